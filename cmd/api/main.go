@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log/slog"
 	"os"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/rsav/k8s-learning/internal/api"
+	"github.com/rsav/k8s-learning/internal/bootstrap"
 	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/health"
 	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+	"github.com/rsav/k8s-learning/internal/tracing"
+	"github.com/rsav/k8s-learning/internal/version"
 )
 
 func main() {
+	migrateOnly := flag.Bool("migrate", false, "apply pending migrations and exit, e.g. from a Job run before rolling out")
+	flag.Parse()
+
 	ctx := context.Background()
 
 	cfg, err := config.Load()
@@ -23,15 +32,54 @@ func main() {
 	log := setupLogger(cfg.Logging.Level, cfg.Logging.Format)
 	slog.SetDefault(log)
 
-	log.InfoContext(ctx, "run migrations")
-	if err := database.RunMigrations(cfg.Database.ConnectionString(), cfg.Database.MigrationsURL, log); err != nil {
-		log.ErrorContext(ctx, "Failed to run migrations", "error", err)
+	stopTelemetry, err := telemetry.Setup(cfg.Metrics, "text-api", log)
+	if err != nil {
+		log.ErrorContext(ctx, "Failed to set up metrics exporters", "error", err)
+		os.Exit(1)
+	}
+	defer stopTelemetry()
+
+	if cfg.Startup.WaitForDependencies {
+		err := health.WaitFor(ctx, cfg.Startup.Timeout, log,
+			health.Dependency{Name: "database", Check: func(ctx context.Context) error { return database.Ping(ctx, cfg.Database) }},
+			health.Dependency{Name: "redis", Check: func(ctx context.Context) error { return queue.Ping(ctx, cfg.Redis) }},
+		)
+		if err != nil {
+			log.ErrorContext(ctx, "Dependencies not available", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *migrateOnly || cfg.Migrations.OnStartup {
+		log.InfoContext(ctx, "run migrations")
+		err := database.RunMigrations(cfg.Database.ConnectionString(), cfg.Database.MigrationsURL, cfg.Migrations.LockTimeout, log)
+		if err != nil {
+			log.ErrorContext(ctx, "Failed to run migrations", "error", err)
+			os.Exit(1)
+		}
+	} else if err := database.CheckSchemaVersion(ctx, cfg.Database, cfg.Database.MigrationsURL); err != nil {
+		// Pending migrations are awaited by the startup probe; only a newer schema stops the start
+		log.ErrorContext(ctx, "Incompatible database schema", "error", err)
 		os.Exit(1)
 	}
+	if *migrateOnly {
+		return
+	}
+
+	buildInfo := version.Get()
+	log.InfoContext(ctx, "Starting text processing API service",
+		"version", buildInfo.Version, "commit", buildInfo.Commit, "build_date", buildInfo.BuildDate)
+	version.RecordBuildInfo("api")
 
-	log.InfoContext(ctx, "Starting text processing API service")
+	runtimeDefaults := config.DefaultRuntime()
+	runtimeDefaults.Storage.MaxFileSize = cfg.Storage.MaxFileSize
+	runtimeConfig, err := config.Watch(ctx, cfg.RuntimeConfigFile, runtimeDefaults, log)
+	if err != nil {
+		log.ErrorContext(ctx, "Failed to load runtime configuration", "error", err)
+		os.Exit(1)
+	}
 
-	server, err := api.NewServer(cfg, log)
+	server, err := bootstrap.APIServer(cfg, runtimeConfig, log)
 	if err != nil {
 		log.ErrorContext(ctx, "Failed to create server", "error", err)
 		os.Exit(1)
@@ -68,5 +116,5 @@ func setupLogger(level, format string) *slog.Logger {
 		handler = slog.NewTextHandler(os.Stdout, opts)
 	}
 
-	return slog.New(handler)
+	return slog.New(tracing.NewLogHandler(handler))
 }
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	manifestFile  = "manifest.json"
+	formatVersion = 1
+
+	databaseDir = "database/"
+	uploadsDir  = "uploads/"
+	resultsDir  = "results/"
+)
+
+// Manifest describes a backup archive. It is the last entry of the archive and lists the SHA-256
+// checksum of every other entry, which restores verify before changing anything.
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// SchemaVersion is the migration version of the dumped tables; restores require the same.
+	SchemaVersion int64 `json:"schema_version"`
+	// UploadDir and ResultDir are the directories the files were backed up from, which the paths
+	// stored in the jobs refer to.
+	UploadDir string  `json:"upload_dir"`
+	ResultDir string  `json:"result_dir"`
+	Entries   []Entry `json:"entries"`
+}
+
+type Entry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// archiveWriter writes a tar.gz backup archive, recording the checksum of every entry.
+type archiveWriter struct {
+	file    *os.File
+	gz      *gzip.Writer
+	tar     *tar.Writer
+	entries []Entry
+}
+
+func createArchive(path string) (*archiveWriter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create archive: %w", err)
+	}
+	gz := gzip.NewWriter(file)
+	return &archiveWriter{file: file, gz: gz, tar: tar.NewWriter(gz)}, nil
+}
+
+// add writes an entry of the given size; content is cut at that size.
+func (a *archiveWriter) add(name string, size int64, modTime time.Time, content io.Reader) error {
+	header := &tar.Header{Name: name, Mode: 0o600, Size: size, ModTime: modTime, Format: tar.FormatPAX}
+	if err := a.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("write header of %s: %w", name, err)
+	}
+
+	checksum := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(a.tar, checksum), content, size); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+
+	a.entries = append(a.entries, Entry{Name: name, Size: size, SHA256: hex.EncodeToString(checksum.Sum(nil))})
+	return nil
+}
+
+// addFile writes the content of an open file as an entry.
+func (a *archiveWriter) addFile(name string, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", file.Name(), err)
+	}
+	return a.add(name, info.Size(), info.ModTime(), file)
+}
+
+// close writes the manifest with the checksums of the entries and closes the archive.
+func (a *archiveWriter) close(manifest Manifest) error {
+	manifest.Entries = a.entries
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode manifest: %w", err)
+	}
+
+	header := &tar.Header{Name: manifestFile, Mode: 0o600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+	if err := a.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("write manifest header: %w", err)
+	}
+	if _, err := a.tar.Write(data); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+
+	return errors.Join(a.tar.Close(), a.gz.Close(), a.file.Close())
+}
+
+// abort closes the archive without completing it.
+func (a *archiveWriter) abort() {
+	_ = a.file.Close()
+}
+
+// readArchive calls visit, when not nil, with every entry of the archive but the manifest, then
+// checks every entry against the checksums of the manifest. Entries are passed on as they are
+// read, so a corrupt archive is only detected at the end: verify an archive before restoring it.
+func readArchive(path string, visit func(name string, content io.Reader) error) (Manifest, error) {
+	var manifest Manifest
+
+	file, err := os.Open(path)
+	if err != nil {
+		return manifest, fmt.Errorf("open archive: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return manifest, fmt.Errorf("open archive: %w", err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	found := make(map[string]Entry)
+	hasManifest := false
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return manifest, fmt.Errorf("read archive: %w", err)
+		}
+
+		if header.Name == manifestFile {
+			if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+				return manifest, fmt.Errorf("read manifest: %w", err)
+			}
+			hasManifest = true
+			continue
+		}
+
+		entry, err := readEntry(header.Name, archive, visit)
+		if err != nil {
+			return manifest, err
+		}
+		found[header.Name] = entry
+	}
+
+	if !hasManifest {
+		return manifest, errors.New("archive has no manifest")
+	}
+	if manifest.FormatVersion != formatVersion {
+		return manifest, fmt.Errorf("unsupported archive format version %d", manifest.FormatVersion)
+	}
+	return manifest, verifyEntries(manifest, found)
+}
+
+func readEntry(name string, content io.Reader, visit func(name string, content io.Reader) error) (Entry, error) {
+	checksum := sha256.New()
+	counter := &countingHash{Hash: checksum}
+	tee := io.TeeReader(content, counter)
+
+	if visit != nil {
+		if err := visit(name, tee); err != nil {
+			return Entry{}, err
+		}
+	}
+	// Hash what the visitor did not read
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return Entry{}, fmt.Errorf("read %s: %w", name, err)
+	}
+
+	return Entry{Name: name, Size: counter.size, SHA256: hex.EncodeToString(checksum.Sum(nil))}, nil
+}
+
+func verifyEntries(manifest Manifest, found map[string]Entry) error {
+	var errs []error
+	for _, want := range manifest.Entries {
+		got, ok := found[want.Name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s is missing", want.Name))
+		case got != want:
+			errs = append(errs, fmt.Errorf("%s does not match its checksum", want.Name))
+		}
+		delete(found, want.Name)
+	}
+	for name := range found {
+		errs = append(errs, fmt.Errorf("%s is not in the manifest", name))
+	}
+	return errors.Join(errs...)
+}
+
+type countingHash struct {
+	hash.Hash
+	size int64
+}
+
+func (c *countingHash) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	return c.Hash.Write(p)
+}
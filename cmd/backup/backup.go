@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// backup writes the tables and the stored files to a tar.gz archive at path. The tables are dumped
+// from one snapshot first; files are copied afterwards, so every file the snapshot refers to is in
+// the archive unless retention removed it in between. The archive is written next to path and
+// renamed into place once complete.
+func backup(ctx context.Context, cfg *config.Backup, path string, log *slog.Logger) error {
+	repo, err := database.NewRepository(cfg.Database, log)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	partial := path + ".partial"
+	archive, err := createArchive(partial)
+	if err != nil {
+		return err
+	}
+	completed := false
+	defer func() {
+		if !completed {
+			archive.abort()
+			_ = os.Remove(partial)
+		}
+	}()
+
+	manifest := Manifest{
+		FormatVersion: formatVersion,
+		CreatedAt:     time.Now().UTC(),
+		UploadDir:     cfg.Storage.UploadDir,
+		ResultDir:     cfg.Storage.ResultDir,
+	}
+
+	if manifest.SchemaVersion, err = backupTables(ctx, repo, archive); err != nil {
+		return err
+	}
+
+	for _, dir := range []struct{ path, prefix string }{
+		{cfg.Storage.UploadDir, uploadsDir},
+		{cfg.Storage.ResultDir, resultsDir},
+	} {
+		if err := backupFiles(ctx, archive, dir.path, dir.prefix, log); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.close(manifest); err != nil {
+		return err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return fmt.Errorf("move archive into place: %w", err)
+	}
+	completed = true
+
+	log.Info("backup written", "file", path, "entries", len(archive.entries), "schema_version", manifest.SchemaVersion)
+	return nil
+}
+
+// backupTables dumps every table as JSON lines. A tar entry needs its size up front, so the rows
+// are spooled to temporary files first.
+func backupTables(ctx context.Context, repo *database.Repository, archive *archiveWriter) (int64, error) {
+	spools := make(map[string]*os.File, len(database.BackupTables))
+	defer func() {
+		for _, spool := range spools {
+			_ = spool.Close()
+			_ = os.Remove(spool.Name())
+		}
+	}()
+	for _, table := range database.BackupTables {
+		spool, err := os.CreateTemp("", "backup-"+table+"-*.jsonl")
+		if err != nil {
+			return 0, fmt.Errorf("create spool file: %w", err)
+		}
+		spools[table] = spool
+	}
+
+	version, err := repo.DumpTables(ctx, func(table string, row []byte) error {
+		if _, err := spools[table].Write(append(row, '\n')); err != nil {
+			return fmt.Errorf("spool %s: %w", table, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, table := range database.BackupTables {
+		spool := spools[table]
+		if _, err := spool.Seek(0, 0); err != nil {
+			return 0, fmt.Errorf("rewind spool: %w", err)
+		}
+		if err := archive.addFile(databaseDir+table+".jsonl", spool); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, nil
+}
+
+// backupFiles adds the files of a storage directory under prefix. Files removed while the backup
+// runs are skipped.
+func backupFiles(ctx context.Context, archive *archiveWriter, dir, prefix string, log *slog.Logger) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("list %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		file, err := os.Open(filepath.Join(dir, entry.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			log.Warn("file removed during backup", "file", entry.Name())
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("open %s: %w", entry.Name(), err)
+		}
+
+		err = archive.addFile(prefix+entry.Name(), file)
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
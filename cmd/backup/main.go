@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+const (
+	modeBackup  = "backup"
+	modeRestore = "restore"
+	modeVerify  = "verify"
+)
+
+func main() {
+	mode := flag.String("mode", modeBackup, "What to do with the archive: backup, restore or verify")
+	file := flag.String("file", "", "Path of the backup archive (tar.gz) to write or read")
+	replace := flag.Bool("replace", false, "Restore over existing jobs and files instead of requiring an empty database")
+	flag.Parse()
+
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, *mode, *file, *replace, log); err != nil {
+		log.Error("backup tool failed", "mode", *mode, "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, mode, file string, replace bool, log *slog.Logger) error {
+	if file == "" {
+		return errors.New("-file is required")
+	}
+
+	if mode == modeVerify {
+		manifest, err := readArchive(file, nil)
+		if err != nil {
+			return err
+		}
+		log.Info("backup verified", "file", file, "entries", len(manifest.Entries),
+			"created_at", manifest.CreatedAt, "schema_version", manifest.SchemaVersion)
+		return nil
+	}
+
+	cfg, err := config.LoadBackup()
+	if err != nil {
+		return fmt.Errorf("load configuration: %w", err)
+	}
+
+	switch mode {
+	case modeBackup:
+		return backup(ctx, cfg, file, log)
+	case modeRestore:
+		return restore(ctx, cfg, file, replace, log)
+	default:
+		return fmt.Errorf("unknown mode: %s", mode)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// jobPathColumns are the columns of the jobs and job_results tables holding paths into the storage
+// directories.
+//
+//nolint:gochecknoglobals // read-only list
+var jobPathColumns = []string{"file_path", "second_file_path", "result_path"}
+
+// restore verifies the archive at path, then restores its tables in one transaction and writes
+// its files to the storage directories. Job paths are moved to the configured directories when
+// the backup was taken from others. The files of a failed restore are left behind for retention
+// to remove.
+func restore(ctx context.Context, cfg *config.Backup, path string, replace bool, log *slog.Logger) error {
+	manifest, err := readArchive(path, nil)
+	if err != nil {
+		return fmt.Errorf("verify archive: %w", err)
+	}
+	log.Info("backup verified", "file", path, "entries", len(manifest.Entries), "created_at", manifest.CreatedAt)
+
+	repo, err := database.NewRepository(cfg.Database, log)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	for _, dir := range []string{cfg.Storage.UploadDir, cfg.Storage.ResultDir} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return fmt.Errorf("create %s: %w", dir, err)
+		}
+	}
+
+	rewrite := pathRewriter(manifest, cfg.Storage)
+	files := 0
+	err = repo.RestoreTables(ctx, manifest.SchemaVersion, replace, func(insert func(table string, row []byte) error) error {
+		_, err := readArchive(path, func(name string, content io.Reader) error {
+			switch {
+			case strings.HasPrefix(name, databaseDir):
+				table := strings.TrimSuffix(strings.TrimPrefix(name, databaseDir), ".jsonl")
+				return restoreRows(table, content, rewrite, insert)
+			case strings.HasPrefix(name, uploadsDir):
+				files++
+				return restoreFile(filepath.Join(cfg.Storage.UploadDir, filepath.Base(name)), content, replace)
+			case strings.HasPrefix(name, resultsDir):
+				files++
+				return restoreFile(filepath.Join(cfg.Storage.ResultDir, filepath.Base(name)), content, replace)
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Info("backup restored", "file", path, "files", files, "schema_version", manifest.SchemaVersion)
+	return nil
+}
+
+func restoreRows(table string, content io.Reader, rewrite func([]byte) ([]byte, error), insert func(table string, row []byte) error) error {
+	reader := bufio.NewReader(content)
+	for {
+		row, err := reader.ReadBytes('\n')
+		if row = bytes.TrimSpace(row); len(row) > 0 {
+			if table == "jobs" || table == "job_results" {
+				if row, err = rewrite(row); err != nil {
+					return err
+				}
+			}
+			if err := insert(table, row); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s rows: %w", table, err)
+		}
+	}
+}
+
+// pathRewriter returns a function moving the paths of a job row from the directories of the backup
+// to the configured ones; rows pass unchanged when they are the same.
+func pathRewriter(manifest Manifest, storage config.Storage) func([]byte) ([]byte, error) {
+	moves := map[string]string{}
+	if manifest.UploadDir != storage.UploadDir {
+		moves[manifest.UploadDir] = storage.UploadDir
+	}
+	if manifest.ResultDir != storage.ResultDir {
+		moves[manifest.ResultDir] = storage.ResultDir
+	}
+	if len(moves) == 0 {
+		return func(row []byte) ([]byte, error) { return row, nil }
+	}
+
+	return func(row []byte) ([]byte, error) {
+		var job map[string]any
+		if err := json.Unmarshal(row, &job); err != nil {
+			return nil, fmt.Errorf("decode job row: %w", err)
+		}
+		for _, column := range jobPathColumns {
+			path, ok := job[column].(string)
+			if !ok {
+				continue
+			}
+			if target, ok := moves[filepath.Dir(path)]; ok {
+				job[column] = filepath.Join(target, filepath.Base(path))
+			}
+		}
+		return json.Marshal(job)
+	}
+}
+
+// restoreFile writes a stored file, refusing to overwrite an existing one unless replace is set.
+func restoreFile(path string, content io.Reader, replace bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if replace {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(path, flags, 0o600)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", path, err)
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+//nolint:forbidigo // CLI tool prints its report to stdout
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+const (
+	serviceAPI        = "api"
+	serviceWorker     = "worker"
+	serviceController = "controller"
+
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// Report is the outcome of a configuration check, safe to print in CI and init container logs.
+type Report struct {
+	Service string        `json:"service"`
+	Valid   bool          `json:"valid"`
+	Error   string        `json:"error,omitempty"`
+	Config  any           `json:"config,omitempty"`
+	Probes  []ProbeResult `json:"probes,omitempty"`
+}
+
+// OK reports whether configuration loaded and every probe succeeded.
+func (r Report) OK() bool {
+	if !r.Valid {
+		return false
+	}
+	for _, p := range r.Probes {
+		if !p.OK {
+			return false
+		}
+	}
+	return true
+}
+
+func main() {
+	service := flag.String("service", serviceAPI, "Service whose configuration to check: api, worker or controller")
+	format := flag.String("format", formatText, "Report format: text or json")
+	skipProbes := flag.Bool("skip-probes", false, "Only validate configuration, skip connectivity probes")
+	timeout := flag.Duration("timeout", 5*time.Second, "Timeout for each connectivity probe") //nolint:mnd // default probe timeout
+	flag.Parse()
+
+	report := check(*service, *skipProbes, *timeout)
+
+	var err error
+	switch *format {
+	case formatJSON:
+		err = writeJSON(os.Stdout, report)
+	case formatText:
+		err = writeText(os.Stdout, report)
+	default:
+		err = fmt.Errorf("unknown format: %s", *format)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "configcheck: %v\n", err)
+		os.Exit(2) //nolint:mnd // distinct exit code for usage errors
+	}
+
+	if !report.OK() {
+		os.Exit(1)
+	}
+}
+
+func check(service string, skipProbes bool, timeout time.Duration) Report {
+	report := Report{Service: service}
+
+	var (
+		probes            []probe
+		runtimeConfigFile string
+	)
+	switch service {
+	case serviceAPI:
+		cfg, err := config.Load()
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		report.Config = cfg.Redacted()
+		probes = []probe{
+			postgresProbe(cfg.Database),
+			redisProbe(cfg.Redis),
+			storageProbe("upload_dir", cfg.Storage.UploadDir),
+			storageProbe("result_dir", cfg.Storage.ResultDir),
+		}
+		runtimeConfigFile = cfg.RuntimeConfigFile
+	case serviceWorker:
+		cfg, err := config.LoadWorker()
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		report.Config = cfg.Redacted()
+		probes = []probe{
+			postgresProbe(cfg.Database),
+			redisProbe(cfg.Redis),
+			storageProbe("upload_dir", cfg.Storage.UploadDir),
+			storageProbe("result_dir", cfg.Storage.ResultDir),
+		}
+		runtimeConfigFile = cfg.RuntimeConfigFile
+	case serviceController:
+		cfg, err := config.LoadController()
+		if err != nil {
+			report.Error = err.Error()
+			return report
+		}
+		report.Config = cfg.Redacted()
+		probes = []probe{
+			redisProbe(cfg.Redis),
+		}
+		runtimeConfigFile = cfg.RuntimeConfigFile
+	default:
+		report.Error = fmt.Sprintf("unknown service: %s", service)
+		return report
+	}
+
+	if runtimeConfigFile != "" {
+		probes = append(probes, runtimeConfigProbe(runtimeConfigFile))
+	}
+
+	report.Valid = true
+	if skipProbes {
+		return report
+	}
+
+	for _, p := range probes {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		report.Probes = append(report.Probes, p.run(ctx))
+		cancel()
+	}
+
+	return report
+}
+
+func writeJSON(w io.Writer, report Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("encode report: %w", err)
+	}
+	return nil
+}
+
+func writeText(w io.Writer, report Report) error {
+	fmt.Fprintf(w, "Service: %s\n", report.Service)
+
+	if !report.Valid {
+		fmt.Fprintf(w, "Configuration: INVALID\n  error: %s\n", report.Error)
+		return nil
+	}
+	fmt.Fprintln(w, "Configuration: valid")
+
+	if len(report.Probes) > 0 {
+		fmt.Fprintln(w, "\nConnectivity:")
+		for _, p := range report.Probes {
+			status := "OK"
+			if !p.OK {
+				status = "FAIL"
+			}
+			fmt.Fprintf(w, "  [%s] %s (%s, %s)\n", status, p.Name, p.Target, p.Duration)
+			if p.Error != "" {
+				fmt.Fprintf(w, "         error: %s\n", p.Error)
+			}
+			if p.Hint != "" {
+				fmt.Fprintf(w, "         hint:  %s\n", p.Hint)
+			}
+		}
+	}
+
+	effective, err := json.MarshalIndent(report.Config, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("encode effective configuration: %w", err)
+	}
+	fmt.Fprintf(w, "\nEffective configuration (secrets redacted):\n  %s\n", effective)
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// ProbeResult describes a single connectivity check.
+type ProbeResult struct {
+	Name     string `json:"name"`
+	Target   string `json:"target"`
+	OK       bool   `json:"ok"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+type probe struct {
+	name   string
+	target string
+	check  func(ctx context.Context) error
+	hints  func(err error) string
+}
+
+func (p probe) run(ctx context.Context) ProbeResult {
+	start := time.Now()
+	err := p.check(ctx)
+
+	result := ProbeResult{
+		Name:     p.name,
+		Target:   p.target,
+		OK:       err == nil,
+		Duration: time.Since(start).Round(time.Millisecond).String(),
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.Hint = p.hints(err)
+	}
+	return result
+}
+
+func postgresProbe(cfg config.Database) probe {
+	return probe{
+		name:   "postgres",
+		target: fmt.Sprintf("%s:%d/%s", cfg.Host, cfg.Port, cfg.Database),
+		check: func(ctx context.Context) error {
+			db, err := sql.Open("pgx", cfg.ConnectionString())
+			if err != nil {
+				return fmt.Errorf("open connection: %w", err)
+			}
+			defer db.Close()
+
+			if err := db.PingContext(ctx); err != nil {
+				return fmt.Errorf("ping: %w", err)
+			}
+			return nil
+		},
+		hints: func(err error) string {
+			msg := err.Error()
+			switch {
+			case strings.Contains(msg, "password authentication failed"):
+				return "check DB_USER and DB_PASSWORD (or the contents of DB_PASSWORD_FILE)"
+			case strings.Contains(msg, "does not exist"):
+				return "check DB_NAME; the database must be created before the services start"
+			case strings.Contains(msg, "SSL"), strings.Contains(msg, "tls"):
+				return "check DB_SSL_MODE; use disable only for local development"
+			default:
+				return networkHint(err, "DB_HOST", "DB_PORT")
+			}
+		},
+	}
+}
+
+func redisProbe(cfg config.Redis) probe {
+	return probe{
+		name:   "redis",
+		target: cfg.Address(),
+		check: func(ctx context.Context) error {
+			client := redis.NewClient(&redis.Options{
+				Addr:     cfg.Address(),
+				Password: cfg.Password,
+				DB:       cfg.Database,
+			})
+			defer client.Close()
+
+			if err := client.Ping(ctx).Err(); err != nil {
+				return fmt.Errorf("ping: %w", err)
+			}
+			return nil
+		},
+		hints: func(err error) string {
+			msg := err.Error()
+			switch {
+			case strings.Contains(msg, "NOAUTH"), strings.Contains(msg, "WRONGPASS"):
+				return "check REDIS_PASSWORD (or the contents of REDIS_PASSWORD_FILE)"
+			case strings.Contains(msg, "DB index is out of range"):
+				return "check REDIS_DB; it must be lower than the server's databases setting"
+			default:
+				return networkHint(err, "REDIS_HOST", "REDIS_PORT")
+			}
+		},
+	}
+}
+
+// storageProbe verifies that dir exists and is writable by creating and removing a temporary file.
+func storageProbe(name, dir string) probe {
+	return probe{
+		name:   name,
+		target: dir,
+		check: func(_ context.Context) error {
+			info, err := os.Stat(dir)
+			if err != nil {
+				return fmt.Errorf("stat directory: %w", err)
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+
+			f, err := os.CreateTemp(dir, ".configcheck-*")
+			if err != nil {
+				return fmt.Errorf("write test file: %w", err)
+			}
+			_ = f.Close()
+
+			if err := os.Remove(f.Name()); err != nil {
+				return fmt.Errorf("remove test file: %w", err)
+			}
+			return nil
+		},
+		hints: func(err error) string {
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				return "create the directory or mount the volume (UPLOAD_DIR/RESULT_DIR)"
+			case errors.Is(err, os.ErrPermission):
+				return "the directory must be writable by the service user; check volume ownership and fsGroup"
+			default:
+				return ""
+			}
+		},
+	}
+}
+
+// runtimeConfigProbe verifies that the hot-reloadable runtime configuration file parses and validates.
+func runtimeConfigProbe(path string) probe {
+	return probe{
+		name:   "runtime_config",
+		target: path,
+		check: func(_ context.Context) error {
+			_, err := config.LoadRuntime(path, config.DefaultRuntime())
+			return err
+		},
+		hints: func(err error) string {
+			if errors.Is(err, os.ErrNotExist) {
+				return "mount the runtime-config ConfigMap or unset RUNTIME_CONFIG_FILE"
+			}
+			return "fix the YAML in the runtime-config ConfigMap; see docs for the expected keys"
+		},
+	}
+}
+
+func networkHint(err error, hostVar, portVar string) string {
+	msg := err.Error()
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), strings.Contains(msg, "i/o timeout"):
+		return fmt.Sprintf("connection timed out; check %s/%s, network policies and firewalls", hostVar, portVar)
+	case strings.Contains(msg, "no such host"):
+		return fmt.Sprintf("%s does not resolve; check the service name and namespace", hostVar)
+	case strings.Contains(msg, "connection refused"):
+		return fmt.Sprintf("nothing is listening at %s/%s; check that the service is running", hostVar, portVar)
+	default:
+		return ""
+	}
+}
@@ -2,26 +2,45 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"flag"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/controller/alerts"
 	"github.com/rsav/k8s-learning/internal/controller/metrics"
 	"github.com/rsav/k8s-learning/internal/controller/scaler"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/federation"
+	"github.com/rsav/k8s-learning/internal/health"
+	"github.com/rsav/k8s-learning/internal/observability"
+	"github.com/rsav/k8s-learning/internal/runtimestats"
+	"github.com/rsav/k8s-learning/internal/secrets"
+	"github.com/rsav/k8s-learning/internal/storage/database"
 	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+	"github.com/rsav/k8s-learning/internal/version"
 )
 
 var (
@@ -46,23 +65,68 @@ func main() {
 
 	// Setup structured logger
 	log := setupLogger(cfg.Logging)
+	buildInfo := version.Get()
+	version.RecordBuildInfo("controller")
 	log.InfoContext(ctx, "starting text processing controller",
-		"version", "v1alpha1",
+		"version", buildInfo.Version,
+		"commit", buildInfo.Commit,
+		"build_date", buildInfo.BuildDate,
 		"server_addr", serverAddr,
 		"leader_election", enableLeaderElection,
-		"reconcile_interval", cfg.ReconcileInterval)
+		"reconcile_interval", cfg.ReconcileInterval,
+		"worker_namespaces", cfg.WorkerNamespaces,
+		"dry_run", cfg.DryRun)
+
+	// Emit metrics to the configured exporters besides Prometheus
+	stopTelemetry, err := telemetry.Setup(cfg.Metrics, controllerComponent, log)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to set up metrics exporters", "error", err)
+		os.Exit(1)
+	}
+	defer stopTelemetry()
 
 	// Initialize components
 	redisQueue := initRedis(ctx, cfg, log)
-	k8sClient := initKubernetesClient()
-	workerScaler := createWorkerScaler(k8sClient, log, redisQueue, cfg)
+	k8sConfig := ctrl.GetConfigOrDie()
+	k8sClient := initKubernetesClient(k8sConfig)
+	recorder, stopRecorder := initEventRecorder(k8sConfig)
+	defer stopRecorder()
+	runtimeConfig := initRuntimeConfig(ctx, cfg, log)
+	fed := initFederation(ctx, cfg, redisQueue, log)
+	workerScaler := createWorkerScaler(k8sClient, log, redisQueue, fed, cfg, recorder, runtimeConfig)
+	checkWorkerAccess(ctx, workerScaler, cfg, log)
+
+	// Evaluate scaling right after jobs are enqueued instead of waiting for the next interval
+	if cfg.ReactiveScaling {
+		go subscribeEnqueued(ctx, redisQueue, workerScaler, log)
+	}
+
+	// Move overflow jobs to regions with spare capacity
+	if fed != nil {
+		go fed.Start(ctx)
+	}
+
+	// Recommend worker requests and limits from observed usage
+	if cfg.ResourceRecommendations {
+		go workerScaler.StartResourceRecommendations(ctx)
+	}
+
+	// Forward job lifecycle events to Kubernetes Events on the worker Deployment
+	if cfg.Events.Enabled(config.EventSinkKubernetes) {
+		go forwardJobEvents(ctx, cfg, k8sClient, log)
+	}
+
+	// Alert on anomalies of the queue and the workers
+	alertEngine := startAlerts(ctx, cfg, redisQueue, recorder, runtimeConfig, log)
 
 	// Start metrics collection
 	metricsCollector := metrics.NewMetricsCollector(redisQueue, log)
 	go metricsCollector.StartPeriodicCollection(ctx, cfg.MetricsCollectionInterval)
+	pushDone := startMetricsPush(ctx, cfg, log)
 
 	// Start server (metrics + health endpoints)
-	server := startServer(ctx, serverAddr, log, redisQueue)
+	server := startServer(ctx, serverAddr, log, redisQueue, workerScaler, alertEngine, adminAuth(ctx, cfg, log),
+		config.EffectiveConfigHandler(cfg.Redacted(), runtimeConfig), cfg.Health, cfg.Metrics)
 
 	// Setup graceful shutdown
 	setupGracefulShutdown(ctx, log, server)
@@ -70,6 +134,30 @@ func main() {
 	// Start worker scaler (blocking)
 	setupLog.Info("starting worker scaler")
 	workerScaler.StartPeriodicScaling(ctx)
+
+	// Let the pusher delete its group before exiting
+	<-pushDone
+}
+
+// startMetricsPush pushes a summary of the metrics for clusters that do not scrape the controller.
+// The returned channel is closed once pushing stopped.
+func startMetricsPush(ctx context.Context, cfg *config.Controller, log *slog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	if !cfg.Metrics.PushEnabled() {
+		close(done)
+		return done
+	}
+
+	pusher, err := observability.NewPusher(cfg.Metrics, "controller", observability.ControllerPushedMetrics, log)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to create metrics pusher", "error", err)
+		os.Exit(1)
+	}
+	go func() {
+		defer close(done)
+		pusher.Start(ctx)
+	}()
+	return done
 }
 
 func parseFlags() (string, bool) {
@@ -98,17 +186,80 @@ func loadConfig() *config.Controller {
 }
 
 func initRedis(ctx context.Context, cfg *config.Controller, log *slog.Logger) *queue.RedisQueue {
+	if cfg.Startup.WaitForDependencies {
+		err := health.WaitFor(ctx, cfg.Startup.Timeout, log,
+			health.Dependency{Name: "redis", Check: func(ctx context.Context) error { return queue.Ping(ctx, cfg.Redis) }},
+		)
+		if err != nil {
+			log.ErrorContext(ctx, "redis not available", "error", err)
+			os.Exit(1)
+		}
+	}
+
 	redisQueue, err := queue.NewRedisQueue(cfg.Redis, log)
 	if err != nil {
 		log.ErrorContext(ctx, "failed to connect to Redis", "error", err)
 		os.Exit(1)
 	}
 	log.InfoContext(ctx, "Redis connection established for queue monitoring")
+
+	if err := secrets.WatchFile(ctx, cfg.Redis.PasswordFile, log, redisQueue.RotatePassword); err != nil {
+		log.ErrorContext(ctx, "failed to watch redis password file", "error", err)
+		os.Exit(1)
+	}
 	return redisQueue
 }
 
-func initKubernetesClient() client.Client {
-	k8sConfig := ctrl.GetConfigOrDie()
+// initFederation connects to the queues of the other regions, nil when none are configured.
+func initFederation(ctx context.Context, cfg *config.Controller, redisQueue *queue.RedisQueue, log *slog.Logger) *federation.Federation {
+	if !cfg.Federation.Enabled() {
+		return nil
+	}
+
+	fed, err := federation.New(cfg.Federation, cfg.Redis, redisQueue, log)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to initialize queue federation", "error", err)
+		os.Exit(1)
+	}
+
+	// Remote regions are reached with the local credentials
+	if err := secrets.WatchFile(ctx, cfg.Redis.PasswordFile, log, fed.RotatePassword); err != nil {
+		log.ErrorContext(ctx, "failed to watch redis password file", "error", err)
+		os.Exit(1)
+	}
+	return fed
+}
+
+// adminAuth returns a middleware serving only requests carrying the admin token, which is reloaded
+// from ADMIN_TOKEN_FILE when it changes. Without a token every request is rejected.
+func adminAuth(ctx context.Context, cfg *config.Controller, log *slog.Logger) func(http.Handler) http.Handler {
+	var token atomic.Pointer[string]
+	token.Store(&cfg.AdminToken)
+	if err := secrets.WatchFile(ctx, cfg.AdminTokenFile, log, func(rotated string) {
+		token.Store(&rotated)
+		log.Info("controller admin token rotated")
+	}); err != nil {
+		log.ErrorContext(ctx, "failed to watch admin token file", "error", err)
+		os.Exit(1)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expected := *token.Load()
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if expected == "" || !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+				log.WarnContext(r.Context(), "rejected controller admin request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func initKubernetesClient(k8sConfig *rest.Config) client.Client {
 	k8sClient, err := client.New(k8sConfig, client.Options{Scheme: scheme})
 	if err != nil {
 		setupLog.Error(err, "unable to create Kubernetes client")
@@ -117,44 +268,153 @@ func initKubernetesClient() client.Client {
 	return k8sClient
 }
 
-func createWorkerScaler(k8sClient client.Client, log *slog.Logger, redisQueue *queue.RedisQueue, cfg *config.Controller) *scaler.Worker {
-	return &scaler.Worker{
-		Client: k8sClient,
-		Log:    log,
-		Queue:  redisQueue,
-		Config: *cfg,
+// initEventRecorder creates a recorder that publishes Kubernetes Events for scaling decisions.
+func initEventRecorder(k8sConfig *rest.Config) (record.EventRecorder, func()) {
+	clientset, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		setupLog.Error(err, "unable to create Kubernetes clientset")
+		os.Exit(1)
 	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	recorder := broadcaster.NewRecorder(scheme, corev1.EventSource{Component: controllerComponent})
+
+	return recorder, broadcaster.Shutdown
 }
 
-func startServer(ctx context.Context, addr string, log *slog.Logger, redisQueue *queue.RedisQueue) *http.Server {
-	mux := http.NewServeMux()
+func initRuntimeConfig(ctx context.Context, cfg *config.Controller, log *slog.Logger) *config.RuntimeWatcher {
+	runtimeConfig, err := config.Watch(ctx, cfg.RuntimeConfigFile, config.DefaultRuntime(), log)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to load runtime configuration", "error", err)
+		os.Exit(1)
+	}
+	return runtimeConfig
+}
 
-	// Prometheus metrics
-	mux.Handle("/metrics", promhttp.Handler())
+func createWorkerScaler(
+	k8sClient client.Client, log *slog.Logger, redisQueue *queue.RedisQueue, fed *federation.Federation,
+	cfg *config.Controller, recorder record.EventRecorder, runtimeConfig *config.RuntimeWatcher,
+) *scaler.Worker {
+	return &scaler.Worker{
+		Client:     k8sClient,
+		Log:        log,
+		Queue:      redisQueue,
+		Config:     *cfg,
+		Recorder:   recorder,
+		Runtime:    runtimeConfig,
+		Federation: fed,
+	}
+}
 
-	// Liveness check - basic check that process is running
-	mux.HandleFunc("/livez", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
-	})
+// checkWorkerAccess exits when RBAC keeps the controller from managing the worker Deployments.
+func checkWorkerAccess(ctx context.Context, workerScaler *scaler.Worker, cfg *config.Controller, log *slog.Logger) {
+	if err := workerScaler.CheckAccess(ctx); err != nil {
+		log.ErrorContext(ctx, "controller lacks permissions on worker namespaces, "+
+			"bind the controller role in each of them or use a ClusterRoleBinding",
+			"namespaces", cfg.WorkerNamespaces, "error", err)
+		os.Exit(1)
+	}
+}
 
-	// Alias for livez
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
+func subscribeEnqueued(ctx context.Context, redisQueue *queue.RedisQueue, workerScaler *scaler.Worker, log *slog.Logger) {
+	log.InfoContext(ctx, "triggering scaling on enqueued jobs", "channel", queue.EnqueuedChannel)
+	err := redisQueue.SubscribeEnqueued(ctx, func(database.ProcessingType) {
+		workerScaler.Trigger()
 	})
+	if err != nil {
+		log.ErrorContext(ctx, "enqueued job subscription failed, relying on periodic scaling", "error", err)
+	}
+}
 
-	// Readiness check - verify Redis connectivity
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		if err := redisQueue.HealthCheck(r.Context()); err != nil {
-			log.ErrorContext(r.Context(), "redis health check failed", "error", err)
-			w.WriteHeader(http.StatusServiceUnavailable)
-			_, _ = w.Write([]byte("NOT READY"))
-			return
+func forwardJobEvents(ctx context.Context, cfg *config.Controller, k8sClient client.Client, log *slog.Logger) {
+	sink := events.NewKubernetesSink(k8sClient, corev1.ObjectReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       cfg.EventsDeployment,
+		Namespace:  cfg.WorkerNamespaces[0],
+	}, controllerComponent)
+
+	log.InfoContext(ctx, "forwarding job events to Kubernetes", "channel", cfg.Events.RedisChannel)
+	err := events.Subscribe(ctx, cfg.Redis, cfg.Events.RedisChannel, func(ctx context.Context, event events.Event) {
+		if err := sink.Publish(ctx, event); err != nil {
+			log.ErrorContext(ctx, "failed to record Kubernetes event", "event_type", event.Type, "job_id", event.JobID, "error", err)
 		}
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
 	})
+	if err != nil {
+		log.ErrorContext(ctx, "job event subscription failed", "error", err)
+	}
+}
+
+// startAlerts evaluates the alert rules in the background, nil when alerts are disabled. Rules in
+// the runtime configuration replace those of the environment.
+func startAlerts(
+	ctx context.Context, cfg *config.Controller, redisQueue *queue.RedisQueue, recorder record.EventRecorder,
+	runtimeConfig *config.RuntimeWatcher, log *slog.Logger,
+) *alerts.Engine {
+	if !cfg.Alerts.Enabled {
+		return nil
+	}
+
+	rules := func() []config.AlertRule {
+		if rules := runtimeConfig.Current().Alerts.Rules; len(rules) > 0 {
+			return rules
+		}
+		return cfg.Alerts.Rules()
+	}
+
+	notifiers := []alerts.Notifier{alerts.NewKubernetesNotifier(recorder, corev1.ObjectReference{
+		APIVersion: "apps/v1",
+		Kind:       "Deployment",
+		Name:       cfg.EventsDeployment,
+		Namespace:  cfg.WorkerNamespaces[0],
+	})}
+	if cfg.Alerts.WebhookURL != "" {
+		notifiers = append(notifiers, alerts.NewWebhookNotifier(cfg.Alerts.WebhookURL, cfg.Alerts.NotifyTimeout))
+	}
+	if cfg.Alerts.SlackWebhookURL != "" {
+		notifiers = append(notifiers, alerts.NewSlackNotifier(cfg.Alerts.SlackWebhookURL, cfg.Alerts.NotifyTimeout))
+	}
+
+	engine := alerts.NewEngine(redisQueue, rules, notifiers, log)
+	go engine.Start(ctx, cfg.Alerts.EvaluationInterval)
+	return engine
+}
+
+func startServer(
+	ctx context.Context, addr string, log *slog.Logger, redisQueue *queue.RedisQueue, workerScaler *scaler.Worker,
+	alertEngine *alerts.Engine, adminAuth func(http.Handler) http.Handler, configHandler http.Handler,
+	healthCfg config.Health, metricsCfg config.Metrics,
+) *http.Server {
+	mux := http.NewServeMux()
+
+	// Recent scaling decisions, including those skipped in dry-run mode
+	mux.HandleFunc("GET /api/v1/scaling", workerScaler.StateHandler)
+	mux.HandleFunc("GET /api/v1/scaling/history", workerScaler.HistoryHandler)
+	mux.HandleFunc("GET /api/v1/scaling/resources", workerScaler.ResourcesHandler)
+
+	// Current state of the alert rules
+	if alertEngine != nil {
+		mux.HandleFunc("GET /api/v1/alerts", alertEngine.Handler)
+	}
+
+	// Effective configuration (secrets redacted; bearer token from ADMIN_TOKEN)
+	mux.Handle("/debug/config", adminAuth(configHandler))
+	// Goroutines, memory and file descriptors, sampled by soak tests for leaks (bearer token from ADMIN_TOKEN)
+	mux.Handle("/debug/runtime", adminAuth(http.HandlerFunc(runtimestats.Handler)))
+	mux.HandleFunc("/version", version.Handler)
+
+	// Prometheus metrics
+	if metricsCfg.Exports(config.MetricsExporterPrometheus) {
+		mux.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}))
+	}
+
+	// Health endpoints, ready while Redis is reachable
+	checker := health.NewChecker(controllerComponent, healthCfg.CacheTTL, healthCfg.CheckTimeout, log)
+	checker.Critical("redis", redisQueue.HealthCheck)
+	checker.Register(mux)
 
 	server := &http.Server{
 		Addr:              addr,
@@ -171,6 +431,7 @@ func startServer(ctx context.Context, addr string, log *slog.Logger, redisQueue
 }
 
 const (
+	controllerComponent   = "text-controller"
 	shutdownTimeout       = 30 * time.Second
 	httpReadHeaderTimeout = 5 * time.Second
 )
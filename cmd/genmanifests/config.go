@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+const (
+	appConfigName     = "app-config"
+	appSecretsName    = "app-secrets"
+	runtimeConfigName = "runtime-config"
+	runtimeConfigDir  = "/etc/k8s-learning/runtime"
+	runtimeConfigFile = "runtime.yaml"
+
+	uploadDir    = "/app/uploads"
+	resultDir    = "/app/results"
+	uploadTmpDir = "/app/upload-tmp"
+
+	postgresService = "postgres-service"
+	redisService    = "redis-service"
+	databaseName    = "textprocessing"
+)
+
+// appConfig returns the environment shared by the api, worker and controller: the defaults of
+// their configuration, with the settings that differ inside the cluster.
+func appConfig(opts Options) map[string]string {
+	env := make(map[string]string)
+	for _, spec := range []any{&config.API{}, &config.Worker{}, &config.Controller{}} {
+		maps.Copy(env, config.EnvDefaults(spec))
+	}
+
+	maps.Copy(env, map[string]string{
+		"DB_NAME":               databaseName,
+		"DB_MIGRATIONS_URL":     "file:///app/migrations",
+		"UPLOAD_DIR":            uploadDir,
+		"RESULT_DIR":            resultDir,
+		"UPLOAD_TEMP_DIR":       uploadTmpDir,
+		"RUNTIME_CONFIG_FILE":   runtimeConfigDir + "/" + runtimeConfigFile,
+		"WAIT_FOR_DEPENDENCIES": "true",
+		"WORKER_NAMESPACES":     opts.Namespace,
+	})
+
+	env["DB_HOST"] = opts.DBHost
+	if opts.Postgres {
+		env["DB_HOST"] = postgresService
+		// The bundled PostgreSQL serves no TLS
+		env["DB_SSL_MODE"] = "disable"
+	}
+
+	env["REDIS_HOST"] = opts.RedisHost
+	if opts.Redis {
+		env["REDIS_HOST"] = redisService
+	}
+
+	return env
+}
+
+func configMaps(opts Options) ([]any, error) {
+	runtime, err := yaml.Marshal(config.DefaultRuntime())
+	if err != nil {
+		return nil, fmt.Errorf("encode runtime configuration: %w", err)
+	}
+
+	return []any{
+		&corev1.ConfigMap{
+			TypeMeta:   typeMeta("v1", "ConfigMap"),
+			ObjectMeta: objectMeta(opts, appConfigName, projectLabels()),
+			Data:       appConfig(opts),
+		},
+		&corev1.ConfigMap{
+			TypeMeta:   typeMeta("v1", "ConfigMap"),
+			ObjectMeta: objectMeta(opts, runtimeConfigName, projectLabels()),
+			Data:       map[string]string{runtimeConfigFile: string(runtime)},
+		},
+	}, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	postgresPort = 5432
+	redisPort    = 6379
+)
+
+func execProbe(periodSeconds int32, command ...string) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler:  corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: command}},
+		PeriodSeconds: periodSeconds,
+	}
+}
+
+func dependencyResources(cpuRequest, memoryRequest, cpuLimit, memoryLimit string) corev1.ResourceRequirements {
+	return resources(Options{CPURequest: cpuRequest, MemoryRequest: memoryRequest, CPULimit: cpuLimit, MemoryLimit: memoryLimit})
+}
+
+func dependencyService(opts Options, name string, labels map[string]string, port int32) *corev1.Service {
+	svc := service(opts, name, labels, port)
+	svc.Spec.Ports = []corev1.ServicePort{{Name: labels["app"], Port: port, TargetPort: intstr.FromInt32(port)}}
+	return svc
+}
+
+// postgres returns a single-instance PostgreSQL that creates the database on first start, with the
+// credentials from the app Secret.
+func postgres(opts Options) []any {
+	labels := appLabels("postgres", "database")
+
+	secretKey := func(key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: appSecretsName}, Key: key,
+		}}
+	}
+
+	readiness := execProbe(5, "pg_isready", "-U", "postgres") //nolint:mnd // probe period in seconds
+	container := corev1.Container{
+		Name:  "postgres",
+		Image: "postgres:15-alpine",
+		Ports: []corev1.ContainerPort{{Name: "postgres", ContainerPort: postgresPort}},
+		Env: []corev1.EnvVar{
+			{Name: "POSTGRES_DB", Value: databaseName},
+			{Name: "POSTGRES_USER", ValueFrom: secretKey("DB_USER")},
+			{Name: "POSTGRES_PASSWORD", ValueFrom: secretKey("DB_PASSWORD")},
+			{Name: "PGDATA", Value: "/var/lib/postgresql/data/pgdata"},
+		},
+		VolumeMounts:   []corev1.VolumeMount{{Name: "postgres-storage", MountPath: "/var/lib/postgresql/data"}},
+		Resources:      dependencyResources("250m", "256Mi", "500m", "512Mi"),
+		LivenessProbe:  execProbe(10, "pg_isready", "-U", "postgres"), //nolint:mnd // probe period in seconds
+		ReadinessProbe: readiness,
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: objectMeta(Options{}, "", labels),
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{container},
+			Volumes:    []corev1.Volume{claimVolume("postgres-storage", "postgres-pvc")},
+		},
+	}
+
+	return []any{
+		persistentVolumeClaim(opts, "postgres-pvc", map[string]string{"app": "postgres"}, corev1.ReadWriteOnce, "1Gi"),
+		deployment(opts, "postgres", labels, 1, template),
+		dependencyService(opts, postgresService, labels, postgresPort),
+	}
+}
+
+// redis returns a single-instance Redis with an append-only file on a persistent volume.
+func redis(opts Options) []any {
+	labels := appLabels("redis", "cache")
+
+	container := corev1.Container{
+		Name:           "redis",
+		Image:          "redis:7-alpine",
+		Ports:          []corev1.ContainerPort{{Name: "redis", ContainerPort: redisPort}},
+		Command:        []string{"redis-server", "--appendonly", "yes"},
+		VolumeMounts:   []corev1.VolumeMount{{Name: "redis-storage", MountPath: "/data"}},
+		Resources:      dependencyResources("100m", "128Mi", "200m", "256Mi"),
+		LivenessProbe:  execProbe(10, "redis-cli", "ping"), //nolint:mnd // probe period in seconds
+		ReadinessProbe: execProbe(5, "redis-cli", "ping"),  //nolint:mnd // probe period in seconds
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: objectMeta(Options{}, "", labels),
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{container},
+			Volumes:    []corev1.Volume{claimVolume("redis-storage", "redis-pvc")},
+		},
+	}
+
+	return []any{
+		persistentVolumeClaim(opts, "redis-pvc", map[string]string{"app": "redis"}, corev1.ReadWriteOnce, "1Gi"),
+		deployment(opts, "redis", labels, 1, template),
+		dependencyService(opts, redisService, labels, redisPort),
+	}
+}
@@ -0,0 +1,195 @@
+//nolint:forbidigo // CLI tool prints the manifests to stdout
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+const defaultReplicas = 2
+
+// Options are the deployment choices the manifests are rendered with; everything else follows the
+// defaults of the service configuration.
+type Options struct {
+	Namespace      string
+	Registry       string
+	Tag            string
+	PullPolicy     string
+	APIReplicas    int
+	WorkerReplicas int
+	CPURequest     string
+	MemoryRequest  string
+	CPULimit       string
+	MemoryLimit    string
+	Postgres       bool
+	Redis          bool
+	DBHost         string
+	RedisHost      string
+	ServiceMonitor bool
+}
+
+func main() {
+	var opts Options
+	flag.StringVar(&opts.Namespace, "namespace", "k8s-learning", "Namespace to deploy to")
+	flag.StringVar(&opts.Registry, "registry", "k8s-learning", "Image repository prefix: <registry>/api:<tag>")
+	flag.StringVar(&opts.Tag, "tag", "latest", "Image tag of the api, worker and controller")
+	flag.StringVar(&opts.PullPolicy, "pull-policy", "IfNotPresent", "Image pull policy: Always, IfNotPresent or Never")
+	flag.IntVar(&opts.APIReplicas, "api-replicas", defaultReplicas, "API replicas")
+	flag.IntVar(&opts.WorkerReplicas, "worker-replicas", defaultReplicas, "Initial worker replicas, scaled by the controller afterwards")
+	flag.StringVar(&opts.CPURequest, "cpu-request", "100m", "CPU request of the api, worker and controller")
+	flag.StringVar(&opts.MemoryRequest, "memory-request", "128Mi", "Memory request of the api, worker and controller")
+	flag.StringVar(&opts.CPULimit, "cpu-limit", "500m", "CPU limit of the api, worker and controller")
+	flag.StringVar(&opts.MemoryLimit, "memory-limit", "512Mi", "Memory limit of the api, worker and controller")
+	flag.BoolVar(&opts.Postgres, "postgres", true, "Deploy PostgreSQL in the namespace; disable to use an external database")
+	flag.BoolVar(&opts.Redis, "redis", true, "Deploy Redis in the namespace; disable to use an external Redis")
+	flag.StringVar(&opts.DBHost, "db-host", "", "Host of the external database, required with -postgres=false")
+	flag.StringVar(&opts.RedisHost, "redis-host", "", "Host of the external Redis, required with -redis=false")
+	flag.BoolVar(&opts.ServiceMonitor, "service-monitors", false, "Render Prometheus Operator ServiceMonitors")
+	output := flag.String("o", "", "File to write the manifests to; stdout when empty")
+	flag.Parse()
+
+	if err := run(opts, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "genmanifests: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts Options, output string) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	objects, err := manifests(opts)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("create output file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	return render(out, objects)
+}
+
+// Validate checks the options before anything is rendered.
+func (o Options) Validate() error {
+	if o.Namespace == "" {
+		return errors.New("namespace is required")
+	}
+
+	if !o.Postgres && o.DBHost == "" {
+		return errors.New("an external database needs -db-host")
+	}
+
+	if !o.Redis && o.RedisHost == "" {
+		return errors.New("an external Redis needs -redis-host")
+	}
+
+	switch o.PullPolicy {
+	case "Always", "IfNotPresent", "Never":
+	default:
+		return fmt.Errorf("invalid pull policy: %s", o.PullPolicy)
+	}
+
+	if o.APIReplicas <= 0 || o.WorkerReplicas < 0 {
+		return errors.New("api replicas must be positive and worker replicas not negative")
+	}
+
+	for _, quantity := range []string{o.CPURequest, o.MemoryRequest, o.CPULimit, o.MemoryLimit} {
+		if _, err := resource.ParseQuantity(quantity); err != nil {
+			return fmt.Errorf("invalid resource quantity %q: %w", quantity, err)
+		}
+	}
+
+	return nil
+}
+
+// manifests returns every object to deploy, in the order they are applied.
+func manifests(opts Options) ([]any, error) {
+	configMaps, err := configMaps(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	objects := []any{namespace(opts)}
+	objects = append(objects, configMaps...)
+	if opts.Postgres {
+		objects = append(objects, postgres(opts)...)
+	}
+	if opts.Redis {
+		objects = append(objects, redis(opts)...)
+	}
+	objects = append(objects, api(opts)...)
+	objects = append(objects, worker(opts)...)
+	objects = append(objects, controller(opts)...)
+	if opts.ServiceMonitor {
+		objects = append(objects, serviceMonitors(opts)...)
+	}
+	return objects, nil
+}
+
+// render writes the objects as a multi-document YAML stream.
+func render(w io.Writer, objects []any) error {
+	var buf bytes.Buffer
+	for i, object := range objects {
+		data, err := json.Marshal(object)
+		if err != nil {
+			return fmt.Errorf("encode manifest: %w", err)
+		}
+
+		// Drop what the typed objects leave empty: status, creation timestamps and unset structs.
+		// None of the rendered objects relies on an empty object, such as emptyDir: {}.
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("decode manifest: %w", err)
+		}
+		prune(doc)
+
+		out, err := yaml.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("encode manifest: %w", err)
+		}
+
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(out)
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func prune(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, field := range v {
+			if field == nil {
+				delete(v, key)
+				continue
+			}
+			prune(field)
+			if m, ok := field.(map[string]any); ok && len(m) == 0 {
+				delete(v, key)
+			}
+		}
+	case []any:
+		for _, item := range v {
+			prune(item)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+// serviceMonitors returns Prometheus Operator ServiceMonitors scraping the metrics endpoints of the
+// api and controller Services. Workers have no Service, so their pods are scraped by a PodMonitor.
+// The operator's types are not a dependency of this module, so the objects are built as maps.
+func serviceMonitors(opts Options) []any {
+	endpoint := map[string]any{"port": "http", "path": "/metrics", "interval": "30s"}
+
+	monitor := func(kind, name, app string, endpointsKey string) map[string]any {
+		return map[string]any{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       kind,
+			"metadata": map[string]any{
+				"name":      name,
+				"namespace": opts.Namespace,
+				"labels":    map[string]any{"app": app},
+			},
+			"spec": map[string]any{
+				"selector":   map[string]any{"matchLabels": map[string]any{"app": app}},
+				endpointsKey: []any{endpoint},
+			},
+		}
+	}
+
+	return []any{
+		monitor("ServiceMonitor", "api", "api", "endpoints"),
+		monitor("ServiceMonitor", "controller", "controller", "endpoints"),
+		monitor("PodMonitor", "worker", "worker", "podMetricsEndpoints"),
+	}
+}
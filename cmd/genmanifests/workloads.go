@@ -0,0 +1,279 @@
+package main
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	httpPort = 8080
+
+	// startupFailureThreshold probes every startupPeriodSeconds cover the default STARTUP_TIMEOUT
+	// of 5m the services wait for their dependencies.
+	startupPeriodSeconds    = 5
+	startupFailureThreshold = 60
+
+	controllerServiceAccount = "controller"
+	nobodyUID                = 65534
+)
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
+
+func typeMeta(apiVersion, kind string) metav1.TypeMeta {
+	return metav1.TypeMeta{APIVersion: apiVersion, Kind: kind}
+}
+
+func objectMeta(opts Options, name string, labels map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: opts.Namespace, Labels: labels}
+}
+
+func projectLabels() map[string]string {
+	return map[string]string{"app": "k8s-learning"}
+}
+
+func appLabels(app, component string) map[string]string {
+	return map[string]string{"app": app, "component": component}
+}
+
+func namespace(opts Options) *corev1.Namespace {
+	return &corev1.Namespace{
+		TypeMeta:   typeMeta("v1", "Namespace"),
+		ObjectMeta: metav1.ObjectMeta{Name: opts.Namespace, Labels: projectLabels()},
+	}
+}
+
+func image(opts Options, name string) string {
+	return opts.Registry + "/" + name + ":" + opts.Tag
+}
+
+func resources(opts Options) corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(opts.CPURequest),
+			corev1.ResourceMemory: resource.MustParse(opts.MemoryRequest),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(opts.CPULimit),
+			corev1.ResourceMemory: resource.MustParse(opts.MemoryLimit),
+		},
+	}
+}
+
+func httpProbe(path string, periodSeconds int32) *corev1.Probe {
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			HTTPGet: &corev1.HTTPGetAction{Path: path, Port: intstr.FromInt32(httpPort)},
+		},
+		PeriodSeconds: periodSeconds,
+	}
+}
+
+// appContainer returns a container of one of the services, configured from the shared ConfigMap
+// and Secret and probed on the health endpoints every service serves.
+func appContainer(opts Options, name string) corev1.Container {
+	startup := httpProbe("/startupz", startupPeriodSeconds)
+	startup.FailureThreshold = startupFailureThreshold
+
+	return corev1.Container{
+		Name:            name,
+		Image:           image(opts, name),
+		ImagePullPolicy: corev1.PullPolicy(opts.PullPolicy),
+		Ports:           []corev1.ContainerPort{{Name: "http", ContainerPort: httpPort, Protocol: corev1.ProtocolTCP}},
+		EnvFrom: []corev1.EnvFromSource{
+			{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: appConfigName}}},
+			{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: appSecretsName}}},
+		},
+		VolumeMounts:   []corev1.VolumeMount{{Name: runtimeConfigName, MountPath: runtimeConfigDir, ReadOnly: true}},
+		Resources:      resources(opts),
+		StartupProbe:   startup,
+		LivenessProbe:  httpProbe("/livez", 10), //nolint:mnd // probe period in seconds
+		ReadinessProbe: httpProbe("/readyz", 5), //nolint:mnd // probe period in seconds
+	}
+}
+
+// podTemplate returns a pod template scraped by Prometheus on the metrics endpoint.
+func podTemplate(labels map[string]string, spec corev1.PodSpec) corev1.PodTemplateSpec {
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: runtimeConfigName,
+		VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: runtimeConfigName}},
+		},
+	})
+
+	return corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+			Annotations: map[string]string{
+				"prometheus.io/scrape": "true",
+				"prometheus.io/port":   "8080",
+				"prometheus.io/path":   "/metrics",
+			},
+		},
+		Spec: spec,
+	}
+}
+
+func deployment(opts Options, name string, labels map[string]string, replicas int, template corev1.PodTemplateSpec) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		TypeMeta:   typeMeta("apps/v1", "Deployment"),
+		ObjectMeta: objectMeta(opts, name, labels),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptrTo(int32(replicas)), //nolint:gosec // replica counts are small
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": labels["app"]}},
+			Template: template,
+		},
+	}
+}
+
+func service(opts Options, name string, labels map[string]string, port int32) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta:   typeMeta("v1", "Service"),
+		ObjectMeta: objectMeta(opts, name, labels),
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{"app": labels["app"]},
+			Ports:    []corev1.ServicePort{{Name: "http", Port: port, TargetPort: intstr.FromInt32(port)}},
+		},
+	}
+}
+
+func persistentVolumeClaim(opts Options, name string, labels map[string]string, mode corev1.PersistentVolumeAccessMode, size string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		TypeMeta:   typeMeta("v1", "PersistentVolumeClaim"),
+		ObjectMeta: objectMeta(opts, name, labels),
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{mode},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+}
+
+func claimVolume(name, claim string) corev1.Volume {
+	return corev1.Volume{
+		Name:         name,
+		VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim}},
+	}
+}
+
+// api returns the API Deployment and Service, and the volumes for uploads and results it shares
+// with the workers.
+func api(opts Options) []any {
+	labels := appLabels("api", "backend")
+
+	container := appContainer(opts, "api")
+	container.VolumeMounts = append(container.VolumeMounts,
+		corev1.VolumeMount{Name: "uploads-storage", MountPath: uploadDir},
+		corev1.VolumeMount{Name: "results-storage", MountPath: resultDir},
+		corev1.VolumeMount{Name: "upload-tmp", MountPath: uploadTmpDir},
+	)
+
+	template := podTemplate(labels, corev1.PodSpec{
+		Containers: []corev1.Container{container},
+		Volumes: []corev1.Volume{
+			claimVolume("uploads-storage", "uploads-pvc"),
+			claimVolume("results-storage", "results-pvc"),
+			// Sized above the default UPLOAD_TEMP_DISK_LIMIT of 1GiB
+			{Name: "upload-tmp", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{
+				SizeLimit: ptrTo(resource.MustParse("1536Mi")),
+			}}},
+		},
+	})
+
+	return []any{
+		persistentVolumeClaim(opts, "uploads-pvc", map[string]string{"app": "api", "purpose": "uploads"}, corev1.ReadWriteMany, "2Gi"),
+		persistentVolumeClaim(opts, "results-pvc", map[string]string{"app": "api", "purpose": "results"}, corev1.ReadWriteMany, "2Gi"),
+		deployment(opts, "api", labels, opts.APIReplicas, template),
+		service(opts, "api", labels, httpPort),
+	}
+}
+
+// worker returns the worker Deployment consuming every processing type, scaled by the controller.
+func worker(opts Options) []any {
+	labels := appLabels("worker", "processor")
+
+	container := appContainer(opts, "worker")
+	container.Env = []corev1.EnvVar{{
+		Name:      "WORKER_ID",
+		ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}},
+	}}
+	container.VolumeMounts = append(container.VolumeMounts,
+		corev1.VolumeMount{Name: "uploads-storage", MountPath: uploadDir, ReadOnly: true},
+		corev1.VolumeMount{Name: "results-storage", MountPath: resultDir},
+	)
+
+	template := podTemplate(labels, corev1.PodSpec{
+		Containers: []corev1.Container{container},
+		Volumes: []corev1.Volume{
+			claimVolume("uploads-storage", "uploads-pvc"),
+			claimVolume("results-storage", "results-pvc"),
+		},
+	})
+
+	return []any{deployment(opts, "worker", labels, opts.WorkerReplicas, template)}
+}
+
+// controller returns the scaling controller with the RBAC it needs to scale worker Deployments.
+func controller(opts Options) []any {
+	labels := appLabels("controller", "controller")
+
+	container := appContainer(opts, "controller")
+	container.SecurityContext = &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptrTo(false),
+		ReadOnlyRootFilesystem:   ptrTo(true),
+		RunAsNonRoot:             ptrTo(true),
+		RunAsUser:                ptrTo(int64(nobodyUID)),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+	}
+
+	template := podTemplate(labels, corev1.PodSpec{
+		ServiceAccountName: controllerServiceAccount,
+		Containers:         []corev1.Container{container},
+		SecurityContext: &corev1.PodSecurityContext{
+			RunAsNonRoot:   ptrTo(true),
+			SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+		},
+	})
+
+	// Cluster-scoped names carry the namespace, so several installations can share a cluster
+	roleName := opts.Namespace + "-controller"
+	return []any{
+		&corev1.ServiceAccount{
+			TypeMeta:   typeMeta("v1", "ServiceAccount"),
+			ObjectMeta: objectMeta(opts, controllerServiceAccount, map[string]string{"app": "controller"}),
+		},
+		&rbacv1.ClusterRole{
+			TypeMeta:   typeMeta("rbac.authorization.k8s.io/v1", "ClusterRole"),
+			ObjectMeta: metav1.ObjectMeta{Name: roleName, Labels: map[string]string{"app": "controller"}},
+			Rules: []rbacv1.PolicyRule{
+				// Scaling worker Deployments
+				{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "list", "patch", "update", "watch"}},
+				// Nodes and pods for the cluster capacity guard
+				{APIGroups: []string{""}, Resources: []string{"nodes", "pods"}, Verbs: []string{"list"}},
+				// Pod metrics for worker resource recommendations
+				{APIGroups: []string{"metrics.k8s.io"}, Resources: []string{"pods"}, Verbs: []string{"get", "list"}},
+				// Events on the worker Deployment
+				{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create", "patch"}},
+				// Leader election
+				{APIGroups: []string{"coordination.k8s.io"}, Resources: []string{"leases"}, Verbs: []string{"create", "get", "list", "update"}},
+			},
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   typeMeta("rbac.authorization.k8s.io/v1", "ClusterRoleBinding"),
+			ObjectMeta: metav1.ObjectMeta{Name: roleName, Labels: map[string]string{"app": "controller"}},
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: roleName},
+			Subjects: []rbacv1.Subject{{
+				Kind: rbacv1.ServiceAccountKind, Name: controllerServiceAccount, Namespace: opts.Namespace,
+			}},
+		},
+		deployment(opts, "controller", labels, 1, template),
+		service(opts, "controller-metrics-service", labels, httpPort),
+	}
+}
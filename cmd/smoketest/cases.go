@@ -0,0 +1,96 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"regexp"
+)
+
+// testdata holds the input files and the result every processing type must produce for them.
+//
+//go:embed testdata
+var testdata embed.FS
+
+const (
+	inputFile  = "input.txt"
+	secondFile = "second.txt"
+)
+
+// Case is one job submitted by the smoke test.
+type Case struct {
+	Name           string
+	ProcessingType string
+	Parameters     string
+	// Diff jobs compare the input with a second file.
+	SecondFile bool
+	// Normalize rewrites what differs between deployments, such as the stored file names, before
+	// the result is compared.
+	Normalize func([]byte) []byte
+}
+
+var (
+	diffHeaders   = regexp.MustCompile(`(?m)^(---|\+\+\+) ([ab])/\S+$`)
+	textStatsFile = regexp.MustCompile(`(?m)^  "file": ".*",$`)
+)
+
+// The API stores uploads under generated names, which the diff headers and the textstats report
+// carry; both are replaced by the names of the embedded files.
+func normalizeDiff(result []byte) []byte {
+	return diffHeaders.ReplaceAllFunc(result, func(line []byte) []byte {
+		if line[0] == '-' {
+			return []byte("--- a/" + inputFile)
+		}
+		return []byte("+++ b/" + secondFile)
+	})
+}
+
+func normalizeTextStats(result []byte) []byte {
+	return textStatsFile.ReplaceAll(result, []byte(`  "file": "`+inputFile+`",`))
+}
+
+// cases covers every built-in processing type; exec and plugin jobs depend on the deployment and
+// are not part of the smoke test.
+var cases = []Case{
+	{Name: "wordcount", ProcessingType: "wordcount"},
+	{Name: "linecount", ProcessingType: "linecount"},
+	{Name: "uppercase", ProcessingType: "uppercase"},
+	{Name: "lowercase", ProcessingType: "lowercase"},
+	{Name: "replace", ProcessingType: "replace", Parameters: `{"find":"fox","replace_with":"cat"}`},
+	{Name: "extract", ProcessingType: "extract", Parameters: `{"pattern":"[a-z]+@example\\.com"}`},
+	{Name: "diff", ProcessingType: "diff", SecondFile: true, Normalize: normalizeDiff},
+	{Name: "textstats", ProcessingType: "textstats", Normalize: normalizeTextStats},
+	{Name: "chunk", ProcessingType: "chunk", Parameters: `{"chunk_by":"characters","chunk_size":64,"overlap":8}`},
+	{Name: "redact", ProcessingType: "redact"},
+	{Name: "pii_report", ProcessingType: "pii_report"},
+	{Name: "detect_language", ProcessingType: "detect_language"},
+	{Name: "transcode", ProcessingType: "transcode", Parameters: `{"from":"utf-8","to":"utf-16le"}`},
+}
+
+func (c Case) expected() ([]byte, error) {
+	data, err := testdata.ReadFile("testdata/" + c.Name + ".expected")
+	if err != nil {
+		return nil, fmt.Errorf("read expected result: %w", err)
+	}
+	return data, nil
+}
+
+func selectCases(names []string) ([]Case, error) {
+	if len(names) == 0 {
+		return cases, nil
+	}
+
+	byName := make(map[string]Case, len(cases))
+	for _, c := range cases {
+		byName[c.Name] = c
+	}
+
+	selected := make([]Case, 0, len(names))
+	for _, name := range names {
+		c, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown processing type: %s", name)
+		}
+		selected = append(selected, c)
+	}
+	return selected, nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const maxErrorBody = 512
+
+type jobResponse struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// Client talks to the jobs API.
+type Client struct {
+	baseURL      string
+	tenant       string
+	pollInterval time.Duration
+	http         *http.Client
+}
+
+// Submit uploads the embedded input, and the second file when the case needs one, as a new job.
+func (c *Client) Submit(ctx context.Context, tc Case) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	if err := attach(form, "file", inputFile); err != nil {
+		return "", err
+	}
+	if tc.SecondFile {
+		if err := attach(form, "second_file", secondFile); err != nil {
+			return "", err
+		}
+	}
+	if err := form.WriteField("processing_type", tc.ProcessingType); err != nil {
+		return "", fmt.Errorf("write processing type: %w", err)
+	}
+	if tc.Parameters != "" {
+		if err := form.WriteField("parameters", tc.Parameters); err != nil {
+			return "", fmt.Errorf("write parameters: %w", err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", fmt.Errorf("close form: %w", err)
+	}
+
+	req, err := c.request(ctx, http.MethodPost, "/api/v1/jobs", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	var job jobResponse
+	if err := c.do(req, http.StatusCreated, &job); err != nil {
+		return "", fmt.Errorf("submit job: %w", err)
+	}
+	return job.ID, nil
+}
+
+// Wait polls the job until it succeeds or fails, or the context ends.
+func (c *Client) Wait(ctx context.Context, id string) error {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		req, err := c.request(ctx, http.MethodGet, "/api/v1/jobs/"+id, nil)
+		if err != nil {
+			return err
+		}
+
+		var job jobResponse
+		if err := c.do(req, http.StatusOK, &job); err != nil {
+			return fmt.Errorf("get job: %w", err)
+		}
+
+		switch job.Status {
+		case "succeeded":
+			return nil
+		case "failed":
+			return fmt.Errorf("job %s failed: %s", id, job.ErrorMessage)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("job %s still %s: %w", id, job.Status, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// Result downloads the result of a succeeded job.
+func (c *Client) Result(ctx context.Context, id string) ([]byte, error) {
+	req, err := c.request(ctx, http.MethodGet, "/api/v1/jobs/"+id+"/result", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get result: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get result: %w", statusError(resp))
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read result: %w", err)
+	}
+	return data, nil
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if c.tenant != "" {
+		req.Header.Set("X-Tenant-ID", c.tenant)
+	}
+	return req, nil
+}
+
+func (c *Client) do(req *http.Request, wantStatus int, out any) error {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		return statusError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+func attach(form *multipart.Writer, field, name string) error {
+	data, err := testdata.ReadFile("testdata/" + name)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+
+	part, err := form.CreateFormFile(field, name)
+	if err != nil {
+		return fmt.Errorf("create form file: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return fmt.Errorf("write form file: %w", err)
+	}
+	return nil
+}
+
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		return errors.New(resp.Status)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, message)
+}
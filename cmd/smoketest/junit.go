@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Result is the outcome of one case.
+type Result struct {
+	Case     Case
+	JobID    string
+	Duration time.Duration
+	// Err is nil when the job succeeded with the expected result.
+	Err error
+	// Detail explains a failure, such as the expected and the actual result.
+	Detail string
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeJUnit writes the results as a JUnit XML test suite, the format CI systems collect.
+func writeJUnit(w io.Writer, results []Result, elapsed time.Duration) error {
+	suite := junitSuite{Name: "smoketest", Tests: len(results), Time: seconds(elapsed)}
+	for _, result := range results {
+		tc := junitCase{
+			Name:      result.Case.Name,
+			ClassName: "smoketest." + result.Case.ProcessingType,
+			Time:      seconds(result.Duration),
+		}
+		if result.JobID != "" {
+			tc.SystemOut = "job " + result.JobID
+		}
+		if result.Err != nil {
+			suite.Failures++
+			tc.Failure = &junitFailure{Message: result.Err.Error(), Body: result.Detail}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return fmt.Errorf("encode report: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
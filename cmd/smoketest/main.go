@@ -0,0 +1,173 @@
+//nolint:forbidigo // CLI tool reports the outcome of every case on stderr, keeping stdout for the report
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configure a smoke test run.
+type Options struct {
+	APIURL       string
+	Tenant       string
+	Types        string
+	Timeout      time.Duration
+	PollInterval time.Duration
+	JUnit        string
+}
+
+func main() {
+	var opts Options
+	flag.StringVar(&opts.APIURL, "api-url", "http://api:8080", "Base URL of the API")
+	flag.StringVar(&opts.Tenant, "tenant", "", "Tenant to submit the jobs as; the default tenant when empty")
+	flag.StringVar(&opts.Types, "types", "", "Comma-separated processing types to test; all when empty")
+	flag.DurationVar(&opts.Timeout, "timeout", 2*time.Minute, "Time every job has to complete, including queueing")
+	flag.DurationVar(&opts.PollInterval, "poll-interval", time.Second, "Interval between job status checks")
+	flag.StringVar(&opts.JUnit, "junit", "", "File to write a JUnit XML report to; - for stdout")
+	flag.Parse()
+
+	ok, err := run(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "smoketest: %v\n", err)
+		os.Exit(1)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+// run reports whether every case passed; the error is for runs that could not be completed.
+func run(opts Options) (bool, error) {
+	if err := opts.Validate(); err != nil {
+		return false, err
+	}
+
+	var names []string
+	if opts.Types != "" {
+		for name := range strings.SplitSeq(opts.Types, ",") {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+	selected, err := selectCases(names)
+	if err != nil {
+		return false, err
+	}
+
+	client := &Client{
+		baseURL:      strings.TrimRight(opts.APIURL, "/"),
+		tenant:       opts.Tenant,
+		pollInterval: opts.PollInterval,
+		http:         &http.Client{Timeout: 30 * time.Second}, //nolint:mnd // per request, jobs are polled
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+
+	// Jobs run concurrently, so the run takes as long as the slowest job rather than the sum
+	results := make([]Result, len(selected))
+	var wg sync.WaitGroup
+	for i, tc := range selected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCase(ctx, client, tc, opts.Timeout)
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	failures := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failures++
+			fmt.Fprintf(os.Stderr, "FAIL %-10s %v (%s)\n", result.Case.Name, result.Err, result.Duration.Round(time.Millisecond))
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "ok   %-10s job %s (%s)\n", result.Case.Name, result.JobID, result.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(os.Stderr, "%d passed, %d failed in %s\n", len(results)-failures, failures, elapsed.Round(time.Millisecond))
+
+	if opts.JUnit != "" {
+		if err := writeReport(opts.JUnit, results, elapsed); err != nil {
+			return false, err
+		}
+	}
+
+	return failures == 0, nil
+}
+
+// Validate checks the options before any job is submitted.
+func (o Options) Validate() error {
+	if o.APIURL == "" {
+		return errors.New("api url is required")
+	}
+	if o.Timeout <= 0 || o.PollInterval <= 0 {
+		return errors.New("timeout and poll interval must be positive")
+	}
+	return nil
+}
+
+// runCase submits the job of one case, waits for it and compares its result with the expected one
+// byte for byte.
+func runCase(ctx context.Context, client *Client, tc Case, timeout time.Duration) (result Result) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	result.Case = tc
+	defer func() { result.Duration = time.Since(start) }()
+
+	expected, err := tc.expected()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	result.JobID, err = client.Submit(ctx, tc)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	if err := client.Wait(ctx, result.JobID); err != nil {
+		result.Err = err
+		return result
+	}
+
+	actual, err := client.Result(ctx, result.JobID)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if tc.Normalize != nil {
+		actual = tc.Normalize(actual)
+	}
+
+	if !bytes.Equal(actual, expected) {
+		result.Err = fmt.Errorf("result of job %s differs from the expected result", result.JobID)
+		result.Detail = fmt.Sprintf("expected:\n%s\nactual:\n%s", expected, actual)
+	}
+	return result
+}
+
+func writeReport(path string, results []Result, elapsed time.Duration) error {
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("create report: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	return writeJUnit(out, results, elapsed)
+}
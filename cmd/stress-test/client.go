@@ -0,0 +1,158 @@
+//nolint:mnd,forbidigo,depguard // HTTP client part of the stress test tool.
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"sync"
+	"time"
+)
+
+// HTTP versions the stress test can speak.
+const (
+	httpVersion1 = "1.1"
+	httpVersion2 = "2"
+)
+
+// newHTTPClient creates the client the load is sent with, shared by all workers so that
+// connections are reused across them as they would be behind a load balancer.
+func newHTTPClient(config Config) *http.Client {
+	transport := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		DisableKeepAlives:   !config.KeepAlive,
+		MaxIdleConns:        config.MaxIdleConns,
+		MaxIdleConnsPerHost: config.MaxIdleConns,
+		IdleConnTimeout:     config.IdleConnTimeout,
+		TLSHandshakeTimeout: 10 * time.Second,
+		// #nosec G402 -- opt-in for test clusters with self-signed certificates
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: config.Insecure},
+	}
+
+	// HTTP/2 is negotiated over TLS, and spoken with prior knowledge over plain HTTP, which needs a
+	// server or proxy accepting unencrypted HTTP/2
+	protocols := new(http.Protocols)
+	if config.HTTPVersion == httpVersion2 {
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	} else {
+		protocols.SetHTTP1(true)
+	}
+	transport.Protocols = protocols
+
+	return &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: transport,
+	}
+}
+
+// requestTiming breaks the latency of a request down into its client-side and server-side parts.
+type requestTiming struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// TTFB is the time from the request being written to the first response byte, the server's part.
+	TTFB time.Duration
+	// Reused is set when the request was sent on an idle connection, without DNS, connect or TLS.
+	Reused   bool
+	Protocol string
+}
+
+// traceRequest returns a request that records its timing into timing as it is sent.
+func traceRequest(req *http.Request, timing *requestTiming) *http.Request {
+	var dnsStart, connectStart, tlsStart, wroteRequest time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone:  func(httptrace.DNSDoneInfo) { timing.DNS = time.Since(dnsStart) },
+		ConnectStart: func(string, string) {
+			connectStart = time.Now()
+		},
+		ConnectDone: func(string, string, error) { timing.Connect = time.Since(connectStart) },
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) { timing.TLS = time.Since(tlsStart) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			timing.Reused = info.Reused
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() {
+			timing.TTFB = time.Since(wroteRequest)
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+}
+
+// latencyBreakdown collects the timings of traced requests.
+type latencyBreakdown struct {
+	mu        sync.Mutex
+	dns       []time.Duration
+	connect   []time.Duration
+	tls       []time.Duration
+	ttfb      []time.Duration
+	total     []time.Duration
+	reused    int
+	protocols map[string]int
+}
+
+func (b *latencyBreakdown) add(timing *requestTiming, total time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.protocols == nil {
+		b.protocols = make(map[string]int)
+	}
+	b.protocols[timing.Protocol]++
+	if timing.Reused {
+		b.reused++
+	} else {
+		b.dns = append(b.dns, timing.DNS)
+		b.connect = append(b.connect, timing.Connect)
+		if timing.TLS > 0 {
+			b.tls = append(b.tls, timing.TLS)
+		}
+	}
+	b.ttfb = append(b.ttfb, timing.TTFB)
+	b.total = append(b.total, total)
+}
+
+// print reports the average and 95th percentile of every phase. DNS, connect and TLS only count
+// requests that opened a connection, TLS only those over HTTPS.
+func (b *latencyBreakdown) print() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.total) == 0 {
+		return
+	}
+
+	fmt.Println("\nLatency Breakdown (avg / p95):")
+	fmt.Printf("  DNS:     %s (%d new connections)\n", formatPhase(b.dns), len(b.dns))
+	fmt.Printf("  Connect: %s\n", formatPhase(b.connect))
+	fmt.Printf("  TLS:     %s\n", formatPhase(b.tls))
+	fmt.Printf("  TTFB:    %s (server processing and network round trip)\n", formatPhase(b.ttfb))
+	fmt.Printf("  Total:   %s\n", formatPhase(b.total))
+	fmt.Printf("  Connection reuse: %d of %d requests (%.2f%%)\n",
+		b.reused, len(b.total), float64(b.reused)/float64(len(b.total))*100)
+	for protocol, count := range b.protocols {
+		fmt.Printf("  Protocol %s: %d requests\n", protocol, count)
+	}
+}
+
+func formatPhase(durations []time.Duration) string {
+	if len(durations) == 0 {
+		return "-"
+	}
+
+	sorted := slices.Clone(durations)
+	slices.Sort(sorted)
+
+	var sum time.Duration
+	for _, d := range sorted {
+		sum += d
+	}
+	p95 := sorted[(len(sorted)*95+99)/100-1]
+	return fmt.Sprintf("%v / %v", sum/time.Duration(len(sorted)), p95)
+}
@@ -0,0 +1,389 @@
+//nolint:mnd,forbidigo,depguard // Distributed mode of the stress test tool.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// Modes of the stress test tool: standalone generates the load itself, agents generate the load of
+// the scenarios a coordinator hands out and report their results back to it.
+const (
+	modeStandalone  = "standalone"
+	modeAgent       = "agent"
+	modeCoordinator = "coordinator"
+)
+
+// Redis keys of the distributed mode. Agents register under agentKeyPrefix with a TTL they keep
+// refreshing, take scenarios from their scenario list, and push their results to the results list of
+// the run.
+const (
+	agentKeyPrefix      = "stress-test:agents:"
+	scenarioKeyPrefix   = "stress-test:scenarios:"
+	runKeyPrefix        = "stress-test:runs:"
+	agentTTL            = 15 * time.Second
+	agentHeartbeat      = 5 * time.Second
+	scenarioPollTimeout = 5 * time.Second
+	// runKeyTTL bounds how long the file and results of a run stay in Redis.
+	runKeyTTL = time.Hour
+	// startDelay gives every agent time to receive the scenario, so that they start together.
+	startDelay = 3 * time.Second
+	// resultGrace is how long the coordinator waits for results after the test should have ended.
+	resultGrace         = time.Minute
+	maxScenarioFileSize = 10 << 20
+)
+
+// agentInfo is what an agent registers.
+type agentInfo struct {
+	ID       string    `json:"id"`
+	Hostname string    `json:"hostname"`
+	Since    time.Time `json:"since"`
+}
+
+// scenario is the part of the load an agent generates.
+type scenario struct {
+	RunID    string    `json:"run_id"`
+	Config   Config    `json:"config"`
+	FileName string    `json:"file_name"`
+	StartAt  time.Time `json:"start_at"`
+}
+
+// agentResult is the partial result an agent reports for a run.
+type agentResult struct {
+	AgentID  string        `json:"agent_id"`
+	Result   TestResult    `json:"result"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+func newRedisClient(config Config) *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     config.RedisAddr,
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+}
+
+func runFileKey(runID string) string {
+	return runKeyPrefix + runID + ":file"
+}
+
+func runResultsKey(runID string) string {
+	return runKeyPrefix + runID + ":results"
+}
+
+// runAgent registers the agent and runs the scenarios it is handed until ctx is done.
+func runAgent(ctx context.Context, config Config) error {
+	client := newRedisClient(config)
+	defer client.Close()
+
+	hostname, _ := os.Hostname()
+	agentID := config.AgentID
+	if agentID == "" {
+		agentID = hostname
+	}
+	if agentID == "" {
+		agentID = uuid.NewString()
+	}
+	info, err := json.Marshal(agentInfo{ID: agentID, Hostname: hostname, Since: time.Now()})
+	if err != nil {
+		return fmt.Errorf("encode agent info: %w", err)
+	}
+
+	register := func() error {
+		return client.Set(ctx, agentKeyPrefix+agentID, info, agentTTL).Err()
+	}
+	if err := register(); err != nil {
+		return fmt.Errorf("register agent: %w", err)
+	}
+	log.Printf("Agent %s registered, waiting for scenarios", agentID)
+
+	// The registration expires unless refreshed, so coordinators skip agents that went away
+	go func() {
+		ticker := time.NewTicker(agentHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := register(); err != nil && ctx.Err() == nil {
+					log.Printf("Failed to refresh agent registration: %v", err)
+				}
+			}
+		}
+	}()
+
+	for {
+		values, err := client.BLPop(ctx, scenarioPollTimeout, scenarioKeyPrefix+agentID).Result()
+		switch {
+		case ctx.Err() != nil:
+			_ = client.Del(context.Background(), agentKeyPrefix+agentID).Err()
+			return nil
+		case errors.Is(err, redis.Nil):
+			continue
+		case err != nil:
+			log.Printf("Failed to poll for scenarios: %v", err)
+			time.Sleep(scenarioPollTimeout)
+			continue
+		}
+
+		var sc scenario
+		if err := json.Unmarshal([]byte(values[1]), &sc); err != nil {
+			log.Printf("Ignoring undecodable scenario: %v", err)
+			continue
+		}
+
+		result := runScenario(ctx, client, sc)
+		result.AgentID = agentID
+		if err := pushResult(ctx, client, sc.RunID, result); err != nil {
+			log.Printf("Failed to report results of run %s: %v", sc.RunID, err)
+		}
+	}
+}
+
+// runScenario generates the load of a scenario from its start time on.
+func runScenario(ctx context.Context, client *redis.Client, sc scenario) agentResult {
+	content, err := client.Get(ctx, runFileKey(sc.RunID)).Bytes()
+	if err != nil {
+		return agentResult{Error: fmt.Sprintf("fetch test file: %v", err)}
+	}
+
+	dir, err := os.MkdirTemp("", "stress-test-")
+	if err != nil {
+		return agentResult{Error: fmt.Sprintf("create temporary directory: %v", err)}
+	}
+	defer os.RemoveAll(dir)
+
+	config := sc.Config
+	config.File = filepath.Join(dir, filepath.Base(sc.FileName))
+	if err := os.WriteFile(config.File, content, 0o600); err != nil {
+		return agentResult{Error: fmt.Sprintf("write test file: %v", err)}
+	}
+
+	log.Printf("Running scenario of run %s with concurrency %d from %s", sc.RunID, config.Concurrency, sc.StartAt.Format(time.RFC3339))
+	select {
+	case <-ctx.Done():
+		return agentResult{Error: "agent stopped"}
+	case <-time.After(time.Until(sc.StartAt)):
+	}
+
+	start := time.Now()
+	result := runStressTest(config, nil)
+	duration := time.Since(start)
+
+	printResults(result, duration)
+	return agentResult{Result: result, Duration: duration}
+}
+
+func pushResult(ctx context.Context, client *redis.Client, runID string, result agentResult) error {
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("encode result: %w", err)
+	}
+
+	key := runResultsKey(runID)
+	_, err = client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, encoded)
+		pipe.Expire(ctx, key, runKeyTTL)
+		return nil
+	})
+	return err
+}
+
+// runCoordinator hands the scenario out to the registered agents, splitting the concurrency
+// between them, and aggregates their results.
+func runCoordinator(ctx context.Context, config Config, monitor *monitor) error {
+	client := newRedisClient(config)
+	defer client.Close()
+
+	content, err := os.ReadFile(config.File)
+	if err != nil {
+		return fmt.Errorf("read test file: %w", err)
+	}
+	if len(content) > maxScenarioFileSize {
+		return fmt.Errorf("test file exceeds %d bytes, the most handed out to agents", maxScenarioFileSize)
+	}
+
+	agents, err := waitForAgents(ctx, client, config.MinAgents, config.AgentWait)
+	if err != nil {
+		return err
+	}
+	if config.Concurrency < len(agents) {
+		return fmt.Errorf("concurrency %d is lower than the %d agents", config.Concurrency, len(agents))
+	}
+
+	runID := uuid.NewString()
+	if err := client.Set(ctx, runFileKey(runID), content, runKeyTTL).Err(); err != nil {
+		return fmt.Errorf("store test file: %w", err)
+	}
+
+	startAt := time.Now().Add(startDelay)
+	for i, agentID := range agents {
+		sc := scenario{RunID: runID, Config: config, FileName: config.File, StartAt: startAt}
+		// The total concurrency is split evenly, the first agents taking the remainder
+		sc.Config.Concurrency = config.Concurrency / len(agents)
+		if i < config.Concurrency%len(agents) {
+			sc.Config.Concurrency++
+		}
+		sc.Config.MaxIdleConns = min(sc.Config.MaxIdleConns, sc.Config.Concurrency)
+		sc.Config.File = ""
+
+		encoded, err := json.Marshal(sc)
+		if err != nil {
+			return fmt.Errorf("encode scenario: %w", err)
+		}
+		if err := client.RPush(ctx, scenarioKeyPrefix+agentID, encoded).Err(); err != nil {
+			return fmt.Errorf("hand out scenario to agent %s: %w", agentID, err)
+		}
+	}
+	log.Printf("Run %s handed out to %d agents: %s", runID, len(agents), strings.Join(agents, ", "))
+
+	// The monitor follows the whole run from the coordinator
+	testEnd := startAt.Add(time.Duration(config.Duration) * time.Second)
+	monitorDone := make(chan struct{})
+	if monitor != nil {
+		monitorCtx, cancel := context.WithDeadline(ctx, testEnd)
+		defer cancel()
+		go func() {
+			defer close(monitorDone)
+			monitor.run(monitorCtx)
+		}()
+	} else {
+		close(monitorDone)
+	}
+
+	results := collectAgentResults(ctx, client, runID, len(agents), testEnd.Add(resultGrace))
+	printAgentResults(results, len(agents))
+	if monitor != nil {
+		<-monitorDone
+		monitor.report(startAt)
+	}
+	return nil
+}
+
+// waitForAgents returns the registered agents once at least minAgents are, or after wait with
+// however many there are.
+func waitForAgents(ctx context.Context, client *redis.Client, minAgents int, wait time.Duration) ([]string, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		agents, err := registeredAgents(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		if len(agents) >= minAgents || time.Now().After(deadline) {
+			if len(agents) == 0 {
+				return nil, errors.New("no agents are registered")
+			}
+			return agents, nil
+		}
+
+		log.Printf("Waiting for agents: %d of %d registered", len(agents), minAgents)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func registeredAgents(ctx context.Context, client *redis.Client) ([]string, error) {
+	var agents []string
+	iter := client.Scan(ctx, 0, agentKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		agents = append(agents, strings.TrimPrefix(iter.Val(), agentKeyPrefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("list agents: %w", err)
+	}
+	slices.Sort(agents)
+	return agents, nil
+}
+
+// collectAgentResults waits until every agent reported or the deadline passed.
+func collectAgentResults(ctx context.Context, client *redis.Client, runID string, agents int, deadline time.Time) []agentResult {
+	var results []agentResult
+	for len(results) < agents {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			break
+		}
+
+		values, err := client.BLPop(ctx, timeout, runResultsKey(runID)).Result()
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				log.Printf("Failed to collect results: %v", err)
+			}
+			break
+		}
+
+		var result agentResult
+		if err := json.Unmarshal([]byte(values[1]), &result); err != nil {
+			log.Printf("Ignoring undecodable agent result: %v", err)
+			continue
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// printAgentResults prints the results of every agent and their aggregate.
+func printAgentResults(results []agentResult, agents int) {
+	fmt.Println("\n=== Agent Results ===")
+	var total TestResult
+	var duration time.Duration
+	for _, result := range results {
+		if result.Error != "" {
+			fmt.Printf("  %s: failed: %s\n", result.AgentID, result.Error)
+			continue
+		}
+		fmt.Printf("  %s: %d requests, %d failed, avg latency %v\n",
+			result.AgentID, result.Result.TotalRequests, result.Result.FailedRequests, result.Result.AverageLatency)
+		total = mergeResults(total, result.Result)
+		duration = max(duration, result.Duration)
+	}
+	if missing := agents - len(results); missing > 0 {
+		fmt.Printf("  %d agents did not report\n", missing)
+	}
+
+	if total.TotalRequests > 0 {
+		printResults(total, duration)
+	}
+}
+
+// mergeResults aggregates the results of two agents.
+func mergeResults(a, b TestResult) TestResult {
+	if a.TotalRequests == 0 {
+		return b
+	}
+	if b.TotalRequests == 0 {
+		return a
+	}
+
+	merged := TestResult{
+		TotalRequests:   a.TotalRequests + b.TotalRequests,
+		SuccessRequests: a.SuccessRequests + b.SuccessRequests,
+		FailedRequests:  a.FailedRequests + b.FailedRequests,
+		MinLatency:      min(a.MinLatency, b.MinLatency),
+		MaxLatency:      max(a.MaxLatency, b.MaxLatency),
+		ErrorCounts:     make(map[int]int, len(a.ErrorCounts)+len(b.ErrorCounts)),
+	}
+	merged.AverageLatency = (a.AverageLatency*time.Duration(a.TotalRequests) +
+		b.AverageLatency*time.Duration(b.TotalRequests)) / time.Duration(merged.TotalRequests)
+	for _, counts := range []map[int]int{a.ErrorCounts, b.ErrorCounts} {
+		for statusCode, count := range counts {
+			merged.ErrorCounts[statusCode] += count
+		}
+	}
+	return merged
+}
@@ -13,8 +13,11 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -26,6 +29,33 @@ type Config struct {
 	QueryDelay      int
 	Duration        int
 	APIEndpoint     string
+	// FailProbability and FailStage ask workers with fault injection enabled to fail the jobs.
+	FailProbability float64
+	FailStage       string
+	// StatsURL and ControllerMetricsURL are sampled every MonitorInterval during the test when set.
+	StatsURL             string
+	ControllerMetricsURL string
+	MonitorInterval      time.Duration
+	// Connection handling of the load generating client.
+	KeepAlive       bool
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+	HTTPVersion     string
+	Insecure        bool
+	// Trace breaks the latency of every request down with httptrace.
+	Trace bool
+	// Mode is standalone, agent or coordinator. Agents and the coordinator meet in Redis at
+	// RedisAddr; the coordinator waits up to AgentWait for MinAgents agents to register.
+	Mode      string
+	RedisAddr string
+	AgentID   string
+	MinAgents int
+	AgentWait time.Duration
+	// Soak samples the /debug/runtime endpoints in SoakTargets every SoakInterval, and reports the
+	// resources that kept growing over the run.
+	Soak         bool
+	SoakTargets  []string
+	SoakInterval time.Duration
 }
 
 type JobResponse struct {
@@ -47,6 +77,9 @@ type TestResult struct {
 	MinLatency      time.Duration
 	MaxLatency      time.Duration
 	ErrorCounts     map[int]int
+	// Breakdown holds the latency breakdown of traced requests; nil without tracing. Agents print
+	// theirs and do not report it to the coordinator.
+	Breakdown *latencyBreakdown `json:"-"`
 }
 
 func main() {
@@ -56,13 +89,49 @@ func main() {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
 
+	switch config.Mode {
+	case modeAgent:
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		if err := runAgent(ctx, config); err != nil {
+			log.Fatalf("Agent failed: %v", err)
+		}
+		return
+	case modeCoordinator:
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		log.Printf("Coordinating stress test with config: %+v", config)
+		if err := runCoordinator(ctx, config, newMonitor(config)); err != nil {
+			log.Fatalf("Coordinator failed: %v", err)
+		}
+		return
+	}
+
 	log.Printf("Starting stress test with config: %+v", config)
 
+	monitor := newMonitor(config)
+	soak := newSoakMonitor(config)
+
+	var stopSoak func()
+	if soak != nil {
+		stopSoak = soak.start()
+	}
+
 	start := time.Now()
-	result := runStressTest(config)
+	result := runStressTest(config, monitor)
 	actualDuration := time.Since(start)
 
+	if soak != nil {
+		stopSoak()
+	}
+
 	printResults(result, actualDuration)
+	if monitor != nil {
+		monitor.report(start)
+	}
+	if soak != nil {
+		soak.report()
+	}
 }
 
 func parseFlags() Config {
@@ -75,12 +144,58 @@ func parseFlags() Config {
 	flag.IntVar(&config.QueryDelay, "query-delay", 10, "Delay between requests in milliseconds")
 	flag.IntVar(&config.Duration, "duration", 60, "Test duration in seconds")
 	flag.StringVar(&config.APIEndpoint, "api-endpoint", "http://localhost:8080/api/v1/jobs", "API endpoint URL")
+	flag.Float64Var(&config.FailProbability, "fail-probability", 0, "Chance from 0 to 1 of every processing attempt failing, on workers with fault injection enabled")
+	flag.StringVar(&config.FailStage, "fail-stage", "process", "Stage injected faults fail at: read, process or write")
+	flag.StringVar(&config.StatsURL, "stats-url", "", "API /stats URL sampled for the queue depth during the test, e.g. http://localhost:8080/stats")
+	flag.StringVar(&config.ControllerMetricsURL, "controller-metrics-url", "", "Controller /metrics URL sampled for replicas and scaling events during the test")
+	flag.DurationVar(&config.MonitorInterval, "monitor-interval", 5*time.Second, "How often the stats and controller metrics are sampled")
+	flag.BoolVar(&config.KeepAlive, "keep-alive", true, "Reuse connections across requests")
+	flag.IntVar(&config.MaxIdleConns, "max-idle-conns", 0, "Idle connections kept per host (default: concurrency)")
+	flag.DurationVar(&config.IdleConnTimeout, "idle-conn-timeout", 90*time.Second, "How long idle connections are kept")
+	flag.StringVar(&config.HTTPVersion, "http-version", httpVersion1, "HTTP version: 1.1 or 2 (prior knowledge over plain HTTP)")
+	flag.BoolVar(&config.Insecure, "insecure", false, "Skip TLS certificate verification")
+	flag.BoolVar(&config.Trace, "trace", false, "Report DNS, connect, TLS and time-to-first-byte latency breakdowns")
+	flag.StringVar(&config.Mode, "mode", modeStandalone, "standalone, agent (runs the scenarios of a coordinator) or coordinator (splits the load between agents)")
+	flag.StringVar(&config.RedisAddr, "redis-addr", "localhost:6379", "Redis agents and the coordinator meet in, with the password in REDIS_PASSWORD")
+	flag.StringVar(&config.AgentID, "agent-id", "", "Agent ID (default: hostname)")
+	flag.IntVar(&config.MinAgents, "agents", 1, "Agents the coordinator waits for before starting")
+	flag.DurationVar(&config.AgentWait, "agent-wait", 30*time.Second, "How long the coordinator waits for agents to register")
+	flag.BoolVar(&config.Soak, "soak", false, "Soak test: run for hours (default 4h) and watch the services for resource leaks")
+	flag.Func("soak-targets", "Comma-separated /debug/runtime URLs sampled during a soak test with the admin token in ADMIN_TOKEN, e.g. http://localhost:8080/debug/runtime", func(value string) error {
+		config.SoakTargets = strings.Split(value, ",")
+		return nil
+	})
+	flag.DurationVar(&config.SoakInterval, "soak-interval", time.Minute, "How often the soak test samples the services")
 
 	flag.Parse()
+
+	durationSet := false
+	flag.Visit(func(f *flag.Flag) {
+		durationSet = durationSet || f.Name == "duration"
+	})
+	if config.Soak && !durationSet {
+		config.Duration = int(soakDefaultDuration.Seconds())
+	}
+	if config.MaxIdleConns == 0 {
+		config.MaxIdleConns = config.Concurrency
+	}
 	return config
 }
 
 func validateConfig(config Config) error {
+	switch config.Mode {
+	case modeAgent:
+		// Agents take everything else from the scenarios they are handed
+		return nil
+	case modeStandalone, modeCoordinator:
+	default:
+		return fmt.Errorf("mode must be standalone, agent or coordinator")
+	}
+
+	if config.MinAgents < 1 {
+		return fmt.Errorf("agents must be at least 1")
+	}
+
 	if config.File == "" {
 		return fmt.Errorf("file parameter is required")
 	}
@@ -113,20 +228,69 @@ func validateConfig(config Config) error {
 		return fmt.Errorf("duration must be at least 1 second")
 	}
 
+	if config.FailProbability < 0 || config.FailProbability > 1 {
+		return fmt.Errorf("fail-probability must be between 0 and 1")
+	}
+
+	if config.HTTPVersion != httpVersion1 && config.HTTPVersion != httpVersion2 {
+		return fmt.Errorf("http-version must be 1.1 or 2")
+	}
+
+	if config.MaxIdleConns < 0 {
+		return fmt.Errorf("max-idle-conns cannot be negative")
+	}
+
+	if config.MonitorInterval <= 0 {
+		return fmt.Errorf("monitor-interval must be positive")
+	}
+
+	if config.Soak {
+		if config.Mode != modeStandalone {
+			return fmt.Errorf("soak runs in standalone mode")
+		}
+		if len(config.SoakTargets) == 0 {
+			return fmt.Errorf("soak-targets is required with soak")
+		}
+		if config.SoakInterval <= 0 {
+			return fmt.Errorf("soak-interval must be positive")
+		}
+	}
+
+	if config.FailStage != "read" && config.FailStage != "process" && config.FailStage != "write" {
+		return fmt.Errorf("fail-stage must be read, process or write")
+	}
+
 	return nil
 }
 
-func runStressTest(config Config) TestResult {
+func runStressTest(config Config, monitor *monitor) TestResult {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Duration)*time.Second)
 	defer cancel()
 
+	// Sample the API and controller alongside the load, until the test ends
+	var monitorWG sync.WaitGroup
+	if monitor != nil {
+		monitorWG.Add(1)
+		go func() {
+			defer monitorWG.Done()
+			monitor.run(ctx)
+		}()
+	}
+	defer monitorWG.Wait()
+
+	client := newHTTPClient(config)
+	var breakdown *latencyBreakdown
+	if config.Trace {
+		breakdown = &latencyBreakdown{}
+	}
+
 	var wg sync.WaitGroup
 	resultChan := make(chan requestResult, config.Concurrency*100)
 
 	// Start workers
 	for i := 0; i < config.Concurrency; i++ {
 		wg.Add(1)
-		go worker(ctx, &wg, config, resultChan)
+		go worker(ctx, &wg, client, config, breakdown, resultChan)
 	}
 
 	// Collect results
@@ -135,7 +299,9 @@ func runStressTest(config Config) TestResult {
 		close(resultChan)
 	}()
 
-	return collectResults(resultChan)
+	result := collectResults(resultChan)
+	result.Breakdown = breakdown
+	return result
 }
 
 type requestResult struct {
@@ -144,19 +310,18 @@ type requestResult struct {
 	StatusCode int
 }
 
-func worker(ctx context.Context, wg *sync.WaitGroup, config Config, resultChan chan<- requestResult) {
+func worker(
+	ctx context.Context, wg *sync.WaitGroup, client *http.Client, config Config, breakdown *latencyBreakdown,
+	resultChan chan<- requestResult,
+) {
 	defer wg.Done()
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			result := makeRequest(client, config)
+			result := makeRequest(client, config, breakdown)
 			resultChan <- result
 
 			if config.QueryDelay > 0 {
@@ -166,7 +331,7 @@ func worker(ctx context.Context, wg *sync.WaitGroup, config Config, resultChan c
 	}
 }
 
-func makeRequest(client *http.Client, config Config) requestResult {
+func makeRequest(client *http.Client, config Config, breakdown *latencyBreakdown) requestResult {
 	start := time.Now()
 
 	// Generate random delay within the specified range
@@ -209,6 +374,14 @@ func makeRequest(client *http.Client, config Config) requestResult {
 		return requestResult{Success: false, Latency: time.Since(start), StatusCode: 0}
 	}
 
+	// Add fault injection parameters
+	if config.FailProbability > 0 {
+		parameters := fmt.Sprintf(`{"fail_probability":%g,"fail_stage":%q}`, config.FailProbability, config.FailStage)
+		if err := writer.WriteField("parameters", parameters); err != nil {
+			return requestResult{Success: false, Latency: time.Since(start), StatusCode: 0}
+		}
+	}
+
 	if err := writer.Close(); err != nil {
 		return requestResult{Success: false, Latency: time.Since(start), StatusCode: 0}
 	}
@@ -221,6 +394,12 @@ func makeRequest(client *http.Client, config Config) requestResult {
 
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
+	var timing requestTiming
+	if breakdown != nil {
+		req = traceRequest(req, &timing)
+	}
+
+	sent := time.Now()
 	resp, err := client.Do(req)
 	latency := time.Since(start)
 
@@ -229,6 +408,11 @@ func makeRequest(client *http.Client, config Config) requestResult {
 	}
 	defer resp.Body.Close()
 
+	if breakdown != nil {
+		timing.Protocol = resp.Proto
+		breakdown.add(&timing, time.Since(sent))
+	}
+
 	// Read response body for debugging if needed
 	_, _ = io.ReadAll(resp.Body)
 
@@ -295,6 +479,10 @@ func printResults(result TestResult, duration time.Duration) {
 		fmt.Printf("Requests/Second: %.2f\n", rps)
 	}
 
+	if result.Breakdown != nil {
+		result.Breakdown.print()
+	}
+
 	if len(result.ErrorCounts) > 0 {
 		fmt.Println("\nError Breakdown:")
 		for statusCode, count := range result.ErrorCounts {
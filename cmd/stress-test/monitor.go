@@ -0,0 +1,314 @@
+//nolint:mnd,forbidigo,depguard,noctx // Reporting part of the stress test tool.
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// Controller metrics the monitor follows.
+const (
+	currentReplicasMetric  = "textprocessing_current_replicas"
+	desiredReplicasMetric  = "textprocessing_desired_replicas"
+	scalingEventsMetric    = "textprocessing_autoscaling_events_total"
+	monitorRequestTimeout  = 5 * time.Second
+	monitorTimelineMaxRows = 40
+)
+
+// monitorSample is what the API and controller reported at one point of the test.
+type monitorSample struct {
+	At time.Time
+	// QueueDepth is the total length of the job queues, -1 when /stats could not be read.
+	QueueDepth int64
+	// Replicas and DesiredReplicas are by worker Deployment, nil when the metrics could not be read.
+	Replicas        map[string]float64
+	DesiredReplicas map[string]float64
+	// ScalingEvents counts the autoscaling events by Deployment and direction, as deployment/direction.
+	ScalingEvents map[string]float64
+}
+
+// replicaChange is a change of the replicas of a worker Deployment between two samples.
+type replicaChange struct {
+	At       time.Time
+	Job      string
+	From, To float64
+}
+
+// scalingEvent is an increase of the autoscaling events of a Deployment between two samples.
+type scalingEvent struct {
+	At        time.Time
+	Job       string
+	Direction string
+	Count     float64
+}
+
+// monitor samples the API /stats and controller /metrics endpoints while load is generated.
+type monitor struct {
+	statsURL   string
+	metricsURL string
+	interval   time.Duration
+	client     *http.Client
+
+	mu      sync.Mutex
+	samples []monitorSample
+}
+
+func newMonitor(config Config) *monitor {
+	if config.StatsURL == "" && config.ControllerMetricsURL == "" {
+		return nil
+	}
+	return &monitor{
+		statsURL:   config.StatsURL,
+		metricsURL: config.ControllerMetricsURL,
+		interval:   config.MonitorInterval,
+		client:     &http.Client{Timeout: monitorRequestTimeout},
+	}
+}
+
+// run samples every interval until ctx is done, and once more at the end.
+func (m *monitor) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	m.sample()
+	for {
+		select {
+		case <-ctx.Done():
+			m.sample()
+			return
+		case <-ticker.C:
+			m.sample()
+		}
+	}
+}
+
+func (m *monitor) sample() {
+	sample := monitorSample{At: time.Now(), QueueDepth: -1}
+
+	if m.statsURL != "" {
+		depth, err := m.queueDepth()
+		if err != nil {
+			fmt.Printf("monitor: %v\n", err)
+		} else {
+			sample.QueueDepth = depth
+		}
+	}
+
+	if m.metricsURL != "" {
+		families, err := m.controllerMetrics()
+		if err != nil {
+			fmt.Printf("monitor: %v\n", err)
+		} else {
+			sample.Replicas = gaugeByLabel(families[currentReplicasMetric], "job_name")
+			sample.DesiredReplicas = gaugeByLabel(families[desiredReplicasMetric], "job_name")
+			sample.ScalingEvents = scalingEventCounts(families[scalingEventsMetric])
+		}
+	}
+
+	m.mu.Lock()
+	m.samples = append(m.samples, sample)
+	m.mu.Unlock()
+}
+
+// queueDepth sums the queue lengths reported by the API /stats endpoint.
+func (m *monitor) queueDepth() (int64, error) {
+	resp, err := m.client.Get(m.statsURL)
+	if err != nil {
+		return 0, fmt.Errorf("fetch stats: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fetch stats: HTTP %d", resp.StatusCode)
+	}
+
+	var stats struct {
+		Queue struct {
+			Queues map[string]int64 `json:"queues"`
+		} `json:"queue"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return 0, fmt.Errorf("decode stats: %w", err)
+	}
+
+	var depth int64
+	for _, length := range stats.Queue.Queues {
+		depth += length
+	}
+	return depth, nil
+}
+
+// controllerMetrics reads the metrics the controller exposes in the Prometheus text format.
+func (m *monitor) controllerMetrics() (map[string]*dto.MetricFamily, error) {
+	resp, err := m.client.Get(m.metricsURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch controller metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch controller metrics: HTTP %d", resp.StatusCode)
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse controller metrics: %w", err)
+	}
+	return families, nil
+}
+
+// gaugeByLabel sums the gauge values of a family by the value of a label.
+func gaugeByLabel(family *dto.MetricFamily, label string) map[string]float64 {
+	values := make(map[string]float64)
+	if family == nil {
+		return values
+	}
+	for _, metric := range family.GetMetric() {
+		values[labelValue(metric, label)] += metric.GetGauge().GetValue()
+	}
+	return values
+}
+
+func scalingEventCounts(family *dto.MetricFamily) map[string]float64 {
+	counts := make(map[string]float64)
+	if family == nil {
+		return counts
+	}
+	for _, metric := range family.GetMetric() {
+		key := labelValue(metric, "job_name") + "/" + labelValue(metric, "direction")
+		counts[key] += metric.GetCounter().GetValue()
+	}
+	return counts
+}
+
+func labelValue(metric *dto.Metric, name string) string {
+	for _, pair := range metric.GetLabel() {
+		if pair.GetName() == name {
+			return pair.GetValue()
+		}
+	}
+	return ""
+}
+
+// report prints the queue depth and replicas over time, the replica changes and the scaling events
+// seen during the test, relative to its start.
+func (m *monitor) report(start time.Time) {
+	m.mu.Lock()
+	samples := slices.Clone(m.samples)
+	m.mu.Unlock()
+
+	fmt.Println("\n=== Autoscaling Report ===")
+	if len(samples) == 0 {
+		fmt.Println("No samples collected")
+		fmt.Println("==========================")
+		return
+	}
+
+	offset := func(at time.Time) string {
+		return "t+" + at.Sub(start).Round(time.Second).String()
+	}
+
+	fmt.Println("Queue depth and replicas over time:")
+	step := max(1, (len(samples)+monitorTimelineMaxRows-1)/monitorTimelineMaxRows)
+	for i := 0; i < len(samples); i += step {
+		sample := samples[i]
+		depth := "n/a"
+		if sample.QueueDepth >= 0 {
+			depth = fmt.Sprintf("%d", sample.QueueDepth)
+		}
+		fmt.Printf("  %-8s queue=%-8s replicas=%s\n", offset(sample.At), depth, formatReplicas(sample.Replicas, sample.DesiredReplicas))
+	}
+
+	changes, events := scalingActivity(samples)
+	if len(changes) > 0 {
+		fmt.Println("\nReplica changes:")
+		for _, change := range changes {
+			fmt.Printf("  %-8s %s: %g -> %g\n", offset(change.At), change.Job, change.From, change.To)
+		}
+	}
+	if len(events) > 0 {
+		fmt.Println("\nScaling events:")
+		for _, event := range events {
+			fmt.Printf("  %-8s %s scaled %s (%gx) at %s\n",
+				offset(event.At), event.Job, event.Direction, event.Count, event.At.Format(time.RFC3339))
+		}
+	}
+
+	peak := slices.MaxFunc(samples, func(a, b monitorSample) int {
+		return cmp.Compare(a.QueueDepth, b.QueueDepth)
+	})
+	fmt.Println("\nCorrelation:")
+	if peak.QueueDepth >= 0 {
+		fmt.Printf("  Peak queue depth: %d at %s\n", peak.QueueDepth, offset(peak.At))
+	}
+	if i := slices.IndexFunc(events, func(e scalingEvent) bool { return e.Direction == "up" }); i >= 0 {
+		fmt.Printf("  First scale-up: %s, %s after the load started\n", events[i].Job, events[i].At.Sub(start).Round(time.Second))
+	} else if m.metricsURL != "" {
+		fmt.Println("  No scale-up observed")
+	}
+	if maxReplicas := peakReplicas(samples); maxReplicas > 0 {
+		fmt.Printf("  Peak worker replicas: %g\n", maxReplicas)
+	}
+	fmt.Println("==========================")
+}
+
+// scalingActivity compares consecutive samples for replica changes and new scaling events.
+func scalingActivity(samples []monitorSample) ([]replicaChange, []scalingEvent) {
+	var changes []replicaChange
+	var events []scalingEvent
+
+	for i := 1; i < len(samples); i++ {
+		prev, cur := samples[i-1], samples[i]
+		if prev.Replicas != nil && cur.Replicas != nil {
+			for _, job := range slices.Sorted(maps.Keys(cur.Replicas)) {
+				if from, ok := prev.Replicas[job]; ok && from != cur.Replicas[job] {
+					changes = append(changes, replicaChange{At: cur.At, Job: job, From: from, To: cur.Replicas[job]})
+				}
+			}
+		}
+		if prev.ScalingEvents != nil && cur.ScalingEvents != nil {
+			for _, key := range slices.Sorted(maps.Keys(cur.ScalingEvents)) {
+				if delta := cur.ScalingEvents[key] - prev.ScalingEvents[key]; delta > 0 {
+					job, direction, _ := strings.Cut(key, "/")
+					events = append(events, scalingEvent{At: cur.At, Job: job, Direction: direction, Count: delta})
+				}
+			}
+		}
+	}
+	return changes, events
+}
+
+func peakReplicas(samples []monitorSample) float64 {
+	var peak float64
+	for _, sample := range samples {
+		var total float64
+		for _, replicas := range sample.Replicas {
+			total += replicas
+		}
+		peak = max(peak, total)
+	}
+	return peak
+}
+
+func formatReplicas(current, desired map[string]float64) string {
+	if current == nil {
+		return "n/a"
+	}
+	parts := make([]string, 0, len(current))
+	for _, job := range slices.Sorted(maps.Keys(current)) {
+		parts = append(parts, fmt.Sprintf("%s:%g/%g", job, current[job], desired[job]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,239 @@
+//nolint:mnd,forbidigo,depguard,noctx // Soak test part of the stress test tool.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/runtimestats"
+)
+
+// Soak tests run for hours unless --duration says otherwise, and report a resource as leaking when
+// it grew by at least soakMinGrowth and soakMetric.minDelta between the first and last third of the run.
+const (
+	soakDefaultDuration = 4 * time.Hour
+	soakMinSamples      = 6
+	soakMinGrowth       = 0.1
+)
+
+// soakMetric is a resource of the services the soak test watches for leaks.
+type soakMetric struct {
+	name  string
+	value func(runtimestats.Snapshot) float64
+	// minDelta is the smallest absolute growth worth reporting, below it growth is noise.
+	minDelta float64
+}
+
+//nolint:gochecknoglobals // lookup table
+var soakMetrics = []soakMetric{
+	{"goroutines", func(s runtimestats.Snapshot) float64 { return float64(s.Goroutines) }, 5},
+	{"heap_inuse_bytes", func(s runtimestats.Snapshot) float64 { return float64(s.HeapInuseBytes) }, 1 << 20},
+	{"heap_objects", func(s runtimestats.Snapshot) float64 { return float64(s.HeapObjects) }, 10000},
+	{"open_fds", func(s runtimestats.Snapshot) float64 { return float64(s.OpenFDs) }, 5},
+	{"threads", func(s runtimestats.Snapshot) float64 { return float64(s.Threads) }, 2},
+}
+
+// soakTrend is how a resource of a service evolved over the soak test.
+type soakTrend struct {
+	// First and Last are the averages of the first and last third of the samples.
+	First, Last float64
+	Growth      float64
+	// PerHour is the least squares slope of the samples.
+	PerHour float64
+	Leak    bool
+}
+
+// soakMonitor samples the /debug/runtime endpoints of the services during a soak test, which serve
+// them to requests carrying the admin token.
+type soakMonitor struct {
+	targets    []string
+	interval   time.Duration
+	client     *http.Client
+	adminToken string
+
+	mu      sync.Mutex
+	samples map[string][]runtimestats.Snapshot
+}
+
+func newSoakMonitor(config Config) *soakMonitor {
+	if !config.Soak {
+		return nil
+	}
+	return &soakMonitor{
+		targets:    config.SoakTargets,
+		interval:   config.SoakInterval,
+		client:     &http.Client{Timeout: monitorRequestTimeout},
+		adminToken: os.Getenv("ADMIN_TOKEN"),
+		samples:    make(map[string][]runtimestats.Snapshot),
+	}
+}
+
+// start samples in the background until the returned stop is called, which takes a last sample
+// and waits for it.
+func (s *soakMonitor) start() (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.run(ctx)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (s *soakMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.sample()
+	for {
+		select {
+		case <-ctx.Done():
+			s.sample()
+			return
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+}
+
+func (s *soakMonitor) sample() {
+	for _, target := range s.targets {
+		snapshot, err := s.fetch(target)
+		if err != nil {
+			fmt.Printf("soak: %v\n", err)
+			continue
+		}
+		s.mu.Lock()
+		s.samples[target] = append(s.samples[target], snapshot)
+		s.mu.Unlock()
+	}
+}
+
+func (s *soakMonitor) fetch(target string) (runtimestats.Snapshot, error) {
+	var snapshot runtimestats.Snapshot
+
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return snapshot, fmt.Errorf("fetch %s: %w", target, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.adminToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return snapshot, fmt.Errorf("fetch %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return snapshot, fmt.Errorf("fetch %s: HTTP %d", target, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+		return snapshot, fmt.Errorf("decode %s: %w", target, err)
+	}
+	return snapshot, nil
+}
+
+// report prints the trend of every resource of every service and flags the ones that kept growing.
+func (s *soakMonitor) report() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fmt.Println("\n=== Soak Report ===")
+	leaks := 0
+	for _, target := range s.targets {
+		samples := s.samples[target]
+		fmt.Printf("%s: %d samples", target, len(samples))
+		if len(samples) < soakMinSamples {
+			fmt.Printf(", at least %d needed for a leak check\n", soakMinSamples)
+			continue
+		}
+		fmt.Printf(" over %s\n", samples[len(samples)-1].At.Sub(samples[0].At).Round(time.Second))
+
+		for _, metric := range soakMetrics {
+			// Services without /proc report no file descriptors
+			if metric.name == "open_fds" && slices.ContainsFunc(samples, func(sample runtimestats.Snapshot) bool { return sample.OpenFDs < 0 }) {
+				continue
+			}
+
+			trend := analyzeSoak(samples, metric)
+			verdict := "stable"
+			if trend.Leak {
+				verdict = "LEAK SUSPECTED"
+				leaks++
+			}
+			fmt.Printf("  %-17s %14.0f -> %-14.0f %+7.1f%% %+12.1f/h  %s\n",
+				metric.name, trend.First, trend.Last, trend.Growth*100, trend.PerHour, verdict)
+		}
+	}
+
+	if leaks > 0 {
+		fmt.Printf("Leak check: %d suspected leak(s)\n", leaks)
+	} else {
+		fmt.Println("Leak check: no monotonic growth detected")
+	}
+	fmt.Println("===================")
+}
+
+// analyzeSoak compares the first and last third of the samples. Memory saws up and down with
+// garbage collection and goroutines with load, so a resource only counts as leaking when even
+// the lowest sample of the last third is above the highest of the first third, and the growth
+// is large enough to matter.
+func analyzeSoak(samples []runtimestats.Snapshot, metric soakMetric) soakTrend {
+	values := make([]float64, len(samples))
+	for i, sample := range samples {
+		values[i] = metric.value(sample)
+	}
+
+	third := len(values) / 3
+	head, tail := values[:third], values[len(values)-third:]
+
+	trend := soakTrend{
+		First:   mean(head),
+		Last:    mean(tail),
+		PerHour: slopePerHour(samples, values),
+	}
+	if trend.First > 0 {
+		trend.Growth = trend.Last/trend.First - 1
+	}
+
+	trend.Leak = slices.Min(tail) > slices.Max(head) &&
+		trend.Last-trend.First >= metric.minDelta &&
+		(trend.First == 0 || trend.Growth >= soakMinGrowth)
+	return trend
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// slopePerHour fits a line through the values by the time they were sampled at.
+func slopePerHour(samples []runtimestats.Snapshot, values []float64) float64 {
+	hours := make([]float64, len(samples))
+	for i, sample := range samples {
+		hours[i] = sample.At.Sub(samples[0].At).Hours()
+	}
+
+	meanX, meanY := mean(hours), mean(values)
+	var num, den float64
+	for i := range values {
+		num += (hours[i] - meanX) * (values[i] - meanY)
+		den += (hours[i] - meanX) * (hours[i] - meanX)
+	}
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
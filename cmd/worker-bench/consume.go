@@ -0,0 +1,144 @@
+//nolint:forbidigo // CLI tool prints its report to stdout
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+const (
+	// benchProcessingType names the queue the consume benchmark fills and drains, which no worker
+	// consumes.
+	benchProcessingType database.ProcessingType = "worker-bench"
+	benchWorkerID                               = "worker-bench"
+	benchClaimLease                             = time.Minute
+)
+
+// ConsumeResult is the consuming throughput at one batch size.
+type ConsumeResult struct {
+	BatchSize  int
+	Jobs       int
+	RoundTrips int
+	Elapsed    time.Duration
+}
+
+// benchConsume queues jobs and drains them the way a worker does at each batch size: consuming a
+// batch, then claiming it, and reports the throughput.
+func benchConsume(addr string, jobs int, batchSizes string, message queue.SubmitJobMessage) error {
+	ctx := context.Background()
+
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("parse redis address: %w", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return fmt.Errorf("parse redis port: %w", err)
+	}
+	cfg := config.Redis{Host: host, Port: port, Password: os.Getenv("REDIS_PASSWORD")}
+
+	rq, err := queue.NewRedisQueue(cfg, slog.New(slog.DiscardHandler))
+	if err != nil {
+		return err
+	}
+	defer rq.Close()
+	client := redis.NewClient(&redis.Options{Addr: cfg.Address(), Password: cfg.Password})
+	defer client.Close()
+
+	var results []ConsumeResult
+	for size := range strings.SplitSeq(batchSizes, ",") {
+		batchSize, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil || batchSize <= 0 {
+			return fmt.Errorf("invalid batch size %q", size)
+		}
+		result, err := drain(ctx, rq, client, jobs, batchSize, message)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+	}
+
+	// The benchmark jobs must not linger in the counters of the controller
+	if err := client.HDel(ctx, queue.ConsumedJobsKey, string(benchProcessingType)).Err(); err != nil {
+		return fmt.Errorf("clean up consumed jobs counter: %w", err)
+	}
+	if err := rq.RemoveHeartbeats(ctx, benchWorkerID); err != nil {
+		return err
+	}
+
+	return writeConsumeResults(os.Stdout, results)
+}
+
+// drain queues the jobs and consumes them in batches of batchSize, timing the consuming only.
+func drain(
+	ctx context.Context, rq *queue.RedisQueue, client *redis.Client, jobs, batchSize int, message queue.SubmitJobMessage,
+) (ConsumeResult, error) {
+	message.ProcessingType = benchProcessingType
+	jobIDs := make([]uuid.UUID, jobs)
+	pipe := client.Pipeline()
+	for i := range jobs {
+		message.JobID = uuid.New()
+		jobIDs[i] = message.JobID
+		data, err := queue.EncodeJob(config.MessageFormatJSON, message)
+		if err != nil {
+			return ConsumeResult{}, err
+		}
+		// Queued directly, the jobs do not signal the controller
+		pipe.LPush(ctx, queue.TypeQueue(benchProcessingType), data)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return ConsumeResult{}, fmt.Errorf("queue benchmark jobs: %w", err)
+	}
+
+	result := ConsumeResult{BatchSize: batchSize}
+	types := []database.ProcessingType{benchProcessingType}
+	start := time.Now()
+	for result.Jobs < jobs {
+		messages, _, err := rq.ConsumeJobs(ctx, time.Second, types, batchSize)
+		if err != nil {
+			return ConsumeResult{}, fmt.Errorf("consume benchmark jobs: %w", err)
+		}
+		batch := make([]uuid.UUID, len(messages))
+		for i, m := range messages {
+			batch[i] = m.JobID
+		}
+		if _, err := rq.ClaimJobs(ctx, batch, benchWorkerID, benchClaimLease); err != nil {
+			return ConsumeResult{}, err
+		}
+		result.Jobs += len(messages)
+		result.RoundTrips += 2 // consume and claim
+	}
+	result.Elapsed = time.Since(start)
+
+	for _, jobID := range jobIDs {
+		if err := rq.ReleaseJobClaim(ctx, jobID); err != nil {
+			return ConsumeResult{}, err
+		}
+	}
+	return result, nil
+}
+
+func writeConsumeResults(w io.Writer, results []ConsumeResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:mnd // column padding
+	fmt.Fprintln(tw, "BATCH SIZE\tJOBS\tROUND TRIPS\tELAPSED\tJOBS/S")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%.0f\n",
+			r.BatchSize, r.Jobs, r.RoundTrips, r.Elapsed.Round(time.Millisecond), float64(r.Jobs)/r.Elapsed.Seconds())
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,128 @@
+//nolint:forbidigo // CLI tool prints its report to stdout
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+// Result is the benchmark of one queue message format.
+type Result struct {
+	Format       string
+	Size         int
+	Encode       testing.BenchmarkResult
+	Decode       testing.BenchmarkResult
+	MessagesPerS float64
+}
+
+func main() {
+	formats := flag.String("formats", strings.Join([]string{config.MessageFormatJSON, config.MessageFormatMsgpack, config.MessageFormatProtobuf}, ","),
+		"Comma separated queue message formats to compare")
+	params := flag.Int("params", 4, "Number of job parameters in the benchmarked message") //nolint:mnd // typical job
+	redisAddr := flag.String("redis-addr", "",
+		"Redis to measure consuming throughput against, with the password in REDIS_PASSWORD; empty skips it")
+	jobs := flag.Int("jobs", 10000, "Number of jobs queued and consumed per batch size") //nolint:mnd // a few seconds of load
+	batchSizes := flag.String("batch-sizes", "1,10,50", "Comma separated consume batch sizes to compare")
+	flag.Parse()
+
+	message := sampleMessage(*params)
+
+	var results []Result
+	for format := range strings.SplitSeq(*formats, ",") {
+		result, err := bench(strings.TrimSpace(format), message)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "worker-bench: %v\n", err)
+			os.Exit(1)
+		}
+		results = append(results, result)
+	}
+
+	if err := writeResults(os.Stdout, results); err != nil {
+		fmt.Fprintf(os.Stderr, "worker-bench: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *redisAddr == "" {
+		return
+	}
+	fmt.Println()
+	if err := benchConsume(*redisAddr, *jobs, *batchSizes, message); err != nil {
+		fmt.Fprintf(os.Stderr, "worker-bench: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// sampleMessage returns a job message as the API publishes it, with the given number of parameters.
+func sampleMessage(params int) queue.SubmitJobMessage {
+	parameters := make(map[string]any, params)
+	for i := range params {
+		parameters[fmt.Sprintf("param_%d", i)] = fmt.Sprintf("value-%d", i)
+	}
+	return queue.SubmitJobMessage{
+		JobID:          uuid.New(),
+		TenantID:       "tenant-a",
+		FilePath:       "/data/uploads/" + uuid.NewString() + ".txt",
+		ProcessingType: database.ProcessingTypeWordCount,
+		Parameters:     parameters,
+		Priority:       1,
+		TraceID:        strings.Repeat("a", 32),                                                 //nolint:mnd // trace ID length
+		Traceparent:    "00-" + strings.Repeat("a", 32) + "-" + strings.Repeat("b", 16) + "-01", //nolint:mnd // W3C traceparent
+		EnqueuedAt:     time.Now().UTC(),
+	}
+}
+
+// bench measures encoding and decoding of the message in the format.
+func bench(format string, message queue.SubmitJobMessage) (Result, error) {
+	data, err := queue.EncodeJob(format, message)
+	if err != nil {
+		return Result{}, err
+	}
+	if _, err := queue.DecodeJob(data); err != nil {
+		return Result{}, fmt.Errorf("decode %s message: %w", format, err)
+	}
+
+	encode := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := queue.EncodeJob(format, message); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	decode := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := queue.DecodeJob(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	result := Result{Format: format, Size: len(data), Encode: encode, Decode: decode}
+	if roundTrip := encode.NsPerOp() + decode.NsPerOp(); roundTrip > 0 {
+		result.MessagesPerS = float64(time.Second) / float64(roundTrip)
+	}
+	return result, nil
+}
+
+func writeResults(w io.Writer, results []Result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:mnd // column padding
+	fmt.Fprintln(tw, "FORMAT\tBYTES\tENCODE NS/OP\tENCODE ALLOCS\tDECODE NS/OP\tDECODE ALLOCS\tMESSAGES/S")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%.0f\n",
+			r.Format, r.Size, r.Encode.NsPerOp(), r.Encode.AllocsPerOp(), r.Decode.NsPerOp(), r.Decode.AllocsPerOp(), r.MessagesPerS)
+	}
+	return tw.Flush()
+}
@@ -12,16 +12,32 @@ import (
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/encryption"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/health"
+	"github.com/rsav/k8s-learning/internal/notifier"
+	"github.com/rsav/k8s-learning/internal/observability"
+	"github.com/rsav/k8s-learning/internal/runtimestats"
+	"github.com/rsav/k8s-learning/internal/sandbox"
+	"github.com/rsav/k8s-learning/internal/secrets"
 	"github.com/rsav/k8s-learning/internal/storage/database"
 	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+	"github.com/rsav/k8s-learning/internal/tracing"
+	"github.com/rsav/k8s-learning/internal/version"
 	"github.com/rsav/k8s-learning/internal/worker"
+	"github.com/rsav/k8s-learning/internal/worker/mailer"
 	"github.com/rsav/k8s-learning/internal/worker/metrics"
 )
 
 func main() {
+	// Exec jobs re-run this binary as the sandbox launcher before exec'ing the allowed command
+	sandbox.RunChildIfRequested()
+
 	cfg, err := config.LoadWorker()
 	if err != nil {
 		slog.Error("Failed to load configuration", "error", err) //nolint:sloglint // we did not initialize the logger yet
@@ -50,10 +66,31 @@ func runWithShutdown(cfg *config.Worker) int {
 }
 
 func run(ctx context.Context, cfg *config.Worker, log *slog.Logger) int {
-	log.InfoContext(ctx, "starting worker", "worker_id", cfg.WorkerID)
+	buildInfo := version.Get()
+	log.InfoContext(ctx, "starting worker", "worker_id", cfg.WorkerID,
+		"version", buildInfo.Version, "commit", buildInfo.Commit, "build_date", buildInfo.BuildDate)
 
 	// Set worker info metric
-	metrics.WorkerInfo.WithLabelValues(cfg.WorkerID, "1.0.0").Set(1)
+	metrics.WorkerInfo.WithLabelValues(cfg.WorkerID, buildInfo.Version).Set(1)
+	version.RecordBuildInfo("worker")
+
+	stopTelemetry, err := telemetry.Setup(cfg.Metrics, "text-worker", log)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to set up metrics exporters", "error", err)
+		return 1
+	}
+	defer stopTelemetry()
+
+	if cfg.Startup.WaitForDependencies {
+		err := health.WaitFor(ctx, cfg.Startup.Timeout, log,
+			health.Dependency{Name: "database", Check: func(ctx context.Context) error { return database.Ping(ctx, cfg.Database) }},
+			health.Dependency{Name: "redis", Check: func(ctx context.Context) error { return queue.Ping(ctx, cfg.Redis) }},
+		)
+		if err != nil {
+			log.ErrorContext(ctx, "dependencies not available", "error", err)
+			return 1
+		}
+	}
 
 	repo, err := database.NewRepository(cfg.Database, log)
 	if err != nil {
@@ -77,7 +114,49 @@ func run(ctx context.Context, cfg *config.Worker, log *slog.Logger) int {
 		}
 	}()
 
-	w, err := worker.New(cfg, repo, redisQueue, log)
+	queueKeys, err := encryption.FromConfig(cfg.Encryption, cfg.Encryption.Queue)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to initialize queue encryption", "error", err)
+		return 1
+	}
+	redisQueue.SetKeyring(queueKeys)
+
+	if err := secrets.WatchFile(ctx, cfg.Database.PasswordFile, log, repo.RotatePassword); err != nil {
+		log.ErrorContext(ctx, "failed to watch database password file", "error", err)
+		return 1
+	}
+
+	if err := secrets.WatchFile(ctx, cfg.Redis.PasswordFile, log, redisQueue.RotatePassword); err != nil {
+		log.ErrorContext(ctx, "failed to watch redis password file", "error", err)
+		return 1
+	}
+
+	notifiers, err := notifier.FromConfig(cfg.Events, log)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to initialize notifiers", "error", err)
+		return 1
+	}
+	sinks := make([]events.Sink, 0, len(notifiers))
+	for _, n := range notifiers {
+		sinks = append(sinks, n)
+	}
+
+	eventBus, err := events.NewBusFromConfig(cfg.Events, cfg.Redis, log, sinks...)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to initialize event bus", "error", err)
+		return 1
+	}
+	defer eventBus.Close()
+
+	runtimeDefaults := config.DefaultRuntime()
+	runtimeDefaults.Worker.PollInterval = config.Duration{Duration: cfg.PollInterval}
+	runtimeConfig, err := config.Watch(ctx, cfg.RuntimeConfigFile, runtimeDefaults, log)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to load runtime configuration", "error", err)
+		return 1
+	}
+
+	w, err := worker.New(cfg, runtimeConfig, repo, redisQueue, eventBus, log)
 	if err != nil {
 		log.ErrorContext(ctx, "failed to create worker", "error", err)
 		return 1
@@ -85,7 +164,50 @@ func run(ctx context.Context, cfg *config.Worker, log *slog.Logger) int {
 
 	// Start metrics and health server
 	var wg sync.WaitGroup
-	metricsServer := startMetricsServer(ctx, cfg.MetricsPort, log, &wg, repo, redisQueue)
+	configHandler := config.EffectiveConfigHandler(cfg.Redacted(), runtimeConfig)
+	admin := worker.NewAdmin(w, cfg.AdminToken, log)
+	if err := secrets.WatchFile(ctx, cfg.AdminTokenFile, log, admin.RotateToken); err != nil {
+		log.ErrorContext(ctx, "failed to watch admin token file", "error", err)
+		return 1
+	}
+	checker := health.NewChecker("text-worker", cfg.Health.CacheTTL, cfg.Health.CheckTimeout, log)
+	checker.Critical("database", repo.HealthCheck)
+	checker.Critical("redis", redisQueue.HealthCheck)
+	checker.Optional("consumption", w.CheckConsuming)
+	metricsServer := startMetricsServer(ctx, cfg.MetricsPort, log, &wg, checker, configHandler, admin,
+		cfg.Metrics.Exports(config.MetricsExporterPrometheus))
+
+	// Push a summary of the metrics for clusters that do not scrape the workers
+	if cfg.Metrics.PushEnabled() {
+		pusher, err := observability.NewPusher(cfg.Metrics, "worker", observability.WorkerPushedMetrics, log)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to create metrics pusher", "error", err)
+			shutdownMetricsServer(metricsServer, log)
+			wg.Wait()
+			return 1
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pusher.Start(ctx)
+		}()
+	}
+
+	// Notification emails are sent by their own goroutines, so a slow SMTP server never holds up jobs
+	if cfg.Email.Enabled() {
+		sender, err := mailer.NewSender(cfg.Email, redisQueue, w.ID(), log)
+		if err != nil {
+			log.ErrorContext(ctx, "failed to create email sender", "error", err)
+			shutdownMetricsServer(metricsServer, log)
+			wg.Wait()
+			return 1
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sender.Start(ctx)
+		}()
+	}
 
 	log.InfoContext(ctx, "worker starting...")
 	if err := w.Start(ctx); err != nil {
@@ -103,44 +225,28 @@ func run(ctx context.Context, cfg *config.Worker, log *slog.Logger) int {
 	return 0
 }
 
-func startMetricsServer(ctx context.Context, port int, log *slog.Logger, wg *sync.WaitGroup, repo *database.Repository, queue *queue.RedisQueue) *http.Server {
+func startMetricsServer(
+	ctx context.Context, port int, log *slog.Logger, wg *sync.WaitGroup,
+	checker *health.Checker, configHandler http.HandlerFunc, admin *worker.Admin, exposeMetrics bool,
+) *http.Server {
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-
-	// Health endpoints
-	mux.HandleFunc("/livez", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
-	})
-
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("OK"))
-	})
-
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		allHealthy := true
-
-		// Check database connectivity
-		if err := repo.HealthCheck(r.Context()); err != nil {
-			log.ErrorContext(r.Context(), "database health check failed", "error", err)
-			allHealthy = false
-		}
 
-		// Check Redis connectivity
-		if err := queue.HealthCheck(r.Context()); err != nil {
-			log.ErrorContext(r.Context(), "redis health check failed", "error", err)
-			allHealthy = false
-		}
+	// Pause, resume and drain job consumption (bearer token from ADMIN_TOKEN)
+	admin.Register(mux)
+
+	// Effective configuration (secrets redacted; bearer token from ADMIN_TOKEN)
+	mux.Handle("/debug/config", admin.Authenticate(configHandler))
+	// Goroutines, memory and file descriptors, sampled by soak tests for leaks (bearer token from ADMIN_TOKEN)
+	mux.Handle("/debug/runtime", admin.Authenticate(http.HandlerFunc(runtimestats.Handler)))
+	mux.HandleFunc("/version", version.Handler)
+	if exposeMetrics {
+		mux.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}))
+	}
 
-		if allHealthy {
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("OK"))
-		} else {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			_, _ = w.Write([]byte("NOT READY"))
-		}
-	})
+	// Health endpoints; a paused or drained worker is reported as degraded but stays ready
+	checker.Register(mux)
 
 	server := &http.Server{
 		Addr:              fmt.Sprintf(":%d", port),
@@ -186,7 +292,7 @@ func setupLogger(config config.Logging) *slog.Logger {
 		handler = slog.NewJSONHandler(os.Stdout, opts)
 	}
 
-	return slog.New(handler)
+	return slog.New(tracing.NewLogHandler(handler))
 }
 
 func parseLogLevel(level string) slog.Level {
@@ -0,0 +1,460 @@
+// Package admintask runs long admin operations, such as bulk retries, exports and the re-encryption
+// of the stored files, as tasks in the background. Tasks are recorded in the admin_tasks table and
+// queued in Redis, so that any API replica runs them and every replica reports their progress.
+package admintask
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+const (
+	// consumeTimeout bounds how long a runner waits for a queued task before checking for shutdown.
+	consumeTimeout = 5 * time.Second
+	// progressInterval is how often the progress of a running task is recorded, which also tells
+	// the other replicas that its runner is alive and picks up cancellations.
+	progressInterval = 5 * time.Second
+	// finishTimeout bounds recording the outcome of a task, which must happen even on shutdown.
+	finishTimeout = 5 * time.Second
+)
+
+// Kinds of admin tasks, besides the bulk operations of package batch.
+const (
+	KindExport         = "export"
+	KindOrphanCleanup  = "orphan_cleanup"
+	KindReencryptFiles = "reencrypt_files"
+)
+
+var (
+	// ErrUnknownKind is returned by Start for kinds no operation is registered for.
+	ErrUnknownKind = errors.New("unknown admin task kind")
+	// ErrInvalidParams is returned by Start when the operation rejects the params of the task.
+	ErrInvalidParams = errors.New("invalid admin task params")
+
+	// errCanceled cancels the context of a task that was asked to stop.
+	errCanceled = errors.New("admin task canceled")
+)
+
+type (
+	// Repository records the tasks and their progress.
+	Repository interface {
+		CreateAdminTask(ctx context.Context, task *database.AdminTask) error
+		ClaimAdminTask(ctx context.Context, id uuid.UUID, runnerID string) (*database.AdminTask, error)
+		UpdateAdminTaskProgress(ctx context.Context, id uuid.UUID, runnerID string, progress database.TaskProgress) (bool, error)
+		FinishAdminTask(ctx context.Context, id uuid.UUID, runnerID string, outcome database.TaskOutcome) error
+		ReleaseAdminTask(ctx context.Context, id uuid.UUID, runnerID string) error
+		RequeueStaleAdminTasks(ctx context.Context, staleBefore time.Time) ([]uuid.UUID, error)
+	}
+
+	// Queue is the queue tasks wait in for a runner.
+	Queue interface {
+		PublishAdminTask(ctx context.Context, taskID uuid.UUID) error
+		ConsumeAdminTask(ctx context.Context, timeout time.Duration) (uuid.UUID, error)
+	}
+
+	// Operation is what tasks of a kind do.
+	Operation interface {
+		// Prepare validates the params of a task before it is queued and returns them as recorded,
+		// with defaults filled in, so that the task does the same whenever and wherever it runs.
+		Prepare(params database.JSONB) (database.JSONB, error)
+		// Run performs the task, reporting its progress, and returns what it produced. It stops when
+		// ctx is canceled, for a cancellation or a shutdown.
+		Run(ctx context.Context, task *database.AdminTask, progress *Progress) (database.JSONB, error)
+	}
+
+	// Config sets how many tasks the runner runs at once, zero only queueing them for the other
+	// replicas, and after how long without progress a running task is queued again. RunnerID
+	// identifies the replica in the tasks it runs, by default its hostname and a random suffix.
+	Config struct {
+		RunnerID    string
+		Concurrency int
+		StaleAfter  time.Duration
+	}
+)
+
+// Runner queues admin tasks and runs those of the shared queue until Close.
+type Runner struct {
+	repo       Repository
+	queue      Queue
+	config     Config
+	log        *slog.Logger
+	operations map[string]Operation
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func New(repo Repository, q Queue, cfg Config, log *slog.Logger) *Runner {
+	if cfg.RunnerID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "api"
+		}
+		cfg.RunnerID = fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		repo:       repo,
+		queue:      q,
+		config:     cfg,
+		log:        log.With("runner_id", cfg.RunnerID),
+		operations: make(map[string]Operation),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Register sets the operation run by tasks of kind. Operations are registered before Run.
+func (r *Runner) Register(kind string, operation Operation) {
+	r.operations[kind] = operation
+}
+
+// Kinds returns the kinds of tasks the runner runs, sorted.
+func (r *Runner) Kinds() []string {
+	return slices.Sorted(maps.Keys(r.operations))
+}
+
+// Start records a task of kind and queues it. It fails with ErrUnknownKind or ErrInvalidParams
+// before recording anything. A task that could not be queued is still returned; it is queued by
+// the next check for stale tasks.
+func (r *Runner) Start(ctx context.Context, kind string, params database.JSONB) (*database.AdminTask, error) {
+	operation, ok := r.operations[kind]
+	if !ok {
+		return nil, fmt.Errorf("%w %q: must be one of %v", ErrUnknownKind, kind, r.Kinds())
+	}
+
+	prepared, err := operation.Prepare(params)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidParams, err)
+	}
+
+	task := &database.AdminTask{
+		ID:        uuid.New(),
+		Kind:      kind,
+		Params:    prepared,
+		CreatedAt: time.Now().UTC(),
+	}
+	task.UpdatedAt = task.CreatedAt
+	if err := r.repo.CreateAdminTask(ctx, task); err != nil {
+		return nil, err
+	}
+
+	if err := r.queue.PublishAdminTask(ctx, task.ID); err != nil {
+		r.log.WarnContext(ctx, "failed to queue admin task, left for the stale task check",
+			"error", err, "task_id", task.ID, "kind", kind)
+	}
+	return task, nil
+}
+
+// Run runs queued tasks, up to Concurrency at a time, and queues stale tasks again until ctx is
+// canceled or the runner is closed.
+func (r *Runner) Run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(r.ctx, cancel)
+	defer stop()
+
+	go r.requeueStale(ctx)
+
+	if r.config.Concurrency <= 0 {
+		<-ctx.Done()
+		return
+	}
+
+	slots := make(chan struct{}, r.config.Concurrency)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		taskID, err := r.queue.ConsumeAdminTask(ctx, consumeTimeout)
+		if err != nil {
+			<-slots
+			if ctx.Err() != nil {
+				return
+			}
+			if !errors.Is(err, queue.ErrNoAdminTasksAvailable) {
+				r.log.ErrorContext(ctx, "failed to consume admin task", "error", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(consumeTimeout):
+				}
+			}
+			continue
+		}
+
+		if !r.track() {
+			// Closed while waiting: leave the task to another replica
+			r.requeue(taskID)
+			return
+		}
+		go func() {
+			defer func() {
+				<-slots
+				r.wg.Done()
+			}()
+			r.runTask(taskID)
+		}()
+	}
+}
+
+// Close stops the running tasks, which are queued again for another replica, and waits for them.
+func (r *Runner) Close() {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	r.cancel()
+	r.wg.Wait()
+}
+
+// track counts a task Close waits for, unless the runner is closed.
+func (r *Runner) track() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.wg.Add(1)
+	return true
+}
+
+// requeueStale queues the tasks that made no progress for StaleAfter again, checking twice per
+// period. Every replica checks; each stale task is returned to only one of them.
+func (r *Runner) requeueStale(ctx context.Context) {
+	ticker := time.NewTicker(r.config.StaleAfter / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		ids, err := r.repo.RequeueStaleAdminTasks(ctx, time.Now().Add(-r.config.StaleAfter))
+		if err != nil {
+			r.log.ErrorContext(ctx, "failed to requeue stale admin tasks", "error", err)
+			continue
+		}
+		for _, id := range ids {
+			r.log.WarnContext(ctx, "requeued stale admin task", "task_id", id)
+			staleTasksTotal.Inc()
+			if err := r.queue.PublishAdminTask(ctx, id); err != nil {
+				r.log.ErrorContext(ctx, "failed to queue stale admin task", "error", err, "task_id", id)
+			}
+		}
+	}
+}
+
+// requeue queues a task taken from the queue but not run again.
+func (r *Runner) requeue(taskID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.ctx), finishTimeout)
+	defer cancel()
+	if err := r.queue.PublishAdminTask(ctx, taskID); err != nil {
+		r.log.ErrorContext(ctx, "failed to queue admin task again, left for the stale task check", "error", err, "task_id", taskID)
+	}
+}
+
+func (r *Runner) runTask(taskID uuid.UUID) {
+	task, err := r.repo.ClaimAdminTask(r.ctx, taskID, r.config.RunnerID)
+	if errors.Is(err, database.ErrAdminTaskNotPending) {
+		r.log.DebugContext(r.ctx, "skipping admin task that is not pending", "task_id", taskID)
+		return
+	}
+	if err != nil {
+		r.log.ErrorContext(r.ctx, "failed to claim admin task, left for the stale task check", "error", err, "task_id", taskID)
+		return
+	}
+
+	log := r.log.With("task_id", task.ID, "kind", task.Kind)
+	log.InfoContext(r.ctx, "admin task started")
+	runningTasksGauge.WithLabelValues(task.Kind).Inc()
+	defer runningTasksGauge.WithLabelValues(task.Kind).Dec()
+
+	ctx, cancel := context.WithCancelCause(r.ctx)
+	defer cancel(nil)
+	if task.CancelRequested {
+		cancel(errCanceled)
+	}
+
+	progress := &Progress{}
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		r.heartbeat(ctx, task, progress, cancel)
+	}()
+
+	var result database.JSONB
+	operation, ok := r.operations[task.Kind]
+	if !ok {
+		err = fmt.Errorf("%w %q", ErrUnknownKind, task.Kind)
+	} else if ctx.Err() == nil {
+		result, err = operation.Run(ctx, task, progress)
+	}
+	cause := context.Cause(ctx)
+	cancel(nil)
+	<-heartbeatDone
+
+	outcome := database.TaskOutcome{
+		Status:   database.TaskStatusSucceeded,
+		Progress: progress.snapshot(),
+		Result:   result,
+	}
+	switch {
+	case errors.Is(cause, database.ErrAdminTaskLost):
+		log.WarnContext(r.ctx, "admin task was queued again for another replica, stopped")
+		return
+	case errors.Is(cause, errCanceled):
+		outcome.Status = database.TaskStatusCanceled
+	case err != nil && r.ctx.Err() != nil:
+		r.release(task, log)
+		return
+	case err != nil:
+		outcome.Status = database.TaskStatusFailed
+		outcome.ErrorMessage = err.Error()
+	}
+
+	finishCtx, finishCancel := context.WithTimeout(context.WithoutCancel(r.ctx), finishTimeout)
+	defer finishCancel()
+	if err := r.repo.FinishAdminTask(finishCtx, task.ID, r.config.RunnerID, outcome); err != nil {
+		log.ErrorContext(finishCtx, "failed to record admin task outcome", "error", err)
+		return
+	}
+	finishedTasksTotal.WithLabelValues(task.Kind, string(outcome.Status)).Inc()
+
+	attrs := []any{
+		"status", outcome.Status,
+		"processed", outcome.Progress.Processed,
+		"succeeded", outcome.Progress.Succeeded,
+		"failed", outcome.Progress.Failed,
+	}
+	if err != nil && outcome.Status == database.TaskStatusFailed {
+		log.ErrorContext(finishCtx, "admin task failed", append(attrs, "error", err)...)
+		return
+	}
+	log.InfoContext(finishCtx, "admin task finished", attrs...)
+}
+
+// heartbeat records the progress of a running task every progressInterval until ctx is done, and
+// cancels the task when it was asked to stop or was queued again for another replica.
+func (r *Runner) heartbeat(ctx context.Context, task *database.AdminTask, progress *Progress, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cancelRequested, err := r.repo.UpdateAdminTaskProgress(ctx, task.ID, r.config.RunnerID, progress.snapshot())
+		switch {
+		case errors.Is(err, database.ErrAdminTaskLost):
+			cancel(database.ErrAdminTaskLost)
+			return
+		case err != nil:
+			if ctx.Err() == nil {
+				r.log.WarnContext(ctx, "failed to record admin task progress", "error", err, "task_id", task.ID)
+			}
+		case cancelRequested:
+			cancel(errCanceled)
+			return
+		}
+	}
+}
+
+// release makes a task interrupted by shutdown pending and queues it for another replica, which
+// runs it from the start.
+func (r *Runner) release(task *database.AdminTask, log *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.ctx), finishTimeout)
+	defer cancel()
+
+	if err := r.repo.ReleaseAdminTask(ctx, task.ID, r.config.RunnerID); err != nil {
+		log.ErrorContext(ctx, "failed to release admin task, left for the stale task check", "error", err)
+		return
+	}
+	if err := r.queue.PublishAdminTask(ctx, task.ID); err != nil {
+		log.ErrorContext(ctx, "failed to queue released admin task, left for the stale task check", "error", err)
+		return
+	}
+	log.InfoContext(ctx, "admin task interrupted by shutdown, queued again")
+}
+
+// Progress is the progress of a running task, recorded by the runner every progressInterval.
+type Progress struct {
+	mu       sync.Mutex
+	progress database.TaskProgress
+}
+
+// SetTotal sets how many items the task processes, once known.
+func (p *Progress) SetTotal(total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Total = total
+}
+
+// Add counts processed items that succeeded and failed. The total grows with items found after it
+// was set.
+func (p *Progress) Add(succeeded, failed int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Succeeded += succeeded
+	p.progress.Failed += failed
+	p.progress.Processed += succeeded + failed
+	p.progress.Total = max(p.progress.Total, p.progress.Processed)
+}
+
+func (p *Progress) snapshot() database.TaskProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.progress
+}
+
+// DecodeParams decodes the params of a task into dst, rejecting unknown params.
+func DecodeParams(params database.JSONB, dst any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("encode params: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dst); err != nil {
+		return fmt.Errorf("decode params: %w", err)
+	}
+	return nil
+}
+
+// EncodeParams encodes src as the params of a task.
+func EncodeParams(src any) (database.JSONB, error) {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return nil, fmt.Errorf("encode params: %w", err)
+	}
+	params := database.JSONB{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("decode params: %w", err)
+	}
+	return params, nil
+}
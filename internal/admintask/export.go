@@ -0,0 +1,109 @@
+package admintask
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// ExportFilePrefix starts the names of the archives written by export tasks, which are stored with
+// the results but referenced by no job.
+const ExportFilePrefix = "export-"
+
+type (
+	// Exporter writes the archives served by GET /api/v1/export.
+	Exporter interface {
+		ResolveExport(query url.Values) (url.Values, error)
+		WriteExport(ctx context.Context, w io.Writer, query url.Values, exported func()) (int, error)
+	}
+
+	// ExportFiles stores the archives of export tasks.
+	ExportFiles interface {
+		CopyResultFile(name string, content io.Reader) (string, int64, error)
+	}
+)
+
+// Export writes the archive of GET /api/v1/export to the result storage, for exports too large to
+// download in one request. Its params are the query parameters of the endpoint; the time range is
+// resolved when the task starts. The archive is removed with the results, after the file retention.
+type Export struct {
+	exporter Exporter
+	files    ExportFiles
+}
+
+func NewExport(exporter Exporter, files ExportFiles) *Export {
+	return &Export{exporter: exporter, files: files}
+}
+
+func (e *Export) Prepare(params database.JSONB) (database.JSONB, error) {
+	query, err := exportQuery(params)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := e.exporter.ResolveExport(query)
+	if err != nil {
+		return nil, err
+	}
+
+	prepared := make(database.JSONB, len(resolved))
+	for key := range resolved {
+		prepared[key] = resolved.Get(key)
+	}
+	return prepared, nil
+}
+
+// Run writes the archive to export-<task ID>-<run>.<format> and returns its path and size. Every
+// run writes its own file, since a replica that died may have left a partial one behind, which is
+// removed with the results.
+func (e *Export) Run(ctx context.Context, task *database.AdminTask, progress *Progress) (database.JSONB, error) {
+	query, err := exportQuery(task.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s%s-%s.%s", ExportFilePrefix, task.ID, uuid.New().String()[:8], query.Get("format"))
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	var count int
+	go func() {
+		defer close(done)
+		var err error
+		count, err = e.exporter.WriteExport(ctx, writer, query, func() {
+			progress.Add(1, 0)
+		})
+		_ = writer.CloseWithError(err)
+	}()
+
+	path, size, err := e.files.CopyResultFile(name, reader)
+	// Unblock the export when storing failed early
+	_ = reader.CloseWithError(io.ErrClosedPipe)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+
+	return database.JSONB{
+		"path":       path,
+		"size_bytes": size,
+		"jobs":       count,
+		"format":     query.Get("format"),
+	}, nil
+}
+
+// exportQuery returns the params of an export task as query parameters. Every param is a string.
+func exportQuery(params database.JSONB) (url.Values, error) {
+	query := make(url.Values, len(params))
+	for key, value := range params {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("param %s must be a string", key)
+		}
+		query.Set(key, s)
+	}
+	return query, nil
+}
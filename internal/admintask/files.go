@@ -0,0 +1,146 @@
+package admintask
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/reconcile"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
+)
+
+type (
+	// Reconciler finds, and deletes, the stored files no job references.
+	Reconciler interface {
+		Reconcile(ctx context.Context, deleteOrphans bool) (*reconcile.Report, error)
+	}
+
+	// ReencryptFiles lists the stored files and rewrites them with the active key.
+	ReencryptFiles interface {
+		ListStoredFiles() ([]filestore.StoredFile, error)
+		ReencryptFile(filePath string) (bool, error)
+	}
+)
+
+// OrphanCleanup runs a file reconciliation, deleting the orphaned files unless the delete param is
+// false, on demand rather than on the reconciliation interval.
+type OrphanCleanup struct {
+	reconciler Reconciler
+}
+
+// orphanCleanupParams are the params of orphan cleanup tasks.
+type orphanCleanupParams struct {
+	Delete *bool `json:"delete,omitempty"`
+}
+
+func NewOrphanCleanup(reconciler Reconciler) *OrphanCleanup {
+	return &OrphanCleanup{reconciler: reconciler}
+}
+
+func (oc *OrphanCleanup) Prepare(params database.JSONB) (database.JSONB, error) {
+	var p orphanCleanupParams
+	if err := DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Delete == nil {
+		deleteOrphans := true
+		p.Delete = &deleteOrphans
+	}
+	return EncodeParams(p)
+}
+
+// Run counts the orphaned files as processed and the deleted ones as succeeded. The report, without
+// its file lists, is the result; the full report is served by GET /api/v1/admin/files/reconcile.
+func (oc *OrphanCleanup) Run(ctx context.Context, task *database.AdminTask, progress *Progress) (database.JSONB, error) {
+	var p orphanCleanupParams
+	if err := DecodeParams(task.Params, &p); err != nil {
+		return nil, err
+	}
+
+	deleteOrphans := p.Delete == nil || *p.Delete
+	report, err := oc.reconciler.Reconcile(ctx, deleteOrphans)
+	if report == nil {
+		return nil, err
+	}
+
+	orphans := int64(report.OrphanedFiles.Total())
+	progress.SetTotal(orphans)
+	if deleteOrphans {
+		progress.Add(int64(report.DeletedFiles), orphans-int64(report.DeletedFiles))
+	}
+
+	summary := *report
+	summary.Orphans, summary.Missing = nil, nil
+	result, encodeErr := EncodeParams(summary)
+	return result, errors.Join(err, encodeErr)
+}
+
+// Reencrypt rewrites the stored files that are not encrypted with the active key, such as those
+// written before encryption was enabled or before the key was rotated, so that a retired key can be
+// removed. Files younger than minAge may still be being written and are skipped.
+type Reencrypt struct {
+	files    ReencryptFiles
+	encrypts bool
+	minAge   time.Duration
+	log      *slog.Logger
+}
+
+func NewReencrypt(files ReencryptFiles, encrypts bool, minAge time.Duration, log *slog.Logger) *Reencrypt {
+	return &Reencrypt{files: files, encrypts: encrypts, minAge: minAge, log: log}
+}
+
+// Prepare fails unless files are encrypted, since the task would otherwise decrypt every file.
+func (re *Reencrypt) Prepare(params database.JSONB) (database.JSONB, error) {
+	if !re.encrypts {
+		return nil, errors.New("files are not encrypted: set ENCRYPT_FILES and ENCRYPTION_ACTIVE_KEY")
+	}
+	if err := DecodeParams(params, &struct{}{}); err != nil {
+		return nil, err
+	}
+	return database.JSONB{}, nil
+}
+
+// Run counts the files it failed to rewrite as failed and keeps going; the result counts the
+// rewritten files and those already encrypted with the active key.
+func (re *Reencrypt) Run(ctx context.Context, task *database.AdminTask, progress *Progress) (database.JSONB, error) {
+	files, err := re.files.ListStoredFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-re.minAge)
+	candidates := make([]filestore.StoredFile, 0, len(files))
+	for _, file := range files {
+		if file.ModTime.Before(cutoff) {
+			candidates = append(candidates, file)
+		}
+	}
+	progress.SetTotal(int64(len(candidates)))
+
+	var rewritten, current int
+	result := func() database.JSONB {
+		return database.JSONB{"rewritten": rewritten, "current": current}
+	}
+	for _, file := range candidates {
+		if err := ctx.Err(); err != nil {
+			return result(), err
+		}
+
+		ok, err := re.files.ReencryptFile(file.Path)
+		if err != nil {
+			re.log.ErrorContext(ctx, "failed to reencrypt file", "error", err, "path", file.Path, "task_id", task.ID)
+			progress.Add(0, 1)
+			continue
+		}
+		if ok {
+			rewritten++
+		} else {
+			current++
+		}
+		progress.Add(1, 0)
+	}
+
+	return result(), nil
+}
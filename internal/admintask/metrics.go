@@ -0,0 +1,31 @@
+package admintask
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+)
+
+var (
+	runningTasksGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "admin_tasks_running",
+			Help: "Admin tasks running on this replica",
+		},
+		[]string{"kind"},
+	)
+
+	finishedTasksTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "admin_tasks_finished_total",
+			Help: "Total number of admin tasks finished on this replica",
+		},
+		[]string{"kind", "status"},
+	)
+
+	staleTasksTotal = telemetry.NewCounter(
+		prometheus.CounterOpts{
+			Name: "admin_tasks_requeued_stale_total",
+			Help: "Total number of admin tasks queued again after making no progress for ADMIN_TASK_STALE_AFTER",
+		},
+	)
+)
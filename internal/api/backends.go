@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/admintask"
+	"github.com/rsav/k8s-learning/internal/api/handlers"
+	"github.com/rsav/k8s-learning/internal/api/middleware"
+	"github.com/rsav/k8s-learning/internal/batch"
+	"github.com/rsav/k8s-learning/internal/federation"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
+)
+
+// Repository is the job store behind the API: what the handlers read and write, plus what the
+// server needs to track SLOs, gate startup, release the storage of removed files, reconcile the
+// stored files, run admin tasks, maintain the jobs partitions and rotate credentials.
+type Repository interface {
+	handlers.Repository
+	handlers.UsageRepository
+	handlers.StorageUsageRepository
+	handlers.StatusRepository
+	handlers.ExportRepository
+	handlers.ImportRepository
+	handlers.AdminTaskRepository
+	admintask.Repository
+	batch.Repository
+	CountCompletedJobsWithin(ctx context.Context, since time.Time, threshold time.Duration) (int64, int64, error)
+	ReleaseStorage(ctx context.Context, files map[string]int64) error
+	ReferencedFiles(ctx context.Context, paths []string) (map[string]bool, error)
+	ActiveFiles(ctx context.Context, paths []string) (map[string]bool, error)
+	AddBandwidthUsage(ctx context.Context, usage []database.BandwidthUsage) error
+	MaintainPartitions(ctx context.Context, now time.Time, ahead int, retention time.Duration) (database.PartitionChanges, error)
+	// CheckMigrations fails until every migration in migrationsURL has been applied.
+	CheckMigrations(ctx context.Context, migrationsURL string) error
+	RotatePassword(password string)
+	Close() error
+}
+
+// Queue is the job queue behind the API, which also backs rate limiting.
+type Queue interface {
+	handlers.Queue
+	handlers.StatusQueue
+	handlers.PoisonQueue
+	handlers.EmailSuppressions
+	handlers.ProcessingSwitch
+	handlers.MaintenanceSwitch
+	middleware.RateLimiter
+	// PopExpiredFailed and RestoreFailed move failed queue messages out for archiving and back.
+	PopExpiredFailed(ctx context.Context, cutoff time.Time, limit int64) ([]string, error)
+	RestoreFailed(ctx context.Context, messages []string) error
+	admintask.Queue
+	batch.Queue
+	WatchMemory(ctx context.Context, watermark float64, interval time.Duration)
+	RotatePassword(password string)
+	Close() error
+}
+
+// FileStorage stores uploads and results.
+type FileStorage interface {
+	handlers.FileStorage
+	handlers.ExportFiles
+	handlers.ImportFiles
+	SetMaxFileSize(maxSize int64)
+	admintask.ExportFiles
+	admintask.ReencryptFiles
+	// CleanupOldFiles removes files older than maxAge and returns their sizes by path.
+	CleanupOldFiles(maxAge time.Duration) (map[string]int64, error)
+	// CleanupQuarantine removes quarantined uploads older than maxAge.
+	CleanupQuarantine(maxAge time.Duration) (int, error)
+	// Volumes returns the space of the volumes the files are stored on.
+	Volumes() ([]filestore.Volume, error)
+}
+
+// Federation reads the queues of other regions.
+type Federation interface {
+	handlers.Regions
+	Remotes() []federation.Region
+	RotatePassword(password string)
+	Close() error
+}
+
+// EventBus publishes job lifecycle events and flushes them on Close.
+type EventBus interface {
+	handlers.EventPublisher
+	Close()
+}
+
+// JobWaiter wakes long-polling requests on job events until Run returns.
+type JobWaiter interface {
+	handlers.JobWaiter
+	Run(ctx context.Context)
+}
+
+// Backends are the storage, queue and event backends the server is wired to. The server owns
+// them and closes them on shutdown.
+type Backends struct {
+	Repo  Repository
+	Queue Queue
+	Files FileStorage
+	// Federation is nil when the queue is not federated.
+	Federation Federation
+	Events     EventBus
+	// Waiter is nil when job events are not published to Redis.
+	Waiter JobWaiter
+	// Notifiers are the chat sinks among the event sinks, tested by POST /api/v1/notifications/test.
+	Notifiers []handlers.Notifier
+}
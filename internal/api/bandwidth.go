@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// bandwidthFlushInterval is how often the bandwidth accumulated in memory is added to the database.
+const bandwidthFlushInterval = time.Minute
+
+type bandwidthKey struct {
+	day      time.Time
+	tenantID string
+	route    string
+}
+
+// bandwidthAccumulator sums the request and response bytes per day, tenant and route in memory
+// between flushes, so the database sees one upsert per key and interval instead of one per request.
+type bandwidthAccumulator struct {
+	mu     sync.Mutex
+	totals map[bandwidthKey]*database.BandwidthUsage
+}
+
+func newBandwidthAccumulator() *bandwidthAccumulator {
+	return &bandwidthAccumulator{totals: make(map[bandwidthKey]*database.BandwidthUsage)}
+}
+
+// RecordBandwidth adds a request to the totals of the current day (UTC).
+func (b *bandwidthAccumulator) RecordBandwidth(tenantID, route string, bytesIn, bytesOut int64) {
+	key := bandwidthKey{
+		day:      time.Now().UTC().Truncate(24 * time.Hour),
+		tenantID: tenantID,
+		route:    route,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	usage, ok := b.totals[key]
+	if !ok {
+		usage = &database.BandwidthUsage{Day: key.day, TenantID: tenantID, Route: route}
+		b.totals[key] = usage
+	}
+	usage.Requests++
+	usage.BytesIn += bytesIn
+	usage.BytesOut += bytesOut
+}
+
+// drain returns the totals accumulated since the last drain and starts over.
+func (b *bandwidthAccumulator) drain() []database.BandwidthUsage {
+	b.mu.Lock()
+	totals := b.totals
+	b.totals = make(map[bandwidthKey]*database.BandwidthUsage, len(totals))
+	b.mu.Unlock()
+
+	usage := make([]database.BandwidthUsage, 0, len(totals))
+	for _, u := range totals {
+		usage = append(usage, *u)
+	}
+	return usage
+}
+
+// restore adds totals that could not be flushed back, to be retried with the next flush.
+func (b *bandwidthAccumulator) restore(usage []database.BandwidthUsage) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, u := range usage {
+		key := bandwidthKey{day: u.Day, tenantID: u.TenantID, route: u.Route}
+		if current, ok := b.totals[key]; ok {
+			current.Requests += u.Requests
+			current.BytesIn += u.BytesIn
+			current.BytesOut += u.BytesOut
+			continue
+		}
+		b.totals[key] = &u
+	}
+}
+
+// persistBandwidth periodically adds the accumulated bandwidth to the daily totals in the database.
+// The last interval is flushed on shutdown.
+func (s *Server) persistBandwidth(ctx context.Context) {
+	ticker := time.NewTicker(bandwidthFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.flushBandwidth(ctx)
+		}
+	}
+}
+
+func (s *Server) flushBandwidth(ctx context.Context) {
+	usage := s.bandwidth.drain()
+	if len(usage) == 0 {
+		return
+	}
+
+	if err := s.repo.AddBandwidthUsage(ctx, usage); err != nil {
+		s.log.ErrorContext(ctx, "failed to persist bandwidth usage", "error", err, "entries", len(usage))
+		s.bandwidth.restore(usage)
+	}
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/api/metrics"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
+)
+
+// emergencyCleanupTarget is the multiple of the watermark the emergency cleanup frees a volume up
+// to, so it does not fall below the watermark again right away.
+const emergencyCleanupTarget = 2
+
+// errDiskSpaceLow fails the readiness check while a volume is below the free space watermark.
+var errDiskSpaceLow = errors.New("storage volume below the free space watermark")
+
+// watchDisk checks the free space of the upload and result volumes every interval. While one is
+// below the watermark, the API is not ready and rejects uploads, and the emergency cleanup removes
+// expendable files. Should the space be unreadable, the last state is kept.
+func (s *Server) watchDisk(ctx context.Context) {
+	cfg := s.config.Disk
+	ticker := time.NewTicker(cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.checkDisk(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) checkDisk(ctx context.Context) {
+	cfg := s.config.Disk
+
+	volumes, err := s.fileStore.Volumes()
+	if err != nil {
+		s.log.WarnContext(ctx, "failed to check storage volume space", "error", err)
+		return
+	}
+
+	low := false
+	for _, volume := range volumes {
+		volumeLow := volume.FreeRatio() < cfg.FreeWatermark
+		if volumeLow && cfg.EmergencyCleanup {
+			s.emergencyCleanup(ctx, volume)
+			if refreshed, err := s.fileStore.Volumes(); err == nil {
+				for _, v := range refreshed {
+					if v.Device == volume.Device {
+						volume = v
+					}
+				}
+				volumeLow = volume.FreeRatio() < cfg.FreeWatermark
+			}
+		}
+
+		name := volume.Name()
+		metrics.DiskTotalBytes.WithLabelValues(name).Set(float64(volume.TotalBytes))
+		metrics.DiskFreeBytes.WithLabelValues(name).Set(float64(volume.FreeBytes))
+		metrics.DiskSpaceLow.WithLabelValues(name).Set(boolGauge(volumeLow))
+		low = low || volumeLow
+	}
+
+	if s.diskLow.Swap(low) != low {
+		if low {
+			s.log.WarnContext(ctx, "storage volume below free space watermark, rejecting uploads",
+				"volumes", volumes, "watermark", cfg.FreeWatermark)
+		} else {
+			s.log.InfoContext(ctx, "storage volumes back above free space watermark, accepting uploads",
+				"volumes", volumes, "watermark", cfg.FreeWatermark)
+		}
+	}
+}
+
+// emergencyCleanup removes the oldest files of the volume older than the emergency min age until
+// twice the watermark is free, keeping the files of pending and running jobs. The removed files
+// are released from their tenants' storage usage like those removed by the retention.
+func (s *Server) emergencyCleanup(ctx context.Context, volume filestore.Volume) {
+	cfg := s.config.Disk
+	target := int64(min(cfg.FreeWatermark*emergencyCleanupTarget, 1) * float64(volume.TotalBytes))
+	needed := target - volume.FreeBytes
+	if needed <= 0 {
+		return
+	}
+
+	files, err := s.fileStore.ListStoredFiles()
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to list files for emergency cleanup", "error", err)
+		return
+	}
+
+	cutoff := time.Now().Add(-cfg.EmergencyMinAge)
+	candidates := make([]filestore.StoredFile, 0, len(files))
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		onVolume := (file.Upload && volume.Uploads) || (!file.Upload && volume.Results)
+		if onVolume && file.ModTime.Before(cutoff) {
+			candidates = append(candidates, file)
+			paths = append(paths, file.Path)
+		}
+	}
+	slices.SortFunc(candidates, func(a, b filestore.StoredFile) int {
+		return a.ModTime.Compare(b.ModTime)
+	})
+
+	active, err := s.repo.ActiveFiles(ctx, paths)
+	if err != nil {
+		s.log.ErrorContext(ctx, "failed to resolve files of active jobs for emergency cleanup", "error", err)
+		return
+	}
+
+	removed := make(map[string]int64)
+	var freed int64
+	for _, file := range candidates {
+		if freed >= needed {
+			break
+		}
+		if active[file.Path] {
+			continue
+		}
+		if err := s.fileStore.DeleteFile(file.Path); err != nil {
+			s.log.ErrorContext(ctx, "failed to remove file in emergency cleanup", "error", err, "path", file.Path)
+			continue
+		}
+		removed[file.Path] = file.Size
+		freed += file.Size
+	}
+
+	name := volume.Name()
+	metrics.DiskEmergencyRemovedFilesTotal.WithLabelValues(name).Add(float64(len(removed)))
+	metrics.DiskEmergencyRemovedBytesTotal.WithLabelValues(name).Add(float64(freed))
+	s.log.WarnContext(ctx, "emergency cleanup of storage volume low on space",
+		"volume", name, "files", len(removed), "freed_bytes", freed, "needed_bytes", needed)
+
+	if len(removed) == 0 {
+		return
+	}
+	if err := s.repo.ReleaseStorage(ctx, removed); err != nil {
+		s.log.ErrorContext(ctx, "failed to release storage of removed files", "error", err, "files", len(removed))
+	}
+}
+
+// diskSpaceCheck fails while a storage volume is below the free space watermark.
+func (s *Server) diskSpaceCheck(_ context.Context) error {
+	if s.diskLow.Load() {
+		return errDiskSpaceLow
+	}
+	return nil
+}
+
+func boolGauge(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
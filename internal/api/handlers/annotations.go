@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// Limits of job annotations, which are meant for short triage notes rather than documents.
+const (
+	maxAnnotationBody = 64 << 10
+	maxNotesLength    = 10000
+	maxLabels         = 32
+	maxLabelValue     = 256
+)
+
+// annotateRequest is the body of PATCH /api/v1/jobs/{id}. Revision is the revision of the job the
+// change is based on. Notes replace the notes, "" clears them; labels with a null value are removed
+// and the others added or replaced.
+type annotateRequest struct {
+	Revision *int               `json:"revision"`
+	Notes    *string            `json:"notes"`
+	Labels   map[string]*string `json:"labels"`
+}
+
+// AnnotateJob changes the notes and labels of a job, never its processing, whatever its status.
+// The change only applies if the job is still at the revision the client read, so concurrent
+// triagers do not overwrite each other's notes; otherwise it is answered with 409 JOB_MODIFIED and
+// the client reads the job again. Every change publishes a job.annotated event.
+func (jh *Job) AnnotateJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid job ID format", "INVALID_JOB_ID")
+		return
+	}
+
+	var req annotateRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAnnotationBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest,
+			`expected a JSON body {"revision": 1, "notes": "...", "labels": {"key": "value"}}: `+err.Error(), "INVALID_ANNOTATIONS")
+		return
+	}
+	annotations, err := req.annotations()
+	if err != nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, err.Error(), "INVALID_ANNOTATIONS")
+		return
+	}
+
+	ctx := r.Context()
+	job, err := jh.repo.AnnotateJob(ctx, jobID, *req.Revision, annotations)
+	if errors.Is(err, database.ErrJobModified) {
+		jh.writeErrorWithCode(w, http.StatusConflict, err.Error(), "JOB_MODIFIED")
+		return
+	}
+	if err != nil {
+		jh.log.Error("failed to annotate job", "error", err, "job_id", jobID)
+		jh.writeErrorWithCode(w, http.StatusNotFound, "job not found", "JOB_NOT_FOUND")
+		return
+	}
+
+	event := events.New(events.JobAnnotated, job.ID, eventSource, map[string]any{
+		"revision": job.Revision,
+		"labels":   job.Labels,
+	})
+	event.TenantID = job.TenantID
+	jh.events.Publish(ctx, event)
+
+	jh.writeJSON(w, http.StatusOK, jh.jobsToResponse(ctx, []*database.Job{job})[0])
+}
+
+// annotations validates the request and returns the change it makes.
+func (req annotateRequest) annotations() (database.JobAnnotations, error) {
+	var annotations database.JobAnnotations
+	if req.Revision == nil {
+		return annotations, errors.New("revision is required: send the revision of the job the change is based on")
+	}
+	if req.Notes == nil && len(req.Labels) == 0 {
+		return annotations, errors.New("nothing to change: set notes or labels")
+	}
+
+	if req.Notes != nil {
+		notes := *req.Notes
+		if !utf8.ValidString(notes) || utf8.RuneCountInString(notes) > maxNotesLength || strings.ContainsRune(notes, 0) {
+			return annotations, fmt.Errorf("notes must be valid UTF-8 of at most %d characters without NUL characters", maxNotesLength)
+		}
+		annotations.Notes = req.Notes
+	}
+
+	if len(req.Labels) > maxLabels {
+		return annotations, fmt.Errorf("at most %d labels can be changed at once", maxLabels)
+	}
+	for key, value := range req.Labels {
+		if !database.ValidLabelKey(key) {
+			return annotations, fmt.Errorf("invalid label %q: must be lowercase letters, digits and _ . / -, at most 63 characters", key)
+		}
+		if value == nil {
+			annotations.RemoveLabels = append(annotations.RemoveLabels, key)
+			continue
+		}
+		if len(*value) > maxLabelValue || strings.ContainsRune(*value, 0) {
+			return annotations, fmt.Errorf("invalid value of label %q: must be at most %d bytes without NUL characters", key, maxLabelValue)
+		}
+		if annotations.SetLabels == nil {
+			annotations.SetLabels = make(map[string]string)
+		}
+		annotations.SetLabels[key] = *value
+	}
+
+	return annotations, nil
+}
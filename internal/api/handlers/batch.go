@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/admintask"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// maxBatchBody bounds the body of bulk operations, which only holds a filter.
+const maxBatchBody = 16 << 10
+
+// BatchRunner starts background tasks canceling and retrying the jobs matching a filter, failing
+// with admintask.ErrInvalidParams for invalid filters.
+type BatchRunner interface {
+	Cancel(ctx context.Context, params database.JSONB) (*database.AdminTask, error)
+	Retry(ctx context.Context, params database.JSONB) (*database.AdminTask, error)
+}
+
+// BatchAdmin serves the admin endpoints canceling and retrying jobs in bulk, which can touch
+// thousands of jobs and therefore run as admin tasks whose progress is polled.
+type BatchAdmin struct {
+	runner BatchRunner
+	log    *slog.Logger
+}
+
+// batchRequest is the body of the bulk operations. Every set criterion must match: the status, the
+// creation range [from, to) in RFC 3339, a label selector such as "team=ops,!reviewed", the tenant
+// and the processing type.
+type batchRequest struct {
+	Status         []database.JobStatus `json:"status"`
+	From           *time.Time           `json:"from"`
+	To             *time.Time           `json:"to"`
+	Labels         string               `json:"labels"`
+	TenantID       string               `json:"tenant_id"`
+	ProcessingType string               `json:"processing_type"`
+}
+
+func NewBatchAdmin(runner BatchRunner, log *slog.Logger) *BatchAdmin {
+	return &BatchAdmin{
+		runner: runner,
+		log:    log,
+	}
+}
+
+// BatchCancel starts a task canceling the pending jobs matching the filter; status may be omitted
+// and otherwise must be pending. Workers skip canceled jobs they consume later.
+func (ba *BatchAdmin) BatchCancel(w http.ResponseWriter, r *http.Request) {
+	req, ok := ba.decodeFilter(w, r)
+	if !ok {
+		return
+	}
+
+	task, err := ba.runner.Cancel(r.Context(), req.params())
+	ba.writeTask(w, r, task, err)
+}
+
+// BatchRetry starts a task queueing the failed or canceled jobs matching the filter again; status
+// defaults to both.
+func (ba *BatchAdmin) BatchRetry(w http.ResponseWriter, r *http.Request) {
+	req, ok := ba.decodeFilter(w, r)
+	if !ok {
+		return
+	}
+
+	task, err := ba.runner.Retry(r.Context(), req.params())
+	ba.writeTask(w, r, task, err)
+}
+
+// decodeFilter decodes the filter of a bulk operation, which the task validates when it starts.
+func (ba *BatchAdmin) decodeFilter(w http.ResponseWriter, r *http.Request) (batchRequest, bool) {
+	var req batchRequest
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBatchBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		ba.writeError(w, http.StatusBadRequest,
+			`expected a JSON body {"status": ["failed"], "from": "2024-01-01T00:00:00Z", "labels": "team=ops"}: `+err.Error(), "INVALID_FILTER")
+		return req, false
+	}
+	return req, true
+}
+
+// params are the params of the task, in which it records the request.
+func (req batchRequest) params() database.JSONB {
+	params := database.JSONB{}
+	if len(req.Status) > 0 {
+		params["status"] = req.Status
+	}
+	if req.From != nil {
+		params["from"] = req.From.UTC().Format(time.RFC3339)
+	}
+	if req.To != nil {
+		params["to"] = req.To.UTC().Format(time.RFC3339)
+	}
+	if req.Labels != "" {
+		params["labels"] = req.Labels
+	}
+	if req.TenantID != "" {
+		params["tenant_id"] = req.TenantID
+	}
+	if req.ProcessingType != "" {
+		params["processing_type"] = req.ProcessingType
+	}
+	return params
+}
+
+// writeTask answers 202 with the started task, whose progress is polled at the Location.
+func (ba *BatchAdmin) writeTask(w http.ResponseWriter, r *http.Request, task *database.AdminTask, err error) {
+	if errors.Is(err, admintask.ErrInvalidParams) {
+		ba.writeError(w, http.StatusBadRequest, err.Error(), "INVALID_FILTER")
+		return
+	}
+	if err != nil {
+		ba.log.ErrorContext(r.Context(), "failed to start batch task", "error", err)
+		ba.writeError(w, http.StatusInternalServerError, "failed to start batch task", "TASK_ERROR")
+		return
+	}
+
+	ba.log.InfoContext(r.Context(), "batch task queued", "task_id", task.ID, "kind", task.Kind)
+	w.Header().Set("Location", "/api/v1/admin/tasks/"+task.ID.String())
+	ba.writeJSON(w, r, http.StatusAccepted, task)
+}
+
+func (ba *BatchAdmin) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		ba.log.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+func (ba *BatchAdmin) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		ba.log.Error("failed to encode error response", "error", err)
+	}
+}
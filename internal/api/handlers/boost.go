@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+// BoostJob moves a pending job to the priority queue of its processing type and answers with the
+// job and its new queue position. The job.boosted event it publishes records the boost in the job's
+// event history.
+func (jh *Job) BoostJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid job ID format", "INVALID_JOB_ID")
+		return
+	}
+
+	ctx := r.Context()
+	job, err := jh.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		jh.log.Error("failed to get job", "error", err, "job_id", jobID)
+		jh.writeErrorWithCode(w, http.StatusNotFound, "job not found", "JOB_NOT_FOUND")
+		return
+	}
+
+	if job.Status != database.JobStatusPending {
+		jh.writeErrorWithCode(w, http.StatusConflict, "only pending jobs can be boosted, current status: "+job.Status.String(), "JOB_NOT_PENDING")
+		return
+	}
+
+	if err := jh.queue.BoostJob(ctx, jobID, job.ProcessingType, job.TenantID); err != nil {
+		if errors.Is(err, queue.ErrJobNotQueued) {
+			jh.writeErrorWithCode(w, http.StatusConflict, err.Error(), "JOB_NOT_QUEUED")
+			return
+		}
+		jh.log.Error("failed to boost job", "error", err, "job_id", jobID)
+		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to boost job", "BOOST_ERROR")
+		return
+	}
+
+	event := events.New(events.JobBoosted, job.ID, eventSource, map[string]any{
+		"processing_type": job.ProcessingType,
+		"queue":           queue.TypePriorityQueue(job.ProcessingType),
+	})
+	event.TenantID = job.TenantID
+	jh.events.Publish(ctx, event)
+
+	response := jh.jobsToResponse(ctx, []*database.Job{job})[0]
+	jh.estimateCompletion(ctx, &response, job)
+	jh.writeJSON(w, http.StatusOK, response)
+}
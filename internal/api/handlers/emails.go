@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// EmailSuppressions is the list of addresses the workers stop emailing after the SMTP server
+// rejected them permanently.
+type EmailSuppressions interface {
+	GetSuppressedEmails(ctx context.Context) ([]string, error)
+	UnsuppressEmail(ctx context.Context, address string) (bool, error)
+}
+
+// EmailAdmin serves the admin endpoints of the job notification emails.
+type EmailAdmin struct {
+	suppressions EmailSuppressions
+	log          *slog.Logger
+}
+
+type suppressedEmailsResponse struct {
+	Addresses []string `json:"addresses"`
+	Total     int      `json:"total"`
+}
+
+func NewEmailAdmin(suppressions EmailSuppressions, log *slog.Logger) *EmailAdmin {
+	return &EmailAdmin{
+		suppressions: suppressions,
+		log:          log,
+	}
+}
+
+// ListSuppressed lists the suppressed addresses.
+func (ea *EmailAdmin) ListSuppressed(w http.ResponseWriter, r *http.Request) {
+	addresses, err := ea.suppressions.GetSuppressedEmails(r.Context())
+	if err != nil {
+		ea.log.ErrorContext(r.Context(), "failed to get suppressed email addresses", "error", err)
+		ea.writeError(w, http.StatusInternalServerError, "failed to get suppressed email addresses", "EMAIL_SUPPRESSION_ERROR")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(suppressedEmailsResponse{Addresses: addresses, Total: len(addresses)}); err != nil {
+		ea.log.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+// DeleteSuppressed removes an address from the suppression list, e.g. once its mailbox exists again.
+func (ea *EmailAdmin) DeleteSuppressed(w http.ResponseWriter, r *http.Request) {
+	address := r.PathValue("address")
+
+	removed, err := ea.suppressions.UnsuppressEmail(r.Context(), address)
+	if err != nil {
+		ea.log.ErrorContext(r.Context(), "failed to unsuppress email address", "error", err)
+		ea.writeError(w, http.StatusInternalServerError, "failed to unsuppress email address", "EMAIL_SUPPRESSION_ERROR")
+		return
+	}
+	if !removed {
+		ea.writeError(w, http.StatusNotFound, "email address not suppressed", "EMAIL_NOT_SUPPRESSED")
+		return
+	}
+
+	ea.log.InfoContext(r.Context(), "email address unsuppressed")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (ea *EmailAdmin) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		ea.log.Error("failed to encode error response", "error", err)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// estimateCompletion adds the queue position and estimated completion time to the response of a
+// pending or running job. The estimate assumes the jobs of the type running now are as many as the
+// workers consuming it, each taking the type's rolling average duration. Estimates are best effort:
+// what cannot be read is left out.
+func (jh *Job) estimateCompletion(ctx context.Context, response *jobResponse, job *database.Job) {
+	if job.Status != database.JobStatusPending && job.Status != database.JobStatusRunning {
+		return
+	}
+
+	average, err := jh.queue.GetAverageDuration(ctx, job.ProcessingType)
+	if err != nil {
+		jh.log.WarnContext(ctx, "failed to get average job duration", "error", err, "job_id", job.ID)
+	}
+
+	now := time.Now()
+	if job.Status == database.JobStatusRunning {
+		if average > 0 && job.StartedAt != nil {
+			eta := job.StartedAt.Add(average)
+			if eta.Before(now) {
+				// Overrunning the average, the job is expected to finish any moment
+				eta = now
+			}
+			eta = eta.Truncate(time.Second).UTC()
+			response.ETA = &eta
+		}
+		return
+	}
+
+	ahead, queued, err := jh.queue.GetQueuePosition(ctx, job.ID, job.ProcessingType, job.TenantID)
+	if err != nil {
+		jh.log.WarnContext(ctx, "failed to get queue position", "error", err, "job_id", job.ID)
+		return
+	}
+	if !queued {
+		return
+	}
+
+	position := ahead + 1
+	response.QueuePosition = &position
+	if average <= 0 {
+		return
+	}
+
+	running, err := jh.repo.CountRunningJobsOfType(ctx, job.ProcessingType)
+	if err != nil {
+		jh.log.WarnContext(ctx, "failed to count running jobs", "error", err, "job_id", job.ID)
+		return
+	}
+
+	// The jobs ahead are shared among the busy workers, then the job itself runs
+	rounds := float64(ahead)/float64(max(running, 1)) + 1
+	eta := now.Add(time.Duration(rounds * float64(average))).Truncate(time.Second).UTC()
+	response.ETA = &eta
+}
@@ -0,0 +1,426 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/tenant"
+)
+
+const (
+	defaultExportRange = 24 * time.Hour
+	exportPageSize     = 100
+	exportMetadataFile = "jobs.jsonl"
+	exportResultDir    = "results/"
+)
+
+type ExportRepository interface {
+	ExportJobs(ctx context.Context, filter database.ExportFilter) ([]*database.Job, error)
+}
+
+// ExportFiles opens result files for streaming into an export archive.
+type ExportFiles interface {
+	OpenFile(filePath string) (io.ReadCloser, int64, error)
+}
+
+type Export struct {
+	repo  ExportRepository
+	files ExportFiles
+	// tempDir is where the metadata is spooled, the system temporary directory when empty.
+	tempDir string
+	log     *slog.Logger
+}
+
+// exportRecord is a line of the metadata file: the job as returned by the jobs API, and the
+// archive path of its result, if the archive holds one.
+type exportRecord struct {
+	jobResponse
+	ResultFile string `json:"result_file,omitempty"`
+}
+
+func NewExport(repo ExportRepository, files ExportFiles, tempDir string, log *slog.Logger) *Export {
+	return &Export{
+		repo:    repo,
+		files:   files,
+		tempDir: tempDir,
+		log:     log,
+	}
+}
+
+// Export streams an archive of the jobs created in a time window: their results under results/
+// and their metadata, one job per line, in jobs.jsonl.
+// Query parameters: from and to (RFC 3339, default the last 24 hours), status, tenant,
+// processing_type and format (tar.gz or zip, default tar.gz).
+//
+// Jobs are read a page at a time and results are copied from disk, so memory stays bounded
+// whatever the size of the export; the metadata is spooled to a temporary file until the results
+// are written. Errors after the first byte cannot change the status code, so they abort the
+// response and leave the client with a truncated archive.
+func (eh *Export) Export(w http.ResponseWriter, r *http.Request) {
+	filter, format, err := parseExportQuery(r.URL.Query())
+	if err != nil {
+		eh.writeError(w, http.StatusBadRequest, err.Error(), "INVALID_EXPORT_QUERY")
+		return
+	}
+
+	// The first page is read before any byte is written, so an unavailable database still gets
+	// an error response
+	jobs, err := eh.repo.ExportJobs(r.Context(), filter)
+	if err != nil {
+		eh.log.ErrorContext(r.Context(), "failed to export jobs", "error", err)
+		eh.writeError(w, http.StatusInternalServerError, "failed to export jobs", "EXPORT_ERROR")
+		return
+	}
+
+	metadata, removeMetadata, err := createMetadataFile(eh.tempDir)
+	if err != nil {
+		eh.log.ErrorContext(r.Context(), "failed to create export metadata file", "error", err)
+		eh.writeError(w, http.StatusInternalServerError, "failed to export jobs", "EXPORT_ERROR")
+		return
+	}
+	defer removeMetadata()
+
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"export_%s_%s.%s\"",
+		filter.From.Format("20060102T150405Z"), filter.To.Format("20060102T150405Z"), format.extension))
+	w.WriteHeader(http.StatusOK)
+
+	archive := format.newArchive(w)
+	exported, err := eh.writeArchive(r.Context(), archive, metadata, filter, jobs, nil)
+	if err == nil {
+		err = archive.Close()
+	}
+	if err != nil {
+		eh.log.ErrorContext(r.Context(), "export aborted", "error", err, "exported_jobs", exported)
+		// Reset the connection, so clients cannot mistake the truncated archive for a complete one
+		panic(http.ErrAbortHandler)
+	}
+
+	eh.log.InfoContext(r.Context(), "jobs exported",
+		"jobs", exported, "from", filter.From, "to", filter.To, "format", format.extension)
+}
+
+// ResolveExport validates an export query for an export run later, as an admin task, and returns
+// it with its time range and format set, so that it exports the same jobs whenever it runs.
+func (eh *Export) ResolveExport(query url.Values) (url.Values, error) {
+	filter, format, err := parseExportQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := make(url.Values, len(query))
+	for key, values := range query {
+		resolved[key] = slices.Clone(values)
+	}
+	resolved.Set("from", filter.From.Format(time.RFC3339))
+	resolved.Set("to", filter.To.Format(time.RFC3339))
+	resolved.Set("format", format.extension)
+	return resolved, nil
+}
+
+// WriteExport writes the archive GET /api/v1/export serves for the query to w, calling exported
+// after every job, and returns how many jobs it exported.
+func (eh *Export) WriteExport(ctx context.Context, w io.Writer, query url.Values, exported func()) (int, error) {
+	filter, format, err := parseExportQuery(query)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs, err := eh.repo.ExportJobs(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	metadata, removeMetadata, err := createMetadataFile(eh.tempDir)
+	if err != nil {
+		return 0, err
+	}
+	defer removeMetadata()
+
+	archive := format.newArchive(w)
+	count, err := eh.writeArchive(ctx, archive, metadata, filter, jobs, exported)
+	if err == nil {
+		err = archive.Close()
+	}
+	return count, err
+}
+
+// createMetadataFile creates the temporary file the metadata is spooled to until the results are
+// written, and a function removing it.
+func createMetadataFile(tempDir string) (*os.File, func(), error) {
+	metadata, err := os.CreateTemp(tempDir, "export-*.jsonl")
+	if err != nil {
+		return nil, nil, fmt.Errorf("create export metadata file: %w", err)
+	}
+	return metadata, func() {
+		_ = metadata.Close()
+		_ = os.Remove(metadata.Name())
+	}, nil
+}
+
+// writeArchive adds the results of every matching job, page after page, then the metadata. It
+// calls exported, unless nil, after every job.
+func (eh *Export) writeArchive(
+	ctx context.Context, archive archiveWriter, metadata *os.File, filter database.ExportFilter, jobs []*database.Job,
+	exported func(),
+) (int, error) {
+	encoder := json.NewEncoder(metadata)
+	encoder.SetEscapeHTML(false)
+
+	count := 0
+	for len(jobs) > 0 {
+		for _, job := range jobs {
+			record := exportRecord{jobResponse: jobToResponse(job)}
+
+			if job.Status == database.JobStatusSucceeded && job.ResultPath != "" {
+				format := database.OutputFormatFromParams(job.ProcessingType, job.Parameters)
+				name := fmt.Sprintf("%s%s.%s", exportResultDir, job.ID, format.Extension())
+				added, err := eh.addResult(archive, name, job)
+				if err != nil {
+					return count, err
+				}
+				if added {
+					record.ResultFile = name
+				}
+			}
+
+			if err := encoder.Encode(record); err != nil {
+				return count, fmt.Errorf("write metadata: %w", err)
+			}
+			count++
+			if exported != nil {
+				exported()
+			}
+		}
+
+		if len(jobs) < filter.Limit {
+			break
+		}
+		last := jobs[len(jobs)-1]
+		filter.After, filter.AfterID = last.CreatedAt, last.ID
+
+		var err error
+		if jobs, err = eh.repo.ExportJobs(ctx, filter); err != nil {
+			return count, err
+		}
+	}
+
+	if _, err := metadata.Seek(0, io.SeekStart); err != nil {
+		return count, fmt.Errorf("rewind metadata: %w", err)
+	}
+	info, err := metadata.Stat()
+	if err != nil {
+		return count, fmt.Errorf("stat metadata: %w", err)
+	}
+	if err := archive.Add(exportMetadataFile, info.Size(), time.Now(), metadata); err != nil {
+		return count, err
+	}
+
+	return count, nil
+}
+
+// addResult copies a result file into the archive. Results already removed by retention are left
+// out, which the metadata shows by the missing result_file.
+func (eh *Export) addResult(archive archiveWriter, name string, job *database.Job) (bool, error) {
+	file, size, err := eh.files.OpenFile(job.ResultPath)
+	if err != nil {
+		eh.log.Warn("result file missing from export", "error", err, "job_id", job.ID)
+		return false, nil
+	}
+	defer file.Close()
+
+	modTime := job.CreatedAt
+	if job.CompletedAt != nil {
+		modTime = *job.CompletedAt
+	}
+	if err := archive.Add(name, size, modTime, file); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func parseExportQuery(query url.Values) (database.ExportFilter, exportFormat, error) {
+	filter := database.ExportFilter{
+		To:    time.Now().UTC(),
+		Limit: exportPageSize,
+	}
+
+	if to := query.Get("to"); to != "" {
+		parsed, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, exportFormat{}, fmt.Errorf("invalid to: %w", err)
+		}
+		filter.To = parsed.UTC()
+	}
+
+	filter.From = filter.To.Add(-defaultExportRange)
+	if from := query.Get("from"); from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, exportFormat{}, fmt.Errorf("invalid from: %w", err)
+		}
+		filter.From = parsed.UTC()
+	}
+
+	if !filter.From.Before(filter.To) {
+		return filter, exportFormat{}, errors.New("from must be before to")
+	}
+
+	if status := query.Get("status"); status != "" {
+		jobStatus, ok := database.ToJobStatus(status)
+		if !ok {
+			return filter, exportFormat{}, fmt.Errorf("invalid status: %s", status)
+		}
+		filter.Status = jobStatus
+	}
+
+	if tenantID := query.Get("tenant"); tenantID != "" {
+		if !tenant.Valid(tenantID) {
+			return filter, exportFormat{}, fmt.Errorf("invalid tenant: %s", tenantID)
+		}
+		filter.TenantID = tenantID
+	}
+
+	if processingType := query.Get("processing_type"); processingType != "" {
+		pt, ok := database.ToProcessingType(processingType)
+		if !ok {
+			return filter, exportFormat{}, fmt.Errorf("invalid processing_type: %s", processingType)
+		}
+		filter.ProcessingType = pt
+	}
+
+	format, err := parseExportFormat(query.Get("format"))
+	return filter, format, err
+}
+
+// parseExportFormat returns the archive format named by the format query parameter, tar.gz when
+// empty.
+func parseExportFormat(name string) (exportFormat, error) {
+	switch name {
+	case "", tarGzFormat.extension:
+		return tarGzFormat, nil
+	case zipFormat.extension:
+		return zipFormat, nil
+	default:
+		return exportFormat{}, errors.New("invalid format: must be one of tar.gz, zip")
+	}
+}
+
+func (eh *Export) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		eh.log.Error("failed to encode error response", "error", err)
+	}
+}
+
+// archiveWriter writes the entries of an export archive in a single pass.
+type archiveWriter interface {
+	Add(name string, size int64, modTime time.Time, content io.Reader) error
+	Close() error
+}
+
+// exportFormat is an archive format exports are written in and imports read.
+type exportFormat struct {
+	extension   string
+	contentType string
+	newArchive  func(w io.Writer) archiveWriter
+	// readArchive calls visit with the name and content of every file in an archive, spooling it
+	// to tempDir when the format needs it.
+	readArchive func(r io.Reader, tempDir string, visit func(name string, content io.Reader) error) error
+}
+
+//nolint:gochecknoglobals // export formats are read-only
+var (
+	tarGzFormat = exportFormat{
+		extension:   "tar.gz",
+		contentType: "application/gzip",
+		newArchive: func(w io.Writer) archiveWriter {
+			gz := gzip.NewWriter(w)
+			return &tarGzArchive{gz: gz, tar: tar.NewWriter(gz)}
+		},
+		readArchive: readTarGz,
+	}
+	zipFormat = exportFormat{
+		extension:   "zip",
+		contentType: "application/zip",
+		newArchive: func(w io.Writer) archiveWriter {
+			return &zipArchive{zip: zip.NewWriter(w)}
+		},
+		readArchive: readZip,
+	}
+)
+
+type tarGzArchive struct {
+	gz  *gzip.Writer
+	tar *tar.Writer
+}
+
+func (a *tarGzArchive) Add(name string, size int64, modTime time.Time, content io.Reader) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    size,
+		ModTime: modTime,
+		Format:  tar.FormatPAX,
+	}
+	if err := a.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("write archive header: %w", err)
+	}
+	// A file that grew since it was sized is cut at the size in the header
+	if _, err := io.CopyN(a.tar, content, size); err != nil {
+		return fmt.Errorf("write archive entry %s: %w", name, err)
+	}
+	return nil
+}
+
+func (a *tarGzArchive) Close() error {
+	if err := a.tar.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	if err := a.gz.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return nil
+}
+
+type zipArchive struct {
+	zip *zip.Writer
+}
+
+func (a *zipArchive) Add(name string, _ int64, modTime time.Time, content io.Reader) error {
+	entry, err := a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return fmt.Errorf("write archive header: %w", err)
+	}
+	if _, err := io.Copy(entry, content); err != nil {
+		return fmt.Errorf("write archive entry %s: %w", name, err)
+	}
+	return nil
+}
+
+func (a *zipArchive) Close() error {
+	if err := a.zip.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return nil
+}
@@ -6,84 +6,89 @@ import (
 	"net/http"
 	"sync"
 	"time"
+
+	"github.com/rsav/k8s-learning/internal/federation"
+	"github.com/rsav/k8s-learning/internal/storage/database"
 )
 
 type Health struct {
 	repo  Repository
 	queue Queue
-	log   *slog.Logger
+	// regions is nil unless the queue is federated across regions.
+	regions Regions
+	log     *slog.Logger
 }
 
-func NewHealth(repo Repository, queue Queue, log *slog.Logger) *Health {
+func NewHealth(repo Repository, queue Queue, regions Regions, log *slog.Logger) *Health {
 	return &Health{
-		repo:  repo,
-		queue: queue,
-		log:   log,
+		repo:    repo,
+		queue:   queue,
+		regions: regions,
+		log:     log,
 	}
 }
 
-// Livez is a basic liveness check - process is running and not deadlocked.
-func (hh *Health) Livez(w http.ResponseWriter, _ *http.Request) {
-	health := map[string]interface{}{
-		"status":    "ok",
-		"timestamp": time.Now().Unix(),
-		"service":   "text-api",
+func (hh *Health) Stats(w http.ResponseWriter, r *http.Request) {
+	queueStats, err := hh.queue.GetStats(r.Context())
+	if err != nil {
+		hh.log.Error("failed to get queue stats", "error", err)
+		hh.writeError(w, http.StatusInternalServerError, "failed to get queue stats")
+		return
 	}
 
-	hh.writeJSON(w, http.StatusOK, health)
-}
-
-// Readyz checks if the service is ready to accept traffic (dependencies are healthy).
-func (hh *Health) Readyz(w http.ResponseWriter, r *http.Request) {
-	checks := map[string]interface{}{
-		"database": "unknown",
-		"redis":    "unknown",
+	var jobsMap map[string]int
+	if r.URL.Query().Get("exact") == "true" {
+		jobsMap = hh.countJobs(r)
+	} else {
+		jobsMap = hh.jobStatusCounts(r)
 	}
 
-	allHealthy := true
-
-	if err := hh.repo.HealthCheck(r.Context()); err != nil {
-		checks["database"] = "unhealthy"
-		allHealthy = false
-		hh.log.ErrorContext(r.Context(), "database health check failed", "error", err)
-	} else {
-		checks["database"] = "healthy"
+	stats := map[string]interface{}{
+		"timestamp": time.Now().Unix(),
+		"service":   "text-api",
+		"queue":     queueStats,
+		"jobs":      jobsMap,
 	}
 
-	if err := hh.queue.HealthCheck(r.Context()); err != nil {
-		checks["redis"] = "unhealthy"
-		allHealthy = false
-		hh.log.ErrorContext(r.Context(), "redis health check failed", "error", err)
-	} else {
-		checks["redis"] = "healthy"
+	// Queues are per region while jobs live in the shared database, so only queues are broken down
+	if hh.regions != nil {
+		regionStats := hh.regions.Stats(r.Context())
+		stats["regions"] = regionStats
+		stats["total"] = federation.Total(regionStats)
 	}
 
-	status := "ready"
-	statusCode := http.StatusOK
+	hh.writeJSON(w, http.StatusOK, stats)
+}
 
-	if !allHealthy {
-		status = "not ready"
-		statusCode = http.StatusServiceUnavailable
+// jobStatusCounts reads the job counts kept per status, which stays cheap under frequent polling.
+// Every count is -1 when they cannot be read.
+func (hh *Health) jobStatusCounts(r *http.Request) map[string]int {
+	statuses := []database.JobStatus{
+		database.JobStatusPending, database.JobStatusRunning, database.JobStatusSucceeded, database.JobStatusFailed,
 	}
+	jobsMap := make(map[string]int, len(statuses)+1)
 
-	response := map[string]interface{}{
-		"status":    status,
-		"timestamp": time.Now().Unix(),
-		"checks":    checks,
-		"service":   "text-api",
+	counts, err := hh.repo.GetJobStatusCounts(r.Context())
+	if err != nil {
+		hh.log.Error("failed to fetch job status counts", "error", err)
+		jobsMap["total"] = -1
+		for _, status := range statuses {
+			jobsMap[status.String()] = -1
+		}
+		return jobsMap
 	}
 
-	hh.writeJSON(w, statusCode, response)
-}
-
-func (hh *Health) Stats(w http.ResponseWriter, r *http.Request) {
-	queueStats, err := hh.queue.GetStats(r.Context())
-	if err != nil {
-		hh.log.Error("failed to get queue stats", "error", err)
-		hh.writeError(w, http.StatusInternalServerError, "failed to get queue stats")
-		return
+	for _, status := range statuses {
+		jobsMap[status.String()] = counts[status]
 	}
+	for _, count := range counts {
+		jobsMap["total"] += count
+	}
+	return jobsMap
+}
 
+// countJobs counts the jobs table per status, for callers asking for exact=true.
+func (hh *Health) countJobs(r *http.Request) map[string]int {
 	wg := &sync.WaitGroup{}
 	jobStats := &sync.Map{}
 
@@ -116,15 +121,7 @@ func (hh *Health) Stats(w http.ResponseWriter, r *http.Request) {
 		}
 		return true
 	})
-
-	stats := map[string]interface{}{
-		"timestamp": time.Now().Unix(),
-		"service":   "text-api",
-		"queue":     queueStats,
-		"jobs":      jobsMap,
-	}
-
-	hh.writeJSON(w, http.StatusOK, stats)
+	return jobsMap
 }
 
 func (hh *Health) writeJSON(w http.ResponseWriter, statusCode int, data interface{}) {
@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/tenant"
+)
+
+// errArchiveTooLarge is returned for archives that decompress to more than the import limits.
+var errArchiveTooLarge = errors.New("archive too large")
+
+type ImportRepository interface {
+	ImportJob(ctx context.Context, job *database.Job) error
+	AddStorageUsage(ctx context.Context, tenantID string, delta database.StorageDelta) error
+}
+
+// ImportFiles stores the result files of an import archive.
+type ImportFiles interface {
+	CopyResultFile(name string, content io.Reader) (string, int64, error)
+	DeleteFile(filePath string) error
+}
+
+type Import struct {
+	repo  ImportRepository
+	files ImportFiles
+	// maxSize is the largest archive accepted, in bytes; maxEntrySize and maxExtractedSize bound
+	// what it decompresses to, per file and in all.
+	maxSize          int64
+	maxEntrySize     int64
+	maxExtractedSize int64
+	// tempDir is where the metadata and zip archives are spooled, the system temporary directory
+	// when empty.
+	tempDir string
+	log     *slog.Logger
+}
+
+type (
+	importResponse struct {
+		// Imported counts the jobs recreated and Results the result files stored for them.
+		Imported int `json:"imported"`
+		Results  int `json:"results"`
+		// Skipped counts the records that could not be imported, such as jobs that had not finished
+		// when they were exported; their reasons are in Errors.
+		Skipped int      `json:"skipped"`
+		Errors  []string `json:"errors,omitempty"`
+	}
+
+	// importedResult is a result file stored from the archive, under the ID of the job it will be
+	// imported as.
+	importedResult struct {
+		jobID uuid.UUID
+		path  string
+		size  int64
+		used  bool
+	}
+)
+
+// maxImportErrors caps the skip reasons listed in the response; Skipped still counts them all.
+const maxImportErrors = 100
+
+func NewImport(
+	repo ImportRepository, files ImportFiles, maxSize, maxEntrySize, maxExtractedSize int64, tempDir string, log *slog.Logger,
+) *Import {
+	return &Import{
+		repo:             repo,
+		files:            files,
+		maxSize:          maxSize,
+		maxEntrySize:     maxEntrySize,
+		maxExtractedSize: maxExtractedSize,
+		tempDir:          tempDir,
+		log:              log,
+	}
+}
+
+// Import recreates the jobs of an export archive, sent as the request body in the format given by
+// the format query parameter (tar.gz or zip, default tar.gz). Jobs get new IDs and keep their
+// exported record under imported_from; their result files are stored again and counted against the
+// storage of their tenant, without enforcing the quota, so restores are never refused. Only
+// succeeded and failed jobs are imported: the archive holds no inputs to run the others again.
+//
+// Records are imported one at a time, so a failure midway leaves the jobs imported so far.
+func (ih *Import) Import(w http.ResponseWriter, r *http.Request) {
+	format, err := parseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		ih.writeError(w, http.StatusBadRequest, err.Error(), "INVALID_IMPORT_QUERY")
+		return
+	}
+
+	metadata, err := os.CreateTemp(ih.tempDir, "import-*.jsonl")
+	if err != nil {
+		ih.log.ErrorContext(r.Context(), "failed to create import metadata file", "error", err)
+		ih.writeError(w, http.StatusInternalServerError, "failed to import archive", "IMPORT_ERROR")
+		return
+	}
+	defer func() {
+		_ = metadata.Close()
+		_ = os.Remove(metadata.Name())
+	}()
+
+	results := make(map[string]*importedResult)
+	defer ih.deleteUnused(results)
+
+	body := http.MaxBytesReader(w, r.Body, ih.maxSize)
+	hasMetadata, err := ih.readArchive(format, body, metadata, results)
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		ih.writeError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("archive exceeds maximum allowed size %d", maxBytesErr.Limit), "ARCHIVE_TOO_LARGE")
+		return
+	case errors.Is(err, errArchiveTooLarge):
+		ih.writeError(w, http.StatusRequestEntityTooLarge, err.Error(), "ARCHIVE_TOO_LARGE")
+		return
+	case err != nil:
+		ih.log.WarnContext(r.Context(), "failed to read import archive", "error", err)
+		ih.writeError(w, http.StatusBadRequest, "invalid archive: "+err.Error(), "INVALID_ARCHIVE")
+		return
+	case !hasMetadata:
+		ih.writeError(w, http.StatusBadRequest, "invalid archive: "+exportMetadataFile+" is missing", "INVALID_ARCHIVE")
+		return
+	}
+
+	if _, err := metadata.Seek(0, io.SeekStart); err != nil {
+		ih.log.ErrorContext(r.Context(), "failed to rewind import metadata", "error", err)
+		ih.writeError(w, http.StatusInternalServerError, "failed to import archive", "IMPORT_ERROR")
+		return
+	}
+
+	response, err := ih.importJobs(r.Context(), metadata, results)
+	if err != nil {
+		ih.log.ErrorContext(r.Context(), "import aborted", "error", err, "imported", response.Imported)
+		ih.writeError(w, http.StatusInternalServerError,
+			fmt.Sprintf("import aborted after %d jobs: %v", response.Imported, err), "IMPORT_ERROR")
+		return
+	}
+
+	ih.log.InfoContext(r.Context(), "jobs imported",
+		"imported", response.Imported, "results", response.Results, "skipped", response.Skipped)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		ih.log.ErrorContext(r.Context(), "failed to encode import response", "error", err)
+	}
+}
+
+// readArchive stores the result files of the archive and spools its metadata, which exports write
+// last, to a file. It reports whether the archive had metadata. Archives that decompress to more
+// than the entry or extracted size fail with errArchiveTooLarge.
+func (ih *Import) readArchive(format exportFormat, body io.Reader, metadata *os.File, results map[string]*importedResult) (bool, error) {
+	hasMetadata := false
+	extracted := ih.maxExtractedSize
+	err := format.readArchive(body, ih.tempDir, func(name string, content io.Reader) error {
+		content = &extractReader{r: content, name: name, entryLeft: ih.maxEntrySize, totalLeft: &extracted}
+		switch {
+		case name == exportMetadataFile:
+			hasMetadata = true
+			if _, err := io.Copy(metadata, content); err != nil {
+				return fmt.Errorf("read %s: %w", name, err)
+			}
+		case strings.HasPrefix(name, exportResultDir) && results[name] == nil:
+			jobID := uuid.New()
+			path, size, err := ih.files.CopyResultFile(fmt.Sprintf("result_%s%s", jobID, filepath.Ext(name)), content)
+			if err != nil {
+				return fmt.Errorf("store %s: %w", name, err)
+			}
+			results[name] = &importedResult{jobID: jobID, path: path, size: size}
+		}
+		// Anything else is not part of the export format
+		return nil
+	})
+	return hasMetadata, err
+}
+
+// importJobs recreates a job for every record of the metadata.
+func (ih *Import) importJobs(ctx context.Context, metadata io.Reader, results map[string]*importedResult) (importResponse, error) {
+	var response importResponse
+	skip := func(line int, reason string) {
+		response.Skipped++
+		if len(response.Errors) < maxImportErrors {
+			response.Errors = append(response.Errors, fmt.Sprintf("line %d: %s", line, reason))
+		}
+	}
+
+	// Results of the jobs imported so far are counted even when the import is aborted
+	storage := make(map[string]database.StorageDelta)
+	defer func() {
+		for tenantID, delta := range storage {
+			if err := ih.repo.AddStorageUsage(ctx, tenantID, delta); err != nil {
+				ih.log.ErrorContext(ctx, "failed to count imported results against storage usage", "error", err, "tenant_id", tenantID)
+			}
+		}
+	}()
+
+	decoder := json.NewDecoder(metadata)
+	for line := 1; ; line++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			// The rest of the metadata cannot be split into records once a line is malformed
+			skip(line, "invalid JSON: "+err.Error())
+			break
+		}
+
+		job, result, err := importedJob(raw, results)
+		if err != nil {
+			skip(line, err.Error())
+			continue
+		}
+
+		if err := ih.repo.ImportJob(ctx, job); err != nil {
+			return response, err
+		}
+		response.Imported++
+
+		if result != nil {
+			result.used = true
+			response.Results++
+			delta := storage[job.TenantID]
+			delta.ResultBytes += result.size
+			delta.Files++
+			storage[job.TenantID] = delta
+		}
+	}
+
+	return response, nil
+}
+
+// importedJob returns the job to recreate from an exported record and its stored result, if any.
+func importedJob(raw json.RawMessage, results map[string]*importedResult) (*database.Job, *importedResult, error) {
+	var record exportRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return nil, nil, fmt.Errorf("invalid record: %w", err)
+	}
+	var original map[string]any
+	if err := json.Unmarshal(raw, &original); err != nil {
+		return nil, nil, fmt.Errorf("invalid record: %w", err)
+	}
+
+	status, ok := database.ToJobStatus(record.Status)
+	if !ok || (status != database.JobStatusSucceeded && status != database.JobStatusFailed) {
+		return nil, nil, fmt.Errorf("job %s: only succeeded and failed jobs can be imported, not %q", record.ID, record.Status)
+	}
+	processingType, ok := database.ToProcessingType(record.ProcessingType)
+	if !ok {
+		return nil, nil, fmt.Errorf("job %s: invalid processing_type %q", record.ID, record.ProcessingType)
+	}
+	if record.TenantID == "" {
+		record.TenantID = tenant.DefaultID
+	}
+	if !tenant.Valid(record.TenantID) {
+		return nil, nil, fmt.Errorf("job %s: invalid tenant_id %q", record.ID, record.TenantID)
+	}
+
+	job := &database.Job{
+		ID:                     uuid.New(),
+		TenantID:               record.TenantID,
+		OriginalFilename:       record.OriginalFilename,
+		SecondOriginalFilename: record.SecondFilename,
+		ProcessingType:         processingType,
+		Parameters:             database.JSONB(record.Parameters),
+		Status:                 status,
+		DelayMS:                record.DelayMS,
+		ErrorMessage:           record.ErrorMessage,
+		CreatedAt:              record.CreatedAt,
+		StartedAt:              record.StartedAt,
+		CompletedAt:            record.CompletedAt,
+		WorkerID:               record.WorkerID,
+		ImportedFrom:           database.JSONB(original),
+		Notes:                  record.Notes,
+		Labels:                 database.JSONB(record.Labels),
+	}
+	if job.Parameters == nil {
+		job.Parameters = database.JSONB{}
+	}
+	if job.Labels == nil {
+		job.Labels = database.JSONB{}
+	}
+	if record.Usage != nil {
+		job.JobUsage = *record.Usage
+	}
+
+	// A result belongs to one job; a second record naming it is imported without
+	result := results[record.ResultFile]
+	if result == nil || result.used || status != database.JobStatusSucceeded {
+		return job, nil, nil
+	}
+	job.ID = result.jobID
+	job.ResultPath = result.path
+	return job, result, nil
+}
+
+// deleteUnused removes the stored results no imported job references.
+func (ih *Import) deleteUnused(results map[string]*importedResult) {
+	for name, result := range results {
+		if result.used {
+			continue
+		}
+		if err := ih.files.DeleteFile(result.path); err != nil {
+			ih.log.Error("failed to delete unused imported result", "error", err, "archive_path", name)
+		}
+	}
+}
+
+func (ih *Import) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		ih.log.Error("failed to encode error response", "error", err)
+	}
+}
+
+// extractReader reads a file of an archive, failing with errArchiveTooLarge once the file exceeds
+// the entry size or the files read so far the extracted size, to stop decompression bombs.
+type extractReader struct {
+	r         io.Reader
+	name      string
+	entryLeft int64
+	totalLeft *int64
+}
+
+func (er *extractReader) Read(p []byte) (int, error) {
+	n, err := er.r.Read(p)
+	er.entryLeft -= int64(n)
+	*er.totalLeft -= int64(n)
+	switch {
+	case er.entryLeft < 0:
+		return n, fmt.Errorf("%w: %s exceeds the maximum file size", errArchiveTooLarge, er.name)
+	case *er.totalLeft < 0:
+		return n, fmt.Errorf("%w: archive exceeds the maximum extracted size", errArchiveTooLarge)
+	}
+	return n, err
+}
+
+// readTarGz calls visit with every regular file of a tar.gz stream.
+func readTarGz(r io.Reader, _ string, visit func(name string, content io.Reader) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("open gzip: %w", err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(header.Name, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// readZip calls visit with every file of a zip stream. Zip archives are indexed at their end, so
+// the stream is spooled to a temporary file in tempDir first.
+func readZip(r io.Reader, tempDir string, visit func(name string, content io.Reader) error) error {
+	spool, err := os.CreateTemp(tempDir, "import-*.zip")
+	if err != nil {
+		return fmt.Errorf("create spool file: %w", err)
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+
+	size, err := io.Copy(spool, r)
+	if err != nil {
+		return fmt.Errorf("spool archive: %w", err)
+	}
+
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		return fmt.Errorf("open zip: %w", err)
+	}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if err := visitZipFile(file, visit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func visitZipFile(file *zip.File, visit func(name string, content io.Reader) error) error {
+	content, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("open %s: %w", file.Name, err)
+	}
+	defer content.Close()
+	return visit(file.Name, content)
+}
@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"context"
-	"mime/multipart"
+	"io"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/federation"
+	"github.com/rsav/k8s-learning/internal/slo"
 	"github.com/rsav/k8s-learning/internal/storage/database"
 	"github.com/rsav/k8s-learning/internal/storage/filestore"
 	"github.com/rsav/k8s-learning/internal/storage/queue"
@@ -12,28 +16,81 @@ import (
 
 type Repository interface {
 	JobsRepository
+	StorageRepository
 	HealthCheck(ctx context.Context) error
 }
 
 type JobsRepository interface {
 	GetJobs(ctx context.Context, req database.GetJobsFilter) ([]*database.Job, error)
+	StreamJobs(ctx context.Context, req database.GetJobsFilter, fn func(*database.Job) error) error
 	GetJobByID(ctx context.Context, id uuid.UUID) (*database.Job, error)
+	GetJobResults(ctx context.Context, id uuid.UUID) ([]database.JobResult, error)
 	CountJobs(ctx context.Context) (int, error)
 	CountJobsByStatus(ctx context.Context, status database.JobStatus) (int, error)
+	GetJobStatusCounts(ctx context.Context) (map[database.JobStatus]int, error)
+	CountRunningJobsOfType(ctx context.Context, processingType database.ProcessingType) (int64, error)
 	CreateJob(ctx context.Context, job *database.Job) error
+	UpdateError(ctx context.Context, id uuid.UUID, errorMessage string) error
+	AnnotateJob(ctx context.Context, id uuid.UUID, revision int, annotations database.JobAnnotations) (*database.Job, error)
+}
+
+type StorageRepository interface {
+	ReserveStorage(ctx context.Context, tenantID string, delta database.StorageDelta, quota int64) error
+	AddStorageUsage(ctx context.Context, tenantID string, delta database.StorageDelta) error
+	GetStorageUsage(ctx context.Context, tenantID string) ([]database.StorageUsage, error)
 }
 
 type Queue interface {
 	PublishJob(ctx context.Context, message queue.SubmitJobMessage) error
+	// MemoryHigh reports whether Redis is above its memory watermark, when PublishJob fails with
+	// queue.ErrMemoryHigh.
+	MemoryHigh() bool
 	GetStats(ctx context.Context) (map[string]interface{}, error)
+	GetJobsProgress(ctx context.Context, jobIDs []uuid.UUID) (map[uuid.UUID]queue.JobProgress, error)
+	GetQueuePosition(ctx context.Context, jobID uuid.UUID, processingType database.ProcessingType, tenantID string) (int64, bool, error)
+	GetAverageDuration(ctx context.Context, processingType database.ProcessingType) (time.Duration, error)
+	BoostJob(ctx context.Context, jobID uuid.UUID, processingType database.ProcessingType, tenantID string) error
 	HealthCheck(ctx context.Context) error
 }
 
+// Regions reports the backlog of every federated region.
+type Regions interface {
+	Stats(ctx context.Context) []federation.RegionStats
+}
+
+// StatusRepository reports the recent job outcomes shown on the status page.
+type StatusRepository interface {
+	CountFinishedJobsSince(ctx context.Context, since time.Time) (int64, int64, error)
+}
+
+// StatusQueue reports the queue depths and the controller's latest scaling decisions shown on the
+// status page.
+type StatusQueue interface {
+	GetTypeQueueLengths(ctx context.Context) (map[database.ProcessingType]int64, error)
+	GetAllQueuesLength(ctx context.Context) (map[string]int64, error)
+	GetScalingDecisions(ctx context.Context, limit int64) ([]string, error)
+}
+
 type FileStorage interface {
-	SaveUploadedFile(fileHeader *multipart.FileHeader) (*filestore.FileInfo, error)
-	ReadFile(filePath string) ([]byte, error)
+	QuarantineUpload(upload filestore.Upload) (*filestore.FileInfo, error)
+	CommitUpload(info *filestore.FileInfo) error
+	DiscardUpload(info *filestore.FileInfo) error
+	OpenFile(filePath string) (io.ReadCloser, int64, error)
 	FileExists(filePath string) bool
 	DeleteFile(filePath string) error
 	GetStoragePaths() (string, string)
 	GetMaxFileSize() int64
 }
+
+type SLOTracker interface {
+	Evaluate(ctx context.Context) slo.Report
+}
+
+type EventPublisher interface {
+	Publish(ctx context.Context, event events.Event)
+}
+
+// JobWaiter wakes long-polling requests once their job succeeded or failed.
+type JobWaiter interface {
+	Wait(jobID uuid.UUID) (<-chan events.Event, func())
+}
@@ -1,11 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"mime/multipart"
 	"net/http"
 	"path/filepath"
 	"strconv"
@@ -14,14 +15,21 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/rsav/k8s-learning/internal/api/metrics"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/processing/schemas"
 	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
 	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/tenant"
+	"github.com/rsav/k8s-learning/internal/tracing"
 )
 
 type (
 	jobResponse struct {
 		ID               uuid.UUID      `json:"id"`
+		TenantID         string         `json:"tenant_id"`
 		OriginalFilename string         `json:"original_filename"`
+		SecondFilename   string         `json:"second_filename,omitempty"`
 		ProcessingType   string         `json:"processing_type"`
 		Parameters       map[string]any `json:"parameters"`
 		Status           string         `json:"status"`
@@ -30,7 +38,28 @@ type (
 		CreatedAt        time.Time      `json:"created_at"`
 		StartedAt        *time.Time     `json:"started_at,omitempty"`
 		CompletedAt      *time.Time     `json:"completed_at,omitempty"`
-		WorkerID         string         `json:"worker_id,omitempty"`
+		// QueueWaitMS (created to started), ProcessingMS (started to completed) and TotalMS
+		// (created to completed) are present once the job reached the stage ending them.
+		QueueWaitMS  *int64 `json:"queue_wait_ms,omitempty"`
+		ProcessingMS *int64 `json:"processing_ms,omitempty"`
+		TotalMS      *int64 `json:"total_ms,omitempty"`
+		WorkerID     string `json:"worker_id,omitempty"`
+		// Usage is present once a worker has finished the job.
+		Usage *database.JobUsage `json:"usage,omitempty"`
+		// Progress is present once a worker has reported it, until an hour after the job finished.
+		Progress *queue.JobProgress `json:"progress,omitempty"`
+		// QueuePosition (1 is next) and ETA, the estimated completion time, are returned by the
+		// single-job endpoints while the job is queued; running jobs only have an ETA.
+		QueuePosition *int64     `json:"queue_position,omitempty"`
+		ETA           *time.Time `json:"eta,omitempty"`
+		// ImportedFrom is the exported record the job was restored from by an import.
+		ImportedFrom map[string]any `json:"imported_from,omitempty"`
+		// Notes and Labels are set with PATCH /api/v1/jobs/{id}, which expects the Revision they
+		// were read at.
+		Notes     string         `json:"notes,omitempty"`
+		Labels    map[string]any `json:"labels,omitempty"`
+		Revision  int            `json:"revision"`
+		UpdatedAt *time.Time     `json:"updated_at,omitempty"`
 	}
 
 	errorResponse struct {
@@ -38,56 +67,127 @@ type (
 		ErrorCode string `json:"error_code"`
 		Status    int    `json:"status"`
 		Timestamp int64  `json:"timestamp"`
+		// Errors lists the parameters that failed validation.
+		Errors []schemas.FieldError `json:"errors,omitempty"`
+		// JobURL points to the existing job when a client-supplied job ID is already taken.
+		JobURL string `json:"job_url,omitempty"`
 	}
 
 	Job struct {
 		repo      Repository
 		queue     Queue
 		fileStore FileStorage
-		log       *slog.Logger
+		events    EventPublisher
+		// waiter is nil when job events are not published to Redis, which disables long polling.
+		waiter JobWaiter
+		// maxWait caps the wait parameter of GetJob.
+		maxWait time.Duration
+		// maxStream caps how long ListJobs streams NDJSON before ending the stream.
+		maxStream time.Duration
+		// storageQuota returns the per-tenant storage cap in bytes; zero disables it.
+		storageQuota func() int64
+		// delayLimits returns the default and max delay_ms of a processing type.
+		delayLimits func(database.ProcessingType) (int, int)
+		uploads     *UploadLimiter
+		// scanner is nil when uploads are not scanned.
+		scanner *UploadScanner
+		log     *slog.Logger
 	}
 )
 
 const (
-	memoryLimit = 32 << 20 // 32 MB limit
-	maxDelayMS  = 60000    // 1 minute max delay
+	eventSource = "text-api"
+	// memoryHighRetryAfterSeconds is when clients rejected by the Redis memory guard should retry.
+	memoryHighRetryAfterSeconds = "30"
 )
 
-func NewJob(repo Repository, queue Queue, fileStore FileStorage, logger *slog.Logger) *Job {
+func NewJob(
+	repo Repository, queue Queue, fileStore FileStorage, events EventPublisher, waiter JobWaiter, maxWait, maxStream time.Duration,
+	storageQuota func() int64, delayLimits func(database.ProcessingType) (int, int), uploads *UploadLimiter,
+	scanner *UploadScanner, logger *slog.Logger,
+) *Job {
 	return &Job{
-		repo:      repo,
-		queue:     queue,
-		fileStore: fileStore,
-		log:       logger,
+		repo:         repo,
+		queue:        queue,
+		fileStore:    fileStore,
+		events:       events,
+		waiter:       waiter,
+		maxWait:      maxWait,
+		maxStream:    maxStream,
+		storageQuota: storageQuota,
+		delayLimits:  delayLimits,
+		uploads:      uploads,
+		scanner:      scanner,
+		log:          logger,
 	}
 }
 
 func (jh *Job) CreateJob(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseMultipartForm(memoryLimit); err != nil {
+	// Rejected before the upload is read, so the job leaves no files or rows behind
+	if jh.queue.MemoryHigh() {
+		jh.writeMemoryHigh(w)
+		return
+	}
+
+	upload, err := jh.uploads.acquire(r.ContentLength, MaxUploadSize(jh.fileStore.GetMaxFileSize()))
+	switch {
+	case errors.Is(err, errUploadTooLarge):
+		jh.writeErrorWithCode(w, http.StatusRequestEntityTooLarge, err.Error(), "UPLOAD_TOO_LARGE")
+		return
+	case err != nil:
+		w.Header().Set("Retry-After", uploadRetryAfterSeconds)
+		jh.writeErrorWithCode(w, http.StatusServiceUnavailable, err.Error(), "UPLOAD_CAPACITY_EXCEEDED")
+		return
+	}
+
+	form, err := upload.parseForm(r)
+	defer func() {
+		if err := upload.release(form); err != nil {
+			jh.log.Error("failed to remove temporary upload files", "error", err)
+		}
+	}()
+	if err != nil {
 		jh.log.Error("failed to parse multipart form", "error", err)
 		jh.writeErrorWithCode(w, http.StatusBadRequest, "failed to parse form", "FORM_PARSE_ERROR")
 		return
 	}
+	upload.settle(form)
 
-	header, err := jh.validateAndExtractFile(w, r)
+	header, err := jh.validateAndExtractFile(w, form, "file")
 	if err != nil {
 		return // error already written in validateAndExtractFile
 	}
 
-	processingType, parameters, delayMS, err := jh.validateJobParameters(w, r)
+	processingType, parameters, delayMS, err := jh.validateJobParameters(w, form)
 	if err != nil {
 		return // error already written in validateJobParameters
 	}
 
-	fileInfo, err := jh.fileStore.SaveUploadedFile(header)
-	if err != nil {
-		jh.log.Error("failed to save uploaded file", "error", err)
-		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to save file", "FILE_SAVE_ERROR")
-		return
+	jobID, ok := jh.parseClientJobID(w, form)
+	if !ok {
+		return // error already written in parseClientJobID
+	}
+
+	var secondHeader *uploadedFile
+	if processingType.RequiresSecondFile() {
+		secondHeader, err = jh.validateAndExtractFile(w, form, "second_file")
+		if err != nil {
+			return // error already written in validateAndExtractFile
+		}
 	}
 
+	// Uploads stay in quarantine until they are validated and their job is committed, so a failure
+	// on the way leaves no files in the upload directory
+	fileInfo, ok := jh.quarantineUpload(w, r, header, processingType)
+	if !ok {
+		return // error already written in quarantineUpload
+	}
+	uploads := []*filestore.FileInfo{fileInfo}
+	storage := database.StorageDelta{UploadBytes: fileInfo.Size, Files: 1}
+
 	job := &database.Job{
-		ID:               uuid.New(),
+		ID:               jobID,
+		TenantID:         tenant.FromContext(r.Context()),
 		OriginalFilename: fileInfo.OriginalName,
 		FilePath:         fileInfo.StoredPath,
 		ProcessingType:   processingType,
@@ -97,26 +197,73 @@ func (jh *Job) CreateJob(w http.ResponseWriter, r *http.Request) {
 		CreatedAt:        time.Now(),
 	}
 
+	if secondHeader != nil {
+		secondInfo, ok := jh.quarantineUpload(w, r, secondHeader, processingType)
+		if !ok {
+			jh.discardUploads(uploads)
+			return // error already written in quarantineUpload
+		}
+		uploads = append(uploads, secondInfo)
+		storage.UploadBytes += secondInfo.Size
+		storage.Files++
+		job.SecondOriginalFilename = secondInfo.OriginalName
+		job.SecondFilePath = secondInfo.StoredPath
+	}
+
+	if !jh.reserveStorage(w, r, job.TenantID, storage) {
+		jh.discardUploads(uploads)
+		return // error already written in reserveStorage
+	}
+
 	if err := jh.repo.CreateJob(r.Context(), job); err != nil {
-		jh.log.Error("failed to create job in database", "error", err, "job_id", job.ID)
-		if err := jh.fileStore.DeleteFile(fileInfo.StoredPath); err != nil {
-			jh.log.Error("failed to delete uploaded file after job creation failure", "error", err, "file_path", fileInfo.StoredPath)
+		jh.releaseStorage(r, job.TenantID, storage)
+		jh.discardUploads(uploads)
+		if errors.Is(err, database.ErrJobExists) {
+			jh.writeJobExists(w, job.ID)
+			return
 		}
+		jh.log.Error("failed to create job in database", "error", err, "job_id", job.ID)
 		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to create job", "JOB_CREATE_ERROR")
 		return
 	}
 
+	// The job is committed: move its files in. A job whose files cannot be moved is failed rather
+	// than queued, as workers would not find them
+	if err := jh.commitUploads(uploads); err != nil {
+		jh.log.Error("failed to commit uploaded files", "error", err, "job_id", job.ID)
+		if err := jh.repo.UpdateError(r.Context(), job.ID, "uploaded files could not be stored"); err != nil {
+			jh.log.Error("failed to fail job with uncommitted files", "error", err, "job_id", job.ID)
+		}
+		jh.releaseStorage(r, job.TenantID, storage)
+		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to save file", "FILE_SAVE_ERROR")
+		return
+	}
+
 	queueMessage := queue.SubmitJobMessage{
 		JobID:          job.ID,
+		TenantID:       job.TenantID,
 		FilePath:       job.FilePath,
+		SecondFilePath: job.SecondFilePath,
 		ProcessingType: job.ProcessingType,
 		Parameters:     map[string]any(job.Parameters),
 		Priority:       1,
 		DelayMS:        job.DelayMS,
+
+		OriginalFilename:       job.OriginalFilename,
+		SecondOriginalFilename: job.SecondOriginalFilename,
+	}
+	if sc, ok := tracing.FromContext(r.Context()); ok {
+		queueMessage.TraceID = sc.TraceID
+		queueMessage.Traceparent = sc.Traceparent()
+		queueMessage.Tracestate = sc.TraceState
 	}
 
 	if err := jh.queue.PublishJob(r.Context(), queueMessage); err != nil {
 		jh.log.Error("failed to publish job to queue", "error", err, "job_id", job.ID)
+		if errors.Is(err, queue.ErrMemoryHigh) {
+			jh.writeMemoryHigh(w)
+			return
+		}
 		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to queue job", "QUEUE_ERROR")
 		return
 	}
@@ -126,12 +273,21 @@ func (jh *Job) CreateJob(w http.ResponseWriter, r *http.Request) {
 	priority := strconv.Itoa(queueMessage.Priority)
 	metrics.JobsQueuedTotal.WithLabelValues(priority).Inc()
 
+	event := events.New(events.JobCreated, job.ID, eventSource, map[string]any{
+		"processing_type": job.ProcessingType,
+		"filename":        job.OriginalFilename,
+	})
+	event.TenantID = job.TenantID
+	jh.events.Publish(r.Context(), event)
+
 	jh.log.Info("job created successfully",
 		"job_id", job.ID,
 		"processing_type", job.ProcessingType,
 		"filename", job.OriginalFilename)
 
-	jh.writeJSON(w, http.StatusCreated, jobToResponse(job))
+	response := jobToResponse(job)
+	jh.estimateCompletion(r.Context(), &response, job)
+	jh.writeJSON(w, http.StatusCreated, response)
 }
 
 func (jh *Job) GetJob(w http.ResponseWriter, r *http.Request) {
@@ -147,6 +303,18 @@ func (jh *Job) GetJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	wait, ok := jh.parseWait(w, r)
+	if !ok {
+		return // error already written in parseWait
+	}
+
+	var finished <-chan events.Event
+	if wait > 0 {
+		var stop func()
+		finished, stop = jh.waiter.Wait(jobID)
+		defer stop()
+	}
+
 	job, err := jh.repo.GetJobByID(r.Context(), jobID)
 	if err != nil {
 		jh.log.Error("failed to get job", "error", err, "job_id", jobID)
@@ -154,7 +322,15 @@ func (jh *Job) GetJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	jh.writeJSON(w, http.StatusOK, jobToResponse(job))
+	if wait > 0 {
+		if job, ok = jh.waitForJob(w, r, job, finished, wait); !ok {
+			return // the client went away
+		}
+	}
+
+	response := jh.jobsToResponse(r.Context(), []*database.Job{job})[0]
+	jh.estimateCompletion(r.Context(), &response, job)
+	jh.writeJSON(w, http.StatusOK, response)
 }
 
 func (jh *Job) ListJobs(w http.ResponseWriter, r *http.Request) {
@@ -196,6 +372,61 @@ func (jh *Job) ListJobs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if sortStr := r.URL.Query().Get("sort"); sortStr != "" {
+		var ok bool
+		if filter.Sort, ok = database.ToJobSort(sortStr); !ok {
+			jh.writeErrorWithCode(w, http.StatusBadRequest,
+				"invalid sort, must be one of created_at, queue_wait_ms, processing_ms, total_ms", "INVALID_SORT")
+			return
+		}
+	}
+
+	for param, target := range map[string]*time.Duration{
+		"min_queue_wait_ms": &filter.MinQueueWait,
+		"min_processing_ms": &filter.MinProcessing,
+		"min_total_ms":      &filter.MinTotal,
+	} {
+		msStr := r.URL.Query().Get(param)
+		if msStr == "" {
+			continue
+		}
+		ms, err := strconv.ParseInt(msStr, 10, 64)
+		if err != nil || ms < 0 {
+			jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid "+param+" parameter", "INVALID_DURATION_FILTER")
+			return
+		}
+		*target = time.Duration(ms) * time.Millisecond
+	}
+
+	// A creation time range confines the listing to the partitions of those months
+	if from := r.URL.Query().Get("from"); from != "" {
+		if filter.CreatedAfter, err = time.Parse(time.RFC3339, from); err != nil {
+			jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid from parameter, expected RFC 3339", "INVALID_TIME_RANGE")
+			return
+		}
+	}
+
+	if to := r.URL.Query().Get("to"); to != "" {
+		if filter.CreatedBefore, err = time.Parse(time.RFC3339, to); err != nil {
+			jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid to parameter, expected RFC 3339", "INVALID_TIME_RANGE")
+			return
+		}
+	}
+
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore) {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "from must be before to", "INVALID_TIME_RANGE")
+		return
+	}
+
+	if AcceptsNDJSON(r) {
+		// Streams return every matching job unless limited explicitly
+		if !r.URL.Query().Has("limit") {
+			filter.Limit = 0
+		}
+		jh.streamJobs(w, r, filter)
+		return
+	}
+
 	jobs, err := jh.repo.GetJobs(r.Context(), filter)
 	if err != nil {
 		jh.log.Error("failed to list jobs", "error", err)
@@ -203,10 +434,7 @@ func (jh *Job) ListJobs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response := make([]jobResponse, len(jobs))
-	for i, job := range jobs {
-		response[i] = jobToResponse(job)
-	}
+	response := jh.jobsToResponse(r.Context(), jobs)
 
 	jh.writeJSON(w, http.StatusOK, map[string]interface{}{
 		"jobs":   response,
@@ -252,17 +480,20 @@ func (jh *Job) GetJobResult(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	content, err := jh.fileStore.ReadFile(job.ResultPath)
+	content, size, err := jh.fileStore.OpenFile(job.ResultPath)
 	if err != nil {
-		jh.log.Error("failed to read result file", "error", err, "job_id", jobID)
+		jh.log.Error("failed to open result file", "error", err, "job_id", jobID)
 		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to read result file", "RESULT_FILE_READ_ERROR")
 		return
 	}
+	defer content.Close()
 
-	w.Header().Set("Content-Type", "text/plain")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"result_%s.txt\"", jobID))
+	format := database.OutputFormatFromParams(job.ProcessingType, job.Parameters)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"result_%s.%s\"", jobID, format.Extension()))
 	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write(content); err != nil {
+	if _, err := io.Copy(w, content); err != nil {
 		jh.log.Error("failed to write result file to response", "error", err, "job_id", jobID)
 	}
 }
@@ -293,6 +524,64 @@ func (jh *Job) writeErrorWithCode(w http.ResponseWriter, statusCode int, message
 	}
 }
 
+// writeValidationError writes an INVALID_PARAMETERS error listing the parameters that failed.
+func (jh *Job) writeValidationError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+
+	errorResp := errorResponse{
+		Error:     err.Error(),
+		ErrorCode: "INVALID_PARAMETERS",
+		Status:    http.StatusBadRequest,
+		Timestamp: time.Now().Unix(),
+	}
+	var validationErr *schemas.ValidationError
+	if errors.As(err, &validationErr) {
+		errorResp.Errors = validationErr.Errors
+	}
+
+	if err := json.NewEncoder(w).Encode(errorResp); err != nil {
+		jh.log.Error("failed to encode error response", "error", err, "error_code", errorResp.ErrorCode)
+	}
+}
+
+// parseClientJobID returns the job ID the client chose with the job_id form field, which makes
+// retried submissions idempotent, or a new random ID when it is absent.
+func (jh *Job) parseClientJobID(w http.ResponseWriter, form *uploadForm) (uuid.UUID, bool) {
+	jobIDStr := form.value("job_id")
+	if jobIDStr == "" {
+		return uuid.New(), true
+	}
+
+	jobID, err := uuid.Parse(jobIDStr)
+	if err != nil || jobID == uuid.Nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid job_id, expected a non-nil UUID", "INVALID_JOB_ID")
+		return uuid.Nil, false
+	}
+	return jobID, true
+}
+
+// writeJobExists answers a submission whose client-supplied job ID is taken with a JOB_EXISTS
+// conflict pointing to the existing job.
+func (jh *Job) writeJobExists(w http.ResponseWriter, jobID uuid.UUID) {
+	jobURL := "/api/v1/jobs/" + jobID.String()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", jobURL)
+	w.WriteHeader(http.StatusConflict)
+
+	errorResp := errorResponse{
+		Error:     fmt.Sprintf("job %s already exists", jobID),
+		ErrorCode: "JOB_EXISTS",
+		Status:    http.StatusConflict,
+		Timestamp: time.Now().Unix(),
+		JobURL:    jobURL,
+	}
+
+	if err := json.NewEncoder(w).Encode(errorResp); err != nil {
+		jh.log.Error("failed to encode error response", "error", err, "error_code", errorResp.ErrorCode)
+	}
+}
+
 func (jh *Job) isValidTextFile(filename string) bool {
 	ext := strings.ToLower(filepath.Ext(filename))
 	validExtensions := []string{".txt", ".md", ".csv", ".json", ".xml", ".log"}
@@ -306,14 +595,13 @@ func (jh *Job) isValidTextFile(filename string) bool {
 	return false
 }
 
-func (jh *Job) validateAndExtractFile(w http.ResponseWriter, r *http.Request) (*multipart.FileHeader, error) {
-	file, header, err := r.FormFile("file")
-	if err != nil {
-		jh.log.Error("failed to get file from form", "error", err)
-		jh.writeErrorWithCode(w, http.StatusBadRequest, "file is required", "FILE_MISSING")
-		return nil, err
+func (jh *Job) validateAndExtractFile(w http.ResponseWriter, form *uploadForm, field string) (*uploadedFile, error) {
+	header := form.file(field)
+	if header == nil {
+		jh.log.Error("failed to get file from form", "field", field)
+		jh.writeErrorWithCode(w, http.StatusBadRequest, field+" is required", "FILE_MISSING")
+		return nil, errors.New(field + " is missing")
 	}
-	_ = file.Close()
 
 	// Validate file type at handler level
 	if !jh.isValidTextFile(header.Filename) {
@@ -335,15 +623,153 @@ func (jh *Job) validateAndExtractFile(w http.ResponseWriter, r *http.Request) (*
 	return header, nil
 }
 
-func (jh *Job) validateJobParameters(w http.ResponseWriter, r *http.Request) (database.ProcessingType, map[string]any, int, error) {
-	processingType, ok := database.ToProcessingType(r.FormValue("processing_type"))
+// quarantineUpload writes an uploaded file to quarantine and validates its content, writing the
+// error response and returning false on failure. Uploads must be text, detected from their content,
+// except for transcode jobs, whose input may be in any character set; with a scanner configured,
+// they must also pass it.
+func (jh *Job) quarantineUpload(
+	w http.ResponseWriter, r *http.Request, header *uploadedFile, processingType database.ProcessingType,
+) (*filestore.FileInfo, bool) {
+	fileInfo, err := jh.quarantine(header)
+	switch {
+	case errors.Is(err, filestore.ErrUnsupportedEncoding):
+		jh.writeErrorWithCode(w, http.StatusUnsupportedMediaType,
+			"unsupported file Content-Encoding: only gzip and deflate are accepted", "UNSUPPORTED_ENCODING")
+		return nil, false
+	case errors.Is(err, filestore.ErrFileTooLarge):
+		jh.writeErrorWithCode(w, http.StatusBadRequest,
+			fmt.Sprintf("decompressed file exceeds maximum allowed size %d", jh.fileStore.GetMaxFileSize()),
+			"FILE_TOO_LARGE")
+		return nil, false
+	case err != nil:
+		jh.log.Error("failed to save uploaded file", "error", err)
+		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to save file", "FILE_SAVE_ERROR")
+		return nil, false
+	}
+
+	if processingType != database.ProcessingTypeTranscode && !strings.HasPrefix(fileInfo.DetectedType, "text/") {
+		jh.discardUploads([]*filestore.FileInfo{fileInfo})
+		jh.writeErrorWithCode(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid file content: %s is not text (detected %s)", header.Filename, fileInfo.DetectedType),
+			"INVALID_FILE_CONTENT")
+		return nil, false
+	}
+
+	if jh.scanner != nil && !jh.scanUpload(w, r, fileInfo) {
+		jh.discardUploads([]*filestore.FileInfo{fileInfo})
+		return nil, false // error already written in scanUpload
+	}
+
+	return fileInfo, true
+}
+
+// quarantine writes an uploaded file to quarantine.
+func (jh *Job) quarantine(header *uploadedFile) (*filestore.FileInfo, error) {
+	content, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open uploaded file: %w", err)
+	}
+	defer content.Close()
+
+	return jh.fileStore.QuarantineUpload(filestore.Upload{
+		Filename: header.Filename,
+		Header:   header.Header,
+		Size:     header.Size,
+		Content:  content,
+	})
+}
+
+// scanUpload passes a quarantined upload through the scanner, writing the error response and
+// returning false when it is rejected or cannot be scanned.
+func (jh *Job) scanUpload(w http.ResponseWriter, r *http.Request, fileInfo *filestore.FileInfo) bool {
+	content, _, err := jh.fileStore.OpenFile(fileInfo.QuarantinePath)
+	if err != nil {
+		jh.log.Error("failed to open quarantined upload", "error", err, "file_path", fileInfo.QuarantinePath)
+		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to scan file", "UPLOAD_SCAN_ERROR")
+		return false
+	}
+	defer content.Close()
+
+	output, err := jh.scanner.Scan(r.Context(), content)
+	switch {
+	case errors.Is(err, errUploadInfected):
+		jh.log.Warn("upload rejected by the content scanner", "filename", fileInfo.OriginalName, "output", output)
+		jh.writeErrorWithCode(w, http.StatusUnprocessableEntity,
+			fmt.Sprintf("%s was rejected by the content scanner", fileInfo.OriginalName), "UPLOAD_REJECTED")
+		return false
+	case err != nil:
+		jh.log.Error("failed to scan upload", "error", err, "output", output)
+		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to scan file", "UPLOAD_SCAN_ERROR")
+		return false
+	}
+
+	return true
+}
+
+// commitUploads moves the quarantined uploads of a committed job to the upload directory. When one
+// cannot be moved, the ones already moved are removed again.
+func (jh *Job) commitUploads(uploads []*filestore.FileInfo) error {
+	for i, upload := range uploads {
+		if err := jh.fileStore.CommitUpload(upload); err != nil {
+			for _, committed := range uploads[:i] {
+				if err := jh.fileStore.DeleteFile(committed.StoredPath); err != nil {
+					jh.log.Error("failed to delete committed upload", "error", err, "file_path", committed.StoredPath)
+				}
+			}
+			jh.discardUploads(uploads[i:])
+			return err
+		}
+	}
+	return nil
+}
+
+// reserveStorage counts the uploaded files against the tenant's storage quota, writing the error
+// response and returning false when the quota is exceeded or the usage cannot be updated.
+func (jh *Job) reserveStorage(w http.ResponseWriter, r *http.Request, tenantID string, delta database.StorageDelta) bool {
+	quota := jh.storageQuota()
+	err := jh.repo.ReserveStorage(r.Context(), tenantID, delta, quota)
+	switch {
+	case errors.Is(err, database.ErrStorageQuotaExceeded):
+		jh.log.Warn("tenant storage quota exceeded", "tenant_id", tenantID, "upload_bytes", delta.UploadBytes, "quota", quota)
+		jh.writeErrorWithCode(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("upload of %d bytes exceeds the tenant storage quota of %d bytes", delta.UploadBytes, quota),
+			"STORAGE_QUOTA_EXCEEDED")
+		return false
+	case err != nil:
+		jh.log.Error("failed to reserve storage", "error", err, "tenant_id", tenantID)
+		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to update storage usage", "STORAGE_USAGE_ERROR")
+		return false
+	}
+
+	return true
+}
+
+// releaseStorage returns storage reserved for a job that could not be created.
+func (jh *Job) releaseStorage(r *http.Request, tenantID string, delta database.StorageDelta) {
+	release := database.StorageDelta{UploadBytes: -delta.UploadBytes, ResultBytes: -delta.ResultBytes, Files: -delta.Files}
+	if err := jh.repo.AddStorageUsage(r.Context(), tenantID, release); err != nil {
+		jh.log.Error("failed to release storage after job creation failure", "error", err, "tenant_id", tenantID)
+	}
+}
+
+// discardUploads removes the quarantined uploads of a job that could not be created.
+func (jh *Job) discardUploads(uploads []*filestore.FileInfo) {
+	for _, upload := range uploads {
+		if err := jh.fileStore.DiscardUpload(upload); err != nil {
+			jh.log.Error("failed to discard quarantined upload", "error", err, "file_path", upload.QuarantinePath)
+		}
+	}
+}
+
+func (jh *Job) validateJobParameters(w http.ResponseWriter, form *uploadForm) (database.ProcessingType, map[string]any, int, error) {
+	processingType, ok := database.ToProcessingType(form.value("processing_type"))
 	if !ok {
 		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid processing_type", "INVALID_PROCESSING_TYPE")
 		return "", nil, 0, errors.New("invalid processing type")
 	}
 
 	var parameters map[string]any
-	if parametersStr := r.FormValue("parameters"); parametersStr != "" {
+	if parametersStr := form.value("parameters"); parametersStr != "" {
 		if err := json.Unmarshal([]byte(parametersStr), &parameters); err != nil {
 			jh.log.Error("failed to parse parameters", "error", err)
 			jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid parameters JSON", "INVALID_PARAMETERS_JSON")
@@ -353,13 +779,13 @@ func (jh *Job) validateJobParameters(w http.ResponseWriter, r *http.Request) (da
 		parameters = make(map[string]any)
 	}
 
-	if err := validateProcessingTypeAndParams(processingType, parameters); err != nil {
-		jh.writeErrorWithCode(w, http.StatusBadRequest, err.Error(), "INVALID_PARAMETERS")
+	if err := schemas.Validate(processingType, parameters); err != nil {
+		jh.writeValidationError(w, err)
 		return "", nil, 0, err
 	}
 
-	var delayMS int
-	if delayStr := r.FormValue("delay_ms"); delayStr != "" {
+	delayMS, maxDelayMS := jh.delayLimits(processingType)
+	if delayStr := form.value("delay_ms"); delayStr != "" {
 		var err error
 		delayMS, err = strconv.Atoi(delayStr)
 		if err != nil || delayMS < 0 {
@@ -367,7 +793,8 @@ func (jh *Job) validateJobParameters(w http.ResponseWriter, r *http.Request) (da
 			return "", nil, 0, err
 		}
 		if delayMS > maxDelayMS {
-			jh.writeErrorWithCode(w, http.StatusBadRequest, fmt.Sprintf("delay_ms cannot exceed %d milliseconds", maxDelayMS), "DELAY_MS_TOO_LARGE")
+			jh.writeErrorWithCode(w, http.StatusBadRequest,
+				fmt.Sprintf("delay_ms of %s jobs cannot exceed %d milliseconds", processingType, maxDelayMS), "DELAY_MS_TOO_LARGE")
 			return "", nil, 0, errors.New("delay too large")
 		}
 	}
@@ -375,38 +802,42 @@ func (jh *Job) validateJobParameters(w http.ResponseWriter, r *http.Request) (da
 	return processingType, parameters, delayMS, nil
 }
 
-func validateProcessingTypeAndParams(processingType database.ProcessingType, params map[string]any) error {
-	switch processingType {
-	case database.ProcessingTypeReplace:
-		find, ok := params["find"]
-		if !ok || find == "" {
-			return errors.New("replace operation requires 'find' parameter")
+// jobsToResponse converts jobs to responses with the progress reported by their workers. Progress
+// is left out when it cannot be read rather than failing the request.
+func (jh *Job) jobsToResponse(ctx context.Context, jobs []*database.Job) []jobResponse {
+	ids := make([]uuid.UUID, 0, len(jobs))
+	for _, job := range jobs {
+		if job.Status != database.JobStatusPending {
+			ids = append(ids, job.ID)
 		}
-		replaceWith, ok := params["replace_with"]
-		if !ok {
-			return errors.New("replace operation requires 'replace_with' parameter")
-		}
-		if _, ok := replaceWith.(string); !ok {
-			return errors.New("'replace_with' parameter must be a string")
-		}
-	case database.ProcessingTypeExtract:
-		pattern, ok := params["pattern"]
-		if !ok || pattern == "" {
-			return errors.New("extract operation requires 'pattern' parameter")
-		}
-		if _, ok := pattern.(string); !ok {
-			return errors.New("'pattern' parameter must be a string")
+	}
+
+	progress, err := jh.queue.GetJobsProgress(ctx, ids)
+	if err != nil {
+		jh.log.WarnContext(ctx, "failed to get jobs progress", "error", err)
+	}
+
+	response := make([]jobResponse, len(jobs))
+	for i, job := range jobs {
+		response[i] = jobToResponse(job)
+		if jobProgress, ok := progress[job.ID]; ok {
+			response[i].Progress = &jobProgress
 		}
-	case database.ProcessingTypeWordCount, database.ProcessingTypeLineCount, database.ProcessingTypeUppercase, database.ProcessingTypeLowercase:
-		// These processing types do not require additional parameters
 	}
-	return nil
+	return response
 }
 
 func jobToResponse(j *database.Job) jobResponse {
+	var usage *database.JobUsage
+	if j.CompletedAt != nil {
+		usage = &j.JobUsage
+	}
+
 	return jobResponse{
 		ID:               j.ID,
+		TenantID:         j.TenantID,
 		OriginalFilename: j.OriginalFilename,
+		SecondFilename:   j.SecondOriginalFilename,
 		ProcessingType:   string(j.ProcessingType),
 		Parameters:       j.Parameters,
 		Status:           string(j.Status),
@@ -415,6 +846,31 @@ func jobToResponse(j *database.Job) jobResponse {
 		CreatedAt:        j.CreatedAt,
 		StartedAt:        j.StartedAt,
 		CompletedAt:      j.CompletedAt,
+		QueueWaitMS:      durationMS(&j.CreatedAt, j.StartedAt),
+		ProcessingMS:     durationMS(j.StartedAt, j.CompletedAt),
+		TotalMS:          durationMS(&j.CreatedAt, j.CompletedAt),
 		WorkerID:         j.WorkerID,
+		Usage:            usage,
+		ImportedFrom:     j.ImportedFrom,
+		Notes:            j.Notes,
+		Labels:           j.Labels,
+		Revision:         j.Revision,
+		UpdatedAt:        j.UpdatedAt,
+	}
+}
+
+// writeMemoryHigh rejects a job while the queue is short of memory.
+func (jh *Job) writeMemoryHigh(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", memoryHighRetryAfterSeconds)
+	jh.writeErrorWithCode(w, http.StatusServiceUnavailable,
+		"the job queue is low on memory, retry once the backlog has drained", "QUEUE_MEMORY_HIGH")
+}
+
+// durationMS returns the milliseconds from start to end, or nil until both are set.
+func durationMS(start, end *time.Time) *int64 {
+	if start == nil || end == nil {
+		return nil
 	}
+	ms := end.Sub(*start).Milliseconds()
+	return &ms
 }
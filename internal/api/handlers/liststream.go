@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	// listStreamBatchSize is how many jobs a stream reads before looking up their progress in one
+	// call and flushing them to the client.
+	listStreamBatchSize = 100
+)
+
+// listStreamEnd is the last line of a job stream that ended before every job was sent. Clients
+// resume by listing again from NextOffset.
+type listStreamEnd struct {
+	Error      string `json:"error"`
+	ErrorCode  string `json:"error_code"`
+	NextOffset int    `json:"next_offset"`
+}
+
+// AcceptsNDJSON reports whether the client asked for a job listing streamed as newline-delimited
+// JSON.
+func AcceptsNDJSON(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(accepted); err == nil && mediaType == ndjsonContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// streamJobs writes the jobs matching the filter as one JSON object per line while they are read
+// from the database. A single request pulls the whole listing, so scripted consumers do not spend
+// their rate limit on pages. The stream ends after maxStream with a line telling where to resume.
+func (jh *Job) streamJobs(w http.ResponseWriter, r *http.Request, filter database.GetJobsFilter) {
+	ctx, cancel := context.WithTimeout(r.Context(), jh.maxStream)
+	defer cancel()
+
+	// The stream outlives the server-wide write timeout, so the deadline is managed per batch instead
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	batch := make([]*database.Job, 0, listStreamBatchSize)
+	sent := 0
+
+	flush := func() error {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		for _, response := range jh.jobsToResponse(ctx, batch) {
+			if err := encoder.Encode(response); err != nil {
+				return err
+			}
+		}
+		sent += len(batch)
+		batch = batch[:0]
+		return rc.Flush()
+	}
+
+	err := jh.repo.StreamJobs(ctx, filter, func(job *database.Job) error {
+		batch = append(batch, job)
+		if len(batch) < listStreamBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err == nil || r.Context().Err() != nil {
+		return
+	}
+
+	end := listStreamEnd{
+		Error:      "failed to list jobs",
+		ErrorCode:  "JOB_LIST_ERROR",
+		NextOffset: filter.Offset + sent,
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		end.Error, end.ErrorCode = "stream reached its maximum duration, resume from next_offset", "STREAM_EXPIRED"
+	} else {
+		jh.log.ErrorContext(ctx, "failed to stream jobs", "error", err, "sent", sent)
+	}
+
+	_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	if err := encoder.Encode(end); err != nil {
+		return
+	}
+	_ = rc.Flush()
+}
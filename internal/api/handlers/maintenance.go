@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// MaintenanceSwitch switches the maintenance mode of every API replica.
+type MaintenanceSwitch interface {
+	SetMaintenance(ctx context.Context, enabled bool, message string) error
+	GetMaintenance(ctx context.Context) (bool, string, error)
+}
+
+// MaintenanceAdmin serves the admin endpoints switching maintenance mode, in which mutating API
+// requests are rejected, e.g. while the database is migrated.
+type MaintenanceAdmin struct {
+	maintenance MaintenanceSwitch
+	// forced is set when MAINTENANCE_MODE keeps this replica in maintenance mode regardless of the
+	// switch.
+	forced bool
+	log    *slog.Logger
+}
+
+type maintenanceRequest struct {
+	Enabled *bool  `json:"enabled"`
+	Message string `json:"message"`
+}
+
+type maintenanceResponse struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"`
+	// Forced is set when the replica is in maintenance mode through its configuration, which the
+	// switch cannot override.
+	Forced bool `json:"forced,omitempty"`
+}
+
+func NewMaintenanceAdmin(maintenance MaintenanceSwitch, forced bool, log *slog.Logger) *MaintenanceAdmin {
+	return &MaintenanceAdmin{
+		maintenance: maintenance,
+		forced:      forced,
+		log:         log,
+	}
+}
+
+// GetMaintenance reports whether the API is in maintenance mode.
+func (ma *MaintenanceAdmin) GetMaintenance(w http.ResponseWriter, r *http.Request) {
+	enabled, message, err := ma.maintenance.GetMaintenance(r.Context())
+	if err != nil {
+		ma.log.ErrorContext(r.Context(), "failed to get maintenance mode", "error", err)
+		ma.writeError(w, http.StatusInternalServerError, "failed to get maintenance mode", "MAINTENANCE_STATE_ERROR")
+		return
+	}
+
+	ma.writeJSON(w, r, http.StatusOK, maintenanceResponse{Enabled: enabled || ma.forced, Message: message, Forced: ma.forced})
+}
+
+// SetMaintenance switches maintenance mode on ({"enabled": true, "message": "..."}) or off
+// ({"enabled": false}) for every API replica.
+func (ma *MaintenanceAdmin) SetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req maintenanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		ma.writeError(w, http.StatusBadRequest, `expected a JSON body {"enabled": true|false, "message": "..."}`, "INVALID_MAINTENANCE_REQUEST")
+		return
+	}
+
+	if err := ma.maintenance.SetMaintenance(r.Context(), *req.Enabled, req.Message); err != nil {
+		ma.log.ErrorContext(r.Context(), "failed to set maintenance mode", "error", err, "enabled", *req.Enabled)
+		ma.writeError(w, http.StatusInternalServerError, "failed to set maintenance mode", "MAINTENANCE_STATE_ERROR")
+		return
+	}
+
+	ma.log.InfoContext(r.Context(), "maintenance mode switched", "enabled", *req.Enabled, "message", req.Message)
+	response := maintenanceResponse{Enabled: *req.Enabled || ma.forced, Forced: ma.forced}
+	if *req.Enabled {
+		response.Message = req.Message
+	}
+	ma.writeJSON(w, r, http.StatusOK, response)
+}
+
+func (ma *MaintenanceAdmin) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		ma.log.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+func (ma *MaintenanceAdmin) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		ma.log.Error("failed to encode error response", "error", err)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/tenant"
+)
+
+// Notifier is a chat notification sink that can send a test message to the channel of a tenant.
+type Notifier interface {
+	Name() string
+	Test(ctx context.Context, tenantID string) error
+}
+
+// Notifications serves the notification endpoints.
+type Notifications struct {
+	notifiers []Notifier
+	log       *slog.Logger
+}
+
+type notificationTestResult struct {
+	Sink      string `json:"sink"`
+	Delivered bool   `json:"delivered"`
+	Error     string `json:"error,omitempty"`
+}
+
+type notificationTestResponse struct {
+	TenantID string                   `json:"tenant_id"`
+	Results  []notificationTestResult `json:"results"`
+}
+
+func NewNotifications(notifiers []Notifier, log *slog.Logger) *Notifications {
+	return &Notifications{
+		notifiers: notifiers,
+		log:       log,
+	}
+}
+
+// Test sends a test message through every notification sink, or only the one named by the sink
+// query parameter, to the channel of the request's tenant. It answers 502 when any was not
+// delivered, e.g. because the tenant has no channel or the webhook rejected the message.
+func (nh *Notifications) Test(w http.ResponseWriter, r *http.Request) {
+	tenantID := tenant.FromContext(r.Context())
+	sink := r.URL.Query().Get("sink")
+
+	response := notificationTestResponse{TenantID: tenantID, Results: []notificationTestResult{}}
+	status := http.StatusOK
+	for _, notifier := range nh.notifiers {
+		if sink != "" && notifier.Name() != sink {
+			continue
+		}
+
+		result := notificationTestResult{Sink: notifier.Name(), Delivered: true}
+		if err := notifier.Test(r.Context(), tenantID); err != nil {
+			nh.log.WarnContext(r.Context(), "test notification failed", "sink", notifier.Name(), "tenant_id", tenantID, "error", err)
+			result.Delivered, result.Error = false, err.Error()
+			status = http.StatusBadGateway
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	if len(response.Results) == 0 {
+		nh.writeError(w, http.StatusNotFound, "no notification sink configured", "NOTIFICATIONS_NOT_CONFIGURED")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		nh.log.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+func (nh *Notifications) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		nh.log.Error("failed to encode error response", "error", err)
+	}
+}
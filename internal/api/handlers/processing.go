@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ProcessingSwitch pauses and resumes job processing for every worker.
+type ProcessingSwitch interface {
+	SetProcessingPaused(ctx context.Context, paused bool) error
+	ProcessingPaused(ctx context.Context) (bool, error)
+}
+
+// ProcessingAdmin serves the admin endpoints switching job processing on and off, e.g. for
+// maintenance windows.
+type ProcessingAdmin struct {
+	processing ProcessingSwitch
+	log        *slog.Logger
+}
+
+type processingRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+type processingResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+func NewProcessingAdmin(processing ProcessingSwitch, log *slog.Logger) *ProcessingAdmin {
+	return &ProcessingAdmin{
+		processing: processing,
+		log:        log,
+	}
+}
+
+// GetProcessing reports whether workers process jobs.
+func (pa *ProcessingAdmin) GetProcessing(w http.ResponseWriter, r *http.Request) {
+	paused, err := pa.processing.ProcessingPaused(r.Context())
+	if err != nil {
+		pa.log.ErrorContext(r.Context(), "failed to get processing state", "error", err)
+		pa.writeError(w, http.StatusInternalServerError, "failed to get processing state", "PROCESSING_STATE_ERROR")
+		return
+	}
+
+	pa.writeJSON(w, r, http.StatusOK, processingResponse{Enabled: !paused})
+}
+
+// SetProcessing pauses ({"enabled": false}) or resumes ({"enabled": true}) processing. While
+// paused, workers finish the jobs in flight and then idle, submissions are still queued and the
+// controller does not scale workers up.
+func (pa *ProcessingAdmin) SetProcessing(w http.ResponseWriter, r *http.Request) {
+	var req processingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+		pa.writeError(w, http.StatusBadRequest, `expected a JSON body {"enabled": true|false}`, "INVALID_PROCESSING_REQUEST")
+		return
+	}
+
+	if err := pa.processing.SetProcessingPaused(r.Context(), !*req.Enabled); err != nil {
+		pa.log.ErrorContext(r.Context(), "failed to set processing state", "error", err, "enabled", *req.Enabled)
+		pa.writeError(w, http.StatusInternalServerError, "failed to set processing state", "PROCESSING_STATE_ERROR")
+		return
+	}
+
+	pa.log.InfoContext(r.Context(), "processing switched", "enabled", *req.Enabled)
+	pa.writeJSON(w, r, http.StatusOK, processingResponse{Enabled: *req.Enabled})
+}
+
+func (pa *ProcessingAdmin) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		pa.log.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+func (pa *ProcessingAdmin) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		pa.log.Error("failed to encode error response", "error", err)
+	}
+}
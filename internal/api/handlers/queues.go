@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+const (
+	defaultPoisonLimit = 50
+	maxPoisonLimit     = 500
+)
+
+// PoisonQueue lists and deletes the messages quarantined by workers.
+type PoisonQueue interface {
+	GetPoisonMessages(ctx context.Context, offset, limit int64) ([]queue.PoisonMessage, int64, error)
+	DeletePoisonMessage(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+// QueueAdmin serves the admin queue endpoints.
+type QueueAdmin struct {
+	queue PoisonQueue
+	log   *slog.Logger
+}
+
+type poisonMessagesResponse struct {
+	Messages []queue.PoisonMessage `json:"messages"`
+	Limit    int64                 `json:"limit"`
+	Offset   int64                 `json:"offset"`
+	Total    int64                 `json:"total"`
+}
+
+func NewQueueAdmin(queue PoisonQueue, log *slog.Logger) *QueueAdmin {
+	return &QueueAdmin{
+		queue: queue,
+		log:   log,
+	}
+}
+
+// ListPoisonMessages lists the quarantined messages, newest first, with limit (default 50, at most
+// 500) and offset query parameters.
+func (qa *QueueAdmin) ListPoisonMessages(w http.ResponseWriter, r *http.Request) {
+	limit, ok := qa.int64Param(w, r, "limit", defaultPoisonLimit)
+	if !ok {
+		return
+	}
+	offset, ok := qa.int64Param(w, r, "offset", 0)
+	if !ok {
+		return
+	}
+	limit = min(limit, maxPoisonLimit)
+
+	messages, total, err := qa.queue.GetPoisonMessages(r.Context(), offset, limit)
+	if err != nil {
+		qa.log.ErrorContext(r.Context(), "failed to get poison messages", "error", err)
+		qa.writeError(w, http.StatusInternalServerError, "failed to get poison messages", "POISON_QUEUE_ERROR")
+		return
+	}
+
+	qa.writeJSON(w, r, http.StatusOK, poisonMessagesResponse{
+		Messages: messages,
+		Limit:    limit,
+		Offset:   offset,
+		Total:    total,
+	})
+}
+
+// DeletePoisonMessage removes a quarantined message once it has been dealt with.
+func (qa *QueueAdmin) DeletePoisonMessage(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		qa.writeError(w, http.StatusBadRequest, "invalid poison message ID format", "INVALID_POISON_MESSAGE_ID")
+		return
+	}
+
+	deleted, err := qa.queue.DeletePoisonMessage(r.Context(), id)
+	if err != nil {
+		qa.log.ErrorContext(r.Context(), "failed to delete poison message", "error", err, "poison_id", id)
+		qa.writeError(w, http.StatusInternalServerError, "failed to delete poison message", "POISON_QUEUE_ERROR")
+		return
+	}
+	if !deleted {
+		qa.writeError(w, http.StatusNotFound, "poison message not found", "POISON_MESSAGE_NOT_FOUND")
+		return
+	}
+
+	qa.log.InfoContext(r.Context(), "poison message deleted", "poison_id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// int64Param parses a non-negative query parameter, writing the error response and returning false
+// when it is invalid.
+func (qa *QueueAdmin) int64Param(w http.ResponseWriter, r *http.Request, name string, fallback int64) (int64, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, true
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || parsed < 0 {
+		qa.writeError(w, http.StatusBadRequest, "invalid "+name+" parameter", "INVALID_"+strings.ToUpper(name))
+		return 0, false
+	}
+	return parsed, true
+}
+
+func (qa *QueueAdmin) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		qa.log.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+func (qa *QueueAdmin) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		qa.log.Error("failed to encode error response", "error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/reconcile"
+)
+
+// FileReconciler compares the stored files with the jobs referencing them.
+type FileReconciler interface {
+	Reconcile(ctx context.Context, deleteOrphans bool) (*reconcile.Report, error)
+	LastReport() *reconcile.Report
+}
+
+// ReconcileAdmin serves the admin endpoints reporting stored files no job references and jobs whose
+// files are missing.
+type ReconcileAdmin struct {
+	reconciler FileReconciler
+	// deleteOrphans is whether on-demand reconciliations delete orphans unless the request says.
+	deleteOrphans bool
+	log           *slog.Logger
+}
+
+func NewReconcileAdmin(reconciler FileReconciler, deleteOrphans bool, log *slog.Logger) *ReconcileAdmin {
+	return &ReconcileAdmin{
+		reconciler:    reconciler,
+		deleteOrphans: deleteOrphans,
+		log:           log,
+	}
+}
+
+// GetReport returns the report of the last reconciliation of this replica.
+func (ra *ReconcileAdmin) GetReport(w http.ResponseWriter, r *http.Request) {
+	report := ra.reconciler.LastReport()
+	if report == nil {
+		ra.writeError(w, http.StatusNotFound, "no file reconciliation has run yet", "RECONCILE_REPORT_NOT_FOUND")
+		return
+	}
+
+	ra.writeJSON(w, r, http.StatusOK, report)
+}
+
+// Reconcile runs a reconciliation and returns its report. The optional delete query parameter
+// overrides FILE_RECONCILE_DELETE_ORPHANS.
+func (ra *ReconcileAdmin) Reconcile(w http.ResponseWriter, r *http.Request) {
+	deleteOrphans := ra.deleteOrphans
+	if value := r.URL.Query().Get("delete"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			ra.writeError(w, http.StatusBadRequest, "delete must be true or false", "INVALID_DELETE")
+			return
+		}
+		deleteOrphans = parsed
+	}
+
+	report, err := ra.reconciler.Reconcile(r.Context(), deleteOrphans)
+	if errors.Is(err, reconcile.ErrInProgress) {
+		ra.writeError(w, http.StatusConflict, err.Error(), "RECONCILE_IN_PROGRESS")
+		return
+	}
+	if err != nil {
+		ra.log.ErrorContext(r.Context(), "failed to reconcile stored files", "error", err)
+		ra.writeError(w, http.StatusInternalServerError, "failed to reconcile stored files", "RECONCILE_ERROR")
+		return
+	}
+
+	ra.log.InfoContext(r.Context(), "stored files reconciled",
+		"orphaned_files", report.OrphanedFiles.Total(),
+		"deleted_files", report.DeletedFiles,
+		"missing_files", report.MissingFiles.Total(),
+	)
+	ra.writeJSON(w, r, http.StatusOK, report)
+}
+
+func (ra *ReconcileAdmin) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		ra.log.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+func (ra *ReconcileAdmin) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		ra.log.Error("failed to encode error response", "error", err)
+	}
+}
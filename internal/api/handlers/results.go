@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// resultVersionResponse describes one result version of a job. The canonical version is the one
+// GET /api/v1/jobs/{id}/result serves.
+type resultVersionResponse struct {
+	Version   int       `json:"version"`
+	Canonical bool      `json:"canonical"`
+	Shared    bool      `json:"shared"`
+	Available bool      `json:"available"`
+	SizeBytes int64     `json:"size_bytes,omitempty"`
+	WorkerID  string    `json:"worker_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+}
+
+// ListJobResults lists the result versions of a job, one per processing attempt that completed
+// it, with the latest marked canonical. Versions whose file was removed are listed as unavailable.
+func (jh *Job) ListJobResults(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid job ID format", "INVALID_JOB_ID")
+		return
+	}
+
+	ctx := r.Context()
+	job, err := jh.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		jh.log.Error("failed to get job", "error", err, "job_id", jobID)
+		jh.writeErrorWithCode(w, http.StatusNotFound, "job not found", "JOB_NOT_FOUND")
+		return
+	}
+
+	results, err := jh.repo.GetJobResults(ctx, jobID)
+	if err != nil {
+		jh.log.Error("failed to get job results", "error", err, "job_id", jobID)
+		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to get job results", "DATABASE_ERROR")
+		return
+	}
+
+	canonical := 0
+	response := make([]resultVersionResponse, 0, len(results))
+	for _, result := range results {
+		version := resultVersionResponse{
+			Version:   result.Version,
+			Canonical: result.ResultPath == job.ResultPath,
+			Shared:    result.Shared,
+			WorkerID:  result.WorkerID,
+			CreatedAt: result.CreatedAt,
+			URL:       fmt.Sprintf("/api/v1/jobs/%s/results/%d", jobID, result.Version),
+		}
+		if content, size, err := jh.fileStore.OpenFile(result.ResultPath); err == nil {
+			_ = content.Close()
+			version.Available = true
+			version.SizeBytes = size
+		}
+		if version.Canonical {
+			canonical = result.Version
+		}
+		response = append(response, version)
+	}
+
+	jh.writeJSON(w, http.StatusOK, map[string]any{
+		"job_id":            jobID,
+		"status":            job.Status,
+		"attempts":          job.Attempts,
+		"canonical_version": canonical,
+		"results":           response,
+	})
+}
+
+// GetJobResultVersion downloads one result version of a job, as listed by ListJobResults.
+func (jh *Job) GetJobResultVersion(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid job ID format", "INVALID_JOB_ID")
+		return
+	}
+
+	number, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil || number <= 0 {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid result version, expected a positive integer", "INVALID_RESULT_VERSION")
+		return
+	}
+
+	ctx := r.Context()
+	job, err := jh.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		jh.log.Error("failed to get job", "error", err, "job_id", jobID)
+		jh.writeErrorWithCode(w, http.StatusNotFound, "job not found", "JOB_NOT_FOUND")
+		return
+	}
+
+	results, err := jh.repo.GetJobResults(ctx, jobID)
+	if err != nil {
+		jh.log.Error("failed to get job results", "error", err, "job_id", jobID)
+		jh.writeErrorWithCode(w, http.StatusInternalServerError, "failed to get job results", "DATABASE_ERROR")
+		return
+	}
+
+	var result *database.JobResult
+	for i := range results {
+		if results[i].Version == number {
+			result = &results[i]
+			break
+		}
+	}
+	if result == nil {
+		jh.writeErrorWithCode(w, http.StatusNotFound, fmt.Sprintf("job has no result version %d", number), "RESULT_VERSION_NOT_FOUND")
+		return
+	}
+
+	content, size, err := jh.fileStore.OpenFile(result.ResultPath)
+	if err != nil {
+		jh.log.Warn("failed to open result version", "error", err, "job_id", jobID, "version", number)
+		jh.writeErrorWithCode(w, http.StatusNotFound, "result file not found on disk", "RESULT_FILE_NOT_ON_DISK")
+		return
+	}
+	defer content.Close()
+
+	format := database.OutputFormatFromParams(job.ProcessingType, job.Parameters)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"result_%s.v%d.%s\"", jobID, number, format.Extension()))
+	w.Header().Set("X-Result-Canonical", strconv.FormatBool(result.ResultPath == job.ResultPath))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, content); err != nil {
+		jh.log.Error("failed to write result version to response", "error", err, "job_id", jobID, "version", number)
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// scanOutputLimit bounds how much of the scanner's output is kept for the log.
+const scanOutputLimit = 1024
+
+// errUploadInfected is returned by UploadScanner.Scan for uploads the scanner rejected.
+var errUploadInfected = errors.New("upload rejected by the content scanner")
+
+// UploadScanner passes quarantined uploads through an external scanner, such as
+// `clamdscan --no-summary -`, on its standard input. Like ClamAV, the scanner exits with 0 for clean
+// content and 1 for rejected content; anything else is a scanner failure.
+type UploadScanner struct {
+	command []string
+	timeout time.Duration
+}
+
+// NewUploadScanner creates a scanner running command, split on whitespace, for up to timeout per
+// upload. An empty command disables scanning and returns nil.
+func NewUploadScanner(command string, timeout time.Duration) *UploadScanner {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+	return &UploadScanner{command: fields, timeout: timeout}
+}
+
+// Scan feeds content to the scanner. It returns errUploadInfected when the scanner rejects it,
+// along with the scanner output.
+func (s *UploadScanner) Scan(ctx context.Context, content io.Reader) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	output := &excerptWriter{limit: scanOutputLimit}
+	// #nosec G204 -- the command comes from the operator's configuration
+	cmd := exec.CommandContext(ctx, s.command[0], s.command[1:]...)
+	cmd.Stdin = content
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return output.String(), nil
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 1:
+		return output.String(), errUploadInfected
+	default:
+		return output.String(), fmt.Errorf("run upload scanner: %w", err)
+	}
+}
+
+// excerptWriter keeps the first limit bytes written to it.
+type excerptWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *excerptWriter) Write(p []byte) (int, error) {
+	if room := w.limit - w.buf.Len(); room > 0 {
+		w.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+func (w *excerptWriter) String() string {
+	return strings.TrimSpace(w.buf.String())
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+type SLO struct {
+	tracker SLOTracker
+	log     *slog.Logger
+}
+
+func NewSLO(tracker SLOTracker, log *slog.Logger) *SLO {
+	return &SLO{
+		tracker: tracker,
+		log:     log,
+	}
+}
+
+// GetSLO returns current compliance, burn rate and remaining error budget for every objective and window.
+func (sh *SLO) GetSLO(w http.ResponseWriter, r *http.Request) {
+	report := sh.tracker.Evaluate(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		sh.log.ErrorContext(r.Context(), "failed to encode SLO report", "error", err)
+	}
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/version"
+)
+
+const (
+	// statusFailureWindow is how far back the status page looks for finished jobs.
+	statusFailureWindow      = time.Hour
+	statusFailureWindowLabel = "1h"
+	// statusDecisionsLimit bounds the scaling decisions read to find each Deployment's latest one.
+	statusDecisionsLimit = 100
+	// statusRefreshSeconds is how often the HTML page reloads itself.
+	statusRefreshSeconds = 30
+)
+
+// StatusPage is the public summary served by /statusz. It never contains job data or error details.
+type StatusPage struct {
+	Service     string    `json:"service"`
+	Status      string    `json:"status"`
+	GeneratedAt time.Time `json:"generated_at"`
+	// Unavailable lists the sections that could not be read, in which case Status is "degraded".
+	Unavailable []string      `json:"unavailable,omitempty"`
+	Queue       QueueStatus   `json:"queue"`
+	Workers     *WorkerStatus `json:"workers,omitempty"`
+	Jobs        JobOutcomes   `json:"jobs"`
+	Build       version.Info  `json:"build"`
+}
+
+// QueueStatus is the queued backlog per processing type and the failed jobs awaiting inspection.
+type QueueStatus struct {
+	Backlog int64            `json:"backlog"`
+	ByType  map[string]int64 `json:"by_type"`
+	Failed  int64            `json:"failed"`
+}
+
+// WorkerStatus sums the worker Deployments as of the controller's latest scaling decisions.
+type WorkerStatus struct {
+	Active      int32     `json:"active"`
+	Desired     int32     `json:"desired"`
+	Deployments int       `json:"deployments"`
+	AsOf        time.Time `json:"as_of"`
+}
+
+// JobOutcomes is the failure rate of the jobs finished within Window.
+type JobOutcomes struct {
+	Window      string  `json:"window"`
+	Finished    int64   `json:"finished"`
+	Failed      int64   `json:"failed"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// scalingDecision holds the fields of the controller's recorded scaling decisions the status page uses.
+type scalingDecision struct {
+	Timestamp      time.Time `json:"timestamp"`
+	Deployment     string    `json:"deployment"`
+	Namespace      string    `json:"namespace"`
+	ActiveWorkers  int32     `json:"active_workers"`
+	TargetReplicas int32     `json:"target_replicas"`
+}
+
+type Status struct {
+	repo  StatusRepository
+	queue StatusQueue
+	log   *slog.Logger
+}
+
+func NewStatus(repo StatusRepository, queue StatusQueue, log *slog.Logger) *Status {
+	return &Status{
+		repo:  repo,
+		queue: queue,
+		log:   log,
+	}
+}
+
+// Statusz serves a read-only status page for embedding in dashboards: HTML by default, JSON with
+// ?format=json or an Accept header preferring application/json.
+func (sh *Status) Statusz(w http.ResponseWriter, r *http.Request) {
+	page := sh.collect(r.Context())
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			sh.log.ErrorContext(r.Context(), "failed to encode status page", "error", err)
+		}
+		return
+	}
+
+	// Dashboards embed the page in frames, which the default security headers forbid
+	w.Header().Del("X-Frame-Options")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors *")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := statusTemplate.Execute(w, page); err != nil {
+		sh.log.ErrorContext(r.Context(), "failed to render status page", "error", err)
+	}
+}
+
+func wantsJSON(r *http.Request) bool {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format == "json"
+	}
+	return strings.HasPrefix(r.Header.Get("Accept"), "application/json")
+}
+
+func (sh *Status) collect(ctx context.Context) StatusPage {
+	page := StatusPage{
+		Service:     "text-api",
+		Status:      "ok",
+		GeneratedAt: time.Now().UTC(),
+		Build:       version.Get(),
+	}
+
+	unavailable := func(section string, err error) {
+		sh.log.ErrorContext(ctx, "failed to read status page section", "section", section, "error", err)
+		page.Unavailable = append(page.Unavailable, section)
+		page.Status = "degraded"
+	}
+
+	if queueStatus, err := sh.queueStatus(ctx); err != nil {
+		unavailable("queue", err)
+	} else {
+		page.Queue = queueStatus
+	}
+
+	if workers, err := sh.workerStatus(ctx); err != nil {
+		unavailable("workers", err)
+	} else {
+		page.Workers = workers
+	}
+
+	page.Jobs.Window = statusFailureWindowLabel
+	finished, failed, err := sh.repo.CountFinishedJobsSince(ctx, time.Now().Add(-statusFailureWindow))
+	if err != nil {
+		unavailable("jobs", err)
+	} else {
+		page.Jobs.Finished, page.Jobs.Failed = finished, failed
+		if finished > 0 {
+			page.Jobs.FailureRate = float64(failed) / float64(finished)
+		}
+	}
+
+	return page
+}
+
+func (sh *Status) queueStatus(ctx context.Context) (QueueStatus, error) {
+	byType, err := sh.queue.GetTypeQueueLengths(ctx)
+	if err != nil {
+		return QueueStatus{}, err
+	}
+
+	shared, err := sh.queue.GetAllQueuesLength(ctx)
+	if err != nil {
+		return QueueStatus{}, err
+	}
+
+	status := QueueStatus{
+		Backlog: shared[queue.QueueMain] + shared[queue.QueuePriority],
+		ByType:  make(map[string]int64, len(byType)),
+		Failed:  shared[queue.QueueFailed],
+	}
+	for processingType, length := range byType {
+		status.ByType[string(processingType)] = length
+		status.Backlog += length
+	}
+	return status, nil
+}
+
+// workerStatus sums the latest scaling decision of every worker Deployment; nil when the
+// controller has not recorded any.
+func (sh *Status) workerStatus(ctx context.Context) (*WorkerStatus, error) {
+	entries, err := sh.queue.GetScalingDecisions(ctx, statusDecisionsLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var status *WorkerStatus
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		var decision scalingDecision
+		if err := json.Unmarshal([]byte(entry), &decision); err != nil {
+			continue
+		}
+
+		// Decisions are newest first, so the first one per Deployment is its latest
+		key := decision.Namespace + "/" + decision.Deployment
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if status == nil {
+			status = &WorkerStatus{AsOf: decision.Timestamp.UTC()}
+		}
+		status.Active += decision.ActiveWorkers
+		status.Desired += decision.TargetReplicas
+		status.Deployments++
+	}
+
+	return status, nil
+}
+
+var statusTemplate = template.Must(template.New("statusz").Funcs(template.FuncMap{
+	"sortedTypes": func(byType map[string]int64) []string { return slices.Sorted(maps.Keys(byType)) },
+	"percent":     func(ratio float64) string { return fmt.Sprintf("%.1f%%", ratio*100) },
+	"refresh":     func() int { return statusRefreshSeconds },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{refresh}}">
+<title>{{.Service}} status</title>
+<style>
+body { font-family: sans-serif; margin: 1em; color: #222; }
+h1 { font-size: 1.2em; }
+.ok { color: #2e7d32; } .degraded { color: #c62828; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { padding: 0.2em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+small { color: #777; }
+</style>
+</head>
+<body>
+<h1>{{.Service}}: <span class="{{.Status}}">{{.Status}}</span></h1>
+{{if .Unavailable}}<p class="degraded">Unavailable: {{range $i, $s := .Unavailable}}{{if $i}}, {{end}}{{$s}}{{end}}</p>{{end}}
+<table>
+<tr><th>Queued jobs</th><td>{{.Queue.Backlog}}</td></tr>
+{{range sortedTypes .Queue.ByType}}<tr><td>&nbsp;&nbsp;{{.}}</td><td>{{index $.Queue.ByType .}}</td></tr>
+{{end}}<tr><th>Failed queue</th><td>{{.Queue.Failed}}</td></tr>
+{{with .Workers}}<tr><th>Workers</th><td>{{.Active}} active / {{.Desired}} desired in {{.Deployments}} deployments</td></tr>
+{{else}}<tr><th>Workers</th><td>unknown</td></tr>
+{{end}}<tr><th>Failure rate ({{.Jobs.Window}})</th><td>{{percent .Jobs.FailureRate}} of {{.Jobs.Finished}} jobs</td></tr>
+</table>
+<small>{{.Build.Version}}{{with .Build.Commit}} ({{.}}){{end}}, {{.Build.GoVersion}} &middot; generated {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}</small>
+</body>
+</html>
+`))
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/tenant"
+)
+
+type StorageUsageRepository interface {
+	GetStorageUsage(ctx context.Context, tenantID string) ([]database.StorageUsage, error)
+}
+
+type Storage struct {
+	repo         StorageUsageRepository
+	storageQuota func() int64
+	log          *slog.Logger
+}
+
+type (
+	tenantStorageResponse struct {
+		database.StorageUsage
+		TotalBytes int64 `json:"total_bytes"`
+		// RemainingBytes is omitted when no quota is configured.
+		RemainingBytes *int64 `json:"remaining_bytes,omitempty"`
+	}
+
+	storageUsageResponse struct {
+		// QuotaBytes is the per-tenant storage cap, zero when unlimited.
+		QuotaBytes int64                   `json:"quota_bytes"`
+		Tenants    []tenantStorageResponse `json:"tenants"`
+	}
+)
+
+func NewStorage(repo StorageUsageRepository, storageQuota func() int64, log *slog.Logger) *Storage {
+	return &Storage{
+		repo:         repo,
+		storageQuota: storageQuota,
+		log:          log,
+	}
+}
+
+// GetStorageUsage reports the bytes of uploads and results each tenant currently keeps stored.
+// The optional tenant query parameter limits the report to a single tenant.
+func (sh *Storage) GetStorageUsage(w http.ResponseWriter, r *http.Request) {
+	tenantID := r.URL.Query().Get("tenant")
+	if tenantID != "" && !tenant.Valid(tenantID) {
+		sh.writeError(w, http.StatusBadRequest, "invalid tenant: "+tenantID, "INVALID_TENANT")
+		return
+	}
+
+	usage, err := sh.repo.GetStorageUsage(r.Context(), tenantID)
+	if err != nil {
+		sh.log.ErrorContext(r.Context(), "failed to get storage usage", "error", err)
+		sh.writeError(w, http.StatusInternalServerError, "failed to get storage usage", "STORAGE_USAGE_ERROR")
+		return
+	}
+
+	// A tenant that never uploaded has no row yet but still has its full quota available
+	if tenantID != "" && len(usage) == 0 {
+		usage = []database.StorageUsage{{TenantID: tenantID}}
+	}
+
+	response := storageUsageResponse{
+		QuotaBytes: sh.storageQuota(),
+		Tenants:    make([]tenantStorageResponse, 0, len(usage)),
+	}
+	for _, u := range usage {
+		entry := tenantStorageResponse{StorageUsage: u, TotalBytes: u.TotalBytes()}
+		if response.QuotaBytes > 0 {
+			remaining := max(response.QuotaBytes-entry.TotalBytes, 0)
+			entry.RemainingBytes = &remaining
+		}
+		response.Tenants = append(response.Tenants, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		sh.log.ErrorContext(r.Context(), "failed to encode storage usage", "error", err)
+	}
+}
+
+func (sh *Storage) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		sh.log.Error("failed to encode error response", "error", err)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+const (
+	// streamPollInterval is how often a job stream checks the job for changes.
+	streamPollInterval = time.Second
+	// streamKeepAliveInterval is how long a job stream may stay silent before a keep-alive comment
+	// is sent, so proxies do not close idle streams.
+	streamKeepAliveInterval = 15 * time.Second
+	// streamWriteTimeout bounds each write to a job stream.
+	streamWriteTimeout = 10 * time.Second
+	// streamMaxDuration closes streams of jobs that never finish; EventSource clients reconnect.
+	streamMaxDuration = 30 * time.Minute
+)
+
+// StreamJob streams the job as Server-Sent Events: a "job" event with the job response, including
+// its progress and completion estimate, whenever one of them changes. The stream ends once the job
+// succeeded or failed.
+func (jh *Job) StreamJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid job ID format", "INVALID_JOB_ID")
+		return
+	}
+
+	ctx := r.Context()
+	job, err := jh.repo.GetJobByID(ctx, jobID)
+	if err != nil {
+		jh.log.Error("failed to get job", "error", err, "job_id", jobID)
+		jh.writeErrorWithCode(w, http.StatusNotFound, "job not found", "JOB_NOT_FOUND")
+		return
+	}
+
+	// The stream outlives the server-wide timeouts, so deadlines are managed per write instead
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(payload string) bool {
+		_ = rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprint(w, payload); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	expired := time.After(streamMaxDuration)
+
+	var last []byte
+	lastSent := time.Now()
+	for {
+		response := jh.jobsToResponse(ctx, []*database.Job{job})[0]
+		jh.estimateCompletion(ctx, &response, job)
+		data, err := json.Marshal(response)
+		if err != nil {
+			jh.log.ErrorContext(ctx, "failed to encode job stream event", "error", err, "job_id", jobID)
+			return
+		}
+
+		if string(data) != string(last) {
+			if !send("event: job\ndata: " + string(data) + "\n\n") {
+				return
+			}
+			last, lastSent = data, time.Now()
+		}
+
+		if job.Status.Finished() {
+			return
+		}
+
+		if time.Since(lastSent) >= streamKeepAliveInterval {
+			if !send(": keep-alive\n\n") {
+				return
+			}
+			lastSent = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-expired:
+			return
+		case <-ticker.C:
+		}
+
+		// A failed read keeps the last state; the next tick tries again
+		refreshed, err := jh.repo.GetJobByID(ctx, jobID)
+		if err != nil {
+			jh.log.WarnContext(ctx, "failed to refresh streamed job", "error", err, "job_id", jobID)
+			continue
+		}
+		job = refreshed
+	}
+}
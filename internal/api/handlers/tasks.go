@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/admintask"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// maxTaskBody bounds the body of the requests starting admin tasks, which only holds params.
+const maxTaskBody = 16 << 10
+
+// TaskRunner records admin tasks and queues them to run in the background.
+type TaskRunner interface {
+	Start(ctx context.Context, kind string, params database.JSONB) (*database.AdminTask, error)
+	Kinds() []string
+}
+
+// AdminTaskRepository reads and cancels the admin tasks run in the background.
+type AdminTaskRepository interface {
+	GetAdminTask(ctx context.Context, id uuid.UUID) (*database.AdminTask, error)
+	ListAdminTasks(ctx context.Context, filter database.AdminTaskFilter) ([]*database.AdminTask, error)
+	CancelAdminTask(ctx context.Context, id uuid.UUID) (*database.AdminTask, error)
+}
+
+// TaskAdmin serves the admin endpoints of the admin tasks: long maintenance operations, such as
+// canceling and retrying jobs in bulk or exporting jobs, that run in the background on one of the
+// replicas and whose progress is polled.
+type TaskAdmin struct {
+	runner TaskRunner
+	tasks  AdminTaskRepository
+	files  ExportFiles
+	log    *slog.Logger
+}
+
+// startTaskRequest is the body of POST /api/v1/admin/tasks.
+type startTaskRequest struct {
+	Kind   string         `json:"kind"`
+	Params database.JSONB `json:"params"`
+}
+
+func NewTaskAdmin(runner TaskRunner, tasks AdminTaskRepository, files ExportFiles, log *slog.Logger) *TaskAdmin {
+	return &TaskAdmin{
+		runner: runner,
+		tasks:  tasks,
+		files:  files,
+		log:    log,
+	}
+}
+
+// StartTask starts a task of the kind in the body, such as export, orphan_cleanup or
+// reencrypt_files, with its params.
+func (ta *TaskAdmin) StartTask(w http.ResponseWriter, r *http.Request) {
+	var req startTaskRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTaskBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		ta.writeError(w, http.StatusBadRequest,
+			`expected a JSON body {"kind": "export", "params": {"format": "zip"}}: `+err.Error(), "INVALID_TASK")
+		return
+	}
+
+	task, err := ta.runner.Start(r.Context(), req.Kind, req.Params)
+	if errors.Is(err, admintask.ErrUnknownKind) || errors.Is(err, admintask.ErrInvalidParams) {
+		ta.writeError(w, http.StatusBadRequest, err.Error(), "INVALID_TASK")
+		return
+	}
+	ta.writeStarted(w, r, task, err)
+}
+
+// ListTasks lists the admin tasks, newest first.
+// Query parameters: status, kind, limit (default 100) and offset.
+func (ta *TaskAdmin) ListTasks(w http.ResponseWriter, r *http.Request) {
+	var err error
+	//nolint:mnd // we need to initialize the filter with default values
+	filter := database.AdminTaskFilter{
+		Limit: 100,
+	}
+
+	if statusStr := r.URL.Query().Get("status"); statusStr != "" {
+		var ok bool
+		if filter.Status, ok = database.ToTaskStatus(statusStr); !ok {
+			ta.writeError(w, http.StatusBadRequest, "invalid task status", "INVALID_STATUS_FILTER")
+			return
+		}
+	}
+
+	filter.Kind = r.URL.Query().Get("kind")
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if filter.Limit, err = strconv.Atoi(limitStr); err != nil || filter.Limit < 0 {
+			ta.writeError(w, http.StatusBadRequest, "invalid limit parameter", "INVALID_LIMIT")
+			return
+		}
+	}
+
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if filter.Offset, err = strconv.Atoi(offsetStr); err != nil || filter.Offset < 0 {
+			ta.writeError(w, http.StatusBadRequest, "invalid offset parameter", "INVALID_OFFSET")
+			return
+		}
+	}
+
+	tasks, err := ta.tasks.ListAdminTasks(r.Context(), filter)
+	if err != nil {
+		ta.log.ErrorContext(r.Context(), "failed to list admin tasks", "error", err)
+		ta.writeError(w, http.StatusInternalServerError, "failed to list tasks", "TASK_LIST_ERROR")
+		return
+	}
+
+	ta.writeJSON(w, r, http.StatusOK, map[string]any{
+		"tasks":  tasks,
+		"kinds":  ta.runner.Kinds(),
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+		"total":  len(tasks),
+	})
+}
+
+// GetTask returns an admin task and its progress.
+func (ta *TaskAdmin) GetTask(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := ta.taskID(w, r)
+	if !ok {
+		return
+	}
+
+	task, err := ta.tasks.GetAdminTask(r.Context(), taskID)
+	if err != nil {
+		ta.log.ErrorContext(r.Context(), "failed to get admin task", "error", err, "task_id", taskID)
+		ta.writeError(w, http.StatusNotFound, "task not found", "TASK_NOT_FOUND")
+		return
+	}
+
+	ta.writeJSON(w, r, http.StatusOK, task)
+}
+
+// CancelTask cancels a pending task at once and asks a running one to stop, which its runner
+// notices within seconds; the task is returned with cancel_requested set.
+func (ta *TaskAdmin) CancelTask(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := ta.taskID(w, r)
+	if !ok {
+		return
+	}
+
+	task, err := ta.tasks.CancelAdminTask(r.Context(), taskID)
+	if errors.Is(err, database.ErrAdminTaskFinished) {
+		ta.writeError(w, http.StatusConflict, "task already finished", "TASK_FINISHED")
+		return
+	}
+	if err != nil {
+		ta.log.ErrorContext(r.Context(), "failed to cancel admin task", "error", err, "task_id", taskID)
+		ta.writeError(w, http.StatusNotFound, "task not found", "TASK_NOT_FOUND")
+		return
+	}
+
+	ta.log.InfoContext(r.Context(), "admin task cancellation requested", "task_id", taskID, "status", task.Status)
+	ta.writeJSON(w, r, http.StatusOK, task)
+}
+
+// GetTaskArtifact streams the file a task produced, such as the archive of an export task, until
+// it is removed with the results.
+func (ta *TaskAdmin) GetTaskArtifact(w http.ResponseWriter, r *http.Request) {
+	taskID, ok := ta.taskID(w, r)
+	if !ok {
+		return
+	}
+
+	task, err := ta.tasks.GetAdminTask(r.Context(), taskID)
+	if err != nil {
+		ta.log.ErrorContext(r.Context(), "failed to get admin task", "error", err, "task_id", taskID)
+		ta.writeError(w, http.StatusNotFound, "task not found", "TASK_NOT_FOUND")
+		return
+	}
+
+	path, _ := task.Result["path"].(string)
+	if task.Status != database.TaskStatusSucceeded || path == "" {
+		ta.writeError(w, http.StatusNotFound, "task has no artifact", "ARTIFACT_NOT_FOUND")
+		return
+	}
+
+	file, size, err := ta.files.OpenFile(path)
+	if err != nil {
+		ta.log.WarnContext(r.Context(), "failed to open admin task artifact", "error", err, "task_id", taskID)
+		ta.writeError(w, http.StatusNotFound, "artifact no longer stored", "ARTIFACT_NOT_FOUND")
+		return
+	}
+	defer file.Close()
+
+	contentType := "application/octet-stream"
+	if format, _ := task.Result["format"].(string); format != "" {
+		if parsed, err := parseExportFormat(format); err == nil {
+			contentType = parsed.contentType
+		}
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		ta.log.WarnContext(r.Context(), "failed to stream admin task artifact", "error", err, "task_id", taskID)
+	}
+}
+
+func (ta *TaskAdmin) taskID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	taskID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		ta.writeError(w, http.StatusBadRequest, "invalid task ID format", "INVALID_TASK_ID")
+		return uuid.Nil, false
+	}
+	return taskID, true
+}
+
+// writeStarted answers 202 with the started task, whose progress is polled at the Location.
+func (ta *TaskAdmin) writeStarted(w http.ResponseWriter, r *http.Request, task *database.AdminTask, err error) {
+	if err != nil {
+		ta.log.ErrorContext(r.Context(), "failed to start admin task", "error", err)
+		ta.writeError(w, http.StatusInternalServerError, "failed to start admin task", "TASK_ERROR")
+		return
+	}
+
+	ta.log.InfoContext(r.Context(), "admin task queued", "task_id", task.ID, "kind", task.Kind)
+	w.Header().Set("Location", "/api/v1/admin/tasks/"+task.ID.String())
+	ta.writeJSON(w, r, http.StatusAccepted, task)
+}
+
+func (ta *TaskAdmin) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		ta.log.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+func (ta *TaskAdmin) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		ta.log.Error("failed to encode error response", "error", err)
+	}
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/rsav/k8s-learning/internal/api/metrics"
+)
+
+// Reasons job submissions are rejected by the upload limits.
+const (
+	uploadRejectBusy         = "busy"
+	uploadRejectTempDiskFull = "temp_disk_full"
+	uploadRejectTooLarge     = "too_large"
+)
+
+// uploadRetryAfterSeconds is sent in Retry-After when a job submission is rejected by the limits.
+const uploadRetryAfterSeconds = "1"
+
+// uploadFormOverhead is the room a job submission leaves for the form fields and part headers
+// around its files.
+const uploadFormOverhead = 1 << 20
+
+// MaxUploadSize returns the largest body of a job submission: two files of up to maxFileSize
+// bytes each, as diffs take, and the rest of the form. The size of each file is checked when it is
+// stored.
+func MaxUploadSize(maxFileSize int64) int64 {
+	return 2*maxFileSize + uploadFormOverhead
+}
+
+var (
+	errUploadBusy         = errors.New("too many uploads in progress, retry later")
+	errUploadTempDiskFull = errors.New("temporary upload storage is full, retry later")
+	errUploadTooLarge     = errors.New("upload exceeds the temporary upload storage limit")
+	errFormTooLarge       = errors.New("form values exceed the upload memory limit")
+)
+
+// UploadLimiter bounds how many multipart job submissions are parsed at once, and so the memory
+// they buffer, and the temporary disk the parses spill larger uploads to.
+type UploadLimiter struct {
+	slots         chan struct{}
+	memoryLimit   int64
+	tempDiskLimit int64
+	// tempDir is where larger uploads are spilled, the system temporary directory when empty.
+	tempDir string
+
+	mu            sync.Mutex
+	tempDiskBytes int64
+}
+
+// NewUploadLimiter allows maxConcurrentParses parses buffering up to memoryLimit bytes each, and
+// up to tempDiskLimit bytes spilled to tempDir across all of them.
+func NewUploadLimiter(maxConcurrentParses int, memoryLimit, tempDiskLimit int64, tempDir string) *UploadLimiter {
+	metrics.UploadTempDiskLimitBytes.Set(float64(tempDiskLimit))
+
+	return &UploadLimiter{
+		slots:         make(chan struct{}, maxConcurrentParses),
+		memoryLimit:   memoryLimit,
+		tempDiskLimit: tempDiskLimit,
+		tempDir:       tempDir,
+	}
+}
+
+// upload is a job submission admitted by the UploadLimiter.
+type upload struct {
+	limiter  *UploadLimiter
+	reserved int64
+}
+
+// acquire admits a submission with a body of size bytes, or up to maxSize bytes when the size is
+// unknown. Until the form is parsed, the whole body is reserved on the temporary disk, as the parse
+// may spill all of it. A body larger than the whole temporary disk limit fails with
+// errUploadTooLarge, as it could never be admitted.
+func (l *UploadLimiter) acquire(size, maxSize int64) (*upload, error) {
+	if size > l.tempDiskLimit {
+		metrics.UploadsRejectedTotal.WithLabelValues(uploadRejectTooLarge).Inc()
+		return nil, errUploadTooLarge
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	default:
+		metrics.UploadsRejectedTotal.WithLabelValues(uploadRejectBusy).Inc()
+		return nil, errUploadBusy
+	}
+
+	if size < 0 {
+		size = min(maxSize, l.tempDiskLimit)
+	}
+
+	l.mu.Lock()
+	if l.tempDiskBytes+size > l.tempDiskLimit {
+		l.mu.Unlock()
+		<-l.slots
+		metrics.UploadsRejectedTotal.WithLabelValues(uploadRejectTempDiskFull).Inc()
+		return nil, errUploadTempDiskFull
+	}
+	l.tempDiskBytes += size
+	metrics.UploadTempDiskBytes.Set(float64(l.tempDiskBytes))
+	l.mu.Unlock()
+
+	metrics.UploadParsesInFlight.Inc()
+	return &upload{limiter: l, reserved: size}, nil
+}
+
+func (l *UploadLimiter) addTempDiskBytes(delta int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tempDiskBytes += delta
+	metrics.UploadTempDiskBytes.Set(float64(l.tempDiskBytes))
+}
+
+// settle replaces the reservation with the bytes the parsed form actually spilled to disk.
+func (u *upload) settle(form *uploadForm) {
+	spilled := form.spilledBytes()
+	u.limiter.addTempDiskBytes(spilled - u.reserved)
+	u.reserved = spilled
+}
+
+// release removes the temporary files of the form and frees the slot and disk of the submission.
+func (u *upload) release(form *uploadForm) error {
+	var err error
+	if form != nil {
+		err = form.removeAll()
+	}
+
+	u.limiter.addTempDiskBytes(-u.reserved)
+	metrics.UploadParsesInFlight.Dec()
+	<-u.limiter.slots
+	return err
+}
+
+// uploadForm is a parsed multipart job submission: its values, followed by those of the query
+// string, and its files.
+type uploadForm struct {
+	values url.Values
+	files  map[string][]*uploadedFile
+}
+
+// uploadedFile is a file of a job submission, held in memory or, when the form exceeds the memory
+// limit, in a temporary file.
+type uploadedFile struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Size     int64
+
+	content []byte
+	tmpFile string
+}
+
+// parseForm reads the multipart body of r like http.Request.ParseMultipartForm, buffering values
+// and files in memory up to the memory limit and spilling the files beyond it to the temp dir of the
+// limiter, which mime/multipart cannot be told.
+func (u *upload) parseForm(r *http.Request) (*uploadForm, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	form := &uploadForm{values: make(url.Values), files: make(map[string][]*uploadedFile)}
+	memory := u.limiter.memoryLimit
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, errors.Join(err, form.removeAll())
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		var buf bytes.Buffer
+		n, err := io.CopyN(&buf, part, memory+1)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, errors.Join(err, form.removeAll())
+		}
+
+		if part.FileName() == "" {
+			if memory -= n; memory < 0 {
+				return nil, errors.Join(errFormTooLarge, form.removeAll())
+			}
+			form.values.Add(name, buf.String())
+			continue
+		}
+
+		file := &uploadedFile{Filename: part.FileName(), Header: part.Header}
+		if n <= memory {
+			memory -= n
+			file.content, file.Size = buf.Bytes(), n
+		} else if file.tmpFile, file.Size, err = u.limiter.spill(io.MultiReader(&buf, part)); err != nil {
+			return nil, errors.Join(err, form.removeAll())
+		}
+		form.files[name] = append(form.files[name], file)
+	}
+
+	for key, values := range r.URL.Query() {
+		form.values[key] = append(form.values[key], values...)
+	}
+	return form, nil
+}
+
+// spill writes content to a new file in the temp dir and returns its path and size.
+func (l *UploadLimiter) spill(content io.Reader) (string, int64, error) {
+	file, err := os.CreateTemp(l.tempDir, "multipart-")
+	if err != nil {
+		return "", 0, fmt.Errorf("create temporary upload file: %w", err)
+	}
+
+	size, err := io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", 0, fmt.Errorf("write temporary upload file: %w", err)
+	}
+	return file.Name(), size, nil
+}
+
+// value returns the first value of the form field key, or an empty string.
+func (f *uploadForm) value(key string) string {
+	return f.values.Get(key)
+}
+
+// file returns the first file of the form field key, or nil.
+func (f *uploadForm) file(key string) *uploadedFile {
+	if files := f.files[key]; len(files) > 0 {
+		return files[0]
+	}
+	return nil
+}
+
+// spilledBytes returns the size of the uploaded files that did not fit in memory and were written
+// to temporary files.
+func (f *uploadForm) spilledBytes() int64 {
+	if f == nil {
+		return 0
+	}
+
+	var spilled int64
+	for _, files := range f.files {
+		for _, file := range files {
+			if file.tmpFile != "" {
+				spilled += file.Size
+			}
+		}
+	}
+	return spilled
+}
+
+// removeAll removes the temporary files of the form.
+func (f *uploadForm) removeAll() error {
+	var errs []error
+	for _, files := range f.files {
+		for _, file := range files {
+			if file.tmpFile == "" {
+				continue
+			}
+			if err := os.Remove(file.tmpFile); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Open returns the content of the file.
+func (f *uploadedFile) Open() (io.ReadCloser, error) {
+	if f.tmpFile == "" {
+		return io.NopCloser(bytes.NewReader(f.content)), nil
+	}
+	// #nosec G304 -- tmpFile was created by spill in the upload temp dir
+	return os.Open(f.tmpFile)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/tenant"
+)
+
+const (
+	defaultUsageRange = 30 * 24 * time.Hour
+	maxUsageRange     = 366 * 24 * time.Hour
+)
+
+type UsageRepository interface {
+	GetUsage(ctx context.Context, filter database.UsageFilter) ([]database.UsageTotals, error)
+	GetBandwidthUsage(ctx context.Context, filter database.UsageFilter) ([]database.BandwidthTotals, error)
+}
+
+type Usage struct {
+	repo UsageRepository
+	log  *slog.Logger
+}
+
+type usageResponse struct {
+	From    time.Time              `json:"from"`
+	To      time.Time              `json:"to"`
+	GroupBy database.UsageGrouping `json:"group_by"`
+	Usage   []database.UsageTotals `json:"usage"`
+	Totals  database.UsageTotals   `json:"totals"`
+	// Bandwidth is the API request and response body bytes per tenant and route, by day at the finest.
+	Bandwidth       []database.BandwidthTotals `json:"bandwidth"`
+	BandwidthTotals database.BandwidthTotals   `json:"bandwidth_totals"`
+}
+
+func NewUsage(repo UsageRepository, log *slog.Logger) *Usage {
+	return &Usage{
+		repo: repo,
+		log:  log,
+	}
+}
+
+// GetUsage reports resource usage of completed jobs per tenant and processing type, and the API
+// bandwidth per tenant and route. Query parameters: from and to (RFC 3339, default the last 30 days), group_by (none, hour, day
+// or month, default day), tenant and processing_type.
+func (uh *Usage) GetUsage(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseUsageFilter(r)
+	if err != nil {
+		uh.writeError(w, http.StatusBadRequest, err.Error(), "INVALID_USAGE_QUERY")
+		return
+	}
+
+	usage, err := uh.repo.GetUsage(r.Context(), filter)
+	if err != nil {
+		uh.log.ErrorContext(r.Context(), "failed to get usage", "error", err)
+		uh.writeError(w, http.StatusInternalServerError, "failed to get usage", "USAGE_QUERY_ERROR")
+		return
+	}
+
+	bandwidth, err := uh.repo.GetBandwidthUsage(r.Context(), filter)
+	if err != nil {
+		uh.log.ErrorContext(r.Context(), "failed to get bandwidth usage", "error", err)
+		uh.writeError(w, http.StatusInternalServerError, "failed to get usage", "USAGE_QUERY_ERROR")
+		return
+	}
+
+	response := usageResponse{
+		From:      filter.From,
+		To:        filter.To,
+		GroupBy:   filter.GroupBy,
+		Usage:     usage,
+		Bandwidth: bandwidth,
+	}
+	if response.Usage == nil {
+		response.Usage = []database.UsageTotals{}
+	}
+	if response.Bandwidth == nil {
+		response.Bandwidth = []database.BandwidthTotals{}
+	}
+	for _, u := range usage {
+		response.Totals.Jobs += u.Jobs
+		response.Totals.CPUTimeMS += u.CPUTimeMS
+		response.Totals.WallTimeMS += u.WallTimeMS
+		response.Totals.MaxPeakMemoryBytes = max(response.Totals.MaxPeakMemoryBytes, u.MaxPeakMemoryBytes)
+		response.Totals.BytesRead += u.BytesRead
+		response.Totals.BytesWritten += u.BytesWritten
+	}
+	response.Totals.TenantID = filter.TenantID
+	response.Totals.ProcessingType = filter.ProcessingType
+	for _, b := range bandwidth {
+		response.BandwidthTotals.Requests += b.Requests
+		response.BandwidthTotals.BytesIn += b.BytesIn
+		response.BandwidthTotals.BytesOut += b.BytesOut
+	}
+	response.BandwidthTotals.TenantID = filter.TenantID
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		uh.log.ErrorContext(r.Context(), "failed to encode usage report", "error", err)
+	}
+}
+
+func parseUsageFilter(r *http.Request) (database.UsageFilter, error) {
+	query := r.URL.Query()
+	filter := database.UsageFilter{
+		To:      time.Now().UTC(),
+		GroupBy: database.UsageGroupingDay,
+	}
+
+	if to := query.Get("to"); to != "" {
+		parsed, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to: %w", err)
+		}
+		filter.To = parsed.UTC()
+	}
+
+	filter.From = filter.To.Add(-defaultUsageRange)
+	if from := query.Get("from"); from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from: %w", err)
+		}
+		filter.From = parsed.UTC()
+	}
+
+	if !filter.From.Before(filter.To) {
+		return filter, errors.New("from must be before to")
+	}
+	if filter.To.Sub(filter.From) > maxUsageRange {
+		return filter, fmt.Errorf("time range cannot exceed %s", maxUsageRange)
+	}
+
+	if groupBy := query.Get("group_by"); groupBy != "" {
+		grouping, ok := database.ToUsageGrouping(groupBy)
+		if !ok {
+			return filter, errors.New("invalid group_by: must be one of none, hour, day, month")
+		}
+		filter.GroupBy = grouping
+	}
+
+	if tenantID := query.Get("tenant"); tenantID != "" {
+		if !tenant.Valid(tenantID) {
+			return filter, fmt.Errorf("invalid tenant: %s", tenantID)
+		}
+		filter.TenantID = tenantID
+	}
+
+	if processingType := query.Get("processing_type"); processingType != "" {
+		pt, ok := database.ToProcessingType(processingType)
+		if !ok {
+			return filter, fmt.Errorf("invalid processing_type: %s", processingType)
+		}
+		filter.ProcessingType = pt
+	}
+
+	return filter, nil
+}
+
+func (uh *Usage) writeError(w http.ResponseWriter, statusCode int, message, errorCode string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(errorResponse{
+		Error:     message,
+		ErrorCode: errorCode,
+		Status:    statusCode,
+		Timestamp: time.Now().Unix(),
+	}); err != nil {
+		uh.log.Error("failed to encode error response", "error", err)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// parseWait reads the wait parameter of GetJob, a duration such as 30s capped at maxWait. Zero
+// means the job is returned right away.
+func (jh *Job) parseWait(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	waitStr := r.URL.Query().Get("wait")
+	if waitStr == "" {
+		return 0, true
+	}
+
+	wait, err := time.ParseDuration(waitStr)
+	if err != nil || wait < 0 {
+		jh.writeErrorWithCode(w, http.StatusBadRequest, "invalid wait parameter, expected a duration such as 30s", "INVALID_WAIT")
+		return 0, false
+	}
+
+	if wait > 0 && jh.waiter == nil {
+		jh.writeErrorWithCode(w, http.StatusBadRequest,
+			"long polling requires job events to be published to Redis, use the events stream instead", "LONG_POLL_UNAVAILABLE")
+		return 0, false
+	}
+
+	return min(wait, jh.maxWait), true
+}
+
+// waitForJob holds the request until the job finished, as announced on finished, or the
+// wait elapsed, and returns the job as it is then. It returns false when the client went away.
+func (jh *Job) waitForJob(
+	w http.ResponseWriter, r *http.Request, job *database.Job, finished <-chan events.Event, wait time.Duration,
+) (*database.Job, bool) {
+	if job.Status.Finished() {
+		return job, true
+	}
+
+	// The wait outlives the server-wide write timeout, so the deadline is extended to cover it
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + streamWriteTimeout))
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	ctx := r.Context()
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case <-timer.C:
+	case <-finished:
+	}
+
+	// A failed read still answers with the state from before the wait
+	refreshed, err := jh.repo.GetJobByID(ctx, job.ID)
+	if err != nil {
+		jh.log.WarnContext(ctx, "failed to refresh awaited job", "error", err, "job_id", job.ID)
+		return job, true
+	}
+	return refreshed, true
+}
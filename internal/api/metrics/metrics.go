@@ -2,31 +2,41 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rsav/k8s-learning/internal/observability"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+)
+
+const (
+	// nativeHistogramBucketFactor enables sparse native histograms alongside the classic buckets.
+	// Prometheus only ingests them when scraping with the native-histograms feature enabled.
+	nativeHistogramBucketFactor = 1.1
+	nativeHistogramMaxBuckets   = 160
 )
 
 var (
 	// HTTPRequestsTotal tracks the total number of HTTP requests.
-	HTTPRequestsTotal = promauto.NewCounterVec(
+	HTTPRequestsTotal = telemetry.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "http_requests_total",
+			Name: observability.MetricHTTPRequestsTotal,
 			Help: "Total number of HTTP requests",
 		},
 		[]string{"method", "path", "status"},
 	)
 
 	// HTTPRequestDuration tracks HTTP request duration in seconds.
-	HTTPRequestDuration = promauto.NewHistogramVec(
+	HTTPRequestDuration = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
-			Help:    "HTTP request duration in seconds",
-			Buckets: prometheus.DefBuckets,
+			Name:                           observability.MetricHTTPRequestDuration,
+			Help:                           "HTTP request duration in seconds",
+			Buckets:                        prometheus.DefBuckets,
+			NativeHistogramBucketFactor:    nativeHistogramBucketFactor,
+			NativeHistogramMaxBucketNumber: nativeHistogramMaxBuckets,
 		},
 		[]string{"method", "path"},
 	)
 
 	// HTTPRequestSize tracks HTTP request size in bytes.
-	HTTPRequestSize = promauto.NewHistogramVec(
+	HTTPRequestSize = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "http_request_size_bytes",
 			Help:    "HTTP request size in bytes",
@@ -36,7 +46,7 @@ var (
 	)
 
 	// HTTPResponseSize tracks HTTP response size in bytes.
-	HTTPResponseSize = promauto.NewHistogramVec(
+	HTTPResponseSize = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "http_response_size_bytes",
 			Help:    "HTTP response size in bytes",
@@ -45,16 +55,130 @@ var (
 		[]string{"method", "path"},
 	)
 
+	// HTTPTenantBytesTotal tracks request (in) and response (out) bytes per tenant and route. Only the
+	// first METRICS_TENANT_LABELS tenants seen get a label of their own, later ones share "other".
+	HTTPTenantBytesTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_tenant_bytes_total",
+			Help: "Total bytes of HTTP request and response bodies per tenant and route",
+		},
+		[]string{"tenant_id", "path", "direction"},
+	)
+
+	// HTTPRequestsRejectedTotal tracks API requests rejected by access control or throttling.
+	HTTPRequestsRejectedTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_rejected_total",
+			Help: "Total number of HTTP requests rejected by IP filtering, rate or concurrency limiting, maintenance mode, low disk space or admin authentication",
+		},
+		[]string{"reason"},
+	)
+
+	// FailedQueueExpiredTotal tracks failed queue messages archived and removed after the max age.
+	FailedQueueExpiredTotal = telemetry.NewCounter(
+		prometheus.CounterOpts{
+			Name: "failed_queue_expired_total",
+			Help: "Total number of failed queue messages archived to the file store and removed after FAILED_QUEUE_MAX_AGE",
+		},
+	)
+
+	// DiskTotalBytes and DiskFreeBytes track the volumes of the upload and result directories.
+	DiskTotalBytes = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "disk_total_bytes",
+			Help: "Capacity of the volume of the upload or result directory",
+		},
+		[]string{"volume"},
+	)
+
+	DiskFreeBytes = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "disk_free_bytes",
+			Help: "Space available on the volume of the upload or result directory",
+		},
+		[]string{"volume"},
+	)
+
+	// DiskSpaceLow is 1 while a volume has less free space than DISK_FREE_WATERMARK.
+	DiskSpaceLow = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "disk_space_low",
+			Help: "Whether the volume has less free space than DISK_FREE_WATERMARK (1) or not (0)",
+		},
+		[]string{"volume"},
+	)
+
+	// DiskEmergencyRemovedFilesTotal and DiskEmergencyRemovedBytesTotal track the files removed
+	// to free a volume below the watermark.
+	DiskEmergencyRemovedFilesTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "disk_emergency_removed_files_total",
+			Help: "Total number of files removed by the emergency cleanup of a volume low on space",
+		},
+		[]string{"volume"},
+	)
+
+	DiskEmergencyRemovedBytesTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "disk_emergency_removed_bytes_total",
+			Help: "Total bytes of the files removed by the emergency cleanup of a volume low on space",
+		},
+		[]string{"volume"},
+	)
+
+	// HTTPRequestsInFlight tracks API requests currently being served under the concurrency limit.
+	HTTPRequestsInFlight = telemetry.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "Number of API requests currently in flight",
+		},
+	)
+
+	// UploadParsesInFlight tracks multipart job submissions currently being parsed and processed.
+	UploadParsesInFlight = telemetry.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_upload_parses_in_flight",
+			Help: "Number of multipart job submissions currently holding a parse slot",
+		},
+	)
+
+	// UploadTempDiskBytes tracks the bytes of multipart uploads spilled to the temporary directory,
+	// including what is reserved for uploads still being parsed.
+	UploadTempDiskBytes = telemetry.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_upload_temp_disk_bytes",
+			Help: "Bytes of temporary disk used or reserved by multipart uploads",
+		},
+	)
+
+	// UploadTempDiskLimitBytes exposes the cap on UploadTempDiskBytes.
+	UploadTempDiskLimitBytes = telemetry.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "api_upload_temp_disk_limit_bytes",
+			Help: "Maximum bytes of temporary disk multipart uploads may use",
+		},
+	)
+
+	// UploadsRejectedTotal tracks job submissions rejected before parsing because all parse slots
+	// were taken, the temporary disk cap was reached or the body exceeds the whole cap.
+	UploadsRejectedTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "api_uploads_rejected_total",
+			Help: "Total number of job submissions rejected by the upload parse limits",
+		},
+		[]string{"reason"},
+	)
+
 	// JobsCreatedTotal tracks the total number of jobs created.
-	JobsCreatedTotal = promauto.NewCounter(
+	JobsCreatedTotal = telemetry.NewCounter(
 		prometheus.CounterOpts{
-			Name: "jobs_created_total",
+			Name: observability.MetricJobsCreatedTotal,
 			Help: "Total number of jobs created",
 		},
 	)
 
 	// JobsQueuedTotal tracks the total number of jobs queued by priority.
-	JobsQueuedTotal = promauto.NewCounterVec(
+	JobsQueuedTotal = telemetry.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "jobs_queued_total",
 			Help: "Total number of jobs queued",
@@ -63,7 +187,7 @@ var (
 	)
 
 	// DBConnectionsActive tracks the number of active database connections.
-	DBConnectionsActive = promauto.NewGauge(
+	DBConnectionsActive = telemetry.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "db_connections_active",
 			Help: "Number of active database connections",
@@ -71,7 +195,7 @@ var (
 	)
 
 	// DBQueriesTotal tracks the total number of database queries by operation.
-	DBQueriesTotal = promauto.NewCounterVec(
+	DBQueriesTotal = telemetry.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "db_queries_total",
 			Help: "Total number of database queries",
@@ -80,7 +204,7 @@ var (
 	)
 
 	// DBQueryDuration tracks database query duration in seconds.
-	DBQueryDuration = promauto.NewHistogramVec(
+	DBQueryDuration = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "db_query_duration_seconds",
 			Help:    "Database query duration in seconds",
@@ -90,7 +214,7 @@ var (
 	)
 
 	// RedisOperationsTotal tracks the total number of Redis operations.
-	RedisOperationsTotal = promauto.NewCounterVec(
+	RedisOperationsTotal = telemetry.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "redis_operations_total",
 			Help: "Total number of Redis operations",
@@ -99,7 +223,7 @@ var (
 	)
 
 	// RedisOperationDuration tracks Redis operation duration in seconds.
-	RedisOperationDuration = promauto.NewHistogramVec(
+	RedisOperationDuration = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "redis_operation_duration_seconds",
 			Help:    "Redis operation duration in seconds",
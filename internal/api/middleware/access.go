@@ -0,0 +1,200 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/api/metrics"
+)
+
+// Rejection reasons used as the reason label of http_requests_rejected_total.
+const (
+	rejectReasonDenied       = "ip_denied"
+	rejectReasonNotAllowed   = "ip_not_allowed"
+	rejectReasonOverloaded   = "overloaded"
+	rejectReasonRateLimited  = "rate_limited"
+	rejectReasonUnauthorized = "unauthorized"
+)
+
+// overloadRetryAfterSeconds is sent in Retry-After when the concurrency limit is reached.
+const overloadRetryAfterSeconds = "1"
+
+// ParseCIDRs parses CIDR ranges such as "10.0.0.0/8" or "2001:db8::/32".
+func ParseCIDRs(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, fmt.Errorf("parse CIDR %q: %w", cidr, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// IPFilterMiddleware rejects API requests from clients in deny, or outside allow when allow is not empty,
+// with 403. Forwarding headers are only trusted when trustForwarded is set, since clients can forge them.
+// Non-API routes such as probes and metrics are never filtered.
+func IPFilterMiddleware(allow, deny []netip.Prefix, trustForwarded bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if len(allow) == 0 && len(deny) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			addr, ok := clientAddr(r, trustForwarded)
+			switch {
+			case ok && containsAddr(deny, addr):
+				metrics.HTTPRequestsRejectedTotal.WithLabelValues(rejectReasonDenied).Inc()
+				writeProblem(w, http.StatusForbidden, "client address is denied", r.URL.Path)
+				return
+			case len(allow) > 0 && (!ok || !containsAddr(allow, addr)):
+				metrics.HTTPRequestsRejectedTotal.WithLabelValues(rejectReasonNotAllowed).Inc()
+				writeProblem(w, http.StatusForbidden, "client address is not allowed", r.URL.Path)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConcurrencyLimitMiddleware serves at most maxInFlight API requests at once and answers the overflow
+// with 503 and Retry-After instead of queueing it. A non-positive limit disables throttling.
+func ConcurrencyLimitMiddleware(maxInFlight int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if maxInFlight <= 0 {
+			return next
+		}
+
+		slots := make(chan struct{}, maxInFlight)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			select {
+			case slots <- struct{}{}:
+			default:
+				metrics.HTTPRequestsRejectedTotal.WithLabelValues(rejectReasonOverloaded).Inc()
+				w.Header().Set("Retry-After", overloadRetryAfterSeconds)
+				writeProblem(w, http.StatusServiceUnavailable, "too many requests in flight, retry later", r.URL.Path)
+				return
+			}
+
+			metrics.HTTPRequestsInFlight.Inc()
+			defer func() {
+				metrics.HTTPRequestsInFlight.Dec()
+				<-slots
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimiter admits requests per client across all API replicas.
+type RateLimiter interface {
+	AllowRequest(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error)
+}
+
+// RateLimitMiddleware admits at most limit API requests per client address within a sliding window
+// and answers the excess with 429. The window is kept in Redis, so the limit holds for the client
+// across every API replica. Requests are let through when Redis cannot be reached, and a limit of
+// zero disables rate limiting. Non-API routes are never limited.
+func RateLimitMiddleware(
+	limiter RateLimiter, limit int, window time.Duration, trustForwarded bool, log *slog.Logger,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limit <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := "unknown"
+			if addr, ok := clientAddr(r, trustForwarded); ok {
+				key = addr.String()
+			}
+
+			allowed, retryAfter, err := limiter.AllowRequest(r.Context(), key, limit, window)
+			if err != nil {
+				log.WarnContext(r.Context(), "rate limit unavailable, admitting request", "error", err, "client", key)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !allowed {
+				metrics.HTTPRequestsRejectedTotal.WithLabelValues(rejectReasonRateLimited).Inc()
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(retryAfter.Seconds())))))
+				writeProblem(w, http.StatusTooManyRequests, "rate limit exceeded, retry later", r.URL.Path)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientAddr(r *http.Request, trustForwarded bool) (netip.Addr, bool) {
+	host := r.RemoteAddr
+	if trustForwarded {
+		host = getClientIP(r)
+	} else if h, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		host = h
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminAuthMiddleware admits requests carrying the current token as a bearer token and rejects the
+// others with 401. With an empty token every request is rejected, so admin routes stay closed until
+// a token is configured.
+func AdminAuthMiddleware(token func() string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			expected := token()
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if expected == "" || !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+				metrics.HTTPRequestsRejectedTotal.WithLabelValues(rejectReasonUnauthorized).Inc()
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeProblem(w, http.StatusUnauthorized, "a valid admin bearer token is required", r.URL.Path)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
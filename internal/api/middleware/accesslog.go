@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/tenant"
+)
+
+// errorBodyLimit bounds how much of a failed response is kept to read its error code from.
+const errorBodyLimit = 4096
+
+// LoggingMiddleware writes a structured access log entry per request, with its request ID, tenant
+// and matched route. Requests taking at least slowThreshold are flagged slow=true; zero disables
+// the flag. Only sampleRate of the fast, successful requests are logged, with the rate attached so
+// counts can be scaled back up, while failed and slow requests are always logged in full, including
+// the error code of the response body.
+func LoggingMiddleware(log *slog.Logger, slowThreshold time.Duration, sampleRate float64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			rw := &accessLogWriter{
+				responseWriter: responseWriter{ResponseWriter: w},
+				body:           excerpt{limit: errorBodyLimit},
+			}
+			r, route := withRouteHolder(r)
+
+			next.ServeHTTP(rw, r)
+
+			duration := time.Since(start)
+			status := rw.statusCode
+			if status == 0 {
+				status = http.StatusOK
+			}
+			slow := slowThreshold > 0 && duration >= slowThreshold
+			failed := status >= http.StatusBadRequest
+
+			if !failed && !slow && sampleRate < 1 && rand.Float64() >= sampleRate { //nolint:gosec // sampling, not security
+				return
+			}
+
+			attrs := []slog.Attr{
+				slog.String("request_id", r.Header.Get("X-Request-ID")),
+				slog.String("tenant", tenant.FromContext(r.Context())),
+				slog.String("method", r.Method),
+				slog.String("route", routeLabel(route.pattern)),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Float64("duration_ms", float64(duration.Microseconds())/1000),
+				slog.Int64("bytes", rw.written),
+				slog.String("user_agent", r.UserAgent()),
+				slog.String("remote_addr", getClientIP(r)),
+			}
+			if slow {
+				attrs = append(attrs, slog.Bool("slow", true))
+			}
+
+			if !failed && !slow {
+				if sampleRate < 1 {
+					attrs = append(attrs, slog.Float64("sample_rate", sampleRate))
+				}
+				log.LogAttrs(r.Context(), slog.LevelInfo, "http request", attrs...)
+				return
+			}
+
+			attrs = append(attrs,
+				slog.String("query", r.URL.RawQuery),
+				slog.Int64("request_bytes", r.ContentLength),
+				slog.String("referer", r.Referer()),
+			)
+			if failed && w.Header().Get("Content-Encoding") == "" {
+				code, message := responseError(w.Header().Get("Content-Type"), rw.body.data)
+				attrs = append(attrs, slog.String("error_code", code), slog.String("error", message))
+			}
+			log.LogAttrs(r.Context(), accessLogLevel(status), "http request", attrs...)
+		})
+	}
+}
+
+// accessLogLevel is error for server errors, and warn for client errors and slow requests.
+func accessLogLevel(status int) slog.Level {
+	if status >= http.StatusInternalServerError {
+		return slog.LevelError
+	}
+	return slog.LevelWarn
+}
+
+// accessLogWriter keeps the start of failed responses, to read their error code from.
+type accessLogWriter struct {
+	responseWriter
+	body excerpt
+}
+
+func (w *accessLogWriter) Write(p []byte) (int, error) {
+	n, err := w.responseWriter.Write(p)
+	if w.statusCode >= http.StatusBadRequest {
+		w.body.add(p[:n])
+	}
+	return n, err
+}
+
+// responseError reads the error code and message of a JSON error body: the error_code and error of
+// the handlers' responses, or the type (unless about:blank), title and detail of problem+json ones.
+func responseError(contentType string, body []byte) (string, string) {
+	if !strings.Contains(contentType, "json") || len(body) == 0 {
+		return "", ""
+	}
+
+	var fields struct {
+		ErrorCode string `json:"error_code"`
+		Error     string `json:"error"`
+		Type      string `json:"type"`
+		Title     string `json:"title"`
+		Detail    string `json:"detail"`
+	}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "", ""
+	}
+
+	if strings.HasPrefix(contentType, problemContentType) {
+		code := fields.Type
+		if code == "" || code == "about:blank" {
+			code = fields.Title
+		}
+		return code, fields.Detail
+	}
+	return fields.ErrorCode, fields.Error
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/tenant"
+	"github.com/rsav/k8s-learning/internal/tracing"
+)
+
+// capturedHeaderRedaction replaces the values of headers carrying credentials.
+const capturedHeaderRedaction = "[REDACTED]"
+
+// CapturedRequest summarizes a failed API request for debugging client integrations.
+type CapturedRequest struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	TraceID    string    `json:"trace_id,omitempty"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	Status     int       `json:"status"`
+	Duration   string    `json:"duration"`
+	// The bodies are cut to the capture body limit; Truncated flags whether they were longer.
+	RequestHeaders   http.Header `json:"request_headers"`
+	RequestBody      string      `json:"request_body,omitempty"`
+	RequestTruncated bool        `json:"request_body_truncated,omitempty"`
+	ResponseHeaders  http.Header `json:"response_headers"`
+	ResponseBody     string      `json:"response_body,omitempty"`
+	// ResponseTruncated is also set for compressed responses, whose bodies are not captured.
+	ResponseTruncated bool `json:"response_body_truncated,omitempty"`
+}
+
+// RequestCapture keeps the last failed (4xx and 5xx) API requests in a ring buffer. Only what the
+// handlers read of the request body is captured, up to the body limit.
+type RequestCapture struct {
+	mu        sync.Mutex
+	entries   []CapturedRequest
+	next      int
+	full      bool
+	bodyLimit int
+}
+
+// NewRequestCapture creates a ring buffer of size requests capturing up to bodyLimit bytes of
+// every body.
+func NewRequestCapture(size, bodyLimit int) *RequestCapture {
+	return &RequestCapture{entries: make([]CapturedRequest, size), bodyLimit: bodyLimit}
+}
+
+func (c *RequestCapture) add(entry CapturedRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[c.next] = entry
+	c.next = (c.next + 1) % len(c.entries)
+	if c.next == 0 {
+		c.full = true
+	}
+}
+
+// Entries returns the captured requests, most recent first.
+func (c *RequestCapture) Entries() []CapturedRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := c.next
+	if c.full {
+		count = len(c.entries)
+	}
+	entries := make([]CapturedRequest, 0, count)
+	for i := 1; i <= count; i++ {
+		entries = append(entries, c.entries[(c.next-i+len(c.entries))%len(c.entries)])
+	}
+	return entries
+}
+
+// Handler serves the captured requests as JSON, most recent first.
+func (c *RequestCapture) Handler(w http.ResponseWriter, _ *http.Request) {
+	entries := c.Entries()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(map[string]any{"count": len(entries), "requests": entries})
+}
+
+// RequestCaptureMiddleware records failed /api/ requests in capture; a nil capture disables it.
+// It belongs outside the access middlewares, so their rejections are captured too.
+func RequestCaptureMiddleware(capture *RequestCapture) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if capture == nil {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			requestBody := &excerpt{limit: capture.bodyLimit}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = &capturingBody{ReadCloser: r.Body, excerpt: requestBody}
+			}
+			rw := &capturingWriter{
+				responseWriter: responseWriter{ResponseWriter: w, statusCode: http.StatusOK},
+				body:           excerpt{limit: capture.bodyLimit},
+			}
+
+			next.ServeHTTP(rw, r)
+
+			if rw.statusCode < http.StatusBadRequest {
+				return
+			}
+
+			responseHeaders := w.Header().Clone()
+			if responseHeaders.Get("Content-Encoding") != "" {
+				rw.body = excerpt{truncated: true}
+			}
+			capture.add(CapturedRequest{
+				Time:              start.UTC(),
+				RequestID:         r.Header.Get("X-Request-ID"),
+				TraceID:           tracing.TraceIDFromContext(r.Context()),
+				TenantID:          tenant.FromContext(r.Context()),
+				Method:            r.Method,
+				Path:              r.URL.Path,
+				Query:             r.URL.RawQuery,
+				RemoteAddr:        getClientIP(r),
+				Status:            rw.statusCode,
+				Duration:          time.Since(start).String(),
+				RequestHeaders:    redactHeaders(r.Header),
+				RequestBody:       requestBody.String(),
+				RequestTruncated:  requestBody.truncated,
+				ResponseHeaders:   redactHeaders(responseHeaders),
+				ResponseBody:      rw.body.String(),
+				ResponseTruncated: rw.body.truncated,
+			})
+		})
+	}
+}
+
+// excerpt keeps the first limit bytes written to it.
+type excerpt struct {
+	data      []byte
+	limit     int
+	truncated bool
+}
+
+func (e *excerpt) add(p []byte) {
+	room := e.limit - len(e.data)
+	if len(p) > room {
+		p = p[:max(room, 0)]
+		e.truncated = true
+	}
+	e.data = append(e.data, p...)
+}
+
+func (e *excerpt) String() string {
+	return strings.ToValidUTF8(string(e.data), "�")
+}
+
+type capturingBody struct {
+	io.ReadCloser
+	excerpt *excerpt
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.excerpt.add(p[:n])
+	return n, err
+}
+
+type capturingWriter struct {
+	responseWriter
+	body excerpt
+}
+
+func (w *capturingWriter) Write(p []byte) (int, error) {
+	n, err := w.responseWriter.Write(p)
+	w.body.add(p[:n])
+	return n, err
+}
+
+// redactHeaders copies headers, hiding the values of those carrying credentials.
+func redactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+	for name := range redacted {
+		lower := strings.ToLower(name)
+		if lower == "authorization" || lower == "cookie" || lower == "set-cookie" ||
+			strings.Contains(lower, "token") || strings.Contains(lower, "key") || strings.Contains(lower, "secret") {
+			redacted[name] = []string{capturedHeaderRedaction}
+		}
+	}
+	return redacted
+}
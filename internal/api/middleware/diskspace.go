@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/rsav/k8s-learning/internal/api/metrics"
+)
+
+const (
+	rejectReasonDiskFull = "disk_full"
+
+	// diskFullRetryAfterSeconds is sent in Retry-After while uploads are rejected for lack of space.
+	diskFullRetryAfterSeconds = "300"
+)
+
+// DiskSpaceMiddleware answers requests with 507 Insufficient Storage while spaceLow reports the
+// upload or result volume below its free space watermark. It wraps the routes storing uploads.
+func DiskSpaceMiddleware(spaceLow func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !spaceLow() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			metrics.HTTPRequestsRejectedTotal.WithLabelValues(rejectReasonDiskFull).Inc()
+			w.Header().Set("Retry-After", diskFullRetryAfterSeconds)
+			writeProblem(w, http.StatusInsufficientStorage, "the storage volume is low on free space, uploads are not accepted", r.URL.Path)
+		})
+	}
+}
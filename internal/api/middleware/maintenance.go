@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/rsav/k8s-learning/internal/api/metrics"
+)
+
+const (
+	rejectReasonMaintenance = "maintenance"
+
+	// DefaultMaintenanceMessage is shown to clients when maintenance mode was switched on without
+	// a message.
+	DefaultMaintenanceMessage = "the API is in maintenance mode, only reads are served"
+
+	// maintenanceRetryAfterSeconds is sent in Retry-After while writes are rejected.
+	maintenanceRetryAfterSeconds = "60"
+)
+
+// Maintenance reports the maintenance mode shared by all API replicas.
+type Maintenance interface {
+	GetMaintenance(ctx context.Context) (bool, string, error)
+}
+
+// MaintenanceMiddleware answers mutating API requests with 503 while maintenance mode is on, either
+// forced by the configuration or switched on through the admin endpoint, and serves reads as usual.
+// Admin routes stay writable so maintenance mode can be switched off again. Requests are let
+// through when Redis cannot be reached.
+func MaintenanceMiddleware(maintenance Maintenance, forced bool, log *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/api/v1/admin/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			enabled, message, err := maintenance.GetMaintenance(r.Context())
+			if err != nil {
+				log.WarnContext(r.Context(), "maintenance mode unavailable, admitting request", "error", err)
+			}
+			if !enabled && !forced {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if message == "" {
+				message = DefaultMaintenanceMessage
+			}
+			metrics.HTTPRequestsRejectedTotal.WithLabelValues(rejectReasonMaintenance).Inc()
+			w.Header().Set("Retry-After", maintenanceRetryAfterSeconds)
+			writeProblem(w, http.StatusServiceUnavailable, message, r.URL.Path)
+		})
+	}
+}
@@ -1,15 +1,30 @@
 package middleware
 
 import (
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rsav/k8s-learning/internal/api/metrics"
+	"github.com/rsav/k8s-learning/internal/tenant"
+	"github.com/rsav/k8s-learning/internal/tracing"
 )
 
-// MetricsMiddleware records HTTP request metrics.
-func MetricsMiddleware() func(http.Handler) http.Handler {
+// BandwidthRecorder receives the body bytes of every request for usage accounting.
+type BandwidthRecorder interface {
+	RecordBandwidth(tenantID, route string, bytesIn, bytesOut int64)
+}
+
+// MetricsMiddleware records HTTP request metrics labeled by the matched route pattern.
+// The router must be wrapped with RoutePattern for routes to be resolved; otherwise
+// every request is recorded under the "other" route. Body bytes are also counted per tenant,
+// labeling at most tenantLabels tenants, and passed to bandwidth unless it is nil.
+func MetricsMiddleware(tenantLabels int, bandwidth BandwidthRecorder) func(http.Handler) http.Handler {
+	tenants := newTenantLabeler(tenantLabels)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
@@ -21,9 +36,12 @@ func MetricsMiddleware() func(http.Handler) http.Handler {
 				written:        0,
 			}
 
-			// Record request size
-			if r.ContentLength > 0 {
-				metrics.HTTPRequestSize.WithLabelValues(r.Method, r.URL.Path).Observe(float64(r.ContentLength))
+			r, route := withRouteHolder(r)
+
+			// Count what the handlers actually read, which chunked uploads do not announce
+			body := &countingBody{ReadCloser: r.Body}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
 			}
 
 			// Process request
@@ -32,10 +50,92 @@ func MetricsMiddleware() func(http.Handler) http.Handler {
 			// Record metrics
 			duration := time.Since(start).Seconds()
 			status := strconv.Itoa(rw.statusCode)
+			path := routeLabel(route.pattern)
+
+			if r.ContentLength > 0 {
+				metrics.HTTPRequestSize.WithLabelValues(r.Method, path).Observe(float64(r.ContentLength))
+			}
+			metrics.HTTPRequestsTotal.WithLabelValues(r.Method, path, status).Inc()
+			metrics.HTTPRequestDuration.WithLabelValues(r.Method, path).
+				ObserveWithTraceID(duration, tracing.TraceIDFromContext(r.Context()))
+			metrics.HTTPResponseSize.WithLabelValues(r.Method, path).Observe(float64(rw.written))
+
+			tenantID := tenant.FromContext(r.Context())
+			tenantLabel := tenants.label(tenantID)
+			metrics.HTTPTenantBytesTotal.WithLabelValues(tenantLabel, path, "in").Add(float64(body.read))
+			metrics.HTTPTenantBytesTotal.WithLabelValues(tenantLabel, path, "out").Add(float64(rw.written))
+			if bandwidth != nil {
+				bandwidth.RecordBandwidth(tenantID, path, body.read, rw.written)
+			}
+		})
+	}
+}
+
+// otherTenant labels the tenants beyond the tenant label limit.
+const otherTenant = "other"
+
+// countingBody counts the bytes read from a request body.
+type countingBody struct {
+	io.ReadCloser
+	read int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	return n, err
+}
+
+// tenantLabeler bounds the tenant label values of metrics: the first limit tenants seen keep their
+// ID, later ones are labeled "other" until the process restarts.
+type tenantLabeler struct {
+	mu     sync.Mutex
+	limit  int
+	labels map[string]struct{}
+}
+
+func newTenantLabeler(limit int) *tenantLabeler {
+	return &tenantLabeler{limit: limit, labels: make(map[string]struct{}, limit)}
+}
+
+func (t *tenantLabeler) label(tenantID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.labels[tenantID]; ok {
+		return tenantID
+	}
+	if len(t.labels) >= t.limit {
+		return otherTenant
+	}
+	t.labels[tenantID] = struct{}{}
+	return tenantID
+}
+
+// AvailabilityRecorder receives request outcomes for availability SLO tracking.
+type AvailabilityRecorder interface {
+	Record(success bool)
+}
+
+// AvailabilityMiddleware records API requests for the availability SLO. Only /api/ routes are counted
+// so probes and metric scrapes do not inflate availability; 5xx responses count as failures.
+func AvailabilityMiddleware(recorder AvailabilityRecorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, "/api/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rw := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+				written:        0,
+			}
+
+			next.ServeHTTP(rw, r)
 
-			metrics.HTTPRequestsTotal.WithLabelValues(r.Method, r.URL.Path, status).Inc()
-			metrics.HTTPRequestDuration.WithLabelValues(r.Method, r.URL.Path).Observe(duration)
-			metrics.HTTPResponseSize.WithLabelValues(r.Method, r.URL.Path).Observe(float64(rw.written))
+			recorder.Record(rw.statusCode < http.StatusInternalServerError)
 		})
 	}
 }
@@ -6,9 +6,11 @@ import (
 	"log/slog"
 	"net"
 	"net/http"
-	"strconv"
 	"strings"
-	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/tenant"
+	"github.com/rsav/k8s-learning/internal/tracing"
 )
 
 type responseWriter struct {
@@ -32,6 +34,10 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
 	if !ok {
@@ -40,40 +46,14 @@ func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return hijacker.Hijack()
 }
 
-func LoggingMiddleware(log *slog.Logger) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-
-			rw := &responseWriter{
-				ResponseWriter: w,
-				statusCode:     0,
-				written:        0,
-			}
-
-			next.ServeHTTP(rw, r)
-
-			duration := time.Since(start)
-
-			log.Info("http request",
-				"method", r.Method,
-				"path", r.URL.Path,
-				"status", rw.statusCode,
-				"duration", duration.String(),
-				"bytes", rw.written,
-				"user_agent", r.UserAgent(),
-				"remote_addr", getClientIP(r),
-			)
-		})
-	}
-}
-
 func CORSMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+tenant.Header+", "+
+				tracing.TraceparentHeader+", "+tracing.TracestateHeader)
+			w.Header().Set("Access-Control-Expose-Headers", tracing.TraceparentHeader+", "+tracing.TracestateHeader)
 			w.Header().Set("Access-Control-Max-Age", "86400")
 
 			if r.Method == http.MethodOptions {
@@ -105,6 +85,12 @@ func RecoveryMiddleware(log *slog.Logger) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if err := recover(); err != nil {
+					// Handlers abort responses they cannot complete, such as streamed downloads;
+					// the server resets the connection instead of ending the response cleanly
+					if err == http.ErrAbortHandler { //nolint:errorlint // recover returns the sentinel itself
+						panic(err)
+					}
+
 					log.Error("panic recovered",
 						"error", err,
 						"method", r.Method,
@@ -130,9 +116,12 @@ func RecoveryMiddleware(log *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
-func MaxRequestSizeMiddleware(maxSize int64) func(http.Handler) http.Handler {
+// MaxRequestSizeMiddleware rejects bodies larger than the limit returned by maxSize,
+// which is evaluated per request so runtime configuration changes apply immediately.
+func MaxRequestSizeMiddleware(maxSize func() int64) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			maxSize := maxSize()
 			if r.ContentLength > maxSize {
 				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
 				return
@@ -160,6 +149,51 @@ func RequestIDMiddleware() func(http.Handler) http.Handler {
 	}
 }
 
+// TenantMiddleware stores the tenant from the X-Tenant-ID header in the request context.
+// Requests without the header belong to the default tenant; malformed IDs are rejected.
+func TenantMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenantID := r.Header.Get(tenant.Header)
+			if tenantID == "" {
+				tenantID = tenant.DefaultID
+			}
+
+			if !tenant.Valid(tenantID) {
+				writeProblem(w, http.StatusBadRequest,
+					"invalid "+tenant.Header+": use lowercase letters, digits, '.', '_' or '-'", r.URL.Path)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), tenantID)))
+		})
+	}
+}
+
+// TraceContextMiddleware continues the W3C trace of the caller, or starts one when the request
+// carries no valid traceparent, in a new span stored in the request context. The traceparent and
+// tracestate of that span are echoed in the response, so clients can find the request in their
+// tracing system, and passed on to the queued jobs.
+func TraceContextMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sc, ok := tracing.Parse(r.Header.Get(tracing.TraceparentHeader), r.Header.Get(tracing.TracestateHeader))
+			if ok {
+				sc = sc.Child()
+			} else {
+				sc = tracing.NewTrace()
+			}
+
+			w.Header().Set(tracing.TraceparentHeader, sc.Traceparent())
+			if sc.TraceState != "" {
+				w.Header().Set(tracing.TracestateHeader, sc.TraceState)
+			}
+
+			next.ServeHTTP(w, r.WithContext(tracing.WithSpanContext(r.Context(), sc)))
+		})
+	}
+}
+
 func getClientIP(r *http.Request) string {
 	forwarded := r.Header.Get("X-Forwarded-For")
 	if forwarded != "" {
@@ -180,8 +214,13 @@ func getClientIP(r *http.Request) string {
 	return ip
 }
 
+// generateRequestID returns a UUIDv7: unique across API replicas and sortable by creation time.
 func generateRequestID() string {
-	return strconv.FormatInt(time.Now().UnixNano(), 10)
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
 }
 
 func Chain(middlewares ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
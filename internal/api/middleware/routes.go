@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// unmatchedRoute is the label used for requests that did not match any registered route.
+// Bucketing them together keeps arbitrary client paths out of metric labels.
+const unmatchedRoute = "other"
+
+type routeKey struct{}
+
+// routeHolder carries the matched route pattern back up the middleware chain.
+type routeHolder struct {
+	pattern string
+}
+
+// RoutePattern wraps the router and records the pattern it matched (e.g. "GET /api/v1/jobs/{id}")
+// so outer middlewares can label metrics by route instead of by raw URL path.
+func RoutePattern(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+
+		if holder, ok := r.Context().Value(routeKey{}).(*routeHolder); ok {
+			holder.pattern = r.Pattern
+		}
+	})
+}
+
+// withRouteHolder attaches an empty route holder to the request context, or returns the holder an
+// outer middleware attached, which RoutePattern fills in for both.
+func withRouteHolder(r *http.Request) (*http.Request, *routeHolder) {
+	if holder, ok := r.Context().Value(routeKey{}).(*routeHolder); ok {
+		return r, holder
+	}
+
+	holder := &routeHolder{}
+	return r.WithContext(context.WithValue(r.Context(), routeKey{}, holder)), holder
+}
+
+// routeLabel converts a ServeMux pattern into a metric label, dropping the method prefix.
+func routeLabel(pattern string) string {
+	if pattern == "" {
+		return unmatchedRoute
+	}
+
+	if _, path, found := strings.Cut(pattern, " "); found {
+		return path
+	}
+
+	return pattern
+}
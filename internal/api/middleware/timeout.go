@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// timeoutWriteGrace leaves room to write the timeout response after the route deadline passes.
+const timeoutWriteGrace = time.Second
+
+// TimeoutMiddleware bounds the handling of a route with a context deadline that repository and
+// queue calls observe through the request context. Connection read and write deadlines are moved
+// to match, so a route may run longer or shorter than the server-wide timeouts.
+// On expiry the client gets 408 if the request body was still being received, 503 otherwise.
+func TimeoutMiddleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			deadline, _ := ctx.Deadline()
+			rc := http.NewResponseController(w)
+			_ = rc.SetReadDeadline(deadline)
+			_ = rc.SetWriteDeadline(deadline.Add(timeoutWriteGrace))
+
+			body := &deadlineBody{ReadCloser: r.Body, ctx: ctx}
+			r = r.WithContext(ctx)
+			r.Body = body
+
+			tw := &timeoutWriter{ResponseWriter: w, ctx: ctx}
+			next.ServeHTTP(tw, r)
+
+			if tw.wroteHeader || (!tw.timedOut && ctx.Err() == nil) {
+				return
+			}
+
+			status := http.StatusServiceUnavailable
+			if body.timedOut {
+				status = http.StatusRequestTimeout
+			}
+			writeProblem(w, status, fmt.Sprintf("request did not complete within %s", timeout), r.URL.Path)
+		})
+	}
+}
+
+// timeoutWriter passes writes through until the deadline expires; after that, handler output is
+// discarded so the middleware can reply with a timeout instead of the handler's error.
+type timeoutWriter struct {
+	http.ResponseWriter
+
+	ctx         context.Context
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	if tw.wroteHeader || tw.timedOut {
+		return
+	}
+
+	if tw.ctx.Err() != nil {
+		tw.timedOut = true
+		return
+	}
+
+	tw.wroteHeader = true
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.WriteHeader(http.StatusOK)
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// deadlineBody records whether reading the request body failed because the deadline expired.
+type deadlineBody struct {
+	io.ReadCloser
+
+	ctx      context.Context
+	timedOut bool
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && (errors.Is(err, os.ErrDeadlineExceeded) || b.ctx.Err() != nil) {
+		b.timedOut = true
+	}
+	return n, err
+}
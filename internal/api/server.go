@@ -6,108 +6,357 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"strings"
 	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rsav/k8s-learning/internal/admintask"
 	"github.com/rsav/k8s-learning/internal/api/handlers"
+	"github.com/rsav/k8s-learning/internal/api/metrics"
 	"github.com/rsav/k8s-learning/internal/api/middleware"
+	"github.com/rsav/k8s-learning/internal/batch"
 	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/health"
+	"github.com/rsav/k8s-learning/internal/observability"
+	"github.com/rsav/k8s-learning/internal/reconcile"
+	"github.com/rsav/k8s-learning/internal/runtimestats"
+	"github.com/rsav/k8s-learning/internal/secrets"
+	"github.com/rsav/k8s-learning/internal/slo"
 	"github.com/rsav/k8s-learning/internal/storage/database"
-	"github.com/rsav/k8s-learning/internal/storage/filestore"
-	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/version"
+)
+
+const (
+	fileCleanupInterval          = time.Hour
+	partitionMaintenanceInterval = time.Hour
+	failedQueueExpiryInterval    = 10 * time.Minute
+	// quarantineMaxAge is when quarantined uploads are considered left behind by a stopped replica;
+	// uploads stay in quarantine only while their job is created.
+	quarantineMaxAge = time.Hour
+	// failedQueueExpiryBatch bounds the messages archived to one file.
+	failedQueueExpiryBatch = 1000
+	// failedQueueArchivePrefix names the archives of expired failed queue messages, which no job
+	// references.
+	failedQueueArchivePrefix = "failed-queue-"
+	// maxJSONBody bounds the JSON bodies of the admin endpoints that do not bound their own.
+	maxJSONBody = 64 << 10
 )
 
 type Server struct {
-	config     *config.API
-	repo       *database.Repository
-	queue      *queue.RedisQueue
-	fileStore  *filestore.FileStore
-	log        *slog.Logger
-	httpServer *http.Server
+	config       *config.API
+	runtime      *config.RuntimeWatcher
+	repo         Repository
+	queue        Queue
+	federation   Federation
+	fileStore    FileStorage
+	log          *slog.Logger
+	httpServer   *http.Server
+	sloTracker   *slo.Tracker
+	availability *slo.AvailabilityCounter
+	bandwidth    *bandwidthAccumulator
+	reconciler   *reconcile.Reconciler
+	taskRunner   *admintask.Runner
+	batchRunner  *batch.Runner
+	eventBus     EventBus
+	waiter       JobWaiter
+	notifiers    []handlers.Notifier
+	ipAllowlist  []netip.Prefix
+	ipDenylist   []netip.Prefix
+	adminToken   atomic.Pointer[string]
+	// diskLow is set while a storage volume is below the free space watermark.
+	diskLow atomic.Bool
 	// Atomic flag to indicate if server is shutting down
 	// 0 = running, 1 = shutting down
 	shuttingDown int32
 }
 
-func NewServer(cfg *config.API, log *slog.Logger) (*Server, error) {
-	ctx := context.Background()
-
-	log.DebugContext(ctx, "Initializing database connection")
-	repo, err := database.NewRepository(cfg.Database, log)
+// NewServer creates the API server on the given backends; see the bootstrap package for wiring them
+// from the configuration.
+func NewServer(cfg *config.API, runtimeConfig *config.RuntimeWatcher, backends Backends, log *slog.Logger) (*Server, error) {
+	ipAllowlist, err := middleware.ParseCIDRs(cfg.Access.AllowCIDRs)
 	if err != nil {
-		return nil, fmt.Errorf("initialize database: %w", err)
+		return nil, fmt.Errorf("parse IP allowlist: %w", err)
 	}
 
-	log.DebugContext(ctx, "Initializing Redis queue connection")
-	q, err := queue.NewRedisQueue(cfg.Redis, log)
+	ipDenylist, err := middleware.ParseCIDRs(cfg.Access.DenyCIDRs)
 	if err != nil {
-		_ = repo.Close()
-		return nil, fmt.Errorf("initialize Redis queue: %w", err)
+		return nil, fmt.Errorf("parse IP denylist: %w", err)
 	}
 
-	log.DebugContext(ctx, "Initializing file store",
-		"upload_dir", cfg.Storage.UploadDir, "result_dir", cfg.Storage.ResultDir, "max_file_size", cfg.Storage.MaxFileSize)
-	fileStore, err := filestore.NewFileStore(
-		cfg.Storage.UploadDir,
-		cfg.Storage.ResultDir,
-		cfg.Storage.MaxFileSize,
-	)
-	if err != nil {
-		_ = repo.Close()
-		_ = q.Close()
-		return nil, fmt.Errorf("initialize file store: %w", err)
+	if err := createUploadTempDir(cfg.Uploads.TempDir); err != nil {
+		return nil, err
 	}
 
+	availability := slo.NewAvailabilityCounter(cfg.SLO.MaxWindow())
+
+	runtimeConfig.Subscribe(func(rt config.Runtime) {
+		backends.Files.SetMaxFileSize(rt.Storage.MaxFileSize)
+	})
+
 	server := &Server{
-		config:    cfg,
-		repo:      repo,
-		queue:     q,
-		fileStore: fileStore,
-		log:       log,
+		config:       cfg,
+		runtime:      runtimeConfig,
+		repo:         backends.Repo,
+		queue:        backends.Queue,
+		federation:   backends.Federation,
+		fileStore:    backends.Files,
+		log:          log,
+		sloTracker:   newSLOTracker(cfg.SLO, backends.Repo, availability, log),
+		availability: availability,
+		bandwidth:    newBandwidthAccumulator(),
+		eventBus:     backends.Events,
+		waiter:       backends.Waiter,
+		notifiers:    backends.Notifiers,
+		ipAllowlist:  ipAllowlist,
+		ipDenylist:   ipDenylist,
 	}
 
+	server.reconciler = reconcile.New(backends.Repo, backends.Files, reconcile.Config{
+		MinAge:        cfg.Reconcile.MinAge,
+		DeleteOrphans: cfg.Reconcile.DeleteOrphans,
+		Retention: func() time.Duration {
+			return runtimeConfig.Current().Storage.FileRetention.Duration
+		},
+		IgnorePrefixes: []string{failedQueueArchivePrefix, admintask.ExportFilePrefix},
+	}, log)
+
+	server.taskRunner = admintask.New(backends.Repo, backends.Queue, admintask.Config{
+		Concurrency: cfg.AdminTasks.Concurrency,
+		StaleAfter:  cfg.AdminTasks.StaleAfter,
+	}, log)
+	server.taskRunner.Register(batch.KindCancel, batch.NewCancelOperation(backends.Repo, backends.Events))
+	server.taskRunner.Register(batch.KindRetry,
+		batch.NewRetryOperation(backends.Repo, backends.Queue, backends.Events, log))
+	server.taskRunner.Register(admintask.KindExport,
+		admintask.NewExport(handlers.NewExport(backends.Repo, backends.Files, cfg.Uploads.TempDir, log), backends.Files))
+	server.taskRunner.Register(admintask.KindOrphanCleanup, admintask.NewOrphanCleanup(server.reconciler))
+	server.taskRunner.Register(admintask.KindReencryptFiles, admintask.NewReencrypt(backends.Files,
+		cfg.Encryption.Files && cfg.Encryption.ActiveKey != "", cfg.Reconcile.MinAge, log))
+	server.batchRunner = batch.New(server.taskRunner)
+
+	server.adminToken.Store(&cfg.AdminToken)
 	server.setupRoutes()
 
 	return server, nil
 }
 
+// healthChecker checks the database and Redis, which the API cannot serve without, and the queues
+// of remote regions, which only degrade it. Startup also waits for every migration to be applied.
+func (s *Server) healthChecker() *health.Checker {
+	checker := health.NewChecker("text-api", s.config.Health.CacheTTL, s.config.Health.CheckTimeout, s.log)
+	checker.Critical("database", s.repo.HealthCheck)
+	checker.Critical("redis", s.queue.HealthCheck)
+	if s.config.Disk.FreeWatermark > 0 {
+		checker.Critical("disk", s.diskSpaceCheck)
+	}
+	checker.Startup("migrations", func(ctx context.Context) error {
+		return s.repo.CheckMigrations(ctx, s.config.Database.MigrationsURL)
+	})
+
+	if s.federation != nil {
+		for _, region := range s.federation.Remotes() {
+			checker.Optional("region:"+region.Name, region.Queue.HealthCheck)
+		}
+	}
+	return checker
+}
+
+// createUploadTempDir creates the directory uploads, imports and exports spool their temporary
+// files to; an empty dir keeps the system default.
+func createUploadTempDir(dir string) error {
+	if dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create upload temp dir: %w", err)
+	}
+	return nil
+}
+
 func (s *Server) setupRoutes() {
 	mux := http.NewServeMux()
 
-	jobHandler := handlers.NewJob(s.repo, s.queue, s.fileStore, s.log)
-	healthHandler := handlers.NewHealth(s.repo, s.queue, s.log)
+	uploads := handlers.NewUploadLimiter(
+		s.config.Uploads.MaxConcurrentParses, s.config.Uploads.MemoryLimit, s.config.Uploads.TempDiskLimit, s.config.Uploads.TempDir,
+	)
+	var waiter handlers.JobWaiter
+	if s.waiter != nil {
+		waiter = s.waiter
+	}
+	jobHandler := handlers.NewJob(s.repo, s.queue, s.fileStore, s.eventBus, waiter, s.config.Server.LongPollMaxWait,
+		s.config.Server.ListStreamMaxDuration, s.tenantQuota, s.delayLimits, uploads,
+		handlers.NewUploadScanner(s.config.Uploads.ScanCommand, s.config.Uploads.ScanTimeout), s.log)
+	var regions handlers.Regions
+	if s.federation != nil {
+		regions = s.federation
+	}
+	healthHandler := handlers.NewHealth(s.repo, s.queue, regions, s.log)
+	sloHandler := handlers.NewSLO(s.sloTracker, s.log)
+	usageHandler := handlers.NewUsage(s.repo, s.log)
+	storageHandler := handlers.NewStorage(s.repo, s.tenantQuota, s.log)
+	exportHandler := handlers.NewExport(s.repo, s.fileStore, s.config.Uploads.TempDir, s.log)
+	importHandler := handlers.NewImport(s.repo, s.fileStore, s.config.Storage.MaxImportSize,
+		s.config.Storage.MaxImportEntrySize, s.config.Storage.MaxImportExtractedSize, s.config.Uploads.TempDir, s.log)
 
 	// Kubernetes-style health endpoints
-	mux.HandleFunc("GET /livez", healthHandler.Livez)
-	mux.HandleFunc("GET /readyz", healthHandler.Readyz)
-	mux.HandleFunc("GET /healthz", healthHandler.Livez) // Alias for livez
+	s.healthChecker().Register(mux)
 
 	mux.HandleFunc("GET /stats", healthHandler.Stats)
+	mux.HandleFunc("GET /version", version.Handler)
+
+	// Public status page for team dashboards, outside /api/ so the IP filter does not apply
+	statusHandler := handlers.NewStatus(s.repo, s.queue, s.log)
+	mux.HandleFunc("GET /statusz", statusHandler.Statusz)
+
+	// Generated Grafana dashboard and Prometheus alert rules
+	observabilityHandler := observability.NewHandler(s.log)
+	mux.HandleFunc("GET /dashboards", observabilityHandler.Dashboard)
+	mux.HandleFunc("GET /dashboards/alerts", observabilityHandler.AlertRules)
 
 	// Prometheus metrics endpoint
-	mux.Handle("GET /metrics", promhttp.Handler())
+	if s.config.Metrics.Exports(config.MetricsExporterPrometheus) {
+		mux.Handle("GET /metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{
+			// OpenMetrics is required to expose exemplars
+			EnableOpenMetrics: true,
+		}))
+	}
 
-	mux.HandleFunc("POST /api/v1/jobs", jobHandler.CreateJob)
-	mux.HandleFunc("GET /api/v1/jobs", jobHandler.ListJobs)
-	mux.HandleFunc("GET /api/v1/jobs/{id}", jobHandler.GetJob)
-	mux.HandleFunc("GET /api/v1/jobs/{id}/result", jobHandler.GetJobResult)
+	// Per-route deadlines: uploads may take longer than the server-wide read/write timeouts
+	requestTimeout := middleware.TimeoutMiddleware(s.config.Server.RequestTimeout)
+	uploadTimeout := middleware.TimeoutMiddleware(s.config.Server.UploadTimeout)
+	downloadTimeout := middleware.TimeoutMiddleware(s.config.Server.DownloadTimeout)
+	exportTimeout := middleware.TimeoutMiddleware(s.config.Server.ExportTimeout)
+	importTimeout := middleware.TimeoutMiddleware(s.config.Server.ImportTimeout)
+
+	// Uploads are rejected with 507 while a storage volume is low on space
+	diskSpace := middleware.DiskSpaceMiddleware(s.diskLow.Load)
+
+	// Per-route body limits: uploads follow the file size limit, which may change at runtime, and
+	// imports MAX_IMPORT_SIZE, which exceeds it
+	uploadBody := middleware.MaxRequestSizeMiddleware(func() int64 {
+		return handlers.MaxUploadSize(s.fileStore.GetMaxFileSize())
+	})
+	importBody := middleware.MaxRequestSizeMiddleware(func() int64 { return s.config.Storage.MaxImportSize })
+	jsonBody := middleware.MaxRequestSizeMiddleware(func() int64 { return maxJSONBody })
+
+	mux.Handle("POST /api/v1/jobs", diskSpace(uploadBody(uploadTimeout(http.HandlerFunc(jobHandler.CreateJob)))))
+	// NDJSON listings stream for up to LIST_STREAM_MAX_DURATION instead of the request timeout
+	listJobs := requestTimeout(http.HandlerFunc(jobHandler.ListJobs))
+	mux.HandleFunc("GET /api/v1/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if handlers.AcceptsNDJSON(r) {
+			jobHandler.ListJobs(w, r)
+			return
+		}
+		listJobs.ServeHTTP(w, r)
+	})
+	// Long-polling requests (?wait=30s) outlast the request timeout and extend their own deadline
+	getJob := requestTimeout(http.HandlerFunc(jobHandler.GetJob))
+	mux.HandleFunc("GET /api/v1/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("wait") {
+			jobHandler.GetJob(w, r)
+			return
+		}
+		getJob.ServeHTTP(w, r)
+	})
+	mux.Handle("PATCH /api/v1/jobs/{id}", requestTimeout(http.HandlerFunc(jobHandler.AnnotateJob)))
+	// Result files may be too large to stream within the request timeout
+	mux.Handle("GET /api/v1/jobs/{id}/result", downloadTimeout(http.HandlerFunc(jobHandler.GetJobResult)))
+	mux.Handle("GET /api/v1/jobs/{id}/results", requestTimeout(http.HandlerFunc(jobHandler.ListJobResults)))
+	mux.Handle("GET /api/v1/jobs/{id}/results/{version}", downloadTimeout(http.HandlerFunc(jobHandler.GetJobResultVersion)))
+	mux.Handle("POST /api/v1/jobs/{id}/boost", requestTimeout(http.HandlerFunc(jobHandler.BoostJob)))
+	// Event streams last until the job finishes and manage their own deadlines
+	mux.HandleFunc("GET /api/v1/jobs/{id}/events", jobHandler.StreamJob)
+
+	mux.Handle("GET /api/v1/slo", requestTimeout(http.HandlerFunc(sloHandler.GetSLO)))
+	mux.Handle("GET /api/v1/usage", requestTimeout(http.HandlerFunc(usageHandler.GetUsage)))
+	mux.Handle("GET /api/v1/storage/usage", requestTimeout(http.HandlerFunc(storageHandler.GetStorageUsage)))
+
+	// Operator endpoints, authenticated with the bearer token from ADMIN_TOKEN
+	adminAuth := middleware.AdminAuthMiddleware(func() string { return *s.adminToken.Load() })
+
+	// Effective configuration (secrets redacted)
+	mux.Handle("GET /debug/config", adminAuth(config.EffectiveConfigHandler(s.config.Redacted(), s.runtime)))
+	// Goroutines, memory and file descriptors, sampled by soak tests for leaks
+	mux.Handle("GET /debug/runtime", adminAuth(http.HandlerFunc(runtimestats.Handler)))
+
+	// Exports read and imports write the jobs of every tenant, bypassing the storage quota
+	mux.Handle("GET /api/v1/export", adminAuth(exportTimeout(http.HandlerFunc(exportHandler.Export))))
+	mux.Handle("POST /api/v1/import", adminAuth(diskSpace(importBody(importTimeout(http.HandlerFunc(importHandler.Import))))))
+
+	queueAdminHandler := handlers.NewQueueAdmin(s.queue, s.log)
+	mux.Handle("GET /api/v1/admin/queues/poison", adminAuth(requestTimeout(http.HandlerFunc(queueAdminHandler.ListPoisonMessages))))
+	mux.Handle("DELETE /api/v1/admin/queues/poison/{id}", adminAuth(requestTimeout(http.HandlerFunc(queueAdminHandler.DeletePoisonMessage))))
+
+	emailAdminHandler := handlers.NewEmailAdmin(s.queue, s.log)
+	mux.Handle("GET /api/v1/admin/emails/suppressed", adminAuth(requestTimeout(http.HandlerFunc(emailAdminHandler.ListSuppressed))))
+	mux.Handle("DELETE /api/v1/admin/emails/suppressed/{address}", adminAuth(requestTimeout(http.HandlerFunc(emailAdminHandler.DeleteSuppressed))))
+
+	processingAdminHandler := handlers.NewProcessingAdmin(s.queue, s.log)
+	mux.Handle("GET /api/v1/admin/processing", adminAuth(requestTimeout(http.HandlerFunc(processingAdminHandler.GetProcessing))))
+	mux.Handle("POST /api/v1/admin/processing", adminAuth(jsonBody(requestTimeout(http.HandlerFunc(processingAdminHandler.SetProcessing)))))
+
+	maintenanceAdminHandler := handlers.NewMaintenanceAdmin(s.queue, s.config.MaintenanceMode, s.log)
+	mux.Handle("GET /api/v1/admin/maintenance", adminAuth(requestTimeout(http.HandlerFunc(maintenanceAdminHandler.GetMaintenance))))
+	mux.Handle("POST /api/v1/admin/maintenance", adminAuth(jsonBody(requestTimeout(http.HandlerFunc(maintenanceAdminHandler.SetMaintenance)))))
+
+	// Stored files no job references and jobs whose files are missing
+	reconcileAdminHandler := handlers.NewReconcileAdmin(s.reconciler, s.config.Reconcile.DeleteOrphans, s.log)
+	mux.Handle("GET /api/v1/admin/files/reconcile", adminAuth(requestTimeout(http.HandlerFunc(reconcileAdminHandler.GetReport))))
+	mux.Handle("POST /api/v1/admin/files/reconcile", adminAuth(exportTimeout(http.HandlerFunc(reconcileAdminHandler.Reconcile))))
+
+	// Long maintenance operations, including bulk cancel and retry, run as admin tasks whose
+	// progress is polled
+	batchAdminHandler := handlers.NewBatchAdmin(s.batchRunner, s.log)
+	mux.Handle("POST /api/v1/jobs:batchCancel", adminAuth(requestTimeout(http.HandlerFunc(batchAdminHandler.BatchCancel))))
+	mux.Handle("POST /api/v1/jobs:batchRetry", adminAuth(requestTimeout(http.HandlerFunc(batchAdminHandler.BatchRetry))))
+	taskAdminHandler := handlers.NewTaskAdmin(s.taskRunner, s.repo, s.fileStore, s.log)
+	mux.Handle("GET /api/v1/admin/tasks", adminAuth(requestTimeout(http.HandlerFunc(taskAdminHandler.ListTasks))))
+	mux.Handle("POST /api/v1/admin/tasks", adminAuth(requestTimeout(http.HandlerFunc(taskAdminHandler.StartTask))))
+	mux.Handle("GET /api/v1/admin/tasks/{id}", adminAuth(requestTimeout(http.HandlerFunc(taskAdminHandler.GetTask))))
+	mux.Handle("POST /api/v1/admin/tasks/{id}/cancel", adminAuth(requestTimeout(http.HandlerFunc(taskAdminHandler.CancelTask))))
+	mux.Handle("GET /api/v1/admin/tasks/{id}/artifact", adminAuth(exportTimeout(http.HandlerFunc(taskAdminHandler.GetTaskArtifact))))
+
+	// Sends a test message to the Slack and Teams channels of the tenant
+	notificationsHandler := handlers.NewNotifications(s.notifiers, s.log)
+	mux.Handle("POST /api/v1/notifications/test", adminAuth(jsonBody(requestTimeout(http.HandlerFunc(notificationsHandler.Test)))))
+
+	// Recently failed requests; their headers and bodies may hold client data, hence the admin token
+	var capture *middleware.RequestCapture
+	if s.config.Capture.Enabled {
+		capture = middleware.NewRequestCapture(s.config.Capture.Size, s.config.Capture.BodyLimit)
+		mux.Handle("GET /debug/requests", adminAuth(http.HandlerFunc(capture.Handler)))
+	}
 
 	middlewareChain := middleware.Chain(
 		middleware.RecoveryMiddleware(s.log),
 		middleware.RequestIDMiddleware(),
-		middleware.LoggingMiddleware(s.log),
-		middleware.MetricsMiddleware(),
+		middleware.TraceContextMiddleware(),
+		middleware.TenantMiddleware(),
+		middleware.LoggingMiddleware(s.log, s.config.AccessLog.SlowThreshold, s.config.AccessLog.SampleRate),
+		middleware.RequestCaptureMiddleware(capture),
+		middleware.MetricsMiddleware(s.config.Metrics.TenantLabels, s.bandwidth),
+		middleware.AvailabilityMiddleware(s.availability),
+		middleware.IPFilterMiddleware(s.ipAllowlist, s.ipDenylist, s.config.Access.TrustForwardedFor),
+		middleware.RateLimitMiddleware(s.queue, s.config.Access.RateLimit, s.config.Access.RateLimitWindow,
+			s.config.Access.TrustForwardedFor, s.log),
+		middleware.ConcurrencyLimitMiddleware(s.config.Access.MaxInFlight),
+		middleware.MaintenanceMiddleware(s.queue, s.config.MaintenanceMode, s.log),
 		middleware.CORSMiddleware(),
 		middleware.SecurityHeadersMiddleware(),
-		middleware.MaxRequestSizeMiddleware(s.config.Storage.MaxFileSize),
+		middleware.CompressionMiddleware(),
 	)
 
 	s.httpServer = &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", s.config.Server.Host, s.config.Server.Port),
-		Handler:      middlewareChain(mux),
+		Handler:      middlewareChain(middleware.RoutePattern(mux)),
 		ReadTimeout:  s.config.Server.ReadTimeout,
 		WriteTimeout: s.config.Server.WriteTimeout,
 		IdleTimeout:  s.config.Server.IdleTimeout,
@@ -119,9 +368,40 @@ func (s *Server) Start(ctx context.Context) error {
 		"address", s.httpServer.Addr,
 		"upload_dir", s.config.Storage.UploadDir,
 		"result_dir", s.config.Storage.ResultDir,
-		"max_file_size", s.config.Storage.MaxFileSize,
+		"max_file_size", s.fileStore.GetMaxFileSize(),
 	)
 
+	if err := secrets.WatchFile(ctx, s.config.Database.PasswordFile, s.log, s.repo.RotatePassword); err != nil {
+		return fmt.Errorf("watch database password file: %w", err)
+	}
+
+	if err := secrets.WatchFile(ctx, s.config.Redis.PasswordFile, s.log, s.rotateRedisPassword); err != nil {
+		return fmt.Errorf("watch redis password file: %w", err)
+	}
+
+	if err := secrets.WatchFile(ctx, s.config.AdminTokenFile, s.log, s.rotateAdminToken); err != nil {
+		return fmt.Errorf("watch admin token file: %w", err)
+	}
+
+	go s.cleanupOldFiles(ctx)
+	go s.maintainPartitions(ctx)
+	go s.persistBandwidth(ctx)
+	if s.config.Disk.FreeWatermark > 0 {
+		go s.watchDisk(ctx)
+	}
+	if s.config.Reconcile.Interval > 0 {
+		go s.reconciler.Run(ctx, s.config.Reconcile.Interval)
+	}
+	go s.taskRunner.Run(ctx)
+	go s.queue.WatchMemory(ctx, s.config.Redis.MemoryWatermark, s.config.Redis.MemoryCheckInterval)
+	if s.config.FailedQueueMaxAge > 0 {
+		go s.expireFailedJobs(ctx)
+	}
+	if s.waiter != nil {
+		go s.waiter.Run(ctx)
+	}
+	go s.sloTracker.StartPeriodicEvaluation(ctx, s.config.SLO.EvaluationInterval)
+
 	errCh := make(chan error, 1)
 
 	go func() {
@@ -168,17 +448,36 @@ func (s *Server) shutdown(ctx context.Context) error {
 		s.log.InfoContext(shutdownCtx, "HTTP server stopped successfully")
 	}
 
-	// Step 2: Close Redis queue connection
+	// Step 2: Interrupt the admin tasks, which publish events and queue jobs, and queue them again
+	// for another replica
+	s.taskRunner.Close()
+
+	// Step 3: Flush pending events to sinks
+	if s.eventBus != nil {
+		s.log.InfoContext(shutdownCtx, "flushing event bus...")
+		s.eventBus.Close()
+	}
+
+	// Step 4: Persist the bandwidth of the last requests
+	s.flushBandwidth(shutdownCtx)
+
+	// Step 5: Close queue connection
 	if s.queue != nil {
-		s.log.InfoContext(shutdownCtx, "closing Redis connection...")
+		s.log.InfoContext(shutdownCtx, "closing queue connection...")
 		if err := s.queue.Close(); err != nil {
-			s.log.ErrorContext(shutdownCtx, "failed to close Redis connection", "error", err)
+			s.log.ErrorContext(shutdownCtx, "failed to close queue connection", "error", err)
 		} else {
-			s.log.InfoContext(shutdownCtx, "Redis connection closed successfully")
+			s.log.InfoContext(shutdownCtx, "queue connection closed successfully")
 		}
 	}
 
-	// Step 3: Close database connections
+	if s.federation != nil {
+		if err := s.federation.Close(); err != nil {
+			s.log.ErrorContext(shutdownCtx, "failed to close federated region connections", "error", err)
+		}
+	}
+
+	// Step 6: Close database connections
 	if s.repo != nil {
 		s.log.InfoContext(shutdownCtx, "closing database connections...")
 		if err := s.repo.Close(); err != nil {
@@ -192,6 +491,139 @@ func (s *Server) shutdown(ctx context.Context) error {
 	return nil
 }
 
+// rotateRedisPassword switches the local queue and, as they share credentials, the federated
+// regions to a new Redis password.
+func (s *Server) rotateRedisPassword(password string) {
+	s.queue.RotatePassword(password)
+	if s.federation != nil {
+		s.federation.RotatePassword(password)
+	}
+}
+
+// rotateAdminToken switches the admin endpoints to a new bearer token.
+func (s *Server) rotateAdminToken(token string) {
+	s.adminToken.Store(&token)
+	s.log.Info("admin token rotated")
+}
+
+// cleanupOldFiles periodically removes stored files older than the runtime-configured retention
+// and subtracts them from the tenants' storage usage, and quarantined uploads left behind.
+func (s *Server) cleanupOldFiles(ctx context.Context) {
+	ticker := time.NewTicker(fileCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if removed, err := s.fileStore.CleanupQuarantine(quarantineMaxAge); err != nil {
+				s.log.ErrorContext(ctx, "failed to clean up quarantined uploads", "error", err)
+			} else if removed > 0 {
+				s.log.InfoContext(ctx, "removed quarantined uploads left behind", "files", removed)
+			}
+
+			retention := s.runtime.Current().Storage.FileRetention.Duration
+			if retention <= 0 {
+				continue
+			}
+
+			s.log.DebugContext(ctx, "cleaning up old files", "retention", retention)
+			removed, err := s.fileStore.CleanupOldFiles(retention)
+			if err != nil {
+				s.log.ErrorContext(ctx, "failed to clean up old files", "error", err)
+			}
+			if len(removed) == 0 {
+				continue
+			}
+
+			// Files that are gone no longer count against their tenant's storage quota
+			if err := s.repo.ReleaseStorage(ctx, removed); err != nil {
+				s.log.ErrorContext(ctx, "failed to release storage of removed files", "error", err, "files", len(removed))
+			}
+		}
+	}
+}
+
+// maintainPartitions creates the upcoming monthly jobs partitions and drops the expired ones at
+// startup and then periodically, so inserts never run out of partitions.
+func (s *Server) maintainPartitions(ctx context.Context) {
+	ticker := time.NewTicker(partitionMaintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		cfg := s.config.Partitions
+		changes, err := s.repo.MaintainPartitions(ctx, time.Now().UTC(), cfg.Ahead, cfg.Retention)
+		if err != nil {
+			s.log.ErrorContext(ctx, "failed to maintain job partitions", "error", err)
+		}
+		if len(changes.Created) > 0 || len(changes.Dropped) > 0 {
+			s.log.InfoContext(ctx, "job partitions maintained", "created", changes.Created, "dropped", changes.Dropped)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expireFailedJobs periodically archives the failed queue messages older than the max age to JSONL
+// files in the result directory and removes them from the queue. Messages are put back when their
+// archive cannot be written.
+func (s *Server) expireFailedJobs(ctx context.Context) {
+	ticker := time.NewTicker(failedQueueExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := time.Now().Add(-s.config.FailedQueueMaxAge)
+		for {
+			expired, err := s.queue.PopExpiredFailed(ctx, cutoff, failedQueueExpiryBatch)
+			if err != nil {
+				s.log.ErrorContext(ctx, "failed to pop expired failed queue messages", "error", err)
+				break
+			}
+			if len(expired) == 0 {
+				break
+			}
+
+			name := fmt.Sprintf("%s%s-%s.jsonl", failedQueueArchivePrefix, time.Now().UTC().Format("20060102T150405Z"), uuid.NewString()[:8])
+			path, _, err := s.fileStore.CopyResultFile(name, strings.NewReader(strings.Join(expired, "\n")+"\n"))
+			if err != nil {
+				s.log.ErrorContext(ctx, "failed to archive expired failed queue messages", "error", err, "messages", len(expired))
+				if err := s.queue.RestoreFailed(ctx, expired); err != nil {
+					s.log.ErrorContext(ctx, "failed to restore expired failed queue messages", "error", err, "messages", expired)
+				}
+				break
+			}
+
+			metrics.FailedQueueExpiredTotal.Add(float64(len(expired)))
+			s.log.InfoContext(ctx, "archived expired failed queue messages", "messages", len(expired), "archive", path)
+
+			if len(expired) < failedQueueExpiryBatch {
+				break
+			}
+		}
+	}
+}
+
+// tenantQuota returns the runtime-configured per-tenant storage quota in bytes; zero means unlimited.
+func (s *Server) tenantQuota() int64 {
+	return s.runtime.Current().Storage.TenantQuota
+}
+
+// delayLimits returns the configured default and max delay_ms of a processing type.
+func (s *Server) delayLimits(processingType database.ProcessingType) (int, int) {
+	return s.config.Delays.Limits(string(processingType))
+}
+
 func (s *Server) HealthCheck(ctx context.Context) error {
 	if err := s.repo.HealthCheck(ctx); err != nil {
 		return fmt.Errorf("database health check failed: %w", err)
@@ -203,3 +635,25 @@ func (s *Server) HealthCheck(ctx context.Context) error {
 
 	return nil
 }
+
+func newSLOTracker(cfg config.SLO, repo Repository, availability *slo.AvailabilityCounter, log *slog.Logger) *slo.Tracker {
+	objectives := []slo.Objective{
+		{
+			Name:        "api_availability",
+			Description: "API requests served without a 5xx response",
+			Target:      cfg.APIAvailabilityTarget,
+			Source:      availability.Source(),
+		},
+		{
+			Name:        "job_latency",
+			Description: fmt.Sprintf("jobs completed successfully within %s", cfg.JobLatencyThreshold),
+			Target:      cfg.JobLatencyTarget,
+			Source: func(ctx context.Context, since time.Time) (int64, int64, error) {
+				total, within, err := repo.CountCompletedJobsWithin(ctx, since, cfg.JobLatencyThreshold)
+				return within, total, err
+			},
+		},
+	}
+
+	return slo.NewTracker(objectives, cfg.Windows, log)
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+const testAdminToken = "test-admin-token"
+
+// importRepository records imported jobs; the methods it does not implement are not reached.
+type importRepository struct {
+	Repository
+	jobs []*database.Job
+}
+
+func (r *importRepository) ImportJob(_ context.Context, job *database.Job) error {
+	r.jobs = append(r.jobs, job)
+	return nil
+}
+
+func (r *importRepository) AddStorageUsage(context.Context, string, database.StorageDelta) error {
+	return nil
+}
+
+// testQueue is never in maintenance and may be low on memory, which rejects job submissions once
+// they pass the middlewares.
+type testQueue struct {
+	Queue
+	memoryHigh bool
+}
+
+func (q *testQueue) GetMaintenance(context.Context) (bool, string, error) {
+	return false, "", nil
+}
+
+func (q *testQueue) MemoryHigh() bool {
+	return q.memoryHigh
+}
+
+// resultFiles stores result files in memory under a file size limit.
+type resultFiles struct {
+	FileStorage
+	maxFileSize int64
+	stored      map[string]int64
+}
+
+func (f *resultFiles) GetMaxFileSize() int64 {
+	return f.maxFileSize
+}
+
+func (f *resultFiles) SetMaxFileSize(maxSize int64) {
+	f.maxFileSize = maxSize
+}
+
+func (f *resultFiles) CopyResultFile(name string, content io.Reader) (string, int64, error) {
+	size, err := io.Copy(io.Discard, content)
+	if err != nil {
+		return "", 0, err
+	}
+	f.stored[name] = size
+	return name, size, nil
+}
+
+func (f *resultFiles) DeleteFile(filePath string) error {
+	delete(f.stored, filePath)
+	return nil
+}
+
+func newTestServer(t *testing.T, backends Backends, cfg *config.API) *Server {
+	t.Helper()
+
+	log := slog.New(slog.DiscardHandler)
+	runtimeConfig, err := config.Watch(t.Context(), "", config.Runtime{}, log)
+	require.NoError(t, err)
+
+	server, err := NewServer(cfg, runtimeConfig, backends, log)
+	require.NoError(t, err)
+	return server
+}
+
+func testConfig(t *testing.T) *config.API {
+	t.Helper()
+
+	return &config.API{
+		Server: config.Server{
+			RequestTimeout: time.Minute,
+			UploadTimeout:  time.Minute,
+			ImportTimeout:  time.Minute,
+		},
+		Storage: config.Storage{
+			MaxImportSize:          1 << 20,
+			MaxImportEntrySize:     1 << 20,
+			MaxImportExtractedSize: 1 << 20,
+		},
+		Uploads: config.Uploads{
+			MaxConcurrentParses: 1,
+			MemoryLimit:         1 << 20,
+			TempDiskLimit:       1 << 30,
+			TempDir:             t.TempDir(),
+		},
+		AdminToken: testAdminToken,
+	}
+}
+
+// exportArchive returns a tar.gz export of one succeeded job whose result holds resultSize random
+// bytes, which do not compress.
+func exportArchive(t *testing.T, resultSize int) []byte {
+	t.Helper()
+
+	record, err := json.Marshal(map[string]any{
+		"id":              "3f1c9a52-8f0e-4b7e-9a43-2c1d6b0e7f15",
+		"processing_type": "uppercase",
+		"status":          "succeeded",
+		"created_at":      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		"result_file":     "results/job.txt",
+	})
+	require.NoError(t, err)
+
+	result := make([]byte, resultSize)
+	_, _ = rand.Read(result)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range []struct {
+		name    string
+		content []byte
+	}{
+		{name: "results/job.txt", content: result},
+		{name: "jobs.jsonl", content: append(record, '\n')},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name: entry.name, Mode: 0o600, Size: int64(len(entry.content)), Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write(entry.content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestImportBodyLimit(t *testing.T) {
+	const maxFileSize = 64 << 10
+
+	tests := []struct {
+		name          string
+		maxImportSize int64
+		wantStatus    int
+		wantImported  int
+	}{
+		{
+			name:          "archive larger than the file size limit",
+			maxImportSize: 1 << 20,
+			wantStatus:    http.StatusOK,
+			wantImported:  1,
+		},
+		{
+			name:          "archive larger than the import size limit",
+			maxImportSize: maxFileSize,
+			wantStatus:    http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &importRepository{}
+			files := &resultFiles{maxFileSize: maxFileSize, stored: make(map[string]int64)}
+			cfg := testConfig(t)
+			cfg.Storage.MaxImportSize = tt.maxImportSize
+			server := newTestServer(t, Backends{Repo: repo, Queue: &testQueue{}, Files: files}, cfg)
+			archive := exportArchive(t, 4*maxFileSize)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/import?format=tar.gz", bytes.NewReader(archive))
+			req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			rec := httptest.NewRecorder()
+
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			assert.Len(t, repo.jobs, tt.wantImported)
+			assert.Len(t, files.stored, tt.wantImported)
+		})
+	}
+}
+
+func TestUploadBodyLimit(t *testing.T) {
+	const maxFileSize = 64 << 10
+
+	tests := []struct {
+		name       string
+		fileSizes  []int
+		wantStatus int
+	}{
+		{
+			name:       "two files within the file size limit",
+			fileSizes:  []int{maxFileSize, maxFileSize},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "body larger than two files and the form",
+			fileSizes:  []int{maxFileSize, maxFileSize, 1 << 20},
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := &resultFiles{maxFileSize: maxFileSize}
+			// The queue being low on memory rejects submissions that pass the body limit
+			server := newTestServer(t, Backends{Repo: &importRepository{}, Queue: &testQueue{memoryHigh: true}, Files: files}, testConfig(t))
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			require.NoError(t, form.WriteField("processing_type", "diff"))
+			for i, size := range tt.fileSizes {
+				part, err := form.CreateFormFile(fmt.Sprintf("file%d", i+1), fmt.Sprintf("file%d.txt", i+1))
+				require.NoError(t, err)
+				_, err = part.Write(bytes.Repeat([]byte("a"), size))
+				require.NoError(t, err)
+			}
+			require.NoError(t, form.Close())
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+			rec := httptest.NewRecorder()
+
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestDebugRuntimeAdminAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "admin token", token: testAdminToken, wantStatus: http.StatusOK},
+		{name: "wrong token", token: "other", wantStatus: http.StatusUnauthorized},
+		{name: "no token", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := &resultFiles{}
+			server := newTestServer(t, Backends{Repo: &importRepository{}, Queue: &testQueue{}, Files: files}, testConfig(t))
+			req := httptest.NewRequest(http.MethodGet, "/debug/runtime", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+
+			server.httpServer.Handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
@@ -0,0 +1,325 @@
+// Package batch cancels and retries the jobs matching a filter as admin tasks, which the admintask
+// runner of any replica runs in the background and records the progress of.
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/admintask"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+const (
+	// pageSize is how many jobs are changed per query.
+	pageSize = 500
+	// eventSource is the source of the events of changed jobs, which are changed by the API.
+	eventSource = "text-api"
+)
+
+// Kinds of batch tasks.
+const (
+	KindCancel = "batch_cancel"
+	KindRetry  = "batch_retry"
+)
+
+type (
+	// Repository selects and changes the jobs of batch tasks.
+	Repository interface {
+		CountBatchJobs(ctx context.Context, filter database.BatchFilter) (int64, error)
+		ListBatchJobs(ctx context.Context, filter database.BatchFilter) ([]*database.Job, error)
+		CancelJobs(ctx context.Context, ids []uuid.UUID, reason string) ([]*database.Job, error)
+		RequeueJobs(ctx context.Context, ids []uuid.UUID, statuses []database.JobStatus) ([]*database.Job, error)
+		UpdateError(ctx context.Context, id uuid.UUID, errorMessage string) error
+	}
+
+	// Queue queues retried jobs again.
+	Queue interface {
+		PublishJob(ctx context.Context, message queue.SubmitJobMessage) error
+		ResetJobDelivery(ctx context.Context, jobID uuid.UUID) error
+	}
+
+	// EventPublisher publishes the events of canceled and retried jobs.
+	EventPublisher interface {
+		Publish(ctx context.Context, event events.Event)
+	}
+
+	// TaskStarter records admin tasks and queues them to run in the background.
+	TaskStarter interface {
+		Start(ctx context.Context, kind string, params database.JSONB) (*database.AdminTask, error)
+	}
+)
+
+// Runner starts batch tasks on the admin task runner, with which CancelOperation and
+// RetryOperation are registered for KindCancel and KindRetry.
+type Runner struct {
+	tasks TaskStarter
+}
+
+func New(tasks TaskStarter) *Runner {
+	return &Runner{tasks: tasks}
+}
+
+// Cancel starts a task canceling the pending jobs matching the filter in params. It fails with
+// admintask.ErrInvalidParams before recording anything when the filter is invalid.
+func (r *Runner) Cancel(ctx context.Context, params database.JSONB) (*database.AdminTask, error) {
+	return r.tasks.Start(ctx, KindCancel, params)
+}
+
+// Retry starts a task queueing the jobs matching the filter in params again. Jobs that are pending
+// or running by the time their page is reached are left alone.
+func (r *Runner) Retry(ctx context.Context, params database.JSONB) (*database.AdminTask, error) {
+	return r.tasks.Start(ctx, KindRetry, params)
+}
+
+// filterParams are the params of batch tasks. Every set criterion must match: the status, the
+// creation range [from, to), a label selector such as "team=ops,!reviewed", the tenant and the
+// processing type.
+type filterParams struct {
+	Status         []database.JobStatus `json:"status,omitempty"`
+	From           *time.Time           `json:"from,omitempty"`
+	To             *time.Time           `json:"to,omitempty"`
+	Labels         string               `json:"labels,omitempty"`
+	TenantID       string               `json:"tenant_id,omitempty"`
+	ProcessingType string               `json:"processing_type,omitempty"`
+}
+
+// prepareFilter validates the params of a batch task, whose statuses must be among allowed and
+// default to defaults. A filter must set at least one criterion besides the status, so that a
+// mistyped request does not change every job.
+func prepareFilter(params database.JSONB, allowed, defaults []database.JobStatus) (database.JSONB, error) {
+	var p filterParams
+	if err := admintask.DecodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Status) == 0 {
+		p.Status = defaults
+	}
+	for _, status := range p.Status {
+		if !slices.Contains(allowed, status) {
+			return nil, fmt.Errorf("status must be one of %v", allowed)
+		}
+	}
+	if p.From == nil && p.To == nil && p.Labels == "" && p.TenantID == "" && p.ProcessingType == "" {
+		return nil, errors.New("set at least one of from, to, labels, tenant_id or processing_type")
+	}
+	if _, err := p.filter(); err != nil {
+		return nil, err
+	}
+	return admintask.EncodeParams(p)
+}
+
+// taskFilter returns the filter of the prepared params of a batch task.
+func taskFilter(params database.JSONB) (database.BatchFilter, error) {
+	var p filterParams
+	if err := admintask.DecodeParams(params, &p); err != nil {
+		return database.BatchFilter{}, err
+	}
+	return p.filter()
+}
+
+func (p filterParams) filter() (database.BatchFilter, error) {
+	filter := database.BatchFilter{
+		Statuses: p.Status,
+		TenantID: p.TenantID,
+		Limit:    pageSize,
+	}
+
+	if p.From != nil {
+		filter.From = *p.From
+	}
+	if p.To != nil {
+		filter.To = *p.To
+	}
+	if p.From != nil && p.To != nil && !p.From.Before(*p.To) {
+		return filter, errors.New("from must be before to")
+	}
+
+	labels, err := database.ParseLabelSelector(p.Labels)
+	if err != nil {
+		return filter, err
+	}
+	filter.Labels = labels
+
+	if p.ProcessingType != "" {
+		processingType, ok := database.ToProcessingType(p.ProcessingType)
+		if !ok {
+			return filter, fmt.Errorf("invalid processing type %q", p.ProcessingType)
+		}
+		filter.ProcessingType = processingType
+	}
+
+	return filter, nil
+}
+
+// forEachPage calls change with the IDs of the jobs matching the filter a page at a time and
+// counts the jobs it did not change as failed, such as jobs whose status changed since they were
+// counted. Jobs created meanwhile may still match and are changed too.
+func forEachPage(
+	ctx context.Context, repo Repository, filter database.BatchFilter, progress *admintask.Progress,
+	change func(ctx context.Context, ids []uuid.UUID) (int, error),
+) error {
+	total, err := repo.CountBatchJobs(ctx, filter)
+	if err != nil {
+		return err
+	}
+	progress.SetTotal(total)
+
+	for {
+		jobs, err := repo.ListBatchJobs(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+
+		ids := make([]uuid.UUID, len(jobs))
+		for i, job := range jobs {
+			ids[i] = job.ID
+		}
+
+		changed, err := change(ctx, ids)
+		progress.Add(int64(changed), int64(len(jobs)-changed))
+		if err != nil {
+			return err
+		}
+
+		last := jobs[len(jobs)-1]
+		filter.After, filter.AfterID = last.CreatedAt, last.ID
+	}
+}
+
+// CancelOperation cancels the pending jobs matching a filter. Workers skip canceled jobs they
+// consume later.
+type CancelOperation struct {
+	repo   Repository
+	events EventPublisher
+}
+
+func NewCancelOperation(repo Repository, publisher EventPublisher) *CancelOperation {
+	return &CancelOperation{repo: repo, events: publisher}
+}
+
+// Prepare only accepts the pending status, which it defaults to.
+func (co *CancelOperation) Prepare(params database.JSONB) (database.JSONB, error) {
+	pending := []database.JobStatus{database.JobStatusPending}
+	return prepareFilter(params, pending, pending)
+}
+
+func (co *CancelOperation) Run(ctx context.Context, task *database.AdminTask, progress *admintask.Progress) (database.JSONB, error) {
+	filter, err := taskFilter(task.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := fmt.Sprintf("canceled by task %s", task.ID)
+	return nil, forEachPage(ctx, co.repo, filter, progress, func(ctx context.Context, ids []uuid.UUID) (int, error) {
+		canceled, err := co.repo.CancelJobs(ctx, ids, reason)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, job := range canceled {
+			event := events.New(events.JobCanceled, job.ID, eventSource, map[string]any{
+				"task_id": task.ID,
+			})
+			event.TenantID = job.TenantID
+			co.events.Publish(ctx, event)
+		}
+		return len(canceled), nil
+	})
+}
+
+// RetryOperation queues the failed or canceled jobs matching a filter again.
+type RetryOperation struct {
+	repo   Repository
+	queue  Queue
+	events EventPublisher
+	log    *slog.Logger
+}
+
+func NewRetryOperation(repo Repository, q Queue, publisher EventPublisher, log *slog.Logger) *RetryOperation {
+	return &RetryOperation{repo: repo, queue: q, events: publisher, log: log}
+}
+
+// Prepare accepts the failed and canceled statuses, by default both.
+func (ro *RetryOperation) Prepare(params database.JSONB) (database.JSONB, error) {
+	retryable := []database.JobStatus{database.JobStatusFailed, database.JobStatusCanceled}
+	return prepareFilter(params, retryable, retryable)
+}
+
+// Run makes the jobs that are still of one of the statuses pending and queues them again. A job
+// that cannot be queued fails again with the queue error; the task stops if Redis is out of memory,
+// failing the rest of the page with the same error, since those jobs are pending already but were
+// never queued and would otherwise be stuck.
+func (ro *RetryOperation) Run(ctx context.Context, task *database.AdminTask, progress *admintask.Progress) (database.JSONB, error) {
+	filter, err := taskFilter(task.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, forEachPage(ctx, ro.repo, filter, progress, func(ctx context.Context, ids []uuid.UUID) (int, error) {
+		requeued, err := ro.repo.RequeueJobs(ctx, ids, filter.Statuses)
+		if err != nil {
+			return 0, err
+		}
+
+		var queued int
+		for i, job := range requeued {
+			if err := ro.requeue(ctx, job); err != nil {
+				if errors.Is(err, queue.ErrMemoryHigh) || ctx.Err() != nil {
+					for _, job := range requeued[i:] {
+						ro.fail(ctx, job, err)
+					}
+					return queued, err
+				}
+				ro.fail(ctx, job, err)
+				continue
+			}
+			queued++
+
+			event := events.New(events.JobRetried, job.ID, eventSource, map[string]any{
+				"task_id":         task.ID,
+				"processing_type": job.ProcessingType,
+			})
+			event.TenantID = job.TenantID
+			ro.events.Publish(ctx, event)
+		}
+		return queued, nil
+	})
+}
+
+// fail fails a retried job again with the error it could not be queued with.
+func (ro *RetryOperation) fail(ctx context.Context, job *database.Job, err error) {
+	ro.log.ErrorContext(ctx, "failed to queue retried job", "error", err, "job_id", job.ID)
+	if updateErr := ro.repo.UpdateError(context.WithoutCancel(ctx), job.ID, "failed to queue retried job: "+err.Error()); updateErr != nil {
+		ro.log.ErrorContext(ctx, "failed to record retry error", "error", updateErr, "job_id", job.ID)
+	}
+}
+
+func (ro *RetryOperation) requeue(ctx context.Context, job *database.Job) error {
+	if err := ro.queue.ResetJobDelivery(ctx, job.ID); err != nil {
+		return err
+	}
+	return ro.queue.PublishJob(ctx, queue.SubmitJobMessage{
+		JobID:          job.ID,
+		TenantID:       job.TenantID,
+		FilePath:       job.FilePath,
+		SecondFilePath: job.SecondFilePath,
+		ProcessingType: job.ProcessingType,
+		Parameters:     map[string]any(job.Parameters),
+		Priority:       1,
+		DelayMS:        job.DelayMS,
+
+		OriginalFilename:       job.OriginalFilename,
+		SecondOriginalFilename: job.SecondOriginalFilename,
+	})
+}
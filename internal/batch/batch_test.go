@@ -0,0 +1,88 @@
+package batch
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rsav/k8s-learning/internal/admintask"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+// pageRepository lists one page of jobs and records the jobs failed again.
+type pageRepository struct {
+	Repository
+	jobs   []*database.Job
+	listed bool
+	failed map[uuid.UUID]string
+}
+
+func (r *pageRepository) CountBatchJobs(context.Context, database.BatchFilter) (int64, error) {
+	return int64(len(r.jobs)), nil
+}
+
+func (r *pageRepository) ListBatchJobs(context.Context, database.BatchFilter) ([]*database.Job, error) {
+	if r.listed {
+		return nil, nil
+	}
+	r.listed = true
+	return r.jobs, nil
+}
+
+func (r *pageRepository) RequeueJobs(context.Context, []uuid.UUID, []database.JobStatus) ([]*database.Job, error) {
+	return r.jobs, nil
+}
+
+func (r *pageRepository) UpdateError(_ context.Context, id uuid.UUID, errorMessage string) error {
+	r.failed[id] = errorMessage
+	return nil
+}
+
+// memoryQueue accepts capacity jobs and then fails with queue.ErrMemoryHigh.
+type memoryQueue struct {
+	capacity  int
+	published []uuid.UUID
+}
+
+func (q *memoryQueue) PublishJob(_ context.Context, message queue.SubmitJobMessage) error {
+	if len(q.published) == q.capacity {
+		return queue.ErrMemoryHigh
+	}
+	q.published = append(q.published, message.JobID)
+	return nil
+}
+
+func (q *memoryQueue) ResetJobDelivery(context.Context, uuid.UUID) error {
+	return nil
+}
+
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(context.Context, events.Event) {}
+
+func TestRetryOperationMemoryHigh(t *testing.T) {
+	repo := &pageRepository{failed: make(map[uuid.UUID]string)}
+	for range 5 {
+		repo.jobs = append(repo.jobs, &database.Job{ID: uuid.New(), ProcessingType: database.ProcessingTypeUppercase})
+	}
+	q := &memoryQueue{capacity: 2}
+	operation := NewRetryOperation(repo, q, discardPublisher{}, slog.New(slog.DiscardHandler))
+	params, err := operation.Prepare(database.JSONB{"tenant_id": "default"})
+	require.NoError(t, err)
+
+	_, err = operation.Run(t.Context(), &database.AdminTask{ID: uuid.New(), Params: params}, &admintask.Progress{})
+
+	require.ErrorIs(t, err, queue.ErrMemoryHigh)
+	assert.Equal(t, []uuid.UUID{repo.jobs[0].ID, repo.jobs[1].ID}, q.published)
+	// Jobs made pending but never queued fail again instead of staying pending
+	assert.Len(t, repo.failed, 3)
+	for _, job := range repo.jobs[2:] {
+		assert.Contains(t, repo.failed[job.ID], queue.ErrMemoryHigh.Error())
+	}
+}
@@ -0,0 +1,135 @@
+// Package bootstrap wires the services to their backends from the configuration, so alternative
+// stores, queues and file storage plug in here without changes to the services themselves.
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/rsav/k8s-learning/internal/api"
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/encryption"
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/federation"
+	"github.com/rsav/k8s-learning/internal/notifier"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+// APIServer connects to Postgres, Redis and the local file store and creates the API server on
+// them.
+func APIServer(cfg *config.API, runtimeConfig *config.RuntimeWatcher, log *slog.Logger) (*api.Server, error) {
+	backends, err := APIBackends(cfg, runtimeConfig, log)
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := api.NewServer(cfg, runtimeConfig, backends, log)
+	if err != nil {
+		closeBackends(backends)
+		return nil, err
+	}
+	return server, nil
+}
+
+// APIBackends connects to the backends of the API server.
+func APIBackends(cfg *config.API, runtimeConfig *config.RuntimeWatcher, log *slog.Logger) (api.Backends, error) {
+	ctx := context.Background()
+
+	queueKeys, err := encryption.FromConfig(cfg.Encryption, cfg.Encryption.Queue)
+	if err != nil {
+		return api.Backends{}, fmt.Errorf("initialize queue encryption: %w", err)
+	}
+	fileKeys, err := encryption.FromConfig(cfg.Encryption, cfg.Encryption.Files)
+	if err != nil {
+		return api.Backends{}, fmt.Errorf("initialize file encryption: %w", err)
+	}
+
+	log.DebugContext(ctx, "Initializing database connection")
+	repo, err := database.NewRepository(cfg.Database, log)
+	if err != nil {
+		return api.Backends{}, fmt.Errorf("initialize database: %w", err)
+	}
+
+	log.DebugContext(ctx, "Initializing Redis queue connection")
+	q, err := queue.NewRedisQueue(cfg.Redis, log)
+	if err != nil {
+		_ = repo.Close()
+		return api.Backends{}, fmt.Errorf("initialize Redis queue: %w", err)
+	}
+	q.SetKeyring(queueKeys)
+
+	backends := api.Backends{Repo: repo, Queue: q}
+
+	// Jobs are always published locally; other regions are only read for stats
+	if cfg.Federation.Enabled() {
+		log.DebugContext(ctx, "Initializing queue federation", "region", cfg.Federation.Region)
+		fed, err := federation.New(cfg.Federation, cfg.Redis, q, log)
+		if err != nil {
+			closeBackends(backends)
+			return api.Backends{}, fmt.Errorf("initialize queue federation: %w", err)
+		}
+		backends.Federation = fed
+	}
+
+	log.DebugContext(ctx, "Initializing file store",
+		"upload_dir", cfg.Storage.UploadDir, "result_dir", cfg.Storage.ResultDir, "max_file_size", cfg.Storage.MaxFileSize)
+	fileStore, err := filestore.NewFileStore(
+		cfg.Storage.UploadDir,
+		cfg.Storage.ResultDir,
+		runtimeConfig.Current().Storage.MaxFileSize,
+	)
+	if err != nil {
+		closeBackends(backends)
+		return api.Backends{}, fmt.Errorf("initialize file store: %w", err)
+	}
+	fileStore.SetKeyring(fileKeys)
+	backends.Files = fileStore
+
+	log.DebugContext(ctx, "Initializing event bus", "sinks", cfg.Events.Sinks)
+	notifiers, err := notifier.FromConfig(cfg.Events, log)
+	if err != nil {
+		closeBackends(backends)
+		return api.Backends{}, fmt.Errorf("initialize notifiers: %w", err)
+	}
+	sinks := make([]events.Sink, 0, len(notifiers))
+	for _, n := range notifiers {
+		sinks = append(sinks, n)
+		backends.Notifiers = append(backends.Notifiers, n)
+	}
+
+	eventBus, err := events.NewBusFromConfig(cfg.Events, cfg.Redis, log, sinks...)
+	if err != nil {
+		for _, sink := range sinks {
+			_ = sink.Close()
+		}
+		closeBackends(backends)
+		return api.Backends{}, fmt.Errorf("initialize event bus: %w", err)
+	}
+	backends.Events = eventBus
+
+	// Workers announce finished jobs on the Redis channel, which long-polling requests wait on
+	if cfg.Events.Enabled(config.EventSinkRedis) {
+		backends.Waiter = events.NewWaiter(cfg.Redis, cfg.Events.RedisChannel, log)
+	}
+
+	return backends, nil
+}
+
+// closeBackends closes the backends connected so far.
+func closeBackends(backends api.Backends) {
+	if backends.Events != nil {
+		backends.Events.Close()
+	}
+	if backends.Federation != nil {
+		_ = backends.Federation.Close()
+	}
+	if backends.Queue != nil {
+		_ = backends.Queue.Close()
+	}
+	if backends.Repo != nil {
+		_ = backends.Repo.Close()
+	}
+}
@@ -1,84 +1,1451 @@
 package config
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"net"
+	"net/mail"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/rsav/k8s-learning/internal/secrets"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 type API struct {
-	Server   Server
-	Database Database
-	Redis    Redis
-	Storage  Storage
-	Logging  Logging
+	Server     Server
+	Database   Database
+	Redis      Redis
+	Storage    Storage
+	Encryption Encryption
+	Delays     Delays
+	Logging    Logging
+	AccessLog  AccessLog
+	SLO        SLO
+	Events     Events
+	Secrets    Secrets
+	Access     Access
+	Federation Federation
+	Uploads    Uploads
+	Health     Health
+	Startup    Startup
+	Migrations Migrations
+	Partitions Partitions
+	Reconcile  FileReconcile
+	AdminTasks AdminTasks
+	Disk       DiskGuard
+	Metrics    Metrics
+	Capture    RequestCapture
+	// AdminToken enables the /api/v1/admin endpoints for requests carrying it as a bearer token.
+	// ADMIN_TOKEN_FILE takes precedence and is reloaded when it changes.
+	AdminToken     string `envconfig:"ADMIN_TOKEN"`
+	AdminTokenFile string `envconfig:"ADMIN_TOKEN_FILE"`
+	// RuntimeConfigFile points to a ConfigMap-mounted file with hot-reloadable settings.
+	RuntimeConfigFile string `envconfig:"RUNTIME_CONFIG_FILE"`
+	// MaintenanceMode rejects mutating API requests with 503; POST /api/v1/admin/maintenance
+	// switches the same mode for every replica at runtime.
+	MaintenanceMode bool `envconfig:"MAINTENANCE_MODE"`
+	// FailedQueueMaxAge archives failed queue messages older than this to a JSONL file in the result
+	// directory and removes them from the queue; zero keeps them until retried or removed.
+	FailedQueueMaxAge time.Duration `envconfig:"FAILED_QUEUE_MAX_AGE" default:"0"`
 }
 
 type Worker struct {
-	Database       Database
-	Redis          Redis
-	Storage        Storage
-	Logging        Logging
-	WorkerID       string        `envconfig:"WORKER_ID"`
-	ConcurrentJobs int           `envconfig:"CONCURRENT_JOBS" default:"5"`
-	PollInterval   time.Duration `envconfig:"POLL_INTERVAL" default:"5s"`
-	MetricsPort    int           `envconfig:"METRICS_PORT" default:"8080"`
+	Database   Database
+	Redis      Redis
+	Storage    Storage
+	Encryption Encryption
+	Delays     Delays
+	Logging    Logging
+	Events     Events
+	Secrets    Secrets
+	Exec       Exec
+	Plugins    Plugins
+	Health     Health
+	Startup    Startup
+	Metrics    Metrics
+	Email      Email
+	Sinks      ResultSinks
+	WorkerID   string `envconfig:"WORKER_ID"`
+	// ProcessingTypes restricts the worker to jobs of these types; empty consumes every built-in
+	// type and loaded plugin. The controller scales each worker Deployment by the backlog of its types.
+	ProcessingTypes []string `envconfig:"PROCESSING_TYPES"`
+	// PriorityOnly makes the worker consume only priority queues, as part of the burst pool the
+	// controller scales from zero when the priority backlog builds up.
+	PriorityOnly bool `envconfig:"PRIORITY_ONLY" default:"false"`
+	// WorkStealing lets a worker whose own queues are empty take jobs from the queues of other
+	// processing types it can process, the most backlogged first, so that capacity is not stranded
+	// when the job mix shifts. StealTypes restricts the types it steals from; empty steals from every
+	// built-in type and loaded plugin the worker can process.
+	WorkStealing   bool     `envconfig:"WORK_STEALING" default:"false"`
+	StealTypes     []string `envconfig:"STEAL_TYPES"`
+	ConcurrentJobs int      `envconfig:"CONCURRENT_JOBS" default:"5"`
+	// ConsumeBatchSize is how many jobs the worker pops from Redis at most in one round trip, bounded
+	// by its free job slots, and claims together. 1 consumes one job at a time.
+	ConsumeBatchSize int           `envconfig:"CONSUME_BATCH_SIZE" default:"1"`
+	PollInterval     time.Duration `envconfig:"POLL_INTERVAL" default:"5s"`
+	MetricsPort      int           `envconfig:"METRICS_PORT" default:"8080"`
+	// HeartbeatInterval is how often the worker records in Redis that it is alive, which the
+	// no_heartbeat alert of the controller watches.
+	HeartbeatInterval time.Duration `envconfig:"HEARTBEAT_INTERVAL" default:"15s"`
+	// ClaimLease bounds how long a job claimed in the idempotency ledger stays claimed while it is
+	// processed, after which a redelivery of a job whose worker died is processed again. Processed
+	// jobs stay claimed for ClaimTTL, during which further deliveries are dropped as duplicates.
+	ClaimLease time.Duration `envconfig:"CLAIM_LEASE" default:"15m"`
+	ClaimTTL   time.Duration `envconfig:"CLAIM_TTL" default:"24h"`
+	// MaxDeliveries is how often a job may be delivered to workers before further deliveries are
+	// quarantined in the poison queue instead of processed.
+	MaxDeliveries int64 `envconfig:"MAX_DELIVERIES" default:"3"`
+	// JobTimeout bounds how long a job may be processed; zero leaves it unbounded. A failed job is
+	// processed again up to MaxRetries times, after RetryDelay, which the exponential RetryBackoff
+	// doubles after every attempt. Per-type worker Deployments set them for their processing types.
+	JobTimeout   time.Duration `envconfig:"JOB_TIMEOUT" default:"0"`
+	MaxRetries   int           `envconfig:"MAX_RETRIES" default:"0"`
+	RetryBackoff string        `envconfig:"RETRY_BACKOFF" default:"exponential"`
+	RetryDelay   time.Duration `envconfig:"RETRY_DELAY" default:"1s"`
+	// ResultOverwritePolicy decides what happens to the result of an earlier attempt of a job:
+	// version writes every attempt to its own result_<job_id>.v<attempt> file, all of them listed
+	// by the API with the latest canonical, while overwrite replaces the single result_<job_id> file.
+	ResultOverwritePolicy string `envconfig:"RESULT_OVERWRITE_POLICY" default:"version"`
+	// FaultInjection honors the fail_probability and fail_stage parameters of jobs, which fail
+	// processing attempts on purpose to exercise retries, the failed queue and alerts. It is meant for
+	// test environments and must stay off in production.
+	FaultInjection bool `envconfig:"FAULT_INJECTION" default:"false"`
+	// AdminToken enables the /admin endpoints of the metrics server for requests carrying it as a
+	// bearer token. ADMIN_TOKEN_FILE takes precedence and is reloaded when it changes.
+	AdminToken     string `envconfig:"ADMIN_TOKEN"`
+	AdminTokenFile string `envconfig:"ADMIN_TOKEN_FILE"`
+	// RuntimeConfigFile points to a ConfigMap-mounted file with hot-reloadable settings.
+	RuntimeConfigFile string `envconfig:"RUNTIME_CONFIG_FILE"`
 }
 
+// Retry backoff policies of failed jobs.
+const (
+	RetryBackoffFixed       = "fixed"
+	RetryBackoffExponential = "exponential"
+)
+
+// MaxRetryDelay caps the exponential backoff between the attempts of a failed job.
+const MaxRetryDelay = time.Minute
+
+// Policies for the results of jobs processed more than once.
+const (
+	ResultPolicyVersion   = "version"
+	ResultPolicyOverwrite = "overwrite"
+)
+
 type Controller struct {
 	Redis                     Redis
 	Logging                   Logging
+	Events                    Events
+	Secrets                   Secrets
+	Federation                Federation
+	Health                    Health
+	Startup                   Startup
+	Metrics                   Metrics
+	Alerts                    Alerts
 	ReconcileInterval         time.Duration `envconfig:"RECONCILE_INTERVAL" default:"30s"`
 	MetricsCollectionInterval time.Duration `envconfig:"METRICS_COLLECTION_INTERVAL" default:"15s"`
+	// WorkerNamespaces and WorkerSelector select the worker Deployments scaled by the controller;
+	// a non-empty WorkerDeployments narrows them down to the listed names. The namespaces need not
+	// be the one the controller runs in.
+	WorkerNamespaces  []string `envconfig:"WORKER_NAMESPACES" default:"k8s-learning"`
+	WorkerSelector    string   `envconfig:"WORKER_SELECTOR" default:"app=worker"`
+	WorkerDeployments []string `envconfig:"WORKER_DEPLOYMENTS"`
+	// EventsDeployment is the Deployment in the first worker namespace that job events are recorded on.
+	EventsDeployment string `envconfig:"EVENTS_DEPLOYMENT" default:"worker"`
+	// ReactiveScaling evaluates scaling as soon as jobs are enqueued, at most once per
+	// ScaleTriggerDebounce, on top of the periodic reconciliation.
+	ReactiveScaling      bool          `envconfig:"REACTIVE_SCALING" default:"true"`
+	ScaleTriggerDebounce time.Duration `envconfig:"SCALE_TRIGGER_DEBOUNCE" default:"5s"`
+	// CapacityGuard caps scale-ups to the worker pods the cluster's allocatable capacity can schedule.
+	CapacityGuard bool `envconfig:"CAPACITY_GUARD" default:"true"`
+	// DryRun logs and records scaling decisions without patching Deployments.
+	DryRun bool `envconfig:"DRY_RUN" default:"false"`
+	// ScalingHistorySize is the number of recent scaling decisions kept in Redis.
+	ScalingHistorySize int64 `envconfig:"SCALING_HISTORY_SIZE" default:"1000"`
+	// ResourceRecommendations samples worker CPU and memory usage from metrics-server every
+	// RecommendationInterval and recommends container requests and limits from the usage seen
+	// within RecommendationWindow, padded by RecommendationMargin. AutoApplyResources also writes
+	// them to the worker pod templates, which rolls the workers.
+	ResourceRecommendations bool          `envconfig:"RESOURCE_RECOMMENDATIONS" default:"true"`
+	RecommendationInterval  time.Duration `envconfig:"RECOMMENDATION_INTERVAL" default:"1m"`
+	RecommendationWindow    time.Duration `envconfig:"RECOMMENDATION_WINDOW" default:"24h"`
+	RecommendationMargin    float64       `envconfig:"RECOMMENDATION_MARGIN" default:"0.15"`
+	AutoApplyResources      bool          `envconfig:"AUTO_APPLY_RESOURCES" default:"false"`
+	// AdminToken enables /debug/config of the controller server for requests carrying it as a
+	// bearer token. ADMIN_TOKEN_FILE takes precedence and is reloaded when it changes.
+	AdminToken     string `envconfig:"ADMIN_TOKEN"`
+	AdminTokenFile string `envconfig:"ADMIN_TOKEN_FILE"`
+	// RuntimeConfigFile points to a ConfigMap-mounted file with hot-reloadable settings.
+	RuntimeConfigFile string `envconfig:"RUNTIME_CONFIG_FILE"`
+}
+type Server struct {
+	Port            int           `envconfig:"PORT" default:"8080"`
+	Host            string        `envconfig:"HOST" default:"0.0.0.0"`
+	ReadTimeout     time.Duration `envconfig:"READ_TIMEOUT" default:"10s"`
+	WriteTimeout    time.Duration `envconfig:"WRITE_TIMEOUT" default:"10s"`
+	IdleTimeout     time.Duration `envconfig:"IDLE_TIMEOUT" default:"120s"`
+	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+	// RequestTimeout bounds read-only API routes; UploadTimeout bounds job submission with file upload,
+	// DownloadTimeout the streaming of result files, ExportTimeout the streaming of export archives
+	// and ImportTimeout their upload and import.
+	RequestTimeout  time.Duration `envconfig:"REQUEST_TIMEOUT" default:"5s"`
+	UploadTimeout   time.Duration `envconfig:"UPLOAD_TIMEOUT" default:"60s"`
+	DownloadTimeout time.Duration `envconfig:"DOWNLOAD_TIMEOUT" default:"10m"`
+	ExportTimeout   time.Duration `envconfig:"EXPORT_TIMEOUT" default:"10m"`
+	ImportTimeout   time.Duration `envconfig:"IMPORT_TIMEOUT" default:"10m"`
+	// LongPollMaxWait caps the wait parameter of GET /api/v1/jobs/{id}.
+	LongPollMaxWait time.Duration `envconfig:"LONG_POLL_MAX_WAIT" default:"60s"`
+	// ListStreamMaxDuration caps how long GET /api/v1/jobs streams NDJSON; clients resume from the
+	// next_offset of the final line.
+	ListStreamMaxDuration time.Duration `envconfig:"LIST_STREAM_MAX_DURATION" default:"5m"`
+}
+
+type Database struct {
+	Host          string `envconfig:"DB_HOST" required:"true"`
+	Port          int    `envconfig:"DB_PORT" default:"5432"`
+	User          string `envconfig:"DB_USER" required:"true"`
+	Password      string `envconfig:"DB_PASSWORD"`
+	PasswordFile  string `envconfig:"DB_PASSWORD_FILE"`
+	Database      string `envconfig:"DB_NAME" required:"true"`
+	SSLMode       string `envconfig:"DB_SSL_MODE" default:"require"`
+	MaxConns      int    `envconfig:"DB_MAX_CONNS" default:"20"`
+	MaxIdle       int    `envconfig:"DB_MAX_IDLE" default:"10"`
+	MigrationsURL string `envconfig:"DB_MIGRATIONS_URL" default:"file://migrations"`
+}
+
+func (dc Database) ConnectionString() string {
+	connURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(dc.User, dc.Password),
+		Host:     net.JoinHostPort(dc.Host, strconv.Itoa(dc.Port)),
+		Path:     dc.Database,
+		RawQuery: "sslmode=" + url.QueryEscape(dc.SSLMode),
+	}
+	return connURL.String()
+}
+
+type Redis struct {
+	Host         string `envconfig:"REDIS_HOST" required:"true"`
+	Port         int    `envconfig:"REDIS_PORT" default:"6379"`
+	Password     string `envconfig:"REDIS_PASSWORD"`
+	PasswordFile string `envconfig:"REDIS_PASSWORD_FILE"`
+	Database     int    `envconfig:"REDIS_DB" default:"0"`
+	// MemoryWatermark is the fraction of maxmemory above which the API rejects new jobs and workers
+	// skip work that adds to Redis, checked every MemoryCheckInterval; zero disables the guard.
+	MemoryWatermark     float64       `envconfig:"REDIS_MEMORY_WATERMARK" default:"0.9"`
+	MemoryCheckInterval time.Duration `envconfig:"REDIS_MEMORY_CHECK_INTERVAL" default:"5s"`
+	// FairTenants makes the API queue jobs in per-tenant sub-queues that workers consume
+	// round-robin, so that one tenant flooding the queue does not starve the others. Workers serve
+	// the sub-queues whether or not it is set.
+	FairTenants bool `envconfig:"QUEUE_FAIR_TENANTS" default:"false"`
+	// MessageFormat is the format the API encodes job messages in: json, or the more compact and
+	// faster msgpack or protobuf. Workers read every format, so it can change while jobs are queued.
+	MessageFormat string `envconfig:"QUEUE_MESSAGE_FORMAT" default:"json"`
+}
+
+// Formats of job messages on the queues.
+const (
+	MessageFormatJSON     = "json"
+	MessageFormatMsgpack  = "msgpack"
+	MessageFormatProtobuf = "protobuf"
+)
+
+// ValidateMessageFormat checks the format the services publishing jobs encode them in.
+func (rc Redis) ValidateMessageFormat() error {
+	switch rc.MessageFormat {
+	case MessageFormatJSON, MessageFormatMsgpack, MessageFormatProtobuf:
+		return nil
+	default:
+		return fmt.Errorf("queue message format %q must be %s, %s or %s",
+			rc.MessageFormat, MessageFormatJSON, MessageFormatMsgpack, MessageFormatProtobuf)
+	}
+}
+
+// ValidateMemoryGuard checks the settings of the memory guard of the services publishing to and
+// consuming from the queue.
+func (rc Redis) ValidateMemoryGuard() error {
+	if rc.MemoryWatermark < 0 || rc.MemoryWatermark > 1 {
+		return fmt.Errorf("redis memory watermark %v must be a fraction in [0, 1]", rc.MemoryWatermark)
+	}
+
+	if rc.MemoryCheckInterval <= 0 {
+		return errors.New("redis memory check interval must be positive")
+	}
+
+	return nil
+}
+
+func (rc Redis) Address() string {
+	return fmt.Sprintf("%s:%d", rc.Host, rc.Port)
+}
+
+// ForAddress returns the connection settings of another Redis reachable at a host:port address,
+// sharing the credentials and database number.
+func (rc Redis) ForAddress(address string) (Redis, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return Redis{}, fmt.Errorf("invalid redis address %q: %w", address, err)
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return Redis{}, fmt.Errorf("invalid redis port in address %q", address)
+	}
+
+	rc.Host, rc.Port = host, port
+	return rc, nil
+}
+
+// Federation connects the region's queue to the queues of other regions. Each region runs its own
+// API, workers and controller against its own Redis; jobs are published and consumed locally, and
+// the controller moves overflow to under-utilized regions. All regions share the database and file
+// storage, since a job moved to another region is processed there.
+type Federation struct {
+	// Region names the local region in stats and metrics.
+	Region string `envconfig:"REGION" default:"local"`
+	// Regions lists the other regions as name=host:port of their Redis, e.g.
+	// eu=redis.eu:6379,us=redis.us:6379. They are reached with the local Redis credentials and
+	// database. Empty disables federation.
+	Regions []string `envconfig:"FEDERATION_REGIONS"`
+	// Interval is how often the controller rebalances queued jobs across regions.
+	Interval time.Duration `envconfig:"FEDERATION_INTERVAL" default:"30s"`
+	// OverflowThreshold is the local backlog above which jobs are moved to other regions, and
+	// AcceptThreshold the backlog below which a region takes them.
+	OverflowThreshold int64 `envconfig:"FEDERATION_OVERFLOW_THRESHOLD" default:"100"`
+	AcceptThreshold   int64 `envconfig:"FEDERATION_ACCEPT_THRESHOLD" default:"20"`
+	// MaxMoves caps the jobs moved per rebalance.
+	MaxMoves int64 `envconfig:"FEDERATION_MAX_MOVES" default:"50"`
+}
+
+// Enabled reports whether other regions are configured.
+func (f Federation) Enabled() bool {
+	return len(f.Regions) > 0
+}
+
+// RegionAddresses maps the other regions to their Redis address.
+func (f Federation) RegionAddresses() (map[string]string, error) {
+	addresses := make(map[string]string, len(f.Regions))
+	for _, entry := range f.Regions {
+		region, address, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid federation region %q, expected name=host:port", entry)
+		}
+		if _, ok := addresses[region]; ok {
+			return nil, fmt.Errorf("duplicate federation region %q", region)
+		}
+		addresses[region] = address
+	}
+	return addresses, nil
+}
+
+func (f Federation) Validate(redis Redis) error {
+	if errs := validation.IsDNS1123Label(f.Region); len(errs) > 0 {
+		return fmt.Errorf("invalid region %q: %s", f.Region, strings.Join(errs, "; "))
+	}
+
+	addresses, err := f.RegionAddresses()
+	if err != nil {
+		return err
+	}
+	for region, address := range addresses {
+		if errs := validation.IsDNS1123Label(region); len(errs) > 0 {
+			return fmt.Errorf("invalid federation region %q: %s", region, strings.Join(errs, "; "))
+		}
+		if region == f.Region {
+			return fmt.Errorf("federation region %q is the local region", region)
+		}
+		if _, err := redis.ForAddress(address); err != nil {
+			return fmt.Errorf("federation region %q: %w", region, err)
+		}
+	}
+
+	if !f.Enabled() {
+		return nil
+	}
+
+	if f.Interval <= 0 {
+		return errors.New("federation interval must be positive")
+	}
+	if f.AcceptThreshold < 0 || f.OverflowThreshold <= f.AcceptThreshold {
+		return errors.New("federation overflow threshold must exceed the accept threshold, which cannot be negative")
+	}
+	if f.MaxMoves <= 0 {
+		return errors.New("federation max moves must be positive")
+	}
+
+	return nil
+}
+
+// Access protects the API routes with CIDR allow/deny lists, a per-client rate limit shared by all
+// replicas and a per-replica in-flight request limit.
+type Access struct {
+	// AllowCIDRs, when set, rejects clients outside these ranges. DenyCIDRs always win over AllowCIDRs.
+	AllowCIDRs []string `envconfig:"IP_ALLOWLIST"`
+	DenyCIDRs  []string `envconfig:"IP_DENYLIST"`
+	// TrustForwardedFor uses X-Forwarded-For/X-Real-IP as the client address; enable only behind a trusted proxy.
+	TrustForwardedFor bool `envconfig:"IP_TRUST_FORWARDED_FOR" default:"false"`
+	// MaxInFlight caps concurrently served API requests; zero disables the limit.
+	MaxInFlight int `envconfig:"MAX_IN_FLIGHT_REQUESTS" default:"0"`
+	// RateLimit caps the API requests of each client address per sliding RateLimitWindow, counted
+	// in Redis across all replicas; zero disables the limit.
+	RateLimit       int           `envconfig:"RATE_LIMIT_REQUESTS" default:"0"`
+	RateLimitWindow time.Duration `envconfig:"RATE_LIMIT_WINDOW" default:"1m"`
+}
+
+func (a Access) Validate() error {
+	for _, cidr := range append(append([]string{}, a.AllowCIDRs...), a.DenyCIDRs...) {
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			return fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+	}
+
+	if a.MaxInFlight < 0 {
+		return errors.New("max in-flight requests cannot be negative")
+	}
+
+	if a.RateLimit < 0 {
+		return errors.New("rate limit cannot be negative")
+	}
+
+	if a.RateLimit > 0 && a.RateLimitWindow < time.Millisecond {
+		return errors.New("rate limit window must be at least 1ms")
+	}
+
+	return nil
+}
+
+// Uploads bounds the memory and temporary disk used to parse multipart job submissions. Each
+// parse buffers up to MemoryLimit bytes in memory and spills larger uploads to TempDir; uploads
+// that would take the spilled bytes over TempDiskLimit are rejected.
+//
+// ScanCommand, when set, is run on every quarantined upload with the content on its standard input,
+// for up to ScanTimeout; exit code 1 rejects the upload.
+type Uploads struct {
+	MaxConcurrentParses int   `envconfig:"UPLOAD_MAX_CONCURRENT_PARSES" default:"8"`
+	MemoryLimit         int64 `envconfig:"UPLOAD_MEMORY_LIMIT" default:"33554432"` // 32MB
+	// TempDir defaults to the system temporary directory.
+	TempDir       string        `envconfig:"UPLOAD_TEMP_DIR"`
+	TempDiskLimit int64         `envconfig:"UPLOAD_TEMP_DISK_LIMIT" default:"1073741824"` // 1GB
+	ScanCommand   string        `envconfig:"UPLOAD_SCAN_COMMAND"`
+	ScanTimeout   time.Duration `envconfig:"UPLOAD_SCAN_TIMEOUT" default:"30s"`
+}
+
+func (u Uploads) Validate() error {
+	if u.MaxConcurrentParses <= 0 {
+		return errors.New("max concurrent upload parses must be positive")
+	}
+
+	if u.MemoryLimit <= 0 || u.TempDiskLimit <= 0 {
+		return errors.New("upload memory and temp disk limits must be positive")
+	}
+
+	if u.ScanCommand != "" && u.ScanTimeout <= 0 {
+		return errors.New("upload scan timeout must be positive")
+	}
+
+	return nil
+}
+
+type Storage struct {
+	UploadDir   string `envconfig:"UPLOAD_DIR" required:"true"`
+	ResultDir   string `envconfig:"RESULT_DIR" required:"true"`
+	MaxFileSize int64  `envconfig:"MAX_FILE_SIZE" default:"10485760"` // 10MB
+	// MaxImportSize caps the archives accepted by the import API. MaxImportEntrySize and
+	// MaxImportExtractedSize cap what they decompress to, per file and in all.
+	MaxImportSize          int64 `envconfig:"MAX_IMPORT_SIZE" default:"1073741824"`           // 1GB
+	MaxImportEntrySize     int64 `envconfig:"MAX_IMPORT_ENTRY_SIZE" default:"1073741824"`     // 1GB
+	MaxImportExtractedSize int64 `envconfig:"MAX_IMPORT_EXTRACTED_SIZE" default:"4294967296"` // 4GB
+}
+
+// Encryption configures AES-GCM encryption of queue messages and of uploaded and result files at
+// rest. Keys are id=base64 entries of 16, 24 or 32 bytes; ENCRYPTION_KEYS_FILE takes precedence
+// and lists one entry per line. Data is encrypted with ActiveKey and names the key it was encrypted
+// with, so a key is rotated by adding the new key everywhere, then making it active, and removing
+// the old key once nothing encrypted with it is left. Configured keys always decrypt, also with
+// encryption disabled.
+type Encryption struct {
+	Keys      []string `envconfig:"ENCRYPTION_KEYS"`
+	KeysFile  string   `envconfig:"ENCRYPTION_KEYS_FILE"`
+	ActiveKey string   `envconfig:"ENCRYPTION_ACTIVE_KEY"`
+	Queue     bool     `envconfig:"ENCRYPT_QUEUE_MESSAGES" default:"false"`
+	Files     bool     `envconfig:"ENCRYPT_FILES" default:"false"`
+}
+
+// KeyMap parses Keys into keys by key ID.
+func (e Encryption) KeyMap() (map[string][]byte, error) {
+	keys := make(map[string][]byte, len(e.Keys))
+	for _, entry := range e.Keys {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || id == "" {
+			return nil, errors.New("invalid encryption key entry, expected id=base64 key")
+		}
+		if _, ok := keys[id]; ok {
+			return nil, fmt.Errorf("encryption key %s is listed twice", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s is not valid base64: %w", id, err)
+		}
+		if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %s has %d bytes, expected 16, 24 or 32", id, len(key))
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// resolveKeys loads the keys from ENCRYPTION_KEYS_FILE.
+func (e *Encryption) resolveKeys() error {
+	if e.KeysFile == "" {
+		return nil
+	}
+
+	data, err := secrets.ReadFile(e.KeysFile)
+	if err != nil {
+		return fmt.Errorf("load encryption keys: %w", err)
+	}
+	e.Keys = strings.Fields(data)
+
+	return nil
+}
+
+func (e Encryption) Validate() error {
+	keys, err := e.KeyMap()
+	if err != nil {
+		return err
+	}
+
+	if e.ActiveKey != "" {
+		if _, ok := keys[e.ActiveKey]; !ok {
+			return fmt.Errorf("active encryption key %s is not among the encryption keys", e.ActiveKey)
+		}
+	}
+
+	if (e.Queue || e.Files) && e.ActiveKey == "" {
+		return errors.New("encrypting queue messages or files requires ENCRYPTION_ACTIVE_KEY")
+	}
+
+	return nil
+}
+
+// Delays bounds the artificial processing delay (delay_ms) jobs ask for to simulate slow processing
+// in stress tests. Jobs submitted without delay_ms get DefaultMS, and the API rejects delays above
+// MaxMS, which workers also cap delays of already queued jobs to. TypeDefaults and TypeMax override
+// them per processing type as type=milliseconds entries.
+type Delays struct {
+	DefaultMS    int      `envconfig:"DELAY_DEFAULT_MS" default:"0"`
+	MaxMS        int      `envconfig:"DELAY_MAX_MS" default:"60000"`
+	TypeDefaults []string `envconfig:"DELAY_DEFAULT_MS_BY_TYPE"`
+	TypeMax      []string `envconfig:"DELAY_MAX_MS_BY_TYPE"`
+}
+
+// Limits returns the default and maximum delay of a processing type in milliseconds. A global
+// default above the max of the type is capped to it.
+func (d Delays) Limits(processingType string) (int, int) {
+	// Validate rejects malformed entries, so they are not reported here
+	defaults, _ := parseTypeMilliseconds(d.TypeDefaults)
+	maxima, _ := parseTypeMilliseconds(d.TypeMax)
+
+	defaultMS, ok := defaults[processingType]
+	if !ok {
+		defaultMS = d.DefaultMS
+	}
+	maxMS, ok := maxima[processingType]
+	if !ok {
+		maxMS = d.MaxMS
+	}
+	return min(defaultMS, maxMS), maxMS
+}
+
+// MaxDelay returns the longest delay any processing type may sleep for.
+func (d Delays) MaxDelay() time.Duration {
+	maxMS := d.MaxMS
+	maxima, _ := parseTypeMilliseconds(d.TypeMax)
+	for _, typeMaxMS := range maxima {
+		maxMS = max(maxMS, typeMaxMS)
+	}
+	return time.Duration(maxMS) * time.Millisecond
+}
+
+func (d Delays) Validate() error {
+	if d.DefaultMS < 0 || d.MaxMS < 0 {
+		return errors.New("default and max delay cannot be negative")
+	}
+	if d.DefaultMS > d.MaxMS {
+		return errors.New("default delay cannot exceed the max delay")
+	}
+
+	defaults, err := parseTypeMilliseconds(d.TypeDefaults)
+	if err != nil {
+		return fmt.Errorf("invalid DELAY_DEFAULT_MS_BY_TYPE: %w", err)
+	}
+	maxima, err := parseTypeMilliseconds(d.TypeMax)
+	if err != nil {
+		return fmt.Errorf("invalid DELAY_MAX_MS_BY_TYPE: %w", err)
+	}
+	for processingType, defaultMS := range defaults {
+		maxMS, ok := maxima[processingType]
+		if !ok {
+			maxMS = d.MaxMS
+		}
+		if defaultMS > maxMS {
+			return fmt.Errorf("default delay of %s (%d ms) exceeds its max delay (%d ms)", processingType, defaultMS, maxMS)
+		}
+	}
+
+	return nil
+}
+
+// parseTypeMilliseconds parses type=milliseconds entries.
+func parseTypeMilliseconds(entries []string) (map[string]int, error) {
+	values := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		processingType, raw, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || processingType == "" {
+			return nil, fmt.Errorf("invalid entry %q, expected type=milliseconds", entry)
+		}
+		if _, ok := values[processingType]; ok {
+			return nil, fmt.Errorf("processing type %s is listed twice", processingType)
+		}
+
+		ms, err := strconv.Atoi(raw)
+		if err != nil || ms < 0 {
+			return nil, fmt.Errorf("invalid milliseconds %q for processing type %s", raw, processingType)
+		}
+		values[processingType] = ms
+	}
+	return values, nil
+}
+
+type SLO struct {
+	APIAvailabilityTarget float64         `envconfig:"SLO_API_AVAILABILITY_TARGET" default:"0.999"`
+	JobLatencyTarget      float64         `envconfig:"SLO_JOB_LATENCY_TARGET" default:"0.99"`
+	JobLatencyThreshold   time.Duration   `envconfig:"SLO_JOB_LATENCY_THRESHOLD" default:"5m"`
+	Windows               []time.Duration `envconfig:"SLO_WINDOWS" default:"1h,6h,24h"`
+	EvaluationInterval    time.Duration   `envconfig:"SLO_EVALUATION_INTERVAL" default:"1m"`
+}
+
+// MaxWindow returns the longest configured SLO window.
+func (s SLO) MaxWindow() time.Duration {
+	var maxWindow time.Duration
+	for _, w := range s.Windows {
+		maxWindow = max(maxWindow, w)
+	}
+	return maxWindow
+}
+
+const (
+	EventSinkRedis      = "redis"
+	EventSinkKafka      = "kafka"
+	EventSinkWebhook    = "webhook"
+	EventSinkKubernetes = "kubernetes"
+	EventSinkSlack      = "slack"
+	EventSinkTeams      = "teams"
+)
+
+type Events struct {
+	Sinks          []string      `envconfig:"EVENTS_SINKS"`
+	BufferSize     int           `envconfig:"EVENTS_BUFFER_SIZE" default:"1000"`
+	PublishTimeout time.Duration `envconfig:"EVENTS_PUBLISH_TIMEOUT" default:"5s"`
+	RedisChannel   string        `envconfig:"EVENTS_REDIS_CHANNEL" default:"text_tasks:events"`
+	KafkaBrokers   []string      `envconfig:"EVENTS_KAFKA_BROKERS"`
+	KafkaTopic     string        `envconfig:"EVENTS_KAFKA_TOPIC" default:"job-events"`
+	WebhookURL     string        `envconfig:"EVENTS_WEBHOOK_URL"`
+	Notifications  Notifications
+}
+
+// Notifications configures the slack and teams event sinks. They post a message rendered from the
+// Go template Template, or a default one, for every event of Types to the incoming webhook of the
+// event's tenant, listed in the tenant webhooks as tenant=url, or else to the default webhook.
+// Empty Types notifies every event. At most RateLimit messages per RateWindow are posted to each
+// webhook by every replica; the rest are dropped.
+type Notifications struct {
+	SlackWebhookURL     string        `envconfig:"NOTIFY_SLACK_WEBHOOK_URL"`
+	SlackTenantWebhooks []string      `envconfig:"NOTIFY_SLACK_TENANT_WEBHOOKS"`
+	TeamsWebhookURL     string        `envconfig:"NOTIFY_TEAMS_WEBHOOK_URL"`
+	TeamsTenantWebhooks []string      `envconfig:"NOTIFY_TEAMS_TENANT_WEBHOOKS"`
+	Types               []string      `envconfig:"NOTIFY_EVENT_TYPES" default:"job.failed"`
+	Template            string        `envconfig:"NOTIFY_TEMPLATE"`
+	RateLimit           int           `envconfig:"NOTIFY_RATE_LIMIT" default:"20"`
+	RateWindow          time.Duration `envconfig:"NOTIFY_RATE_WINDOW" default:"1m"`
+}
+
+// ParseTenantWebhooks parses tenant webhooks given as tenant=url.
+func ParseTenantWebhooks(entries []string) (map[string]string, error) {
+	webhooks := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		tenantID, url, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(tenantID) == "" || strings.TrimSpace(url) == "" {
+			return nil, fmt.Errorf("invalid tenant webhook %q, expected tenant=url", entry)
+		}
+		webhooks[strings.TrimSpace(tenantID)] = strings.TrimSpace(url)
+	}
+	return webhooks, nil
+}
+
+func (n Notifications) validate(sink, defaultURL string, tenantWebhooks []string) error {
+	webhooks, err := ParseTenantWebhooks(tenantWebhooks)
+	if err != nil {
+		return fmt.Errorf("%s event sink: %w", sink, err)
+	}
+
+	if defaultURL == "" && len(webhooks) == 0 {
+		return fmt.Errorf("%s event sink requires a webhook URL or tenant webhooks", sink)
+	}
+
+	if n.RateLimit <= 0 || n.RateWindow <= 0 {
+		return errors.New("notification rate limit and window must be positive")
+	}
+
+	return nil
+}
+
+// Exec configures the opt-in exec processing type, which pipes input files through
+// operator-allowed commands in a sandbox without network access.
+type Exec struct {
+	Enabled bool `envconfig:"EXEC_ENABLED" default:"false"`
+	// AllowedCommands are command names resolved on PATH at startup, e.g. sed,awk,jq.
+	AllowedCommands []string      `envconfig:"EXEC_ALLOWED_COMMANDS"`
+	Timeout         time.Duration `envconfig:"EXEC_TIMEOUT" default:"30s"`
+	CPULimit        time.Duration `envconfig:"EXEC_CPU_LIMIT" default:"10s"`
+	MemoryLimit     int64         `envconfig:"EXEC_MEMORY_LIMIT" default:"268435456"` // 256MB
+	MaxOutputSize   int64         `envconfig:"EXEC_MAX_OUTPUT_SIZE" default:"10485760"`
+	// IsolateNetwork needs unprivileged user namespaces; disable it only when a NetworkPolicy
+	// already denies worker egress.
+	IsolateNetwork bool `envconfig:"EXEC_ISOLATE_NETWORK" default:"true"`
+}
+
+// Plugins configures WASM plugin processors loaded from Dir at worker startup.
+type Plugins struct {
+	// Dir holds <name>.wasm modules, each served as processing type plugin:<name>. Empty disables plugins.
+	Dir         string        `envconfig:"PLUGIN_DIR"`
+	Timeout     time.Duration `envconfig:"PLUGIN_TIMEOUT" default:"30s"`
+	MemoryLimit int64         `envconfig:"PLUGIN_MEMORY_LIMIT" default:"134217728"` // 128MB
+}
+
+func (p Plugins) Validate() error {
+	if p.Dir == "" {
+		return nil
+	}
+
+	if p.Timeout <= 0 {
+		return errors.New("plugin timeout must be positive")
+	}
+
+	if p.MemoryLimit < wasmPageSize {
+		return fmt.Errorf("plugin memory limit must be at least %d bytes", wasmPageSize)
+	}
+
+	return nil
+}
+
+// wasmPageSize is the WebAssembly linear memory page size.
+const wasmPageSize = 64 << 10
+
+// MemoryLimitPages returns MemoryLimit in WebAssembly pages.
+func (p Plugins) MemoryLimitPages() uint32 {
+	return uint32(min(p.MemoryLimit/wasmPageSize, 65536)) //nolint:gosec,mnd // bounded by the 4GB wasm32 address space
+}
+
+func (e Exec) Validate() error {
+	if !e.Enabled {
+		return nil
+	}
+
+	if len(e.AllowedCommands) == 0 {
+		return errors.New("exec processing requires at least one allowed command")
+	}
+
+	if e.Timeout <= 0 || e.CPULimit < time.Second {
+		return errors.New("exec timeout must be positive and CPU limit at least 1s")
+	}
+
+	if e.MemoryLimit <= 0 || e.MaxOutputSize <= 0 {
+		return errors.New("exec memory limit and max output size must be positive")
+	}
+
+	return nil
+}
+
+func (e Events) Enabled(sink string) bool {
+	return contains(e.Sinks, sink)
+}
+
+func (e Events) Validate() error {
+	validSinks := []string{EventSinkRedis, EventSinkKafka, EventSinkWebhook, EventSinkKubernetes, EventSinkSlack, EventSinkTeams}
+	for _, sink := range e.Sinks {
+		if !contains(validSinks, sink) {
+			return fmt.Errorf("invalid event sink: %s", sink)
+		}
+	}
+
+	if e.BufferSize <= 0 {
+		return errors.New("events buffer size must be positive")
+	}
+
+	if e.PublishTimeout <= 0 {
+		return errors.New("events publish timeout must be positive")
+	}
+
+	if e.Enabled(EventSinkKafka) && (len(e.KafkaBrokers) == 0 || e.KafkaTopic == "") {
+		return errors.New("kafka event sink requires brokers and topic")
+	}
+
+	if e.Enabled(EventSinkWebhook) && e.WebhookURL == "" {
+		return errors.New("webhook event sink requires a URL")
+	}
+
+	if (e.Enabled(EventSinkRedis) || e.Enabled(EventSinkKubernetes)) && e.RedisChannel == "" {
+		return errors.New("redis and kubernetes event sinks require a redis channel")
+	}
+
+	n := e.Notifications
+	if e.Enabled(EventSinkSlack) {
+		if err := n.validate(EventSinkSlack, n.SlackWebhookURL, n.SlackTenantWebhooks); err != nil {
+			return err
+		}
+	}
+
+	if e.Enabled(EventSinkTeams) {
+		if err := n.validate(EventSinkTeams, n.TeamsWebhookURL, n.TeamsTenantWebhooks); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Health configures the readiness checks of a service. Check results are reused for CacheTTL, so
+// frequent probes do not hit the database and Redis on every request.
+type Health struct {
+	CacheTTL     time.Duration `envconfig:"HEALTH_CACHE_TTL" default:"5s"`
+	CheckTimeout time.Duration `envconfig:"HEALTH_CHECK_TIMEOUT" default:"2s"`
+}
+
+func (h Health) Validate() error {
+	if h.CacheTTL < 0 {
+		return errors.New("health cache TTL cannot be negative")
+	}
+
+	if h.CheckTimeout <= 0 {
+		return errors.New("health check timeout must be positive")
+	}
+
+	return nil
+}
+
+// RequestCapture keeps summaries of the last Size failed (4xx and 5xx) API requests in memory,
+// with up to BodyLimit bytes of their bodies, served at /debug/requests to the admin token.
+type RequestCapture struct {
+	Enabled   bool `envconfig:"REQUEST_CAPTURE_ENABLED" default:"false"`
+	Size      int  `envconfig:"REQUEST_CAPTURE_SIZE" default:"100"`
+	BodyLimit int  `envconfig:"REQUEST_CAPTURE_BODY_LIMIT" default:"2048"`
+}
+
+func (c RequestCapture) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.Size <= 0 {
+		return errors.New("request capture size must be positive")
+	}
+
+	if c.BodyLimit < 0 {
+		return errors.New("request capture body limit cannot be negative")
+	}
+
+	return nil
+}
+
+// AccessLog configures the access log of the API. Requests taking at least SlowThreshold are
+// flagged slow, zero disables the flag. SampleRate is the fraction of fast, successful requests
+// logged; failed and slow requests are always logged.
+type AccessLog struct {
+	SlowThreshold time.Duration `envconfig:"ACCESS_LOG_SLOW_THRESHOLD" default:"1s"`
+	SampleRate    float64       `envconfig:"ACCESS_LOG_SAMPLE_RATE" default:"1"`
+}
+
+func (a AccessLog) Validate() error {
+	if a.SlowThreshold < 0 {
+		return errors.New("access log slow threshold cannot be negative")
+	}
+
+	if a.SampleRate < 0 || a.SampleRate > 1 {
+		return fmt.Errorf("access log sample rate must be between 0 and 1, got %g", a.SampleRate)
+	}
+
+	return nil
+}
+
+// Alerts configures the anomaly alerts of the controller. Every EvaluationInterval it evaluates
+// the alert rules and notifies when one starts or stops firing: in the log, as a Kubernetes Event
+// on the events Deployment and, when set, to WebhookURL as JSON and to SlackWebhookURL as a Slack
+// message. The rules come from the ALERT_* thresholds below, where zero disables a rule, unless
+// the alerts section of the runtime configuration lists rules, which then replace them.
+type Alerts struct {
+	Enabled            bool          `envconfig:"ALERTS_ENABLED" default:"true"`
+	EvaluationInterval time.Duration `envconfig:"ALERT_EVALUATION_INTERVAL" default:"30s"`
+	// QueueDepthThreshold fires when more jobs stay queued for QueueDepthFor.
+	QueueDepthThreshold int64         `envconfig:"ALERT_QUEUE_DEPTH_THRESHOLD" default:"1000"`
+	QueueDepthFor       time.Duration `envconfig:"ALERT_QUEUE_DEPTH_FOR" default:"10m"`
+	// FailureRateThreshold fires when more than this percentage of the jobs finished within
+	// FailureRateWindow failed, once at least FailureRateMinJobs finished.
+	FailureRateThreshold float64       `envconfig:"ALERT_FAILURE_RATE_THRESHOLD" default:"20"`
+	FailureRateWindow    time.Duration `envconfig:"ALERT_FAILURE_RATE_WINDOW" default:"15m"`
+	FailureRateMinJobs   int64         `envconfig:"ALERT_FAILURE_RATE_MIN_JOBS" default:"20"`
+	// HeartbeatTimeout fires when jobs are queued but no worker sent a heartbeat for this long.
+	HeartbeatTimeout time.Duration `envconfig:"ALERT_HEARTBEAT_TIMEOUT" default:"5m"`
+	// FailedQueueSizeThreshold fires when more messages stay in the failed queue for FailedQueueFor,
+	// FailedQueueAgeThreshold when its oldest message failed longer ago than this.
+	FailedQueueSizeThreshold int64         `envconfig:"ALERT_FAILED_QUEUE_SIZE_THRESHOLD" default:"100"`
+	FailedQueueAgeThreshold  time.Duration `envconfig:"ALERT_FAILED_QUEUE_AGE_THRESHOLD" default:"72h"`
+	FailedQueueFor           time.Duration `envconfig:"ALERT_FAILED_QUEUE_FOR" default:"10m"`
+	WebhookURL               string        `envconfig:"ALERT_WEBHOOK_URL"`
+	SlackWebhookURL          string        `envconfig:"ALERT_SLACK_WEBHOOK_URL"`
+	NotifyTimeout            time.Duration `envconfig:"ALERT_NOTIFY_TIMEOUT" default:"5s"`
+}
+
+// Rules returns the alert rules configured by the ALERT_* thresholds.
+func (a Alerts) Rules() []AlertRule {
+	var rules []AlertRule
+	if a.QueueDepthThreshold > 0 {
+		rules = append(rules, AlertRule{
+			Name:      AlertRuleQueueDepth,
+			Type:      AlertRuleQueueDepth,
+			Threshold: float64(a.QueueDepthThreshold),
+			For:       Duration{Duration: a.QueueDepthFor},
+			Severity:  AlertSeverityWarning,
+		})
+	}
+	if a.FailureRateThreshold > 0 {
+		rules = append(rules, AlertRule{
+			Name:      AlertRuleFailureRate,
+			Type:      AlertRuleFailureRate,
+			Threshold: a.FailureRateThreshold,
+			Window:    Duration{Duration: a.FailureRateWindow},
+			MinJobs:   a.FailureRateMinJobs,
+			Severity:  AlertSeverityWarning,
+		})
+	}
+	if a.HeartbeatTimeout > 0 {
+		rules = append(rules, AlertRule{
+			Name:     AlertRuleNoHeartbeat,
+			Type:     AlertRuleNoHeartbeat,
+			For:      Duration{Duration: a.HeartbeatTimeout},
+			Severity: AlertSeverityCritical,
+		})
+	}
+	if a.FailedQueueSizeThreshold > 0 {
+		rules = append(rules, AlertRule{
+			Name:      AlertRuleFailedQueueSize,
+			Type:      AlertRuleFailedQueueSize,
+			Threshold: float64(a.FailedQueueSizeThreshold),
+			For:       Duration{Duration: a.FailedQueueFor},
+			Severity:  AlertSeverityWarning,
+		})
+	}
+	if a.FailedQueueAgeThreshold > 0 {
+		rules = append(rules, AlertRule{
+			Name:      AlertRuleFailedQueueAge,
+			Type:      AlertRuleFailedQueueAge,
+			Threshold: a.FailedQueueAgeThreshold.Seconds(),
+			For:       Duration{Duration: a.FailedQueueFor},
+			Severity:  AlertSeverityWarning,
+		})
+	}
+	return rules
+}
+
+func (a Alerts) Validate() error {
+	if !a.Enabled {
+		return nil
+	}
+
+	if a.EvaluationInterval <= 0 {
+		return errors.New("alert evaluation interval must be positive")
+	}
+
+	if a.NotifyTimeout <= 0 {
+		return errors.New("alert notify timeout must be positive")
+	}
+
+	if a.QueueDepthThreshold < 0 || a.FailureRateThreshold < 0 || a.HeartbeatTimeout < 0 ||
+		a.FailedQueueSizeThreshold < 0 || a.FailedQueueAgeThreshold < 0 {
+		return errors.New("alert thresholds cannot be negative")
+	}
+
+	for _, rule := range a.Rules() {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("alert rule %s: %w", rule.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// SMTP transport security modes of Email.
+const (
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLSImplicit = "tls"
+	SMTPTLSNone     = "none"
+)
+
+// Email configures the emails sent for jobs submitted with the notify_email parameter; an empty
+// SMTPHost disables them. Workers queue an email in Redis when such a job succeeds or fails, and
+// Senders goroutines per worker deliver the queue through the SMTP server. A failed delivery is
+// retried up to MaxAttempts times after RetryDelay, doubled after every attempt, and recipients the
+// server rejects permanently are suppressed from further emails. Succeeded jobs link their result
+// under ResultBaseURL, the public URL of the API. SMTP_PASSWORD_FILE takes precedence over
+// SMTP_PASSWORD.
+type Email struct {
+	SMTPHost         string        `envconfig:"SMTP_HOST"`
+	SMTPPort         int           `envconfig:"SMTP_PORT" default:"587"`
+	SMTPUsername     string        `envconfig:"SMTP_USERNAME"`
+	SMTPPassword     string        `envconfig:"SMTP_PASSWORD"`
+	SMTPPasswordFile string        `envconfig:"SMTP_PASSWORD_FILE"`
+	SMTPTLS          string        `envconfig:"SMTP_TLS" default:"starttls"`
+	From             string        `envconfig:"EMAIL_FROM"`
+	ResultBaseURL    string        `envconfig:"EMAIL_RESULT_BASE_URL"`
+	Senders          int           `envconfig:"EMAIL_SENDERS" default:"2"`
+	MaxAttempts      int           `envconfig:"EMAIL_MAX_ATTEMPTS" default:"5"`
+	RetryDelay       time.Duration `envconfig:"EMAIL_RETRY_DELAY" default:"30s"`
+	SendTimeout      time.Duration `envconfig:"EMAIL_SEND_TIMEOUT" default:"30s"`
+}
+
+func (e Email) Enabled() bool {
+	return e.SMTPHost != ""
+}
+
+// resolvePassword loads the SMTP password from its file.
+func (e *Email) resolvePassword() error {
+	if e.SMTPPasswordFile == "" {
+		return nil
+	}
+
+	password, err := secrets.ReadFile(e.SMTPPasswordFile)
+	if err != nil {
+		return fmt.Errorf("load smtp password: %w", err)
+	}
+	e.SMTPPassword = password
+
+	return nil
+}
+
+func (e Email) Validate() error {
+	if !e.Enabled() {
+		return nil
+	}
+
+	if e.SMTPPort <= 0 || e.SMTPPort > 65535 {
+		return fmt.Errorf("invalid smtp port: %d", e.SMTPPort)
+	}
+
+	validTLSModes := []string{SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone}
+	if !contains(validTLSModes, e.SMTPTLS) {
+		return fmt.Errorf("invalid smtp tls mode %q: must be one of %s", e.SMTPTLS, strings.Join(validTLSModes, ", "))
+	}
+
+	if _, err := mail.ParseAddress(e.From); err != nil {
+		return fmt.Errorf("invalid email from address %q: %w", e.From, err)
+	}
+
+	if e.ResultBaseURL != "" {
+		if u, err := url.Parse(e.ResultBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid email result base URL: %s", e.ResultBaseURL)
+		}
+	}
+
+	if e.Senders <= 0 || e.MaxAttempts <= 0 {
+		return errors.New("email senders and max attempts must be positive")
+	}
+
+	if e.RetryDelay <= 0 || e.SendTimeout <= 0 {
+		return errors.New("email retry delay and send timeout must be positive")
+	}
+
+	return nil
+}
+
+// Result sinks jobs can deliver their result to with the sinks parameter.
+const (
+	ResultSinkS3    = "s3"
+	ResultSinkHTTP  = "http"
+	ResultSinkKafka = "kafka"
+)
+
+// ResultSinks configures the connectors workers push the results of succeeded jobs to, for jobs
+// listing them in their sinks parameter. A sink is configured by its bucket, URL or brokers:
+// s3 uploads the result to S3Bucket, or to a compatible store at S3Endpoint, under the key
+// rendered from S3KeyTemplate; http POSTs it to the URL rendered from HTTPURLTemplate with
+// HTTPHeaders, given as name=value; kafka appends it to KafkaTopic keyed by job ID. The templates
+// are Go templates of the job, e.g. {{.TenantID}}/{{.JobID}}{{.Ext}}.
+//
+// A delivery is attempted up to MaxAttempts times, RetryDelay apart, each bounded by Timeout.
+// S3_SECRET_ACCESS_KEY_FILE takes precedence over S3_SECRET_ACCESS_KEY.
+type ResultSinks struct {
+	S3Bucket              string        `envconfig:"RESULT_SINK_S3_BUCKET"`
+	S3Region              string        `envconfig:"RESULT_SINK_S3_REGION" default:"us-east-1"`
+	S3Endpoint            string        `envconfig:"RESULT_SINK_S3_ENDPOINT"`
+	S3AccessKeyID         string        `envconfig:"RESULT_SINK_S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey     string        `envconfig:"RESULT_SINK_S3_SECRET_ACCESS_KEY"`
+	S3SecretAccessKeyFile string        `envconfig:"RESULT_SINK_S3_SECRET_ACCESS_KEY_FILE"`
+	S3KeyTemplate         string        `envconfig:"RESULT_SINK_S3_KEY_TEMPLATE" default:"results/{{.JobID}}{{.Ext}}"`
+	HTTPURLTemplate       string        `envconfig:"RESULT_SINK_HTTP_URL"`
+	HTTPHeaders           []string      `envconfig:"RESULT_SINK_HTTP_HEADERS"`
+	KafkaBrokers          []string      `envconfig:"RESULT_SINK_KAFKA_BROKERS"`
+	KafkaTopic            string        `envconfig:"RESULT_SINK_KAFKA_TOPIC" default:"job-results"`
+	KafkaMaxMessageBytes  int64         `envconfig:"RESULT_SINK_KAFKA_MAX_MESSAGE_BYTES" default:"1048576"`
+	MaxAttempts           int           `envconfig:"RESULT_SINK_MAX_ATTEMPTS" default:"3"`
+	RetryDelay            time.Duration `envconfig:"RESULT_SINK_RETRY_DELAY" default:"2s"`
+	Timeout               time.Duration `envconfig:"RESULT_SINK_TIMEOUT" default:"30s"`
+}
+
+// Configured returns the sinks that are configured.
+func (r ResultSinks) Configured() []string {
+	var sinks []string
+	if r.S3Bucket != "" {
+		sinks = append(sinks, ResultSinkS3)
+	}
+	if r.HTTPURLTemplate != "" {
+		sinks = append(sinks, ResultSinkHTTP)
+	}
+	if len(r.KafkaBrokers) > 0 {
+		sinks = append(sinks, ResultSinkKafka)
+	}
+	return sinks
+}
+
+// HTTPHeaderMap parses HTTPHeaders.
+func (r ResultSinks) HTTPHeaderMap() (map[string]string, error) {
+	headers := make(map[string]string, len(r.HTTPHeaders))
+	for _, header := range r.HTTPHeaders {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid result sink header %q, expected name=value", header)
+		}
+		headers[strings.TrimSpace(name)] = value
+	}
+	return headers, nil
+}
+
+// resolveCredentials loads the S3 secret access key from its file.
+func (r *ResultSinks) resolveCredentials() error {
+	if r.S3SecretAccessKeyFile == "" {
+		return nil
+	}
+
+	key, err := secrets.ReadFile(r.S3SecretAccessKeyFile)
+	if err != nil {
+		return fmt.Errorf("load result sink s3 secret access key: %w", err)
+	}
+	r.S3SecretAccessKey = key
+
+	return nil
+}
+
+func (r ResultSinks) Validate() error {
+	if len(r.Configured()) == 0 {
+		return nil
+	}
+
+	if r.MaxAttempts <= 0 {
+		return errors.New("result sink max attempts must be positive")
+	}
+
+	if r.RetryDelay < 0 || r.Timeout <= 0 {
+		return errors.New("result sink retry delay cannot be negative and timeout must be positive")
+	}
+
+	if r.S3Bucket != "" {
+		if r.S3AccessKeyID == "" || r.S3SecretAccessKey == "" {
+			return errors.New("result sink s3 requires RESULT_SINK_S3_ACCESS_KEY_ID and a secret access key")
+		}
+		if r.S3Endpoint != "" {
+			if u, err := url.Parse(r.S3Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+				return fmt.Errorf("invalid result sink s3 endpoint: %s", r.S3Endpoint)
+			}
+		}
+		if r.S3KeyTemplate == "" {
+			return errors.New("result sink s3 key template cannot be empty")
+		}
+	}
+
+	if _, err := r.HTTPHeaderMap(); err != nil {
+		return err
+	}
+
+	if len(r.KafkaBrokers) > 0 && (r.KafkaTopic == "" || r.KafkaMaxMessageBytes <= 0) {
+		return errors.New("result sink kafka requires a topic and a positive max message size")
+	}
+
+	return nil
+}
+
+// Migrations configures how the API applies database migrations. Replicas migrating at startup
+// take turns under a Postgres advisory lock, waiting at most LockTimeout for each other. With
+// OnStartup disabled, serving pods leave migrations to `api -migrate`, e.g. run as a Job.
+type Migrations struct {
+	OnStartup   bool          `envconfig:"MIGRATE_ON_STARTUP" default:"true"`
+	LockTimeout time.Duration `envconfig:"MIGRATION_LOCK_TIMEOUT" default:"5m"`
+}
+
+func (m Migrations) Validate() error {
+	if m.LockTimeout <= 0 {
+		return errors.New("migration lock timeout must be positive")
+	}
+
+	return nil
+}
+
+// Partitions configures the maintenance of the monthly jobs partitions. The API keeps Ahead months
+// of partitions created in advance and, with a positive Retention, drops the months that ended
+// longer than Retention ago together with their jobs.
+type Partitions struct {
+	Ahead     int           `envconfig:"JOB_PARTITIONS_AHEAD" default:"3"`
+	Retention time.Duration `envconfig:"JOB_RETENTION" default:"0"`
+}
+
+func (p Partitions) Validate() error {
+	if p.Ahead < 1 {
+		return errors.New("job partitions ahead must be at least 1")
+	}
+
+	if p.Retention < 0 {
+		return errors.New("job retention cannot be negative")
+	}
+
+	return nil
+}
+
+// FileReconcile configures the reconciliation of the stored files with the jobs referencing them.
+// Every Interval, zero disabling the schedule, the API reports the files older than MinAge that no
+// job references, deleting them with DeleteOrphans, and the jobs whose files are missing.
+type FileReconcile struct {
+	Interval      time.Duration `envconfig:"FILE_RECONCILE_INTERVAL" default:"6h"`
+	MinAge        time.Duration `envconfig:"FILE_RECONCILE_MIN_AGE" default:"1h"`
+	DeleteOrphans bool          `envconfig:"FILE_RECONCILE_DELETE_ORPHANS"`
+}
+
+func (f FileReconcile) Validate() error {
+	if f.Interval < 0 {
+		return errors.New("file reconcile interval cannot be negative")
+	}
+
+	if f.MinAge <= 0 {
+		return errors.New("file reconcile min age must be positive")
+	}
+
+	return nil
+}
+
+// AdminTasks configures the runner of long admin operations, such as bulk retries and exports.
+// Every API replica runs up to Concurrency tasks from the shared queue. A running task whose
+// replica stopped reporting its progress for StaleAfter is queued again for another one.
+type AdminTasks struct {
+	Concurrency int           `envconfig:"ADMIN_TASK_CONCURRENCY" default:"1"`
+	StaleAfter  time.Duration `envconfig:"ADMIN_TASK_STALE_AFTER" default:"2m"`
+}
+
+func (a AdminTasks) Validate() error {
+	if a.Concurrency < 0 {
+		return errors.New("admin task concurrency cannot be negative")
+	}
+
+	if a.StaleAfter < time.Minute {
+		return errors.New("admin task stale after must be at least a minute")
+	}
+
+	return nil
+}
+
+// DiskGuard configures the watchdog of the volumes of the upload and result directories, checked
+// every CheckInterval. While less than FreeWatermark of a volume is free, zero disabling the
+// watchdog, the API is not ready and rejects uploads, and with EmergencyCleanup it removes the
+// oldest files older than EmergencyMinAge that no pending or running job needs.
+type DiskGuard struct {
+	FreeWatermark    float64       `envconfig:"DISK_FREE_WATERMARK" default:"0.05"`
+	CheckInterval    time.Duration `envconfig:"DISK_CHECK_INTERVAL" default:"30s"`
+	EmergencyCleanup bool          `envconfig:"DISK_EMERGENCY_CLEANUP" default:"true"`
+	EmergencyMinAge  time.Duration `envconfig:"DISK_EMERGENCY_MIN_AGE" default:"24h"`
+}
+
+func (d DiskGuard) Validate() error {
+	if d.FreeWatermark < 0 || d.FreeWatermark >= 1 {
+		return fmt.Errorf("disk free watermark %v must be a fraction in [0, 1)", d.FreeWatermark)
+	}
+
+	if d.CheckInterval <= 0 {
+		return errors.New("disk check interval must be positive")
+	}
+
+	if d.EmergencyMinAge < 0 {
+		return errors.New("disk emergency cleanup min age cannot be negative")
+	}
+
+	return nil
+}
+
+// Startup configures how a service boots. With WaitForDependencies it retries its dependencies for
+// up to Timeout instead of exiting when they are not reachable yet, so a startupProbe can replace
+// initContainers that wait for them.
+type Startup struct {
+	WaitForDependencies bool          `envconfig:"WAIT_FOR_DEPENDENCIES" default:"false"`
+	Timeout             time.Duration `envconfig:"STARTUP_TIMEOUT" default:"5m"`
+}
+
+func (s Startup) Validate() error {
+	if s.WaitForDependencies && s.Timeout <= 0 {
+		return errors.New("startup timeout must be positive when waiting for dependencies")
+	}
+
+	return nil
 }
-type Server struct {
-	Port            int           `envconfig:"PORT" default:"8080"`
-	Host            string        `envconfig:"HOST" default:"0.0.0.0"`
-	ReadTimeout     time.Duration `envconfig:"READ_TIMEOUT" default:"10s"`
-	WriteTimeout    time.Duration `envconfig:"WRITE_TIMEOUT" default:"10s"`
-	IdleTimeout     time.Duration `envconfig:"IDLE_TIMEOUT" default:"120s"`
-	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"30s"`
+
+// Metrics exporters a binary can emit its metrics to.
+const (
+	MetricsExporterPrometheus = "prometheus"
+	MetricsExporterStatsD     = "statsd"
+	MetricsExporterOTLP       = "otlp"
+)
+
+// Metrics configures where a service sends its metrics. Exporters lists the backends used at the
+// same time: prometheus serves them on /metrics, statsd sends every change to StatsDAddress with
+// DogStatsD tags and otlp exports them to OTLPEndpoint every OTLPInterval. OTLPHeaders are sent
+// with every export, as name=value, e.g. for an API key.
+//
+// Workers and the controller can also push a curated subset to a Prometheus Pushgateway, for
+// clusters where nothing scrapes them. An empty PushURL disables pushing. The Pushgateway is
+// authenticated with PushUsername and PushPassword or with the bearer PushToken; the _FILE
+// variants take precedence.
+type Metrics struct {
+	Exporters     []string      `envconfig:"METRICS_EXPORTERS" default:"prometheus"`
+	StatsDAddress string        `envconfig:"METRICS_STATSD_ADDRESS" default:"localhost:8125"`
+	StatsDPrefix  string        `envconfig:"METRICS_STATSD_PREFIX"`
+	OTLPEndpoint  string        `envconfig:"METRICS_OTLP_ENDPOINT" default:"http://localhost:4318/v1/metrics"`
+	OTLPInterval  time.Duration `envconfig:"METRICS_OTLP_INTERVAL" default:"30s"`
+	OTLPHeaders   []string      `envconfig:"METRICS_OTLP_HEADERS"`
+	// TenantLabels bounds the tenants the API labels bandwidth metrics with; the rest are "other".
+	TenantLabels int `envconfig:"METRICS_TENANT_LABELS" default:"20"`
+
+	PushURL          string        `envconfig:"METRICS_PUSH_URL"`
+	PushInterval     time.Duration `envconfig:"METRICS_PUSH_INTERVAL" default:"30s"`
+	PushJob          string        `envconfig:"METRICS_PUSH_JOB" default:"k8s-learning"`
+	PushUsername     string        `envconfig:"METRICS_PUSH_USERNAME"`
+	PushPassword     string        `envconfig:"METRICS_PUSH_PASSWORD"`
+	PushPasswordFile string        `envconfig:"METRICS_PUSH_PASSWORD_FILE"`
+	PushToken        string        `envconfig:"METRICS_PUSH_TOKEN"`
+	PushTokenFile    string        `envconfig:"METRICS_PUSH_TOKEN_FILE"`
 }
 
-type Database struct {
-	Host          string `envconfig:"DB_HOST" required:"true"`
-	Port          int    `envconfig:"DB_PORT" default:"5432"`
-	User          string `envconfig:"DB_USER" required:"true"`
-	Password      string `envconfig:"DB_PASSWORD" required:"true"`
-	Database      string `envconfig:"DB_NAME" required:"true"`
-	SSLMode       string `envconfig:"DB_SSL_MODE" default:"require"`
-	MaxConns      int    `envconfig:"DB_MAX_CONNS" default:"20"`
-	MaxIdle       int    `envconfig:"DB_MAX_IDLE" default:"10"`
-	MigrationsURL string `envconfig:"DB_MIGRATIONS_URL" default:"file://migrations"`
+// Exports reports whether metrics are sent to the named exporter.
+func (m Metrics) Exports(exporter string) bool {
+	return contains(m.Exporters, exporter)
 }
 
-func (dc Database) ConnectionString() string {
-	hostPort := net.JoinHostPort(dc.Host, strconv.Itoa(dc.Port))
-	return fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=%s",
-		dc.User, dc.Password, hostPort, dc.Database, dc.SSLMode)
+// OTLPHeaderMap parses OTLPHeaders.
+func (m Metrics) OTLPHeaderMap() (map[string]string, error) {
+	headers := make(map[string]string, len(m.OTLPHeaders))
+	for _, header := range m.OTLPHeaders {
+		name, value, ok := strings.Cut(header, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header %q, expected name=value", header)
+		}
+		headers[strings.TrimSpace(name)] = value
+	}
+	return headers, nil
 }
 
-type Redis struct {
-	Host     string `envconfig:"REDIS_HOST" required:"true"`
-	Port     int    `envconfig:"REDIS_PORT" default:"6379"`
-	Password string `envconfig:"REDIS_PASSWORD"`
-	Database int    `envconfig:"REDIS_DB" default:"0"`
+// PushEnabled reports whether metrics are pushed.
+func (m Metrics) PushEnabled() bool {
+	return m.PushURL != ""
 }
 
-func (rc Redis) Address() string {
-	return fmt.Sprintf("%s:%d", rc.Host, rc.Port)
+// resolveCredentials loads the Pushgateway password and token from their files.
+func (m *Metrics) resolveCredentials() error {
+	if m.PushPasswordFile != "" {
+		password, err := secrets.ReadFile(m.PushPasswordFile)
+		if err != nil {
+			return fmt.Errorf("load metrics push password: %w", err)
+		}
+		m.PushPassword = password
+	}
+
+	if m.PushTokenFile != "" {
+		token, err := secrets.ReadFile(m.PushTokenFile)
+		if err != nil {
+			return fmt.Errorf("load metrics push token: %w", err)
+		}
+		m.PushToken = token
+	}
+
+	return nil
 }
 
-type Storage struct {
-	UploadDir   string `envconfig:"UPLOAD_DIR" required:"true"`
-	ResultDir   string `envconfig:"RESULT_DIR" required:"true"`
-	MaxFileSize int64  `envconfig:"MAX_FILE_SIZE" default:"10485760"` // 10MB
+func (m Metrics) Validate() error {
+	validExporters := []string{MetricsExporterPrometheus, MetricsExporterStatsD, MetricsExporterOTLP}
+	for _, exporter := range m.Exporters {
+		if !contains(validExporters, exporter) {
+			return fmt.Errorf("invalid metrics exporter: %s", exporter)
+		}
+	}
+
+	if m.TenantLabels < 0 {
+		return errors.New("metrics tenant labels cannot be negative")
+	}
+
+	if m.Exports(MetricsExporterStatsD) {
+		if _, _, err := net.SplitHostPort(m.StatsDAddress); err != nil {
+			return fmt.Errorf("invalid statsd address %q: %w", m.StatsDAddress, err)
+		}
+	}
+
+	if m.Exports(MetricsExporterOTLP) {
+		endpoint, err := url.Parse(m.OTLPEndpoint)
+		if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			return fmt.Errorf("invalid otlp endpoint: %s", m.OTLPEndpoint)
+		}
+		if m.OTLPInterval <= 0 {
+			return errors.New("otlp interval must be positive")
+		}
+		if _, err := m.OTLPHeaderMap(); err != nil {
+			return fmt.Errorf("otlp headers: %w", err)
+		}
+	}
+
+	if !m.PushEnabled() {
+		return nil
+	}
+
+	pushURL, err := url.Parse(m.PushURL)
+	if err != nil || (pushURL.Scheme != "http" && pushURL.Scheme != "https") || pushURL.Host == "" {
+		return fmt.Errorf("invalid metrics push URL: %s", m.PushURL)
+	}
+
+	if m.PushInterval <= 0 {
+		return errors.New("metrics push interval must be positive")
+	}
+
+	if m.PushJob == "" {
+		return errors.New("metrics push job is required")
+	}
+
+	if m.PushToken != "" && (m.PushUsername != "" || m.PushPassword != "") {
+		return errors.New("metrics push accepts either basic auth or a bearer token, not both")
+	}
+
+	return nil
 }
 
 type Logging struct {
@@ -100,6 +1467,26 @@ func Load() (*API, error) {
 		return nil, fmt.Errorf("process environment variables: %w", err)
 	}
 
+	if err := config.Database.resolvePassword(config.Secrets); err != nil {
+		return nil, err
+	}
+
+	if err := config.Redis.resolvePassword(config.Secrets); err != nil {
+		return nil, err
+	}
+
+	if err := config.Encryption.resolveKeys(); err != nil {
+		return nil, err
+	}
+
+	if config.AdminTokenFile != "" {
+		token, err := secrets.ReadFile(config.AdminTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("load admin token: %w", err)
+		}
+		config.AdminToken = token
+	}
+
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
@@ -121,6 +1508,38 @@ func LoadWorker() (*Worker, error) {
 		return nil, fmt.Errorf("process environment variables: %w", err)
 	}
 
+	if err := config.Database.resolvePassword(config.Secrets); err != nil {
+		return nil, err
+	}
+
+	if err := config.Redis.resolvePassword(config.Secrets); err != nil {
+		return nil, err
+	}
+
+	if err := config.Encryption.resolveKeys(); err != nil {
+		return nil, err
+	}
+
+	if config.AdminTokenFile != "" {
+		token, err := secrets.ReadFile(config.AdminTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("load admin token: %w", err)
+		}
+		config.AdminToken = token
+	}
+
+	if err := config.Metrics.resolveCredentials(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Email.resolvePassword(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Sinks.resolveCredentials(); err != nil {
+		return nil, err
+	}
+
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
@@ -142,6 +1561,22 @@ func LoadController() (*Controller, error) {
 		return nil, fmt.Errorf("process environment variables: %w", err)
 	}
 
+	if err := config.Redis.resolvePassword(config.Secrets); err != nil {
+		return nil, err
+	}
+
+	if config.AdminTokenFile != "" {
+		token, err := secrets.ReadFile(config.AdminTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("load admin token: %w", err)
+		}
+		config.AdminToken = token
+	}
+
+	if err := config.Metrics.resolveCredentials(); err != nil {
+		return nil, err
+	}
+
 	if err := config.Validate(); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
@@ -149,6 +1584,34 @@ func LoadController() (*Controller, error) {
 	return &config, nil
 }
 
+// Backup configures cmd/backup, which snapshots the database and the stored files.
+type Backup struct {
+	Database Database
+	Storage  Storage
+	Secrets  Secrets
+}
+
+func LoadBackup() (*Backup, error) {
+	// Try to load .env file for local development (ignore if not found)
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(".env"); err != nil {
+			return nil, fmt.Errorf("load .env file: %w", err)
+		}
+	}
+
+	var config Backup
+
+	if err := envconfig.Process("", &config); err != nil {
+		return nil, fmt.Errorf("process environment variables: %w", err)
+	}
+
+	if err := config.Database.resolvePassword(config.Secrets); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
 func (c *API) Validate() error {
 	// Port validation
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
@@ -165,9 +1628,33 @@ func (c *API) Validate() error {
 		return fmt.Errorf("invalid redis port: %d", c.Redis.Port)
 	}
 
+	if err := c.Redis.ValidateMemoryGuard(); err != nil {
+		return err
+	}
+
+	if err := c.Redis.ValidateMessageFormat(); err != nil {
+		return err
+	}
+
+	if err := c.Encryption.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Delays.Validate(); err != nil {
+		return err
+	}
+
+	// Route timeout validation
+	if c.Server.RequestTimeout <= 0 || c.Server.UploadTimeout <= 0 || c.Server.DownloadTimeout <= 0 ||
+		c.Server.ExportTimeout <= 0 || c.Server.ImportTimeout <= 0 || c.Server.LongPollMaxWait <= 0 ||
+		c.Server.ListStreamMaxDuration <= 0 {
+		return errors.New("request, upload, download, export and import timeouts, the long poll max wait and the list stream max duration must be positive")
+	}
+
 	// Storage validation
-	if c.Storage.MaxFileSize <= 0 {
-		return errors.New("max file size must be positive")
+	if c.Storage.MaxFileSize <= 0 || c.Storage.MaxImportSize <= 0 ||
+		c.Storage.MaxImportEntrySize <= 0 || c.Storage.MaxImportExtractedSize <= 0 {
+		return errors.New("max file and import sizes must be positive")
 	}
 
 	// SSL mode validation
@@ -187,9 +1674,131 @@ func (c *API) Validate() error {
 		return fmt.Errorf("invalid log format: %s", c.Logging.Format)
 	}
 
+	// SLO validation
+	if err := c.SLO.Validate(); err != nil {
+		return err
+	}
+
+	// Events validation
+	if err := c.Events.Validate(); err != nil {
+		return err
+	}
+
+	// Access control validation
+	if err := c.Access.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Uploads.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Health.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Startup.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Migrations.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Partitions.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Reconcile.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.AdminTasks.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Disk.Validate(); err != nil {
+		return err
+	}
+
+	if c.FailedQueueMaxAge < 0 {
+		return errors.New("failed queue max age cannot be negative")
+	}
+
+	if err := c.Metrics.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Capture.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.AccessLog.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Federation.Validate(c.Redis); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s SLO) Validate() error {
+	if s.APIAvailabilityTarget <= 0 || s.APIAvailabilityTarget >= 1 {
+		return fmt.Errorf("invalid API availability SLO target: %g", s.APIAvailabilityTarget)
+	}
+
+	if s.JobLatencyTarget <= 0 || s.JobLatencyTarget >= 1 {
+		return fmt.Errorf("invalid job latency SLO target: %g", s.JobLatencyTarget)
+	}
+
+	if s.JobLatencyThreshold <= 0 {
+		return errors.New("job latency SLO threshold must be positive")
+	}
+
+	if len(s.Windows) == 0 {
+		return errors.New("at least one SLO window is required")
+	}
+
+	for _, w := range s.Windows {
+		if w < time.Minute {
+			return fmt.Errorf("SLO window must be at least one minute: %s", w)
+		}
+	}
+
+	if s.EvaluationInterval <= 0 {
+		return errors.New("SLO evaluation interval must be positive")
+	}
+
 	return nil
 }
 
+// MaxProcessingTime returns how long a job whose every attempt times out is processed: the longest
+// simulated delay, which is slept before the first attempt, MaxRetries+1 attempts of JobTimeout and
+// the delays between them. It is zero when JobTimeout leaves attempts unbounded.
+func (w *Worker) MaxProcessingTime() time.Duration {
+	if w.JobTimeout <= 0 {
+		return 0
+	}
+
+	total := w.Delays.MaxDelay() + time.Duration(w.MaxRetries+1)*w.JobTimeout
+	delay := w.RetryDelay
+	for range w.MaxRetries {
+		total += delay
+		delay = w.NextRetryDelay(delay)
+	}
+	return total
+}
+
+// NextRetryDelay returns the delay before the retry that follows one after delay.
+func (w *Worker) NextRetryDelay(delay time.Duration) time.Duration {
+	if w.RetryBackoff == RetryBackoffExponential {
+		return min(2*delay, MaxRetryDelay) //nolint:mnd // double the delay
+	}
+	return delay
+}
+
 func (w *Worker) Validate() error {
 	// Database port validation
 	if w.Database.Port <= 0 || w.Database.Port > 65535 {
@@ -201,6 +1810,18 @@ func (w *Worker) Validate() error {
 		return fmt.Errorf("invalid redis port: %d", w.Redis.Port)
 	}
 
+	if err := w.Redis.ValidateMemoryGuard(); err != nil {
+		return err
+	}
+
+	if err := w.Encryption.Validate(); err != nil {
+		return err
+	}
+
+	if err := w.Delays.Validate(); err != nil {
+		return err
+	}
+
 	// Metrics port validation
 	if w.MetricsPort <= 0 || w.MetricsPort > 65535 {
 		return fmt.Errorf("invalid metrics port: %d", w.MetricsPort)
@@ -211,6 +1832,10 @@ func (w *Worker) Validate() error {
 		return errors.New("poll interval must be positive")
 	}
 
+	if w.HeartbeatInterval <= 0 {
+		return errors.New("heartbeat interval must be positive")
+	}
+
 	// Storage validation
 	if w.Storage.MaxFileSize <= 0 {
 		return errors.New("max file size must be positive")
@@ -221,6 +1846,50 @@ func (w *Worker) Validate() error {
 		return errors.New("concurrent jobs must be positive")
 	}
 
+	if w.ConsumeBatchSize <= 0 {
+		return errors.New("consume batch size must be positive")
+	}
+
+	if w.ClaimLease <= 0 || w.ClaimTTL <= 0 {
+		return errors.New("claim lease and TTL must be positive")
+	}
+
+	if w.MaxDeliveries <= 0 {
+		return errors.New("max deliveries must be positive")
+	}
+
+	if w.JobTimeout < 0 {
+		return errors.New("job timeout cannot be negative")
+	}
+
+	if w.MaxRetries < 0 {
+		return errors.New("max retries cannot be negative")
+	}
+
+	if w.RetryBackoff != RetryBackoffFixed && w.RetryBackoff != RetryBackoffExponential {
+		return fmt.Errorf("invalid retry backoff %q: must be %s or %s", w.RetryBackoff, RetryBackoffFixed, RetryBackoffExponential)
+	}
+
+	if w.MaxRetries > 0 && w.RetryDelay <= 0 {
+		return errors.New("retry delay must be positive")
+	}
+
+	// Retries run within the claim of the delivery, and a job still processed when its claim
+	// expires is processed twice, so the attempts must be bounded to be retried
+	if w.MaxRetries > 0 && w.JobTimeout == 0 {
+		return fmt.Errorf("max retries %d requires a job timeout: unbounded attempts could outlast the claim lease %s",
+			w.MaxRetries, w.ClaimLease)
+	}
+	if maxTime := w.MaxProcessingTime(); maxTime >= w.ClaimLease {
+		return fmt.Errorf("max delay %s plus job timeout %s over %d attempts plus retry delays, %s in all, must be shorter than the claim lease %s",
+			w.Delays.MaxDelay(), w.JobTimeout, w.MaxRetries+1, maxTime, w.ClaimLease)
+	}
+
+	if w.ResultOverwritePolicy != ResultPolicyVersion && w.ResultOverwritePolicy != ResultPolicyOverwrite {
+		return fmt.Errorf("invalid result overwrite policy %q: must be %s or %s",
+			w.ResultOverwritePolicy, ResultPolicyVersion, ResultPolicyOverwrite)
+	}
+
 	// SSL mode validation
 	validSSLModes := []string{"disable", "require", "verify-ca", "verify-full"}
 	if !contains(validSSLModes, w.Database.SSLMode) {
@@ -238,6 +1907,39 @@ func (w *Worker) Validate() error {
 		return fmt.Errorf("invalid log format: %s", w.Logging.Format)
 	}
 
+	// Events validation
+	if err := w.Events.Validate(); err != nil {
+		return err
+	}
+
+	if err := w.Exec.Validate(); err != nil {
+		return err
+	}
+
+	if err := w.Plugins.Validate(); err != nil {
+		return err
+	}
+
+	if err := w.Health.Validate(); err != nil {
+		return err
+	}
+
+	if err := w.Startup.Validate(); err != nil {
+		return err
+	}
+
+	if err := w.Metrics.Validate(); err != nil {
+		return err
+	}
+
+	if err := w.Email.Validate(); err != nil {
+		return err
+	}
+
+	if err := w.Sinks.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -247,6 +1949,22 @@ func (c *Controller) Validate() error {
 		return fmt.Errorf("invalid redis port: %d", c.Redis.Port)
 	}
 
+	if err := c.Health.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Startup.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Metrics.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Alerts.Validate(); err != nil {
+		return err
+	}
+
 	// Controller validation
 	if c.ReconcileInterval <= 0 {
 		return errors.New("reconcile interval must be positive")
@@ -256,6 +1974,52 @@ func (c *Controller) Validate() error {
 		return errors.New("metrics collection interval must be positive")
 	}
 
+	if len(c.WorkerNamespaces) == 0 {
+		return errors.New("at least one worker namespace is required")
+	}
+	for i, namespace := range c.WorkerNamespaces {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf("invalid worker namespace %q: %s", namespace, strings.Join(errs, "; "))
+		}
+		if contains(c.WorkerNamespaces[:i], namespace) {
+			return fmt.Errorf("duplicate worker namespace %q", namespace)
+		}
+	}
+
+	for _, name := range append([]string{c.EventsDeployment}, c.WorkerDeployments...) {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			return fmt.Errorf("invalid worker deployment name %q: %s", name, strings.Join(errs, "; "))
+		}
+	}
+
+	if _, err := labels.Parse(c.WorkerSelector); err != nil {
+		return fmt.Errorf("invalid worker selector: %w", err)
+	}
+
+	if c.ReactiveScaling && c.ScaleTriggerDebounce <= 0 {
+		return errors.New("scale trigger debounce must be positive")
+	}
+
+	if c.ScalingHistorySize <= 0 {
+		return errors.New("scaling history size must be positive")
+	}
+
+	if c.ResourceRecommendations {
+		if c.RecommendationInterval <= 0 {
+			return errors.New("recommendation interval must be positive")
+		}
+		if c.RecommendationWindow < c.RecommendationInterval {
+			return errors.New("recommendation window must not be shorter than the recommendation interval")
+		}
+		if c.RecommendationMargin < 0 {
+			return errors.New("recommendation margin must not be negative")
+		}
+	}
+
+	if c.AutoApplyResources && !c.ResourceRecommendations {
+		return errors.New("auto apply resources requires resource recommendations")
+	}
+
 	// Logging validation
 	validLogLevels := []string{"debug", "info", "warn", "error"}
 	if !contains(validLogLevels, c.Logging.Level) {
@@ -267,6 +2031,15 @@ func (c *Controller) Validate() error {
 		return fmt.Errorf("invalid log format: %s", c.Logging.Format)
 	}
 
+	// Events validation
+	if err := c.Events.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Federation.Validate(c.Redis); err != nil {
+		return err
+	}
+
 	return nil
 }
 
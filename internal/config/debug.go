@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const redactedValue = "[REDACTED]"
+
+// Redacted returns a copy of the database configuration safe to log or expose.
+func (dc Database) Redacted() Database {
+	if dc.Password != "" {
+		dc.Password = redactedValue
+	}
+	return dc
+}
+
+// Redacted returns a copy of the Redis configuration safe to log or expose.
+func (rc Redis) Redacted() Redis {
+	if rc.Password != "" {
+		rc.Password = redactedValue
+	}
+	return rc
+}
+
+// Redacted returns a copy of the metrics configuration safe to log or expose.
+func (m Metrics) Redacted() Metrics {
+	if m.PushPassword != "" {
+		m.PushPassword = redactedValue
+	}
+	if m.PushToken != "" {
+		m.PushToken = redactedValue
+	}
+	// Header values are usually credentials
+	headers := make([]string, len(m.OTLPHeaders))
+	for i, header := range m.OTLPHeaders {
+		name, _, _ := strings.Cut(header, "=")
+		headers[i] = name + "=" + redactedValue
+	}
+	m.OTLPHeaders = headers
+	return m
+}
+
+// Redacted returns a copy of the result sinks configuration safe to log or expose.
+func (r ResultSinks) Redacted() ResultSinks {
+	if r.S3SecretAccessKey != "" {
+		r.S3SecretAccessKey = redactedValue
+	}
+	// Header values are usually credentials
+	headers := make([]string, len(r.HTTPHeaders))
+	for i, header := range r.HTTPHeaders {
+		name, _, _ := strings.Cut(header, "=")
+		headers[i] = name + "=" + redactedValue
+	}
+	r.HTTPHeaders = headers
+	return r
+}
+
+// Redacted returns a copy of the encryption configuration safe to log or expose, keeping only the
+// IDs of the keys.
+func (e Encryption) Redacted() Encryption {
+	keys := make([]string, len(e.Keys))
+	for i, entry := range e.Keys {
+		id, _, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		keys[i] = id + "=" + redactedValue
+	}
+	e.Keys = keys
+	return e
+}
+
+// Redacted returns a copy of the events configuration safe to log or expose. Webhook URLs often
+// embed a token, as Slack and Teams ones always do.
+func (e Events) Redacted() Events {
+	if e.WebhookURL != "" {
+		e.WebhookURL = redactedValue
+	}
+	n := &e.Notifications
+	if n.SlackWebhookURL != "" {
+		n.SlackWebhookURL = redactedValue
+	}
+	if n.TeamsWebhookURL != "" {
+		n.TeamsWebhookURL = redactedValue
+	}
+	n.SlackTenantWebhooks = redactTenantWebhooks(n.SlackTenantWebhooks)
+	n.TeamsTenantWebhooks = redactTenantWebhooks(n.TeamsTenantWebhooks)
+	return e
+}
+
+// Redacted returns a copy of the alerts configuration safe to log or expose. Webhook URLs often
+// embed a token, as Slack ones always do.
+func (a Alerts) Redacted() Alerts {
+	if a.WebhookURL != "" {
+		a.WebhookURL = redactedValue
+	}
+	if a.SlackWebhookURL != "" {
+		a.SlackWebhookURL = redactedValue
+	}
+	return a
+}
+
+func redactTenantWebhooks(entries []string) []string {
+	redacted := make([]string, len(entries))
+	for i, entry := range entries {
+		tenantID, _, _ := strings.Cut(entry, "=")
+		redacted[i] = tenantID + "=" + redactedValue
+	}
+	return redacted
+}
+
+func (c API) Redacted() API {
+	c.Database = c.Database.Redacted()
+	c.Redis = c.Redis.Redacted()
+	c.Encryption = c.Encryption.Redacted()
+	c.Events = c.Events.Redacted()
+	c.Metrics = c.Metrics.Redacted()
+	if c.AdminToken != "" {
+		c.AdminToken = redactedValue
+	}
+	return c
+}
+
+func (w Worker) Redacted() Worker {
+	w.Database = w.Database.Redacted()
+	w.Redis = w.Redis.Redacted()
+	w.Encryption = w.Encryption.Redacted()
+	w.Events = w.Events.Redacted()
+	w.Metrics = w.Metrics.Redacted()
+	if w.Email.SMTPPassword != "" {
+		w.Email.SMTPPassword = redactedValue
+	}
+	w.Sinks = w.Sinks.Redacted()
+	if w.AdminToken != "" {
+		w.AdminToken = redactedValue
+	}
+	return w
+}
+
+func (c Controller) Redacted() Controller {
+	c.Redis = c.Redis.Redacted()
+	c.Events = c.Events.Redacted()
+	c.Metrics = c.Metrics.Redacted()
+	c.Alerts = c.Alerts.Redacted()
+	if c.AdminToken != "" {
+		c.AdminToken = redactedValue
+	}
+	return c
+}
+
+// EffectiveConfigHandler serves the redacted static configuration together with the current runtime settings.
+func EffectiveConfigHandler(static any, runtime *RuntimeWatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		response := map[string]any{
+			"static":            static,
+			"runtime":           runtime.Current(),
+			"runtime_source":    runtime.Source(),
+			"runtime_loaded_at": runtime.LoadedAt().Format(time.RFC3339),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(response)
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import "reflect"
+
+// EnvDefaults returns the defaults of the environment variables read into spec, a pointer to a
+// configuration struct, by variable name. Variables without a default are left out.
+func EnvDefaults(spec any) map[string]string {
+	defaults := make(map[string]string)
+	collectEnvDefaults(reflect.TypeOf(spec).Elem(), defaults)
+	return defaults
+}
+
+func collectEnvDefaults(t reflect.Type, defaults map[string]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, tagged := field.Tag.Lookup("envconfig")
+
+		// Nested sections are read with the variable names of their own fields
+		if !tagged && field.Type.Kind() == reflect.Struct {
+			collectEnvDefaults(field.Type, defaults)
+			continue
+		}
+
+		if value, ok := field.Tag.Lookup("default"); ok && tagged && value != "" {
+			defaults[name] = value
+		}
+	}
+}
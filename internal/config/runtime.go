@@ -0,0 +1,479 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"sigs.k8s.io/yaml"
+)
+
+type (
+	// Runtime holds tunable settings that can be changed at runtime through a
+	// ConfigMap-mounted file without restarting the services.
+	Runtime struct {
+		Scaling Scaling        `json:"scaling"`
+		Worker  WorkerRuntime  `json:"worker"`
+		Storage StorageRuntime `json:"storage"`
+		Alerts  AlertsRuntime  `json:"alerts"`
+	}
+
+	Scaling struct {
+		ScaleUpThreshold      int64 `json:"scale_up_threshold"`
+		ScaleDownThreshold    int64 `json:"scale_down_threshold"`
+		JobsPerWorker         int64 `json:"jobs_per_worker"`
+		MinReplicas           int32 `json:"min_replicas"`
+		MaxReplicas           int32 `json:"max_replicas"`
+		MaxScaleUpIncrement   int32 `json:"max_scale_up_increment"`
+		MaxScaleDownDecrement int32 `json:"max_scale_down_decrement"`
+		// ScaleUpStabilization and ScaleDownStabilization work like the HPA stabilization windows:
+		// the controller scales up to the lowest and down to the highest replica count recommended
+		// within the window, so short queue spikes or dips do not move the Deployment.
+		ScaleUpStabilization   Duration `json:"scale_up_stabilization"`
+		ScaleDownStabilization Duration `json:"scale_down_stabilization"`
+		// MinScaleInterval is the minimum time between two scale operations of the same Deployment.
+		MinScaleInterval Duration `json:"min_scale_interval"`
+		// Hysteresis widens the threshold that reverses the last scaling direction by this fraction:
+		// after a scale-up the queue must drop below ScaleDownThreshold*(1-Hysteresis) to scale down,
+		// and after a scale-down exceed ScaleUpThreshold*(1+Hysteresis) to scale up.
+		Hysteresis float64 `json:"hysteresis"`
+		// ProcessingTypes overrides the replica bounds of worker Deployments dedicated to a single
+		// processing type, keyed by that type. A minimum of zero lets an idle type scale to zero.
+		ProcessingTypes map[string]ReplicaBounds `json:"processing_types,omitempty"`
+		// PriorityBurst scales the burst pool: worker Deployments running with PRIORITY_ONLY=true,
+		// which consume only priority queues.
+		PriorityBurst PriorityBurst `json:"priority_burst"`
+	}
+
+	// PriorityBurst starts the burst pool from zero once the priority backlog exceeds Threshold,
+	// sizes it at one replica per JobsPerWorker priority jobs up to MaxReplicas, and scales it
+	// back to zero once the priority queues are drained.
+	PriorityBurst struct {
+		Threshold     int64 `json:"threshold"`
+		JobsPerWorker int64 `json:"jobs_per_worker"`
+		MaxReplicas   int32 `json:"max_replicas"`
+	}
+
+	ReplicaBounds struct {
+		MinReplicas int32 `json:"min_replicas"`
+		MaxReplicas int32 `json:"max_replicas"`
+	}
+
+	WorkerRuntime struct {
+		PollInterval Duration `json:"poll_interval"`
+	}
+
+	StorageRuntime struct {
+		MaxFileSize int64 `json:"max_file_size"`
+		// FileRetention removes uploaded and result files older than this; zero disables cleanup.
+		FileRetention Duration `json:"file_retention"`
+		// TenantQuota caps the bytes of uploads and results each tenant may keep stored; zero disables the cap.
+		TenantQuota int64 `json:"tenant_quota"`
+	}
+
+	// AlertsRuntime lists the alert rules of the controller; when empty, the rules configured by
+	// its ALERT_* variables apply.
+	AlertsRuntime struct {
+		Rules []AlertRule `json:"rules,omitempty"`
+	}
+
+	// AlertRule fires once its condition held for For:
+	//   - queue_depth: more than Threshold jobs are queued.
+	//   - failure_rate: more than Threshold percent of the jobs finished within Window failed, once
+	//     at least MinJobs finished.
+	//   - no_heartbeat: jobs are queued but no worker sent a heartbeat for For; Threshold is unused.
+	//   - failed_queue_size: more than Threshold messages are in the failed queue.
+	//   - failed_queue_age: the oldest message of the failed queue failed more than Threshold
+	//     seconds ago.
+	AlertRule struct {
+		Name      string   `json:"name"`
+		Type      string   `json:"type"`
+		Threshold float64  `json:"threshold,omitempty"`
+		For       Duration `json:"for"`
+		Window    Duration `json:"window,omitempty"`
+		MinJobs   int64    `json:"min_jobs,omitempty"`
+		Severity  string   `json:"severity,omitempty"`
+	}
+
+	// Duration is a time.Duration encoded as a Go duration string ("5s", "1h").
+	Duration struct {
+		time.Duration
+	}
+)
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("parse duration: %w", err)
+	}
+
+	d.Duration = parsed
+	return nil
+}
+
+func (r Runtime) Validate() error {
+	s := r.Scaling
+	if s.MinReplicas <= 0 || s.MaxReplicas < s.MinReplicas {
+		return fmt.Errorf("invalid replica bounds: min=%d max=%d", s.MinReplicas, s.MaxReplicas)
+	}
+
+	if s.ScaleDownThreshold < 0 || s.ScaleUpThreshold <= s.ScaleDownThreshold {
+		return fmt.Errorf("scale up threshold %d must be greater than scale down threshold %d",
+			s.ScaleUpThreshold, s.ScaleDownThreshold)
+	}
+
+	if s.JobsPerWorker <= 0 || s.MaxScaleUpIncrement <= 0 || s.MaxScaleDownDecrement <= 0 {
+		return errors.New("jobs per worker and scaling steps must be positive")
+	}
+
+	if s.ScaleUpStabilization.Duration < 0 || s.ScaleDownStabilization.Duration < 0 || s.MinScaleInterval.Duration < 0 {
+		return errors.New("stabilization windows and min scale interval cannot be negative")
+	}
+
+	if s.Hysteresis < 0 || s.Hysteresis >= 1 {
+		return fmt.Errorf("hysteresis %v must be in [0, 1)", s.Hysteresis)
+	}
+
+	for processingType, bounds := range s.ProcessingTypes {
+		if bounds.MinReplicas < 0 || bounds.MaxReplicas <= 0 || bounds.MaxReplicas < bounds.MinReplicas {
+			return fmt.Errorf("invalid replica bounds for processing type %s: min=%d max=%d",
+				processingType, bounds.MinReplicas, bounds.MaxReplicas)
+		}
+	}
+
+	if b := s.PriorityBurst; b.Threshold < 0 || b.JobsPerWorker <= 0 || b.MaxReplicas <= 0 {
+		return fmt.Errorf("invalid priority burst: threshold=%d jobs_per_worker=%d max_replicas=%d",
+			b.Threshold, b.JobsPerWorker, b.MaxReplicas)
+	}
+
+	if r.Worker.PollInterval.Duration <= 0 {
+		return errors.New("poll interval must be positive")
+	}
+
+	if r.Storage.MaxFileSize <= 0 {
+		return errors.New("max file size must be positive")
+	}
+
+	if r.Storage.FileRetention.Duration < 0 {
+		return errors.New("file retention cannot be negative")
+	}
+
+	if r.Storage.TenantQuota < 0 {
+		return errors.New("tenant storage quota cannot be negative")
+	}
+
+	names := make([]string, 0, len(r.Alerts.Rules))
+	for _, rule := range r.Alerts.Rules {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("alert rule %q: %w", rule.Name, err)
+		}
+		if contains(names, rule.Name) {
+			return fmt.Errorf("duplicate alert rule %q", rule.Name)
+		}
+		names = append(names, rule.Name)
+	}
+
+	return nil
+}
+
+// Alert rule types and severities.
+const (
+	AlertRuleQueueDepth  = "queue_depth"
+	AlertRuleFailureRate = "failure_rate"
+	AlertRuleNoHeartbeat = "no_heartbeat"
+	// AlertRuleFailedQueueSize and AlertRuleFailedQueueAge watch the failed queue.
+	AlertRuleFailedQueueSize = "failed_queue_size"
+	AlertRuleFailedQueueAge  = "failed_queue_age"
+
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
+
+func (r AlertRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+
+	if r.For.Duration < 0 {
+		return errors.New("for cannot be negative")
+	}
+
+	switch r.Type {
+	case AlertRuleQueueDepth:
+		if r.Threshold <= 0 {
+			return errors.New("queue depth threshold must be positive")
+		}
+	case AlertRuleFailureRate:
+		if r.Threshold <= 0 || r.Threshold > 100 {
+			return fmt.Errorf("failure rate threshold %v must be a percentage in (0, 100]", r.Threshold)
+		}
+		if r.Window.Duration <= 0 {
+			return errors.New("failure rate window must be positive")
+		}
+		if r.MinJobs < 0 {
+			return errors.New("min jobs cannot be negative")
+		}
+	case AlertRuleNoHeartbeat:
+		if r.For.Duration <= 0 {
+			return errors.New("heartbeat timeout must be positive")
+		}
+	case AlertRuleFailedQueueSize, AlertRuleFailedQueueAge:
+		if r.Threshold <= 0 {
+			return errors.New("failed queue threshold must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, must be one of %s, %s, %s, %s, %s",
+			r.Type, AlertRuleQueueDepth, AlertRuleFailureRate, AlertRuleNoHeartbeat, AlertRuleFailedQueueSize, AlertRuleFailedQueueAge)
+	}
+
+	if r.Severity != "" && r.Severity != AlertSeverityWarning && r.Severity != AlertSeverityCritical {
+		return fmt.Errorf("severity %q must be %s or %s", r.Severity, AlertSeverityWarning, AlertSeverityCritical)
+	}
+
+	return nil
+}
+
+// LoadRuntime reads the runtime configuration file at path on top of defaults and validates it.
+func LoadRuntime(path string, defaults Runtime) (Runtime, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Runtime{}, fmt.Errorf("read file: %w", err)
+	}
+
+	next := defaults
+	if err := yaml.Unmarshal(data, &next); err != nil {
+		return Runtime{}, fmt.Errorf("parse file: %w", err)
+	}
+
+	if err := next.Validate(); err != nil {
+		return Runtime{}, fmt.Errorf("validate: %w", err)
+	}
+
+	return next, nil
+}
+
+// RuntimeWatcher keeps the effective runtime configuration up to date with the watched file.
+type RuntimeWatcher struct {
+	path     string
+	defaults Runtime
+	log      *slog.Logger
+
+	current  atomic.Pointer[Runtime]
+	loadedAt atomic.Pointer[time.Time]
+
+	mu          sync.Mutex
+	subscribers []func(Runtime)
+}
+
+// Watch loads the runtime configuration file on top of defaults and reloads it whenever it changes.
+// ConfigMap volumes update files by swapping symlinks, so the parent directory is watched.
+// An empty path disables watching and the defaults stay in effect.
+// Invalid updates are logged and ignored, keeping the last good configuration.
+func Watch(ctx context.Context, path string, defaults Runtime, log *slog.Logger) (*RuntimeWatcher, error) {
+	rw := &RuntimeWatcher{
+		path:     path,
+		defaults: defaults,
+		log:      log,
+	}
+	rw.store(defaults)
+
+	if path == "" {
+		return rw, nil
+	}
+
+	if _, err := rw.reload(); err != nil {
+		return nil, fmt.Errorf("load runtime config: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("create file watcher: %w", err)
+	}
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("watch runtime config directory: %w", err)
+	}
+
+	go rw.watch(ctx, watcher)
+
+	return rw, nil
+}
+
+// Current returns the effective runtime configuration.
+func (rw *RuntimeWatcher) Current() Runtime {
+	return *rw.current.Load()
+}
+
+// Subscribe registers a callback invoked after every successful reload.
+func (rw *RuntimeWatcher) Subscribe(fn func(Runtime)) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+
+	rw.subscribers = append(rw.subscribers, fn)
+}
+
+// Source returns the watched file path, empty when runtime reload is disabled.
+func (rw *RuntimeWatcher) Source() string {
+	return rw.path
+}
+
+// LoadedAt returns when the effective configuration was last applied.
+func (rw *RuntimeWatcher) LoadedAt() time.Time {
+	return *rw.loadedAt.Load()
+}
+
+func (rw *RuntimeWatcher) watch(ctx context.Context, watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Chmod) {
+				continue
+			}
+
+			changed, err := rw.reload()
+			if err != nil {
+				rw.log.ErrorContext(ctx, "failed to reload runtime config, keeping previous values",
+					"path", rw.path, "error", err)
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			rw.log.InfoContext(ctx, "runtime config reloaded", "path", rw.path)
+			rw.notify()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			rw.log.ErrorContext(ctx, "runtime config watcher error", "error", err)
+		}
+	}
+}
+
+// reload reads the file and applies it, reporting whether the effective configuration changed.
+func (rw *RuntimeWatcher) reload() (bool, error) {
+	next, err := LoadRuntime(rw.path, rw.defaults)
+	if err != nil {
+		return false, err
+	}
+
+	if reflect.DeepEqual(*rw.current.Load(), next) {
+		return false, nil
+	}
+
+	rw.store(next)
+	return true, nil
+}
+
+func (rw *RuntimeWatcher) store(r Runtime) {
+	now := time.Now()
+	rw.current.Store(&r)
+	rw.loadedAt.Store(&now)
+}
+
+func (rw *RuntimeWatcher) notify() {
+	rw.mu.Lock()
+	subscribers := append([]func(Runtime){}, rw.subscribers...)
+	rw.mu.Unlock()
+
+	current := rw.Current()
+	for _, fn := range subscribers {
+		fn(current)
+	}
+}
+
+const (
+	defaultScaleUpThreshold       = 20
+	defaultScaleDownThreshold     = 5
+	defaultJobsPerWorker          = 10
+	defaultMinReplicas            = 1
+	defaultMaxReplicas            = 10
+	defaultMaxScaleUpIncrement    = 2
+	defaultMaxScaleDownDecrement  = 1
+	defaultScaleDownStabilization = 2 * time.Minute
+	defaultMinScaleInterval       = time.Minute
+	defaultHysteresis             = 0.2
+	defaultBurstThreshold         = 10
+	defaultBurstJobsPerWorker     = 5
+	defaultBurstMaxReplicas       = 3
+	defaultPollInterval           = 5 * time.Second
+	defaultMaxFileSize            = 10 << 20
+)
+
+// ForProcessingTypes returns the scaling settings of a worker Deployment serving the given
+// processing types: the per-type replica bounds when it serves exactly one overridden type,
+// the global bounds otherwise.
+func (s Scaling) ForProcessingTypes(types []string) Scaling {
+	if len(types) != 1 {
+		return s
+	}
+
+	if bounds, ok := s.ProcessingTypes[types[0]]; ok {
+		s.MinReplicas = bounds.MinReplicas
+		s.MaxReplicas = bounds.MaxReplicas
+	}
+	return s
+}
+
+// ForPriorityBurst returns the scaling settings of a burst pool Deployment, which may scale to zero.
+func (s Scaling) ForPriorityBurst() Scaling {
+	s.MinReplicas = 0
+	s.MaxReplicas = s.PriorityBurst.MaxReplicas
+	return s
+}
+
+// DefaultRuntime returns the built-in runtime settings used when no runtime config file overrides them.
+func DefaultRuntime() Runtime {
+	return Runtime{
+		Scaling: Scaling{
+			ScaleUpThreshold:       defaultScaleUpThreshold,
+			ScaleDownThreshold:     defaultScaleDownThreshold,
+			JobsPerWorker:          defaultJobsPerWorker,
+			MinReplicas:            defaultMinReplicas,
+			MaxReplicas:            defaultMaxReplicas,
+			MaxScaleUpIncrement:    defaultMaxScaleUpIncrement,
+			MaxScaleDownDecrement:  defaultMaxScaleDownDecrement,
+			ScaleDownStabilization: Duration{Duration: defaultScaleDownStabilization},
+			MinScaleInterval:       Duration{Duration: defaultMinScaleInterval},
+			Hysteresis:             defaultHysteresis,
+			PriorityBurst: PriorityBurst{
+				Threshold:     defaultBurstThreshold,
+				JobsPerWorker: defaultBurstJobsPerWorker,
+				MaxReplicas:   defaultBurstMaxReplicas,
+			},
+		},
+		Worker: WorkerRuntime{
+			PollInterval: Duration{Duration: defaultPollInterval},
+		},
+		Storage: StorageRuntime{
+			MaxFileSize: defaultMaxFileSize,
+		},
+	}
+}
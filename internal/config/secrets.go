@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rsav/k8s-learning/internal/secrets"
+)
+
+// File names rendered by the Vault agent into VAULT_AGENT_SECRETS_DIR.
+const (
+	VaultDBPasswordFile    = "db-password"
+	VaultRedisPasswordFile = "redis-password"
+)
+
+// Secrets configures external credential sources used when passwords are not set directly.
+type Secrets struct {
+	// VaultAgentDir is the directory a Vault agent sidecar renders secrets into.
+	VaultAgentDir string `envconfig:"VAULT_AGENT_SECRETS_DIR"`
+}
+
+// vaultFile returns the path of a Vault agent rendered secret, or empty if it does not exist.
+func (s Secrets) vaultFile(name string) string {
+	if s.VaultAgentDir == "" {
+		return ""
+	}
+
+	path := filepath.Join(s.VaultAgentDir, name)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// resolvePassword loads the database password from DB_PASSWORD_FILE or the Vault agent directory.
+// A password file takes precedence over DB_PASSWORD.
+func (dc *Database) resolvePassword(s Secrets) error {
+	if dc.PasswordFile == "" {
+		dc.PasswordFile = s.vaultFile(VaultDBPasswordFile)
+	}
+
+	if dc.PasswordFile != "" {
+		password, err := secrets.ReadFile(dc.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("load database password: %w", err)
+		}
+		dc.Password = password
+	}
+
+	if dc.Password == "" {
+		return errors.New("database password is required: set DB_PASSWORD or DB_PASSWORD_FILE")
+	}
+
+	return nil
+}
+
+// resolvePassword loads the Redis password from REDIS_PASSWORD_FILE or the Vault agent directory.
+// A password file takes precedence over REDIS_PASSWORD.
+func (rc *Redis) resolvePassword(s Secrets) error {
+	if rc.PasswordFile == "" {
+		rc.PasswordFile = s.vaultFile(VaultRedisPasswordFile)
+	}
+
+	if rc.PasswordFile == "" {
+		return nil
+	}
+
+	password, err := secrets.ReadFile(rc.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("load redis password: %w", err)
+	}
+	rc.Password = password
+
+	return nil
+}
@@ -0,0 +1,409 @@
+// Package alerts fires anomaly alerts from the queue: when the backlog stays high, when too many
+// jobs fail, when jobs are queued but no worker is alive, or when failed messages pile up or age. Rules are evaluated periodically and
+// notifiers are told when a rule starts and stops firing.
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/controller/metrics"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+// staleHeartbeatAge is the age after which the heartbeat of a worker that did not shut down
+// cleanly is removed.
+const staleHeartbeatAge = 24 * time.Hour
+
+// Queue provides the signals the alert rules evaluate.
+type Queue interface {
+	GetTypeQueueLengths(ctx context.Context) (map[database.ProcessingType]int64, error)
+	GetJobOutcomes(ctx context.Context) (queue.JobOutcomes, error)
+	GetWorkerHeartbeats(ctx context.Context) (map[string]time.Time, error)
+	GetFailedQueueAge(ctx context.Context) (int64, time.Time, error)
+	RemoveHeartbeats(ctx context.Context, workerIDs ...string) error
+}
+
+// Notifier delivers the alerts that start or stop firing.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// State is the state of an alert rule.
+type State string
+
+const (
+	// StateInactive rules do not match.
+	StateInactive State = "inactive"
+	// StatePending rules match, but not yet for their For duration.
+	StatePending State = "pending"
+	// StateFiring rules matched for their For duration.
+	StateFiring State = "firing"
+	// StateResolved is only notified, when a firing rule stops matching.
+	StateResolved State = "resolved"
+)
+
+// Alert is the state of an alert rule, as notified and served.
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Type      string    `json:"type"`
+	Severity  string    `json:"severity"`
+	State     State     `json:"state"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold,omitempty"`
+	Message   string    `json:"message"`
+	Since     time.Time `json:"since,omitzero"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// signals are the observations the rules are evaluated against.
+type signals struct {
+	queued        int64
+	queuedSince   time.Time
+	outcomes      []outcomeSample
+	lastHeartbeat time.Time
+	workers       int
+	failed        int64
+	// oldestFailure is zero when the failed queue is empty.
+	oldestFailure time.Time
+}
+
+type outcomeSample struct {
+	at       time.Time
+	outcomes queue.JobOutcomes
+}
+
+// Engine evaluates the alert rules. The rules are read before every evaluation, so changes of the
+// runtime configuration apply without a restart.
+type Engine struct {
+	queue     Queue
+	rules     func() []config.AlertRule
+	notifiers []Notifier
+	log       *slog.Logger
+
+	// queuedSince and samples are only touched by Evaluate, which mu serializes.
+	queuedSince time.Time
+	samples     []outcomeSample
+
+	mu     sync.Mutex
+	alerts map[string]Alert
+}
+
+// NewEngine creates an engine evaluating rules against q and notifying notifiers.
+func NewEngine(q Queue, rules func() []config.AlertRule, notifiers []Notifier, log *slog.Logger) *Engine {
+	return &Engine{
+		queue:     q,
+		rules:     rules,
+		notifiers: notifiers,
+		log:       log.With("component", "alerts"),
+		alerts:    make(map[string]Alert),
+	}
+}
+
+// Start evaluates the rules every interval until ctx is done.
+func (e *Engine) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	e.log.InfoContext(ctx, "starting alert evaluation", "interval", interval, "rules", len(e.rules()))
+
+	for {
+		if err := e.Evaluate(ctx); err != nil && ctx.Err() == nil {
+			e.log.ErrorContext(ctx, "failed to evaluate alert rules", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Evaluate checks every rule once, notifying the rules that start or stop firing.
+func (e *Engine) Evaluate(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	rules := e.rules()
+	observed, err := e.observe(ctx, now, rules)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]struct{}, len(rules))
+	for _, rule := range rules {
+		names[rule.Name] = struct{}{}
+		e.apply(ctx, rule, now, observed)
+	}
+
+	// Rules removed from the configuration stop firing silently
+	for name := range e.alerts {
+		if _, ok := names[name]; !ok {
+			delete(e.alerts, name)
+			metrics.DeleteAlert(name)
+		}
+	}
+
+	return nil
+}
+
+// observe reads the signals the rules need.
+func (e *Engine) observe(ctx context.Context, now time.Time, rules []config.AlertRule) (signals, error) {
+	lengths, err := e.queue.GetTypeQueueLengths(ctx)
+	if err != nil {
+		return signals{}, err
+	}
+	var queued int64
+	for _, length := range lengths {
+		queued += length
+	}
+	if queued == 0 {
+		e.queuedSince = time.Time{}
+	} else if e.queuedSince.IsZero() {
+		e.queuedSince = now
+	}
+	observed := signals{queued: queued, queuedSince: e.queuedSince}
+
+	var window time.Duration
+	watchHeartbeats, watchFailed := false, false
+	for _, rule := range rules {
+		switch rule.Type {
+		case config.AlertRuleFailureRate:
+			window = max(window, rule.Window.Duration)
+		case config.AlertRuleNoHeartbeat:
+			watchHeartbeats = true
+		case config.AlertRuleFailedQueueSize, config.AlertRuleFailedQueueAge:
+			watchFailed = true
+		}
+	}
+
+	if watchFailed {
+		observed.failed, observed.oldestFailure, err = e.queue.GetFailedQueueAge(ctx)
+		if err != nil {
+			return signals{}, err
+		}
+	}
+
+	if window > 0 {
+		outcomes, err := e.queue.GetJobOutcomes(ctx)
+		if err != nil {
+			return signals{}, err
+		}
+		e.recordOutcomes(now, outcomes, window)
+		observed.outcomes = e.samples
+	}
+
+	if watchHeartbeats {
+		heartbeats, err := e.queue.GetWorkerHeartbeats(ctx)
+		if err != nil {
+			return signals{}, err
+		}
+
+		var stale []string
+		for workerID, at := range heartbeats {
+			if now.Sub(at) > staleHeartbeatAge {
+				stale = append(stale, workerID)
+				continue
+			}
+			observed.workers++
+			if at.After(observed.lastHeartbeat) {
+				observed.lastHeartbeat = at
+			}
+		}
+		if err := e.queue.RemoveHeartbeats(ctx, stale...); err != nil {
+			e.log.WarnContext(ctx, "failed to remove stale heartbeats", "error", err)
+		}
+	}
+
+	return observed, nil
+}
+
+// recordOutcomes adds a sample of the outcome counters, keeping those needed for window.
+func (e *Engine) recordOutcomes(now time.Time, outcomes queue.JobOutcomes, window time.Duration) {
+	// The counters only decrease when Redis lost them, which makes the history meaningless
+	if n := len(e.samples); n > 0 {
+		last := e.samples[n-1].outcomes
+		if outcomes.Succeeded < last.Succeeded || outcomes.Failed < last.Failed {
+			e.samples = nil
+		}
+	}
+	e.samples = append(e.samples, outcomeSample{at: now, outcomes: outcomes})
+
+	// Keep the newest sample at or before the window start as its baseline
+	start := 0
+	for i, sample := range e.samples {
+		if now.Sub(sample.at) >= window {
+			start = i
+		}
+	}
+	e.samples = e.samples[start:]
+}
+
+// apply evaluates rule and moves its alert to the resulting state.
+func (e *Engine) apply(ctx context.Context, rule config.AlertRule, now time.Time, observed signals) {
+	severity := rule.Severity
+	if severity == "" {
+		severity = config.AlertSeverityWarning
+	}
+
+	value, matching, message := evaluate(rule, now, observed)
+	previous, known := e.alerts[rule.Name]
+	alert := Alert{
+		Rule:      rule.Name,
+		Type:      rule.Type,
+		Severity:  severity,
+		State:     StateInactive,
+		Value:     value,
+		Threshold: rule.Threshold,
+		Message:   message,
+		Timestamp: now,
+	}
+
+	switch {
+	case matching && known && previous.State != StateInactive:
+		alert.State, alert.Since = previous.State, previous.Since
+	case matching:
+		alert.State, alert.Since = StatePending, now
+	}
+
+	// The heartbeat timeout is the duration of the rule already
+	holdFor := rule.For.Duration
+	if rule.Type == config.AlertRuleNoHeartbeat {
+		holdFor = 0
+	}
+	if alert.State == StatePending && now.Sub(alert.Since) >= holdFor {
+		alert.State, alert.Since = StateFiring, now
+	}
+
+	e.alerts[rule.Name] = alert
+	metrics.UpdateAlertFiring(rule.Name, severity, alert.State == StateFiring)
+
+	switch {
+	case alert.State == StateFiring && previous.State != StateFiring:
+		e.notify(ctx, alert)
+	case alert.State != StateFiring && previous.State == StateFiring:
+		resolved := alert
+		resolved.State, resolved.Since = StateResolved, previous.Since
+		e.notify(ctx, resolved)
+	}
+}
+
+// evaluate returns the value of the rule, whether it matches and a message describing it.
+func evaluate(rule config.AlertRule, now time.Time, observed signals) (float64, bool, string) {
+	switch rule.Type {
+	case config.AlertRuleQueueDepth:
+		value := float64(observed.queued)
+		return value, value > rule.Threshold,
+			fmt.Sprintf("%d jobs queued, threshold %g", observed.queued, rule.Threshold)
+
+	case config.AlertRuleFailureRate:
+		finished, failed := windowOutcomes(observed.outcomes, now, rule.Window.Duration)
+		if finished == 0 {
+			return 0, false, fmt.Sprintf("no jobs finished within %s", rule.Window.Duration)
+		}
+		rate := float64(failed) / float64(finished) * 100
+		return rate, finished >= rule.MinJobs && rate > rule.Threshold,
+			fmt.Sprintf("%.1f%% of %d jobs failed within %s, threshold %g%%", rate, finished, rule.Window.Duration, rule.Threshold)
+
+	case config.AlertRuleNoHeartbeat:
+		if observed.queued == 0 {
+			return 0, false, "no jobs queued"
+		}
+		// Workers get the timeout to show up after jobs were queued, e.g. when scaling from zero
+		since := observed.queuedSince
+		if observed.lastHeartbeat.After(since) {
+			since = observed.lastHeartbeat
+		}
+		silence := now.Sub(since)
+		return silence.Seconds(), silence >= rule.For.Duration,
+			fmt.Sprintf("no worker heartbeat for %s with %d jobs queued (%d workers known)",
+				silence.Round(time.Second), observed.queued, observed.workers)
+
+	case config.AlertRuleFailedQueueSize:
+		value := float64(observed.failed)
+		return value, value > rule.Threshold,
+			fmt.Sprintf("%d messages in the failed queue, threshold %g", observed.failed, rule.Threshold)
+
+	case config.AlertRuleFailedQueueAge:
+		if observed.failed == 0 {
+			return 0, false, "failed queue is empty"
+		}
+		age := now.Sub(observed.oldestFailure)
+		return age.Seconds(), age.Seconds() > rule.Threshold,
+			fmt.Sprintf("oldest of %d failed queue messages failed %s ago, threshold %s",
+				observed.failed, age.Round(time.Second), time.Duration(rule.Threshold*float64(time.Second)))
+	}
+
+	return 0, false, ""
+}
+
+// windowOutcomes returns how many jobs finished and failed within window, measured from the newest
+// sample at or before the window start, or from the oldest sample while the history is shorter.
+func windowOutcomes(samples []outcomeSample, now time.Time, window time.Duration) (int64, int64) {
+	if len(samples) < 2 {
+		return 0, 0
+	}
+
+	baseline := samples[0]
+	for _, sample := range samples {
+		if now.Sub(sample.at) < window {
+			break
+		}
+		baseline = sample
+	}
+
+	latest := samples[len(samples)-1].outcomes
+	return latest.Total() - baseline.outcomes.Total(), latest.Failed - baseline.outcomes.Failed
+}
+
+// notify logs the alert and passes it to every notifier.
+func (e *Engine) notify(ctx context.Context, alert Alert) {
+	attrs := []any{"rule", alert.Rule, "type", alert.Type, "severity", alert.Severity,
+		"value", alert.Value, "threshold", alert.Threshold, "message", alert.Message}
+	if alert.State == StateFiring {
+		e.log.WarnContext(ctx, "alert firing", attrs...)
+	} else {
+		e.log.InfoContext(ctx, "alert resolved", attrs...)
+	}
+
+	for _, notifier := range e.notifiers {
+		if err := notifier.Notify(ctx, alert); err != nil {
+			e.log.ErrorContext(ctx, "failed to notify alert", "rule", alert.Rule, "state", alert.State, "error", err)
+		}
+	}
+}
+
+// Alerts returns the current state of every rule.
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for _, rule := range e.rules() {
+		if alert, ok := e.alerts[rule.Name]; ok {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// Handler serves the current state of every rule as JSON.
+func (e *Engine) Handler(w http.ResponseWriter, _ *http.Request) {
+	alerts := e.Alerts()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(map[string]any{"count": len(alerts), "alerts": alerts})
+}
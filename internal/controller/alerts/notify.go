@@ -0,0 +1,95 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Event reasons of the Kubernetes Events recorded for alerts.
+const (
+	EventReasonAlertFiring   = "AlertFiring"
+	EventReasonAlertResolved = "AlertResolved"
+)
+
+// KubernetesNotifier records alerts as Kubernetes Events on an object, Warning events for firing
+// alerts and Normal events once they resolve.
+type KubernetesNotifier struct {
+	recorder record.EventRecorder
+	object   *corev1.ObjectReference
+}
+
+func NewKubernetesNotifier(recorder record.EventRecorder, object corev1.ObjectReference) *KubernetesNotifier {
+	return &KubernetesNotifier{recorder: recorder, object: &object}
+}
+
+func (n *KubernetesNotifier) Notify(_ context.Context, alert Alert) error {
+	eventType, reason := corev1.EventTypeWarning, EventReasonAlertFiring
+	if alert.State != StateFiring {
+		eventType, reason = corev1.EventTypeNormal, EventReasonAlertResolved
+	}
+	n.recorder.Eventf(n.object, eventType, reason, "%s (%s): %s", alert.Rule, alert.Severity, alert.Message)
+	return nil
+}
+
+// WebhookNotifier POSTs alerts as JSON to an HTTP endpoint.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	return post(ctx, n.client, n.url, alert)
+}
+
+// SlackNotifier posts alerts as messages to a Slack incoming webhook.
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackNotifier(url string, timeout time.Duration) *SlackNotifier {
+	return &SlackNotifier{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	text := fmt.Sprintf("[%s] %s (%s): %s", strings.ToUpper(string(alert.State)), alert.Rule, alert.Severity, alert.Message)
+	return post(ctx, n.client, n.url, map[string]string{"text": text})
+}
+
+func post(ctx context.Context, client *http.Client, url string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send alert: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("alert endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
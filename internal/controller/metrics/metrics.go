@@ -6,44 +6,94 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rsav/k8s-learning/internal/observability"
 	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/telemetry"
 )
 
 var (
 	// Queue metrics.
-	queueDepthGauge = promauto.NewGaugeVec(
+	queueDepthGauge = telemetry.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "textprocessing_queue_depth",
+			Name: observability.MetricQueueDepth,
 			Help: "Current depth of text processing queues",
 		},
 		[]string{"queue_name"},
 	)
 
+	typeQueueDepthGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: observability.MetricTypeQueueDepth,
+			Help: "Current number of queued jobs per processing type",
+		},
+		[]string{"processing_type"},
+	)
+
+	failedQueueOldestAgeGauge = telemetry.NewGauge(
+		prometheus.GaugeOpts{
+			Name: observability.MetricFailedQueueOldestAge,
+			Help: "Seconds since the oldest message of the failed queue failed, 0 when it is empty",
+		},
+	)
+
 	// Scaling metrics.
-	autoscalingEventsCounter = promauto.NewCounterVec(
+	autoscalingEventsCounter = telemetry.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "textprocessing_autoscaling_events_total",
+			Name: observability.MetricAutoscalingEventsTotal,
 			Help: "Total number of autoscaling events",
 		},
 		[]string{"job_name", "direction"},
 	)
 
-	currentReplicasGauge = promauto.NewGaugeVec(
+	capacityLimitedCounter = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: observability.MetricCapacityLimitedTotal,
+			Help: "Total number of scale-ups lowered to the replicas the cluster can schedule",
+		},
+		[]string{"job_name"},
+	)
+
+	currentReplicasGauge = telemetry.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "textprocessing_current_replicas",
+			Name: observability.MetricCurrentReplicas,
 			Help: "Current number of replicas for each TextProcessingJob",
 		},
 		[]string{"job_name", "processing_type"},
 	)
 
-	desiredReplicasGauge = promauto.NewGaugeVec(
+	desiredReplicasGauge = telemetry.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "textprocessing_desired_replicas",
 			Help: "Desired number of replicas for each TextProcessingJob",
 		},
 		[]string{"job_name", "processing_type"},
 	)
+
+	// Resource recommendation metrics.
+	recommendedResourcesGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: observability.MetricRecommendedResources,
+			Help: "Recommended worker container requests and limits, CPU in cores and memory in bytes",
+		},
+		[]string{"job_name", "container", "resource", "kind"},
+	)
+
+	workerThroughputGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: observability.MetricWorkerThroughput,
+			Help: "Jobs consumed per minute by each worker Deployment",
+		},
+		[]string{"job_name"},
+	)
+
+	// Alert metrics.
+	alertFiringGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "textprocessing_alert_firing",
+			Help: "Whether each alert rule is firing (1) or not (0)",
+		},
+		[]string{"rule", "severity"},
+	)
 )
 
 // Collector collects and updates Prometheus metrics.
@@ -96,8 +146,31 @@ func (m *Collector) CollectQueueMetrics(ctx context.Context) error {
 		queueDepthGauge.WithLabelValues(queueName).Set(float64(length))
 	}
 
+	// The failed queue size is its queue depth; its age tells whether failures are being handled
+	failed, oldestFailure, err := m.queue.GetFailedQueueAge(ctx)
+	if err != nil {
+		return err
+	}
+	if failed == 0 {
+		failedQueueOldestAgeGauge.Set(0)
+	} else {
+		failedQueueOldestAgeGauge.Set(time.Since(oldestFailure).Seconds())
+	}
+
+	typeLengths, err := m.queue.GetTypeQueueLengths(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Drained type queues disappear from Redis, so stale series are dropped before setting current ones
+	typeQueueDepthGauge.Reset()
+	for processingType, length := range typeLengths {
+		typeQueueDepthGauge.WithLabelValues(string(processingType)).Set(float64(length))
+	}
+
 	m.log.DebugContext(ctx, "collected queue metrics",
-		"queue_lengths", queueLengths)
+		"queue_lengths", queueLengths,
+		"type_queue_lengths", typeLengths)
 
 	return nil
 }
@@ -107,8 +180,43 @@ func RecordAutoscalingEvent(jobName, direction string) {
 	autoscalingEventsCounter.WithLabelValues(jobName, direction).Inc()
 }
 
+// RecordCapacityLimited records a scale-up lowered by cluster capacity.
+func RecordCapacityLimited(jobName string) {
+	capacityLimitedCounter.WithLabelValues(jobName).Inc()
+}
+
 // UpdateReplicasMetrics updates replica count metrics.
 func UpdateReplicasMetrics(jobName, processingType string, current, desired int32) {
 	currentReplicasGauge.WithLabelValues(jobName, processingType).Set(float64(current))
 	desiredReplicasGauge.WithLabelValues(jobName, processingType).Set(float64(desired))
 }
+
+// UpdateResourceRecommendation records a recommended request or limit of a worker container.
+func UpdateResourceRecommendation(jobName, container, resource, kind string, value float64) {
+	recommendedResourcesGauge.WithLabelValues(jobName, container, resource, kind).Set(value)
+}
+
+// UpdateWorkerThroughput records the jobs consumed per minute by a worker Deployment.
+func UpdateWorkerThroughput(jobName string, jobsPerMinute float64) {
+	workerThroughputGauge.WithLabelValues(jobName).Set(jobsPerMinute)
+}
+
+// DeleteResourceRecommendations drops the recommendation series of a removed worker Deployment.
+func DeleteResourceRecommendations(jobName string) {
+	recommendedResourcesGauge.DeletePartialMatch(prometheus.Labels{"job_name": jobName})
+	workerThroughputGauge.DeletePartialMatch(prometheus.Labels{"job_name": jobName})
+}
+
+// UpdateAlertFiring records whether an alert rule is firing.
+func UpdateAlertFiring(rule, severity string, firing bool) {
+	value := 0.0
+	if firing {
+		value = 1
+	}
+	alertFiringGauge.WithLabelValues(rule, severity).Set(value)
+}
+
+// DeleteAlert drops the series of a removed alert rule.
+func DeleteAlert(rule string) {
+	alertFiringGauge.DeletePartialMatch(prometheus.Labels{"rule": rule})
+}
@@ -0,0 +1,71 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// CheckAccess verifies that the controller may read and scale Deployments, record Events and,
+// with resource recommendations enabled, read pod metrics in every worker namespace, and that it
+// may list nodes and pods when the capacity guard is enabled. It is called at startup so that missing RBAC fails the controller
+// instead of leaving the workers unscaled.
+func (r *Worker) CheckAccess(ctx context.Context) error {
+	required := []authorizationv1.ResourceAttributes{
+		{Group: "apps", Resource: "deployments", Verb: "get"},
+		{Group: "apps", Resource: "deployments", Verb: "list"},
+		{Group: "", Resource: "events", Verb: "create"},
+	}
+	if !r.Config.DryRun {
+		required = append(required, authorizationv1.ResourceAttributes{Group: "apps", Resource: "deployments", Verb: "patch"})
+	}
+	if r.Config.ResourceRecommendations {
+		required = append(required, authorizationv1.ResourceAttributes{Group: "metrics.k8s.io", Resource: "pods", Verb: "list"})
+	}
+
+	var errs []error
+	if r.Config.CapacityGuard {
+		// Capacity is cluster-wide: nodes are not namespaced and pending pods anywhere compete for them
+		for _, attributes := range []authorizationv1.ResourceAttributes{
+			{Group: "", Resource: "nodes", Verb: "list"},
+			{Group: "", Resource: "pods", Verb: "list"},
+		} {
+			if err := r.reviewAccess(ctx, attributes); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	for _, namespace := range r.Config.WorkerNamespaces {
+		for _, attributes := range required {
+			attributes.Namespace = namespace
+			if err := r.reviewAccess(ctx, attributes); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// reviewAccess returns an error unless the controller is allowed the given access. An empty
+// namespace means all namespaces.
+func (r *Worker) reviewAccess(ctx context.Context, attributes authorizationv1.ResourceAttributes) error {
+	scope := "cluster-wide"
+	if attributes.Namespace != "" {
+		scope = "in namespace " + attributes.Namespace
+	}
+
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+	}
+	if err := r.Create(ctx, review); err != nil {
+		return fmt.Errorf("review access to %s %s: %w", attributes.Resource, scope, err)
+	}
+	if !review.Status.Allowed {
+		return fmt.Errorf("not allowed to %s %s %s", attributes.Verb, attributes.Resource, scope)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// schedulableReplicas estimates how many more pods of the Deployment's template the cluster can
+// schedule: the free allocatable CPU and memory of each Ready, schedulable node, minus what pending
+// pods are still waiting for. ok is false when the template requests neither CPU nor memory, in
+// which case the scheduler never runs out of room for it.
+func (r *Worker) schedulableReplicas(ctx context.Context, deployment *appsv1.Deployment) (replicas int64, ok bool, err error) {
+	podCPU, podMemory := podRequests(&deployment.Spec.Template.Spec)
+	if podCPU == 0 && podMemory == 0 {
+		return 0, false, nil
+	}
+
+	var nodes corev1.NodeList
+	if err := r.List(ctx, &nodes); err != nil {
+		return 0, false, fmt.Errorf("list nodes: %w", err)
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods); err != nil {
+		return 0, false, fmt.Errorf("list pods: %w", err)
+	}
+
+	type usage struct{ cpu, memory int64 }
+	requested := make(map[string]usage, len(nodes.Items))
+	var pending usage
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		cpu, memory := podRequests(&pod.Spec)
+		if pod.Spec.NodeName == "" {
+			pending.cpu += cpu
+			pending.memory += memory
+			continue
+		}
+		node := requested[pod.Spec.NodeName]
+		requested[pod.Spec.NodeName] = usage{cpu: node.cpu + cpu, memory: node.memory + memory}
+	}
+
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !nodeSchedulable(node) {
+			continue
+		}
+
+		used := requested[node.Name]
+		replicas += fits(
+			node.Status.Allocatable.Cpu().MilliValue()-used.cpu,
+			node.Status.Allocatable.Memory().Value()-used.memory,
+			podCPU, podMemory)
+	}
+
+	// Pending pods will take room first; count it in replicas of this template
+	replicas -= int64(math.Ceil(max(ratio(pending.cpu, podCPU), ratio(pending.memory, podMemory))))
+	return max(replicas, 0), true, nil
+}
+
+// podRequests sums the CPU (millicores) and memory (bytes) requests of a pod's containers. An init
+// container runs alone, so it only matters when it requests more than all containers together.
+func podRequests(spec *corev1.PodSpec) (cpu, memory int64) {
+	for _, container := range spec.Containers {
+		cpu += requestOf(container, corev1.ResourceCPU).MilliValue()
+		memory += requestOf(container, corev1.ResourceMemory).Value()
+	}
+	for _, container := range spec.InitContainers {
+		cpu = max(cpu, requestOf(container, corev1.ResourceCPU).MilliValue())
+		memory = max(memory, requestOf(container, corev1.ResourceMemory).Value())
+	}
+	return cpu, memory
+}
+
+func requestOf(container corev1.Container, name corev1.ResourceName) *resource.Quantity {
+	quantity := container.Resources.Requests[name]
+	return &quantity
+}
+
+// nodeSchedulable reports whether new pods can land on the node: it is Ready, not cordoned and
+// has no NoSchedule or NoExecute taint.
+func nodeSchedulable(node *corev1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute {
+			return false
+		}
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// fits returns how many pods requesting podCPU and podMemory fit into the free capacity.
+func fits(freeCPU, freeMemory, podCPU, podMemory int64) int64 {
+	if freeCPU < 0 || freeMemory < 0 {
+		return 0
+	}
+
+	count := int64(math.MaxInt64)
+	if podCPU > 0 {
+		count = freeCPU / podCPU
+	}
+	if podMemory > 0 {
+		count = min(count, freeMemory/podMemory)
+	}
+	return count
+}
+
+func ratio(amount, per int64) float64 {
+	if per == 0 {
+		return 0
+	}
+	return float64(amount) / float64(per)
+}
+
+// capToCapacity lowers a scale-up target to what the cluster can schedule, never below current.
+// It reports whether the target was lowered.
+func (r *Worker) capToCapacity(ctx context.Context, deployment *appsv1.Deployment, current, target int32) (int32, bool, error) {
+	headroom, ok, err := r.schedulableReplicas(ctx, deployment)
+	if err != nil || !ok {
+		return target, false, err
+	}
+
+	capped := int64(current) + headroom
+	if capped >= int64(target) {
+		return target, false, nil
+	}
+	return max(int32(capped), current), true, nil //nolint:gosec // capped < target, an int32
+}
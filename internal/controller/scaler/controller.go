@@ -2,57 +2,136 @@ package scaler
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/rsav/k8s-learning/internal/config"
 	"github.com/rsav/k8s-learning/internal/controller/metrics"
+	"github.com/rsav/k8s-learning/internal/federation"
 	"github.com/rsav/k8s-learning/internal/storage/queue"
 )
 
 const (
-	WorkerDeploymentName      = "worker"
-	WorkerDeploymentNamespace = "k8s-learning"
-
-	DefaultMinReplicas    = 1
-	DefaultMaxReplicas    = 10
-	ScaleUpThreshold      = 20 // Scale up when queue depth > 20
-	ScaleDownThreshold    = 5  // Scale down when queue depth < 5
-	JobsPerWorker         = 10 // Estimated jobs per worker capacity
-	MaxScaleUpIncrement   = 2  // Maximum replicas to add per scaling event
-	MaxScaleDownDecrement = 1  // Maximum replicas to remove per scaling event
+	// ProcessingTypesEnv is the worker container variable listing the processing types a Deployment
+	// serves. Deployments without it serve every type that no other discovered Deployment claims.
+	ProcessingTypesEnv = "PROCESSING_TYPES"
+	// PriorityOnlyEnv marks a worker Deployment as the burst pool, scaled by the priority backlog only.
+	PriorityOnlyEnv = "PRIORITY_ONLY"
+
+	allProcessingTypes  = "all"
+	priorityLabelPrefix = "priority:"
+)
+
+// Event reasons recorded on the worker Deployment.
+const (
+	EventReasonScaledUp               = "ScaledUp"
+	EventReasonScaledDown             = "ScaledDown"
+	EventReasonQueueThresholdExceeded = "QueueThresholdExceeded"
+	EventReasonReconcileFailed        = "ReconcileFailed"
+	EventReasonResourcesUpdated       = "ResourcesUpdated"
+	EventReasonCapacityLimited        = "CapacityLimited"
 )
 
 type Worker struct {
 	client.Client
 
-	Log    *slog.Logger
-	Queue  *queue.RedisQueue
-	Config config.Controller
+	Log      *slog.Logger
+	Queue    *queue.RedisQueue
+	Config   config.Controller
+	Recorder record.EventRecorder
+	// Runtime supplies scaling thresholds and replica bounds, reloaded without restarts.
+	Runtime *config.RuntimeWatcher
+	// Federation reports the backlog of the other regions, nil unless the queue is federated.
+	// Scaling only follows the local backlog, since workers consume from their own region.
+	Federation *federation.Federation
+
+	// states holds stabilization state and lastDecisions the latest decision per Deployment, both
+	// keyed by namespace/name and guarded by stateMu, since StateHandler reads them.
+	states        map[string]*scaleState
+	lastDecisions map[string]Decision
+	stateMu       sync.Mutex
+
+	triggers     chan struct{}
+	triggersOnce sync.Once
+
+	// usage holds sampled pod usage per Deployment and is only accessed from the recommendation
+	// loop; recommendations is also read by ResourcesHandler.
+	usage             map[string]*usageHistory
+	recommendations   map[string]ResourceRecommendation
+	recommendationsMu sync.RWMutex
+}
+
+// workerDeployment is a discovered worker Deployment with the processing types it serves,
+// empty when it serves all unclaimed types.
+type workerDeployment struct {
+	deployment appsv1.Deployment
+	types      []string
+	// priorityOnly marks the burst pool, whose workers consume only priority queues.
+	priorityOnly bool
+}
+
+func (wd workerDeployment) typesLabel() string {
+	label := strings.Join(wd.types, ",")
+	if len(wd.types) == 0 {
+		label = allProcessingTypes
+	}
+	if wd.priorityOnly {
+		return priorityLabelPrefix + label
+	}
+	return label
 }
 
+// StartPeriodicScaling reconciles worker Deployments every ReconcileInterval and, between ticks,
+// shortly after Trigger is called.
 func (r *Worker) StartPeriodicScaling(ctx context.Context) {
 	ticker := time.NewTicker(r.Config.ReconcileInterval)
 	defer ticker.Stop()
 
 	r.Log.InfoContext(ctx, "starting periodic reconciliation",
-		"interval", r.Config.ReconcileInterval)
+		"interval", r.Config.ReconcileInterval,
+		"namespaces", r.Config.WorkerNamespaces,
+		"selector", r.Config.WorkerSelector,
+		"deployments", r.Config.WorkerDeployments)
 
+	// debounce is armed by the first trigger of a burst, so a burst causes a single evaluation
+	var debounce <-chan time.Time
 	for {
 		select {
 		case <-ticker.C:
 			// Call scaling logic directly - no controller-runtime reconcile needed
-			err := r.scaleWorkerDeployment(ctx)
+			err := r.scaleWorkerDeployments(ctx)
 			if err != nil {
 				r.Log.ErrorContext(ctx, "periodic scaling failed", "error", err)
 			}
 
+		case <-r.triggerChannel():
+			if debounce == nil {
+				debounce = time.After(r.Config.ScaleTriggerDebounce)
+			}
+
+		case <-debounce:
+			debounce = nil
+			r.Log.DebugContext(ctx, "jobs enqueued, evaluating scaling")
+			if err := r.scaleWorkerDeployments(ctx); err != nil {
+				r.Log.ErrorContext(ctx, "triggered scaling failed", "error", err)
+			}
+			// The periodic loop is only a fallback, so restart its interval
+			ticker.Reset(r.Config.ReconcileInterval)
+
 		case <-ctx.Done():
 			r.Log.InfoContext(ctx, "stopping periodic reconciliation")
 			return
@@ -60,94 +139,433 @@ func (r *Worker) StartPeriodicScaling(ctx context.Context) {
 	}
 }
 
-func (r *Worker) scaleWorkerDeployment(ctx context.Context) error {
+// Trigger requests a scaling evaluation ahead of the next periodic one. It never blocks; triggers
+// arriving while one is pending are coalesced.
+func (r *Worker) Trigger() {
+	select {
+	case r.triggerChannel() <- struct{}{}:
+	default:
+	}
+}
+
+func (r *Worker) triggerChannel() chan struct{} {
+	r.triggersOnce.Do(func() {
+		r.triggers = make(chan struct{}, 1)
+	})
+	return r.triggers
+}
+
+// scaleWorkerDeployments scales every discovered worker Deployment by the backlog of its processing types.
+func (r *Worker) scaleWorkerDeployments(ctx context.Context) error {
 	log := r.Log.With("worker-scaler", "queue-monitor")
 	log.DebugContext(ctx, "starting worker scaling reconciliation")
 
-	// Get current worker deployment
-	var deployment appsv1.Deployment
-	deploymentKey := types.NamespacedName{
-		Name:      WorkerDeploymentName,
-		Namespace: WorkerDeploymentNamespace,
-	}
-
-	if err := r.Get(ctx, deploymentKey, &deployment); err != nil {
-		if apierrors.IsNotFound(err) {
-			log.InfoContext(ctx, "worker deployment not found, skipping scaling")
-			return nil
-		}
-		log.ErrorContext(ctx, "failed to get worker deployment", "error", err)
+	workers, err := r.discoverWorkerDeployments(ctx)
+	if err != nil {
+		log.ErrorContext(ctx, "failed to list worker deployments", "error", err)
 		return err
 	}
+	if len(workers) == 0 {
+		log.InfoContext(ctx, "no worker deployments found, skipping scaling",
+			"namespaces", r.Config.WorkerNamespaces, "selector", r.Config.WorkerSelector,
+			"deployments", r.Config.WorkerDeployments)
+		return nil
+	}
 
 	// Get current queue metrics
-	queueStats, err := r.getQueueStats(ctx)
+	backlog, err := r.getBacklog(ctx)
 	if err != nil {
 		log.ErrorContext(ctx, "failed to get queue stats", "error", err)
+		for i := range workers {
+			r.Recorder.Eventf(&workers[i].deployment, corev1.EventTypeWarning, EventReasonReconcileFailed,
+				"Failed to read queue depth: %v", err)
+		}
 		// Continue with last known values, don't fail reconciliation
-		queueStats = &QueueStats{TotalDepth: 0}
+		backlog = &Backlog{ByType: map[string]int64{}}
+	}
+
+	claimed := claimedTypes(workers)
+
+	scaling := r.Runtime.Current().Scaling
+	var errs []error
+	for i := range workers {
+		deploymentScaling, stats := workers[i].scalingInputs(scaling, backlog, claimed)
+		if err := r.scaleWorkerDeployment(ctx, &workers[i], deploymentScaling, stats, backlog.ProcessingPaused); err != nil {
+			errs = append(errs, fmt.Errorf("scale deployment %s: %w", workers[i].deployment.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// scalingInputs returns the scaling settings and backlog the Deployment is scaled by.
+func (wd *workerDeployment) scalingInputs(scaling config.Scaling, backlog *Backlog, claimed map[string]bool) (config.Scaling, *QueueStats) {
+	if wd.priorityOnly {
+		return scaling.ForPriorityBurst(), backlog.priorityStatsFor(wd.types)
+	}
+	return scaling.ForProcessingTypes(wd.types), backlog.statsFor(wd.types, claimed)
+}
+
+// recommendReplicas returns the replicas the backlog alone calls for, before stabilization and cooldown.
+func (wd *workerDeployment) recommendReplicas(scaling config.Scaling, stats *QueueStats, current int32, lastDirection int) int32 {
+	if wd.priorityOnly {
+		return burstReplicas(scaling.PriorityBurst, stats, current)
+	}
+	return calculateOptimalReplicas(withHysteresis(scaling, lastDirection), stats, current)
+}
+
+// currentReplicas returns the Deployment's desired replicas, which default to one when unset.
+func (wd *workerDeployment) currentReplicas() int32 {
+	if wd.deployment.Spec.Replicas == nil {
+		return 1
+	}
+	return *wd.deployment.Spec.Replicas
+}
+
+// claimedTypes returns the processing types served by a dedicated Deployment. The burst pool only
+// helps with priority jobs, so it claims none.
+func claimedTypes(workers []workerDeployment) map[string]bool {
+	claimed := make(map[string]bool)
+	for _, wd := range workers {
+		if wd.priorityOnly {
+			continue
+		}
+		for _, processingType := range wd.types {
+			claimed[processingType] = true
+		}
+	}
+	return claimed
+}
+
+// discoverWorkerDeployments lists the Deployments matching the configured worker selector in every
+// worker namespace, keeping only WorkerDeployments when it is set.
+func (r *Worker) discoverWorkerDeployments(ctx context.Context) ([]workerDeployment, error) {
+	selector, err := labels.Parse(r.Config.WorkerSelector)
+	if err != nil {
+		return nil, fmt.Errorf("parse worker selector: %w", err)
+	}
+
+	var workers []workerDeployment
+	found := make(map[string]bool)
+	for _, namespace := range r.Config.WorkerNamespaces {
+		var deployments appsv1.DeploymentList
+		if err := r.List(ctx, &deployments,
+			client.InNamespace(namespace),
+			client.MatchingLabelsSelector{Selector: selector},
+		); err != nil {
+			if apierrors.IsForbidden(err) {
+				return nil, fmt.Errorf("list deployments in namespace %s: forbidden, check the controller RBAC: %w", namespace, err)
+			}
+			return nil, fmt.Errorf("list deployments in namespace %s: %w", namespace, err)
+		}
+
+		for _, deployment := range deployments.Items {
+			if len(r.Config.WorkerDeployments) > 0 && !slices.Contains(r.Config.WorkerDeployments, deployment.Name) {
+				continue
+			}
+			found[deployment.Name] = true
+			priorityOnly, _ := strconv.ParseBool(templateEnv(&deployment, PriorityOnlyEnv))
+			workers = append(workers, workerDeployment{
+				deployment:   deployment,
+				types:        deploymentProcessingTypes(&deployment),
+				priorityOnly: priorityOnly,
+			})
+		}
+	}
+
+	for _, name := range r.Config.WorkerDeployments {
+		if !found[name] {
+			r.Log.WarnContext(ctx, "configured worker deployment not found",
+				"deployment", name, "namespaces", r.Config.WorkerNamespaces, "selector", r.Config.WorkerSelector)
+		}
+	}
+
+	return workers, nil
+}
+
+// deploymentProcessingTypes reads ProcessingTypesEnv from the Deployment's pod template, the same
+// value the workers consume jobs by.
+func deploymentProcessingTypes(deployment *appsv1.Deployment) []string {
+	var types []string
+	for _, processingType := range strings.Split(templateEnv(deployment, ProcessingTypesEnv), ",") {
+		if processingType = strings.TrimSpace(processingType); processingType != "" {
+			types = append(types, processingType)
+		}
+	}
+	slices.Sort(types)
+	return slices.Compact(types)
+}
+
+// templateEnv returns the value of the first env variable named name in the Deployment's pod
+// template, empty when no container sets it.
+func templateEnv(deployment *appsv1.Deployment, name string) string {
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		for _, env := range container.Env {
+			if env.Name == name {
+				return env.Value
+			}
+		}
+	}
+	return ""
+}
+
+func (r *Worker) scaleWorkerDeployment(
+	ctx context.Context, wd *workerDeployment, scaling config.Scaling, queueStats *QueueStats, processingPaused bool,
+) error {
+	deployment := &wd.deployment
+	log := r.Log.With("worker-scaler", "queue-monitor", "deployment", deployment.Name, "processing_types", wd.typesLabel())
+
+	threshold := scaling.ScaleUpThreshold
+	if wd.priorityOnly {
+		threshold = scaling.PriorityBurst.Threshold
+	}
+	if queueStats.TotalDepth > threshold {
+		r.Recorder.Eventf(deployment, corev1.EventTypeNormal, EventReasonQueueThresholdExceeded,
+			"Queue depth %d exceeds scale-up threshold %d", queueStats.TotalDepth, threshold)
 	}
 
 	// Calculate optimal replica count
-	currentReplicas := *deployment.Spec.Replicas
-	optimalReplicas := r.calculateOptimalReplicas(queueStats, currentReplicas)
+	currentReplicas := wd.currentReplicas()
+	now := time.Now()
+	r.stateMu.Lock()
+	state := r.stateFor(deployment)
+	recommended := wd.recommendReplicas(scaling, queueStats, currentReplicas, state.lastDirection)
+	scaleDecision := decideReplicas(scaling, recommended, currentReplicas, state, now)
+	r.stateMu.Unlock()
+	if processingPaused {
+		scaleDecision.holdUp(currentReplicas)
+	}
+	if r.Config.CapacityGuard && scaleDecision.Target > currentReplicas {
+		r.guardCapacity(ctx, deployment, currentReplicas, &scaleDecision)
+	}
+	optimalReplicas := scaleDecision.Target
 
 	log.InfoContext(ctx, "scaling analysis",
 		"current_replicas", currentReplicas,
+		"recommended_replicas", scaleDecision.Recommended,
 		"optimal_replicas", optimalReplicas,
-		"queue_depth", queueStats.TotalDepth)
-
-	// Update deployment if scaling is needed
-	if optimalReplicas != currentReplicas {
-		err := r.updateDeploymentReplicas(ctx, &deployment, optimalReplicas)
-		if err != nil {
-			log.ErrorContext(ctx, "failed to update worker deployment", "error", err)
-			return err
-		}
+		"hold_reason", scaleDecision.HoldReason,
+		"queue_depth", queueStats.TotalDepth,
+		"dry_run", r.Config.DryRun)
+
+	decision := Decision{
+		Timestamp:           now.UTC(),
+		Deployment:          deployment.Name,
+		Namespace:           deployment.Namespace,
+		ProcessingTypes:     wd.typesLabel(),
+		QueueDepth:          queueStats.TotalDepth,
+		CurrentReplicas:     currentReplicas,
+		ActiveWorkers:       deployment.Status.ReadyReplicas,
+		MinReplicas:         scaling.MinReplicas,
+		MaxReplicas:         scaling.MaxReplicas,
+		RecommendedReplicas: scaleDecision.Recommended,
+		TargetReplicas:      optimalReplicas,
+		HoldReason:          scaleDecision.HoldReason,
+		Outcome:             DecisionUnchanged,
+	}
+	defer func() { r.recordDecision(ctx, decision) }()
 
-		// Record scaling event
-		direction := "up"
-		if optimalReplicas < currentReplicas {
-			direction = "down"
-		}
-		metrics.RecordAutoscalingEvent("worker-deployment", direction)
+	// Update metrics
+	metrics.UpdateReplicasMetrics(deployment.Name, wd.typesLabel(), currentReplicas, optimalReplicas)
 
-		log.InfoContext(ctx, "scaled worker deployment",
+	if optimalReplicas == currentReplicas {
+		return nil
+	}
+
+	if r.Config.DryRun {
+		decision.Outcome = DecisionDryRun
+		log.InfoContext(ctx, "dry run: skipping worker deployment scaling",
 			"from", currentReplicas,
-			"to", optimalReplicas,
-			"direction", direction,
-			"reason", fmt.Sprintf("queue_depth=%d", queueStats.TotalDepth))
+			"to", optimalReplicas)
+		return nil
 	}
 
-	// Update metrics
-	metrics.UpdateReplicasMetrics("worker-deployment", "mixed", currentReplicas, optimalReplicas)
+	// Update deployment since scaling is needed
+	if err := r.updateDeploymentReplicas(ctx, deployment, optimalReplicas); err != nil {
+		decision.Outcome = DecisionFailed
+		decision.Error = err.Error()
+		log.ErrorContext(ctx, "failed to update worker deployment", "error", err)
+		r.Recorder.Eventf(deployment, corev1.EventTypeWarning, EventReasonReconcileFailed,
+			"Failed to scale from %d to %d replicas: %v", currentReplicas, optimalReplicas, err)
+		return err
+	}
+	decision.Outcome = DecisionApplied
+	r.stateMu.Lock()
+	state.scaled(now, currentReplicas, optimalReplicas)
+	r.stateMu.Unlock()
+
+	// Record scaling event
+	direction := "up"
+	reason := EventReasonScaledUp
+	if optimalReplicas < currentReplicas {
+		direction = "down"
+		reason = EventReasonScaledDown
+	}
+	metrics.RecordAutoscalingEvent(deployment.Name, direction)
+	r.Recorder.Eventf(deployment, corev1.EventTypeNormal, reason,
+		"Scaled from %d to %d replicas (queue depth %d)", currentReplicas, optimalReplicas, queueStats.TotalDepth)
+
+	log.InfoContext(ctx, "scaled worker deployment",
+		"from", currentReplicas,
+		"to", optimalReplicas,
+		"direction", direction,
+		"reason", fmt.Sprintf("queue_depth=%d", queueStats.TotalDepth))
 	return nil
 }
 
+// guardCapacity lowers a scale-up to the replicas the cluster can schedule. When capacity cannot be
+// determined the scale-up proceeds, since unschedulable pods are better than an idle scaler.
+func (r *Worker) guardCapacity(ctx context.Context, deployment *appsv1.Deployment, current int32, decision *scaleDecision) {
+	capped, limited, err := r.capToCapacity(ctx, deployment, current, decision.Target)
+	if err != nil {
+		r.Log.WarnContext(ctx, "failed to check cluster capacity, scaling without limit",
+			"deployment", deployment.Name, "error", err)
+		return
+	}
+	if !limited {
+		return
+	}
+
+	r.Log.InfoContext(ctx, "scale-up limited by cluster capacity",
+		"deployment", deployment.Name, "target_replicas", decision.Target, "schedulable_replicas", capped)
+	metrics.RecordCapacityLimited(deployment.Name)
+	r.Recorder.Eventf(deployment, corev1.EventTypeWarning, EventReasonCapacityLimited,
+		"Scale-up to %d replicas limited to %d by allocatable cluster capacity", decision.Target, capped)
+
+	decision.Target = capped
+	decision.HoldReason = HoldReasonCapacity
+}
+
+// stateFor returns the stabilization state of the Deployment, creating it on first use. Callers
+// hold stateMu.
+func (r *Worker) stateFor(deployment *appsv1.Deployment) *scaleState {
+	if r.states == nil {
+		r.states = make(map[string]*scaleState)
+	}
+
+	key := deploymentKey(deployment)
+	state, ok := r.states[key]
+	if !ok {
+		state = &scaleState{}
+		r.states[key] = state
+	}
+	return state
+}
+
 // QueueStats holds queue statistics.
 type QueueStats struct {
 	TotalDepth int64
 }
 
-func (r *Worker) getQueueStats(ctx context.Context) (*QueueStats, error) {
+// Backlog is the number of queued jobs per processing type, plus jobs in the shared queues
+// that predate per-type queues. PriorityByType and SharedPriority are the priority jobs among them.
+type Backlog struct {
+	ByType         map[string]int64
+	Shared         int64
+	PriorityByType map[string]int64
+	SharedPriority int64
+	// ProcessingPaused is set while processing is paused through the API; workers are not scaled
+	// up then, since they would idle.
+	ProcessingPaused bool
+}
+
+// statsFor returns the backlog of a Deployment serving types. A Deployment without types serves
+// the shared queues and every type not claimed by another Deployment.
+func (b *Backlog) statsFor(types []string, claimed map[string]bool) *QueueStats {
+	depth := sumServed(b.ByType, types, claimed)
+	if len(types) == 0 {
+		depth += b.Shared
+	}
+	return &QueueStats{TotalDepth: depth}
+}
+
+// priorityStatsFor returns the priority backlog of the burst pool serving types, or every type when
+// it has none.
+func (b *Backlog) priorityStatsFor(types []string) *QueueStats {
+	depth := sumServed(b.PriorityByType, types, nil)
+	if len(types) == 0 {
+		depth += b.SharedPriority
+	}
+	return &QueueStats{TotalDepth: depth}
+}
+
+// sumServed sums the per-type counts of the types a Deployment serves: its own types, or every
+// type not claimed by another Deployment when it has none.
+func sumServed(byType map[string]int64, types []string, claimed map[string]bool) int64 {
+	var sum int64
+	if len(types) == 0 {
+		for processingType, count := range byType {
+			if !claimed[processingType] {
+				sum += count
+			}
+		}
+		return sum
+	}
+
+	for _, processingType := range types {
+		sum += byType[processingType]
+	}
+	return sum
+}
+
+func (r *Worker) getBacklog(ctx context.Context) (*Backlog, error) {
 	// Get queue depths
 	queueLengths, err := r.Queue.GetAllQueuesLength(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get queue lengths: %w", err)
 	}
 
-	// Calculate total depth (main + priority queues, exclude failed)
-	totalDepth := queueLengths[queue.QueueMain] + queueLengths[queue.QueuePriority]
+	typeLengths, err := r.Queue.GetTypeQueueLengths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get type queue lengths: %w", err)
+	}
+
+	priorityLengths, err := r.Queue.GetTypePriorityQueueLengths(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get type priority queue lengths: %w", err)
+	}
+
+	paused, err := r.Queue.ProcessingPaused(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get processing paused: %w", err)
+	}
+
+	backlog := &Backlog{
+		ByType: make(map[string]int64, len(typeLengths)),
+		// Shared main + priority queues, failed jobs are not backlog
+		Shared:         queueLengths[queue.QueueMain] + queueLengths[queue.QueuePriority],
+		PriorityByType: make(map[string]int64, len(priorityLengths)),
+		SharedPriority: queueLengths[queue.QueuePriority],
+		// Queued jobs still count, so that scale-downs do not overshoot while processing is paused
+		ProcessingPaused: paused,
+	}
+	for processingType, length := range typeLengths {
+		backlog.ByType[string(processingType)] = length
+	}
+	for processingType, length := range priorityLengths {
+		backlog.PriorityByType[string(processingType)] = length
+	}
 
 	r.Log.DebugContext(ctx, "collected queue metrics",
-		"queue_lengths", queueLengths)
+		"queue_lengths", queueLengths,
+		"type_queue_lengths", typeLengths)
+
+	return backlog, nil
+}
+
+// burstReplicas sizes the burst pool: it starts once the priority backlog exceeds the threshold,
+// keeps one replica per JobsPerWorker priority jobs while any remain and stops once they are drained.
+func burstReplicas(burst config.PriorityBurst, stats *QueueStats, currentReplicas int32) int32 {
+	depth := stats.TotalDepth
+	if depth == 0 || (currentReplicas == 0 && depth <= burst.Threshold) {
+		return 0
+	}
 
-	return &QueueStats{
-		TotalDepth: totalDepth,
-	}, nil
+	needed := (depth + burst.JobsPerWorker - 1) / burst.JobsPerWorker
+	return int32(min(needed, int64(burst.MaxReplicas))) //nolint:gosec // bounded by MaxReplicas
 }
 
-func (r *Worker) calculateOptimalReplicas(stats *QueueStats, currentReplicas int32) int32 {
+func calculateOptimalReplicas(scaling config.Scaling, stats *QueueStats, currentReplicas int32) int32 {
 	queueDepth := stats.TotalDepth
 
 	// Calculate optimal replicas based on queue depth
@@ -156,44 +574,45 @@ func (r *Worker) calculateOptimalReplicas(stats *QueueStats, currentReplicas int
 	switch {
 	case queueDepth == 0:
 		// No jobs in queue - scale down to minimum
-		targetReplicas = DefaultMinReplicas
-	case queueDepth > ScaleUpThreshold:
+		targetReplicas = scaling.MinReplicas
+	case queueDepth > scaling.ScaleUpThreshold:
 		// High queue depth - scale up
-		// Formula: ceil(queueDepth / JobsPerWorker) but limit growth rate
-		needed := (queueDepth + JobsPerWorker - 1) / JobsPerWorker // Ceiling division
+		// Formula: ceil(queueDepth / scaling.JobsPerWorker) but limit growth rate
+		needed := (queueDepth + scaling.JobsPerWorker - 1) / scaling.JobsPerWorker // Ceiling division
 
 		// Safe conversion with overflow protection
 		var neededReplicas int32
-		if needed > int64(DefaultMaxReplicas) || needed < 0 {
-			neededReplicas = DefaultMaxReplicas
+		if needed > int64(scaling.MaxReplicas) || needed < 0 {
+			neededReplicas = scaling.MaxReplicas
 		} else {
 			neededReplicas = int32(needed) // #nosec G115 - overflow checked above
 		}
-		targetReplicas = minInt32(currentReplicas+MaxScaleUpIncrement, neededReplicas)
-	case queueDepth < ScaleDownThreshold && currentReplicas > DefaultMinReplicas:
+		// Never scale down on a scale-up signal, which would flap against the next evaluation
+		targetReplicas = max(currentReplicas, minInt32(currentReplicas+scaling.MaxScaleUpIncrement, neededReplicas))
+	case queueDepth < scaling.ScaleDownThreshold && currentReplicas > scaling.MinReplicas:
 		// Low queue depth - scale down gradually
-		targetReplicas = currentReplicas - MaxScaleDownDecrement
+		targetReplicas = currentReplicas - scaling.MaxScaleDownDecrement
 	default:
 		// Queue depth is in acceptable range - no change
 		targetReplicas = currentReplicas
 	}
 
 	// Apply constraints
-	if targetReplicas < DefaultMinReplicas {
-		targetReplicas = DefaultMinReplicas
+	if targetReplicas < scaling.MinReplicas {
+		targetReplicas = scaling.MinReplicas
 	}
-	if targetReplicas > DefaultMaxReplicas {
-		targetReplicas = DefaultMaxReplicas
+	if targetReplicas > scaling.MaxReplicas {
+		targetReplicas = scaling.MaxReplicas
 	}
 
 	return targetReplicas
 }
 
-func (r *Worker) updateDeploymentReplicas(ctx context.Context, _ *appsv1.Deployment, replicas int32) error {
+func (r *Worker) updateDeploymentReplicas(ctx context.Context, deployment *appsv1.Deployment, replicas int32) error {
 	var freshDeployment appsv1.Deployment
 	deploymentKey := types.NamespacedName{
-		Name:      WorkerDeploymentName,
-		Namespace: WorkerDeploymentNamespace,
+		Name:      deployment.Name,
+		Namespace: deployment.Namespace,
 	}
 
 	if err := r.Get(ctx, deploymentKey, &freshDeployment); err != nil {
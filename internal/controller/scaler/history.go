@@ -0,0 +1,131 @@
+package scaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// Decision outcomes.
+const (
+	// DecisionApplied means the Deployment was patched to the target replicas.
+	DecisionApplied = "applied"
+	// DecisionUnchanged means the Deployment already runs the target replicas.
+	DecisionUnchanged = "unchanged"
+	// DecisionDryRun means the replicas would have changed but DRY_RUN is enabled.
+	DecisionDryRun = "dry_run"
+	// DecisionFailed means patching the Deployment failed.
+	DecisionFailed = "failed"
+)
+
+// Decision is a single scaling evaluation of a worker Deployment with its inputs and outcome.
+type Decision struct {
+	Timestamp       time.Time `json:"timestamp"`
+	Deployment      string    `json:"deployment"`
+	Namespace       string    `json:"namespace"`
+	ProcessingTypes string    `json:"processing_types"`
+	QueueDepth      int64     `json:"queue_depth"`
+	CurrentReplicas int32     `json:"current_replicas"`
+	ActiveWorkers   int32     `json:"active_workers"`
+	MinReplicas     int32     `json:"min_replicas"`
+	MaxReplicas     int32     `json:"max_replicas"`
+	// RecommendedReplicas is what the queue depth alone calls for; TargetReplicas is what remains after
+	// stabilization and cooldown, with HoldReason explaining any difference.
+	RecommendedReplicas int32  `json:"recommended_replicas"`
+	TargetReplicas      int32  `json:"target_replicas"`
+	HoldReason          string `json:"hold_reason,omitempty"`
+	Outcome             string `json:"outcome"`
+	Error               string `json:"error,omitempty"`
+}
+
+// recordDecision keeps the decision as the Deployment's latest and stores it in the Redis history.
+// Failures are logged only: history must never block scaling.
+func (r *Worker) recordDecision(ctx context.Context, decision Decision) {
+	r.stateMu.Lock()
+	if r.lastDecisions == nil {
+		r.lastDecisions = make(map[string]Decision)
+	}
+	r.lastDecisions[decision.Namespace+"/"+decision.Deployment] = decision
+	r.stateMu.Unlock()
+
+	data, err := json.Marshal(decision)
+	if err != nil {
+		r.Log.ErrorContext(ctx, "failed to marshal scaling decision", "error", err)
+		return
+	}
+
+	if err := r.Queue.AppendScalingDecision(ctx, data, r.Config.ScalingHistorySize); err != nil {
+		r.Log.ErrorContext(ctx, "failed to record scaling decision", "error", err, "deployment", decision.Deployment)
+	}
+}
+
+// History returns up to limit recent scaling decisions, newest first. A non-empty deployment
+// keeps only decisions about that Deployment.
+func (r *Worker) History(ctx context.Context, limit int, deployment string) ([]Decision, error) {
+	// Filtering happens after reading, so read the whole history when a Deployment is given
+	count := int64(limit)
+	if deployment != "" {
+		count = r.Config.ScalingHistorySize
+	}
+
+	entries, err := r.Queue.GetScalingDecisions(ctx, count)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]Decision, 0, min(len(entries), limit))
+	for _, entry := range entries {
+		var decision Decision
+		if err := json.Unmarshal([]byte(entry), &decision); err != nil {
+			r.Log.WarnContext(ctx, "skipping malformed scaling decision", "error", err)
+			continue
+		}
+		if deployment != "" && decision.Deployment != deployment {
+			continue
+		}
+
+		decisions = append(decisions, decision)
+		if len(decisions) == limit {
+			break
+		}
+	}
+
+	return decisions, nil
+}
+
+// HistoryHandler serves recent scaling decisions. Query parameters: limit (default 100, max 1000)
+// and deployment.
+func (r *Worker) HistoryHandler(w http.ResponseWriter, req *http.Request) {
+	limit := defaultHistoryLimit
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 || parsed > maxHistoryLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxHistoryLimit), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	decisions, err := r.History(req.Context(), limit, req.URL.Query().Get("deployment"))
+	if err != nil {
+		r.Log.ErrorContext(req.Context(), "failed to read scaling history", "error", err)
+		http.Error(w, "failed to read scaling history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"dry_run":   r.Config.DryRun,
+		"decisions": decisions,
+	}); err != nil {
+		r.Log.ErrorContext(req.Context(), "failed to encode scaling history", "error", err)
+	}
+}
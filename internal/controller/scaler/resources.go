@@ -0,0 +1,496 @@
+package scaler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/rsav/k8s-learning/internal/controller/metrics"
+)
+
+const (
+	// ResourceRecommendationAnnotation holds the latest ResourceRecommendation of a worker Deployment as JSON.
+	ResourceRecommendationAnnotation = "k8s-learning/resource-recommendation"
+
+	// Requests follow the 90th percentile of the observed usage and limits its peak, as the
+	// VerticalPodAutoscaler recommender does.
+	recommendationPercentile = 0.9
+	minRecommendationSamples = 10
+	// resourceChangeTolerance keeps auto-apply from rolling the workers for small fluctuations.
+	resourceChangeTolerance = 0.2
+)
+
+const (
+	minCPUMillis   = 10
+	minMemoryBytes = 32 << 20
+	memoryStep     = 1 << 20
+)
+
+var podMetricsGVK = schema.GroupVersionKind{Group: "metrics.k8s.io", Version: "v1beta1", Kind: "PodMetricsList"}
+
+// ContainerRecommendation is the recommended resources of one worker container.
+type ContainerRecommendation struct {
+	Requests corev1.ResourceList `json:"requests"`
+	Limits   corev1.ResourceList `json:"limits"`
+	// Samples is the number of pod usage samples the recommendation is based on.
+	Samples int `json:"samples"`
+}
+
+// ResourceRecommendation is the recommended resources of a worker Deployment's containers.
+// Containers with fewer than minRecommendationSamples samples are left out.
+type ResourceRecommendation struct {
+	Deployment string                             `json:"deployment"`
+	Namespace  string                             `json:"namespace"`
+	Containers map[string]ContainerRecommendation `json:"containers"`
+	// JobsPerMinute is the Deployment's throughput since the previous evaluation.
+	JobsPerMinute float64   `json:"jobs_per_minute"`
+	Applied       bool      `json:"applied"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type usageSample struct {
+	at       time.Time
+	cpuMilli int64
+	memory   int64
+}
+
+// usageHistory is the usage observed for a Deployment within the recommendation window.
+type usageHistory struct {
+	containers map[string][]usageSample
+	consumed   int64
+	consumedAt time.Time
+}
+
+// StartResourceRecommendations recommends worker container resources every RecommendationInterval.
+func (r *Worker) StartResourceRecommendations(ctx context.Context) {
+	ticker := time.NewTicker(r.Config.RecommendationInterval)
+	defer ticker.Stop()
+
+	r.Log.InfoContext(ctx, "starting resource recommendations",
+		"interval", r.Config.RecommendationInterval,
+		"window", r.Config.RecommendationWindow,
+		"auto_apply", r.Config.AutoApplyResources)
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.recommendResources(ctx); err != nil {
+				r.Log.ErrorContext(ctx, "resource recommendation failed", "error", err)
+			}
+		case <-ctx.Done():
+			r.Log.InfoContext(ctx, "stopping resource recommendations")
+			return
+		}
+	}
+}
+
+func (r *Worker) recommendResources(ctx context.Context) error {
+	workers, err := r.discoverWorkerDeployments(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Throughput is informational, so recommendations go on without it
+	var consumed map[string]int64
+	if counts, err := r.Queue.GetConsumedJobs(ctx); err != nil {
+		r.Log.WarnContext(ctx, "failed to read consumed jobs, skipping throughput", "error", err)
+	} else {
+		consumed = make(map[string]int64, len(counts))
+		for processingType, count := range counts {
+			consumed[string(processingType)] = count
+		}
+	}
+
+	claimed := claimedTypes(workers)
+	now := time.Now()
+	seen := make(map[string]bool, len(workers))
+	var errs []error
+	for i := range workers {
+		seen[deploymentKey(&workers[i].deployment)] = true
+
+		var served *int64
+		if consumed != nil {
+			total := sumServed(consumed, workers[i].types, claimed)
+			served = &total
+		}
+		if err := r.recommendDeploymentResources(ctx, &workers[i].deployment, served, now); err != nil {
+			errs = append(errs, fmt.Errorf("recommend resources for deployment %s: %w", workers[i].deployment.Name, err))
+		}
+	}
+
+	r.pruneRecommendations(seen)
+	return errors.Join(errs...)
+}
+
+// recommendDeploymentResources samples the Deployment's pod usage and publishes a recommendation.
+// consumed is the number of jobs of the Deployment's processing types consumed so far, nil when unknown.
+func (r *Worker) recommendDeploymentResources(ctx context.Context, deployment *appsv1.Deployment, consumed *int64, now time.Time) error {
+	log := r.Log.With("worker-scaler", "resource-recommender", "deployment", deployment.Name)
+
+	usage, err := r.podUsage(ctx, deployment)
+	if err != nil {
+		return err
+	}
+
+	history := r.usageFor(deployment)
+	history.add(now, usage, r.Config.RecommendationWindow)
+
+	recommendation := ResourceRecommendation{
+		Deployment: deployment.Name,
+		Namespace:  deployment.Namespace,
+		Containers: make(map[string]ContainerRecommendation),
+		UpdatedAt:  now.UTC(),
+	}
+	if consumed != nil {
+		recommendation.JobsPerMinute = history.throughput(now, *consumed)
+		metrics.UpdateWorkerThroughput(deployment.Name, recommendation.JobsPerMinute)
+	}
+
+	for container, samples := range history.containers {
+		if len(samples) < minRecommendationSamples {
+			continue
+		}
+		recommended := recommendContainer(samples, r.Config.RecommendationMargin)
+		recommendation.Containers[container] = recommended
+		publishContainerRecommendation(deployment.Name, container, recommended)
+	}
+
+	if len(recommendation.Containers) == 0 {
+		log.DebugContext(ctx, "not enough usage samples for a resource recommendation")
+		r.storeRecommendation(deployment, recommendation)
+		return nil
+	}
+
+	if r.Config.DryRun {
+		log.InfoContext(ctx, "dry run: skipping resource recommendation update",
+			"containers", recommendation.Containers)
+		r.storeRecommendation(deployment, recommendation)
+		return nil
+	}
+
+	if r.Config.AutoApplyResources {
+		applied, err := r.applyResources(ctx, deployment, recommendation.Containers)
+		if err != nil {
+			return fmt.Errorf("apply resources: %w", err)
+		}
+		recommendation.Applied = applied
+	}
+
+	r.storeRecommendation(deployment, recommendation)
+	return r.annotateRecommendation(ctx, deployment, recommendation)
+}
+
+// podUsage returns the current usage of each container of the Deployment's pods, one sample per pod.
+func (r *Worker) podUsage(ctx context.Context, deployment *appsv1.Deployment) (map[string][]usageSample, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("parse deployment selector: %w", err)
+	}
+
+	var podMetrics unstructured.UnstructuredList
+	podMetrics.SetGroupVersionKind(podMetricsGVK)
+	if err := r.List(ctx, &podMetrics,
+		client.InNamespace(deployment.Namespace),
+		client.MatchingLabelsSelector{Selector: selector},
+	); err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, fmt.Errorf("metrics-server is not installed: %w", err)
+		}
+		return nil, fmt.Errorf("list pod metrics: %w", err)
+	}
+
+	usage := make(map[string][]usageSample)
+	for _, pod := range podMetrics.Items {
+		containers, _, err := unstructured.NestedSlice(pod.Object, "containers")
+		if err != nil {
+			return nil, fmt.Errorf("read metrics of pod %s: %w", pod.GetName(), err)
+		}
+
+		for _, c := range containers {
+			container, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(container, "name")
+			cpu, _, _ := unstructured.NestedString(container, "usage", "cpu")
+			memory, _, _ := unstructured.NestedString(container, "usage", "memory")
+
+			cpuQuantity, err := resource.ParseQuantity(cpu)
+			if err != nil {
+				return nil, fmt.Errorf("parse cpu usage of pod %s: %w", pod.GetName(), err)
+			}
+			memoryQuantity, err := resource.ParseQuantity(memory)
+			if err != nil {
+				return nil, fmt.Errorf("parse memory usage of pod %s: %w", pod.GetName(), err)
+			}
+
+			usage[name] = append(usage[name], usageSample{
+				cpuMilli: cpuQuantity.MilliValue(),
+				memory:   memoryQuantity.Value(),
+			})
+		}
+	}
+
+	return usage, nil
+}
+
+// add records usage observed at now and drops samples older than window.
+func (h *usageHistory) add(now time.Time, usage map[string][]usageSample, window time.Duration) {
+	cutoff := now.Add(-window)
+	for container, samples := range h.containers {
+		samples = slices.DeleteFunc(samples, func(sample usageSample) bool {
+			return sample.at.Before(cutoff)
+		})
+		if len(samples) == 0 {
+			delete(h.containers, container)
+			continue
+		}
+		h.containers[container] = samples
+	}
+
+	for container, samples := range usage {
+		for _, sample := range samples {
+			sample.at = now
+			h.containers[container] = append(h.containers[container], sample)
+		}
+	}
+}
+
+// throughput returns the jobs consumed per minute since the previous call, given the total
+// consumed so far. It returns zero on the first call and after the counter was reset.
+func (h *usageHistory) throughput(now time.Time, consumed int64) float64 {
+	previous, previousAt := h.consumed, h.consumedAt
+	h.consumed, h.consumedAt = consumed, now
+
+	elapsed := now.Sub(previousAt).Minutes()
+	if previousAt.IsZero() || consumed < previous || elapsed <= 0 {
+		return 0
+	}
+	return float64(consumed-previous) / elapsed
+}
+
+// recommendContainer pads the 90th percentile usage into requests and the peak usage into limits.
+func recommendContainer(samples []usageSample, margin float64) ContainerRecommendation {
+	cpu := make([]int64, len(samples))
+	memory := make([]int64, len(samples))
+	for i, sample := range samples {
+		cpu[i] = sample.cpuMilli
+		memory[i] = sample.memory
+	}
+	slices.Sort(cpu)
+	slices.Sort(memory)
+
+	pad := func(value int64) int64 {
+		return int64(math.Ceil(float64(value) * (1 + margin)))
+	}
+	roundMemory := func(value int64) int64 {
+		return (value + memoryStep - 1) / memoryStep * memoryStep
+	}
+
+	cpuRequest := max(pad(percentile(cpu, recommendationPercentile)), minCPUMillis)
+	cpuLimit := max(pad(cpu[len(cpu)-1]), cpuRequest)
+	memoryRequest := roundMemory(max(pad(percentile(memory, recommendationPercentile)), minMemoryBytes))
+	memoryLimit := max(roundMemory(pad(memory[len(memory)-1])), memoryRequest)
+
+	return ContainerRecommendation{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(cpuRequest, resource.DecimalSI),
+			corev1.ResourceMemory: *resource.NewQuantity(memoryRequest, resource.BinarySI),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    *resource.NewMilliQuantity(cpuLimit, resource.DecimalSI),
+			corev1.ResourceMemory: *resource.NewQuantity(memoryLimit, resource.BinarySI),
+		},
+		Samples: len(samples),
+	}
+}
+
+// percentile returns the p-th percentile of sorted, which must not be empty.
+func percentile(sorted []int64, p float64) int64 {
+	return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+}
+
+func publishContainerRecommendation(deployment, container string, recommendation ContainerRecommendation) {
+	for kind, resources := range map[string]corev1.ResourceList{
+		"request": recommendation.Requests,
+		"limit":   recommendation.Limits,
+	} {
+		for name, quantity := range resources {
+			metrics.UpdateResourceRecommendation(deployment, container, string(name), kind, quantity.AsApproximateFloat64())
+		}
+	}
+}
+
+// applyResources writes the recommended resources to the Deployment's pod template when they
+// differ from the current ones by more than resourceChangeTolerance. It reports whether the
+// template was changed.
+func (r *Worker) applyResources(ctx context.Context, deployment *appsv1.Deployment, containers map[string]ContainerRecommendation) (bool, error) {
+	var fresh appsv1.Deployment
+	if err := r.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, &fresh); err != nil {
+		return false, fmt.Errorf("get fresh deployment: %w", err)
+	}
+	original := fresh.DeepCopy()
+
+	var updated []string
+	for i := range fresh.Spec.Template.Spec.Containers {
+		container := &fresh.Spec.Template.Spec.Containers[i]
+		recommendation, ok := containers[container.Name]
+		if !ok || !resourcesDiffer(container.Resources, recommendation) {
+			continue
+		}
+
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = corev1.ResourceList{}
+		}
+		if container.Resources.Limits == nil {
+			container.Resources.Limits = corev1.ResourceList{}
+		}
+		maps.Copy(container.Resources.Requests, recommendation.Requests)
+		maps.Copy(container.Resources.Limits, recommendation.Limits)
+		updated = append(updated, container.Name)
+	}
+	if len(updated) == 0 {
+		return false, nil
+	}
+
+	// The pod template is replaced as a whole, so concurrent edits must not be overwritten
+	patch := client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{})
+	if err := r.Patch(ctx, &fresh, patch); err != nil {
+		return false, fmt.Errorf("patch deployment: %w", err)
+	}
+
+	r.Recorder.Eventf(&fresh, corev1.EventTypeNormal, EventReasonResourcesUpdated,
+		"Applied recommended resources to containers %s", strings.Join(updated, ", "))
+	r.Log.InfoContext(ctx, "applied recommended resources",
+		"deployment", deployment.Name, "containers", updated)
+	return true, nil
+}
+
+// resourcesDiffer reports whether any recommended value is missing from current or differs from
+// it by more than resourceChangeTolerance.
+func resourcesDiffer(current corev1.ResourceRequirements, recommendation ContainerRecommendation) bool {
+	for _, pair := range []struct{ current, recommended corev1.ResourceList }{
+		{current.Requests, recommendation.Requests},
+		{current.Limits, recommendation.Limits},
+	} {
+		for name, recommended := range pair.recommended {
+			have, ok := pair.current[name]
+			if !ok {
+				return true
+			}
+			haveValue := have.AsApproximateFloat64()
+			if math.Abs(recommended.AsApproximateFloat64()-haveValue) > resourceChangeTolerance*haveValue {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// annotateRecommendation stores the recommendation on the Deployment without touching its pod template.
+func (r *Worker) annotateRecommendation(ctx context.Context, deployment *appsv1.Deployment, recommendation ResourceRecommendation) error {
+	value, err := json.Marshal(recommendation)
+	if err != nil {
+		return fmt.Errorf("marshal recommendation: %w", err)
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"annotations": map[string]string{ResourceRecommendationAnnotation: string(value)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal annotation patch: %w", err)
+	}
+
+	if err := r.Patch(ctx, deployment, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return fmt.Errorf("annotate deployment: %w", err)
+	}
+	return nil
+}
+
+// usageFor returns the usage history of the Deployment, creating it on first use.
+func (r *Worker) usageFor(deployment *appsv1.Deployment) *usageHistory {
+	if r.usage == nil {
+		r.usage = make(map[string]*usageHistory)
+	}
+
+	key := deploymentKey(deployment)
+	history, ok := r.usage[key]
+	if !ok {
+		history = &usageHistory{containers: make(map[string][]usageSample)}
+		r.usage[key] = history
+	}
+	return history
+}
+
+func (r *Worker) storeRecommendation(deployment *appsv1.Deployment, recommendation ResourceRecommendation) {
+	r.recommendationsMu.Lock()
+	defer r.recommendationsMu.Unlock()
+
+	if r.recommendations == nil {
+		r.recommendations = make(map[string]ResourceRecommendation)
+	}
+	r.recommendations[deploymentKey(deployment)] = recommendation
+}
+
+// pruneRecommendations forgets Deployments that are no longer discovered.
+func (r *Worker) pruneRecommendations(seen map[string]bool) {
+	r.recommendationsMu.Lock()
+	defer r.recommendationsMu.Unlock()
+
+	for key, recommendation := range r.recommendations {
+		if !seen[key] {
+			delete(r.recommendations, key)
+			delete(r.usage, key)
+			metrics.DeleteResourceRecommendations(recommendation.Deployment)
+		}
+	}
+}
+
+// Recommendations returns the latest resource recommendation of every worker Deployment,
+// ordered by namespace and name.
+func (r *Worker) Recommendations() []ResourceRecommendation {
+	r.recommendationsMu.RLock()
+	defer r.recommendationsMu.RUnlock()
+
+	keys := slices.Sorted(maps.Keys(r.recommendations))
+	recommendations := make([]ResourceRecommendation, 0, len(keys))
+	for _, key := range keys {
+		recommendations = append(recommendations, r.recommendations[key])
+	}
+	return recommendations
+}
+
+// ResourcesHandler serves the latest resource recommendations.
+func (r *Worker) ResourcesHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"auto_apply":      r.Config.AutoApplyResources,
+		"dry_run":         r.Config.DryRun,
+		"recommendations": r.Recommendations(),
+	}); err != nil {
+		r.Log.ErrorContext(req.Context(), "failed to encode resource recommendations", "error", err)
+	}
+}
+
+func deploymentKey(deployment *appsv1.Deployment) string {
+	return deployment.Namespace + "/" + deployment.Name
+}
@@ -0,0 +1,130 @@
+package scaler
+
+import (
+	"math"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// Reasons a recommended replica change was held back.
+const (
+	HoldReasonStabilization    = "stabilization window"
+	HoldReasonMinScaleInterval = "min scale interval"
+	HoldReasonCapacity         = "cluster capacity"
+	HoldReasonProcessingPaused = "processing paused"
+)
+
+type recommendation struct {
+	at       time.Time
+	replicas int32
+}
+
+// scaleState is what the scaler remembers about a Deployment between reconciliations.
+type scaleState struct {
+	recommendations []recommendation
+	lastScaled      time.Time
+	// lastDirection is +1 after a scale-up, -1 after a scale-down and 0 before the first one.
+	lastDirection int
+}
+
+// scaleDecision is the outcome of decideReplicas.
+type scaleDecision struct {
+	// Recommended is the replica count the queue depth alone calls for.
+	Recommended int32
+	// Target is the replica count to apply after stabilization and cooldown.
+	Target int32
+	// HoldReason explains why Target differs from Recommended, empty otherwise.
+	HoldReason string
+}
+
+// decideReplicas turns the replicas recommended for a Deployment running current replicas into the
+// replicas to apply. It records the recommendation in state; callers report applied changes with
+// state.scaled.
+func decideReplicas(scaling config.Scaling, recommended, current int32, state *scaleState, now time.Time) scaleDecision {
+	state.record(now, recommended, max(scaling.ScaleUpStabilization.Duration, scaling.ScaleDownStabilization.Duration))
+
+	decision := scaleDecision{Recommended: recommended, Target: current}
+
+	// Scale up only as far as every recommendation in the up window agrees, and down only as far
+	// as every recommendation in the down window agrees
+	switch {
+	case recommended > current:
+		decision.Target = max(state.lowestSince(now.Add(-scaling.ScaleUpStabilization.Duration)), current)
+	case recommended < current:
+		decision.Target = min(state.highestSince(now.Add(-scaling.ScaleDownStabilization.Duration)), current)
+	}
+	if decision.Target != recommended {
+		decision.HoldReason = HoldReasonStabilization
+	}
+
+	if decision.Target != current && !state.lastScaled.IsZero() &&
+		now.Sub(state.lastScaled) < scaling.MinScaleInterval.Duration {
+		decision.Target = current
+		decision.HoldReason = HoldReasonMinScaleInterval
+	}
+
+	return decision
+}
+
+// holdUp keeps a scale-up of a Deployment running current replicas from happening while processing
+// is paused. Scale-downs proceed.
+func (d *scaleDecision) holdUp(current int32) {
+	if d.Target > current {
+		d.Target = current
+		d.HoldReason = HoldReasonProcessingPaused
+	}
+}
+
+// withHysteresis makes reversing the last scaling direction require a stronger signal.
+func withHysteresis(scaling config.Scaling, lastDirection int) config.Scaling {
+	switch {
+	case lastDirection > 0:
+		scaling.ScaleDownThreshold = int64(math.Floor(float64(scaling.ScaleDownThreshold) * (1 - scaling.Hysteresis)))
+	case lastDirection < 0:
+		scaling.ScaleUpThreshold = int64(math.Ceil(float64(scaling.ScaleUpThreshold) * (1 + scaling.Hysteresis)))
+	}
+	return scaling
+}
+
+// record appends a recommendation and drops those older than window.
+func (s *scaleState) record(now time.Time, replicas int32, window time.Duration) {
+	cutoff := now.Add(-window)
+	kept := s.recommendations[:0]
+	for _, rec := range s.recommendations {
+		if !rec.at.Before(cutoff) {
+			kept = append(kept, rec)
+		}
+	}
+	s.recommendations = append(kept, recommendation{at: now, replicas: replicas})
+}
+
+func (s *scaleState) lowestSince(since time.Time) int32 {
+	lowest := int32(math.MaxInt32)
+	for _, rec := range s.recommendations {
+		if !rec.at.Before(since) {
+			lowest = min(lowest, rec.replicas)
+		}
+	}
+	return lowest
+}
+
+func (s *scaleState) highestSince(since time.Time) int32 {
+	highest := int32(math.MinInt32)
+	for _, rec := range s.recommendations {
+		if !rec.at.Before(since) {
+			highest = max(highest, rec.replicas)
+		}
+	}
+	return highest
+}
+
+// scaled records that the Deployment was scaled from one replica count to another at now.
+func (s *scaleState) scaled(now time.Time, from, to int32) {
+	s.lastScaled = now
+	if to > from {
+		s.lastDirection = 1
+	} else {
+		s.lastDirection = -1
+	}
+}
@@ -0,0 +1,242 @@
+package scaler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+func TestDecideReplicas(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	windows := func(up, down, interval time.Duration) config.Scaling {
+		return config.Scaling{
+			ScaleUpStabilization:   config.Duration{Duration: up},
+			ScaleDownStabilization: config.Duration{Duration: down},
+			MinScaleInterval:       config.Duration{Duration: interval},
+		}
+	}
+	ago := func(d time.Duration, replicas int32) recommendation {
+		return recommendation{at: now.Add(-d), replicas: replicas}
+	}
+
+	tests := []struct {
+		name        string
+		scaling     config.Scaling
+		history     []recommendation
+		lastScaled  time.Time
+		recommended int32
+		current     int32
+		want        scaleDecision
+	}{
+		{
+			name:        "empty history scales up at once",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			recommended: 5,
+			current:     2,
+			want:        scaleDecision{Recommended: 5, Target: 5},
+		},
+		{
+			name:        "empty history scales down at once",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			recommended: 1,
+			current:     4,
+			want:        scaleDecision{Recommended: 1, Target: 1},
+		},
+		{
+			name:        "unchanged recommendation",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			history:     []recommendation{ago(30*time.Second, 8)},
+			recommended: 3,
+			current:     3,
+			want:        scaleDecision{Recommended: 3, Target: 3},
+		},
+		{
+			name:        "scale-up limited to the lowest recommendation in the up window",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			history:     []recommendation{ago(45*time.Second, 4), ago(30*time.Second, 3)},
+			recommended: 5,
+			current:     2,
+			want:        scaleDecision{Recommended: 5, Target: 3, HoldReason: HoldReasonStabilization},
+		},
+		{
+			name:        "scale-up ignores recommendations before the up window",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			history:     []recommendation{ago(2*time.Minute, 1)},
+			recommended: 5,
+			current:     2,
+			want:        scaleDecision{Recommended: 5, Target: 5},
+		},
+		{
+			name:        "scale-up never scales down",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			history:     []recommendation{ago(10*time.Second, 1)},
+			recommended: 5,
+			current:     2,
+			want:        scaleDecision{Recommended: 5, Target: 2, HoldReason: HoldReasonStabilization},
+		},
+		{
+			name:        "scale-down limited to the highest recommendation in the down window",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			history:     []recommendation{ago(4*time.Minute, 3), ago(time.Minute, 4)},
+			recommended: 2,
+			current:     5,
+			want:        scaleDecision{Recommended: 2, Target: 4, HoldReason: HoldReasonStabilization},
+		},
+		{
+			name:        "scale-down never scales up",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			history:     []recommendation{ago(time.Minute, 6)},
+			recommended: 2,
+			current:     5,
+			want:        scaleDecision{Recommended: 2, Target: 5, HoldReason: HoldReasonStabilization},
+		},
+		{
+			name:        "scale-down ignores recommendations before the down window",
+			scaling:     windows(time.Minute, 5*time.Minute, 0),
+			history:     []recommendation{ago(6*time.Minute, 6)},
+			recommended: 2,
+			current:     5,
+			want:        scaleDecision{Recommended: 2, Target: 2},
+		},
+		{
+			name:        "min scale interval holds a change",
+			scaling:     windows(0, 0, time.Minute),
+			lastScaled:  now.Add(-30 * time.Second),
+			recommended: 5,
+			current:     2,
+			want:        scaleDecision{Recommended: 5, Target: 2, HoldReason: HoldReasonMinScaleInterval},
+		},
+		{
+			name:        "min scale interval elapsed",
+			scaling:     windows(0, 0, time.Minute),
+			lastScaled:  now.Add(-2 * time.Minute),
+			recommended: 5,
+			current:     2,
+			want:        scaleDecision{Recommended: 5, Target: 5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &scaleState{recommendations: tt.history, lastScaled: tt.lastScaled}
+
+			got := decideReplicas(tt.scaling, tt.recommended, tt.current, state, now)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDecideReplicasForgetsRecommendationsOutsideTheWindows(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	scaling := config.Scaling{
+		ScaleUpStabilization:   config.Duration{Duration: time.Minute},
+		ScaleDownStabilization: config.Duration{Duration: 5 * time.Minute},
+	}
+	state := &scaleState{recommendations: []recommendation{
+		{at: now.Add(-6 * time.Minute), replicas: 1},
+		{at: now.Add(-4 * time.Minute), replicas: 2},
+	}}
+
+	decideReplicas(scaling, 3, 3, state, now)
+
+	assert.Equal(t, []recommendation{
+		{at: now.Add(-4 * time.Minute), replicas: 2},
+		{at: now, replicas: 3},
+	}, state.recommendations)
+}
+
+func TestScaleStateScaled(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		from, to int32
+		want     int
+	}{
+		{name: "up", from: 2, to: 4, want: 1},
+		{name: "down", from: 4, to: 2, want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state scaleState
+
+			state.scaled(now, tt.from, tt.to)
+
+			assert.Equal(t, now, state.lastScaled)
+			assert.Equal(t, tt.want, state.lastDirection)
+		})
+	}
+}
+
+func TestWithHysteresis(t *testing.T) {
+	tests := []struct {
+		name          string
+		hysteresis    float64
+		lastDirection int
+		wantUp        int64
+		wantDown      int64
+	}{
+		{name: "before the first scale", hysteresis: 0.25, lastDirection: 0, wantUp: 100, wantDown: 10},
+		{name: "after a scale-up lowers the down threshold", hysteresis: 0.25, lastDirection: 1, wantUp: 100, wantDown: 7},
+		{name: "after a scale-down raises the up threshold", hysteresis: 0.25, lastDirection: -1, wantUp: 125, wantDown: 10},
+		{name: "no hysteresis", hysteresis: 0, lastDirection: 1, wantUp: 100, wantDown: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scaling := config.Scaling{ScaleUpThreshold: 100, ScaleDownThreshold: 10, Hysteresis: tt.hysteresis}
+
+			got := withHysteresis(scaling, tt.lastDirection)
+
+			assert.Equal(t, tt.wantUp, got.ScaleUpThreshold)
+			assert.Equal(t, tt.wantDown, got.ScaleDownThreshold)
+			assert.Equal(t, tt.hysteresis, got.Hysteresis)
+		})
+	}
+}
+
+func TestRecommendReplicas(t *testing.T) {
+	scaling := config.Scaling{
+		ScaleUpThreshold:      100,
+		ScaleDownThreshold:    10,
+		JobsPerWorker:         10,
+		MinReplicas:           1,
+		MaxReplicas:           10,
+		MaxScaleUpIncrement:   2,
+		MaxScaleDownDecrement: 1,
+		Hysteresis:            0.25,
+	}
+
+	tests := []struct {
+		name          string
+		depth         int64
+		current       int32
+		lastDirection int
+		want          int32
+	}{
+		{name: "scale up above the up threshold", depth: 110, current: 4, want: 6},
+		{name: "hysteresis band holds a scale-up after a scale-down", depth: 110, current: 4, lastDirection: -1, want: 4},
+		{name: "scale up beyond the hysteresis band", depth: 130, current: 4, lastDirection: -1, want: 6},
+		{name: "scale down below the down threshold", depth: 8, current: 4, want: 3},
+		{name: "hysteresis band holds a scale-down after a scale-up", depth: 8, current: 4, lastDirection: 1, want: 4},
+		{name: "scale down beyond the hysteresis band", depth: 6, current: 4, lastDirection: 1, want: 3},
+		{name: "clamped to max replicas", depth: 1000, current: 9, want: 10},
+		{name: "current above max replicas", depth: 50, current: 12, want: 10},
+		{name: "current below min replicas", depth: 50, current: 0, want: 1},
+		{name: "empty queue scales to min replicas", depth: 0, current: 5, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wd workerDeployment
+
+			got := wd.recommendReplicas(scaling, &QueueStats{TotalDepth: tt.depth}, tt.current, tt.lastDirection)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
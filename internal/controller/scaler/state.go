@@ -0,0 +1,176 @@
+package scaler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/federation"
+)
+
+// ScalingState explains the scaler's view of a worker Deployment: its inputs, the cooldowns in
+// effect and what an evaluation right now would decide.
+type ScalingState struct {
+	Deployment      string `json:"deployment"`
+	Namespace       string `json:"namespace"`
+	ProcessingTypes string `json:"processing_types"`
+	QueueDepth      int64  `json:"queue_depth"`
+	CurrentReplicas int32  `json:"current_replicas"`
+	ActiveWorkers   int32  `json:"active_workers"`
+	MinReplicas     int32  `json:"min_replicas"`
+	MaxReplicas     int32  `json:"max_replicas"`
+	// RecommendedReplicas, TargetReplicas and HoldReason are what an evaluation right now would
+	// decide. Unlike a real evaluation, computing them changes no state.
+	RecommendedReplicas int32     `json:"recommended_replicas"`
+	TargetReplicas      int32     `json:"target_replicas"`
+	HoldReason          string    `json:"hold_reason,omitempty"`
+	Cooldowns           Cooldowns `json:"cooldowns"`
+	// LastDecision is the latest evaluation since the controller started, nil before the first one.
+	LastDecision *Decision `json:"last_decision,omitempty"`
+}
+
+// Cooldowns are the damping timers of a worker Deployment.
+type Cooldowns struct {
+	// LastScaledAt is when the controller last scaled the Deployment, nil if it has not since starting.
+	LastScaledAt  *time.Time `json:"last_scaled_at,omitempty"`
+	LastDirection string     `json:"last_direction,omitempty"`
+	// MinScaleIntervalRemaining is how long scaling stays on hold due to MinScaleInterval.
+	MinScaleIntervalRemaining config.Duration `json:"min_scale_interval_remaining"`
+	// ScaleUpWindowLowest and ScaleDownWindowHighest are the most conservative recommendations
+	// within the stabilization windows, which bound scale-ups and scale-downs.
+	ScaleUpWindowLowest    int32 `json:"scale_up_window_lowest"`
+	ScaleDownWindowHighest int32 `json:"scale_down_window_highest"`
+}
+
+// State evaluates every worker Deployment without scaling it or touching the stabilization state.
+func (r *Worker) State(ctx context.Context) ([]ScalingState, *Backlog, error) {
+	workers, err := r.discoverWorkerDeployments(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backlog, err := r.getBacklog(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	claimed := claimedTypes(workers)
+	scaling := r.Runtime.Current().Scaling
+	now := time.Now()
+
+	states := make([]ScalingState, 0, len(workers))
+	for i := range workers {
+		wd := &workers[i]
+		deploymentScaling, stats := wd.scalingInputs(scaling, backlog, claimed)
+		current := wd.currentReplicas()
+
+		snapshot, lastDecision := r.snapshotState(deploymentKey(&wd.deployment))
+		recommended := wd.recommendReplicas(deploymentScaling, stats, current, snapshot.lastDirection)
+		decision := decideReplicas(deploymentScaling, recommended, current, &snapshot, now)
+		if backlog.ProcessingPaused {
+			decision.holdUp(current)
+		}
+		if r.Config.CapacityGuard && decision.Target > current {
+			capped, limited, err := r.capToCapacity(ctx, &wd.deployment, current, decision.Target)
+			if err != nil {
+				r.Log.WarnContext(ctx, "failed to check cluster capacity", "deployment", wd.deployment.Name, "error", err)
+			} else if limited {
+				decision.Target, decision.HoldReason = capped, HoldReasonCapacity
+			}
+		}
+
+		states = append(states, ScalingState{
+			Deployment:          wd.deployment.Name,
+			Namespace:           wd.deployment.Namespace,
+			ProcessingTypes:     wd.typesLabel(),
+			QueueDepth:          stats.TotalDepth,
+			CurrentReplicas:     current,
+			ActiveWorkers:       wd.deployment.Status.ReadyReplicas,
+			MinReplicas:         deploymentScaling.MinReplicas,
+			MaxReplicas:         deploymentScaling.MaxReplicas,
+			RecommendedReplicas: decision.Recommended,
+			TargetReplicas:      decision.Target,
+			HoldReason:          decision.HoldReason,
+			Cooldowns:           snapshot.cooldowns(deploymentScaling, now),
+			LastDecision:        lastDecision,
+		})
+	}
+
+	return states, backlog, nil
+}
+
+// snapshotState copies the Deployment's stabilization state, so that it can be evaluated without
+// affecting the reconciliation loop.
+func (r *Worker) snapshotState(key string) (scaleState, *Decision) {
+	r.stateMu.Lock()
+	defer r.stateMu.Unlock()
+
+	var snapshot scaleState
+	if state, ok := r.states[key]; ok {
+		snapshot = *state
+		snapshot.recommendations = slices.Clone(state.recommendations)
+	}
+
+	var lastDecision *Decision
+	if decision, ok := r.lastDecisions[key]; ok {
+		lastDecision = &decision
+	}
+	return snapshot, lastDecision
+}
+
+// cooldowns reports the damping timers of the state at now. It expects the recommendation made at
+// now to be recorded already.
+func (s *scaleState) cooldowns(scaling config.Scaling, now time.Time) Cooldowns {
+	var cooldowns Cooldowns
+	if !s.lastScaled.IsZero() {
+		lastScaled := s.lastScaled.UTC()
+		cooldowns.LastScaledAt = &lastScaled
+		cooldowns.MinScaleIntervalRemaining.Duration = max(s.lastScaled.Add(scaling.MinScaleInterval.Duration).Sub(now), 0)
+	}
+
+	switch {
+	case s.lastDirection > 0:
+		cooldowns.LastDirection = "up"
+	case s.lastDirection < 0:
+		cooldowns.LastDirection = "down"
+	}
+
+	cooldowns.ScaleUpWindowLowest = s.lowestSince(now.Add(-scaling.ScaleUpStabilization.Duration))
+	cooldowns.ScaleDownWindowHighest = s.highestSince(now.Add(-scaling.ScaleDownStabilization.Duration))
+	return cooldowns
+}
+
+// StateHandler serves the scaling state of every worker Deployment together with the backlog and,
+// when the queue is federated, the backlog of every region.
+func (r *Worker) StateHandler(w http.ResponseWriter, req *http.Request) {
+	states, backlog, err := r.State(req.Context())
+	if err != nil {
+		r.Log.ErrorContext(req.Context(), "failed to evaluate scaling state", "error", err)
+		http.Error(w, "failed to evaluate scaling state", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]any{
+		"dry_run": r.Config.DryRun,
+		"backlog": map[string]any{
+			"by_type":          backlog.ByType,
+			"shared":           backlog.Shared,
+			"priority_by_type": backlog.PriorityByType,
+			"shared_priority":  backlog.SharedPriority,
+		},
+		"deployments": states,
+	}
+	if r.Federation != nil {
+		regions := r.Federation.Stats(req.Context())
+		response["regions"] = regions
+		response["total"] = federation.Total(regions)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		r.Log.ErrorContext(req.Context(), "failed to encode scaling state", "error", err)
+	}
+}
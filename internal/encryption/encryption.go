@@ -0,0 +1,184 @@
+// Package encryption encrypts queue messages and stored files with AES-GCM. Every ciphertext starts
+// with a header naming the key it was encrypted with, so keys can be rotated while data encrypted
+// with earlier keys is still around. Data without the header, written before encryption was
+// enabled, is read as is.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// magic starts the header of everything this package encrypts. The header continues with the
+// length of the key ID in one byte and the key ID, and is authenticated along with the ciphertext.
+const magic = "TPE1"
+
+const maxKeyIDLength = 255
+
+// ErrUnknownKey is returned when data is encrypted with a key that is not in the keyring.
+var ErrUnknownKey = errors.New("data is encrypted with an unknown key")
+
+// Keyring holds the keys data is decrypted with and the active key it is encrypted with. Without an
+// active key data is written unencrypted, and a nil Keyring only reads unencrypted data.
+type Keyring struct {
+	active  string
+	ciphers map[string]cipher.AEAD
+}
+
+// NewKeyring creates a keyring of AES-128, AES-192 or AES-256 keys by key ID. An empty active key
+// only decrypts.
+func NewKeyring(keys map[string][]byte, active string) (*Keyring, error) {
+	ciphers := make(map[string]cipher.AEAD, len(keys))
+	for _, id := range slices.Sorted(maps.Keys(keys)) {
+		if id == "" || len(id) > maxKeyIDLength {
+			return nil, fmt.Errorf("encryption key ID %q must have 1 to %d characters", id, maxKeyIDLength)
+		}
+
+		block, err := aes.NewCipher(keys[id])
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s: %w", id, err)
+		}
+		ciphers[id] = aead
+	}
+
+	if _, ok := ciphers[active]; active != "" && !ok {
+		return nil, fmt.Errorf("active encryption key %s is not configured", active)
+	}
+
+	return &Keyring{active: active, ciphers: ciphers}, nil
+}
+
+// FromConfig creates the keyring of the configured keys, encrypting with the active key when
+// encrypt is set. It returns nil when no keys are configured.
+func FromConfig(cfg config.Encryption, encrypt bool) (*Keyring, error) {
+	keys, err := cfg.KeyMap()
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	active := ""
+	if encrypt {
+		active = cfg.ActiveKey
+	}
+	return NewKeyring(keys, active)
+}
+
+// Encrypts reports whether data is encrypted when written.
+func (k *Keyring) Encrypts() bool {
+	return k != nil && k.active != ""
+}
+
+// Seal encrypts plaintext with the active key, or returns it as is without one.
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	if !k.Encrypts() {
+		return plaintext, nil
+	}
+
+	aead := k.ciphers[k.active]
+	header := newHeader(k.active)
+
+	sealed := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(sealed, header)
+	nonce := sealed[len(header):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	return aead.Seal(sealed, nonce, plaintext, header), nil
+}
+
+// Open decrypts data sealed with any key of the keyring. Data that was not encrypted is returned as
+// is.
+func (k *Keyring) Open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	keyID, headerLength, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := k.lookup(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	header, rest := data[:headerLength], data[headerLength:]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("encrypted data is truncated")
+	}
+
+	plaintext, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt with key %s: %w", keyID, err)
+	}
+	return plaintext, nil
+}
+
+// HeaderLength is enough of the start of encrypted data to hold its header.
+const HeaderLength = len(magic) + 1 + maxKeyIDLength
+
+// IsCurrent reports whether data, of which prefix holds at least the first HeaderLength bytes or
+// all of it, is written the way the keyring writes: encrypted with the active key, or unencrypted
+// without one. Data that is not current is rewritten to rotate keys.
+func (k *Keyring) IsCurrent(prefix []byte) bool {
+	if !IsEncrypted(prefix) {
+		return !k.Encrypts()
+	}
+
+	keyID, _, err := parseHeader(prefix)
+	return err == nil && k.Encrypts() && keyID == k.active
+}
+
+// IsEncrypted reports whether data starts with the header of encrypted data.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// lookup returns the cipher of the key.
+func (k *Keyring) lookup(keyID string) (cipher.AEAD, error) {
+	if k == nil {
+		return nil, fmt.Errorf("%w %s: no encryption keys are configured", ErrUnknownKey, keyID)
+	}
+
+	aead, ok := k.ciphers[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, keyID)
+	}
+	return aead, nil
+}
+
+func newHeader(keyID string) []byte {
+	header := make([]byte, 0, len(magic)+1+len(keyID))
+	header = append(header, magic...)
+	header = append(header, byte(len(keyID)))
+	return append(header, keyID...)
+}
+
+// parseHeader returns the key ID of encrypted data and the length of its header.
+func parseHeader(data []byte) (string, int, error) {
+	if len(data) <= len(magic) {
+		return "", 0, errors.New("encryption header is truncated")
+	}
+
+	length := len(magic) + 1 + int(data[len(magic)])
+	if length > len(data) {
+		return "", 0, errors.New("encryption header is truncated")
+	}
+	return string(data[len(magic)+1 : length]), length, nil
+}
@@ -0,0 +1,232 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Files are encrypted in chunks so that they can be streamed: after the header and a random nonce
+// prefix, every chunk of up to chunkSize bytes is sealed on its own with the prefix, the chunk
+// counter and a flag marking the final chunk as nonce. Only the final chunk is shorter than
+// chunkSize, possibly empty, so a truncated file fails to decrypt instead of reading short.
+const (
+	chunkSize       = 64 * 1024
+	noncePrefixSize = 7
+	counterSize     = 4
+)
+
+// NewWriter returns a writer encrypting to w with the active key, or passing through to w without
+// one. Close writes the final chunk and must be called; it does not close w.
+func (k *Keyring) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if !k.Encrypts() {
+		return nopWriteCloser{w}, nil
+	}
+
+	header := newHeader(k.active)
+	sw := &streamWriter{
+		dst:    w,
+		aead:   k.ciphers[k.active],
+		header: header,
+		buf:    make([]byte, 0, chunkSize),
+	}
+	if _, err := rand.Read(sw.nonce[:noncePrefixSize]); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	if _, err := w.Write(append(header, sw.nonce[:noncePrefixSize]...)); err != nil {
+		return nil, fmt.Errorf("write encryption header: %w", err)
+	}
+	return sw, nil
+}
+
+// NewReader returns a reader decrypting r with any key of the keyring. Unencrypted content is read
+// as is.
+func (k *Keyring) NewReader(r io.Reader) (io.Reader, error) {
+	reader, _, err := k.newReader(r)
+	return reader, err
+}
+
+// NewSizedReader is NewReader for content of a known size, such as a file opened by the caller,
+// and also returns the size of the decrypted content.
+func (k *Keyring) NewSizedReader(r io.Reader, size int64) (io.Reader, int64, error) {
+	reader, overhead, err := k.newReader(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if overhead > 0 {
+		size = plaintextSize(size - overhead)
+	}
+	return reader, size, nil
+}
+
+// newReader returns a reader of the content of r and how many bytes of r precede the chunks, zero
+// when r is not encrypted.
+func (k *Keyring) newReader(r io.Reader) (io.Reader, int64, error) {
+	br := bufio.NewReaderSize(r, chunkSize)
+
+	prefix, err := br.Peek(len(magic) + 1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, 0, fmt.Errorf("read encryption header: %w", err)
+	}
+	if !IsEncrypted(prefix) {
+		return br, 0, nil
+	}
+
+	headerLength := len(magic) + 1 + int(prefix[len(magic)])
+	start, err := br.Peek(headerLength + noncePrefixSize)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read encryption header: %w", err)
+	}
+
+	keyID, _, err := parseHeader(start)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := k.lookup(keyID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sr := &streamReader{
+		src:    br,
+		aead:   aead,
+		header: append([]byte(nil), start[:headerLength]...),
+		buf:    make([]byte, chunkSize+aead.Overhead()),
+	}
+	copy(sr.nonce[:], start[headerLength:])
+
+	if _, err := br.Discard(len(start)); err != nil {
+		return nil, 0, fmt.Errorf("read encryption header: %w", err)
+	}
+	return sr, int64(len(start)), nil
+}
+
+// plaintextSize returns the size of the content of encrypted chunks of the given total size.
+func plaintextSize(chunks int64) int64 {
+	const overhead = 16 // GCM tag size
+	count := chunks/(chunkSize+overhead) + 1
+	return max(chunks-count*overhead, 0)
+}
+
+// chunkNonce sets the counter and final flag of the nonce of a chunk.
+func chunkNonce(nonce *[12]byte, counter uint32, final bool) []byte {
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	nonce[noncePrefixSize+counterSize] = 0
+	if final {
+		nonce[noncePrefixSize+counterSize] = 1
+	}
+	return nonce[:]
+}
+
+type streamWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	nonce   [12]byte
+	counter uint32
+	buf     []byte
+	closed  bool
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed encrypting writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), chunkSize-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+
+		// Full chunks are written right away, so that the final chunk written by Close is never full
+		if len(w.buf) == chunkSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *streamWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+func (w *streamWriter) flush(final bool) error {
+	sealed := w.aead.Seal(nil, chunkNonce(&w.nonce, w.counter, final), w.buf, w.header)
+	w.counter++
+	w.buf = w.buf[:0]
+
+	if _, err := w.dst.Write(sealed); err != nil {
+		return fmt.Errorf("write encrypted chunk: %w", err)
+	}
+	return nil
+}
+
+type streamReader struct {
+	src     io.Reader
+	aead    cipher.AEAD
+	header  []byte
+	nonce   [12]byte
+	counter uint32
+	buf     []byte
+	plain   []byte
+	done    bool
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk.
+func (r *streamReader) next() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	switch {
+	case err == nil:
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		r.done = true
+	case errors.Is(err, io.EOF):
+		return fmt.Errorf("encrypted content is truncated: %w", io.ErrUnexpectedEOF)
+	default:
+		return fmt.Errorf("read encrypted chunk: %w", err)
+	}
+
+	plain, err := r.aead.Open(r.buf[:0], chunkNonce(&r.nonce, r.counter, r.done), r.buf[:n], r.header)
+	if err != nil {
+		return fmt.Errorf("decrypt chunk %d: %w", r.counter, err)
+	}
+	r.counter++
+	r.plain = plain
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
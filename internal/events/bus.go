@@ -0,0 +1,126 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// Sink delivers events to an external system.
+type Sink interface {
+	Name() string
+	Publish(ctx context.Context, event Event) error
+	Close() error
+}
+
+// Bus fans events out to all sinks asynchronously so publishers never block on slow sinks.
+// Events are dropped (and logged) when the buffer is full.
+type Bus struct {
+	sinks   []Sink
+	eventCh chan Event
+	log     *slog.Logger
+	timeout time.Duration
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+}
+
+func NewBus(sinks []Sink, bufferSize int, publishTimeout time.Duration, log *slog.Logger) *Bus {
+	bus := &Bus{
+		sinks:   sinks,
+		eventCh: make(chan Event, bufferSize),
+		log:     log,
+		timeout: publishTimeout,
+	}
+
+	bus.wg.Add(1)
+	go bus.dispatch()
+
+	return bus
+}
+
+// NewBusFromConfig builds a bus with the sinks enabled in the configuration and the extra sinks.
+// The Kubernetes sink requires a cluster client and is wired separately by the controller; the
+// Slack and Teams sinks of the notifier package are passed as extra sinks.
+func NewBusFromConfig(cfg config.Events, redisCfg config.Redis, log *slog.Logger, extra ...Sink) (*Bus, error) {
+	sinks := make([]Sink, 0, len(cfg.Sinks))
+
+	for _, name := range cfg.Sinks {
+		var (
+			sink Sink
+			err  error
+		)
+
+		switch name {
+		case config.EventSinkRedis:
+			sink = NewRedisSink(redisCfg, cfg.RedisChannel)
+		case config.EventSinkKafka:
+			sink = NewKafkaSink(cfg.KafkaBrokers, cfg.KafkaTopic)
+		case config.EventSinkWebhook:
+			sink = NewWebhookSink(cfg.WebhookURL, cfg.PublishTimeout)
+		case config.EventSinkKubernetes, config.EventSinkSlack, config.EventSinkTeams:
+			continue
+		default:
+			err = fmt.Errorf("unknown event sink: %s", name)
+		}
+
+		if err != nil {
+			closeSinks(sinks, log)
+			return nil, fmt.Errorf("create %s event sink: %w", name, err)
+		}
+
+		log.Info("event sink enabled", "sink", name)
+		sinks = append(sinks, sink)
+	}
+
+	return NewBus(append(sinks, extra...), cfg.BufferSize, cfg.PublishTimeout, log), nil
+}
+
+// Publish enqueues an event for delivery. It never blocks.
+func (b *Bus) Publish(ctx context.Context, event Event) {
+	if len(b.sinks) == 0 {
+		return
+	}
+
+	select {
+	case b.eventCh <- event:
+	default:
+		b.log.WarnContext(ctx, "event bus buffer full, dropping event", "event_type", event.Type, "job_id", event.JobID)
+	}
+}
+
+// Close stops accepting events, drains the buffer and closes all sinks.
+func (b *Bus) Close() {
+	b.closeOnce.Do(func() {
+		close(b.eventCh)
+		b.wg.Wait()
+		closeSinks(b.sinks, b.log)
+	})
+}
+
+func (b *Bus) dispatch() {
+	defer b.wg.Done()
+
+	for event := range b.eventCh {
+		for _, sink := range b.sinks {
+			ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+			if err := sink.Publish(ctx, event); err != nil {
+				b.log.ErrorContext(ctx, "failed to publish event",
+					"sink", sink.Name(), "event_type", event.Type, "job_id", event.JobID, "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+func closeSinks(sinks []Sink, log *slog.Logger) {
+	for _, sink := range sinks {
+		if err := sink.Close(); err != nil {
+			log.Error("failed to close event sink", "sink", sink.Name(), "error", err)
+		}
+	}
+}
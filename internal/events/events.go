@@ -0,0 +1,50 @@
+package events
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type identifies a job lifecycle event.
+type Type string
+
+const (
+	JobCreated   Type = "job.created"
+	JobStarted   Type = "job.started"
+	JobSucceeded Type = "job.succeeded"
+	JobFailed    Type = "job.failed"
+	JobRetried   Type = "job.retried"
+	// JobBoosted records that a queued job was moved to the priority queue.
+	JobBoosted Type = "job.boosted"
+	// JobCanceled records that a pending job was canceled by a bulk cancel.
+	JobCanceled Type = "job.canceled"
+	// JobAnnotated records that a client changed the notes or labels of a job.
+	JobAnnotated Type = "job.annotated"
+
+	// NotificationTest is only sent by POST /api/v1/notifications/test to verify notification sinks.
+	NotificationTest Type = "notification.test"
+)
+
+// Event is a structured job lifecycle event delivered to every configured sink.
+type Event struct {
+	ID        uuid.UUID      `json:"id"`
+	Type      Type           `json:"type"`
+	JobID     uuid.UUID      `json:"job_id"`
+	TenantID  string         `json:"tenant_id,omitempty"`
+	Source    string         `json:"source"`
+	Timestamp time.Time      `json:"timestamp"`
+	Data      map[string]any `json:"data,omitempty"`
+}
+
+// New creates an event for the given job with a fresh ID and the current timestamp.
+func New(eventType Type, jobID uuid.UUID, source string, data map[string]any) Event {
+	return Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		JobID:     jobID,
+		Source:    source,
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+}
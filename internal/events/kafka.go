@@ -0,0 +1,53 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// KafkaSink writes events to a Kafka topic keyed by job ID, so events of one job stay ordered.
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Topic:                  topic,
+			Balancer:               &kafka.Hash{},
+			AllowAutoTopicCreation: true,
+		},
+	}
+}
+
+func (s *KafkaSink) Name() string {
+	return config.EventSinkKafka
+}
+
+func (s *KafkaSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	message := kafka.Message{
+		Key:   []byte(event.JobID.String()),
+		Value: data,
+	}
+
+	if err := s.writer.WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("write kafka message: %w", err)
+	}
+
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
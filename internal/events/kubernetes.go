@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// KubernetesSink records job events as core/v1 Events attached to a target object,
+// typically the worker Deployment, so they show up in `kubectl describe`.
+type KubernetesSink struct {
+	client    client.Client
+	target    corev1.ObjectReference
+	component string
+}
+
+func NewKubernetesSink(c client.Client, target corev1.ObjectReference, component string) *KubernetesSink {
+	return &KubernetesSink{
+		client:    c,
+		target:    target,
+		component: component,
+	}
+}
+
+func (s *KubernetesSink) Name() string {
+	return config.EventSinkKubernetes
+}
+
+func (s *KubernetesSink) Publish(ctx context.Context, event Event) error {
+	eventType := corev1.EventTypeNormal
+	if event.Type == JobFailed {
+		eventType = corev1.EventTypeWarning
+	}
+
+	now := metav1.NewTime(event.Timestamp)
+	k8sEvent := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: s.target.Name + ".",
+			Namespace:    s.target.Namespace,
+		},
+		InvolvedObject: s.target,
+		Reason:         reasonFor(event.Type),
+		Message:        fmt.Sprintf("job %s: %s", event.JobID, event.Type),
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: s.component},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if err := s.client.Create(ctx, k8sEvent); err != nil {
+		return fmt.Errorf("create kubernetes event: %w", err)
+	}
+
+	return nil
+}
+
+func (s *KubernetesSink) Close() error {
+	return nil
+}
+
+// reasonFor converts "job.succeeded" into the CamelCase "JobSucceeded" reason Kubernetes expects.
+func reasonFor(eventType Type) string {
+	var reason strings.Builder
+	for _, part := range strings.Split(string(eventType), ".") {
+		if part == "" {
+			continue
+		}
+		reason.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return reason.String()
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// RedisSink publishes events to a Redis pub/sub channel.
+type RedisSink struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedisSink(cfg config.Redis, channel string) *RedisSink {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address(),
+		Password: cfg.Password,
+		DB:       cfg.Database,
+	})
+
+	return &RedisSink{client: client, channel: channel}
+}
+
+func (s *RedisSink) Name() string {
+	return config.EventSinkRedis
+}
+
+func (s *RedisSink) Publish(ctx context.Context, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	if err := s.client.Publish(ctx, s.channel, data).Err(); err != nil {
+		return fmt.Errorf("publish to redis channel: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RedisSink) Close() error {
+	return s.client.Close()
+}
+
+// Subscribe forwards events from the Redis channel to the handler until ctx is cancelled.
+// It is used by consumers that live in other processes, e.g. the controller's Kubernetes sink.
+func Subscribe(ctx context.Context, cfg config.Redis, channel string, handler func(context.Context, Event)) error {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Address(),
+		Password: cfg.Password,
+		DB:       cfg.Database,
+	})
+	defer client.Close()
+
+	pubsub := client.Subscribe(ctx, channel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe to redis channel: %w", err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var event Event
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				continue
+			}
+			handler(ctx, event)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// waiterResubscribeDelay is how long the waiter pauses before subscribing again after the
+// subscription to the Redis channel failed.
+const waiterResubscribeDelay = 5 * time.Second
+
+// Waiter wakes requests waiting for a job to finish. It follows the events that workers publish to
+// the Redis channel, so waiting does not poll the database.
+type Waiter struct {
+	cfg     config.Redis
+	channel string
+	log     *slog.Logger
+
+	mu      sync.Mutex
+	waiting map[uuid.UUID]map[chan Event]struct{}
+}
+
+func NewWaiter(cfg config.Redis, channel string, log *slog.Logger) *Waiter {
+	return &Waiter{
+		cfg:     cfg,
+		channel: channel,
+		log:     log,
+		waiting: make(map[uuid.UUID]map[chan Event]struct{}),
+	}
+}
+
+// Run follows the Redis channel until ctx is cancelled, subscribing again when the subscription
+// fails. Waiters only time out while it is not subscribed.
+func (w *Waiter) Run(ctx context.Context) {
+	w.log.InfoContext(ctx, "waking job waiters on job events", "channel", w.channel)
+	for {
+		if err := Subscribe(ctx, w.cfg, w.channel, w.notify); err != nil {
+			w.log.ErrorContext(ctx, "job waiter subscription failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(waiterResubscribeDelay):
+		}
+	}
+}
+
+// Wait returns a channel that receives the event finishing the job, and a function to stop waiting
+// that must be called once the caller is done. Call Wait before reading the job so that a job
+// finishing in between is not missed.
+func (w *Waiter) Wait(jobID uuid.UUID) (<-chan Event, func()) {
+	ch := make(chan Event, 1)
+
+	w.mu.Lock()
+	if w.waiting[jobID] == nil {
+		w.waiting[jobID] = make(map[chan Event]struct{})
+	}
+	w.waiting[jobID][ch] = struct{}{}
+	w.mu.Unlock()
+
+	return ch, func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		delete(w.waiting[jobID], ch)
+		if len(w.waiting[jobID]) == 0 {
+			delete(w.waiting, jobID)
+		}
+	}
+}
+
+func (w *Waiter) notify(_ context.Context, event Event) {
+	if event.Type != JobSucceeded && event.Type != JobFailed && event.Type != JobCanceled {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.waiting[event.JobID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
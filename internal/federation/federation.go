@@ -0,0 +1,272 @@
+package federation
+
+import (
+	"cmp"
+	"context"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+// Region is the job queue of a region.
+type Region struct {
+	Name  string
+	Local bool
+	Queue *queue.RedisQueue
+}
+
+// RegionStats is the backlog of a region. An unreachable region only reports Error.
+type RegionStats struct {
+	Region string `json:"region"`
+	Local  bool   `json:"local"`
+	// Backlog counts every queued job, ByType and PriorityByType break it down by processing type
+	// and Queues holds the shared queues.
+	Backlog        int64                             `json:"backlog"`
+	ByType         map[database.ProcessingType]int64 `json:"by_type,omitempty"`
+	PriorityByType map[database.ProcessingType]int64 `json:"priority_by_type,omitempty"`
+	Queues         map[string]int64                  `json:"queues,omitempty"`
+	Error          string                            `json:"error,omitempty"`
+}
+
+// Federation connects the local queue to the queues of the other regions and moves overflow jobs
+// to regions with spare capacity.
+type Federation struct {
+	config  config.Federation
+	regions []Region
+	log     *slog.Logger
+}
+
+// New connects to the queues of the configured regions. Remote regions are connected lazily, so an
+// unreachable region shows up in stats instead of failing the local one.
+func New(cfg config.Federation, redis config.Redis, local *queue.RedisQueue, log *slog.Logger) (*Federation, error) {
+	f := &Federation{
+		config:  cfg,
+		regions: []Region{{Name: cfg.Region, Local: true, Queue: local}},
+		log:     log,
+	}
+
+	addresses, err := cfg.RegionAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(addresses)) {
+		remote, err := redis.ForAddress(addresses[name])
+		if err != nil {
+			return nil, err
+		}
+
+		log.Info("federating queue with region", "region", name, "address", remote.Address())
+		f.regions = append(f.regions, Region{Name: name, Queue: queue.NewLazyRedisQueue(remote, log)})
+	}
+
+	return f, nil
+}
+
+// RotatePassword switches the remote regions to a new Redis password; they share the local one.
+func (f *Federation) RotatePassword(password string) {
+	for _, region := range f.Remotes() {
+		region.Queue.RotatePassword(password)
+	}
+}
+
+// Close closes the connections to the remote regions. The local queue is left to its owner.
+func (f *Federation) Close() error {
+	for _, region := range f.Remotes() {
+		if err := region.Queue.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remotes returns the regions other than the local one.
+func (f *Federation) Remotes() []Region {
+	return f.regions[1:]
+}
+
+// Stats reads the backlog of every region concurrently, the local region first.
+func (f *Federation) Stats(ctx context.Context) []RegionStats {
+	stats := make([]RegionStats, len(f.regions))
+
+	var wg sync.WaitGroup
+	for i, region := range f.regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stats[i] = regionStats(ctx, region)
+		}()
+	}
+	wg.Wait()
+
+	return stats
+}
+
+func regionStats(ctx context.Context, region Region) RegionStats {
+	stats := RegionStats{Region: region.Name, Local: region.Local}
+
+	byType, err := region.Queue.GetTypeQueueLengths(ctx)
+	if err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+
+	priorityByType, err := region.Queue.GetTypePriorityQueueLengths(ctx)
+	if err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+
+	queues, err := region.Queue.GetAllQueuesLength(ctx)
+	if err != nil {
+		stats.Error = err.Error()
+		return stats
+	}
+
+	stats.ByType, stats.PriorityByType, stats.Queues = byType, priorityByType, queues
+	for _, length := range byType {
+		stats.Backlog += length
+	}
+	stats.Backlog += queues[queue.QueueMain] + queues[queue.QueuePriority]
+	return stats
+}
+
+// Total sums the stats of the reachable regions.
+func Total(stats []RegionStats) RegionStats {
+	total := RegionStats{
+		Region:         "total",
+		ByType:         make(map[database.ProcessingType]int64),
+		PriorityByType: make(map[database.ProcessingType]int64),
+		Queues:         make(map[string]int64),
+	}
+
+	for _, region := range stats {
+		if region.Error != "" {
+			continue
+		}
+
+		total.Backlog += region.Backlog
+		for processingType, length := range region.ByType {
+			total.ByType[processingType] += length
+		}
+		for processingType, length := range region.PriorityByType {
+			total.PriorityByType[processingType] += length
+		}
+		for name, length := range region.Queues {
+			total.Queues[name] += length
+		}
+	}
+
+	return total
+}
+
+// Start rebalances queued jobs across regions every interval until ctx is cancelled.
+func (f *Federation) Start(ctx context.Context) {
+	ticker := time.NewTicker(f.config.Interval)
+	defer ticker.Stop()
+
+	f.log.InfoContext(ctx, "starting queue federation",
+		"region", f.config.Region,
+		"regions", len(f.Remotes()),
+		"interval", f.config.Interval,
+		"overflow_threshold", f.config.OverflowThreshold,
+		"accept_threshold", f.config.AcceptThreshold)
+
+	for {
+		select {
+		case <-ctx.Done():
+			f.log.InfoContext(ctx, "stopping queue federation")
+			return
+		case <-ticker.C:
+			f.Rebalance(ctx)
+		}
+	}
+}
+
+// Rebalance moves the local backlog above the overflow threshold to remote regions below the
+// accept threshold, filling the emptiest region first without lifting it past the threshold.
+// Only the main per-type queues are moved: priority jobs stay where they are consumed fastest.
+// Each region only pushes its own overflow, so controllers of different regions never contend.
+func (f *Federation) Rebalance(ctx context.Context) {
+	stats := f.Stats(ctx)
+	for _, region := range stats {
+		updateRegionMetrics(region)
+		if region.Error != "" {
+			f.log.WarnContext(ctx, "failed to read region backlog", "region", region.Region, "error", region.Error)
+		}
+	}
+
+	local := stats[0]
+	if local.Error != "" || local.Backlog <= f.config.OverflowThreshold {
+		return
+	}
+
+	// Jobs of the shared queues and priority jobs are not movable
+	movable := make(map[database.ProcessingType]int64, len(local.ByType))
+	for processingType, length := range local.ByType {
+		if length -= local.PriorityByType[processingType]; length > 0 {
+			movable[processingType] = length
+		}
+	}
+
+	candidates := make([]int, 0, len(stats)-1)
+	for i := 1; i < len(stats); i++ {
+		if stats[i].Error == "" && stats[i].Backlog < f.config.AcceptThreshold {
+			candidates = append(candidates, i)
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b int) int {
+		return cmp.Compare(stats[a].Backlog, stats[b].Backlog)
+	})
+
+	budget := min(local.Backlog-f.config.OverflowThreshold, f.config.MaxMoves)
+	for _, i := range candidates {
+		if budget <= 0 {
+			break
+		}
+
+		target := f.regions[i]
+		room := min(f.config.AcceptThreshold-stats[i].Backlog, budget)
+		moved := f.moveTo(ctx, target, movable, room)
+		budget -= moved
+
+		if moved > 0 {
+			f.log.InfoContext(ctx, "moved overflow jobs to region",
+				"region", target.Name, "jobs", moved, "local_backlog", local.Backlog)
+		}
+	}
+}
+
+// moveTo moves up to count jobs to the region, taking from the types with the largest movable
+// backlog first, and returns how many were moved.
+func (f *Federation) moveTo(ctx context.Context, target Region, movable map[database.ProcessingType]int64, count int64) int64 {
+	types := slices.SortedFunc(maps.Keys(movable), func(a, b database.ProcessingType) int {
+		return cmp.Or(cmp.Compare(movable[b], movable[a]), cmp.Compare(a, b))
+	})
+
+	var total int64
+	for _, processingType := range types {
+		if total >= count {
+			break
+		}
+
+		moved, err := f.regions[0].Queue.MoveJobs(ctx, processingType, target.Queue, min(movable[processingType], count-total))
+		movable[processingType] -= moved
+		total += moved
+		recordMovedJobs(f.config.Region, target.Name, processingType, moved)
+
+		if err != nil {
+			f.log.ErrorContext(ctx, "failed to move jobs to region",
+				"region", target.Name, "processing_type", processingType, "moved", moved, "error", err)
+			break
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,49 @@
+package federation
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+)
+
+var (
+	regionBacklogGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "textprocessing_region_queue_depth",
+			Help: "Current number of queued jobs per federated region",
+		},
+		[]string{"region"},
+	)
+
+	regionUpGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "textprocessing_region_up",
+			Help: "Whether the queue of a federated region is reachable (1) or not (0)",
+		},
+		[]string{"region"},
+	)
+
+	federatedJobsCounter = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "textprocessing_federated_jobs_total",
+			Help: "Total number of queued jobs moved to another region",
+		},
+		[]string{"from_region", "to_region", "processing_type"},
+	)
+)
+
+func updateRegionMetrics(stats RegionStats) {
+	if stats.Error != "" {
+		regionUpGauge.WithLabelValues(stats.Region).Set(0)
+		return
+	}
+
+	regionUpGauge.WithLabelValues(stats.Region).Set(1)
+	regionBacklogGauge.WithLabelValues(stats.Region).Set(float64(stats.Backlog))
+}
+
+func recordMovedJobs(from, to string, processingType database.ProcessingType, count int64) {
+	if count > 0 {
+		federatedJobsCounter.WithLabelValues(from, to, string(processingType)).Add(float64(count))
+	}
+}
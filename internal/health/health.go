@@ -0,0 +1,228 @@
+// Package health serves the startup, liveness and readiness endpoints of every service from named
+// dependency checks. Check results are cached for a TTL, so probes from several kubelets and load
+// balancers do not hit the database and Redis on every request, and concurrent probes share one
+// run of each check.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status is the health of a check or of a whole service.
+type Status string
+
+const (
+	StatusHealthy Status = "healthy"
+	// StatusDegraded means an optional check failed: the service works with reduced function.
+	StatusDegraded  Status = "degraded"
+	StatusUnhealthy Status = "unhealthy"
+)
+
+// CheckFunc reports a dependency as unhealthy by returning an error.
+type CheckFunc func(ctx context.Context) error
+
+// Result is the outcome of a check. CheckedAt and LatencyMS describe the run it was cached from.
+type Result struct {
+	Status    Status    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the health of a service: unhealthy when a critical check failed, degraded when an
+// optional one did.
+type Report struct {
+	Status    Status            `json:"status"`
+	Service   string            `json:"service"`
+	Timestamp int64             `json:"timestamp"`
+	Checks    map[string]Result `json:"checks,omitempty"`
+}
+
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+
+	mu     sync.Mutex
+	result Result
+}
+
+// Checker runs the checks of a service.
+type Checker struct {
+	service string
+	ttl     time.Duration
+	timeout time.Duration
+	log     *slog.Logger
+
+	checks []*check
+	// startup checks only gate /startupz, on top of the critical checks.
+	startup []*check
+	started atomic.Bool
+}
+
+// NewChecker creates a checker for the service that reuses check results for ttl and gives up on
+// checks after timeout.
+func NewChecker(service string, ttl, timeout time.Duration, log *slog.Logger) *Checker {
+	return &Checker{service: service, ttl: ttl, timeout: timeout, log: log}
+}
+
+// Critical adds a check whose failure makes the service unhealthy and not ready.
+func (c *Checker) Critical(name string, fn CheckFunc) {
+	c.checks = append(c.checks, &check{name: name, critical: true, fn: fn})
+}
+
+// Optional adds a check whose failure degrades the service but keeps it ready.
+func (c *Checker) Optional(name string, fn CheckFunc) {
+	c.checks = append(c.checks, &check{name: name, fn: fn})
+}
+
+// Startup adds a check that must pass, together with the critical checks, before the service has
+// started. Once started, it is never run again.
+func (c *Checker) Startup(name string, fn CheckFunc) {
+	c.startup = append(c.startup, &check{name: name, critical: true, fn: fn})
+}
+
+// Check runs the checks concurrently, reusing results younger than the TTL.
+func (c *Checker) Check(ctx context.Context) Report {
+	return c.evaluate(ctx, c.checks)
+}
+
+func (c *Checker) evaluate(ctx context.Context, checks []*check) Report {
+	results := make([]Result, len(checks))
+
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, chk)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:    StatusHealthy,
+		Service:   c.service,
+		Timestamp: time.Now().Unix(),
+		Checks:    make(map[string]Result, len(checks)),
+	}
+	for i, chk := range checks {
+		report.Checks[chk.name] = results[i]
+		switch {
+		case results[i].Status == StatusHealthy:
+		case chk.critical:
+			report.Status = StatusUnhealthy
+		case report.Status == StatusHealthy:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run returns the cached result of the check or runs it. Concurrent callers wait for the run in
+// progress instead of starting their own.
+func (c *Checker) run(ctx context.Context, chk *check) Result {
+	chk.mu.Lock()
+	defer chk.mu.Unlock()
+
+	if !chk.result.CheckedAt.IsZero() && time.Since(chk.result.CheckedAt) < c.ttl {
+		return chk.result
+	}
+
+	// The result is shared with other probes, so it must not fail because this one went away
+	checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := chk.fn(checkCtx)
+	latency := time.Since(start)
+
+	chk.result = Result{
+		Status:    StatusHealthy,
+		Critical:  chk.critical,
+		LatencyMS: float64(latency) / float64(time.Millisecond),
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		chk.result.Status = StatusUnhealthy
+		chk.result.Error = err.Error()
+		c.log.WarnContext(ctx, "health check failed",
+			"check", chk.name, "critical", chk.critical, "error", err, "latency", latency.String())
+	}
+
+	return chk.result
+}
+
+// Register adds the health endpoints to mux:
+//
+//	GET /startupz  startup: 503 until the critical and startup checks have passed once
+//	GET /livez     liveness: the process serves requests; runs no checks
+//	GET /healthz   alias for /livez
+//	GET /readyz    readiness: 503 when a critical check fails, with the result of every check
+func (c *Checker) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /startupz", c.Startupz)
+	mux.HandleFunc("GET /livez", c.Livez)
+	mux.HandleFunc("GET /healthz", c.Livez)
+	mux.HandleFunc("GET /readyz", c.Readyz)
+}
+
+// Livez reports the process as alive without checking dependencies, so a failing dependency never
+// gets pods restarted.
+func (c *Checker) Livez(w http.ResponseWriter, _ *http.Request) {
+	c.writeJSON(w, http.StatusOK, Report{Status: StatusHealthy, Service: c.service, Timestamp: time.Now().Unix()})
+}
+
+// Readyz reports the result of every check; the service is ready unless a critical check failed.
+func (c *Checker) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+
+	statusCode := http.StatusOK
+	if report.Status == StatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	}
+	c.writeJSON(w, statusCode, report)
+}
+
+// Startupz reports whether the service has started: its critical and startup checks passed once.
+// After that it always succeeds, so a startupProbe hands over to the liveness and readiness probes.
+func (c *Checker) Startupz(w http.ResponseWriter, r *http.Request) {
+	if c.started.Load() {
+		c.writeJSON(w, http.StatusOK, Report{Status: StatusHealthy, Service: c.service, Timestamp: time.Now().Unix()})
+		return
+	}
+
+	checks := make([]*check, 0, len(c.checks)+len(c.startup))
+	for _, chk := range c.checks {
+		if chk.critical {
+			checks = append(checks, chk)
+		}
+	}
+	checks = append(checks, c.startup...)
+
+	report := c.evaluate(r.Context(), checks)
+
+	statusCode := http.StatusOK
+	if report.Status == StatusUnhealthy {
+		statusCode = http.StatusServiceUnavailable
+	} else if c.started.CompareAndSwap(false, true) {
+		c.log.InfoContext(r.Context(), "service started", "service", c.service)
+	}
+	c.writeJSON(w, statusCode, report)
+}
+
+func (c *Checker) writeJSON(w http.ResponseWriter, statusCode int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		c.log.Error("failed to encode health report", "error", err)
+	}
+}
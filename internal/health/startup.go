@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	initialWaitBackoff = 500 * time.Millisecond
+	maxWaitBackoff     = 10 * time.Second
+)
+
+// Dependency is a service that must be reachable before a service can start.
+type Dependency struct {
+	Name  string
+	Check CheckFunc
+}
+
+// WaitFor retries each dependency with exponential backoff until it is reachable, giving up after
+// timeout. It lets services wait for Postgres and Redis at boot instead of crash-looping while they
+// warm up.
+func WaitFor(ctx context.Context, timeout time.Duration, log *slog.Logger, deps ...Dependency) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, dep := range deps {
+		if err := waitFor(ctx, log, dep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func waitFor(ctx context.Context, log *slog.Logger, dep Dependency) error {
+	backoff := initialWaitBackoff
+	for attempt := 1; ; attempt++ {
+		err := dep.Check(ctx)
+		if err == nil {
+			log.InfoContext(ctx, "dependency available", "dependency", dep.Name, "attempts", attempt)
+			return nil
+		}
+
+		log.WarnContext(ctx, "waiting for dependency",
+			"dependency", dep.Name, "attempt", attempt, "retry_in", backoff.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return fmt.Errorf("%s not available after %d attempts: %w", dep.Name, attempt, err)
+			}
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxWaitBackoff) //nolint:mnd // double the backoff
+	}
+}
@@ -0,0 +1,209 @@
+// Package notifier posts job events as chat messages to Slack and Microsoft Teams incoming
+// webhooks. Its sinks subscribe to the event bus like the other event sinks; every tenant can
+// have its own channel.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/events"
+)
+
+// DefaultTemplate renders events when no template is configured.
+const DefaultTemplate = `{{.Type}} job {{.JobID}}` +
+	`{{with .TenantID}} (tenant {{.}}){{end}}` +
+	`{{with index .Data "processing_type"}} [{{.}}]{{end}}` +
+	`{{with index .Data "error"}}: {{.}}{{end}}` +
+	`{{with index .Data "message"}}: {{.}}{{end}}`
+
+// ErrNoWebhook is returned for events of a tenant without a channel when no default is configured.
+var ErrNoWebhook = errors.New("no webhook configured")
+
+// ErrRateLimited is returned for messages dropped by the rate limit of their webhook.
+var ErrRateLimited = errors.New("notification rate limit exceeded")
+
+// payloadFunc builds the request body of a chat service from the rendered message.
+type payloadFunc func(event events.Event, text string) any
+
+// Notifier is an event sink posting a message per event to a chat webhook.
+type Notifier struct {
+	name           string
+	payload        payloadFunc
+	defaultWebhook string
+	tenantWebhooks map[string]string
+	types          []string
+	template       *template.Template
+	limiter        *rateLimiter
+	client         *http.Client
+	log            *slog.Logger
+}
+
+// FromConfig creates the Slack and Teams sinks enabled in cfg.
+func FromConfig(cfg config.Events, log *slog.Logger) ([]*Notifier, error) {
+	n := cfg.Notifications
+	var notifiers []*Notifier
+
+	if cfg.Enabled(config.EventSinkSlack) {
+		slack, err := newNotifier(config.EventSinkSlack, slackPayload, n.SlackWebhookURL, n.SlackTenantWebhooks, n, cfg.PublishTimeout, log)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, slack)
+	}
+
+	if cfg.Enabled(config.EventSinkTeams) {
+		teams, err := newNotifier(config.EventSinkTeams, teamsPayload, n.TeamsWebhookURL, n.TeamsTenantWebhooks, n, cfg.PublishTimeout, log)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, teams)
+	}
+
+	return notifiers, nil
+}
+
+// newNotifier creates a notifier named name, posting the payloads to defaultWebhook or the webhook of the
+// event's tenant among tenantWebhooks, given as tenant=url.
+func newNotifier(
+	name string, payload payloadFunc, defaultWebhook string, tenantWebhooks []string, cfg config.Notifications,
+	timeout time.Duration, log *slog.Logger,
+) (*Notifier, error) {
+	webhooks, err := config.ParseTenantWebhooks(tenantWebhooks)
+	if err != nil {
+		return nil, fmt.Errorf("%s notifier: %w", name, err)
+	}
+
+	text := cfg.Template
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s notifier: parse template: %w", name, err)
+	}
+
+	return &Notifier{
+		name:           name,
+		payload:        payload,
+		defaultWebhook: defaultWebhook,
+		tenantWebhooks: webhooks,
+		types:          cfg.Types,
+		template:       tmpl,
+		limiter:        newRateLimiter(cfg.RateLimit, cfg.RateWindow),
+		client:         &http.Client{Timeout: timeout},
+		log:            log.With("component", "notifier", "sink", name),
+	}, nil
+}
+
+func (n *Notifier) Name() string {
+	return n.name
+}
+
+// Publish posts the event when its type is notified. Events without a channel for their tenant
+// and events beyond the rate limit are dropped.
+func (n *Notifier) Publish(ctx context.Context, event events.Event) error {
+	if len(n.types) > 0 && !slices.Contains(n.types, string(event.Type)) {
+		return nil
+	}
+
+	err := n.send(ctx, event)
+	if errors.Is(err, ErrNoWebhook) {
+		return nil
+	}
+	if errors.Is(err, ErrRateLimited) {
+		n.log.DebugContext(ctx, "dropping rate limited notification", "event_type", event.Type, "tenant_id", event.TenantID)
+		return nil
+	}
+	return err
+}
+
+// Test posts a test message to the channel of the tenant, reporting why it was not delivered.
+func (n *Notifier) Test(ctx context.Context, tenantID string) error {
+	return n.send(ctx, events.Event{
+		ID:        uuid.New(),
+		Type:      events.NotificationTest,
+		TenantID:  tenantID,
+		Source:    "text-api",
+		Timestamp: time.Now(),
+		Data:      map[string]any{"message": "test notification"},
+	})
+}
+
+func (n *Notifier) Close() error {
+	n.client.CloseIdleConnections()
+	return nil
+}
+
+func (n *Notifier) send(ctx context.Context, event events.Event) error {
+	webhook := n.webhook(event.TenantID)
+	if webhook == "" {
+		return fmt.Errorf("%w for tenant %q", ErrNoWebhook, event.TenantID)
+	}
+
+	var text strings.Builder
+	if err := n.template.Execute(&text, event); err != nil {
+		return fmt.Errorf("render notification: %w", err)
+	}
+
+	if dropped, ok := n.limiter.allow(webhook); !ok {
+		if dropped == 1 {
+			n.log.WarnContext(ctx, "notification rate limit reached, dropping messages", "tenant_id", event.TenantID)
+		}
+		return ErrRateLimited
+	}
+
+	return n.post(ctx, webhook, n.payload(event, text.String()))
+}
+
+// webhook returns the webhook of the tenant, or the default one.
+func (n *Notifier) webhook(tenantID string) string {
+	if webhook, ok := n.tenantWebhooks[tenantID]; ok {
+		return webhook
+	}
+	return n.defaultWebhook
+}
+
+func (n *Notifier) post(ctx context.Context, webhook string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		// The URL holds the webhook token, so only the cause is reported
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%s webhook returned status %d", n.name, resp.StatusCode)
+	}
+	return nil
+}
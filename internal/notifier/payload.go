@@ -0,0 +1,37 @@
+package notifier
+
+import (
+	"github.com/rsav/k8s-learning/internal/events"
+)
+
+// slackPayload is a Slack incoming webhook message.
+func slackPayload(_ events.Event, text string) any {
+	return map[string]string{"text": text}
+}
+
+// teamsPayload is a Microsoft Teams webhook message carrying an Adaptive Card, which Workflows
+// webhooks and the older Office 365 connectors both accept.
+func teamsPayload(event events.Event, text string) any {
+	color := "default"
+	if event.Type == events.JobFailed {
+		color = "attention"
+	}
+
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body": []map[string]any{{
+					"type":  "TextBlock",
+					"text":  text,
+					"wrap":  true,
+					"color": color,
+				}},
+			},
+		}},
+	}
+}
@@ -0,0 +1,47 @@
+package notifier
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows up to limit messages per fixed window to every webhook, keeping chat services
+// from throttling or disabling the webhook during bursts of events.
+type rateLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+type rateWindow struct {
+	start   time.Time
+	sent    int
+	dropped int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, windows: make(map[string]*rateWindow)}
+}
+
+// allow reports whether a message may be posted to webhook, and otherwise how many messages were
+// dropped within the current window, including this one.
+func (l *rateLimiter) allow(webhook string) (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[webhook]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &rateWindow{start: now}
+		l.windows[webhook] = w
+	}
+
+	if w.sent >= l.limit {
+		w.dropped++
+		return w.dropped, false
+	}
+	w.sent++
+	return 0, true
+}
@@ -0,0 +1,124 @@
+package observability
+
+import (
+	"fmt"
+
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+type (
+	// RuleFile mirrors the Prometheus rule file format. Prometheus accepts it as JSON since JSON is valid YAML.
+	RuleFile struct {
+		Groups []RuleGroup `json:"groups"`
+	}
+
+	RuleGroup struct {
+		Name  string `json:"name"`
+		Rules []Rule `json:"rules"`
+	}
+
+	Rule struct {
+		Alert       string            `json:"alert"`
+		Expr        string            `json:"expr"`
+		For         string            `json:"for,omitempty"`
+		Labels      map[string]string `json:"labels,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+)
+
+const (
+	queueDepthAlertThreshold   = 100
+	failedQueueAlertThreshold  = 10
+	failedQueueAgeAlertSeconds = 3 * 24 * 60 * 60
+	jobFailureRatioThreshold   = 0.1
+	apiLatencyP95Threshold     = 1.0
+	jobLatencyP95Threshold     = 60.0
+	scalingFlapEventsThreshold = 6
+)
+
+// NewAlertRules builds the Prometheus alerting rules for the text processing system.
+func NewAlertRules() RuleFile {
+	return RuleFile{
+		Groups: []RuleGroup{
+			{
+				Name: "text-processing",
+				Rules: []Rule{
+					{
+						Alert: "TextProcessingQueueBacklog",
+						Expr: fmt.Sprintf(`(sum(%s{queue_name!~"%s|%s"}) or vector(0)) + (sum(%s) or vector(0)) > %d`,
+							MetricQueueDepth, queue.QueueFailed, queue.QueuePoison, MetricTypeQueueDepth, queueDepthAlertThreshold),
+						For:    "10m",
+						Labels: map[string]string{"severity": "warning"},
+						Annotations: map[string]string{
+							"summary": "Text processing queue backlog is growing",
+						},
+					},
+					{
+						Alert:  "TextProcessingFailedQueueGrowing",
+						Expr:   fmt.Sprintf(`%s{queue_name="%s"} > %d`, MetricQueueDepth, queue.QueueFailed, failedQueueAlertThreshold),
+						For:    "5m",
+						Labels: map[string]string{"severity": "warning"},
+						Annotations: map[string]string{
+							"summary": "Jobs are accumulating in the failed queue",
+						},
+					},
+					{
+						Alert:  "TextProcessingFailedQueueAging",
+						Expr:   fmt.Sprintf(`%s > %d`, MetricFailedQueueOldestAge, failedQueueAgeAlertSeconds),
+						For:    "10m",
+						Labels: map[string]string{"severity": "warning"},
+						Annotations: map[string]string{
+							"summary": "Failed jobs have been waiting in the failed queue for over 3 days",
+						},
+					},
+					{
+						Alert:  "TextProcessingPoisonMessages",
+						Expr:   fmt.Sprintf(`%s{queue_name="%s"} > 0`, MetricQueueDepth, queue.QueuePoison),
+						For:    "5m",
+						Labels: map[string]string{"severity": "warning"},
+						Annotations: map[string]string{
+							"summary": "Messages were quarantined in the poison queue and need inspection",
+						},
+					},
+					{
+						Alert:  "TextProcessingHighJobFailureRate",
+						Expr:   fmt.Sprintf("%s > %g", jobFailureRatioExpr(), jobFailureRatioThreshold),
+						For:    "10m",
+						Labels: map[string]string{"severity": "critical"},
+						Annotations: map[string]string{
+							"summary": "More than 10% of processed jobs are failing",
+						},
+					},
+					{
+						Alert:  "TextProcessingAPIHighLatency",
+						Expr:   fmt.Sprintf("%s > %g", quantileExpr(MetricHTTPRequestDuration, "path"), apiLatencyP95Threshold),
+						For:    "10m",
+						Labels: map[string]string{"severity": "warning"},
+						Annotations: map[string]string{
+							"summary": "API p95 latency is above 1s",
+						},
+					},
+					{
+						Alert: "TextProcessingJobHighLatency",
+						Expr: fmt.Sprintf("%s > %g",
+							quantileExpr(MetricWorkerJobDuration, "processing_type"), jobLatencyP95Threshold),
+						For:    "15m",
+						Labels: map[string]string{"severity": "warning"},
+						Annotations: map[string]string{
+							"summary": "Job processing p95 latency is above 60s",
+						},
+					},
+					{
+						Alert: "TextProcessingScalingFlapping",
+						Expr: fmt.Sprintf("sum(increase(%s[30m])) > %d",
+							MetricAutoscalingEventsTotal, scalingFlapEventsThreshold),
+						Labels: map[string]string{"severity": "info"},
+						Annotations: map[string]string{
+							"summary": "Worker deployment is scaling up and down frequently",
+						},
+					},
+				},
+			},
+		},
+	}
+}
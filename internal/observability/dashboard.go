@@ -0,0 +1,165 @@
+package observability
+
+import "fmt"
+
+type (
+	// Dashboard is the subset of the Grafana dashboard model needed to render time series panels.
+	Dashboard struct {
+		UID           string    `json:"uid"`
+		Title         string    `json:"title"`
+		Tags          []string  `json:"tags"`
+		Timezone      string    `json:"timezone"`
+		Refresh       string    `json:"refresh"`
+		SchemaVersion int       `json:"schemaVersion"`
+		Time          TimeRange `json:"time"`
+		Panels        []Panel   `json:"panels"`
+	}
+
+	TimeRange struct {
+		From string `json:"from"`
+		To   string `json:"to"`
+	}
+
+	Panel struct {
+		ID         int        `json:"id"`
+		Title      string     `json:"title"`
+		Type       string     `json:"type"`
+		Datasource Datasource `json:"datasource"`
+		GridPos    GridPos    `json:"gridPos"`
+		Targets    []Target   `json:"targets"`
+	}
+
+	Datasource struct {
+		Type string `json:"type"`
+		UID  string `json:"uid"`
+	}
+
+	GridPos struct {
+		H int `json:"h"`
+		W int `json:"w"`
+		X int `json:"x"`
+		Y int `json:"y"`
+	}
+
+	Target struct {
+		RefID        string `json:"refId"`
+		Expr         string `json:"expr"`
+		LegendFormat string `json:"legendFormat,omitempty"`
+	}
+)
+
+const (
+	panelWidth    = 12
+	panelHeight   = 8
+	panelsPerRow  = 2
+	schemaVersion = 39
+)
+
+// NewDashboard builds the text processing overview dashboard covering queue depth,
+// scaling activity, job failure rate, p95 latencies and worker resource recommendations.
+func NewDashboard() Dashboard {
+	queries := []struct {
+		title  string
+		expr   string
+		legend string
+	}{
+		{
+			title:  "Queue Depth",
+			expr:   fmt.Sprintf("sum(%s) by (queue_name)", MetricQueueDepth),
+			legend: "{{queue_name}}",
+		},
+		{
+			title:  "Backlog by Processing Type",
+			expr:   fmt.Sprintf("sum(%s) by (processing_type)", MetricTypeQueueDepth),
+			legend: "{{processing_type}}",
+		},
+		{
+			title:  "Worker Replicas",
+			expr:   fmt.Sprintf("sum(%s) by (job_name)", MetricCurrentReplicas),
+			legend: "{{job_name}}",
+		},
+		{
+			title:  "Autoscaling Events",
+			expr:   fmt.Sprintf("sum(increase(%s[%s])) by (direction)", MetricAutoscalingEventsTotal, defaultRateWindow),
+			legend: "{{direction}}",
+		},
+		{
+			title:  "Job Failure Rate",
+			expr:   jobFailureRatioExpr(),
+			legend: "failure ratio",
+		},
+		{
+			title:  "API p95 Latency",
+			expr:   quantileExpr(MetricHTTPRequestDuration, "path"),
+			legend: "{{path}}",
+		},
+		{
+			title:  "Job Processing p95 Latency",
+			expr:   quantileExpr(MetricWorkerJobDuration, "processing_type"),
+			legend: "{{processing_type}}",
+		},
+		{
+			title:  "API Request Rate",
+			expr:   fmt.Sprintf("sum(rate(%s[%s])) by (status)", MetricHTTPRequestsTotal, defaultRateWindow),
+			legend: "{{status}}",
+		},
+		{
+			title:  "Jobs Created",
+			expr:   fmt.Sprintf("sum(rate(%s[%s]))", MetricJobsCreatedTotal, defaultRateWindow),
+			legend: "jobs/s",
+		},
+		{
+			title:  "Active Jobs",
+			expr:   fmt.Sprintf("sum(%s)", MetricWorkerJobsActive),
+			legend: "active",
+		},
+		{
+			title:  "Worker Throughput",
+			expr:   fmt.Sprintf("sum(%s) by (job_name)", MetricWorkerThroughput),
+			legend: "{{job_name}} jobs/min",
+		},
+		{
+			title:  "Recommended Worker Requests",
+			expr:   fmt.Sprintf("%s{kind=\"request\"}", MetricRecommendedResources),
+			legend: "{{job_name}}/{{container}} {{resource}}",
+		},
+	}
+
+	panels := make([]Panel, 0, len(queries))
+	for i, q := range queries {
+		panels = append(panels, Panel{
+			ID:         i + 1,
+			Title:      q.title,
+			Type:       "timeseries",
+			Datasource: Datasource{Type: "prometheus", UID: defaultPrometheusDatasourceID},
+			GridPos: GridPos{
+				H: panelHeight,
+				W: panelWidth,
+				X: (i % panelsPerRow) * panelWidth,
+				Y: (i / panelsPerRow) * panelHeight,
+			},
+			Targets: []Target{{RefID: "A", Expr: q.expr, LegendFormat: q.legend}},
+		})
+	}
+
+	return Dashboard{
+		UID:           "text-processing-overview",
+		Title:         "Text Processing Overview",
+		Tags:          []string{"k8s-learning", "generated"},
+		Timezone:      "browser",
+		Refresh:       "30s",
+		SchemaVersion: schemaVersion,
+		Time:          TimeRange{From: "now-1h", To: "now"},
+		Panels:        panels,
+	}
+}
+
+func quantileExpr(histogram, by string) string {
+	return fmt.Sprintf("histogram_quantile(%s, sum(rate(%s_bucket[%s])) by (le, %s))",
+		defaultQuantile, histogram, defaultRateWindow, by)
+}
+
+func jobFailureRatioExpr() string {
+	return fmt.Sprintf(`sum(rate(%[1]s{status="failed"}[%[2]s])) / clamp_min(sum(rate(%[1]s[%[2]s])), 1e-9)`,
+		MetricWorkerJobsProcessed, defaultRateWindow)
+}
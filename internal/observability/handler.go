@@ -0,0 +1,37 @@
+package observability
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// Handler serves the generated dashboard and alert rules so they can be provisioned from a running service.
+type Handler struct {
+	log *slog.Logger
+}
+
+func NewHandler(log *slog.Logger) *Handler {
+	return &Handler{log: log}
+}
+
+// Dashboard serves the Grafana dashboard JSON.
+func (h *Handler) Dashboard(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, NewDashboard())
+}
+
+// AlertRules serves the Prometheus alerting rules.
+func (h *Handler) AlertRules(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, NewAlertRules())
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, r *http.Request, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		h.log.ErrorContext(r.Context(), "failed to encode observability response", "error", err)
+	}
+}
@@ -0,0 +1,26 @@
+package observability
+
+// Metric names emitted by the API, worker and controller binaries, whose metric definitions use them.
+// Dashboards and alert rules are built only from these names so they stay in sync with the code.
+const (
+	MetricHTTPRequestsTotal      = "http_requests_total"
+	MetricHTTPRequestDuration    = "http_request_duration_seconds"
+	MetricJobsCreatedTotal       = "jobs_created_total"
+	MetricWorkerJobsProcessed    = "worker_jobs_processed_total"
+	MetricWorkerJobDuration      = "worker_job_processing_duration_seconds"
+	MetricWorkerJobsActive       = "worker_jobs_active"
+	MetricQueueDepth             = "textprocessing_queue_depth"
+	MetricTypeQueueDepth         = "textprocessing_type_queue_depth"
+	MetricFailedQueueOldestAge   = "textprocessing_failed_queue_oldest_age_seconds"
+	MetricAutoscalingEventsTotal = "textprocessing_autoscaling_events_total"
+	MetricCapacityLimitedTotal   = "textprocessing_capacity_limited_scaleups_total"
+	MetricCurrentReplicas        = "textprocessing_current_replicas"
+	MetricRecommendedResources   = "textprocessing_recommended_resources"
+	MetricWorkerThroughput       = "textprocessing_worker_throughput_jobs_per_minute"
+)
+
+const (
+	defaultRateWindow             = "5m"
+	defaultQuantile               = "0.95"
+	defaultPrometheusDatasourceID = "prometheus"
+)
@@ -0,0 +1,103 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// Metrics pushed by each service when METRICS_PUSH_URL is set. They summarize the business state
+// of the system: the failure rate is derived from the status label of MetricWorkerJobsProcessed.
+//
+//nolint:gochecknoglobals // read-only lists
+var (
+	WorkerPushedMetrics     = []string{MetricWorkerJobsProcessed, MetricWorkerJobsActive}
+	ControllerPushedMetrics = []string{MetricQueueDepth, MetricTypeQueueDepth, MetricCurrentReplicas}
+)
+
+// pushTimeout bounds a single push, so a hanging Pushgateway does not pile up pushes.
+const pushTimeout = 10 * time.Second
+
+// Pusher periodically pushes a subset of the default registry to a Prometheus Pushgateway. Each
+// replica pushes to its own group, keyed by service and instance, which it deletes on shutdown so
+// the Pushgateway does not keep reporting replicas that are gone.
+type Pusher struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	log      *slog.Logger
+}
+
+// NewPusher creates a pusher of the named metrics of service. The instance label is the host name,
+// which is the pod name in Kubernetes.
+func NewPusher(cfg config.Metrics, service string, metrics []string, log *slog.Logger) (*Pusher, error) {
+	instance, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("resolve instance name: %w", err)
+	}
+
+	pusher := push.New(cfg.PushURL, cfg.PushJob).
+		Gatherer(filteredGatherer(prometheus.DefaultGatherer, metrics)).
+		Grouping("service", service).
+		Grouping("instance", instance).
+		Client(&http.Client{Timeout: pushTimeout})
+	if cfg.PushUsername != "" {
+		pusher = pusher.BasicAuth(cfg.PushUsername, cfg.PushPassword)
+	}
+	if cfg.PushToken != "" {
+		pusher = pusher.Header(http.Header{"Authorization": []string{"Bearer " + cfg.PushToken}})
+	}
+
+	return &Pusher{
+		pusher:   pusher,
+		interval: cfg.PushInterval,
+		log:      log.With("component", "metrics_pusher", "service", service, "instance", instance),
+	}, nil
+}
+
+// Start pushes the metrics every interval until ctx is done, then deletes the group.
+func (p *Pusher) Start(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.log.InfoContext(ctx, "starting metrics push", "interval", p.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.delete()
+			return
+		case <-ticker.C:
+			if err := p.pusher.PushContext(ctx); err != nil && ctx.Err() == nil {
+				p.log.WarnContext(ctx, "failed to push metrics", "error", err)
+			}
+		}
+	}
+}
+
+func (p *Pusher) delete() {
+	if err := p.pusher.Delete(); err != nil {
+		p.log.Warn("failed to delete pushed metrics", "error", err)
+		return
+	}
+	p.log.Info("deleted pushed metrics")
+}
+
+// filteredGatherer gathers the named metric families of gatherer only.
+func filteredGatherer(gatherer prometheus.Gatherer, names []string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := gatherer.Gather()
+		return slices.DeleteFunc(families, func(family *dto.MetricFamily) bool {
+			return !slices.Contains(names, family.GetName())
+		}), err
+	})
+}
@@ -0,0 +1,39 @@
+// Package charset looks up the text encodings transcode jobs convert between, by their IANA names
+// and aliases or, failing that, their WHATWG labels.
+package charset
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// ErrUnsupported is returned for encodings that are unknown or cannot be converted.
+var ErrUnsupported = errors.New("unsupported encoding")
+
+// Lookup returns the encoding of a name such as utf-8, utf-16le, iso-8859-1, windows-1252 or
+// shift_jis, case-insensitively.
+func Lookup(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	// IANA knows encodings it cannot convert, which it returns as nil
+	if enc, err := ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	if enc, err := htmlindex.Get(name); err == nil {
+		return enc, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, name)
+}
+
+// Same reports whether a and b are the same encoding by their IANA names, so that converting
+// between them would rewrite the text unchanged.
+func Same(a, b encoding.Encoding) bool {
+	aName, aErr := ianaindex.IANA.Name(a)
+	bName, bErr := ianaindex.IANA.Name(b)
+	return aErr == nil && bErr == nil && aName == bName
+}
@@ -0,0 +1,67 @@
+package schemas
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/rsav/k8s-learning/internal/processing/charset"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// checkConstraints checks what a schema cannot express: relations between parameters, regular
+// expressions and encodings given as parameters and the address of notify_email. It only runs on parameters that
+// match their schema.
+func checkConstraints(processingType database.ProcessingType, params map[string]any) []FieldError {
+	if _, err := database.NotifyEmailFrom(params); err != nil {
+		return []FieldError{{Field: database.NotifyEmailParam, Reason: "must be an email address"}}
+	}
+
+	switch processingType {
+	case database.ProcessingTypeChunk:
+		size := database.DefaultChunkSize
+		if raw, ok := params[database.ChunkSizeParam].(float64); ok {
+			size = int(raw)
+		}
+		if overlap, ok := params[database.ChunkOverlapParam].(float64); ok && int(overlap) >= size {
+			return []FieldError{{
+				Field:  database.ChunkOverlapParam,
+				Reason: fmt.Sprintf("must be smaller than %s (%d)", database.ChunkSizeParam, size),
+			}}
+		}
+	case database.ProcessingTypeExtract:
+		pattern, _ := params["pattern"].(string)
+		if _, err := regexp.Compile(pattern); err != nil {
+			return []FieldError{{Field: "pattern", Reason: fmt.Sprintf("is not a valid regular expression: %v", err)}}
+		}
+	case database.ProcessingTypeRedact, database.ProcessingTypePIIReport:
+		var errs []FieldError
+		patterns, _ := params[database.PIIPatternsParam].([]any)
+		for i, raw := range patterns {
+			pattern, _ := raw.(string)
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, FieldError{
+					Field:  fmt.Sprintf("%s/%d", database.PIIPatternsParam, i),
+					Reason: fmt.Sprintf("is not a valid regular expression: %v", err),
+				})
+			}
+		}
+		if detect, ok := params[database.PIIDetectParam].([]any); ok && len(detect) == 0 && len(patterns) == 0 {
+			errs = append(errs, FieldError{
+				Field:  database.PIIDetectParam,
+				Reason: fmt.Sprintf("cannot be empty without %s", database.PIIPatternsParam),
+			})
+		}
+		return errs
+	case database.ProcessingTypeTranscode:
+		var errs []FieldError
+		for _, param := range []string{database.TranscodeFromParam, database.TranscodeToParam} {
+			if name, ok := params[param].(string); ok {
+				if _, err := charset.Lookup(name); err != nil {
+					errs = append(errs, FieldError{Field: param, Reason: "is not a supported encoding"})
+				}
+			}
+		}
+		return errs
+	}
+	return nil
+}
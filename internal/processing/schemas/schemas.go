@@ -0,0 +1,275 @@
+// Package schemas validates job parameters against the JSON Schema of their processing type. The
+// schemas are the <type>.json files of this package; plugin types share plugin.json. Only the
+// keywords the schemas need are supported, and a schema using any other fails at startup:
+// type, properties, required, enum, minimum, maximum, minLength, maxLength, pattern, items and
+// maxItems. Parameters a schema does not describe are allowed.
+package schemas
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+//go:embed *.json
+var files embed.FS
+
+// pluginSchema validates the parameters of every plugin processing type.
+const pluginSchema = "plugin"
+
+// FieldError is a parameter that failed validation. Field is the parameter name, followed by the
+// index for array elements, e.g. "args/2"; it is empty for errors about the parameters as a whole.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError lists every parameter of a job that failed validation.
+type ValidationError struct {
+	ProcessingType database.ProcessingType
+	Errors         []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		reasons[i] = fieldErr.Reason
+		if fieldErr.Field != "" {
+			reasons[i] = fmt.Sprintf("'%s' %s", fieldErr.Field, fieldErr.Reason)
+		}
+	}
+	return fmt.Sprintf("invalid %s parameters: %s", e.ProcessingType, strings.Join(reasons, "; "))
+}
+
+// schema is a JSON Schema restricted to the supported keywords.
+type schema struct {
+	SchemaURI   string             `json:"$schema"`
+	ID          string             `json:"$id"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Type        string             `json:"type"`
+	Properties  map[string]*schema `json:"properties"`
+	Required    []string           `json:"required"`
+	Enum        []any              `json:"enum"`
+	Minimum     *float64           `json:"minimum"`
+	Maximum     *float64           `json:"maximum"`
+	MinLength   *int               `json:"minLength"`
+	MaxLength   *int               `json:"maxLength"`
+	Pattern     string             `json:"pattern"`
+	Items       *schema            `json:"items"`
+	MaxItems    *int               `json:"maxItems"`
+
+	pattern *regexp.Regexp
+}
+
+// registry holds the schemas by file name without extension.
+var registry = mustLoad()
+
+func mustLoad() map[string]*schema {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		panic(fmt.Sprintf("read parameter schemas: %v", err))
+	}
+
+	loaded := make(map[string]*schema, len(entries))
+	for _, entry := range entries {
+		data, err := files.ReadFile(entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("read parameter schema %s: %v", entry.Name(), err))
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+
+		var s schema
+		if err := decoder.Decode(&s); err != nil {
+			panic(fmt.Sprintf("parse parameter schema %s: %v", entry.Name(), err))
+		}
+		if err := s.compile(); err != nil {
+			panic(fmt.Sprintf("compile parameter schema %s: %v", entry.Name(), err))
+		}
+
+		loaded[strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))] = &s
+	}
+	return loaded
+}
+
+func (s *schema) compile() error {
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = pattern
+	}
+
+	for name, property := range s.Properties {
+		if err := property.compile(); err != nil {
+			return fmt.Errorf("property %s: %w", name, err)
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// Validate checks job parameters against the schema of the processing type and returns a
+// *ValidationError listing every parameter that failed.
+func Validate(processingType database.ProcessingType, params map[string]any) error {
+	name := string(processingType)
+	if _, isPlugin := processingType.PluginName(); isPlugin {
+		name = pluginSchema
+	}
+
+	s, ok := registry[name]
+	if !ok {
+		return &ValidationError{
+			ProcessingType: processingType,
+			Errors:         []FieldError{{Reason: "unsupported processing type"}},
+		}
+	}
+
+	if params == nil {
+		params = map[string]any{}
+	}
+
+	var fieldErrors []FieldError
+	s.validate("", params, &fieldErrors)
+	if len(fieldErrors) == 0 {
+		fieldErrors = checkConstraints(processingType, params)
+	}
+	if len(fieldErrors) > 0 {
+		return &ValidationError{ProcessingType: processingType, Errors: fieldErrors}
+	}
+	return nil
+}
+
+func (s *schema) validate(field string, value any, fieldErrors *[]FieldError) {
+	fail := func(format string, args ...any) {
+		*fieldErrors = append(*fieldErrors, FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if s.Type != "" && !hasType(value, s.Type) {
+		fail("must be %s", article(s.Type))
+		return
+	}
+
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, value) {
+		fail("must be one of: %s", joinValues(s.Enum))
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			if *s.MinLength == 1 {
+				fail("must not be empty")
+			} else {
+				fail("must be at least %d characters long", *s.MinLength)
+			}
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %s", s.Pattern)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("must be at least %g", *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("must be at most %g", *s.Maximum)
+		}
+	case []any:
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s/%d", field, i), item, fieldErrors)
+			}
+		}
+	case map[string]any:
+		s.validateObject(field, v, fieldErrors)
+	}
+}
+
+func (s *schema) validateObject(field string, object map[string]any, fieldErrors *[]FieldError) {
+	child := func(name string) string {
+		if field == "" {
+			return name
+		}
+		return field + "/" + name
+	}
+
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			*fieldErrors = append(*fieldErrors, FieldError{Field: child(name), Reason: "is required"})
+		}
+	}
+
+	// Sorted so that errors come in a stable order
+	for _, name := range slices.Sorted(maps.Keys(object)) {
+		if property, ok := s.Properties[name]; ok {
+			property.validate(child(name), object[name], fieldErrors)
+		}
+	}
+}
+
+// hasType reports whether a value decoded from JSON has the JSON Schema type.
+func hasType(value any, schemaType string) bool {
+	switch schemaType {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		number, ok := value.(float64)
+		return ok && number == float64(int64(number))
+	case "null":
+		return value == nil
+	default:
+		return false
+	}
+}
+
+func article(schemaType string) string {
+	switch schemaType {
+	case "object", "array", "integer":
+		return "an " + schemaType
+	case "null":
+		return "null"
+	default:
+		return "a " + schemaType
+	}
+}
+
+func joinValues(values []any) string {
+	names := make([]string, len(values))
+	for i, value := range values {
+		names[i] = fmt.Sprint(value)
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,60 @@
+package reconcile
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+)
+
+var (
+	orphanedFilesGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "file_reconcile_orphaned_files",
+			Help: "Stored files no job references, as of the last reconciliation",
+		},
+		[]string{"kind"},
+	)
+
+	orphanedBytesGauge = telemetry.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "file_reconcile_orphaned_bytes",
+			Help: "Bytes of the stored files no job references, as of the last reconciliation",
+		},
+	)
+
+	missingFilesGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "file_reconcile_missing_files",
+			Help: "Files referenced by jobs that are not stored, as of the last reconciliation",
+		},
+		[]string{"kind"},
+	)
+
+	orphansDeletedTotal = telemetry.NewCounter(
+		prometheus.CounterOpts{
+			Name: "file_reconcile_orphans_deleted_total",
+			Help: "Total number of orphaned files deleted by the reconciliation",
+		},
+	)
+
+	lastSuccessGauge = telemetry.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "file_reconcile_last_success_timestamp_seconds",
+			Help: "Unix time the last successful file reconciliation completed",
+		},
+	)
+)
+
+// recordReportMetrics publishes the counts of a completed reconciliation. Failed reconciliations
+// leave the gauges of the last successful one.
+func recordReportMetrics(report *Report) {
+	if report.Error != "" {
+		return
+	}
+
+	orphanedFilesGauge.WithLabelValues(KindUpload).Set(float64(report.OrphanedFiles.Uploads))
+	orphanedFilesGauge.WithLabelValues(KindResult).Set(float64(report.OrphanedFiles.Results))
+	orphanedBytesGauge.Set(float64(report.OrphanedBytes))
+	missingFilesGauge.WithLabelValues(KindUpload).Set(float64(report.MissingFiles.Uploads))
+	missingFilesGauge.WithLabelValues(KindResult).Set(float64(report.MissingFiles.Results))
+	lastSuccessGauge.Set(float64(report.CompletedAt.Unix()))
+}
@@ -0,0 +1,337 @@
+// Package reconcile compares the stored upload and result files with the jobs referencing them.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
+)
+
+const (
+	// jobPageSize is how many jobs are checked for missing files per query.
+	jobPageSize = 1000
+	// reportLimit bounds the orphaned and missing files listed in a report; counts are exact.
+	reportLimit = 1000
+)
+
+// ErrInProgress is returned by Reconcile while another reconciliation runs.
+var ErrInProgress = errors.New("file reconciliation already in progress")
+
+type (
+	// Repository resolves the files referenced by jobs.
+	Repository interface {
+		ReferencedFiles(ctx context.Context, paths []string) (map[string]bool, error)
+		ExportJobs(ctx context.Context, filter database.ExportFilter) ([]*database.Job, error)
+	}
+
+	// Files lists and removes the stored files.
+	Files interface {
+		ListStoredFiles() ([]filestore.StoredFile, error)
+		DeleteFile(filePath string) error
+	}
+
+	// Config sets the files considered. Files and jobs younger than MinAge may be in the middle of
+	// being created and are skipped. Jobs created longer than the file retention ago have had their
+	// files removed on purpose and are not checked. Stored files whose name starts with one of
+	// IgnorePrefixes are not referenced by jobs by design.
+	Config struct {
+		MinAge         time.Duration
+		DeleteOrphans  bool
+		Retention      func() time.Duration
+		IgnorePrefixes []string
+	}
+)
+
+type (
+	// Report is the outcome of a reconciliation. Orphans and Missing list up to 1000 files each,
+	// with Truncated set when there were more.
+	Report struct {
+		StartedAt     time.Time     `json:"started_at"`
+		CompletedAt   time.Time     `json:"completed_at"`
+		DeleteOrphans bool          `json:"delete_orphans"`
+		ScannedFiles  int           `json:"scanned_files"`
+		ScannedJobs   int           `json:"scanned_jobs"`
+		OrphanedFiles FileCounts    `json:"orphaned_files"`
+		OrphanedBytes int64         `json:"orphaned_bytes"`
+		DeletedFiles  int           `json:"deleted_files"`
+		MissingFiles  FileCounts    `json:"missing_files"`
+		Orphans       []OrphanFile  `json:"orphans"`
+		Missing       []MissingFile `json:"missing"`
+		Truncated     bool          `json:"truncated"`
+		Error         string        `json:"error,omitempty"`
+	}
+
+	// FileCounts counts files by kind.
+	FileCounts struct {
+		Uploads int `json:"uploads"`
+		Results int `json:"results"`
+	}
+
+	// OrphanFile is a stored file no job references.
+	OrphanFile struct {
+		Path    string    `json:"path"`
+		Kind    string    `json:"kind"`
+		Size    int64     `json:"size"`
+		ModTime time.Time `json:"mod_time"`
+		Deleted bool      `json:"deleted"`
+	}
+
+	// MissingFile is a file a job references that is not stored.
+	MissingFile struct {
+		JobID    uuid.UUID          `json:"job_id"`
+		TenantID string             `json:"tenant_id"`
+		Status   database.JobStatus `json:"status"`
+		Kind     string             `json:"kind"`
+		Path     string             `json:"path"`
+	}
+)
+
+// Kinds of files, also used as metric labels.
+const (
+	KindUpload = "upload"
+	KindResult = "result"
+)
+
+type Reconciler struct {
+	repo   Repository
+	files  Files
+	config Config
+	log    *slog.Logger
+
+	running sync.Mutex
+	mu      sync.Mutex
+	last    *Report
+}
+
+func New(repo Repository, files Files, cfg Config, log *slog.Logger) *Reconciler {
+	return &Reconciler{
+		repo:   repo,
+		files:  files,
+		config: cfg,
+		log:    log,
+	}
+}
+
+// LastReport returns the report of the last reconciliation, or nil before the first one.
+func (r *Reconciler) LastReport() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// Reconcile reports the stored files no job references, deleting them when deleteOrphans is set,
+// and the files referenced by jobs that are not stored. Only one reconciliation runs at a time;
+// others fail with ErrInProgress. A reconciliation that fails part way returns the partial report
+// along with the error.
+func (r *Reconciler) Reconcile(ctx context.Context, deleteOrphans bool) (*Report, error) {
+	if !r.running.TryLock() {
+		return nil, ErrInProgress
+	}
+	defer r.running.Unlock()
+
+	report := &Report{
+		StartedAt:     time.Now().UTC(),
+		DeleteOrphans: deleteOrphans,
+		Orphans:       []OrphanFile{},
+		Missing:       []MissingFile{},
+	}
+
+	err := r.reconcile(ctx, report)
+	report.CompletedAt = time.Now().UTC()
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	recordReportMetrics(report)
+	r.mu.Lock()
+	r.last = report
+	r.mu.Unlock()
+
+	return report, err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, report *Report) error {
+	files, err := r.files.ListStoredFiles()
+	if err != nil {
+		return fmt.Errorf("list stored files: %w", err)
+	}
+	report.ScannedFiles = len(files)
+
+	stored := make(map[string]bool, len(files))
+	for _, file := range files {
+		stored[file.Path] = true
+	}
+
+	if err := r.findOrphans(ctx, files, report); err != nil {
+		return err
+	}
+
+	return r.findMissing(ctx, stored, report)
+}
+
+// findOrphans reports, and with DeleteOrphans removes, the files older than MinAge no job references.
+func (r *Reconciler) findOrphans(ctx context.Context, files []filestore.StoredFile, report *Report) error {
+	cutoff := report.StartedAt.Add(-r.config.MinAge)
+
+	candidates := make([]filestore.StoredFile, 0, len(files))
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.ModTime.After(cutoff) || r.ignored(file.Path) {
+			continue
+		}
+		candidates = append(candidates, file)
+		paths = append(paths, file.Path)
+	}
+
+	referenced, err := r.repo.ReferencedFiles(ctx, paths)
+	if err != nil {
+		return fmt.Errorf("resolve referenced files: %w", err)
+	}
+
+	for _, file := range candidates {
+		if referenced[file.Path] {
+			continue
+		}
+
+		orphan := OrphanFile{Path: file.Path, Kind: KindResult, Size: file.Size, ModTime: file.ModTime}
+		if file.Upload {
+			orphan.Kind = KindUpload
+		}
+
+		if report.DeleteOrphans {
+			// Orphans were never counted against a tenant's storage, so there is no usage to release
+			if err := r.files.DeleteFile(file.Path); err != nil {
+				r.log.ErrorContext(ctx, "failed to delete orphaned file", "error", err, "path", file.Path)
+			} else {
+				orphan.Deleted = true
+				report.DeletedFiles++
+				orphansDeletedTotal.Inc()
+			}
+		}
+
+		report.OrphanedFiles.add(orphan.Kind)
+		report.OrphanedBytes += file.Size
+		if len(report.Orphans) < reportLimit {
+			report.Orphans = append(report.Orphans, orphan)
+		} else {
+			report.Truncated = true
+		}
+	}
+
+	return nil
+}
+
+// findMissing reports the files of the jobs created within the file retention, and longer than
+// MinAge ago, that are not among the stored files.
+func (r *Reconciler) findMissing(ctx context.Context, stored map[string]bool, report *Report) error {
+	filter := database.ExportFilter{
+		To:    report.StartedAt.Add(-r.config.MinAge),
+		Limit: jobPageSize,
+	}
+	if retention := r.config.Retention(); retention > 0 {
+		filter.From = report.StartedAt.Add(-retention)
+	}
+
+	for {
+		jobs, err := r.repo.ExportJobs(ctx, filter)
+		if err != nil {
+			return fmt.Errorf("list jobs: %w", err)
+		}
+
+		for _, job := range jobs {
+			report.ScannedJobs++
+			r.checkFile(job, job.FilePath, KindUpload, stored, report)
+			r.checkFile(job, job.SecondFilePath, KindUpload, stored, report)
+			r.checkFile(job, job.ResultPath, KindResult, stored, report)
+		}
+
+		if len(jobs) < jobPageSize {
+			return nil
+		}
+		last := jobs[len(jobs)-1]
+		filter.After, filter.AfterID = last.CreatedAt, last.ID
+	}
+}
+
+func (r *Reconciler) checkFile(job *database.Job, path, kind string, stored map[string]bool, report *Report) {
+	if path == "" || stored[path] {
+		return
+	}
+
+	report.MissingFiles.add(kind)
+	if len(report.Missing) < reportLimit {
+		report.Missing = append(report.Missing, MissingFile{
+			JobID:    job.ID,
+			TenantID: job.TenantID,
+			Status:   job.Status,
+			Kind:     kind,
+			Path:     path,
+		})
+	} else {
+		report.Truncated = true
+	}
+}
+
+func (c *FileCounts) add(kind string) {
+	if kind == KindUpload {
+		c.Uploads++
+	} else {
+		c.Results++
+	}
+}
+
+// Total is the number of files of every kind.
+func (c FileCounts) Total() int {
+	return c.Uploads + c.Results
+}
+
+func (r *Reconciler) ignored(path string) bool {
+	name := filepath.Base(path)
+	for _, prefix := range r.config.IgnorePrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run reconciles every interval until ctx is cancelled, deleting orphans as configured.
+func (r *Reconciler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := r.Reconcile(ctx, r.config.DeleteOrphans)
+		switch {
+		case errors.Is(err, ErrInProgress):
+			continue
+		case err != nil:
+			r.log.ErrorContext(ctx, "failed to reconcile stored files", "error", err)
+			continue
+		}
+
+		if report.OrphanedFiles.Total() > 0 || report.MissingFiles.Total() > 0 {
+			r.log.WarnContext(ctx, "stored files out of sync with jobs",
+				"orphaned_files", report.OrphanedFiles.Total(),
+				"orphaned_bytes", report.OrphanedBytes,
+				"deleted_files", report.DeletedFiles,
+				"missing_files", report.MissingFiles.Total(),
+			)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Package runtimestats reports the resources held by the running process: goroutines, memory,
+// OS threads and open file descriptors. Every service serves them at /debug/runtime, where the
+// stress test's soak mode samples them for hours to spot leaks.
+package runtimestats
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// Snapshot is the resource usage of the process at one point in time.
+type Snapshot struct {
+	At         time.Time `json:"at"`
+	Goroutines int       `json:"goroutines"`
+	// Threads is the number of OS threads the runtime has created.
+	Threads        int    `json:"threads"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	HeapObjects    uint64 `json:"heap_objects"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+	// OpenFDs is the number of open file descriptors, -1 where /proc is not available.
+	OpenFDs int `json:"open_fds"`
+}
+
+// Collect takes a snapshot of the process. Reading the memory statistics briefly stops the world,
+// so it is meant for sampling every few seconds at most.
+func Collect() Snapshot {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return Snapshot{
+		At:             time.Now().UTC(),
+		Goroutines:     runtime.NumGoroutine(),
+		Threads:        pprof.Lookup("threadcreate").Count(),
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapInuseBytes: mem.HeapInuse,
+		HeapObjects:    mem.HeapObjects,
+		SysBytes:       mem.Sys,
+		NumGC:          mem.NumGC,
+		OpenFDs:        openFDs(),
+	}
+}
+
+// openFDs counts the entries of /proc/self/fd, which includes the descriptor reading it.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries) - 1
+}
+
+// Handler serves a snapshot of the process as JSON.
+func Handler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(Collect())
+}
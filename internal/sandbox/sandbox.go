@@ -0,0 +1,39 @@
+// Package sandbox runs operator-allowed commands on untrusted input with CPU and memory
+// limits and, where the kernel allows it, without network access.
+//
+// Limits are applied by re-executing the current binary, which sets rlimits and then execs the
+// target command. Binaries that use Command must call RunChildIfRequested first thing in main.
+package sandbox
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// childArg marks a re-executed process as the sandbox launcher.
+const childArg = "__sandbox_exec"
+
+// exitSetupFailed is returned by the launcher when the target command could not be started,
+// matching the shell convention for "command found but not executable".
+const exitSetupFailed = 126
+
+var ErrUnsupported = errors.New("sandboxed execution is only supported on linux")
+
+// Limits bound a sandboxed command. CPU is rounded down to whole seconds.
+type Limits struct {
+	CPU    time.Duration
+	Memory int64
+	// IsolateNetwork runs the command in new user and network namespaces with no interfaces
+	// other than loopback.
+	IsolateNetwork bool
+}
+
+// RunChildIfRequested applies limits and execs the target command when the process was started
+// by Command. It never returns in that case; otherwise it does nothing.
+func RunChildIfRequested() {
+	if len(os.Args) < 2 || os.Args[1] != childArg {
+		return
+	}
+	os.Exit(runChild(os.Args[2:]))
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// sandboxEnv is the whole environment of sandboxed commands; nothing is inherited from the worker.
+//
+//nolint:gochecknoglobals // constant environment for child processes
+var sandboxEnv = []string{"PATH=/usr/local/bin:/usr/bin:/bin", "LANG=C.UTF-8", "HOME=/nonexistent"}
+
+// Command prepares path to run with args under limits. The process group is killed when ctx is done.
+func Command(ctx context.Context, limits Limits, path string, args ...string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("resolve own executable: %w", err)
+	}
+
+	childArgs := append([]string{
+		childArg,
+		strconv.FormatInt(limits.Memory, 10),
+		strconv.FormatInt(int64(limits.CPU/time.Second), 10),
+		path,
+	}, args...)
+
+	cmd := exec.CommandContext(ctx, self, childArgs...)
+	cmd.Env = sandboxEnv
+	cmd.Dir = "/"
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+	if limits.IsolateNetwork {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+
+	return cmd, nil
+}
+
+func runChild(args []string) int {
+	if len(args) < 3 { //nolint:mnd // memory, cpu and command path
+		fmt.Fprintln(os.Stderr, "sandbox: missing launcher arguments")
+		return exitSetupFailed
+	}
+
+	memory, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: invalid memory limit: %v\n", err)
+		return exitSetupFailed
+	}
+	cpu, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: invalid cpu limit: %v\n", err)
+		return exitSetupFailed
+	}
+
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_AS, memory},
+		{syscall.RLIMIT_CPU, cpu},
+		{syscall.RLIMIT_CORE, 0},
+	}
+	for _, l := range limits {
+		if err := syscall.Setrlimit(l.resource, &syscall.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			fmt.Fprintf(os.Stderr, "sandbox: set rlimit %d: %v\n", l.resource, err)
+			return exitSetupFailed
+		}
+	}
+
+	// #nosec G204 -- path was resolved from the operator allowlist by the parent
+	if err := syscall.Exec(args[2], args[2:], sandboxEnv); err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: exec %s: %v\n", args[2], err)
+	}
+	return exitSetupFailed
+}
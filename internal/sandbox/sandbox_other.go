@@ -0,0 +1,17 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"os/exec"
+)
+
+// Command is not available outside linux, which provides the rlimits and namespaces it relies on.
+func Command(_ context.Context, _ Limits, _ string, _ ...string) (*exec.Cmd, error) {
+	return nil, ErrUnsupported
+}
+
+func runChild(_ []string) int {
+	return exitSetupFailed
+}
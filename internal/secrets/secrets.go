@@ -0,0 +1,91 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReadFile returns the secret stored in path with surrounding whitespace removed,
+// so files written by Kubernetes Secrets or a Vault agent template can be used as is.
+func ReadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("read secret file: %w", err)
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "" {
+		return "", fmt.Errorf("secret file %s is empty", path)
+	}
+
+	return value, nil
+}
+
+// WatchFile calls onChange with the new secret whenever the file at path is rotated.
+// The parent directory is watched because Secret volumes and Vault agent replace files
+// atomically. An empty path is a no-op. Unreadable updates are logged and skipped.
+func WatchFile(ctx context.Context, path string, log *slog.Logger, onChange func(string)) error {
+	if path == "" {
+		return nil
+	}
+
+	current, err := ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("create file watcher: %w", err)
+	}
+
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("watch secret directory: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Has(fsnotify.Chmod) {
+					continue
+				}
+
+				next, err := ReadFile(path)
+				if err != nil {
+					log.ErrorContext(ctx, "failed to re-read rotated secret, keeping previous value",
+						"path", path, "error", err)
+					continue
+				}
+				if next == current {
+					continue
+				}
+
+				current = next
+				log.InfoContext(ctx, "secret rotated", "path", path)
+				onChange(next)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.ErrorContext(ctx, "secret watcher error", "path", path, "error", err)
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package slo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AvailabilityCounter counts good and total requests in per-minute buckets so
+// availability can be evaluated over rolling windows without an external store.
+type AvailabilityCounter struct {
+	mu      sync.Mutex
+	buckets []availabilityBucket
+}
+
+type availabilityBucket struct {
+	minute int64
+	good   int64
+	total  int64
+}
+
+func NewAvailabilityCounter(retention time.Duration) *AvailabilityCounter {
+	size := int(retention/time.Minute) + 1
+	return &AvailabilityCounter{
+		buckets: make([]availabilityBucket, size),
+	}
+}
+
+// Record registers a request outcome.
+func (c *AvailabilityCounter) Record(success bool) {
+	minute := time.Now().Unix() / int64(time.Minute/time.Second)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bucket := &c.buckets[minute%int64(len(c.buckets))]
+	if bucket.minute != minute {
+		*bucket = availabilityBucket{minute: minute}
+	}
+
+	bucket.total++
+	if success {
+		bucket.good++
+	}
+}
+
+// Source returns an SLO source reading from the counter.
+func (c *AvailabilityCounter) Source() Source {
+	return func(_ context.Context, since time.Time) (int64, int64, error) {
+		fromMinute := since.Unix() / int64(time.Minute/time.Second)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		var good, total int64
+		for _, bucket := range c.buckets {
+			if bucket.total > 0 && bucket.minute >= fromMinute {
+				good += bucket.good
+				total += bucket.total
+			}
+		}
+
+		return good, total, nil
+	}
+}
@@ -0,0 +1,38 @@
+package slo
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+)
+
+var (
+	complianceGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "slo_compliance_ratio",
+			Help: "Ratio of good events to total events for the SLO window",
+		},
+		[]string{"objective", "window"},
+	)
+
+	burnRateGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "slo_error_budget_burn_rate",
+			Help: "Rate at which the SLO error budget is consumed (1 = exhausted at window end)",
+		},
+		[]string{"objective", "window"},
+	)
+
+	budgetRemainingGauge = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "slo_error_budget_remaining_ratio",
+			Help: "Fraction of the SLO error budget remaining in the window",
+		},
+		[]string{"objective", "window"},
+	)
+)
+
+func recordWindowMetrics(objective string, report WindowReport) {
+	complianceGauge.WithLabelValues(objective, report.Window).Set(report.Compliance)
+	burnRateGauge.WithLabelValues(objective, report.Window).Set(report.BurnRate)
+	budgetRemainingGauge.WithLabelValues(objective, report.Window).Set(report.ErrorBudgetRemaining)
+}
@@ -0,0 +1,129 @@
+package slo
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type (
+	// Source reports the number of good and total events observed since the given time.
+	Source func(ctx context.Context, since time.Time) (good, total int64, err error)
+
+	// Objective is a service level objective evaluated over one or more rolling windows.
+	Objective struct {
+		Name        string
+		Description string
+		Target      float64
+		Source      Source
+	}
+
+	// Report summarizes compliance for all objectives.
+	Report struct {
+		EvaluatedAt time.Time         `json:"evaluated_at"`
+		Objectives  []ObjectiveReport `json:"objectives"`
+	}
+
+	ObjectiveReport struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Target      float64        `json:"target"`
+		Windows     []WindowReport `json:"windows"`
+	}
+
+	// WindowReport holds the SLI and burn rate for a single rolling window.
+	// BurnRate is the rate the error budget is being consumed: 1 means the budget
+	// would be exactly exhausted at the end of the window.
+	WindowReport struct {
+		Window               string  `json:"window"`
+		GoodEvents           int64   `json:"good_events"`
+		TotalEvents          int64   `json:"total_events"`
+		Compliance           float64 `json:"compliance"`
+		BurnRate             float64 `json:"burn_rate"`
+		ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+		Error                string  `json:"error,omitempty"`
+	}
+)
+
+type Tracker struct {
+	objectives []Objective
+	windows    []time.Duration
+	log        *slog.Logger
+}
+
+func NewTracker(objectives []Objective, windows []time.Duration, log *slog.Logger) *Tracker {
+	return &Tracker{
+		objectives: objectives,
+		windows:    windows,
+		log:        log,
+	}
+}
+
+// Evaluate computes compliance and burn rates for every objective and window.
+// Source errors are reported per window rather than failing the whole report.
+func (t *Tracker) Evaluate(ctx context.Context) Report {
+	now := time.Now()
+	report := Report{
+		EvaluatedAt: now,
+		Objectives:  make([]ObjectiveReport, 0, len(t.objectives)),
+	}
+
+	for _, objective := range t.objectives {
+		objReport := ObjectiveReport{
+			Name:        objective.Name,
+			Description: objective.Description,
+			Target:      objective.Target,
+			Windows:     make([]WindowReport, 0, len(t.windows)),
+		}
+
+		for _, window := range t.windows {
+			windowReport := WindowReport{Window: window.String(), Compliance: 1, ErrorBudgetRemaining: 1}
+
+			good, total, err := objective.Source(ctx, now.Add(-window))
+			if err != nil {
+				t.log.ErrorContext(ctx, "failed to evaluate SLO window", "objective", objective.Name, "window", window, "error", err)
+				windowReport.Error = fmt.Sprintf("evaluate window: %v", err)
+				objReport.Windows = append(objReport.Windows, windowReport)
+				continue
+			}
+
+			windowReport.GoodEvents = good
+			windowReport.TotalEvents = total
+			if total > 0 {
+				windowReport.Compliance = float64(good) / float64(total)
+			}
+
+			budget := 1 - objective.Target
+			if budget > 0 {
+				windowReport.BurnRate = (1 - windowReport.Compliance) / budget
+				windowReport.ErrorBudgetRemaining = 1 - windowReport.BurnRate
+			}
+
+			recordWindowMetrics(objective.Name, windowReport)
+			objReport.Windows = append(objReport.Windows, windowReport)
+		}
+
+		report.Objectives = append(report.Objectives, objReport)
+	}
+
+	return report
+}
+
+// StartPeriodicEvaluation refreshes the SLO gauges on a fixed interval until ctx is cancelled.
+func (t *Tracker) StartPeriodicEvaluation(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	t.log.InfoContext(ctx, "starting periodic SLO evaluation", "interval", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.log.InfoContext(ctx, "stopping SLO evaluation")
+			return
+		case <-ticker.C:
+			t.Evaluate(ctx)
+		}
+	}
+}
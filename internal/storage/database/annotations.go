@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+//nolint:gochecknoglobals // labelKeyPattern is compiled once
+var labelKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_./-]{0,62}$`)
+
+// ValidLabelKey reports whether key can name a job label: lowercase letters, digits and _ . / -,
+// at most 63 characters.
+func ValidLabelKey(key string) bool {
+	return labelKeyPattern.MatchString(key)
+}
+
+// ErrJobModified is returned by AnnotateJob when the annotations of the job changed since the
+// revision the update was based on.
+var ErrJobModified = errors.New("job was modified")
+
+// JobAnnotations changes the annotations of a job. Nil Notes keep the notes and an empty one
+// clears them; SetLabels are added or replaced and RemoveLabels removed, leaving the other labels.
+type JobAnnotations struct {
+	Notes        *string
+	SetLabels    map[string]string
+	RemoveLabels []string
+}
+
+// AnnotateJob applies the annotations to the job if it is still at revision, and returns the job
+// at its new revision. A job at another revision is left unchanged with ErrJobModified.
+func (r *Repository) AnnotateJob(ctx context.Context, id uuid.UUID, revision int, annotations JobAnnotations) (*Job, error) {
+	setLabels := annotations.SetLabels
+	if setLabels == nil {
+		setLabels = map[string]string{}
+	}
+	labels, err := json.Marshal(setLabels)
+	if err != nil {
+		return nil, fmt.Errorf("marshal labels: %w", err)
+	}
+	removeLabels := annotations.RemoveLabels
+	if removeLabels == nil {
+		removeLabels = []string{}
+	}
+
+	query := psql.Update("jobs").
+		Set("labels", squirrel.Expr("(labels || ?::jsonb) - ?::text[]", string(labels), removeLabels)).
+		Set("revision", squirrel.Expr("revision + 1")).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(byJobID(id)).
+		Where(squirrel.Eq{"revision": revision}).
+		Suffix("RETURNING " + strings.Join(jobSelectColumns, ", "))
+	if annotations.Notes != nil {
+		query = query.Set("notes", nullIfEmpty(*annotations.Notes))
+	}
+
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var job Job
+	err = r.db.GetContext(ctx, &job, sqlQuery, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either the job does not exist or its revision moved on
+		current, getErr := r.GetJobByID(ctx, id)
+		if getErr != nil {
+			return nil, getErr
+		}
+		return nil, fmt.Errorf("annotate job %s at revision %d, now %d: %w", id, revision, current.Revision, ErrJobModified)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("annotate job: %w", err)
+	}
+
+	return &job, nil
+}
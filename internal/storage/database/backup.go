@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// BackupTables are the tables holding the state of the service, in the order they are restored.
+//
+//nolint:gochecknoglobals // BackupTables is a read-only list
+var BackupTables = []string{"jobs", "job_results", "storage_usage"}
+
+// DumpTables passes every row of BackupTables, as a JSON object, to write. The rows are read in a
+// single read-only snapshot, so they are consistent with each other whatever the services do in the
+// meantime. It returns the schema version the rows belong to.
+func (r *Repository) DumpTables(ctx context.Context, write func(table string, row []byte) error) (int64, error) {
+	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return 0, fmt.Errorf("begin snapshot: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var version int64
+	if err := tx.GetContext(ctx, &version, "SELECT version FROM schema_migrations LIMIT 1"); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+
+	for _, table := range BackupTables {
+		if err := dumpTable(ctx, tx, table, write); err != nil {
+			return 0, err
+		}
+	}
+
+	return version, nil
+}
+
+func dumpTable(ctx context.Context, tx *sqlx.Tx, table string, write func(table string, row []byte) error) error {
+	// #nosec G202 -- table is one of BackupTables
+	rows, err := tx.QueryContext(ctx, "SELECT row_to_json(t)::text FROM "+table+" t")
+	if err != nil {
+		return fmt.Errorf("dump %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return fmt.Errorf("scan %s row: %w", table, err)
+		}
+		if err := write(table, row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("dump %s: %w", table, err)
+	}
+	return nil
+}
+
+// RestoreTables inserts the rows produced by rows, as dumped by DumpTables, in a single
+// transaction. The database must be at the schema version of the dump and, unless replace is set,
+// hold no rows in BackupTables; with replace, the existing rows are deleted first.
+func (r *Repository) RestoreTables(
+	ctx context.Context, version int64, replace bool, rows func(insert func(table string, row []byte) error) error,
+) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin restore: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current int64
+	if err := tx.GetContext(ctx, &current, "SELECT version FROM schema_migrations LIMIT 1"); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current != version {
+		return fmt.Errorf("backup is of schema version %d, the database is at version %d", version, current)
+	}
+
+	for _, table := range BackupTables {
+		if replace {
+			// #nosec G202 -- table is one of BackupTables
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+				return fmt.Errorf("clear %s: %w", table, err)
+			}
+			continue
+		}
+
+		var exists bool
+		// #nosec G202 -- table is one of BackupTables
+		if err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM "+table+")"); err != nil {
+			return fmt.Errorf("check %s: %w", table, err)
+		}
+		if exists {
+			return fmt.Errorf("table %s is not empty", table)
+		}
+	}
+
+	insert := func(table string, row []byte) error {
+		if !slices.Contains(BackupTables, table) {
+			return fmt.Errorf("unknown table: %s", table)
+		}
+		// #nosec G202 -- table is one of BackupTables
+		query := "INSERT INTO " + table + " SELECT * FROM json_populate_record(NULL::" + table + ", $1::json)"
+		if _, err := tx.ExecContext(ctx, query, string(row)); err != nil {
+			return fmt.Errorf("restore %s row: %w", table, err)
+		}
+		return nil
+	}
+	if err := rows(insert); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit restore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// BandwidthUsage is the request and response body bytes of a tenant on an API route during a day (UTC).
+type BandwidthUsage struct {
+	Day      time.Time
+	TenantID string
+	Route    string
+	Requests int64
+	BytesIn  int64
+	BytesOut int64
+}
+
+// BandwidthTotals aggregates bandwidth usage for a tenant, route and, unless grouping is none, a
+// period starting at PeriodStart (UTC). Bandwidth is kept per day, so hourly reports are by day.
+type BandwidthTotals struct {
+	TenantID    string     `json:"tenant_id" db:"tenant_id"`
+	Route       string     `json:"route" db:"route"`
+	PeriodStart *time.Time `json:"period_start,omitempty" db:"period_start"`
+	Requests    int64      `json:"requests" db:"requests"`
+	BytesIn     int64      `json:"bytes_in" db:"bytes_in"`
+	BytesOut    int64      `json:"bytes_out" db:"bytes_out"`
+}
+
+// AddBandwidthUsage adds the usage to the daily totals, in a single statement. Every entry must be
+// of a different day, tenant and route.
+func (r *Repository) AddBandwidthUsage(ctx context.Context, usage []BandwidthUsage) error {
+	if len(usage) == 0 {
+		return nil
+	}
+
+	query := psql.Insert("bandwidth_usage").
+		Columns("day", "tenant_id", "route", "requests", "bytes_in", "bytes_out")
+	for _, u := range usage {
+		query = query.Values(u.Day.UTC().Format(time.DateOnly), u.TenantID, u.Route, u.Requests, u.BytesIn, u.BytesOut)
+	}
+
+	sqlQuery, args, err := query.Suffix("ON CONFLICT (day, tenant_id, route) DO UPDATE SET " +
+		"requests = bandwidth_usage.requests + EXCLUDED.requests, " +
+		"bytes_in = bandwidth_usage.bytes_in + EXCLUDED.bytes_in, " +
+		"bytes_out = bandwidth_usage.bytes_out + EXCLUDED.bytes_out").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, sqlQuery, args...); err != nil {
+		return fmt.Errorf("add bandwidth usage: %w", err)
+	}
+
+	return nil
+}
+
+// GetBandwidthUsage sums the bandwidth of the days overlapping [From, To) per tenant, route and
+// period. The processing type of the filter does not apply to bandwidth.
+func (r *Repository) GetBandwidthUsage(ctx context.Context, filter UsageFilter) ([]BandwidthTotals, error) {
+	groupBy := []string{"tenant_id", "route"}
+
+	query := psql.Select("tenant_id", "route").
+		Column("COALESCE(SUM(requests), 0) AS requests").
+		Column("COALESCE(SUM(bytes_in), 0) AS bytes_in").
+		Column("COALESCE(SUM(bytes_out), 0) AS bytes_out").
+		From("bandwidth_usage").
+		Where(squirrel.GtOrEq{"day": filter.From.UTC().Format(time.DateOnly)}).
+		Where(squirrel.Lt{"day": filter.To})
+
+	switch filter.GroupBy {
+	case UsageGroupingNone:
+	case UsageGroupingMonth:
+		query = query.Column("date_trunc('month', day)::timestamp AS period_start")
+		groupBy = append(groupBy, "period_start")
+	default:
+		query = query.Column("day::timestamp AS period_start")
+		groupBy = append(groupBy, "period_start")
+	}
+	if filter.TenantID != "" {
+		query = query.Where(squirrel.Eq{"tenant_id": filter.TenantID})
+	}
+
+	sqlQuery, args, err := query.GroupBy(groupBy...).OrderBy(groupBy...).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var totals []BandwidthTotals
+	if err := r.db.SelectContext(ctx, &totals, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("get bandwidth usage: %w", err)
+	}
+
+	return totals, nil
+}
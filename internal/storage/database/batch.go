@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// LabelRequirement is one term of a label selector: the label Key equals or differs from Value, or
+// exists or is absent when Value is empty.
+type LabelRequirement struct {
+	Key    string
+	Negate bool
+	Value  string
+}
+
+// ParseLabelSelector parses a comma separated label selector in the style of Kubernetes:
+// key=value, key!=value, key (the label is set) and !key (it is not).
+func ParseLabelSelector(selector string) ([]LabelRequirement, error) {
+	var requirements []LabelRequirement
+	for term := range strings.SplitSeq(selector, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		var requirement LabelRequirement
+		switch {
+		case strings.Contains(term, "!="):
+			requirement.Key, requirement.Value, _ = strings.Cut(term, "!=")
+			requirement.Negate = true
+		case strings.Contains(term, "="):
+			requirement.Key, requirement.Value, _ = strings.Cut(term, "=")
+		case strings.HasPrefix(term, "!"):
+			requirement.Key = term[1:]
+			requirement.Negate = true
+		default:
+			requirement.Key = term
+		}
+
+		requirement.Key = strings.TrimSpace(requirement.Key)
+		requirement.Value = strings.TrimSpace(requirement.Value)
+		if !ValidLabelKey(requirement.Key) {
+			return nil, fmt.Errorf("invalid label selector term %q", term)
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements, nil
+}
+
+func (l LabelRequirement) sqlizer() squirrel.Sqlizer {
+	switch {
+	case l.Value == "" && l.Negate:
+		return squirrel.Expr("labels ->> ? IS NULL", l.Key)
+	case l.Value == "":
+		return squirrel.Expr("labels ->> ? IS NOT NULL", l.Key)
+	case l.Negate:
+		return squirrel.Expr("labels ->> ? IS DISTINCT FROM ?", l.Key, l.Value)
+	default:
+		return squirrel.Expr("labels ->> ? = ?", l.Key, l.Value)
+	}
+}
+
+// BatchFilter selects the jobs a bulk operation applies to: jobs of one of Statuses created in
+// [From, To), optionally of one tenant and processing type and matching every label requirement.
+// Zero times leave the range open. Jobs are returned in creation order a page at a time, After and
+// AfterID holding the creation time and ID of the last job of the previous page.
+type BatchFilter struct {
+	Statuses       []JobStatus
+	From           time.Time
+	To             time.Time
+	TenantID       string
+	ProcessingType ProcessingType
+	Labels         []LabelRequirement
+	After          time.Time
+	AfterID        uuid.UUID
+	Limit          int
+}
+
+func (f BatchFilter) where() squirrel.And {
+	where := squirrel.And{squirrel.Eq{"status": f.Statuses}}
+	if !f.From.IsZero() {
+		where = append(where, squirrel.GtOrEq{"created_at": f.From})
+	}
+	if !f.To.IsZero() {
+		where = append(where, squirrel.Lt{"created_at": f.To})
+	}
+	if f.TenantID != "" {
+		where = append(where, squirrel.Eq{"tenant_id": f.TenantID})
+	}
+	if f.ProcessingType != "" {
+		where = append(where, squirrel.Eq{"processing_type": f.ProcessingType})
+	}
+	for _, label := range f.Labels {
+		where = append(where, label.sqlizer())
+	}
+	return where
+}
+
+// CountBatchJobs counts the jobs matching the filter, regardless of its page.
+func (r *Repository) CountBatchJobs(ctx context.Context, filter BatchFilter) (int64, error) {
+	sqlQuery, args, err := psql.Select("COUNT(*)").From("jobs").Where(filter.where()).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build query: %w", err)
+	}
+
+	var count int64
+	if err := r.db.GetContext(ctx, &count, sqlQuery, args...); err != nil {
+		return 0, fmt.Errorf("count batch jobs: %w", err)
+	}
+	return count, nil
+}
+
+// ListBatchJobs returns the next page of jobs matching the filter.
+func (r *Repository) ListBatchJobs(ctx context.Context, filter BatchFilter) ([]*Job, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100 // Default limit
+	}
+
+	query := psql.Select(jobSelectColumns...).
+		From("jobs").
+		Where(filter.where()).
+		OrderBy("created_at", "id").
+		Limit(uint64(filter.Limit))
+	if filter.AfterID != uuid.Nil {
+		query = query.Where(squirrel.Expr("(created_at, id) > (?, ?)", filter.After, filter.AfterID))
+	}
+
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var jobs []*Job
+	if err := r.db.SelectContext(ctx, &jobs, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("list batch jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// CancelJobs cancels those of the jobs that are still pending, recording reason as their error,
+// and returns them.
+func (r *Repository) CancelJobs(ctx context.Context, ids []uuid.UUID, reason string) ([]*Job, error) {
+	query := psql.Update("jobs").
+		Set("status", JobStatusCanceled).
+		Set("error_message", reason).
+		Set("completed_at", time.Now()).
+		Where(squirrel.Eq{"id": ids, "status": JobStatusPending})
+	return r.updateBatchJobs(ctx, query, "cancel jobs")
+}
+
+// RequeueJobs makes those of the jobs that are still of one of statuses pending again, clearing
+// their previous outcome, and returns them for publishing.
+func (r *Repository) RequeueJobs(ctx context.Context, ids []uuid.UUID, statuses []JobStatus) ([]*Job, error) {
+	query := psql.Update("jobs").
+		Set("status", JobStatusPending).
+		Set("error_message", nil).
+		Set("started_at", nil).
+		Set("completed_at", nil).
+		Set("worker_id", nil).
+		Where(squirrel.Eq{"id": ids, "status": statuses})
+	return r.updateBatchJobs(ctx, query, "requeue jobs")
+}
+
+func (r *Repository) updateBatchJobs(ctx context.Context, query squirrel.UpdateBuilder, operation string) ([]*Job, error) {
+	sqlQuery, args, err := query.Suffix("RETURNING " + strings.Join(jobSelectColumns, ", ")).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var jobs []*Job
+	if err := r.db.SelectContext(ctx, &jobs, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("%s: %w", operation, err)
+	}
+	return jobs, nil
+}
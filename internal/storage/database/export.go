@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// ExportFilter selects the jobs created in [From, To), optionally of one status, tenant and
+// processing type. Jobs are returned in creation order a page at a time: After and AfterID hold the
+// creation time and ID of the last job of the previous page, and are zero for the first page.
+type ExportFilter struct {
+	From           time.Time
+	To             time.Time
+	Status         JobStatus
+	TenantID       string
+	ProcessingType ProcessingType
+	After          time.Time
+	AfterID        uuid.UUID
+	Limit          int
+}
+
+// ExportJobs returns the next page of jobs matching the filter. Pages are read by keyset, so
+// exports of any size keep a constant cost per page.
+func (r *Repository) ExportJobs(ctx context.Context, filter ExportFilter) ([]*Job, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100 // Default limit
+	}
+
+	query := psql.Select(jobSelectColumns...).
+		From("jobs").
+		Where(squirrel.GtOrEq{"created_at": filter.From}).
+		Where(squirrel.Lt{"created_at": filter.To}).
+		OrderBy("created_at", "id").
+		Limit(uint64(filter.Limit))
+
+	if filter.AfterID != uuid.Nil {
+		query = query.Where(squirrel.Expr("(created_at, id) > (?, ?)", filter.After, filter.AfterID))
+	}
+	if filter.Status != "" {
+		query = query.Where(squirrel.Eq{"status": filter.Status})
+	}
+	if filter.TenantID != "" {
+		query = query.Where(squirrel.Eq{"tenant_id": filter.TenantID})
+	}
+	if filter.ProcessingType != "" {
+		query = query.Where(squirrel.Eq{"processing_type": filter.ProcessingType})
+	}
+
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var jobs []*Job
+	if err := r.db.SelectContext(ctx, &jobs, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("export jobs: %w", err)
+	}
+
+	return jobs, nil
+}
+
+// ImportJob inserts a job restored from an export archive with its outcome and usage, unlike
+// CreateJob, which inserts a new pending job.
+func (r *Repository) ImportJob(ctx context.Context, job *Job) error {
+	attempts := 0
+	if job.Status != JobStatusPending {
+		attempts = 1
+	}
+
+	sqlQuery, args, err := psql.Insert("jobs").
+		Columns("id", "tenant_id", "original_filename", "file_path", "second_original_filename",
+			"processing_type", "parameters", "status", "delay_ms", "result_path", "error_message",
+			"created_at", "started_at", "completed_at", "worker_id",
+			"cpu_time_ms", "wall_time_ms", "peak_memory_bytes", "bytes_read", "bytes_written", "imported_from",
+			"attempts", "notes", "labels").
+		Values(job.ID, job.TenantID, job.OriginalFilename, job.FilePath, nullIfEmpty(job.SecondOriginalFilename),
+			job.ProcessingType, job.Parameters, job.Status, job.DelayMS, nullIfEmpty(job.ResultPath), nullIfEmpty(job.ErrorMessage),
+			job.CreatedAt, job.StartedAt, job.CompletedAt, nullIfEmpty(job.WorkerID),
+			job.CPUTimeMS, job.WallTimeMS, job.PeakMemoryBytes, job.BytesRead, job.BytesWritten, job.ImportedFrom,
+			attempts, nullIfEmpty(job.Notes), job.Labels).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin import job: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, sqlQuery, args...); err != nil {
+		return fmt.Errorf("import job: %w", err)
+	}
+
+	// The imported result is the only version of the job
+	if job.ResultPath != "" {
+		writtenAt := time.Now()
+		if job.CompletedAt != nil {
+			writtenAt = *job.CompletedAt
+		}
+		sqlQuery, args, err = psql.Insert("job_results").
+			Columns("job_id", "version", "result_path", "worker_id", "created_at").
+			Values(job.ID, 1, job.ResultPath, nullIfEmpty(job.WorkerID), writtenAt).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, sqlQuery, args...); err != nil {
+			return fmt.Errorf("import job result: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit import job: %w", err)
+	}
+	return nil
+}
@@ -5,30 +5,61 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// uniqueViolation is the PostgreSQL error code of a unique constraint violation.
+const uniqueViolation = "23505"
+
+// ErrJobCanceled is returned by UpdateStatus when a worker starts a job that was canceled while
+// its message was queued.
+var ErrJobCanceled = errors.New("job was canceled")
+
+// ErrJobExists is returned by CreateJob when a job with the same ID already exists, which happens
+// when clients supply their own job IDs.
+var ErrJobExists = errors.New("job already exists")
+
 type (
 	JobStatus      string
 	ProcessingType string
 
 	Job struct {
-		ID               uuid.UUID      `json:"id" db:"id"`
-		OriginalFilename string         `json:"original_filename" db:"original_filename"`
-		FilePath         string         `json:"file_path" db:"file_path"`
-		ProcessingType   ProcessingType `json:"processing_type" db:"processing_type"`
-		Parameters       JSONB          `json:"parameters" db:"parameters"`
-		Status           JobStatus      `json:"status" db:"status"`
-		DelayMS          int            `json:"delay_ms" db:"delay_ms"`
-		ResultPath       string         `json:"result_path,omitempty" db:"result_path"`
-		ErrorMessage     string         `json:"error_message,omitempty" db:"error_message"`
-		CreatedAt        time.Time      `json:"created_at" db:"created_at"`
-		StartedAt        *time.Time     `json:"started_at,omitempty" db:"started_at"`
-		CompletedAt      *time.Time     `json:"completed_at,omitempty" db:"completed_at"`
-		WorkerID         string         `json:"worker_id,omitempty" db:"worker_id"`
+		ID               uuid.UUID `json:"id" db:"id"`
+		TenantID         string    `json:"tenant_id" db:"tenant_id"`
+		OriginalFilename string    `json:"original_filename" db:"original_filename"`
+		FilePath         string    `json:"file_path" db:"file_path"`
+		// SecondOriginalFilename and SecondFilePath hold the second input of two-file processing types.
+		SecondOriginalFilename string         `json:"second_original_filename,omitempty" db:"second_original_filename"`
+		SecondFilePath         string         `json:"second_file_path,omitempty" db:"second_file_path"`
+		ProcessingType         ProcessingType `json:"processing_type" db:"processing_type"`
+		Parameters             JSONB          `json:"parameters" db:"parameters"`
+		Status                 JobStatus      `json:"status" db:"status"`
+		DelayMS                int            `json:"delay_ms" db:"delay_ms"`
+		ResultPath             string         `json:"result_path,omitempty" db:"result_path"`
+		ErrorMessage           string         `json:"error_message,omitempty" db:"error_message"`
+		CreatedAt              time.Time      `json:"created_at" db:"created_at"`
+		StartedAt              *time.Time     `json:"started_at,omitempty" db:"started_at"`
+		CompletedAt            *time.Time     `json:"completed_at,omitempty" db:"completed_at"`
+		WorkerID               string         `json:"worker_id,omitempty" db:"worker_id"`
+		// Attempts counts the processing attempts of the job, each writing its own result version.
+		Attempts int `json:"attempts" db:"attempts"`
+		// Notes and Labels are annotations clients change after creation; Revision counts the
+		// changes, made last at UpdatedAt.
+		Notes     string     `json:"notes,omitempty" db:"notes"`
+		Labels    JSONB      `json:"labels,omitempty" db:"labels"`
+		Revision  int        `json:"revision" db:"revision"`
+		UpdatedAt *time.Time `json:"updated_at,omitempty" db:"updated_at"`
+		// ImportedFrom holds the exported record a job was restored from; empty for jobs created here.
+		ImportedFrom JSONB `json:"imported_from,omitempty" db:"imported_from"`
+		// JobUsage is recorded by the worker when processing finishes, successfully or not.
+		JobUsage
 	}
 )
 
@@ -39,6 +70,14 @@ const (
 	ProcessingTypeLowercase ProcessingType = "lowercase"
 	ProcessingTypeReplace   ProcessingType = "replace"
 	ProcessingTypeExtract   ProcessingType = "extract"
+	ProcessingTypeDiff      ProcessingType = "diff"
+	ProcessingTypeTextStats ProcessingType = "textstats"
+	ProcessingTypeChunk     ProcessingType = "chunk"
+	ProcessingTypeExec      ProcessingType = "exec"
+	ProcessingTypeRedact    ProcessingType = "redact"
+	ProcessingTypePIIReport ProcessingType = "pii_report"
+	ProcessingTypeLanguage  ProcessingType = "detect_language"
+	ProcessingTypeTranscode ProcessingType = "transcode"
 )
 
 func (p ProcessingType) String() string {
@@ -53,9 +92,52 @@ var processingTypes = map[string]ProcessingType{
 	ProcessingTypeLowercase.String(): ProcessingTypeLowercase,
 	ProcessingTypeReplace.String():   ProcessingTypeReplace,
 	ProcessingTypeExtract.String():   ProcessingTypeExtract,
+	ProcessingTypeDiff.String():      ProcessingTypeDiff,
+	ProcessingTypeTextStats.String(): ProcessingTypeTextStats,
+	ProcessingTypeChunk.String():     ProcessingTypeChunk,
+	ProcessingTypeExec.String():      ProcessingTypeExec,
+	ProcessingTypeRedact.String():    ProcessingTypeRedact,
+	ProcessingTypePIIReport.String(): ProcessingTypePIIReport,
+	ProcessingTypeLanguage.String():  ProcessingTypeLanguage,
+	ProcessingTypeTranscode.String(): ProcessingTypeTranscode,
+}
+
+// ProcessingTypes returns the built-in processing types in sorted order; plugin types are not included.
+func ProcessingTypes() []ProcessingType {
+	types := make([]ProcessingType, 0, len(processingTypes))
+	for _, pt := range processingTypes {
+		types = append(types, pt)
+	}
+	slices.Sort(types)
+	return types
+}
+
+// RequiresSecondFile reports whether the processing type compares two uploaded files.
+func (p ProcessingType) RequiresSecondFile() bool {
+	return p == ProcessingTypeDiff
+}
+
+// PluginProcessingTypePrefix marks processing types served by worker WASM plugins, e.g. "plugin:reverse".
+// The API accepts any well-formed plugin name; workers fail jobs for plugins they have not loaded.
+const PluginProcessingTypePrefix = "plugin:"
+
+//nolint:gochecknoglobals // pluginNamePattern is compiled once
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidPluginName reports whether name can be used as a plugin processing type.
+func ValidPluginName(name string) bool {
+	return pluginNamePattern.MatchString(name)
+}
+
+// PluginName returns the plugin name of a plugin processing type.
+func (p ProcessingType) PluginName() (string, bool) {
+	return strings.CutPrefix(string(p), PluginProcessingTypePrefix)
 }
 
 func ToProcessingType(pt string) (ProcessingType, bool) {
+	if name, ok := strings.CutPrefix(pt, PluginProcessingTypePrefix); ok {
+		return ProcessingType(pt), ValidPluginName(name)
+	}
 	res, ok := processingTypes[pt]
 	return res, ok
 }
@@ -65,18 +147,26 @@ const (
 	JobStatusRunning   JobStatus = "running"
 	JobStatusSucceeded JobStatus = "succeeded"
 	JobStatusFailed    JobStatus = "failed"
+	// JobStatusCanceled jobs were canceled while pending; workers drop their queued messages.
+	JobStatusCanceled JobStatus = "canceled"
 )
 
 func (s JobStatus) String() string {
 	return string(s)
 }
 
+// Finished reports whether the job reached a terminal status: succeeded, failed or canceled.
+func (s JobStatus) Finished() bool {
+	return s == JobStatusSucceeded || s == JobStatusFailed || s == JobStatusCanceled
+}
+
 //nolint:gochecknoglobals // jobStatuses is a map of all valid job statuses.
 var jobStatuses = map[string]JobStatus{
 	JobStatusPending.String():   JobStatusPending,
 	JobStatusRunning.String():   JobStatusRunning,
 	JobStatusSucceeded.String(): JobStatusSucceeded,
 	JobStatusFailed.String():    JobStatusFailed,
+	JobStatusCanceled.String():  JobStatusCanceled,
 }
 
 func ToJobStatus(status string) (JobStatus, bool) {
@@ -95,8 +185,11 @@ var psql = squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 //nolint:gochecknoglobals // jobSelectColumns is a read-only slice, safe to use as global
 var jobSelectColumns = []string{
 	"id",
+	"tenant_id",
 	"original_filename",
 	"file_path",
+	"COALESCE(second_original_filename, '') as second_original_filename",
+	"COALESCE(second_file_path, '') as second_file_path",
 	"processing_type",
 	"parameters",
 	"status",
@@ -107,58 +200,149 @@ var jobSelectColumns = []string{
 	"started_at",
 	"completed_at",
 	"COALESCE(worker_id, '') as worker_id",
+	"attempts",
+	"COALESCE(notes, '') as notes",
+	"labels",
+	"revision",
+	"updated_at",
+	"imported_from",
+	"COALESCE(cpu_time_ms, 0) as cpu_time_ms",
+	"COALESCE(wall_time_ms, 0) as wall_time_ms",
+	"COALESCE(peak_memory_bytes, 0) as peak_memory_bytes",
+	"COALESCE(bytes_read, 0) as bytes_read",
+	"COALESCE(bytes_written, 0) as bytes_written",
+}
+
+// JobSort orders job listings, newest first by default or longest first by one of the durations of
+// the job lifecycle.
+type JobSort string
+
+const (
+	JobSortCreated    JobSort = "created_at"
+	JobSortQueueWait  JobSort = "queue_wait_ms"
+	JobSortProcessing JobSort = "processing_ms"
+	JobSortTotal      JobSort = "total_ms"
+)
+
+//nolint:gochecknoglobals // jobDurations maps the duration sorts to their SQL expressions.
+var jobDurations = map[JobSort]string{
+	JobSortQueueWait:  "started_at - created_at",
+	JobSortProcessing: "completed_at - started_at",
+	JobSortTotal:      "completed_at - created_at",
+}
+
+func ToJobSort(sort string) (JobSort, bool) {
+	if JobSort(sort) == JobSortCreated {
+		return JobSortCreated, true
+	}
+	_, ok := jobDurations[JobSort(sort)]
+	return JobSort(sort), ok
 }
 
 type GetJobsFilter struct {
 	Status JobStatus
-	Limit  int
-	Offset int
+	// CreatedAfter and CreatedBefore bound the creation time when set, which limits the query to
+	// the monthly partitions of that range.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// MinQueueWait, MinProcessing and MinTotal keep the jobs that spent at least that long queued,
+	// processing and from submission to completion; zero disables them.
+	MinQueueWait  time.Duration
+	MinProcessing time.Duration
+	MinTotal      time.Duration
+	Sort          JobSort
+	Limit         int
+	Offset        int
 }
 
 func (r *Repository) GetJobs(ctx context.Context, req GetJobsFilter) ([]*Job, error) {
 	if req.Limit <= 0 {
 		req.Limit = 100 // Default limit
 	}
+
+	var jobs []*Job
+	err := r.StreamJobs(ctx, req, func(job *Job) error {
+		jobs = append(jobs, job)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// StreamJobs passes the jobs matching the filter to fn as they are read from the database, so
+// listings of any size are never held in memory at once. A zero Limit streams every matching job.
+// An error returned by fn stops the stream and is returned.
+func (r *Repository) StreamJobs(ctx context.Context, req GetJobsFilter, fn func(*Job) error) error {
 	if req.Offset < 0 {
 		req.Offset = 0 // Default offset
 	}
 
 	query := psql.Select(jobSelectColumns...).
 		From("jobs").
-		OrderBy("created_at DESC").
-		Limit(uint64(req.Limit)).
 		Offset(uint64(req.Offset))
 
+	// Jobs that have not reached the stage a duration ends with sort last
+	if duration, ok := jobDurations[req.Sort]; ok {
+		query = query.OrderBy(duration + " DESC NULLS LAST")
+	}
+	query = query.OrderBy("created_at DESC")
+
+	if req.Limit > 0 {
+		query = query.Limit(uint64(req.Limit))
+	}
+
 	// Add status filter if specified
 	if req.Status != "" {
 		query = query.Where(squirrel.Eq{"status": req.Status})
 	}
+	if !req.CreatedAfter.IsZero() {
+		query = query.Where(squirrel.GtOrEq{"created_at": req.CreatedAfter})
+	}
+	if !req.CreatedBefore.IsZero() {
+		query = query.Where(squirrel.Lt{"created_at": req.CreatedBefore})
+	}
+	for _, bound := range []struct {
+		sort    JobSort
+		minimum time.Duration
+	}{
+		{JobSortQueueWait, req.MinQueueWait},
+		{JobSortProcessing, req.MinProcessing},
+		{JobSortTotal, req.MinTotal},
+	} {
+		if bound.minimum > 0 {
+			query = query.Where(jobDurations[bound.sort]+" >= make_interval(secs => ?)", bound.minimum.Seconds())
+		}
+	}
 
 	sqlQuery, args, err := query.ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("build query: %w", err)
+		return fmt.Errorf("build query: %w", err)
 	}
 
 	rows, err := r.db.QueryxContext(ctx, sqlQuery, args...)
 	if err != nil {
-		return nil, fmt.Errorf("list jobs: %w", err)
+		return fmt.Errorf("list jobs: %w", err)
 	}
 	defer rows.Close()
 
-	var jobs []*Job
 	for rows.Next() {
 		var job Job
 		if err := rows.StructScan(&job); err != nil {
-			return nil, fmt.Errorf("scan job: %w", err)
+			return fmt.Errorf("scan job: %w", err)
+		}
+		if err := fn(&job); err != nil {
+			return err
 		}
-		jobs = append(jobs, &job)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error during row iteration: %w", err)
+		return fmt.Errorf("error during row iteration: %w", err)
 	}
 
-	return jobs, nil
+	return nil
 }
 
 func (r *Repository) GetJobByID(ctx context.Context, id uuid.UUID) (*Job, error) {
@@ -166,7 +350,7 @@ func (r *Repository) GetJobByID(ctx context.Context, id uuid.UUID) (*Job, error)
 
 	query, args, err := psql.Select(jobSelectColumns...).
 		From("jobs").
-		Where(squirrel.Eq{"id": id}).
+		Where(byJobID(id)).
 		ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("build query: %w", err)
@@ -218,12 +402,111 @@ func (r *Repository) CountJobsByStatus(ctx context.Context, status JobStatus) (i
 	return count, nil
 }
 
+// GetJobStatusCounts returns the number of jobs per status as kept current by a trigger on the jobs
+// table, which is cheap to read however many jobs there are. Statuses without jobs may be missing.
+func (r *Repository) GetJobStatusCounts(ctx context.Context) (map[JobStatus]int, error) {
+	sqlQuery, args, err := psql.Select("status", "count").From("job_status_counts").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var rows []struct {
+		Status JobStatus `db:"status"`
+		Count  int       `db:"count"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("get job status counts: %w", err)
+	}
+
+	counts := make(map[JobStatus]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// CountRunningJobsOfType counts the jobs of the processing type workers are processing.
+func (r *Repository) CountRunningJobsOfType(ctx context.Context, processingType ProcessingType) (int64, error) {
+	var count int64
+
+	sqlQuery, args, err := psql.Select("COUNT(*)").
+		From("jobs").
+		Where(squirrel.Eq{"status": JobStatusRunning, "processing_type": processingType}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build query: %w", err)
+	}
+
+	if err := r.db.GetContext(ctx, &count, sqlQuery, args...); err != nil {
+		return 0, fmt.Errorf("count running jobs of type: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountCompletedJobsWithin counts jobs that reached a terminal status since the given time
+// and how many of them succeeded within the latency threshold.
+func (r *Repository) CountCompletedJobsWithin(ctx context.Context, since time.Time, threshold time.Duration) (int64, int64, error) {
+	var counts struct {
+		Total  int64 `db:"total"`
+		Within int64 `db:"within"`
+	}
+
+	sqlQuery, args, err := psql.Select("COUNT(*) AS total").
+		Column(squirrel.Expr(
+			"COUNT(*) FILTER (WHERE status = ? AND completed_at - created_at <= make_interval(secs => ?)) AS within",
+			JobStatusSucceeded, threshold.Seconds())).
+		From("jobs").
+		Where(squirrel.Eq{"status": []JobStatus{JobStatusSucceeded, JobStatusFailed}}).
+		Where(squirrel.GtOrEq{"completed_at": since}).
+		ToSql()
+	if err != nil {
+		return 0, 0, fmt.Errorf("build query: %w", err)
+	}
+
+	if err := r.db.GetContext(ctx, &counts, sqlQuery, args...); err != nil {
+		return 0, 0, fmt.Errorf("count completed jobs: %w", err)
+	}
+
+	return counts.Total, counts.Within, nil
+}
+
+// CountFinishedJobsSince counts jobs that reached a terminal status since the given time and how
+// many of them failed.
+func (r *Repository) CountFinishedJobsSince(ctx context.Context, since time.Time) (int64, int64, error) {
+	var counts struct {
+		Total  int64 `db:"total"`
+		Failed int64 `db:"failed"`
+	}
+
+	sqlQuery, args, err := psql.Select("COUNT(*) AS total").
+		Column(squirrel.Expr("COUNT(*) FILTER (WHERE status = ?) AS failed", JobStatusFailed)).
+		From("jobs").
+		Where(squirrel.Eq{"status": []JobStatus{JobStatusSucceeded, JobStatusFailed}}).
+		Where(squirrel.GtOrEq{"completed_at": since}).
+		ToSql()
+	if err != nil {
+		return 0, 0, fmt.Errorf("build query: %w", err)
+	}
+
+	if err := r.db.GetContext(ctx, &counts, sqlQuery, args...); err != nil {
+		return 0, 0, fmt.Errorf("count finished jobs: %w", err)
+	}
+
+	return counts.Total, counts.Failed, nil
+}
+
+// nullIfEmpty stores optional text columns as NULL rather than empty strings.
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 func (r *Repository) CreateJob(ctx context.Context, job *Job) error {
 	sqlQuery, args, err := psql.Insert("jobs").
-		Columns("id", "original_filename", "file_path", "processing_type",
-			"parameters", "status", "delay_ms", "created_at").
-		Values(job.ID, job.OriginalFilename, job.FilePath, job.ProcessingType,
-			job.Parameters, job.Status, job.DelayMS, job.CreatedAt).
+		Columns("id", "tenant_id", "original_filename", "file_path", "second_original_filename", "second_file_path",
+			"processing_type", "parameters", "status", "delay_ms", "created_at").
+		Values(job.ID, job.TenantID, job.OriginalFilename, job.FilePath, nullIfEmpty(job.SecondOriginalFilename), nullIfEmpty(job.SecondFilePath),
+			job.ProcessingType, job.Parameters, job.Status, job.DelayMS, job.CreatedAt).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("build query: %w", err)
@@ -231,6 +514,10 @@ func (r *Repository) CreateJob(ctx context.Context, job *Job) error {
 
 	_, err = r.db.ExecContext(ctx, sqlQuery, args...)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return fmt.Errorf("create job %s: %w", job.ID, ErrJobExists)
+		}
 		return fmt.Errorf("create job: %w", err)
 	}
 
@@ -240,14 +527,15 @@ func (r *Repository) CreateJob(ctx context.Context, job *Job) error {
 func (r *Repository) UpdateStatus(ctx context.Context, id uuid.UUID, status JobStatus, workerID *string) error {
 	now := time.Now()
 
-	query := psql.Update("jobs").Where(squirrel.Eq{"id": id})
+	query := psql.Update("jobs").Where(byJobID(id))
 
 	switch status {
 	case JobStatusRunning:
 		query = query.Set("status", status).
 			Set("started_at", now).
-			Set("worker_id", workerID)
-	case JobStatusSucceeded, JobStatusFailed:
+			Set("worker_id", workerID).
+			Where(squirrel.NotEq{"status": JobStatusCanceled})
+	case JobStatusSucceeded, JobStatusFailed, JobStatusCanceled:
 		query = query.Set("status", status).
 			Set("completed_at", now)
 	case JobStatusPending:
@@ -270,34 +558,11 @@ func (r *Repository) UpdateStatus(ctx context.Context, id uuid.UUID, status JobS
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("job not found: %s", id)
-	}
-
-	return nil
-}
-
-func (r *Repository) UpdateResult(ctx context.Context, id uuid.UUID, resultPath string) error {
-	sqlQuery, args, err := psql.Update("jobs").
-		Set("result_path", resultPath).
-		Set("status", JobStatusSucceeded).
-		Set("completed_at", time.Now()).
-		Where(squirrel.Eq{"id": id}).
-		ToSql()
-	if err != nil {
-		return fmt.Errorf("build query: %w", err)
-	}
-
-	result, err := r.db.ExecContext(ctx, sqlQuery, args...)
-	if err != nil {
-		return fmt.Errorf("update job result: %w", err)
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("get rows affected: %w", err)
-	}
-
-	if rowsAffected == 0 {
+		if status == JobStatusRunning {
+			if job, err := r.GetJobByID(ctx, id); err == nil && job.Status == JobStatusCanceled {
+				return fmt.Errorf("start job %s: %w", id, ErrJobCanceled)
+			}
+		}
 		return fmt.Errorf("job not found: %s", id)
 	}
 
@@ -309,7 +574,7 @@ func (r *Repository) UpdateError(ctx context.Context, id uuid.UUID, errorMessage
 		Set("error_message", errorMessage).
 		Set("status", JobStatusFailed).
 		Set("completed_at", time.Now()).
-		Where(squirrel.Eq{"id": id}).
+		Where(byJobID(id)).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("build query: %w", err)
@@ -4,15 +4,33 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	pgxv5 "github.com/golang-migrate/migrate/v4/database/pgx/v5"
 	"github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
+	"github.com/rsav/k8s-learning/internal/config"
 )
 
-func RunMigrations(connStr, migrationsURL string, log *slog.Logger) error {
+const (
+	// migrationLockID keys the Postgres advisory lock API replicas take turns migrating under.
+	migrationLockID = 4_209_117_325
+	// migrationLockPollInterval is how often a replica retries the lock held by another one.
+	migrationLockPollInterval = time.Second
+)
+
+// ErrSchemaTooNew is returned when the database schema is at a migration this binary does not
+// know, i.e. a newer release migrated it. Serving it could corrupt data the binary does not
+// understand.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// RunMigrations applies the pending migrations in migrationsURL. Replicas starting together take
+// turns under an advisory lock, waiting at most lockTimeout for the one migrating, and refuse to
+// touch a schema newer than the latest migration they know.
+func RunMigrations(connStr, migrationsURL string, lockTimeout time.Duration, log *slog.Logger) error {
 	ctx := context.Background()
 
 	log.DebugContext(ctx, "creating separate database connection for migrations")
@@ -22,6 +40,22 @@ func RunMigrations(connStr, migrationsURL string, log *slog.Logger) error {
 	}
 	defer migrationDB.Close()
 
+	// Session-level advisory locks belong to a connection, so the lock holds one for the whole run
+	lockConn, err := migrationDB.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("open migration lock connection: %w", err)
+	}
+	defer lockConn.Close()
+
+	if err := acquireMigrationLock(ctx, lockConn, lockTimeout, log); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := lockConn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			log.WarnContext(ctx, "failed to release migration lock", "error", err)
+		}
+	}()
+
 	log.DebugContext(ctx, "creating migration driver instance")
 	driver, err := pgxv5.WithInstance(migrationDB.DB, &pgxv5.Config{})
 	if err != nil {
@@ -41,16 +75,169 @@ func RunMigrations(connStr, migrationsURL string, log *slog.Logger) error {
 	}
 	defer m.Close()
 
+	latest, err := latestMigration(migrationsURL)
+	if err != nil {
+		return err
+	}
+	current, _, err := m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+	if current > latest {
+		return fmt.Errorf("%w: schema is at version %d, latest known migration is %d", ErrSchemaTooNew, current, latest)
+	}
+
 	log.DebugContext(ctx, "running pending migrations")
-	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+	err = m.Up()
+	switch {
+	case errors.Is(err, migrate.ErrNoChange):
+		log.InfoContext(ctx, "no new migrations to apply", "version", current)
+	case err != nil:
 		return fmt.Errorf("run migrations: %w", err)
+	default:
+		log.InfoContext(ctx, "migrations completed successfully", "from_version", current, "to_version", latest)
+	}
+
+	return nil
+}
+
+// acquireMigrationLock takes the migration advisory lock on conn, retrying while another replica
+// holds it for up to timeout.
+func acquireMigrationLock(ctx context.Context, conn *sqlx.Conn, timeout time.Duration, log *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(migrationLockPollInterval)
+	defer ticker.Stop()
+
+	for waiting := false; ; waiting = true {
+		var acquired bool
+		if err := conn.GetContext(ctx, &acquired, "SELECT pg_try_advisory_lock($1)", migrationLockID); err != nil {
+			return fmt.Errorf("acquire migration lock: %w", err)
+		}
+		if acquired {
+			return nil
+		}
+
+		if !waiting {
+			log.InfoContext(ctx, "another replica is running migrations, waiting", "timeout", timeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("acquire migration lock: still held by another replica after %s", timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckSchemaVersion fails with ErrSchemaTooNew when the schema is at a migration newer than the
+// latest in migrationsURL. Pods that leave migrations to a dedicated Job check it instead of
+// migrating; a schema that is behind is left to the startup probe.
+func CheckSchemaVersion(ctx context.Context, conf config.Database, migrationsURL string) error {
+	latest, err := latestMigration(migrationsURL)
+	if err != nil {
+		return err
+	}
+
+	db, err := sqlx.Open("pgx", conf.ConnectionString())
+	if err != nil {
+		return fmt.Errorf("open database connection: %w", err)
 	}
+	defer db.Close()
 
-	if errors.Is(err, migrate.ErrNoChange) {
-		log.InfoContext(ctx, "no new migrations to apply")
-	} else {
-		log.InfoContext(ctx, "migrations completed successfully")
+	// Before the first migration ran there is no version to compare
+	var migrated bool
+	if err := db.GetContext(ctx, &migrated, "SELECT to_regclass('schema_migrations') IS NOT NULL"); err != nil {
+		return fmt.Errorf("check schema version table: %w", err)
+	}
+	if !migrated {
+		return nil
 	}
 
+	state, err := readSchemaState(ctx, db)
+	if err != nil {
+		return err
+	}
+	if state.Version > int64(latest) {
+		return fmt.Errorf("%w: schema is at version %d, latest known migration is %d", ErrSchemaTooNew, state.Version, latest)
+	}
+	return nil
+}
+
+// Ping opens a connection to the database and closes it again, to wait for the database before
+// the service connects for good.
+func Ping(ctx context.Context, conf config.Database) error {
+	db, err := sqlx.Open("pgx", conf.ConnectionString())
+	if err != nil {
+		return fmt.Errorf("open database connection: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
 	return nil
 }
+
+// CheckMigrations fails unless the schema is clean and at the latest migration in migrationsURL,
+// i.e. every migration this binary knows about and none it does not know has been applied.
+func (r *Repository) CheckMigrations(ctx context.Context, migrationsURL string) error {
+	latest, err := latestMigration(migrationsURL)
+	if err != nil {
+		return err
+	}
+
+	state, err := readSchemaState(ctx, r.db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case state.Dirty:
+		return fmt.Errorf("migration %d failed and left the schema dirty", state.Version)
+	case state.Version > int64(latest):
+		return fmt.Errorf("%w: schema is at version %d, latest known migration is %d", ErrSchemaTooNew, state.Version, latest)
+	case state.Version < int64(latest):
+		return fmt.Errorf("schema is at version %d, migrations up to %d are pending", state.Version, latest)
+	}
+	return nil
+}
+
+type schemaState struct {
+	Version int64 `db:"version"`
+	Dirty   bool  `db:"dirty"`
+}
+
+// readSchemaState reads the version golang-migrate recorded for the schema.
+func readSchemaState(ctx context.Context, db *sqlx.DB) (schemaState, error) {
+	var state schemaState
+	if err := db.GetContext(ctx, &state, "SELECT version, dirty FROM schema_migrations LIMIT 1"); err != nil {
+		return schemaState{}, fmt.Errorf("read schema version: %w", err)
+	}
+	return state, nil
+}
+
+// latestMigration returns the version of the last migration in migrationsURL.
+func latestMigration(migrationsURL string) (uint, error) {
+	source, err := (&file.File{}).Open(migrationsURL)
+	if err != nil {
+		return 0, fmt.Errorf("open migrations source: %w", err)
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return 0, fmt.Errorf("read first migration: %w", err)
+	}
+	for {
+		next, err := source.Next(version)
+		if errors.Is(err, fs.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read migration after %d: %w", version, err)
+		}
+		version = next
+	}
+}
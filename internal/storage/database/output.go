@@ -0,0 +1,113 @@
+package database
+
+// OutputFormatParam is the job parameter selecting the result format.
+const OutputFormatParam = "output_format"
+
+type OutputFormat string
+
+const (
+	OutputFormatText     OutputFormat = "text"
+	OutputFormatJSON     OutputFormat = "json"
+	OutputFormatCSV      OutputFormat = "csv"
+	OutputFormatMarkdown OutputFormat = "markdown"
+	// OutputFormatJSONL is newline-delimited JSON, one record per line.
+	OutputFormatJSONL OutputFormat = "jsonl"
+)
+
+func (f OutputFormat) String() string {
+	return string(f)
+}
+
+//nolint:gochecknoglobals // outputFormats is a map of all valid output formats.
+var outputFormats = map[string]OutputFormat{
+	OutputFormatText.String():     OutputFormatText,
+	OutputFormatJSON.String():     OutputFormatJSON,
+	OutputFormatCSV.String():      OutputFormatCSV,
+	OutputFormatMarkdown.String(): OutputFormatMarkdown,
+	OutputFormatJSONL.String():    OutputFormatJSONL,
+}
+
+func ToOutputFormat(f string) (OutputFormat, bool) {
+	res, ok := outputFormats[f]
+	return res, ok
+}
+
+// OutputFormatFromParams returns the output format requested in job parameters, defaulting to the
+// processing type's default format.
+func OutputFormatFromParams(processingType ProcessingType, params map[string]any) OutputFormat {
+	name, _ := params[OutputFormatParam].(string)
+	if format, ok := ToOutputFormat(name); ok {
+		return format
+	}
+	return processingType.DefaultOutputFormat()
+}
+
+// ContentType returns the MIME type results in this format are served with.
+func (f OutputFormat) ContentType() string {
+	switch f {
+	case OutputFormatJSON:
+		return "application/json"
+	case OutputFormatCSV:
+		return "text/csv"
+	case OutputFormatMarkdown:
+		return "text/markdown"
+	case OutputFormatJSONL:
+		return "application/x-ndjson"
+	case OutputFormatText:
+		return "text/plain"
+	default:
+		return "text/plain"
+	}
+}
+
+// Extension returns the file extension, without the dot, for results in this format.
+func (f OutputFormat) Extension() string {
+	switch f {
+	case OutputFormatJSON:
+		return "json"
+	case OutputFormatCSV:
+		return "csv"
+	case OutputFormatMarkdown:
+		return "md"
+	case OutputFormatJSONL:
+		return "jsonl"
+	case OutputFormatText:
+		return "txt"
+	default:
+		return "txt"
+	}
+}
+
+// DefaultOutputFormat returns the format used when a job does not request one.
+func (p ProcessingType) DefaultOutputFormat() OutputFormat {
+	switch p {
+	case ProcessingTypeTextStats, ProcessingTypePIIReport, ProcessingTypeLanguage:
+		return OutputFormatJSON
+	case ProcessingTypeChunk:
+		return OutputFormatJSONL
+	default:
+		return OutputFormatText
+	}
+}
+
+// SupportsOutputFormat reports whether the processing type can emit results in format.
+// Text transformations only produce plain text; analysis types support every tabular format,
+// textstats, pii_report and detect_language, whose results are nested, are JSON only and chunk
+// emits JSONL only.
+func (p ProcessingType) SupportsOutputFormat(format OutputFormat) bool {
+	switch p {
+	case ProcessingTypeWordCount, ProcessingTypeLineCount, ProcessingTypeExtract:
+		return format != OutputFormatJSONL
+	case ProcessingTypeUppercase, ProcessingTypeLowercase, ProcessingTypeReplace, ProcessingTypeDiff,
+		ProcessingTypeExec, ProcessingTypeRedact, ProcessingTypeTranscode:
+		return format == OutputFormatText
+	case ProcessingTypeTextStats, ProcessingTypePIIReport, ProcessingTypeLanguage:
+		return format == OutputFormatJSON
+	case ProcessingTypeChunk:
+		return format == OutputFormatJSONL
+	default:
+		// Plugins return opaque bytes that are served as text
+		_, isPlugin := p.PluginName()
+		return isPlugin && format == OutputFormatText
+	}
+}
@@ -0,0 +1,378 @@
+package database
+
+import (
+	"fmt"
+	"net/mail"
+	"slices"
+	"strings"
+)
+
+// NotifyEmailParam is accepted by every processing type: the address is emailed when the job
+// succeeds or fails.
+const NotifyEmailParam = "notify_email"
+
+// NotifyEmailFrom returns the notify_email parameter of a job, or "" when it is not set. The
+// parameter must be a bare address such as user@example.com, without display name.
+func NotifyEmailFrom(params map[string]any) (string, error) {
+	raw, ok := params[NotifyEmailParam]
+	if !ok {
+		return "", nil
+	}
+
+	address, _ := raw.(string)
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return "", fmt.Errorf("'%s' parameter must be an email address", NotifyEmailParam)
+	}
+	return address, nil
+}
+
+// ResultSinksParam is accepted by every processing type: the result of a succeeded job is delivered
+// to the result sinks it lists.
+const ResultSinksParam = "sinks"
+
+// ResultSinksFrom returns the sinks parameter of a job without duplicates. The values were checked
+// against the schema when the job was submitted.
+func ResultSinksFrom(params map[string]any) []string {
+	raw, _ := params[ResultSinksParam].([]any)
+
+	var sinks []string
+	for _, value := range raw {
+		if sink, ok := value.(string); ok && !slices.Contains(sinks, sink) {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+// Fault injection parameters are accepted by every processing type, to exercise retries, the failed
+// queue and alerts in test environments: workers with fault injection enabled fail every attempt
+// of the job with fail_probability at fail_stage, and other workers ignore them.
+const (
+	FailProbabilityParam = "fail_probability"
+	FailStageParam       = "fail_stage"
+
+	FailStageRead    = "read"
+	FailStageProcess = "process"
+	FailStageWrite   = "write"
+
+	DefaultFailStage = FailStageProcess
+)
+
+// FailStages returns the stages a fault can be injected at, in processing order.
+func FailStages() []string {
+	return []string{FailStageRead, FailStageProcess, FailStageWrite}
+}
+
+// FaultParams are the fault injection parameters of a job.
+type FaultParams struct {
+	// Probability is the chance of an attempt failing, from 0 to 1; zero injects no faults.
+	Probability float64
+	Stage       string
+}
+
+// FaultParamsFrom returns the fault injection parameters of a job.
+func FaultParamsFrom(params map[string]any) (FaultParams, error) {
+	fault := FaultParams{Stage: DefaultFailStage}
+
+	if raw, ok := params[FailProbabilityParam]; ok {
+		probability, ok := raw.(float64)
+		if !ok || probability < 0 || probability > 1 {
+			return FaultParams{}, fmt.Errorf("'%s' parameter must be a number between 0 and 1", FailProbabilityParam)
+		}
+		fault.Probability = probability
+	}
+
+	if raw, ok := params[FailStageParam]; ok {
+		stage, _ := raw.(string)
+		if !slices.Contains(FailStages(), stage) {
+			return FaultParams{}, fmt.Errorf("'%s' parameter must be one of: %s", FailStageParam, strings.Join(FailStages(), ", "))
+		}
+		fault.Stage = stage
+	}
+
+	return fault, nil
+}
+
+// Parameters of the textstats processing type.
+const (
+	TextStatsTopNParam  = "top_n"
+	TextStatsNgramParam = "ngram"
+
+	DefaultTextStatsTopN  = 10
+	DefaultTextStatsNgram = 2
+	MaxTextStatsTopN      = 1000
+	MaxTextStatsNgram     = 5
+)
+
+// Parameters of the chunk processing type.
+const (
+	ChunkByParam      = "chunk_by"
+	ChunkSizeParam    = "chunk_size"
+	ChunkOverlapParam = "overlap"
+
+	ChunkByTokens     = "tokens"
+	ChunkByCharacters = "characters"
+
+	DefaultChunkSize = 512
+	MaxChunkSize     = 100000
+)
+
+// ChunkParams holds the validated parameters of a chunk job.
+type ChunkParams struct {
+	By      string
+	Size    int
+	Overlap int
+}
+
+// ChunkParamsFrom returns the chunk_by, chunk_size and overlap parameters of a chunk job.
+// Chunks default to 512 approximate tokens without overlap; overlap must be smaller than the chunk size.
+func ChunkParamsFrom(params map[string]any) (ChunkParams, error) {
+	result := ChunkParams{By: ChunkByTokens}
+
+	if raw, ok := params[ChunkByParam]; ok {
+		by, _ := raw.(string)
+		if by != ChunkByTokens && by != ChunkByCharacters {
+			return ChunkParams{}, fmt.Errorf("'%s' parameter must be one of: %s",
+				ChunkByParam, strings.Join([]string{ChunkByTokens, ChunkByCharacters}, ", "))
+		}
+		result.By = by
+	}
+
+	size, err := intParam(params, ChunkSizeParam, DefaultChunkSize, 1, MaxChunkSize)
+	if err != nil {
+		return ChunkParams{}, err
+	}
+	result.Size = size
+
+	overlap, err := intParam(params, ChunkOverlapParam, 0, 0, size-1)
+	if err != nil {
+		return ChunkParams{}, err
+	}
+	result.Overlap = overlap
+
+	return result, nil
+}
+
+// Parameters of the redact and pii_report processing types.
+const (
+	PIIDetectParam   = "detect"
+	PIIPatternsParam = "patterns"
+	PIIMaskParam     = "mask"
+	PIIKeepLastParam = "keep_last"
+
+	PIIKindEmail      = "email"
+	PIIKindPhone      = "phone"
+	PIIKindCreditCard = "credit_card"
+	// PIIKindCustom is the kind of matches of the patterns parameter.
+	PIIKindCustom = "custom"
+
+	// PIIMaskKindPlaceholder is replaced by the kind of the redacted match in the mask.
+	PIIMaskKindPlaceholder = "{kind}"
+	DefaultPIIMask         = "[REDACTED:" + PIIMaskKindPlaceholder + "]"
+	MaxPIIPatterns         = 20
+	MaxPIIKeepLast         = 4
+)
+
+// PIIKinds returns the kinds of PII detected without custom patterns.
+func PIIKinds() []string {
+	return []string{PIIKindEmail, PIIKindPhone, PIIKindCreditCard}
+}
+
+// PIIParams holds the validated parameters of a redact or pii_report job.
+type PIIParams struct {
+	// Detect lists the built-in kinds to detect.
+	Detect []string
+	// Patterns are custom regular expressions in RE2 syntax, detected as PIIKindCustom.
+	Patterns []string
+	// Mask replaces redacted matches, with PIIMaskKindPlaceholder replaced by their kind.
+	Mask string
+	// KeepLast is how many trailing characters of a redacted match are kept after the mask.
+	KeepLast int
+}
+
+// PIIParamsFrom returns the detect, patterns, mask and keep_last parameters of a redact or
+// pii_report job. Every built-in kind is detected by default; an empty detect list together with
+// patterns detects only the patterns.
+func PIIParamsFrom(params map[string]any) (PIIParams, error) {
+	result := PIIParams{Detect: PIIKinds(), Mask: DefaultPIIMask}
+
+	if raw, ok := params[PIIDetectParam]; ok {
+		kinds, err := stringsParam(raw, PIIDetectParam, len(PIIKinds()))
+		if err != nil {
+			return PIIParams{}, err
+		}
+		for _, kind := range kinds {
+			if !slices.Contains(PIIKinds(), kind) {
+				return PIIParams{}, fmt.Errorf("'%s' parameter must only list: %s", PIIDetectParam, strings.Join(PIIKinds(), ", "))
+			}
+		}
+		result.Detect = kinds
+	}
+
+	if raw, ok := params[PIIPatternsParam]; ok {
+		patterns, err := stringsParam(raw, PIIPatternsParam, MaxPIIPatterns)
+		if err != nil {
+			return PIIParams{}, err
+		}
+		result.Patterns = patterns
+	}
+
+	if len(result.Detect) == 0 && len(result.Patterns) == 0 {
+		return PIIParams{}, fmt.Errorf("'%s' or '%s' parameter must name something to detect", PIIDetectParam, PIIPatternsParam)
+	}
+
+	if raw, ok := params[PIIMaskParam]; ok {
+		mask, _ := raw.(string)
+		result.Mask = mask
+	}
+
+	keepLast, err := intParam(params, PIIKeepLastParam, 0, 0, MaxPIIKeepLast)
+	if err != nil {
+		return PIIParams{}, err
+	}
+	result.KeepLast = keepLast
+
+	return result, nil
+}
+
+// stringsParam reads an array parameter of at most maxItems strings.
+func stringsParam(raw any, name string, maxItems int) ([]string, error) {
+	values, ok := raw.([]any)
+	if !ok || len(values) > maxItems {
+		return nil, fmt.Errorf("'%s' parameter must be an array of at most %d strings", name, maxItems)
+	}
+
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("'%s' parameter must be an array of strings", name)
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// Parameters of the detect_language processing type.
+const (
+	LanguageTopParam = "top"
+
+	DefaultLanguageTop = 3
+	MaxLanguageTop     = 10
+)
+
+// LanguageTopFrom returns the top parameter of a detect_language job, how many of the most
+// probable languages are reported.
+func LanguageTopFrom(params map[string]any) (int, error) {
+	return intParam(params, LanguageTopParam, DefaultLanguageTop, 1, MaxLanguageTop)
+}
+
+// Parameters of the transcode processing type. Encodings are named by their WHATWG or IANA labels,
+// e.g. utf-8, utf-16le, windows-1252, iso-8859-1 or shift_jis.
+const (
+	TranscodeFromParam = "from"
+	TranscodeToParam   = "to"
+
+	DefaultTranscodeTo = "utf-8"
+)
+
+// TranscodeParamsFrom returns the from and to encodings of a transcode job; to defaults to UTF-8.
+// Whether the encodings are supported is decided where they are looked up.
+func TranscodeParamsFrom(params map[string]any) (string, string, error) {
+	from, _ := params[TranscodeFromParam].(string)
+	if from == "" {
+		return "", "", fmt.Errorf("transcode operation requires '%s' parameter", TranscodeFromParam)
+	}
+
+	to := DefaultTranscodeTo
+	if raw, ok := params[TranscodeToParam]; ok {
+		to, _ = raw.(string)
+		if to == "" {
+			return "", "", fmt.Errorf("'%s' parameter must name an encoding", TranscodeToParam)
+		}
+	}
+	return from, to, nil
+}
+
+// Parameters of the exec processing type.
+const (
+	ExecCommandParam = "command"
+	ExecArgsParam    = "args"
+
+	MaxExecArgs = 32
+)
+
+// ExecParams holds the command name and arguments of an exec job. Whether the command is
+// allowed is decided by the worker, which owns the allowlist.
+type ExecParams struct {
+	Command string
+	Args    []string
+}
+
+// ExecParamsFrom returns the command and args parameters of an exec job.
+func ExecParamsFrom(params map[string]any) (ExecParams, error) {
+	command, _ := params[ExecCommandParam].(string)
+	if command == "" {
+		return ExecParams{}, fmt.Errorf("exec operation requires '%s' parameter", ExecCommandParam)
+	}
+	if strings.ContainsRune(command, '/') {
+		return ExecParams{}, fmt.Errorf("'%s' parameter must be a command name, not a path", ExecCommandParam)
+	}
+
+	result := ExecParams{Command: command}
+
+	raw, ok := params[ExecArgsParam]
+	if !ok {
+		return result, nil
+	}
+
+	args, ok := raw.([]any)
+	if !ok || len(args) > MaxExecArgs {
+		return ExecParams{}, fmt.Errorf("'%s' parameter must be an array of at most %d strings", ExecArgsParam, MaxExecArgs)
+	}
+	for _, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			return ExecParams{}, fmt.Errorf("'%s' parameter must be an array of strings", ExecArgsParam)
+		}
+		result.Args = append(result.Args, s)
+	}
+
+	return result, nil
+}
+
+// TextStatsParams returns the top_n and ngram parameters of a textstats job, applying defaults
+// for missing values and rejecting anything that is not an integer within range.
+func TextStatsParams(params map[string]any) (int, int, error) {
+	topN, err := intParam(params, TextStatsTopNParam, DefaultTextStatsTopN, 1, MaxTextStatsTopN)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ngram, err := intParam(params, TextStatsNgramParam, DefaultTextStatsNgram, 1, MaxTextStatsNgram)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return topN, ngram, nil
+}
+
+// intParam reads an integer parameter. Parameters are decoded from JSON, so numbers arrive as float64.
+func intParam(params map[string]any, name string, defaultValue, minValue, maxValue int) (int, error) {
+	raw, ok := params[name]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	number, ok := raw.(float64)
+	if !ok || number != float64(int(number)) {
+		return 0, fmt.Errorf("'%s' parameter must be an integer", name)
+	}
+
+	value := int(number)
+	if value < minValue || value > maxValue {
+		return 0, fmt.Errorf("'%s' parameter must be between %d and %d", name, minValue, maxValue)
+	}
+	return value, nil
+}
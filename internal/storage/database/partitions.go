@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// partitionLockID keys the Postgres advisory lock API replicas take turns maintaining the jobs
+	// partitions under.
+	partitionLockID = 4_209_117_326
+	// partitionNameLayout names the monthly jobs partitions, e.g. jobs_y2026m10.
+	partitionNameLayout = "jobs_y2006m01"
+)
+
+// PartitionChanges are the monthly jobs partitions a maintenance run created and dropped.
+type PartitionChanges struct {
+	Created []string
+	Dropped []string
+}
+
+// MaintainPartitions creates the monthly jobs partitions from the month of now up to ahead months
+// later and, with a positive retention, drops the partitions whose month ended before now minus
+// retention, together with their jobs. Replicas take turns under an advisory lock; a replica that
+// finds it held skips the run.
+func (r *Repository) MaintainPartitions(ctx context.Context, now time.Time, ahead int, retention time.Duration) (PartitionChanges, error) {
+	var changes PartitionChanges
+
+	// Session-level advisory locks belong to a connection, so the run holds one throughout
+	conn, err := r.db.Connx(ctx)
+	if err != nil {
+		return changes, fmt.Errorf("open partition maintenance connection: %w", err)
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.GetContext(ctx, &locked, "SELECT pg_try_advisory_lock($1)", partitionLockID); err != nil {
+		return changes, fmt.Errorf("acquire partition maintenance lock: %w", err)
+	}
+	if !locked {
+		r.log.DebugContext(ctx, "partition maintenance running on another replica")
+		return changes, nil
+	}
+	defer func() {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", partitionLockID); err != nil {
+			r.log.WarnContext(ctx, "failed to release partition maintenance lock", "error", err)
+		}
+	}()
+
+	var names []string
+	if err := conn.SelectContext(ctx, &names,
+		"SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid WHERE i.inhparent = 'jobs'::regclass",
+	); err != nil {
+		return changes, fmt.Errorf("list job partitions: %w", err)
+	}
+
+	existing := make(map[string]time.Time, len(names))
+	for _, name := range names {
+		// The default partition and partitions created by hand are left alone
+		if start, err := time.Parse(partitionNameLayout, name); err == nil {
+			existing[name] = start
+		}
+	}
+
+	// A partition that fails, e.g. because the default partition already holds jobs of its month,
+	// does not keep the others from being maintained
+	var errs []error
+
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := range ahead + 1 {
+		start := month.AddDate(0, i, 0)
+		name := start.Format(partitionNameLayout)
+		if _, ok := existing[name]; ok {
+			continue
+		}
+
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF jobs FOR VALUES FROM ('%s') TO ('%s')",
+			name, start.Format(time.DateOnly), start.AddDate(0, 1, 0).Format(time.DateOnly))); err != nil {
+			errs = append(errs, fmt.Errorf("create partition %s: %w", name, err))
+			continue
+		}
+		changes.Created = append(changes.Created, name)
+	}
+
+	if retention > 0 {
+		cutoff := now.Add(-retention)
+		for name, start := range existing {
+			end := start.AddDate(0, 1, 0)
+			if end.After(cutoff) {
+				continue
+			}
+
+			if err := dropPartition(ctx, conn, name, start, end); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			changes.Dropped = append(changes.Dropped, name)
+		}
+	}
+
+	return changes, errors.Join(errs...)
+}
+
+// dropPartition drops the jobs partition of the month from start to end. Dropping a partition fires
+// no row triggers, so the IDs and status counts of its jobs are released in the same transaction.
+func dropPartition(ctx context.Context, conn *sqlx.Conn, name string, start, end time.Time) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin dropping partition %s: %w", name, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// #nosec G201 -- name is a partition name in partitionNameLayout
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(
+		"UPDATE job_status_counts c SET count = c.count - d.n FROM (SELECT status, COUNT(*) AS n FROM %s GROUP BY status) d WHERE c.status = d.status",
+		name)); err != nil {
+		return fmt.Errorf("release status counts of partition %s: %w", name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM job_ids WHERE created_at >= $1 AND created_at < $2", start, end); err != nil {
+		return fmt.Errorf("release job IDs of partition %s: %w", name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+name); err != nil {
+		return fmt.Errorf("drop partition %s: %w", name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit dropping partition %s: %w", name, err)
+	}
+	return nil
+}
+
+// byJobID matches the job with the given ID. Its creation time, looked up in job_ids, lets Postgres
+// prune the query to the partition holding the job instead of probing every partition.
+func byJobID(id uuid.UUID) squirrel.Sqlizer {
+	return squirrel.And{
+		squirrel.Eq{"id": id},
+		squirrel.Expr("created_at = (SELECT created_at FROM job_ids WHERE job_ids.id = ?)", id),
+	}
+}
@@ -6,14 +6,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 	"github.com/rsav/k8s-learning/internal/config"
 )
 
 type Repository struct {
-	db *sqlx.DB
+	db       *sqlx.DB
+	password atomic.Pointer[string]
+	maxIdle  int
+	log      *slog.Logger
 }
 
 // JSONB handles PostgreSQL JSONB columns by implementing sql.Scanner and driver.Valuer.
@@ -24,8 +30,25 @@ func NewRepository(conf config.Database, log *slog.Logger) (*Repository, error)
 
 	log.InfoContext(ctx, "connecting to PostgreSQL database", "host", conf.Host, "port", conf.Port, "database", conf.Database)
 
-	db, err := sqlx.Connect("pgx", conf.ConnectionString())
+	connConfig, err := pgx.ParseConfig(conf.ConnectionString())
 	if err != nil {
+		return nil, fmt.Errorf("parse connection string: %w", err)
+	}
+
+	repo := &Repository{
+		maxIdle: conf.MaxIdle,
+		log:     log,
+	}
+	repo.password.Store(&conf.Password)
+
+	// New connections always authenticate with the latest password so rotation needs no restart
+	db := sqlx.NewDb(stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(_ context.Context, cc *pgx.ConnConfig) error {
+		cc.Password = *repo.password.Load()
+		return nil
+	})), "pgx")
+
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("connect to database: %w", err)
 	}
 
@@ -35,9 +58,25 @@ func NewRepository(conf config.Database, log *slog.Logger) (*Repository, error)
 
 	log.DebugContext(ctx, "connection pool configured", "max_conns", conf.MaxConns, "max_idle", conf.MaxIdle)
 
-	return &Repository{
-		db: db,
-	}, nil
+	repo.db = db
+	return repo, nil
+}
+
+// RotatePassword switches to a new database password and refreshes the connection pool.
+// Idle connections are closed right away; connections in use are replaced as they expire.
+func (r *Repository) RotatePassword(password string) {
+	ctx := context.Background()
+
+	r.password.Store(&password)
+	r.db.SetMaxIdleConns(0)
+	r.db.SetMaxIdleConns(r.maxIdle)
+
+	if err := r.HealthCheck(ctx); err != nil {
+		r.log.ErrorContext(ctx, "database unreachable after password rotation", "error", err)
+		return
+	}
+
+	r.log.InfoContext(ctx, "database connection pool refreshed after password rotation")
 }
 
 func (r *Repository) Close() error {
@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// JobResult is one version of the result of a job, written by one processing attempt.
+type JobResult struct {
+	JobID      uuid.UUID `json:"job_id" db:"job_id"`
+	Version    int       `json:"version" db:"version"`
+	ResultPath string    `json:"result_path" db:"result_path"`
+	Shared     bool      `json:"shared" db:"result_shared"`
+	WorkerID   string    `json:"worker_id,omitempty" db:"worker_id"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// ResultVersion is the result a processing attempt completes a job with.
+type ResultVersion struct {
+	// Version is the attempt that wrote the result, as numbered by StartAttempt.
+	Version int
+	Path    string
+	// Shared results link the bytes of the input rather than duplicating them, so releasing them
+	// frees no storage quota.
+	Shared bool
+	// Replace drops the other versions of the job, whose file the result overwrote.
+	Replace bool
+}
+
+// StartAttempt counts a processing attempt of a job and returns its 1-based number, which numbers
+// the result version the attempt writes. Attempts are counted across redeliveries and retries.
+func (r *Repository) StartAttempt(ctx context.Context, id uuid.UUID) (int, error) {
+	sqlQuery, args, err := psql.Update("jobs").
+		Set("attempts", squirrel.Expr("attempts + 1")).
+		Where(byJobID(id)).
+		Suffix("RETURNING attempts").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build query: %w", err)
+	}
+
+	var attempt int
+	if err := r.db.GetContext(ctx, &attempt, sqlQuery, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("job not found: %s", id)
+		}
+		return 0, fmt.Errorf("start job attempt: %w", err)
+	}
+
+	return attempt, nil
+}
+
+// UpdateResult completes a job with a result version, which becomes its canonical result. Earlier
+// versions stay listed unless the result replaces them.
+func (r *Repository) UpdateResult(ctx context.Context, id uuid.UUID, result ResultVersion) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin update result: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	sqlQuery, args, err := psql.Update("jobs").
+		Set("result_path", result.Path).
+		Set("result_shared", result.Shared).
+		Set("status", JobStatusSucceeded).
+		Set("completed_at", time.Now()).
+		Where(byJobID(id)).
+		Suffix("RETURNING COALESCE(worker_id, '')").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	var workerID string
+	if err := tx.GetContext(ctx, &workerID, sqlQuery, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("job not found: %s", id)
+		}
+		return fmt.Errorf("update job result: %w", err)
+	}
+
+	if result.Replace {
+		sqlQuery, args, err = psql.Delete("job_results").
+			Where(squirrel.Eq{"job_id": id}).
+			Where(squirrel.NotEq{"version": result.Version}).
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("build query: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, sqlQuery, args...); err != nil {
+			return fmt.Errorf("replace job results: %w", err)
+		}
+	}
+
+	sqlQuery, args, err = psql.Insert("job_results").
+		Columns("job_id", "version", "result_path", "result_shared", "worker_id").
+		Values(id, result.Version, result.Path, result.Shared, nullIfEmpty(workerID)).
+		Suffix("ON CONFLICT (job_id, version) DO UPDATE SET " +
+			"result_path = EXCLUDED.result_path, result_shared = EXCLUDED.result_shared, " +
+			"worker_id = EXCLUDED.worker_id, created_at = NOW()").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, sqlQuery, args...); err != nil {
+		return fmt.Errorf("record job result: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit update result: %w", err)
+	}
+	return nil
+}
+
+// GetJobResults returns the result versions of a job, oldest first.
+func (r *Repository) GetJobResults(ctx context.Context, id uuid.UUID) ([]JobResult, error) {
+	sqlQuery, args, err := psql.Select("job_id", "version", "result_path", "result_shared",
+		"COALESCE(worker_id, '') AS worker_id", "created_at").
+		From("job_results").
+		Where(squirrel.Eq{"job_id": id}).
+		OrderBy("version").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var results []JobResult
+	if err := r.db.SelectContext(ctx, &results, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("get job results: %w", err)
+	}
+
+	return results, nil
+}
+
+// previousResult is a result version that is no longer the canonical result of its job.
+type previousResult struct {
+	TenantID     string `db:"tenant_id"`
+	ResultPath   string `db:"result_path"`
+	ResultShared bool   `db:"result_shared"`
+}
+
+// previousResults returns the earlier result versions among paths, only of jobs of statuses unless
+// it is empty. Canonical results are referenced by their jobs already.
+func (r *Repository) previousResults(ctx context.Context, paths []string, statuses []JobStatus) ([]previousResult, error) {
+	query := psql.Select("j.tenant_id", "r.result_path", "r.result_shared").
+		From("job_results r").
+		Join("jobs j ON j.id = r.job_id").
+		Where(squirrel.Eq{"r.result_path": paths}).
+		Where("r.result_path <> COALESCE(j.result_path, '')")
+	if len(statuses) > 0 {
+		query = query.Where(squirrel.Eq{"j.status": statuses})
+	}
+
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var results []previousResult
+	if err := r.db.SelectContext(ctx, &results, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("resolve previous results: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,270 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// releaseBatchSize bounds the number of paths resolved per query; each path is bound three times.
+const releaseBatchSize = 1000
+
+// ErrStorageQuotaExceeded is returned by ReserveStorage when the upload would exceed the tenant quota.
+var ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+
+// StorageUsage is the storage a tenant currently occupies with uploaded inputs and result files.
+type StorageUsage struct {
+	TenantID    string    `json:"tenant_id" db:"tenant_id"`
+	UploadBytes int64     `json:"upload_bytes" db:"upload_bytes"`
+	ResultBytes int64     `json:"result_bytes" db:"result_bytes"`
+	Files       int64     `json:"files" db:"files"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// TotalBytes is the storage counted against the tenant quota.
+func (s StorageUsage) TotalBytes() int64 {
+	return s.UploadBytes + s.ResultBytes
+}
+
+// StorageDelta is a change of a tenant's storage usage; negative values release storage.
+type StorageDelta struct {
+	UploadBytes int64
+	ResultBytes int64
+	Files       int64
+}
+
+// ReserveStorage adds uploaded bytes to the tenant's usage unless that would exceed quota, in which
+// case it returns ErrStorageQuotaExceeded and leaves the usage unchanged. A quota of zero disables the check.
+func (r *Repository) ReserveStorage(ctx context.Context, tenantID string, delta StorageDelta, quota int64) error {
+	if quota > 0 && delta.UploadBytes+delta.ResultBytes > quota {
+		return ErrStorageQuotaExceeded
+	}
+
+	query := upsertStorageUsage(tenantID, delta)
+	if quota > 0 {
+		// The check and the increment are a single statement, so concurrent uploads cannot overshoot
+		query = query.Suffix("WHERE storage_usage.upload_bytes + storage_usage.result_bytes + ? <= ?",
+			delta.UploadBytes+delta.ResultBytes, quota)
+	}
+
+	sqlQuery, args, err := query.Suffix("RETURNING tenant_id").ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	var reserved string
+	err = r.db.GetContext(ctx, &reserved, sqlQuery, args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrStorageQuotaExceeded
+	}
+	if err != nil {
+		return fmt.Errorf("reserve storage: %w", err)
+	}
+
+	return nil
+}
+
+// AddStorageUsage applies delta to the tenant's usage without a quota check. Usage never drops below zero.
+func (r *Repository) AddStorageUsage(ctx context.Context, tenantID string, delta StorageDelta) error {
+	sqlQuery, args, err := upsertStorageUsage(tenantID, delta).ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, sqlQuery, args...); err != nil {
+		return fmt.Errorf("add storage usage: %w", err)
+	}
+
+	return nil
+}
+
+func upsertStorageUsage(tenantID string, delta StorageDelta) squirrel.InsertBuilder {
+	return psql.Insert("storage_usage").
+		Columns("tenant_id", "upload_bytes", "result_bytes", "files").
+		Values(tenantID, max(delta.UploadBytes, 0), max(delta.ResultBytes, 0), max(delta.Files, 0)).
+		Suffix("ON CONFLICT (tenant_id) DO UPDATE SET "+
+			"upload_bytes = GREATEST(storage_usage.upload_bytes + ?, 0), "+
+			"result_bytes = GREATEST(storage_usage.result_bytes + ?, 0), "+
+			"files = GREATEST(storage_usage.files + ?, 0), "+
+			"updated_at = NOW()",
+			delta.UploadBytes, delta.ResultBytes, delta.Files)
+}
+
+// ReleaseStorage subtracts removed files, given as path to size, from the usage of the tenants whose
+// jobs reference them. Files not referenced by any job were never counted and are ignored.
+func (r *Repository) ReleaseStorage(ctx context.Context, files map[string]int64) error {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+
+	deltas := make(map[string]StorageDelta)
+	for start := 0; start < len(paths); start += releaseBatchSize {
+		batch := paths[start:min(start+releaseBatchSize, len(paths))]
+		if err := r.resolveStorageDeltas(ctx, batch, files, deltas); err != nil {
+			return err
+		}
+	}
+
+	for tenantID, delta := range deltas {
+		if err := r.AddStorageUsage(ctx, tenantID, delta); err != nil {
+			return fmt.Errorf("release storage of tenant %s: %w", tenantID, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveStorageDeltas accumulates into deltas the negative usage of the jobs referencing paths,
+// as inputs, canonical results or earlier result versions.
+func (r *Repository) resolveStorageDeltas(ctx context.Context, paths []string, sizes map[string]int64, deltas map[string]StorageDelta) error {
+	sqlQuery, args, err := psql.Select("tenant_id", "file_path",
+		"COALESCE(second_file_path, '') AS second_file_path", "COALESCE(result_path, '') AS result_path",
+		"result_shared").
+		From("jobs").
+		Where(squirrel.Or{
+			squirrel.Eq{"file_path": paths},
+			squirrel.Eq{"second_file_path": paths},
+			squirrel.Eq{"result_path": paths},
+		}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	var refs []struct {
+		TenantID       string `db:"tenant_id"`
+		FilePath       string `db:"file_path"`
+		SecondFilePath string `db:"second_file_path"`
+		ResultPath     string `db:"result_path"`
+		ResultShared   bool   `db:"result_shared"`
+	}
+	if err := r.db.SelectContext(ctx, &refs, sqlQuery, args...); err != nil {
+		return fmt.Errorf("resolve removed files: %w", err)
+	}
+
+	for _, ref := range refs {
+		delta := deltas[ref.TenantID]
+		for _, path := range []string{ref.FilePath, ref.SecondFilePath} {
+			if size, ok := sizes[path]; ok && path != "" {
+				delta.UploadBytes -= size
+				delta.Files--
+			}
+		}
+		if size, ok := sizes[ref.ResultPath]; ok && ref.ResultPath != "" {
+			// Shared results never added their bytes, which are released with the input
+			if !ref.ResultShared {
+				delta.ResultBytes -= size
+			}
+			delta.Files--
+		}
+		deltas[ref.TenantID] = delta
+	}
+
+	previous, err := r.previousResults(ctx, paths, nil)
+	if err != nil {
+		return err
+	}
+	for _, result := range previous {
+		if size, ok := sizes[result.ResultPath]; ok {
+			delta := deltas[result.TenantID]
+			if !result.ResultShared {
+				delta.ResultBytes -= size
+			}
+			delta.Files--
+			deltas[result.TenantID] = delta
+		}
+	}
+
+	return nil
+}
+
+// ReferencedFiles returns which of paths a job references as its input or result file, of any
+// version.
+func (r *Repository) ReferencedFiles(ctx context.Context, paths []string) (map[string]bool, error) {
+	return r.referencedFiles(ctx, paths, nil)
+}
+
+// ActiveFiles returns which of paths a pending or running job references, which must not be removed.
+func (r *Repository) ActiveFiles(ctx context.Context, paths []string) (map[string]bool, error) {
+	return r.referencedFiles(ctx, paths, []JobStatus{JobStatusPending, JobStatusRunning})
+}
+
+// referencedFiles returns which of paths a job references, only counting jobs of statuses unless
+// it is empty.
+func (r *Repository) referencedFiles(ctx context.Context, paths []string, statuses []JobStatus) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for start := 0; start < len(paths); start += releaseBatchSize {
+		batch := paths[start:min(start+releaseBatchSize, len(paths))]
+
+		query := psql.Select("file_path",
+			"COALESCE(second_file_path, '') AS second_file_path", "COALESCE(result_path, '') AS result_path").
+			From("jobs").
+			Where(squirrel.Or{
+				squirrel.Eq{"file_path": batch},
+				squirrel.Eq{"second_file_path": batch},
+				squirrel.Eq{"result_path": batch},
+			})
+		if len(statuses) > 0 {
+			query = query.Where(squirrel.Eq{"status": statuses})
+		}
+
+		sqlQuery, args, err := query.ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("build query: %w", err)
+		}
+
+		var refs []struct {
+			FilePath       string `db:"file_path"`
+			SecondFilePath string `db:"second_file_path"`
+			ResultPath     string `db:"result_path"`
+		}
+		if err := r.db.SelectContext(ctx, &refs, sqlQuery, args...); err != nil {
+			return nil, fmt.Errorf("resolve referenced files: %w", err)
+		}
+
+		for _, ref := range refs {
+			for _, path := range []string{ref.FilePath, ref.SecondFilePath, ref.ResultPath} {
+				if path != "" {
+					referenced[path] = true
+				}
+			}
+		}
+
+		previous, err := r.previousResults(ctx, batch, statuses)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range previous {
+			referenced[result.ResultPath] = true
+		}
+	}
+
+	return referenced, nil
+}
+
+// GetStorageUsage returns the storage usage of tenantID, or of every tenant when tenantID is empty.
+func (r *Repository) GetStorageUsage(ctx context.Context, tenantID string) ([]StorageUsage, error) {
+	query := psql.Select("tenant_id", "upload_bytes", "result_bytes", "files", "updated_at").
+		From("storage_usage").
+		OrderBy("tenant_id")
+	if tenantID != "" {
+		query = query.Where(squirrel.Eq{"tenant_id": tenantID})
+	}
+
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var usage []StorageUsage
+	if err := r.db.SelectContext(ctx, &usage, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("get storage usage: %w", err)
+	}
+
+	return usage, nil
+}
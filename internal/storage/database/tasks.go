@@ -0,0 +1,331 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// TaskStatus is the lifecycle stage of an admin task.
+type TaskStatus string
+
+const (
+	TaskStatusPending   TaskStatus = "pending"
+	TaskStatusRunning   TaskStatus = "running"
+	TaskStatusSucceeded TaskStatus = "succeeded"
+	TaskStatusFailed    TaskStatus = "failed"
+	TaskStatusCanceled  TaskStatus = "canceled"
+)
+
+//nolint:gochecknoglobals // taskStatuses is a map of all valid task statuses.
+var taskStatuses = map[string]TaskStatus{
+	string(TaskStatusPending):   TaskStatusPending,
+	string(TaskStatusRunning):   TaskStatusRunning,
+	string(TaskStatusSucceeded): TaskStatusSucceeded,
+	string(TaskStatusFailed):    TaskStatusFailed,
+	string(TaskStatusCanceled):  TaskStatusCanceled,
+}
+
+func ToTaskStatus(status string) (TaskStatus, bool) {
+	taskStatus, ok := taskStatuses[status]
+	return taskStatus, ok
+}
+
+var (
+	// ErrAdminTaskNotPending is returned by ClaimAdminTask when the task was claimed by another
+	// replica, canceled or finished since it was queued.
+	ErrAdminTaskNotPending = errors.New("admin task is not pending")
+	// ErrAdminTaskLost is returned when a runner records the progress or outcome of a task it no
+	// longer runs, because it was queued again for another replica.
+	ErrAdminTaskLost = errors.New("admin task is no longer run by this replica")
+	// ErrAdminTaskFinished is returned by CancelAdminTask for tasks that already finished.
+	ErrAdminTaskFinished = errors.New("admin task already finished")
+)
+
+// AdminTask is a long-running admin operation run in the background by one of the API replicas,
+// RunnerID. Total is how many items it found to process, zero while unknown, of which Processed are
+// done so far, Succeeded or Failed. Result holds what the task produced once it finished.
+type AdminTask struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Kind            string     `json:"kind" db:"kind"`
+	Status          TaskStatus `json:"status" db:"status"`
+	Params          JSONB      `json:"params" db:"params"`
+	Total           int64      `json:"total" db:"total"`
+	Processed       int64      `json:"processed" db:"processed"`
+	Succeeded       int64      `json:"succeeded" db:"succeeded"`
+	Failed          int64      `json:"failed" db:"failed"`
+	Result          JSONB      `json:"result,omitempty" db:"result"`
+	ErrorMessage    string     `json:"error_message,omitempty" db:"error_message"`
+	RunnerID        string     `json:"runner_id,omitempty" db:"runner_id"`
+	CancelRequested bool       `json:"cancel_requested" db:"cancel_requested"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty" db:"started_at"`
+	CompletedAt     *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	UpdatedAt       time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// TaskProgress is the progress of a running admin task.
+type TaskProgress struct {
+	Total     int64
+	Processed int64
+	Succeeded int64
+	Failed    int64
+}
+
+// TaskOutcome is how an admin task finished: Status is succeeded, failed with ErrorMessage or
+// canceled.
+type TaskOutcome struct {
+	Status       TaskStatus
+	Progress     TaskProgress
+	Result       JSONB
+	ErrorMessage string
+}
+
+// AdminTaskFilter selects admin tasks by status and kind, newest first.
+type AdminTaskFilter struct {
+	Status TaskStatus
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+//nolint:gochecknoglobals // adminTaskColumns is a read-only slice
+var adminTaskColumns = []string{
+	"id", "kind", "status", "params", "total", "processed", "succeeded", "failed", "result",
+	"COALESCE(error_message, '') AS error_message", "COALESCE(runner_id, '') AS runner_id", "cancel_requested",
+	"created_at", "started_at", "completed_at", "updated_at",
+}
+
+// CreateAdminTask records a new pending admin task.
+func (r *Repository) CreateAdminTask(ctx context.Context, task *AdminTask) error {
+	sqlQuery, args, err := psql.Insert("admin_tasks").
+		Columns("id", "kind", "status", "params", "created_at", "updated_at").
+		Values(task.ID, task.Kind, TaskStatusPending, task.Params, task.CreatedAt, task.CreatedAt).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, sqlQuery, args...); err != nil {
+		return fmt.Errorf("create admin task: %w", err)
+	}
+	task.Status = TaskStatusPending
+	return nil
+}
+
+// ClaimAdminTask marks a pending admin task as run by runnerID and returns it. A task run before,
+// by a replica that stopped, starts over with its progress reset.
+func (r *Repository) ClaimAdminTask(ctx context.Context, id uuid.UUID, runnerID string) (*AdminTask, error) {
+	query := psql.Update("admin_tasks").
+		SetMap(progressColumns(TaskProgress{})).
+		Set("status", TaskStatusRunning).
+		Set("runner_id", runnerID).
+		Set("started_at", squirrel.Expr("NOW()")).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": id, "status": TaskStatusPending})
+
+	task, err := r.returnAdminTask(ctx, query)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("claim admin task %s: %w", id, ErrAdminTaskNotPending)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim admin task: %w", err)
+	}
+	return task, nil
+}
+
+// UpdateAdminTaskProgress records the progress of an admin task run by runnerID, which also shows
+// the replica is still running it, and returns whether the task was asked to stop.
+func (r *Repository) UpdateAdminTaskProgress(ctx context.Context, id uuid.UUID, runnerID string, progress TaskProgress) (bool, error) {
+	sqlQuery, args, err := psql.Update("admin_tasks").
+		SetMap(progressColumns(progress)).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": id, "status": TaskStatusRunning, "runner_id": runnerID}).
+		Suffix("RETURNING cancel_requested").
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build query: %w", err)
+	}
+
+	var cancelRequested bool
+	if err := r.db.GetContext(ctx, &cancelRequested, sqlQuery, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("update admin task %s: %w", id, ErrAdminTaskLost)
+		}
+		return false, fmt.Errorf("update admin task progress: %w", err)
+	}
+	return cancelRequested, nil
+}
+
+// FinishAdminTask records the outcome of an admin task run by runnerID.
+func (r *Repository) FinishAdminTask(ctx context.Context, id uuid.UUID, runnerID string, outcome TaskOutcome) error {
+	var result any
+	if len(outcome.Result) > 0 {
+		result = outcome.Result
+	}
+
+	query := psql.Update("admin_tasks").
+		SetMap(progressColumns(outcome.Progress)).
+		Set("status", outcome.Status).
+		Set("result", result).
+		Set("error_message", nullIfEmpty(outcome.ErrorMessage)).
+		Set("completed_at", squirrel.Expr("NOW()")).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": id, "status": TaskStatusRunning, "runner_id": runnerID})
+	return r.updateAdminTask(ctx, id, query, "finish admin task")
+}
+
+// ReleaseAdminTask makes an admin task run by runnerID pending again, for another replica to run
+// when this one shuts down.
+func (r *Repository) ReleaseAdminTask(ctx context.Context, id uuid.UUID, runnerID string) error {
+	query := psql.Update("admin_tasks").
+		Set("status", TaskStatusPending).
+		Set("runner_id", nil).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": id, "status": TaskStatusRunning, "runner_id": runnerID})
+	return r.updateAdminTask(ctx, id, query, "release admin task")
+}
+
+// RequeueStaleAdminTasks makes the admin tasks not updated since staleBefore pending again and
+// returns them for queueing: running tasks whose replica stopped reporting progress, and pending
+// tasks that may have been lost on the way to the queue. Requeued tasks count as updated, so a task
+// waiting behind long ones is queued again at most once per period.
+func (r *Repository) RequeueStaleAdminTasks(ctx context.Context, staleBefore time.Time) ([]uuid.UUID, error) {
+	sqlQuery, args, err := psql.Update("admin_tasks").
+		Set("status", TaskStatusPending).
+		Set("runner_id", nil).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"status": []TaskStatus{TaskStatusPending, TaskStatusRunning}}).
+		Where(squirrel.Lt{"updated_at": staleBefore}).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var ids []uuid.UUID
+	if err := r.db.SelectContext(ctx, &ids, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("requeue stale admin tasks: %w", err)
+	}
+	return ids, nil
+}
+
+// CancelAdminTask cancels a pending admin task, or asks the replica running it to stop, and returns
+// the task. Tasks that already finished fail with ErrAdminTaskFinished.
+func (r *Repository) CancelAdminTask(ctx context.Context, id uuid.UUID) (*AdminTask, error) {
+	pending := squirrel.Expr("status = ?", TaskStatusPending)
+	query := psql.Update("admin_tasks").
+		Set("cancel_requested", true).
+		Set("status", squirrel.Case().When(pending, squirrel.Expr("?", TaskStatusCanceled)).Else("status")).
+		Set("completed_at", squirrel.Case().When(pending, "NOW()").Else("completed_at")).
+		Set("updated_at", squirrel.Expr("NOW()")).
+		Where(squirrel.Eq{"id": id, "status": []TaskStatus{TaskStatusPending, TaskStatusRunning}})
+
+	task, err := r.returnAdminTask(ctx, query)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.GetAdminTask(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("cancel admin task %s: %w", id, ErrAdminTaskFinished)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cancel admin task: %w", err)
+	}
+	return task, nil
+}
+
+func progressColumns(progress TaskProgress) map[string]any {
+	return map[string]any{
+		"total":     progress.Total,
+		"processed": progress.Processed,
+		"succeeded": progress.Succeeded,
+		"failed":    progress.Failed,
+	}
+}
+
+func (r *Repository) updateAdminTask(ctx context.Context, id uuid.UUID, query squirrel.UpdateBuilder, operation string) error {
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	result, err := r.db.ExecContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected == 0 {
+		return fmt.Errorf("%s %s: %w", operation, id, ErrAdminTaskLost)
+	}
+	return nil
+}
+
+// returnAdminTask runs an update of one admin task and returns the task as updated, or
+// sql.ErrNoRows when no task matched.
+func (r *Repository) returnAdminTask(ctx context.Context, query squirrel.UpdateBuilder) (*AdminTask, error) {
+	sqlQuery, args, err := query.Suffix("RETURNING " + strings.Join(adminTaskColumns, ", ")).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var task AdminTask
+	if err := r.db.GetContext(ctx, &task, sqlQuery, args...); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// GetAdminTask returns an admin task.
+func (r *Repository) GetAdminTask(ctx context.Context, id uuid.UUID) (*AdminTask, error) {
+	sqlQuery, args, err := psql.Select(adminTaskColumns...).
+		From("admin_tasks").
+		Where(squirrel.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var task AdminTask
+	if err := r.db.GetContext(ctx, &task, sqlQuery, args...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("admin task not found: %s", id)
+		}
+		return nil, fmt.Errorf("get admin task: %w", err)
+	}
+	return &task, nil
+}
+
+// ListAdminTasks returns the admin tasks matching the filter, newest first.
+func (r *Repository) ListAdminTasks(ctx context.Context, filter AdminTaskFilter) ([]*AdminTask, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 100 // Default limit
+	}
+
+	query := psql.Select(adminTaskColumns...).
+		From("admin_tasks").
+		OrderBy("created_at DESC", "id").
+		Limit(uint64(filter.Limit)).
+		Offset(uint64(filter.Offset))
+	if filter.Status != "" {
+		query = query.Where(squirrel.Eq{"status": filter.Status})
+	}
+	if filter.Kind != "" {
+		query = query.Where(squirrel.Eq{"kind": filter.Kind})
+	}
+
+	sqlQuery, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	tasks := []*AdminTask{}
+	if err := r.db.SelectContext(ctx, &tasks, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("list admin tasks: %w", err)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+)
+
+// JobUsage is the resource consumption of a single job. PeakMemoryBytes is an estimate: the
+// in-memory input and result for built-in processors, or the maximum RSS of an exec child.
+type JobUsage struct {
+	CPUTimeMS       int64 `json:"cpu_time_ms" db:"cpu_time_ms"`
+	WallTimeMS      int64 `json:"wall_time_ms" db:"wall_time_ms"`
+	PeakMemoryBytes int64 `json:"peak_memory_bytes" db:"peak_memory_bytes"`
+	BytesRead       int64 `json:"bytes_read" db:"bytes_read"`
+	BytesWritten    int64 `json:"bytes_written" db:"bytes_written"`
+}
+
+// UsageGrouping selects the time bucket of a usage report.
+type UsageGrouping string
+
+const (
+	UsageGroupingNone  UsageGrouping = "none"
+	UsageGroupingHour  UsageGrouping = "hour"
+	UsageGroupingDay   UsageGrouping = "day"
+	UsageGroupingMonth UsageGrouping = "month"
+)
+
+//nolint:gochecknoglobals // usageGroupings is a map of all valid usage groupings.
+var usageGroupings = map[string]UsageGrouping{
+	string(UsageGroupingNone):  UsageGroupingNone,
+	string(UsageGroupingHour):  UsageGroupingHour,
+	string(UsageGroupingDay):   UsageGroupingDay,
+	string(UsageGroupingMonth): UsageGroupingMonth,
+}
+
+func ToUsageGrouping(g string) (UsageGrouping, bool) {
+	res, ok := usageGroupings[g]
+	return res, ok
+}
+
+// UsageFilter selects jobs completed in [From, To). Empty TenantID and ProcessingType match all.
+type UsageFilter struct {
+	From           time.Time
+	To             time.Time
+	GroupBy        UsageGrouping
+	TenantID       string
+	ProcessingType ProcessingType
+}
+
+// UsageTotals aggregates job usage for a tenant, processing type and, unless grouping is none,
+// a period starting at PeriodStart (UTC).
+type UsageTotals struct {
+	TenantID           string         `json:"tenant_id" db:"tenant_id"`
+	ProcessingType     ProcessingType `json:"processing_type" db:"processing_type"`
+	PeriodStart        *time.Time     `json:"period_start,omitempty" db:"period_start"`
+	Jobs               int64          `json:"jobs" db:"jobs"`
+	CPUTimeMS          int64          `json:"cpu_time_ms" db:"cpu_time_ms"`
+	WallTimeMS         int64          `json:"wall_time_ms" db:"wall_time_ms"`
+	MaxPeakMemoryBytes int64          `json:"max_peak_memory_bytes" db:"max_peak_memory_bytes"`
+	BytesRead          int64          `json:"bytes_read" db:"bytes_read"`
+	BytesWritten       int64          `json:"bytes_written" db:"bytes_written"`
+}
+
+func (r *Repository) RecordUsage(ctx context.Context, id uuid.UUID, usage JobUsage) error {
+	sqlQuery, args, err := psql.Update("jobs").
+		Set("cpu_time_ms", usage.CPUTimeMS).
+		Set("wall_time_ms", usage.WallTimeMS).
+		Set("peak_memory_bytes", usage.PeakMemoryBytes).
+		Set("bytes_read", usage.BytesRead).
+		Set("bytes_written", usage.BytesWritten).
+		Where(byJobID(id)).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if _, err := r.db.ExecContext(ctx, sqlQuery, args...); err != nil {
+		return fmt.Errorf("record job usage: %w", err)
+	}
+
+	return nil
+}
+
+// GetUsage sums the usage of completed jobs per tenant, processing type and period.
+func (r *Repository) GetUsage(ctx context.Context, filter UsageFilter) ([]UsageTotals, error) {
+	groupBy := []string{"tenant_id", "processing_type"}
+
+	query := psql.Select("tenant_id", "processing_type").
+		Column("COUNT(*) AS jobs").
+		Column("COALESCE(SUM(cpu_time_ms), 0) AS cpu_time_ms").
+		Column("COALESCE(SUM(wall_time_ms), 0) AS wall_time_ms").
+		Column("COALESCE(MAX(peak_memory_bytes), 0) AS max_peak_memory_bytes").
+		Column("COALESCE(SUM(bytes_read), 0) AS bytes_read").
+		Column("COALESCE(SUM(bytes_written), 0) AS bytes_written").
+		From("jobs").
+		Where(squirrel.GtOrEq{"completed_at": filter.From}).
+		Where(squirrel.Lt{"completed_at": filter.To})
+
+	if filter.GroupBy != UsageGroupingNone {
+		// GroupBy is one of the fixed values above, never user input
+		query = query.Column(fmt.Sprintf("date_trunc('%s', completed_at) AS period_start", filter.GroupBy))
+		groupBy = append(groupBy, "period_start")
+	}
+	if filter.TenantID != "" {
+		query = query.Where(squirrel.Eq{"tenant_id": filter.TenantID})
+	}
+	if filter.ProcessingType != "" {
+		query = query.Where(squirrel.Eq{"processing_type": filter.ProcessingType})
+	}
+
+	sqlQuery, args, err := query.GroupBy(groupBy...).OrderBy(groupBy...).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	var totals []UsageTotals
+	if err := r.db.SelectContext(ctx, &totals, sqlQuery, args...); err != nil {
+		return nil, fmt.Errorf("get usage: %w", err)
+	}
+
+	return totals, nil
+}
@@ -0,0 +1,45 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/spf13/afero"
+)
+
+// ErrNotWritable is returned for storage directories files cannot be written to.
+var ErrNotWritable = errors.New("storage directory is not writable")
+
+// PrepareDir creates dir on fsys if needed and checks that files can be written to it, so a
+// read-only mount fails at startup rather than with the first upload or result.
+func PrepareDir(fsys afero.Fs, dir string) error {
+	if err := fsys.MkdirAll(dir, 0750); err != nil {
+		return dirError(dir, "create directory", err)
+	}
+
+	probe, err := afero.TempFile(fsys, dir, ".write-check-*")
+	if err != nil {
+		return dirError(dir, "write test file", err)
+	}
+	_ = probe.Close()
+
+	if err := fsys.Remove(probe.Name()); err != nil {
+		return dirError(dir, "remove test file", err)
+	}
+	return nil
+}
+
+// dirError explains the errors of read-only and permission-restricted directories.
+func dirError(dir, op string, err error) error {
+	switch {
+	case errors.Is(err, syscall.EROFS):
+		return fmt.Errorf("%w: %s is on a read-only filesystem; mount the volume read-write: %w", ErrNotWritable, dir, err)
+	case errors.Is(err, os.ErrPermission):
+		return fmt.Errorf("%w: %s; the directory must be writable by uid %d, check the volume's ownership and fsGroup: %w",
+			ErrNotWritable, dir, os.Getuid(), err)
+	default:
+		return fmt.Errorf("%s %s: %w", op, dir, err)
+	}
+}
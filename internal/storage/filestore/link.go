@@ -0,0 +1,71 @@
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// LinkMethod is how LinkFile gave a file the content of another.
+type LinkMethod string
+
+const (
+	// LinkReflink clones the source copy-on-write: the files share their blocks until one changes.
+	LinkReflink LinkMethod = "reflink"
+	// LinkHardlink adds a name to the source, which both names then refer to.
+	LinkHardlink LinkMethod = "hardlink"
+	// LinkCopy copies the content, for filesystems supporting neither.
+	LinkCopy LinkMethod = "copy"
+)
+
+// Shared reports whether the method shares the bytes of the source rather than duplicating them,
+// so they should only be counted once against storage quotas.
+func (m LinkMethod) Shared() bool {
+	return m == LinkReflink || m == LinkHardlink
+}
+
+// LinkFile gives dst the content of src without duplicating its bytes where the filesystem allows:
+// a reflink where supported, such as on Btrfs and XFS, else a hard link, else a copy. Filesystems
+// other than the OS one, such as an afero.NewMemMapFs in tests, always copy. dst must not exist. A
+// hard link shares the modification time of src, so retention treats both files as old as src.
+func LinkFile(fsys afero.Fs, src, dst string) (LinkMethod, error) {
+	if _, ok := fsys.(*afero.OsFs); ok {
+		if err := reflink(src, dst); err == nil {
+			return LinkReflink, nil
+		}
+
+		if err := os.Link(src, dst); err == nil {
+			return LinkHardlink, nil
+		}
+	}
+
+	if err := copyFile(fsys, src, dst); err != nil {
+		return "", err
+	}
+	return LinkCopy, nil
+}
+
+func copyFile(fsys afero.Fs, src, dst string) error {
+	in, err := fsys.Open(src)
+	if err != nil {
+		return fmt.Errorf("open source file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := fsys.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = fsys.Remove(dst)
+		return fmt.Errorf("copy file: %w", err)
+	}
+	return nil
+}
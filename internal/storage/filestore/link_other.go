@@ -0,0 +1,10 @@
+//go:build !linux
+
+package filestore
+
+import "errors"
+
+// reflink is only implemented on Linux.
+func reflink(_, _ string) error {
+	return errors.New("reflinks are not supported on this platform")
+}
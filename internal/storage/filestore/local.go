@@ -1,108 +1,297 @@
 package filestore
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"net/http"
+	"net/textproto"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/spf13/afero"
+
+	"github.com/rsav/k8s-learning/internal/encryption"
+)
+
+// quarantineDirName is the directory within the upload directory uploads are written to until their
+// job is created. Being on the same filesystem, they are moved to the upload directory atomically.
+const quarantineDirName = ".quarantine"
+
+// sniffLength is how much of an upload its content type is detected from.
+const sniffLength = 512
+
+var (
+	ErrFileTooLarge        = errors.New("file exceeds maximum allowed size")
+	ErrUnsupportedEncoding = errors.New("unsupported content encoding")
 )
 
 type FileStore struct {
-	uploadDir string
-	resultDir string
-	maxSize   int64
+	// fsys is the filesystem the directories are on, the OS one outside of tests.
+	fsys          afero.Fs
+	uploadDir     string
+	quarantineDir string
+	resultDir     string
+	maxSize       atomic.Int64
+	// keys encrypt stored files at rest; nil leaves them unencrypted.
+	keys *encryption.Keyring
 }
 
+// FileInfo describes an upload. Until it is committed, its content is at QuarantinePath and
+// StoredPath is where it will be stored.
 type FileInfo struct {
-	ID           string
-	OriginalName string
-	StoredPath   string
-	Size         int64
+	ID             string
+	OriginalName   string
+	StoredPath     string
+	QuarantinePath string
+	Size           int64
+	// ContentType is the type the client declared, DetectedType the one sniffed from the content.
 	ContentType  string
+	DetectedType string
+}
+
+// Upload is a file sent in a multipart form: its name and part header as sent by the client, its
+// size before decoding and its content.
+type Upload struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Size     int64
+	Content  io.Reader
 }
 
+// NewFileStore creates a file store on the OS filesystem.
 func NewFileStore(uploadDir, resultDir string, maxSize int64) (*FileStore, error) {
-	if err := os.MkdirAll(uploadDir, 0750); err != nil {
-		return nil, fmt.Errorf("create upload directory: %w", err)
+	return NewFileStoreFS(afero.NewOsFs(), uploadDir, resultDir, maxSize)
+}
+
+// NewFileStoreFS creates a file store on fsys, such as an afero.NewMemMapFs in tests. It creates
+// the directories and fails when one is not writable, e.g. on a read-only mount.
+func NewFileStoreFS(fsys afero.Fs, uploadDir, resultDir string, maxSize int64) (*FileStore, error) {
+	quarantineDir := filepath.Join(uploadDir, quarantineDirName)
+	for _, dir := range []string{uploadDir, quarantineDir, resultDir} {
+		if err := PrepareDir(fsys, dir); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := os.MkdirAll(resultDir, 0750); err != nil {
-		return nil, fmt.Errorf("create result directory: %w", err)
+	fs := &FileStore{
+		fsys:          fsys,
+		uploadDir:     uploadDir,
+		quarantineDir: quarantineDir,
+		resultDir:     resultDir,
 	}
+	fs.maxSize.Store(maxSize)
 
-	return &FileStore{
-		uploadDir: uploadDir,
-		resultDir: resultDir,
-		maxSize:   maxSize,
-	}, nil
+	return fs, nil
 }
 
-func (fs *FileStore) SaveUploadedFile(fileHeader *multipart.FileHeader) (*FileInfo, error) {
-	if fileHeader.Size > fs.maxSize {
-		return nil, fmt.Errorf("file size %d exceeds maximum allowed size %d",
-			fileHeader.Size, fs.maxSize)
+// QuarantineUpload writes an uploaded file to the quarantine directory, where it stays until
+// CommitUpload moves it to the upload directory or DiscardUpload removes it. Parts sent with
+// Content-Encoding gzip or deflate are decompressed, and the decompressed size is checked against
+// the limit to guard against zip bombs. The content type is detected from the decompressed content.
+func (fs *FileStore) QuarantineUpload(upload Upload) (*FileInfo, error) {
+	maxSize := fs.maxSize.Load()
+	if upload.Size > maxSize {
+		return nil, fmt.Errorf("%w: size %d, limit %d", ErrFileTooLarge, upload.Size, maxSize)
 	}
 
-	file, err := fileHeader.Open()
+	content, err := decodeContent(upload.Content, upload.Header.Get("Content-Encoding"))
 	if err != nil {
-		return nil, fmt.Errorf("open uploaded file: %w", err)
+		return nil, err
 	}
-	defer file.Close()
+	defer content.Close()
 
 	fileID := uuid.New().String()
-	ext := filepath.Ext(fileHeader.Filename)
+	ext := filepath.Ext(upload.Filename)
 	storedName := fmt.Sprintf("%s%s", fileID, ext)
 	storedPath := filepath.Clean(filepath.Join(fs.uploadDir, storedName))
+	quarantinePath := filepath.Clean(filepath.Join(fs.quarantineDir, storedName))
 
-	// #nosec G304 -- storedPath is constructed from trusted uploadDir + UUID + sanitized extension
-	dst, err := os.Create(storedPath)
+	// #nosec G304 -- quarantinePath is constructed from trusted uploadDir + UUID + sanitized extension
+	dst, err := fs.fsys.Create(quarantinePath)
 	if err != nil {
-		return nil, fmt.Errorf("create destination file: %w", err)
+		return nil, fmt.Errorf("create quarantine file: %w", err)
 	}
 	defer dst.Close()
 
-	size, err := io.Copy(dst, file)
+	head := &headBuffer{limit: sniffLength}
+	size, err := fs.writeContent(dst, io.TeeReader(io.LimitReader(content, maxSize+1), head))
+	if err == nil && size > maxSize {
+		err = fmt.Errorf("%w: decompressed size exceeds limit %d", ErrFileTooLarge, maxSize)
+	}
 	if err != nil {
-		if removeErr := os.Remove(storedPath); removeErr != nil {
-			// Log error but don't override the original error
-			_ = removeErr
-		}
+		_ = fs.fsys.Remove(quarantinePath)
 		return nil, fmt.Errorf("save file: %w", err)
 	}
 
 	return &FileInfo{
-		ID:           fileID,
-		OriginalName: fileHeader.Filename,
-		StoredPath:   storedPath,
-		Size:         size,
-		ContentType:  fileHeader.Header.Get("Content-Type"),
+		ID:             fileID,
+		OriginalName:   upload.Filename,
+		StoredPath:     storedPath,
+		QuarantinePath: quarantinePath,
+		Size:           size,
+		ContentType:    upload.Header.Get("Content-Type"),
+		DetectedType:   http.DetectContentType(head.data),
 	}, nil
 }
 
+// CommitUpload moves a quarantined upload to its stored path.
+func (fs *FileStore) CommitUpload(info *FileInfo) error {
+	if err := fs.fsys.Rename(info.QuarantinePath, info.StoredPath); err != nil {
+		return fmt.Errorf("commit upload: %w", err)
+	}
+	return nil
+}
+
+// DiscardUpload removes a quarantined upload.
+func (fs *FileStore) DiscardUpload(info *FileInfo) error {
+	if err := fs.fsys.Remove(info.QuarantinePath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("discard upload: %w", err)
+	}
+	return nil
+}
+
+// CleanupQuarantine removes quarantined uploads older than maxAge, left behind by API replicas
+// that stopped while creating a job, and returns how many were removed.
+func (fs *FileStore) CleanupQuarantine(maxAge time.Duration) (int, error) {
+	entries, err := afero.ReadDir(fs.fsys, fs.quarantineDir)
+	if err != nil {
+		return 0, fmt.Errorf("list quarantine directory: %w", err)
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	for _, info := range entries {
+		if info.IsDir() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := fs.fsys.Remove(filepath.Join(fs.quarantineDir, info.Name())); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("remove quarantined upload %s: %w", info.Name(), err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// headBuffer keeps the first limit bytes written to it.
+type headBuffer struct {
+	data  []byte
+	limit int
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	if room := h.limit - len(h.data); room > 0 {
+		h.data = append(h.data, p[:min(room, len(p))]...)
+	}
+	return len(p), nil
+}
+
+// decodeContent wraps r with a decompressor for the given Content-Encoding.
+func decodeContent(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return io.NopCloser(r), nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip content: %w", err)
+		}
+		return gz, nil
+	case "deflate":
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("open deflate content: %w", err)
+		}
+		return zr, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncoding, encoding)
+	}
+}
+
+// SetKeyring sets the keys stored files are encrypted and decrypted with. Files are encrypted only
+// when the keyring has an active key, and unencrypted ones are always read.
+func (fs *FileStore) SetKeyring(keys *encryption.Keyring) {
+	fs.keys = keys
+}
+
+// writeContent writes content to file, encrypted when files are encrypted at rest, and returns the
+// size of the content.
+func (fs *FileStore) writeContent(file io.Writer, content io.Reader) (int64, error) {
+	w, err := fs.keys.NewWriter(file)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := io.Copy(w, content)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return size, err
+}
+
 func (fs *FileStore) SaveResultFile(jobID uuid.UUID, filename string, content []byte) (string, error) {
 	resultName := fmt.Sprintf("%s_%s", jobID.String(), filename)
 	resultPath := filepath.Join(fs.resultDir, resultName)
 
-	if err := os.WriteFile(resultPath, content, 0600); err != nil {
+	file, err := fs.fsys.OpenFile(resultPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("create result file: %w", err)
+	}
+
+	_, err = fs.writeContent(file, bytes.NewReader(content))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
 		return "", fmt.Errorf("save result file: %w", err)
 	}
 
 	return resultPath, nil
 }
 
+// CopyResultFile stores a result file from a stream, such as an archive entry, and returns its
+// path and size. A partially written file is removed.
+func (fs *FileStore) CopyResultFile(name string, content io.Reader) (string, int64, error) {
+	resultPath := filepath.Join(fs.resultDir, filepath.Base(name))
+
+	// #nosec G304 -- the name is reduced to its base within resultDir
+	file, err := fs.fsys.OpenFile(resultPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", 0, fmt.Errorf("create result file: %w", err)
+	}
+
+	size, err := fs.writeContent(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = fs.fsys.Remove(resultPath)
+		return "", 0, fmt.Errorf("save result file: %w", err)
+	}
+
+	return resultPath, size, nil
+}
+
 func (fs *FileStore) ReadFile(filePath string) ([]byte, error) {
 	if !fs.isValidPath(filePath) {
 		return nil, errors.New("invalid file path")
 	}
 
-	// #nosec G304 -- filePath is validated by isValidPath() to be within uploadDir or resultDir
-	content, err := os.ReadFile(filePath)
+	// filePath is validated by isValidPath() to be within uploadDir or resultDir
+	file, _, err := OpenFile(fs.fsys, fs.keys, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
 	if err != nil {
 		return nil, fmt.Errorf("read file: %w", err)
 	}
@@ -110,12 +299,23 @@ func (fs *FileStore) ReadFile(filePath string) ([]byte, error) {
 	return content, nil
 }
 
+// OpenFile opens a stored file for streaming, for files too large to read into memory, and returns
+// it along with the size of its content, which differs from the size on disk for encrypted files.
+func (fs *FileStore) OpenFile(filePath string) (io.ReadCloser, int64, error) {
+	if !fs.isValidPath(filePath) {
+		return nil, 0, errors.New("invalid file path")
+	}
+
+	// filePath is validated by isValidPath() to be within uploadDir or resultDir
+	return OpenFile(fs.fsys, fs.keys, filePath)
+}
+
 func (fs *FileStore) FileExists(filePath string) bool {
 	if !fs.isValidPath(filePath) {
 		return false
 	}
 
-	_, err := os.Stat(filePath)
+	_, err := fs.fsys.Stat(filePath)
 	return err == nil
 }
 
@@ -124,7 +324,7 @@ func (fs *FileStore) DeleteFile(filePath string) error {
 		return errors.New("invalid file path")
 	}
 
-	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+	if err := fs.fsys.Remove(filePath); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("delete file: %w", err)
 	}
 
@@ -136,7 +336,7 @@ func (fs *FileStore) GetFileSize(filePath string) (int64, error) {
 		return 0, errors.New("invalid file path")
 	}
 
-	info, err := os.Stat(filePath)
+	info, err := fs.fsys.Stat(filePath)
 	if err != nil {
 		return 0, fmt.Errorf("get file info: %w", err)
 	}
@@ -149,7 +349,7 @@ func (fs *FileStore) GetFileModTime(filePath string) (time.Time, error) {
 		return time.Time{}, errors.New("invalid file path")
 	}
 
-	info, err := os.Stat(filePath)
+	info, err := fs.fsys.Stat(filePath)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("get file info: %w", err)
 	}
@@ -157,46 +357,85 @@ func (fs *FileStore) GetFileModTime(filePath string) (time.Time, error) {
 	return info.ModTime(), nil
 }
 
-func (fs *FileStore) CleanupOldFiles(maxAge time.Duration) error {
+// CleanupOldFiles removes stored files older than maxAge and returns the removed files mapped to
+// their sizes. On error the files removed so far are returned along with it.
+func (fs *FileStore) CleanupOldFiles(maxAge time.Duration) (map[string]int64, error) {
 	cutoff := time.Now().Add(-maxAge)
+	removed := make(map[string]int64)
 
-	err := filepath.Walk(fs.uploadDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	if err := fs.removeFilesBefore(fs.uploadDir, cutoff, removed, fs.quarantineDir); err != nil {
+		return removed, fmt.Errorf("cleanup upload directory: %w", err)
+	}
 
-		if !info.IsDir() && info.ModTime().Before(cutoff) {
-			if err := os.Remove(path); err != nil {
-				return fmt.Errorf("remove old file %s: %w", path, err)
+	if err := fs.removeFilesBefore(fs.resultDir, cutoff, removed, ""); err != nil {
+		return removed, fmt.Errorf("cleanup result directory: %w", err)
+	}
+
+	return removed, nil
+}
+
+// StoredFile is a file of the upload or result directory.
+type StoredFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Upload  bool
+}
+
+// ListStoredFiles returns the files of the upload directory, except quarantined uploads, and of the
+// result directory.
+func (fs *FileStore) ListStoredFiles() ([]StoredFile, error) {
+	var files []StoredFile
+
+	for _, dir := range []string{fs.uploadDir, fs.resultDir} {
+		err := afero.Walk(fs.fsys, dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
 			}
-		}
 
-		return nil
-	})
+			if info.IsDir() {
+				if path == fs.quarantineDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
 
-	if err != nil {
-		return fmt.Errorf("cleanup upload directory: %w", err)
+			files = append(files, StoredFile{
+				Path:    path,
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+				Upload:  dir == fs.uploadDir,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("list stored files of %s: %w", dir, err)
+		}
 	}
 
-	err = filepath.Walk(fs.resultDir, func(path string, info os.FileInfo, err error) error {
+	return files, nil
+}
+
+// removeFilesBefore removes the files in dir modified before cutoff, except within skipDir.
+func (fs *FileStore) removeFilesBefore(dir string, cutoff time.Time, removed map[string]int64, skipDir string) error {
+	return afero.Walk(fs.fsys, dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
+		if info.IsDir() && path == skipDir {
+			return filepath.SkipDir
+		}
+
 		if !info.IsDir() && info.ModTime().Before(cutoff) {
-			if err := os.Remove(path); err != nil {
+			if err := fs.fsys.Remove(path); err != nil {
 				return fmt.Errorf("remove old file %s: %w", path, err)
 			}
+			removed[path] = info.Size()
 		}
 
 		return nil
 	})
-
-	if err != nil {
-		return fmt.Errorf("cleanup result directory: %w", err)
-	}
-
-	return nil
 }
 
 func (fs *FileStore) isValidPath(filePath string) bool {
@@ -215,7 +454,13 @@ func (fs *FileStore) isValidPath(filePath string) bool {
 		return false
 	}
 
-	return strings.HasPrefix(absPath, uploadAbs) || strings.HasPrefix(absPath, resultAbs)
+	return withinDir(absPath, uploadAbs) || withinDir(absPath, resultAbs)
+}
+
+// withinDir reports whether the absolute path is dir or below it; a sibling sharing its prefix, such
+// as /data/uploads-old for /data/uploads, is not.
+func withinDir(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
 }
 
 func (fs *FileStore) GetStoragePaths() (string, string) {
@@ -223,5 +468,10 @@ func (fs *FileStore) GetStoragePaths() (string, string) {
 }
 
 func (fs *FileStore) GetMaxFileSize() int64 {
-	return fs.maxSize
+	return fs.maxSize.Load()
+}
+
+// SetMaxFileSize updates the upload size limit, used when runtime configuration changes.
+func (fs *FileStore) SetMaxFileSize(maxSize int64) {
+	fs.maxSize.Store(maxSize)
 }
@@ -0,0 +1,416 @@
+package filestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rsav/k8s-learning/internal/encryption"
+)
+
+const (
+	testUploadDir = "/data/uploads"
+	testResultDir = "/data/results"
+)
+
+func newTestFileStore(t *testing.T, maxSize int64) (*FileStore, afero.Fs) {
+	t.Helper()
+
+	fsys := afero.NewMemMapFs()
+	fs, err := NewFileStoreFS(fsys, testUploadDir, testResultDir, maxSize)
+	require.NoError(t, err)
+	return fs, fsys
+}
+
+func writeTestFile(t *testing.T, fsys afero.Fs, path, content string, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, fsys.MkdirAll(filepath.Dir(path), 0o750))
+	require.NoError(t, afero.WriteFile(fsys, path, []byte(content), 0o600))
+	require.NoError(t, fsys.Chtimes(path, modTime, modTime))
+}
+
+func gzipped(t *testing.T, content string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestNewFileStoreFSCreatesDirectories(t *testing.T) {
+	_, fsys := newTestFileStore(t, 100)
+
+	for _, dir := range []string{testUploadDir, filepath.Join(testUploadDir, quarantineDirName), testResultDir} {
+		info, err := fsys.Stat(dir)
+		require.NoError(t, err, dir)
+		assert.True(t, info.IsDir(), dir)
+
+		entries, err := afero.ReadDir(fsys, dir)
+		require.NoError(t, err)
+		for _, entry := range entries {
+			assert.False(t, strings.HasPrefix(entry.Name(), ".write-check-"), "write probe left in %s", dir)
+		}
+	}
+}
+
+func TestIsValidPath(t *testing.T) {
+	fs, _ := newTestFileStore(t, 100)
+
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{name: "upload", path: "/data/uploads/a.txt", want: true},
+		{name: "result", path: "/data/results/result_a.txt", want: true},
+		{name: "nested", path: "/data/results/sub/result_a.txt", want: true},
+		{name: "upload directory", path: "/data/uploads", want: true},
+		{name: "traversal out of the uploads", path: "/data/uploads/../secrets.txt", want: false},
+		{name: "traversal into the results", path: "/data/uploads/../results/result_a.txt", want: true},
+		{name: "sibling sharing the prefix", path: "/data/uploads-old/a.txt", want: false},
+		{name: "parent", path: "/data", want: false},
+		{name: "elsewhere", path: "/etc/passwd", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, fs.isValidPath(tt.path))
+		})
+	}
+}
+
+func TestFileOperationsRejectInvalidPaths(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+	outside := "/data/uploads-old/a.txt"
+	writeTestFile(t, fsys, outside, "keep", time.Now())
+
+	_, err := fs.ReadFile(outside)
+	assert.Error(t, err)
+	_, _, err = fs.OpenFile(outside)
+	assert.Error(t, err)
+	_, err = fs.GetFileSize(outside)
+	assert.Error(t, err)
+	_, err = fs.GetFileModTime(outside)
+	assert.Error(t, err)
+	_, err = fs.ReencryptFile(outside)
+	assert.Error(t, err)
+	assert.False(t, fs.FileExists(outside))
+	assert.Error(t, fs.DeleteFile(outside))
+
+	content, err := afero.ReadFile(fsys, outside)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(content))
+}
+
+func TestDeleteFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		create  bool
+		wantErr bool
+	}{
+		{name: "upload", path: "/data/uploads/a.txt", create: true},
+		{name: "result", path: "/data/results/result_a.txt", create: true},
+		{name: "missing file", path: "/data/results/missing.txt"},
+		{name: "outside the directories", path: "/data/secrets.txt", create: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, fsys := newTestFileStore(t, 100)
+			if tt.create {
+				writeTestFile(t, fsys, tt.path, "content", time.Now())
+			}
+
+			err := fs.DeleteFile(tt.path)
+
+			exists, statErr := afero.Exists(fsys, tt.path)
+			require.NoError(t, statErr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.True(t, exists)
+				return
+			}
+			assert.NoError(t, err)
+			assert.False(t, exists)
+		})
+	}
+}
+
+func TestCopyResultFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		wantPath string
+	}{
+		{name: "stored under its name", fileName: "result_a.txt", content: "hello", wantPath: "/data/results/result_a.txt"},
+		{name: "directories are stripped", fileName: "../../etc/result_b.txt", content: "world!", wantPath: "/data/results/result_b.txt"},
+		{name: "empty content", fileName: "result_c.txt", wantPath: "/data/results/result_c.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, fsys := newTestFileStore(t, 100)
+
+			path, size, err := fs.CopyResultFile(tt.fileName, strings.NewReader(tt.content))
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPath, path)
+			assert.Equal(t, int64(len(tt.content)), size)
+			content, err := afero.ReadFile(fsys, path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.content, string(content))
+		})
+	}
+}
+
+func TestCopyResultFileKeepsExistingFile(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+	writeTestFile(t, fsys, "/data/results/result_a.txt", "original", time.Now())
+
+	_, _, err := fs.CopyResultFile("result_a.txt", strings.NewReader("replacement"))
+
+	assert.Error(t, err)
+	content, err := afero.ReadFile(fsys, "/data/results/result_a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(content))
+}
+
+func TestCopyResultFileRemovesPartialFile(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+
+	_, _, err := fs.CopyResultFile("result_a.txt", io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(io.ErrUnexpectedEOF)))
+
+	assert.Error(t, err)
+	exists, err := afero.Exists(fsys, "/data/results/result_a.txt")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestQuarantineUpload(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      []byte
+		encoding     string
+		size         int64
+		wantContent  string
+		wantDetected string
+		wantErr      error
+	}{
+		{
+			name:         "plain text",
+			content:      []byte("hello world"),
+			wantContent:  "hello world",
+			wantDetected: "text/plain; charset=utf-8",
+		},
+		{
+			name:         "gzip content is decompressed",
+			content:      gzipped(t, "compressed text"),
+			encoding:     "gzip",
+			wantContent:  "compressed text",
+			wantDetected: "text/plain; charset=utf-8",
+		},
+		{
+			name:    "declared size over the limit",
+			content: []byte("short"),
+			size:    101,
+			wantErr: ErrFileTooLarge,
+		},
+		{
+			name:     "decompressed size over the limit",
+			content:  gzipped(t, strings.Repeat("a", 101)),
+			encoding: "gzip",
+			wantErr:  ErrFileTooLarge,
+		},
+		{
+			name:     "unsupported encoding",
+			content:  []byte("hello"),
+			encoding: "br",
+			wantErr:  ErrUnsupportedEncoding,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs, fsys := newTestFileStore(t, 100)
+			header := textproto.MIMEHeader{}
+			if tt.encoding != "" {
+				header.Set("Content-Encoding", tt.encoding)
+			}
+			size := tt.size
+			if size == 0 {
+				size = int64(len(tt.content))
+			}
+
+			info, err := fs.QuarantineUpload(Upload{
+				Filename: "input.txt",
+				Header:   header,
+				Size:     size,
+				Content:  bytes.NewReader(tt.content),
+			})
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				entries, err := afero.ReadDir(fsys, filepath.Join(testUploadDir, quarantineDirName))
+				require.NoError(t, err)
+				assert.Empty(t, entries, "quarantine must be left empty")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "input.txt", info.OriginalName)
+			assert.Equal(t, ".txt", filepath.Ext(info.StoredPath))
+			assert.Equal(t, testUploadDir, filepath.Dir(info.StoredPath))
+			assert.Equal(t, filepath.Join(testUploadDir, quarantineDirName), filepath.Dir(info.QuarantinePath))
+			assert.Equal(t, int64(len(tt.wantContent)), info.Size)
+			assert.Equal(t, tt.wantDetected, info.DetectedType)
+			content, err := afero.ReadFile(fsys, info.QuarantinePath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantContent, string(content))
+		})
+	}
+}
+
+func TestCommitAndDiscardUpload(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+	upload := func() *FileInfo {
+		info, err := fs.QuarantineUpload(Upload{Filename: "a.txt", Header: textproto.MIMEHeader{}, Size: 5, Content: strings.NewReader("hello")})
+		require.NoError(t, err)
+		return info
+	}
+
+	committed := upload()
+	require.NoError(t, fs.CommitUpload(committed))
+	assert.True(t, fs.FileExists(committed.StoredPath))
+	exists, err := afero.Exists(fsys, committed.QuarantinePath)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	discarded := upload()
+	require.NoError(t, fs.DiscardUpload(discarded))
+	assert.False(t, fs.FileExists(discarded.StoredPath))
+	exists, err = afero.Exists(fsys, discarded.QuarantinePath)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	// Discarding twice is not an error
+	assert.NoError(t, fs.DiscardUpload(discarded))
+}
+
+func TestCleanupOldFiles(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+	writeTestFile(t, fsys, "/data/uploads/old.txt", "old upload", old)
+	writeTestFile(t, fsys, "/data/uploads/new.txt", "new upload", now)
+	writeTestFile(t, fsys, "/data/results/result_old.txt", "old result!", old)
+	writeTestFile(t, fsys, "/data/results/result_new.txt", "new result", now)
+	writeTestFile(t, fsys, "/data/uploads/.quarantine/pending.txt", "quarantined", old)
+
+	removed, err := fs.CleanupOldFiles(time.Hour)
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"/data/uploads/old.txt":        int64(len("old upload")),
+		"/data/results/result_old.txt": int64(len("old result!")),
+	}, removed)
+	for _, path := range []string{"/data/uploads/new.txt", "/data/results/result_new.txt", "/data/uploads/.quarantine/pending.txt"} {
+		exists, err := afero.Exists(fsys, path)
+		require.NoError(t, err)
+		assert.True(t, exists, path)
+	}
+}
+
+func TestCleanupQuarantine(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+	now := time.Now()
+	writeTestFile(t, fsys, "/data/uploads/.quarantine/stale.txt", "stale", now.Add(-2*time.Hour))
+	writeTestFile(t, fsys, "/data/uploads/.quarantine/pending.txt", "pending", now)
+
+	removed, err := fs.CleanupQuarantine(time.Hour)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	exists, err := afero.Exists(fsys, "/data/uploads/.quarantine/pending.txt")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestListStoredFiles(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+	modTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	writeTestFile(t, fsys, "/data/uploads/a.txt", "upload", modTime)
+	writeTestFile(t, fsys, "/data/results/result_a.txt", "result!", modTime)
+	writeTestFile(t, fsys, "/data/uploads/.quarantine/pending.txt", "quarantined", modTime)
+
+	files, err := fs.ListStoredFiles()
+
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []StoredFile{
+		{Path: "/data/uploads/a.txt", Size: int64(len("upload")), ModTime: modTime, Upload: true},
+		{Path: "/data/results/result_a.txt", Size: int64(len("result!")), ModTime: modTime},
+	}, files)
+}
+
+func TestEncryptedFilesReportTheirContentSize(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+	keys, err := encryption.NewKeyring(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	require.NoError(t, err)
+	fs.SetKeyring(keys)
+
+	path, size, err := fs.CopyResultFile("result_a.txt", strings.NewReader("secret result"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("secret result")), size)
+
+	stored, err := afero.ReadFile(fsys, path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), "secret result")
+
+	content, contentSize, err := fs.OpenFile(path)
+	require.NoError(t, err)
+	defer content.Close()
+	plaintext, err := io.ReadAll(content)
+	require.NoError(t, err)
+	assert.Equal(t, "secret result", string(plaintext))
+	assert.Equal(t, int64(len("secret result")), contentSize)
+}
+
+func TestReencryptFile(t *testing.T) {
+	fs, fsys := newTestFileStore(t, 100)
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeTestFile(t, fsys, "/data/results/result_a.txt", "plain result", modTime)
+	keys, err := encryption.NewKeyring(map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}, "k1")
+	require.NoError(t, err)
+	fs.SetKeyring(keys)
+
+	rewritten, err := fs.ReencryptFile("/data/results/result_a.txt")
+	require.NoError(t, err)
+	assert.True(t, rewritten)
+
+	rewritten, err = fs.ReencryptFile("/data/results/result_a.txt")
+	require.NoError(t, err)
+	assert.False(t, rewritten, "a file encrypted with the active key is left alone")
+
+	gotModTime, err := fs.GetFileModTime("/data/results/result_a.txt")
+	require.NoError(t, err)
+	assert.True(t, modTime.Equal(gotModTime), "the modification time is kept")
+	content, err := fs.ReadFile("/data/results/result_a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "plain result", string(content))
+	entries, err := afero.ReadDir(fsys, testResultDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary file is left behind")
+}
@@ -0,0 +1,76 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+
+	"github.com/rsav/k8s-learning/internal/encryption"
+)
+
+// ReencryptFile rewrites a stored file that is not encrypted with the active key, such as one
+// written before encryption was enabled or before the key was rotated, and reports whether it did.
+// The file is replaced atomically and keeps its modification time, from which its retention is
+// counted; readers that opened it before keep reading the previous content.
+func (fs *FileStore) ReencryptFile(filePath string) (bool, error) {
+	if !fs.isValidPath(filePath) {
+		return false, errors.New("invalid file path")
+	}
+
+	file, err := fs.fsys.Open(filePath)
+	if err != nil {
+		return false, fmt.Errorf("open file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat file: %w", err)
+	}
+
+	prefix := make([]byte, encryption.HeaderLength)
+	n, err := io.ReadFull(file, prefix)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, fmt.Errorf("read file: %w", err)
+	}
+	if fs.keys.IsCurrent(prefix[:n]) {
+		return false, nil
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, fmt.Errorf("rewind file: %w", err)
+	}
+
+	content, _, err := fs.keys.NewSizedReader(file, info.Size())
+	if err != nil {
+		return false, err
+	}
+
+	// The rewritten file is created next to the original, on the same filesystem, to be renamed
+	// over it
+	tempPath := filepath.Join(filepath.Dir(filePath), fmt.Sprintf(".%s.%s.tmp", filepath.Base(filePath), uuid.New()))
+	temp, err := fs.fsys.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return false, fmt.Errorf("create reencrypted file: %w", err)
+	}
+
+	_, err = fs.writeContent(temp, content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.fsys.Chtimes(tempPath, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = fs.fsys.Rename(tempPath, filePath)
+	}
+	if err != nil {
+		_ = fs.fsys.Remove(tempPath)
+		return false, fmt.Errorf("reencrypt file: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,54 @@
+package filestore
+
+import "fmt"
+
+// Volume is a filesystem holding the upload directory, the result directory or both.
+type Volume struct {
+	Device     uint64
+	TotalBytes int64
+	FreeBytes  int64
+	Uploads    bool
+	Results    bool
+}
+
+// Name labels the volume by the directories on it: uploads, results or uploads+results.
+func (v Volume) Name() string {
+	switch {
+	case v.Uploads && v.Results:
+		return "uploads+results"
+	case v.Uploads:
+		return "uploads"
+	default:
+		return "results"
+	}
+}
+
+// FreeRatio is the fraction of the volume available to the service.
+func (v Volume) FreeRatio() float64 {
+	if v.TotalBytes <= 0 {
+		return 1
+	}
+	return float64(v.FreeBytes) / float64(v.TotalBytes)
+}
+
+// Volumes returns the space of the OS volumes the upload and result directories are on, one entry
+// for both when they share a volume.
+func (fs *FileStore) Volumes() ([]Volume, error) {
+	uploads, err := volumeSpace(fs.uploadDir)
+	if err != nil {
+		return nil, fmt.Errorf("get space of upload directory: %w", err)
+	}
+	uploads.Uploads = true
+
+	results, err := volumeSpace(fs.resultDir)
+	if err != nil {
+		return nil, fmt.Errorf("get space of result directory: %w", err)
+	}
+	results.Results = true
+
+	if uploads.Device == results.Device {
+		uploads.Results = true
+		return []Volume{uploads}, nil
+	}
+	return []Volume{uploads, results}, nil
+}
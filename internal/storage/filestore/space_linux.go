@@ -0,0 +1,28 @@
+//go:build linux
+
+package filestore
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// volumeSpace reads the capacity and the space available to unprivileged users of the volume dir is on.
+func volumeSpace(dir string) (Volume, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(dir, &stat); err != nil {
+		return Volume{}, fmt.Errorf("stat %s: %w", dir, err)
+	}
+
+	var statfs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &statfs); err != nil {
+		return Volume{}, fmt.Errorf("statfs %s: %w", dir, err)
+	}
+
+	// #nosec G115 -- block counts and sizes of real filesystems fit in int64
+	return Volume{
+		Device:     stat.Dev,
+		TotalBytes: int64(statfs.Blocks) * statfs.Bsize,
+		FreeBytes:  int64(statfs.Bavail) * statfs.Bsize,
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package filestore
+
+import "errors"
+
+// volumeSpace is only implemented on Linux.
+func volumeSpace(_ string) (Volume, error) {
+	return Volume{}, errors.New("volume space is not supported on this platform")
+}
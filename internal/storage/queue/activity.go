@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// WorkerHeartbeatsKey is a hash of the last heartbeat of every worker, as Unix seconds keyed by
+	// worker ID, from which the controller tells whether any worker is alive.
+	WorkerHeartbeatsKey = "workers:heartbeats"
+
+	// JobOutcomesKey is a hash counting the jobs workers finished by outcome, from which the
+	// controller derives the failure rate.
+	JobOutcomesKey = "text_tasks:outcomes"
+
+	outcomeSucceeded = "succeeded"
+	outcomeFailed    = "failed"
+)
+
+// JobOutcomes counts the jobs workers finished so far.
+type JobOutcomes struct {
+	Succeeded int64 `json:"succeeded"`
+	Failed    int64 `json:"failed"`
+}
+
+// Total returns the number of finished jobs.
+func (o JobOutcomes) Total() int64 {
+	return o.Succeeded + o.Failed
+}
+
+// RecordHeartbeat records that the worker is alive.
+func (rq *RedisQueue) RecordHeartbeat(ctx context.Context, workerID string) error {
+	if err := rq.client.HSet(ctx, WorkerHeartbeatsKey, workerID, time.Now().Unix()).Err(); err != nil {
+		return fmt.Errorf("record heartbeat: %w", err)
+	}
+	return nil
+}
+
+// RemoveHeartbeats forgets the heartbeats of the workers, e.g. of a worker shutting down.
+func (rq *RedisQueue) RemoveHeartbeats(ctx context.Context, workerIDs ...string) error {
+	if len(workerIDs) == 0 {
+		return nil
+	}
+	if err := rq.client.HDel(ctx, WorkerHeartbeatsKey, workerIDs...).Err(); err != nil {
+		return fmt.Errorf("remove heartbeats: %w", err)
+	}
+	return nil
+}
+
+// GetWorkerHeartbeats returns the last heartbeat of every worker that did not shut down cleanly.
+func (rq *RedisQueue) GetWorkerHeartbeats(ctx context.Context) (map[string]time.Time, error) {
+	values, err := rq.client.HGetAll(ctx, WorkerHeartbeatsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get heartbeats: %w", err)
+	}
+
+	heartbeats := make(map[string]time.Time, len(values))
+	for workerID, value := range values {
+		seconds, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse heartbeat of %s: %w", workerID, err)
+		}
+		heartbeats[workerID] = time.Unix(seconds, 0)
+	}
+	return heartbeats, nil
+}
+
+// RecordJobOutcome counts a job the worker finished, successfully or not.
+func (rq *RedisQueue) RecordJobOutcome(ctx context.Context, failed bool) error {
+	outcome := outcomeSucceeded
+	if failed {
+		outcome = outcomeFailed
+	}
+	if err := rq.client.HIncrBy(ctx, JobOutcomesKey, outcome, 1).Err(); err != nil {
+		return fmt.Errorf("record job outcome: %w", err)
+	}
+	return nil
+}
+
+// GetJobOutcomes returns the number of jobs finished so far by outcome.
+func (rq *RedisQueue) GetJobOutcomes(ctx context.Context) (JobOutcomes, error) {
+	counts, err := rq.client.HGetAll(ctx, JobOutcomesKey).Result()
+	if err != nil {
+		return JobOutcomes{}, fmt.Errorf("get job outcomes: %w", err)
+	}
+
+	var outcomes JobOutcomes
+	for outcome, count := range counts {
+		n, err := strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			return JobOutcomes{}, fmt.Errorf("parse %s jobs: %w", outcome, err)
+		}
+		switch outcome {
+		case outcomeSucceeded:
+			outcomes.Succeeded = n
+		case outcomeFailed:
+			outcomes.Failed = n
+		}
+	}
+	return outcomes, nil
+}
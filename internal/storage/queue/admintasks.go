@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// AdminTaskQueue is the list of admin tasks waiting to be run, by ID, consumed by the task runners
+// of the API replicas. The tasks themselves are stored in the database.
+const AdminTaskQueue = QueueMain + ":admin"
+
+// ErrNoAdminTasksAvailable is returned by ConsumeAdminTask when no task was queued before the
+// timeout.
+var ErrNoAdminTasksAvailable = errors.New("no admin tasks available in the queue")
+
+// PublishAdminTask queues an admin task to be run by one of the API replicas.
+func (rq *RedisQueue) PublishAdminTask(ctx context.Context, taskID uuid.UUID) error {
+	if err := rq.client.LPush(ctx, AdminTaskQueue, taskID.String()).Err(); err != nil {
+		return fmt.Errorf("publish admin task: %w", err)
+	}
+	return nil
+}
+
+// ConsumeAdminTask takes the oldest queued admin task, waiting up to timeout for one. A task may be
+// queued more than once; runners claim it in the database before running it.
+func (rq *RedisQueue) ConsumeAdminTask(ctx context.Context, timeout time.Duration) (uuid.UUID, error) {
+	result, err := rq.client.BRPop(ctx, timeout, AdminTaskQueue).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return uuid.Nil, ErrNoAdminTasksAvailable
+		}
+		return uuid.Nil, fmt.Errorf("consume admin task: %w", err)
+	}
+
+	const expectedBRPopResultLength = 2
+	if len(result) != expectedBRPopResultLength {
+		return uuid.Nil, fmt.Errorf("unexpected BRPOP result length: %d", len(result))
+	}
+
+	taskID, err := uuid.Parse(result[1])
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("parse admin task ID: %w", err)
+	}
+	return taskID, nil
+}
@@ -0,0 +1,50 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// ErrJobNotQueued is returned by BoostJob when the job is not waiting in the main queue of its
+// processing type or its tenant: it was consumed already, boosted before or moved to another region.
+var ErrJobNotQueued = errors.New("job is not waiting in the main queue")
+
+// boostScript moves the job marked by any of ARGV from the main queues KEYS[1] to KEYS[n-1] to the
+// priority queue KEYS[n], where it is consumed after the priority jobs queued before it. It returns
+// 0 when the job is in none of the main queues. Running as a script, no consumer can pop the job
+// while it moves.
+var boostScript = redis.NewScript(`
+for k = 1, #KEYS - 1 do
+	local jobs = redis.call('LRANGE', KEYS[k], 0, -1)
+	for i = #jobs, 1, -1 do
+		for _, marker in ipairs(ARGV) do
+			if string.find(jobs[i], marker, 1, true) then
+				redis.call('LREM', KEYS[k], 1, jobs[i])
+				redis.call('LPUSH', KEYS[#KEYS], jobs[i])
+				return 1
+			end
+		end
+	end
+end
+return 0
+`)
+
+// BoostJob moves a queued job of the processing type and the tenant to its priority queue.
+func (rq *RedisQueue) BoostJob(ctx context.Context, jobID uuid.UUID, processingType database.ProcessingType, tenantID string) error {
+	keys := []string{TypeQueue(processingType), TenantQueue(processingType, tenantID), TypePriorityQueue(processingType)}
+	moved, err := boostScript.Run(ctx, rq.client, keys, jobMarkers(jobID)...).Int64()
+	if err != nil {
+		return fmt.Errorf("boost job: %w", err)
+	}
+	if moved == 0 {
+		return ErrJobNotQueued
+	}
+
+	rq.log.InfoContext(ctx, "job boosted to priority queue", "job_id", jobID, "queue", keys[len(keys)-1])
+	return nil
+}
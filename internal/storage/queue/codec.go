@@ -0,0 +1,367 @@
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// Prefix bytes of job messages in the binary formats, by which consumers tell the formats apart.
+// JSON messages have none: they start with '{', so messages queued before the format was
+// configurable stay readable.
+const (
+	msgpackPrefix  byte = 0x01
+	protobufPrefix byte = 0x02
+)
+
+// serializer encodes job messages in one format.
+type serializer interface {
+	marshal(message SubmitJobMessage) ([]byte, error)
+	unmarshal(data []byte, message *SubmitJobMessage) error
+	// jobMarker returns the bytes identifying the messages of the job in the format, for the
+	// scripts searching the queues for a job.
+	jobMarker(jobID uuid.UUID) string
+}
+
+//nolint:gochecknoglobals // stateless serializers of the formats
+var serializers = map[string]serializer{
+	config.MessageFormatJSON:     jsonSerializer{},
+	config.MessageFormatMsgpack:  msgpackSerializer{},
+	config.MessageFormatProtobuf: protobufSerializer{},
+}
+
+// EncodeJob encodes a job message in the format, as published with QUEUE_MESSAGE_FORMAT.
+func EncodeJob(format string, message SubmitJobMessage) ([]byte, error) {
+	s, ok := serializers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown message format %q", format)
+	}
+	return s.marshal(message)
+}
+
+// DecodeJob decodes an unencrypted job message in any format.
+func DecodeJob(data []byte) (SubmitJobMessage, error) {
+	var message SubmitJobMessage
+	err := unmarshalJob(data, &message)
+	return message, err
+}
+
+// unmarshalJob decodes a job message in any format.
+func unmarshalJob(data []byte, message *SubmitJobMessage) error {
+	if len(data) > 0 {
+		switch data[0] {
+		case msgpackPrefix:
+			return msgpackSerializer{}.unmarshal(data, message)
+		case protobufPrefix:
+			return protobufSerializer{}.unmarshal(data, message)
+		}
+	}
+	return jsonSerializer{}.unmarshal(data, message)
+}
+
+// jobMarkers returns what identifies the messages of the job in every format, and in sealed
+// messages, whose envelope is JSON.
+func jobMarkers(jobID uuid.UUID) []any {
+	return []any{
+		jsonSerializer{}.jobMarker(jobID),
+		msgpackSerializer{}.jobMarker(jobID),
+		protobufSerializer{}.jobMarker(jobID),
+	}
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) marshal(message SubmitJobMessage) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+func (jsonSerializer) unmarshal(data []byte, message *SubmitJobMessage) error {
+	return json.Unmarshal(data, message)
+}
+
+func (jsonSerializer) jobMarker(jobID uuid.UUID) string {
+	return fmt.Sprintf(`"job_id":%q`, jobID.String())
+}
+
+// msgpackMessage is a job message in msgpack. Parameters stay JSON, so that processors see the
+// same values, e.g. float64 numbers, whatever format the job was queued in.
+type msgpackMessage struct {
+	JobID          string          `msgpack:"job_id"`
+	TenantID       string          `msgpack:"tenant_id,omitempty"`
+	FilePath       string          `msgpack:"file_path"`
+	SecondFilePath string          `msgpack:"second_file_path,omitempty"`
+	ProcessingType string          `msgpack:"processing_type"`
+	Parameters     json.RawMessage `msgpack:"parameters,omitempty"`
+	Priority       int             `msgpack:"priority,omitempty"`
+	DelayMS        int             `msgpack:"delay_ms,omitempty"`
+	TraceID        string          `msgpack:"trace_id,omitempty"`
+	Traceparent    string          `msgpack:"traceparent,omitempty"`
+	Tracestate     string          `msgpack:"tracestate,omitempty"`
+	EnqueuedAt     time.Time       `msgpack:"enqueued_at,omitempty"`
+
+	OriginalFilename       string `msgpack:"original_filename,omitempty"`
+	SecondOriginalFilename string `msgpack:"second_original_filename,omitempty"`
+}
+
+type msgpackSerializer struct{}
+
+func (msgpackSerializer) marshal(message SubmitJobMessage) ([]byte, error) {
+	params, err := marshalParameters(message.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := msgpack.Marshal(msgpackMessage{
+		JobID:          message.JobID.String(),
+		TenantID:       message.TenantID,
+		FilePath:       message.FilePath,
+		SecondFilePath: message.SecondFilePath,
+		ProcessingType: string(message.ProcessingType),
+		Parameters:     params,
+		Priority:       message.Priority,
+		DelayMS:        message.DelayMS,
+		TraceID:        message.TraceID,
+		Traceparent:    message.Traceparent,
+		Tracestate:     message.Tracestate,
+		EnqueuedAt:     message.EnqueuedAt,
+
+		OriginalFilename:       message.OriginalFilename,
+		SecondOriginalFilename: message.SecondOriginalFilename,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{msgpackPrefix}, data...), nil
+}
+
+func (msgpackSerializer) unmarshal(data []byte, message *SubmitJobMessage) error {
+	var m msgpackMessage
+	if err := msgpack.Unmarshal(data[1:], &m); err != nil {
+		return err
+	}
+
+	jobID, err := uuid.Parse(m.JobID)
+	if err != nil {
+		return fmt.Errorf("parse job ID: %w", err)
+	}
+	params, err := unmarshalParameters(m.Parameters)
+	if err != nil {
+		return err
+	}
+
+	*message = SubmitJobMessage{
+		JobID:          jobID,
+		TenantID:       m.TenantID,
+		FilePath:       m.FilePath,
+		SecondFilePath: m.SecondFilePath,
+		ProcessingType: database.ProcessingType(m.ProcessingType),
+		Parameters:     params,
+		Priority:       m.Priority,
+		DelayMS:        m.DelayMS,
+		TraceID:        m.TraceID,
+		Traceparent:    m.Traceparent,
+		Tracestate:     m.Tracestate,
+		EnqueuedAt:     m.EnqueuedAt,
+
+		OriginalFilename:       m.OriginalFilename,
+		SecondOriginalFilename: m.SecondOriginalFilename,
+	}
+	return nil
+}
+
+func (msgpackSerializer) jobMarker(jobID uuid.UUID) string {
+	// The map of the job ID alone, less its header byte, is the job ID entry of any message
+	data, err := msgpack.Marshal(map[string]string{"job_id": jobID.String()})
+	if err != nil {
+		return ""
+	}
+	return string(data[1:])
+}
+
+// Field numbers of job messages in protobuf, as declared in message.proto.
+const (
+	protoJobID protowire.Number = iota + 1
+	protoTenantID
+	protoFilePath
+	protoSecondFilePath
+	protoProcessingType
+	protoParameters
+	protoPriority
+	protoDelayMS
+	protoTraceID
+	protoTraceparent
+	protoTracestate
+	protoEnqueuedAt
+	protoOriginalFilename
+	protoSecondOriginalFilename
+)
+
+// protobufSerializer encodes job messages as the SubmitJob message of message.proto. It writes the
+// wire format directly, which keeps generated code and protoc out of the build.
+type protobufSerializer struct{}
+
+func (protobufSerializer) marshal(message SubmitJobMessage) ([]byte, error) {
+	params, err := marshalParameters(message.Parameters)
+	if err != nil {
+		return nil, err
+	}
+
+	data := []byte{protobufPrefix}
+	data = appendProtoString(data, protoJobID, message.JobID.String())
+	data = appendProtoString(data, protoTenantID, message.TenantID)
+	data = appendProtoString(data, protoFilePath, message.FilePath)
+	data = appendProtoString(data, protoSecondFilePath, message.SecondFilePath)
+	data = appendProtoString(data, protoProcessingType, string(message.ProcessingType))
+	if len(params) > 0 {
+		data = protowire.AppendTag(data, protoParameters, protowire.BytesType)
+		data = protowire.AppendBytes(data, params)
+	}
+	data = appendProtoInt(data, protoPriority, int64(message.Priority))
+	data = appendProtoInt(data, protoDelayMS, int64(message.DelayMS))
+	data = appendProtoString(data, protoTraceID, message.TraceID)
+	data = appendProtoString(data, protoTraceparent, message.Traceparent)
+	data = appendProtoString(data, protoTracestate, message.Tracestate)
+	if !message.EnqueuedAt.IsZero() {
+		data = appendProtoInt(data, protoEnqueuedAt, message.EnqueuedAt.UnixNano())
+	}
+	data = appendProtoString(data, protoOriginalFilename, message.OriginalFilename)
+	data = appendProtoString(data, protoSecondOriginalFilename, message.SecondOriginalFilename)
+	return data, nil
+}
+
+func (protobufSerializer) unmarshal(data []byte, message *SubmitJobMessage) error {
+	*message = SubmitJobMessage{}
+	var params []byte
+
+	data = data[1:]
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			if err := setProtoBytes(message, &params, num, value); err != nil {
+				return err
+			}
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+			setProtoInt(message, num, int64(value)) //nolint:gosec // int64 values are encoded as their two's complement
+		default:
+			// Fields of later versions are skipped
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+
+	var err error
+	message.Parameters, err = unmarshalParameters(params)
+	return err
+}
+
+func (protobufSerializer) jobMarker(jobID uuid.UUID) string {
+	return string(appendProtoString(nil, protoJobID, jobID.String()))
+}
+
+func setProtoBytes(message *SubmitJobMessage, params *[]byte, num protowire.Number, value []byte) error {
+	switch num {
+	case protoJobID:
+		jobID, err := uuid.ParseBytes(value)
+		if err != nil {
+			return fmt.Errorf("parse job ID: %w", err)
+		}
+		message.JobID = jobID
+	case protoTenantID:
+		message.TenantID = string(value)
+	case protoFilePath:
+		message.FilePath = string(value)
+	case protoSecondFilePath:
+		message.SecondFilePath = string(value)
+	case protoProcessingType:
+		message.ProcessingType = database.ProcessingType(value)
+	case protoParameters:
+		*params = value
+	case protoTraceID:
+		message.TraceID = string(value)
+	case protoTraceparent:
+		message.Traceparent = string(value)
+	case protoTracestate:
+		message.Tracestate = string(value)
+	case protoOriginalFilename:
+		message.OriginalFilename = string(value)
+	case protoSecondOriginalFilename:
+		message.SecondOriginalFilename = string(value)
+	}
+	return nil
+}
+
+func setProtoInt(message *SubmitJobMessage, num protowire.Number, value int64) {
+	switch num {
+	case protoPriority:
+		message.Priority = int(value)
+	case protoDelayMS:
+		message.DelayMS = int(value)
+	case protoEnqueuedAt:
+		message.EnqueuedAt = time.Unix(0, value).UTC()
+	}
+}
+
+func appendProtoString(data []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return data
+	}
+	data = protowire.AppendTag(data, num, protowire.BytesType)
+	return protowire.AppendString(data, value)
+}
+
+func appendProtoInt(data []byte, num protowire.Number, value int64) []byte {
+	if value == 0 {
+		return data
+	}
+	data = protowire.AppendTag(data, num, protowire.VarintType)
+	return protowire.AppendVarint(data, uint64(value)) //nolint:gosec // negative values are encoded as their two's complement
+}
+
+// marshalParameters encodes job parameters as JSON for the binary formats, nil when there are none.
+func marshalParameters(params map[string]any) ([]byte, error) {
+	if len(params) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("marshal parameters: %w", err)
+	}
+	return data, nil
+}
+
+func unmarshalParameters(data []byte) (map[string]any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var params map[string]any
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("unmarshal parameters: %w", err)
+	}
+	return params, nil
+}
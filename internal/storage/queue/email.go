@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// EmailOutboxKey is the list of emails waiting to be sent, consumed by the email senders of
+	// the workers.
+	EmailOutboxKey = "emails:outbox"
+
+	// EmailRetryKey is a sorted set of emails whose delivery failed, scored by the Unix milliseconds
+	// at which they are due to be sent again.
+	EmailRetryKey = "emails:retry"
+
+	// EmailSuppressedKey is the set of addresses no email is sent to, as lowercase addresses.
+	EmailSuppressedKey = "emails:suppressed"
+
+	// emailPromoteBatch bounds the due retries moved to the outbox at once.
+	emailPromoteBatch = 100
+)
+
+// ErrNoEmailsAvailable is returned by ConsumeEmail when no email was queued before the timeout.
+var ErrNoEmailsAvailable = errors.New("no emails available in the outbox")
+
+// EmailMessage is an email queued for delivery.
+type EmailMessage struct {
+	ID       uuid.UUID `json:"id"`
+	JobID    uuid.UUID `json:"job_id"`
+	TenantID string    `json:"tenant_id,omitempty"`
+	To       string    `json:"to"`
+	Subject  string    `json:"subject"`
+	Body     string    `json:"body"`
+	// Attempts counts the failed deliveries so far and LastError is the error of the last one.
+	Attempts  int       `json:"attempts,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	QueuedAt  time.Time `json:"queued_at"`
+}
+
+// EnqueueEmail queues an email for delivery.
+func (rq *RedisQueue) EnqueueEmail(ctx context.Context, message EmailMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("marshal email: %w", err)
+	}
+
+	if err := rq.client.LPush(ctx, EmailOutboxKey, data).Err(); err != nil {
+		return fmt.Errorf("enqueue email: %w", err)
+	}
+	return nil
+}
+
+// ConsumeEmail takes the oldest queued email, waiting up to timeout for one. Emails that cannot be
+// decoded are dropped.
+func (rq *RedisQueue) ConsumeEmail(ctx context.Context, timeout time.Duration) (*EmailMessage, error) {
+	result, err := rq.client.BRPop(ctx, timeout, EmailOutboxKey).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrNoEmailsAvailable
+		}
+		return nil, fmt.Errorf("consume email: %w", err)
+	}
+
+	const expectedBRPopResultLength = 2
+	if len(result) != expectedBRPopResultLength {
+		return nil, fmt.Errorf("unexpected BRPOP result length: %d", len(result))
+	}
+
+	var message EmailMessage
+	if err := json.Unmarshal([]byte(result[1]), &message); err != nil {
+		return nil, fmt.Errorf("unmarshal email: %w", err)
+	}
+	return &message, nil
+}
+
+// RetryEmail schedules an email whose delivery failed to be sent again at the given time.
+func (rq *RedisQueue) RetryEmail(ctx context.Context, message EmailMessage, at time.Time) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("marshal email: %w", err)
+	}
+
+	if err := rq.client.ZAdd(ctx, EmailRetryKey, redis.Z{Score: float64(at.UnixMilli()), Member: data}).Err(); err != nil {
+		return fmt.Errorf("schedule email retry: %w", err)
+	}
+	return nil
+}
+
+// PromoteDueEmails moves the retries that are due back to the outbox and returns how many it
+// moved. Senders of several workers may promote at the same time; only the one that removed a
+// retry from the sorted set queues it.
+func (rq *RedisQueue) PromoteDueEmails(ctx context.Context) (int, error) {
+	due, err := rq.client.ZRangeByScore(ctx, EmailRetryKey, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Count: emailPromoteBatch,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("get due email retries: %w", err)
+	}
+
+	promoted := 0
+	for _, data := range due {
+		removed, err := rq.client.ZRem(ctx, EmailRetryKey, data).Result()
+		if err != nil {
+			return promoted, fmt.Errorf("remove due email retry: %w", err)
+		}
+		if removed == 0 {
+			continue
+		}
+
+		if err := rq.client.LPush(ctx, EmailOutboxKey, data).Err(); err != nil {
+			return promoted, fmt.Errorf("promote email retry: %w", err)
+		}
+		promoted++
+	}
+	return promoted, nil
+}
+
+// SuppressEmail adds the address to the suppression list.
+func (rq *RedisQueue) SuppressEmail(ctx context.Context, address string) error {
+	if err := rq.client.SAdd(ctx, EmailSuppressedKey, strings.ToLower(address)).Err(); err != nil {
+		return fmt.Errorf("suppress email address: %w", err)
+	}
+	return nil
+}
+
+// UnsuppressEmail removes the address from the suppression list and reports whether it was listed.
+func (rq *RedisQueue) UnsuppressEmail(ctx context.Context, address string) (bool, error) {
+	removed, err := rq.client.SRem(ctx, EmailSuppressedKey, strings.ToLower(address)).Result()
+	if err != nil {
+		return false, fmt.Errorf("unsuppress email address: %w", err)
+	}
+	return removed > 0, nil
+}
+
+// IsEmailSuppressed reports whether the address is on the suppression list.
+func (rq *RedisQueue) IsEmailSuppressed(ctx context.Context, address string) (bool, error) {
+	suppressed, err := rq.client.SIsMember(ctx, EmailSuppressedKey, strings.ToLower(address)).Result()
+	if err != nil {
+		return false, fmt.Errorf("check email suppression: %w", err)
+	}
+	return suppressed, nil
+}
+
+// GetSuppressedEmails returns the suppression list, sorted.
+func (rq *RedisQueue) GetSuppressedEmails(ctx context.Context) ([]string, error) {
+	addresses, err := rq.client.SMembers(ctx, EmailSuppressedKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get suppressed email addresses: %w", err)
+	}
+	slices.Sort(addresses)
+	return addresses, nil
+}
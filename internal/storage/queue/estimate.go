@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+const (
+	// durationKeyPrefix namespaces the recent job durations per processing type in milliseconds,
+	// text_tasks:durations:<type>, newest first.
+	durationKeyPrefix = QueueMain + ":durations:"
+
+	// durationSamples is how many recent jobs the rolling average duration covers.
+	durationSamples = 100
+)
+
+// queuePositionScript returns how many jobs are consumed before the job marked by any of ARGV[3] to
+// ARGV[n]: consumers pop from the tail, draining the priority queue KEYS[1], then the tenant queues
+// of the ring KEYS[2] round-robin, then the main queue KEYS[3]. Tenant queues are named by the
+// prefix ARGV[1]; a job in the queue of the tenant ARGV[2] waits for as many jobs of every other
+// tenant as are ahead of it in its own queue. It returns -1 when the job is in none of the queues.
+var queuePositionScript = redis.NewScript(`
+local function find(key)
+	local jobs = redis.call('LRANGE', key, 0, -1)
+	for i = #jobs, 1, -1 do
+		for m = 3, #ARGV do
+			if string.find(jobs[i], ARGV[m], 1, true) then
+				return #jobs - i
+			end
+		end
+	end
+	return -1
+end
+
+local position = find(KEYS[1])
+if position >= 0 then
+	return position
+end
+local ahead = redis.call('LLEN', KEYS[1])
+
+local tenants = redis.call('LRANGE', KEYS[2], 0, -1)
+local lengths = {}
+local queued = 0
+for i, tenant in ipairs(tenants) do
+	lengths[i] = redis.call('LLEN', ARGV[1] .. tenant)
+	queued = queued + lengths[i]
+end
+
+position = find(ARGV[1] .. ARGV[2])
+if position >= 0 then
+	for i, tenant in ipairs(tenants) do
+		if tenant ~= ARGV[2] then
+			ahead = ahead + math.min(lengths[i], position)
+		end
+	end
+	return ahead + position
+end
+
+position = find(KEYS[3])
+if position >= 0 then
+	return ahead + queued + position
+end
+return -1
+`)
+
+func durationKey(processingType database.ProcessingType) string {
+	return durationKeyPrefix + string(processingType)
+}
+
+// RecordJobDuration adds the duration of a finished job to the rolling average of its type.
+func (rq *RedisQueue) RecordJobDuration(ctx context.Context, processingType database.ProcessingType, duration time.Duration) error {
+	key := durationKey(processingType)
+	_, err := rq.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, key, duration.Milliseconds())
+		pipe.LTrim(ctx, key, 0, durationSamples-1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("record job duration: %w", err)
+	}
+	return nil
+}
+
+// GetAverageDuration returns the rolling average duration of jobs of the processing type, zero
+// when none finished recently.
+func (rq *RedisQueue) GetAverageDuration(ctx context.Context, processingType database.ProcessingType) (time.Duration, error) {
+	samples, err := rq.client.LRange(ctx, durationKey(processingType), 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("get job durations: %w", err)
+	}
+	if len(samples) == 0 {
+		return 0, nil
+	}
+
+	var total int64
+	for _, sample := range samples {
+		ms, err := strconv.ParseInt(sample, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse job duration of %s: %w", processingType, err)
+		}
+		total += ms
+	}
+	return time.Duration(total/int64(len(samples))) * time.Millisecond, nil
+}
+
+// GetQueuePosition returns how many queued jobs of the processing type are consumed before the
+// job of the tenant, and false when the job is no longer queued.
+func (rq *RedisQueue) GetQueuePosition(ctx context.Context, jobID uuid.UUID, processingType database.ProcessingType, tenantID string) (int64, bool, error) {
+	keys := []string{TypePriorityQueue(processingType), tenantRing(processingType), TypeQueue(processingType)}
+	args := append([]any{TypeQueue(processingType) + tenantQueueInfix, tenantOrDefault(tenantID)}, jobMarkers(jobID)...)
+
+	ahead, err := queuePositionScript.Run(ctx, rq.client, keys, args...).Int64()
+	if err != nil {
+		return 0, false, fmt.Errorf("get queue position: %w", err)
+	}
+	if ahead < 0 {
+		return 0, false, nil
+	}
+	return ahead, true, nil
+}
@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// expireScript pops the oldest messages of the failed queue KEYS[1] as long as they are the
+// messages ARGV, given oldest first, and returns the popped ones. A message retried or pushed back
+// in the meantime stops it, so nothing is popped that was not judged expired.
+var expireScript = redis.NewScript(`
+local popped = {}
+for i = 1, #ARGV do
+	if redis.call('LINDEX', KEYS[1], -1) ~= ARGV[i] then
+		break
+	end
+	redis.call('RPOP', KEYS[1])
+	popped[#popped + 1] = ARGV[i]
+end
+return popped
+`)
+
+// failedAt reads when a failed queue message failed. Messages that cannot be decoded are as old as
+// can be, so they are expired rather than kept forever.
+func failedAt(data string) time.Time {
+	var message struct {
+		FailedAt time.Time `json:"failed_at"`
+	}
+	if err := json.Unmarshal([]byte(data), &message); err != nil {
+		return time.Time{}
+	}
+	return message.FailedAt
+}
+
+// GetFailedQueueAge returns the size of the failed queue and when its oldest message failed, which
+// is zero when the queue is empty.
+func (rq *RedisQueue) GetFailedQueueAge(ctx context.Context) (int64, time.Time, error) {
+	var length *redis.IntCmd
+	var oldest *redis.StringCmd
+	_, err := rq.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		length = pipe.LLen(ctx, QueueFailed)
+		oldest = pipe.LIndex(ctx, QueueFailed, -1)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, time.Time{}, fmt.Errorf("get failed queue age: %w", err)
+	}
+
+	if length.Val() == 0 {
+		return 0, time.Time{}, nil
+	}
+	return length.Val(), failedAt(oldest.Val()), nil
+}
+
+// PopExpiredFailed removes up to limit messages that failed before cutoff from the failed queue,
+// oldest first, and returns them. Messages are pushed newest first, so the expired ones are at the
+// tail.
+func (rq *RedisQueue) PopExpiredFailed(ctx context.Context, cutoff time.Time, limit int64) ([]string, error) {
+	tail, err := rq.client.LRange(ctx, QueueFailed, -limit, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("read failed queue: %w", err)
+	}
+
+	var expired []any
+	for i := len(tail) - 1; i >= 0; i-- {
+		if !failedAt(tail[i]).Before(cutoff) {
+			break
+		}
+		expired = append(expired, tail[i])
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	popped, err := expireScript.Run(ctx, rq.client, []string{QueueFailed}, expired...).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("pop expired failed messages: %w", err)
+	}
+	return popped, nil
+}
+
+// RestoreFailed puts messages popped by PopExpiredFailed, oldest first, back at the tail of the
+// failed queue, e.g. when archiving them failed.
+func (rq *RedisQueue) RestoreFailed(ctx context.Context, messages []string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	values := make([]any, 0, len(messages))
+	for i := len(messages) - 1; i >= 0; i-- {
+		values = append(values, messages[i])
+	}
+	if err := rq.client.RPush(ctx, QueueFailed, values...).Err(); err != nil {
+		return fmt.Errorf("restore failed messages: %w", err)
+	}
+	return nil
+}
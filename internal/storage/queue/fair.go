@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/tenant"
+)
+
+const (
+	// tenantQueueInfix and tenantRingSuffix name the per-tenant sub-queues of a processing type's
+	// main queue, text_tasks:type:<type>:tenant:<tenant>, and the ring of tenants with queued jobs
+	// consumers rotate through, text_tasks:type:<type>:tenants.
+	tenantQueueInfix = ":tenant:"
+	tenantRingSuffix = ":tenants"
+)
+
+// fairPublishScript queues the job ARGV[1] in the tenant sub-queue KEYS[1] and adds the tenant
+// ARGV[2] to the back of the ring KEYS[2] unless it is waiting for its turn already.
+var fairPublishScript = redis.NewScript(`
+redis.call('LPUSH', KEYS[1], ARGV[1])
+if not redis.call('LPOS', KEYS[2], ARGV[2]) then
+	redis.call('LPUSH', KEYS[2], ARGV[2])
+end
+return 1
+`)
+
+// fairConsumeScript pops up to ARGV[5] jobs, each from the first of KEYS with one, returning the
+// queue and the job of each as consecutive elements. Plain queues are popped from the tail. A ring,
+// recognized by the ARGV[1] suffix, serves its tenants round-robin: the tenant whose turn it is
+// goes to the back of the ring and one job is popped from its sub-queue, named by ARGV[2], and
+// tenants whose sub-queue is empty leave the ring. ARGV[3] and ARGV[4] optionally name a ring and
+// a tenant a blocking pop took off it, which is put back first, at the front. Sub-queues are
+// derived from the rings rather than passed as keys, which ties the queues to a single Redis node.
+var fairConsumeScript = redis.NewScript(`
+local function pop()
+	for _, key in ipairs(KEYS) do
+		if string.sub(key, -#ARGV[1]) == ARGV[1] then
+			local prefix = string.sub(key, 1, #key - #ARGV[1]) .. ARGV[2]
+			for _ = 1, redis.call('LLEN', key) do
+				local tenant = redis.call('LMOVE', key, key, 'RIGHT', 'LEFT')
+				local queue = prefix .. tenant
+				local data = redis.call('RPOP', queue)
+				if redis.call('LLEN', queue) == 0 then
+					redis.call('LREM', key, 1, tenant)
+				end
+				if data then
+					return queue, data
+				end
+			end
+		else
+			local data = redis.call('RPOP', key)
+			if data then
+				return key, data
+			end
+		end
+	end
+	return nil
+end
+
+if ARGV[3] ~= '' and not redis.call('LPOS', ARGV[3], ARGV[4]) then
+	redis.call('RPUSH', ARGV[3], ARGV[4])
+end
+local popped = {}
+for _ = 1, tonumber(ARGV[5]) do
+	local queue, data = pop()
+	if not queue then
+		break
+	end
+	table.insert(popped, queue)
+	table.insert(popped, data)
+end
+if #popped == 0 then
+	return false
+end
+return popped
+`)
+
+// TenantQueue returns the sub-queue of the processing type's main queue holding the jobs of the
+// tenant, when jobs are queued fairly across tenants.
+func TenantQueue(processingType database.ProcessingType, tenantID string) string {
+	return TypeQueue(processingType) + tenantQueueInfix + tenantOrDefault(tenantID)
+}
+
+// tenantRing returns the ring of the tenants with jobs queued in sub-queues of the processing type.
+func tenantRing(processingType database.ProcessingType) string {
+	return TypeQueue(processingType) + tenantRingSuffix
+}
+
+func tenantOrDefault(tenantID string) string {
+	if tenantID == "" {
+		return tenant.DefaultID
+	}
+	return tenantID
+}
+
+// typeQueueName returns the processing type of a key below typeQueuePrefix, with the priority
+// suffix or the tenant of a sub-queue cut off, and false for tenant rings.
+func typeQueueName(key string) (database.ProcessingType, bool) {
+	name := strings.TrimPrefix(key, typeQueuePrefix)
+	if strings.HasSuffix(name, tenantRingSuffix) {
+		return "", false
+	}
+	name, _, _ = strings.Cut(name, tenantQueueInfix)
+	return database.ProcessingType(strings.TrimSuffix(name, priorityQueueSuffix)), true
+}
+
+// publishFair queues a job of a tenant in its sub-queue, to be consumed round-robin with the jobs
+// of other tenants.
+func (rq *RedisQueue) publishFair(ctx context.Context, message SubmitJobMessage, data []byte) error {
+	keys := []string{TenantQueue(message.ProcessingType, message.TenantID), tenantRing(message.ProcessingType)}
+	return fairPublishScript.Run(ctx, rq.client, keys, data, tenantOrDefault(message.TenantID)).Err()
+}
+
+// popFair pops up to limit jobs from the first of the queues with one without waiting, serving the
+// tenant rings among them round-robin. ring and tenantID name a tenant a blocking pop took off its
+// ring, which is put back before; both are empty otherwise. Undecodable jobs are quarantined, and
+// why each could not be decoded is returned instead.
+func (rq *RedisQueue) popFair(ctx context.Context, queues []string, ring, tenantID string, limit int) ([]*SubmitJobMessage, []error, error) {
+	result, err := fairConsumeScript.Run(ctx, rq.client, queues, tenantRingSuffix, tenantQueueInfix, ring, tenantID, limit).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, ErrNoJobsAvailable
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("consume job from queue: %w", err)
+	}
+
+	if len(result) == 0 || len(result)%2 != 0 { // queue and job of each
+		return nil, nil, fmt.Errorf("unexpected consume result length: %d", len(result))
+	}
+
+	popped := make([]poppedJob, 0, len(result)/2)
+	for i := 0; i < len(result); i += 2 {
+		popped = append(popped, poppedJob{queue: result[i], data: result[i+1]})
+	}
+	messages, quarantined := rq.decodeJobs(ctx, popped)
+	return messages, quarantined, nil
+}
+
+// popOne pops the next job like popFair, returning why it could not be decoded when it was
+// quarantined.
+func (rq *RedisQueue) popOne(ctx context.Context, queues []string) (*SubmitJobMessage, error) {
+	messages, quarantined, err := rq.popFair(ctx, queues, "", "", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(quarantined) > 0 {
+		return nil, quarantined[0]
+	}
+	return messages[0], nil
+}
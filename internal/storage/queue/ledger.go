@@ -0,0 +1,151 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// processingKeyPrefix namespaces the idempotency ledger, text_tasks:processing:<job_id>, holding
+// the ID of the worker that claimed the job.
+const processingKeyPrefix = QueueMain + ":processing:"
+
+func processingKey(jobID uuid.UUID) string {
+	return processingKeyPrefix + jobID.String()
+}
+
+// claimScript claims the job of the ledger key KEYS[1] for the worker ARGV[1] for ARGV[2]
+// milliseconds unless it is claimed already, and records the heartbeat ARGV[3] of the worker in
+// KEYS[2] with the claim. It returns 1 and no holder for a new claim, and 0 and the holder
+// otherwise, read in the same step so that the holder is the one that refused the claim.
+var claimScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	redis.call('HSET', KEYS[2], ARGV[1], ARGV[3])
+	return {1, ''}
+end
+return {0, redis.call('GET', KEYS[1])}
+`)
+
+// JobClaim is the outcome of claiming a job: whether the worker claimed it or, for a duplicate
+// delivery, the worker holding the claim.
+type JobClaim struct {
+	Claimed bool
+	Holder  string
+}
+
+// ClaimJobs records in the idempotency ledger that the worker processes the jobs, for at most lease,
+// and that the worker is alive, in a single round trip. The claim of each job, in order, is not
+// Claimed when the job was claimed already, i.e. the message is a duplicate delivery.
+func (rq *RedisQueue) ClaimJobs(ctx context.Context, jobIDs []uuid.UUID, workerID string, lease time.Duration) ([]JobClaim, error) {
+	results, err := rq.claimJobs(ctx, jobIDs, workerID, lease)
+	if redis.HasErrorPrefix(err, "NOSCRIPT") {
+		// Pipelined scripts run by SHA only, and Redis lost its script cache since startup
+		if err := claimScript.Load(ctx, rq.client).Err(); err != nil {
+			return nil, fmt.Errorf("load claim script: %w", err)
+		}
+		results, err = rq.claimJobs(ctx, jobIDs, workerID, lease)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim jobs: %w", err)
+	}
+
+	claims := make([]JobClaim, len(results))
+	for i, result := range results {
+		values, err := result.Slice()
+		if err != nil {
+			return nil, fmt.Errorf("claim jobs: %w", err)
+		}
+		if claims[i], err = parseClaim(values); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
+
+func (rq *RedisQueue) claimJobs(ctx context.Context, jobIDs []uuid.UUID, workerID string, lease time.Duration) ([]*redis.Cmd, error) {
+	now := time.Now().Unix()
+	results := make([]*redis.Cmd, len(jobIDs))
+	_, err := rq.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, jobID := range jobIDs {
+			keys := []string{processingKey(jobID), WorkerHeartbeatsKey}
+			results[i] = claimScript.EvalSha(ctx, pipe, keys, workerID, lease.Milliseconds(), now)
+		}
+		return nil
+	})
+	return results, err
+}
+
+func parseClaim(result []any) (JobClaim, error) {
+	if len(result) != 2 { // {claimed, holder}
+		return JobClaim{}, fmt.Errorf("claim jobs: unexpected script result %v", result)
+	}
+	claimed, _ := result[0].(int64)
+	holder, _ := result[1].(string)
+	return JobClaim{Claimed: claimed == 1, Holder: holder}, nil
+}
+
+// CompleteJobClaim keeps the claim of a processed job for ttl, so deliveries arriving later are
+// recognized as duplicates too.
+func (rq *RedisQueue) CompleteJobClaim(ctx context.Context, jobID uuid.UUID, workerID string, ttl time.Duration) error {
+	if err := rq.client.Set(ctx, processingKey(jobID), workerID, ttl).Err(); err != nil {
+		return fmt.Errorf("complete job claim: %w", err)
+	}
+	return nil
+}
+
+// ReleaseJobClaim removes the claim of a job that was not processed, so a redelivery is processed.
+func (rq *RedisQueue) ReleaseJobClaim(ctx context.Context, jobID uuid.UUID) error {
+	if err := rq.client.Del(ctx, processingKey(jobID)).Err(); err != nil {
+		return fmt.Errorf("release job claim: %w", err)
+	}
+	return nil
+}
+
+// JobAck is what a worker records about a job that reached a terminal status.
+type JobAck struct {
+	JobID          uuid.UUID
+	ProcessingType database.ProcessingType
+	WorkerID       string
+	// ClaimTTL is how long the claim of the job is kept, as by CompleteJobClaim.
+	ClaimTTL time.Duration
+	Failed   bool
+	// Duration is added to the rolling average duration of the processing type; zero skips it.
+	Duration time.Duration
+}
+
+// AckJob completes the claim of a finished job, counts its outcome and records its duration in a
+// single round trip.
+func (rq *RedisQueue) AckJob(ctx context.Context, ack JobAck) error {
+	outcome := outcomeSucceeded
+	if ack.Failed {
+		outcome = outcomeFailed
+	}
+
+	_, err := rq.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, processingKey(ack.JobID), ack.WorkerID, ack.ClaimTTL)
+		pipe.HIncrBy(ctx, JobOutcomesKey, outcome, 1)
+		if ack.Duration > 0 {
+			key := durationKey(ack.ProcessingType)
+			pipe.LPush(ctx, key, ack.Duration.Milliseconds())
+			pipe.LTrim(ctx, key, 0, durationSamples-1)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("ack job: %w", err)
+	}
+	return nil
+}
+
+// ResetJobDelivery forgets the claim and the deliveries of a job that is queued again, so that it
+// is neither dropped as a duplicate nor quarantined for the deliveries of its earlier runs.
+func (rq *RedisQueue) ResetJobDelivery(ctx context.Context, jobID uuid.UUID) error {
+	if err := rq.client.Del(ctx, processingKey(jobID), deliveriesKey(jobID)).Err(); err != nil {
+		return fmt.Errorf("reset job delivery: %w", err)
+	}
+	return nil
+}
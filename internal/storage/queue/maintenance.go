@@ -0,0 +1,39 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MaintenanceKey is set while the API is in maintenance mode, holding the message shown to clients.
+// Every API replica reads it, so switching one switches all.
+const MaintenanceKey = "api:maintenance"
+
+// SetMaintenance switches maintenance mode on with the message, or off.
+func (rq *RedisQueue) SetMaintenance(ctx context.Context, enabled bool, message string) error {
+	var err error
+	if enabled {
+		err = rq.client.Set(ctx, MaintenanceKey, message, 0).Err()
+	} else {
+		err = rq.client.Del(ctx, MaintenanceKey).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("set maintenance mode: %w", err)
+	}
+	return nil
+}
+
+// GetMaintenance reports whether maintenance mode is on and its message.
+func (rq *RedisQueue) GetMaintenance(ctx context.Context) (bool, string, error) {
+	message, err := rq.client.Get(ctx, MaintenanceKey).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("get maintenance mode: %w", err)
+	}
+	return true, message, nil
+}
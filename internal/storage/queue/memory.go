@@ -0,0 +1,94 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMemoryHigh is returned by PublishJob while Redis uses more memory than the watermark allows,
+// so new jobs do not push it into evicting or rejecting queue data.
+var ErrMemoryHigh = errors.New("redis memory usage is above the watermark")
+
+// MemoryUsage is the memory Redis uses and may use; MaxMemory is zero when it is not limited.
+type MemoryUsage struct {
+	UsedMemory int64
+	MaxMemory  int64
+}
+
+// GetMemoryUsage reads the memory usage from INFO memory.
+func (rq *RedisQueue) GetMemoryUsage(ctx context.Context) (MemoryUsage, error) {
+	info, err := rq.client.Info(ctx, "memory").Result()
+	if err != nil {
+		return MemoryUsage{}, fmt.Errorf("get redis memory info: %w", err)
+	}
+
+	var usage MemoryUsage
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		field, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok {
+			continue
+		}
+		switch field {
+		case "used_memory":
+			usage.UsedMemory, err = strconv.ParseInt(value, 10, 64)
+		case "maxmemory":
+			usage.MaxMemory, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return MemoryUsage{}, fmt.Errorf("parse redis %s: %w", field, err)
+		}
+	}
+	return usage, nil
+}
+
+// WatchMemory checks the memory usage of Redis every interval until ctx is done and records whether
+// it is above watermark, the fraction of maxmemory at which publishing stops. Without maxmemory
+// or with a zero watermark it returns right away. Should the usage be unreadable, the last state
+// is kept.
+func (rq *RedisQueue) WatchMemory(ctx context.Context, watermark float64, interval time.Duration) {
+	if watermark <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		usage, err := rq.GetMemoryUsage(ctx)
+		switch {
+		case err != nil:
+			rq.log.WarnContext(ctx, "failed to check redis memory usage", "error", err)
+		case usage.MaxMemory == 0:
+			rq.log.InfoContext(ctx, "redis has no maxmemory, memory guard disabled")
+			return
+		default:
+			high := float64(usage.UsedMemory) >= watermark*float64(usage.MaxMemory)
+			if rq.memoryHigh.Swap(high) != high {
+				if high {
+					rq.log.WarnContext(ctx, "redis memory above watermark, rejecting new jobs",
+						"used_memory", usage.UsedMemory, "max_memory", usage.MaxMemory, "watermark", watermark)
+				} else {
+					rq.log.InfoContext(ctx, "redis memory back below watermark, accepting new jobs",
+						"used_memory", usage.UsedMemory, "max_memory", usage.MaxMemory, "watermark", watermark)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MemoryHigh reports whether Redis memory was above the watermark at the last check.
+func (rq *RedisQueue) MemoryHigh() bool {
+	return rq.memoryHigh.Load()
+}
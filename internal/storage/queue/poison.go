@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+const (
+	// QueuePoison holds quarantined messages, newest first. Nothing consumes it: messages stay until
+	// an operator inspects and deletes them.
+	QueuePoison = QueueMain + ":poison"
+
+	// deliveriesKeyPrefix namespaces the delivery counters, text_tasks:deliveries:<job_id>, hashes
+	// with the number of deliveries, the last worker and the last processing error of a job.
+	deliveriesKeyPrefix = QueueMain + ":deliveries:"
+
+	// deliveriesTTL is how long a job's deliveries are remembered after the last one, long enough
+	// to span retries from the failed queue.
+	deliveriesTTL = 7 * 24 * time.Hour
+)
+
+// Reasons a message is quarantined for.
+const (
+	PoisonReasonUndecodable   = "undecodable"
+	PoisonReasonMaxDeliveries = "max_deliveries"
+)
+
+// ErrMessageQuarantined is returned by consumers when the consumed message was quarantined instead.
+var ErrMessageQuarantined = errors.New("message quarantined in the poison queue")
+
+// PoisonMessage is a quarantined message with what is known about why it could not be processed.
+type PoisonMessage struct {
+	ID uuid.UUID `json:"id"`
+	// JobID and ProcessingType are empty when the message could not be decoded.
+	JobID          uuid.UUID               `json:"job_id,omitempty"`
+	ProcessingType database.ProcessingType `json:"processing_type,omitempty"`
+	// Queue is the queue the message was consumed from and Payload the message as consumed.
+	Queue         string    `json:"queue"`
+	Payload       string    `json:"payload"`
+	Reason        string    `json:"reason"`
+	Diagnosis     string    `json:"diagnosis"`
+	Deliveries    int64     `json:"deliveries,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+	WorkerID      string    `json:"worker_id,omitempty"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+// JobDeliveries is how often a job was delivered to workers.
+type JobDeliveries struct {
+	Count      int64
+	LastWorker string
+	LastError  string
+}
+
+func deliveriesKey(jobID uuid.UUID) string {
+	return deliveriesKeyPrefix + jobID.String()
+}
+
+// RecordDelivery counts a delivery of the job to the worker and returns its deliveries so far.
+func (rq *RedisQueue) RecordDelivery(ctx context.Context, jobID uuid.UUID, workerID string) (JobDeliveries, error) {
+	key := deliveriesKey(jobID)
+
+	var count *redis.IntCmd
+	var previous *redis.MapStringStringCmd
+	_, err := rq.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		previous = pipe.HGetAll(ctx, key)
+		count = pipe.HIncrBy(ctx, key, "count", 1)
+		pipe.HSet(ctx, key, "worker", workerID)
+		pipe.Expire(ctx, key, deliveriesTTL)
+		return nil
+	})
+	if err != nil {
+		return JobDeliveries{}, fmt.Errorf("record delivery: %w", err)
+	}
+
+	// The last worker and error are those of the previous delivery, the one that did not complete
+	return JobDeliveries{
+		Count:      count.Val(),
+		LastWorker: previous.Val()["worker"],
+		LastError:  previous.Val()["error"],
+	}, nil
+}
+
+// RecordDeliveryError stores why processing a delivery of the job failed, for the diagnosis of a
+// later quarantine.
+func (rq *RedisQueue) RecordDeliveryError(ctx context.Context, jobID uuid.UUID, errorMsg string) error {
+	if err := rq.client.HSet(ctx, deliveriesKey(jobID), "error", errorMsg).Err(); err != nil {
+		return fmt.Errorf("record delivery error: %w", err)
+	}
+	return nil
+}
+
+// Quarantine moves a message to the poison queue.
+func (rq *RedisQueue) Quarantine(ctx context.Context, message PoisonMessage) error {
+	if message.ID == uuid.Nil {
+		message.ID = uuid.New()
+	}
+	if message.QuarantinedAt.IsZero() {
+		message.QuarantinedAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("marshal poison message: %w", err)
+	}
+
+	if err := rq.client.LPush(ctx, QueuePoison, data).Err(); err != nil {
+		return fmt.Errorf("quarantine message: %w", err)
+	}
+
+	rq.log.WarnContext(ctx, "message quarantined",
+		"poison_id", message.ID, "job_id", message.JobID, "queue", message.Queue, "reason", message.Reason)
+	return nil
+}
+
+// quarantineUndecodable quarantines a consumed message that is not a job message. Should that fail
+// the message is logged, as it is already off its queue.
+func (rq *RedisQueue) quarantineUndecodable(ctx context.Context, queueName, data string, decodeErr error) {
+	message := PoisonMessage{
+		Queue:     queueName,
+		Payload:   data,
+		Reason:    PoisonReasonUndecodable,
+		Diagnosis: decodeErr.Error(),
+	}
+	if !utf8.ValidString(data) {
+		// Binary messages would not survive the JSON of the poison queue
+		message.Payload = base64.StdEncoding.EncodeToString([]byte(data))
+		message.Diagnosis += " (payload base64 encoded)"
+	}
+	if err := rq.Quarantine(ctx, message); err != nil {
+		rq.log.ErrorContext(ctx, "failed to quarantine undecodable message", "queue", queueName, "message", data, "error", err)
+	}
+}
+
+// GetPoisonMessages returns up to limit quarantined messages from offset, newest first, and how
+// many are quarantined in total.
+func (rq *RedisQueue) GetPoisonMessages(ctx context.Context, offset, limit int64) ([]PoisonMessage, int64, error) {
+	var entries *redis.StringSliceCmd
+	var total *redis.IntCmd
+	_, err := rq.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		entries = pipe.LRange(ctx, QueuePoison, offset, offset+limit-1)
+		total = pipe.LLen(ctx, QueuePoison)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("get poison messages: %w", err)
+	}
+
+	messages := make([]PoisonMessage, 0, len(entries.Val()))
+	for _, entry := range entries.Val() {
+		var message PoisonMessage
+		if err := json.Unmarshal([]byte(entry), &message); err != nil {
+			return nil, 0, fmt.Errorf("unmarshal poison message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+	return messages, total.Val(), nil
+}
+
+// DeletePoisonMessage removes a quarantined message and returns false when there is none with the ID.
+func (rq *RedisQueue) DeletePoisonMessage(ctx context.Context, id uuid.UUID) (bool, error) {
+	entries, err := rq.client.LRange(ctx, QueuePoison, 0, -1).Result()
+	if err != nil {
+		return false, fmt.Errorf("get poison messages: %w", err)
+	}
+
+	for _, entry := range entries {
+		var message PoisonMessage
+		if err := json.Unmarshal([]byte(entry), &message); err != nil || message.ID != id {
+			continue
+		}
+
+		removed, err := rq.client.LRem(ctx, QueuePoison, 1, entry).Result()
+		if err != nil {
+			return false, fmt.Errorf("delete poison message: %w", err)
+		}
+		return removed > 0, nil
+	}
+	return false, nil
+}
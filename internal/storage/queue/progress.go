@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// progressKeyPrefix namespaces the progress reported for jobs, text_tasks:progress:<job_id>.
+	progressKeyPrefix = QueueMain + ":progress:"
+
+	// progressTTL is how long a job's progress outlives its last report, so the progress of jobs
+	// whose worker died does not stay around forever.
+	progressTTL = time.Hour
+)
+
+// JobProgress is how much of its input a worker has processed for a job.
+type JobProgress struct {
+	Percent        int       `json:"percent"`
+	BytesProcessed int64     `json:"bytes_processed"`
+	BytesTotal     int64     `json:"bytes_total"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func progressKey(jobID uuid.UUID) string {
+	return progressKeyPrefix + jobID.String()
+}
+
+// SetJobProgress stores the latest progress of a job.
+func (rq *RedisQueue) SetJobProgress(ctx context.Context, jobID uuid.UUID, progress JobProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("marshal job progress: %w", err)
+	}
+
+	if err := rq.client.Set(ctx, progressKey(jobID), data, progressTTL).Err(); err != nil {
+		return fmt.Errorf("set job progress: %w", err)
+	}
+	return nil
+}
+
+// GetJobsProgress returns the latest progress of the given jobs. Jobs without reported progress
+// are absent.
+func (rq *RedisQueue) GetJobsProgress(ctx context.Context, jobIDs []uuid.UUID) (map[uuid.UUID]JobProgress, error) {
+	progress := make(map[uuid.UUID]JobProgress, len(jobIDs))
+	if len(jobIDs) == 0 {
+		return progress, nil
+	}
+
+	keys := make([]string, len(jobIDs))
+	for i, jobID := range jobIDs {
+		keys[i] = progressKey(jobID)
+	}
+
+	values, err := rq.client.MGet(ctx, keys...).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("get jobs progress: %w", err)
+	}
+
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var jobProgress JobProgress
+		if err := json.Unmarshal([]byte(data), &jobProgress); err != nil {
+			return nil, fmt.Errorf("unmarshal progress of job %s: %w", jobIDs[i], err)
+		}
+		progress[jobIDs[i]] = jobProgress
+	}
+
+	return progress, nil
+}
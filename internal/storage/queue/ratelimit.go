@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// rateLimitKeyPrefix namespaces the request log of each rate-limited client,
+// text_tasks:ratelimit:<key>, shared by every API replica.
+const rateLimitKeyPrefix = QueueMain + ":ratelimit:"
+
+// rateLimitScript keeps a sliding-window log of the requests of KEYS[1] as a sorted set scored by
+// Redis server time in microseconds, so replicas with skewed clocks agree. It admits the request
+// ARGV[3] when fewer than ARGV[1] requests were admitted within the last ARGV[2] microseconds and
+// returns {1, 0}; otherwise it returns {0, microseconds until the oldest request leaves the window}.
+var rateLimitScript = redis.NewScript(`
+local now = redis.call('TIME')
+local now_us = tonumber(now[1]) * 1000000 + tonumber(now[2])
+local window_us = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now_us - window_us)
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[1]) then
+	redis.call('ZADD', KEYS[1], now_us, ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], math.ceil(window_us / 1000))
+	return {1, 0}
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return {0, tonumber(oldest[2]) + window_us - now_us}
+`)
+
+// AllowRequest records a request of the client identified by key and reports whether it is within
+// limit requests per sliding window. Rejected requests are not recorded; for them it also returns
+// how long until the client may send another request.
+func (rq *RedisQueue) AllowRequest(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	result, err := rateLimitScript.Run(ctx, rq.client, []string{rateLimitKeyPrefix + key},
+		limit, window.Microseconds(), uuid.NewString()).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("check rate limit: %w", err)
+	}
+
+	if len(result) != 2 { // {allowed, retry after}
+		return false, 0, fmt.Errorf("check rate limit: unexpected script result %v", result)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Microsecond, nil
+}
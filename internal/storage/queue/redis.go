@@ -1,41 +1,90 @@
 package queue
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/encryption"
 	"github.com/rsav/k8s-learning/internal/storage/database"
 )
 
 const (
+	// QueueMain and QueuePriority are the shared queues jobs were published to before per-type
+	// queues; workers keep draining them so that no queued job is lost on upgrade.
 	QueueMain     = "text_tasks"
 	QueuePriority = "text_tasks:priority"
 	QueueFailed   = "text_tasks:failed"
 
+	// typeQueuePrefix namespaces the per-processing-type queues, text_tasks:type:<type>[:priority].
+	typeQueuePrefix     = QueueMain + ":type:"
+	priorityQueueSuffix = ":priority"
+
+	// EnqueuedChannel is the pub/sub channel announcing newly queued jobs by processing type, so the
+	// controller can react to bursts without waiting for its next reconciliation.
+	EnqueuedChannel = "text_tasks:enqueued"
+
+	// ScalingHistoryKey holds the controller's recent scaling decisions, newest first.
+	ScalingHistoryKey = "scaling:history"
+
+	// ConsumedJobsKey is a hash counting the jobs consumed per processing type, from which the
+	// controller derives worker throughput.
+	ConsumedJobsKey = "text_tasks:consumed"
+
 	highPriorityThreshold = 5
+	scanBatchSize         = 100
 )
 
 var ErrNoJobsAvailable = errors.New("no jobs available in the queue")
 
 type SubmitJobMessage struct {
 	JobID          uuid.UUID               `json:"job_id"`
+	TenantID       string                  `json:"tenant_id,omitempty"`
 	FilePath       string                  `json:"file_path"`
+	SecondFilePath string                  `json:"second_file_path,omitempty"`
 	ProcessingType database.ProcessingType `json:"processing_type"`
-	Parameters     map[string]any          `json:"parameters"`
-	Priority       int                     `json:"priority"`
-	DelayMS        int                     `json:"delay_ms"`
+	// OriginalFilename and SecondOriginalFilename are the names the files were uploaded under, which
+	// label the results that quote them, such as diff headers.
+	OriginalFilename       string         `json:"original_filename,omitempty"`
+	SecondOriginalFilename string         `json:"second_original_filename,omitempty"`
+	Parameters             map[string]any `json:"parameters"`
+	Priority               int            `json:"priority"`
+	DelayMS                int            `json:"delay_ms"`
+	TraceID                string         `json:"trace_id,omitempty"`
+	// Traceparent and Tracestate carry the W3C trace context of the submitting request, so the
+	// worker continues its trace.
+	Traceparent string `json:"traceparent,omitempty"`
+	Tracestate  string `json:"tracestate,omitempty"`
+	// EnqueuedAt is when the job was queued, from which workers measure how long tenants wait.
+	EnqueuedAt time.Time `json:"enqueued_at,omitzero"`
+	// Queue is the queue the message was consumed from; it is not part of the message.
+	Queue string `json:"-"`
 }
 
 type RedisQueue struct {
-	client *redis.Client
-	log    *slog.Logger
+	client   *redis.Client
+	password atomic.Pointer[string]
+	log      *slog.Logger
+	// memoryHigh is set by WatchMemory while Redis uses more memory than the watermark.
+	memoryHigh atomic.Bool
+	// keys encrypt job messages; nil leaves them unencrypted.
+	keys *encryption.Keyring
+	// fairTenants queues the jobs published to main queues in per-tenant sub-queues.
+	fairTenants bool
+	// serializer encodes published job messages; consumers decode every format.
+	serializer serializer
 }
 
 func NewRedisQueue(config config.Redis, log *slog.Logger) (*RedisQueue, error) {
@@ -43,49 +92,163 @@ func NewRedisQueue(config config.Redis, log *slog.Logger) (*RedisQueue, error) {
 
 	log.InfoContext(ctx, "connecting to Redis", "host", config.Host, "port", config.Port, "db", config.Database)
 
-	client := redis.NewClient(&redis.Options{
-		Addr:     config.Address(),
-		Password: config.Password,
-		DB:       config.Database,
-	})
+	rq := newRedisQueue(config, log)
 
 	pingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second) //nolint: mnd // Use a longer timeout for initial connection
 	defer cancel()
 
 	log.DebugContext(pingCtx, "pinging Redis connection")
-	if err := client.Ping(pingCtx).Err(); err != nil {
-		if closeErr := client.Close(); closeErr != nil {
+	if err := rq.client.Ping(pingCtx).Err(); err != nil {
+		if closeErr := rq.client.Close(); closeErr != nil {
 			log.ErrorContext(ctx, "failed to close Redis client", "error", closeErr)
 		}
 		return nil, fmt.Errorf("connect to Redis: %w", err)
 	}
 
+	if err := rq.LoadScripts(pingCtx); err != nil {
+		if closeErr := rq.client.Close(); closeErr != nil {
+			log.ErrorContext(ctx, "failed to close Redis client", "error", closeErr)
+		}
+		return nil, err
+	}
+
 	log.InfoContext(ctx, "Redis connection established successfully")
-	return &RedisQueue{client: client, log: log}, nil
+	return rq, nil
+}
+
+// Ping connects to Redis and disconnects again, to wait for Redis before the service connects for
+// good.
+func Ping(ctx context.Context, config config.Redis) error {
+	rq := newRedisQueue(config, slog.Default())
+	defer rq.client.Close()
+
+	if err := rq.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("connect to Redis: %w", err)
+	}
+	return nil
+}
+
+// NewLazyRedisQueue creates a queue that connects on first use instead of failing when Redis is
+// unreachable, for remote regions that may be down while the local one keeps working.
+func NewLazyRedisQueue(config config.Redis, log *slog.Logger) *RedisQueue {
+	return newRedisQueue(config, log)
+}
+
+func newRedisQueue(config config.Redis, log *slog.Logger) *RedisQueue {
+	rq := &RedisQueue{log: log, fairTenants: config.FairTenants, serializer: serializers[config.MessageFormat]}
+	if rq.serializer == nil {
+		// Only publishers validate the format, so consumers of any configuration fall back to JSON
+		rq.serializer = jsonSerializer{}
+	}
+	rq.password.Store(&config.Password)
+
+	// New connections always authenticate with the latest password so rotation needs no restart
+	rq.client = redis.NewClient(&redis.Options{
+		Addr: config.Address(),
+		CredentialsProvider: func() (string, string) {
+			return "", *rq.password.Load()
+		},
+		DB: config.Database,
+	})
+	return rq
+}
+
+// RotatePassword switches to a new Redis password used by connections opened from now on.
+// Established connections stay authenticated, so the pool refreshes as connections are recycled.
+func (rq *RedisQueue) RotatePassword(password string) {
+	ctx := context.Background()
+
+	rq.password.Store(&password)
+
+	if err := rq.HealthCheck(ctx); err != nil {
+		rq.log.ErrorContext(ctx, "redis unreachable after password rotation", "error", err)
+		return
+	}
+
+	rq.log.InfoContext(ctx, "redis password rotated")
+}
+
+// TypeQueue returns the queue jobs of the processing type are published to.
+func TypeQueue(processingType database.ProcessingType) string {
+	return typeQueuePrefix + string(processingType)
+}
+
+// TypePriorityQueue returns the high-priority queue of the processing type.
+func TypePriorityQueue(processingType database.ProcessingType) string {
+	return TypeQueue(processingType) + priorityQueueSuffix
 }
 
 func (rq *RedisQueue) PublishJob(ctx context.Context, message SubmitJobMessage) error {
-	data, err := json.Marshal(message)
+	if rq.memoryHigh.Load() {
+		return ErrMemoryHigh
+	}
+
+	if message.EnqueuedAt.IsZero() {
+		message.EnqueuedAt = time.Now().UTC()
+	}
+	data, err := rq.serializer.marshal(message)
 	if err != nil {
-		return fmt.Errorf("marshal queue message: %w", err)
+		return fmt.Errorf("marshal job message: %w", err)
+	}
+	data, err = rq.seal(message.JobID, nil, data)
+	if err != nil {
+		return err
 	}
 
-	queueName := QueueMain
+	queueName := TypeQueue(message.ProcessingType)
+	fair := false
 	if message.Priority > highPriorityThreshold {
-		queueName = QueuePriority
+		queueName = TypePriorityQueue(message.ProcessingType)
+	} else if rq.fairTenants {
+		queueName = TenantQueue(message.ProcessingType, message.TenantID)
+		fair = true
 	}
 
 	rq.log.DebugContext(ctx, "publishing job to queue", "job_id", message.JobID, "queue", queueName, "processing_type", message.ProcessingType)
 
-	if err := rq.client.LPush(ctx, queueName, data).Err(); err != nil {
+	if fair {
+		err = rq.publishFair(ctx, message, data)
+	} else {
+		err = rq.client.LPush(ctx, queueName, data).Err()
+	}
+	if err != nil {
 		rq.log.ErrorContext(ctx, "failed to publish job to queue", "job_id", message.JobID, "queue", queueName, "error", err)
 		return fmt.Errorf("publish job to queue: %w", err)
 	}
 
+	// The signal is best effort: the controller still polls queue depth periodically
+	if err := rq.client.Publish(ctx, EnqueuedChannel, string(message.ProcessingType)).Err(); err != nil {
+		rq.log.WarnContext(ctx, "failed to publish job enqueued signal", "job_id", message.JobID, "error", err)
+	}
+
 	rq.log.InfoContext(ctx, "job published successfully", "job_id", message.JobID, "queue", queueName)
 	return nil
 }
 
+// SubscribeEnqueued calls notify with the processing type of every job published from now on,
+// until ctx is cancelled. The subscription reconnects on its own after Redis connection errors.
+func (rq *RedisQueue) SubscribeEnqueued(ctx context.Context, notify func(database.ProcessingType)) error {
+	pubsub := rq.client.Subscribe(ctx, EnqueuedChannel)
+	defer pubsub.Close()
+
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe to enqueued channel: %w", err)
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			notify(database.ProcessingType(msg.Payload))
+		}
+	}
+}
+
 func (rq *RedisQueue) GetQueueLength(ctx context.Context, queueName string) (int64, error) {
 	length, err := rq.client.LLen(ctx, queueName).Result()
 	if err != nil {
@@ -95,7 +258,7 @@ func (rq *RedisQueue) GetQueueLength(ctx context.Context, queueName string) (int
 }
 
 func (rq *RedisQueue) GetAllQueuesLength(ctx context.Context) (map[string]int64, error) {
-	queues := []string{QueueMain, QueuePriority, QueueFailed}
+	queues := []string{QueueMain, QueuePriority, QueueFailed, QueuePoison}
 	lengths := make(map[string]int64)
 
 	for _, queue := range queues {
@@ -109,36 +272,400 @@ func (rq *RedisQueue) GetAllQueuesLength(ctx context.Context) (map[string]int64,
 	return lengths, nil
 }
 
-func (rq *RedisQueue) ConsumeJob(ctx context.Context, timeout time.Duration) (*SubmitJobMessage, error) {
-	queues := []string{QueuePriority, QueueMain}
+// GetTypeQueueLengths returns the backlog of every processing type with queued jobs, summing its
+// main, priority and tenant queues. Redis deletes empty lists, so types without jobs are absent.
+func (rq *RedisQueue) GetTypeQueueLengths(ctx context.Context) (map[database.ProcessingType]int64, error) {
+	var keys []string
+	iter := rq.client.Scan(ctx, 0, typeQueuePrefix+"*", scanBatchSize).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("scan type queues: %w", err)
+	}
+
+	lengths := make(map[database.ProcessingType]int64)
+	for _, key := range keys {
+		processingType, ok := typeQueueName(key)
+		if !ok {
+			continue
+		}
+
+		length, err := rq.GetQueueLength(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		lengths[processingType] += length
+	}
+
+	return lengths, nil
+}
+
+// GetTypePriorityQueueLengths returns the priority backlog of every processing type with queued
+// priority jobs.
+func (rq *RedisQueue) GetTypePriorityQueueLengths(ctx context.Context) (map[database.ProcessingType]int64, error) {
+	var keys []string
+	iter := rq.client.Scan(ctx, 0, typeQueuePrefix+"*"+priorityQueueSuffix, scanBatchSize).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("scan type priority queues: %w", err)
+	}
+
+	lengths := make(map[database.ProcessingType]int64, len(keys))
+	for _, key := range keys {
+		length, err := rq.GetQueueLength(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+
+		processingType, _ := typeQueueName(key)
+		lengths[processingType] = length
+	}
+
+	return lengths, nil
+}
+
+// MoveJobs moves up to count of the most recently queued jobs of the processing type to the same
+// queue of dest, returning how many were moved. The main queue gives up its jobs first, then the
+// tenant queues one job each in turn. Priority queues are left alone. A job dest fails to take is
+// put back in its place, so a failure never loses a job.
+func (rq *RedisQueue) MoveJobs(ctx context.Context, processingType database.ProcessingType, dest *RedisQueue, count int64) (int64, error) {
+	queueName := TypeQueue(processingType)
+
+	var moved int64
+	for moved < count {
+		ok, err := rq.moveJob(ctx, processingType, "", dest)
+		if err != nil {
+			return moved, err
+		}
+		if !ok {
+			break
+		}
+		moved++
+	}
+
+	ring := tenantRing(processingType)
+	for moved < count {
+		tenants, err := rq.client.LRange(ctx, ring, 0, -1).Result()
+		if err != nil {
+			return moved, fmt.Errorf("get tenants to move jobs of: %w", err)
+		}
+
+		round := moved
+		for _, tenantID := range tenants {
+			if moved == count {
+				break
+			}
+			ok, err := rq.moveJob(ctx, processingType, tenantID, dest)
+			if err != nil {
+				return moved, err
+			}
+			if ok {
+				moved++
+			}
+		}
+		if moved == round {
+			break
+		}
+	}
+
+	if moved > 0 {
+		if err := dest.client.Publish(ctx, EnqueuedChannel, string(processingType)).Err(); err != nil {
+			rq.log.WarnContext(ctx, "failed to publish job enqueued signal", "queue", queueName, "error", err)
+		}
+	}
+
+	return moved, nil
+}
+
+// moveJob moves the most recently queued job of the processing type's main queue, or of the
+// tenant's queue unless tenantID is empty, to the same queue of dest. It returns false when the
+// queue is empty.
+func (rq *RedisQueue) moveJob(ctx context.Context, processingType database.ProcessingType, tenantID string, dest *RedisQueue) (bool, error) {
+	queueName := TypeQueue(processingType)
+	if tenantID != "" {
+		queueName = TenantQueue(processingType, tenantID)
+	}
+
+	data, err := rq.client.LPop(ctx, queueName).Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("pop job to move: %w", err)
+	}
+
+	if tenantID == "" {
+		err = dest.client.LPush(ctx, queueName, data).Err()
+	} else {
+		err = fairPublishScript.Run(ctx, dest.client, []string{queueName, tenantRing(processingType)}, data, tenantID).Err()
+	}
+	if err != nil {
+		if restoreErr := rq.client.LPush(ctx, queueName, data).Err(); restoreErr != nil {
+			rq.log.ErrorContext(ctx, "failed to restore job that could not be moved", "queue", queueName, "job", data, "error", restoreErr)
+		}
+		return false, fmt.Errorf("push moved job: %w", err)
+	}
+	return true, nil
+}
+
+// ConsumeJobs pops up to limit jobs of the given processing types, preferring priority queues and
+// serving the tenant queues round-robin before the main queues. Jobs left in the shared
+// pre-per-type queues are consumed as well. It waits up to timeout for the first job only, and
+// returns how many popped messages could not be decoded and were quarantined along with the jobs.
+func (rq *RedisQueue) ConsumeJobs(
+	ctx context.Context, timeout time.Duration, types []database.ProcessingType, limit int,
+) ([]*SubmitJobMessage, int, error) {
+	queues := make([]string, 0, 3*len(types)+2) //nolint:mnd // priority, tenant ring and main queue per type
+	for _, processingType := range types {
+		queues = append(queues, TypePriorityQueue(processingType))
+	}
+	queues = append(queues, QueuePriority)
+	for _, processingType := range types {
+		queues = append(queues, tenantRing(processingType))
+	}
+	for _, processingType := range types {
+		queues = append(queues, TypeQueue(processingType))
+	}
+	queues = append(queues, QueueMain)
+
+	return rq.consume(ctx, timeout, queues, limit)
+}
+
+// ConsumePriorityJobs pops up to limit priority jobs of the given processing types, including the
+// shared priority queue. Workers of the burst pool consume only priority jobs.
+func (rq *RedisQueue) ConsumePriorityJobs(
+	ctx context.Context, timeout time.Duration, types []database.ProcessingType, limit int,
+) ([]*SubmitJobMessage, int, error) {
+	queues := make([]string, 0, len(types)+1)
+	for _, processingType := range types {
+		queues = append(queues, TypePriorityQueue(processingType))
+	}
+	queues = append(queues, QueuePriority)
+
+	return rq.consume(ctx, timeout, queues, limit)
+}
+
+// consume pops up to limit jobs from the first of the queues with one, waiting up to timeout for
+// the first.
+func (rq *RedisQueue) consume(ctx context.Context, timeout time.Duration, queues []string, limit int) ([]*SubmitJobMessage, int, error) {
+	// Jobs already queued are popped by the script, which alone serves tenant rings fairly
+	messages, quarantined, err := rq.popFair(ctx, queues, "", "", limit)
+	if !errors.Is(err, ErrNoJobsAvailable) {
+		return messages, len(quarantined), err
+	}
 
 	result, err := rq.client.BRPop(ctx, timeout, queues...).Result()
 	if err != nil {
 		if errors.Is(err, redis.Nil) {
-			return nil, ErrNoJobsAvailable
+			return nil, 0, ErrNoJobsAvailable
 		}
-		return nil, fmt.Errorf("consume job from queue: %w", err)
+		return nil, 0, fmt.Errorf("consume job from queue: %w", err)
 	}
 
 	const expectedBRPopResultLength = 2
 	if len(result) != expectedBRPopResultLength {
-		return nil, fmt.Errorf("unexpected BRPOP result length: %d", len(result))
+		return nil, 0, fmt.Errorf("unexpected BRPOP result length: %d", len(result))
+	}
+
+	queueName, data := result[0], result[1]
+	if strings.HasSuffix(queueName, tenantRingSuffix) {
+		// The pop took the tenant whose turn it is off its ring rather than a job. Putting the tenant
+		// back within the script that pops its job keeps its other jobs from being stranded.
+		messages, quarantined, err = rq.popFair(ctx, queues, queueName, data, limit)
+		return messages, len(quarantined), err
+	}
+
+	messages, quarantined = rq.decodeJobs(ctx, []poppedJob{{queue: queueName, data: data}})
+	if limit > 1 {
+		// Jobs queued along with the one waited for fill the rest of the batch
+		more, moreQuarantined, err := rq.popFair(ctx, queues, "", "", limit-1)
+		if err != nil && !errors.Is(err, ErrNoJobsAvailable) {
+			rq.log.WarnContext(ctx, "failed to consume further jobs of the batch", "error", err)
+		}
+		messages = append(messages, more...)
+		quarantined = append(quarantined, moreQuarantined...)
+	}
+	return messages, len(quarantined), nil
+}
+
+// StealJob pops the next job of one of the given processing types without waiting, for workers
+// whose own queues are empty. Types are tried from the most to the least backlogged, priority
+// queues first; a queue another consumer empties in the meantime is passed over for the next.
+func (rq *RedisQueue) StealJob(ctx context.Context, types []database.ProcessingType) (*SubmitJobMessage, error) {
+	priority, main, err := rq.typeBacklogs(ctx, types)
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]string, 0, 3*len(types)) //nolint:mnd // priority, tenant ring and main queue per type
+	for _, processingType := range byBacklog(priority) {
+		queues = append(queues, TypePriorityQueue(processingType))
+	}
+	for _, processingType := range byBacklog(main) {
+		queues = append(queues, tenantRing(processingType), TypeQueue(processingType))
+	}
+	return rq.popOne(ctx, queues)
+}
+
+// StealPriorityJob pops the next priority job of one of the given processing types without
+// waiting, for workers of the burst pool.
+func (rq *RedisQueue) StealPriorityJob(ctx context.Context, types []database.ProcessingType) (*SubmitJobMessage, error) {
+	priority, _, err := rq.typeBacklogs(ctx, types)
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make([]string, 0, len(types))
+	for _, processingType := range byBacklog(priority) {
+		queues = append(queues, TypePriorityQueue(processingType))
+	}
+	return rq.popOne(ctx, queues)
+}
+
+// typeBacklogs returns the priority and the main backlog of the processing types with queued jobs,
+// the main backlog summing the main queue and the tenant queues.
+func (rq *RedisQueue) typeBacklogs(ctx context.Context, types []database.ProcessingType) (priority, main map[database.ProcessingType]int64, err error) {
+	pipe := rq.client.Pipeline()
+	priorityLengths := make([]*redis.IntCmd, len(types))
+	mainLengths := make([]*redis.IntCmd, len(types))
+	rings := make([]*redis.StringSliceCmd, len(types))
+	for i, processingType := range types {
+		priorityLengths[i] = pipe.LLen(ctx, TypePriorityQueue(processingType))
+		mainLengths[i] = pipe.LLen(ctx, TypeQueue(processingType))
+		rings[i] = pipe.LRange(ctx, tenantRing(processingType), 0, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, nil, fmt.Errorf("get queue lengths: %w", err)
 	}
 
-	queueName := result[0]
-	jobData := result[1]
+	tenantPipe := rq.client.Pipeline()
+	tenantLengths := make([][]*redis.IntCmd, len(types))
+	for i, processingType := range types {
+		for _, tenantID := range rings[i].Val() {
+			tenantLengths[i] = append(tenantLengths[i], tenantPipe.LLen(ctx, TenantQueue(processingType, tenantID)))
+		}
+	}
+	if tenantPipe.Len() > 0 {
+		if _, err := tenantPipe.Exec(ctx); err != nil {
+			return nil, nil, fmt.Errorf("get tenant queue lengths: %w", err)
+		}
+	}
 
-	rq.log.DebugContext(ctx, "consumed job from queue", "queue", queueName, "data_length", len(jobData))
+	priority = make(map[database.ProcessingType]int64, len(types))
+	main = make(map[database.ProcessingType]int64, len(types))
+	for i, processingType := range types {
+		if length := priorityLengths[i].Val(); length > 0 {
+			priority[processingType] = length
+		}
+		length := mainLengths[i].Val()
+		for _, tenantLength := range tenantLengths[i] {
+			length += tenantLength.Val()
+		}
+		if length > 0 {
+			main[processingType] = length
+		}
+	}
+	return priority, main, nil
+}
 
-	var message SubmitJobMessage
-	if err := json.Unmarshal([]byte(jobData), &message); err != nil {
-		return nil, fmt.Errorf("unmarshal job message: %w", err)
+// byBacklog returns the processing types from the most to the least backlogged.
+func byBacklog(backlog map[database.ProcessingType]int64) []database.ProcessingType {
+	types := slices.Collect(maps.Keys(backlog))
+	slices.SortFunc(types, func(a, b database.ProcessingType) int {
+		return cmp.Or(cmp.Compare(backlog[b], backlog[a]), cmp.Compare(a, b))
+	})
+	return types
+}
+
+// poppedJob is a job message as popped from its queue.
+type poppedJob struct {
+	queue string
+	data  string
+}
+
+// decodeJobs decodes popped jobs and counts them as consumed. Undecodable messages are quarantined,
+// returning why each could not be decoded in their place.
+func (rq *RedisQueue) decodeJobs(ctx context.Context, popped []poppedJob) ([]*SubmitJobMessage, []error) {
+	messages := make([]*SubmitJobMessage, 0, len(popped))
+	var quarantined []error
+	for _, job := range popped {
+		rq.log.DebugContext(ctx, "consumed job from queue", "queue", job.queue, "data_length", len(job.data))
+
+		var message SubmitJobMessage
+		data, err := rq.unseal([]byte(job.data))
+		if err == nil {
+			err = unmarshalJob(data, &message)
+		}
+		if err != nil {
+			// Requeued, the message would fail every consumer again, so it is set aside for inspection
+			rq.quarantineUndecodable(ctx, job.queue, job.data, err)
+			quarantined = append(quarantined, fmt.Errorf("%w: decode job message: %w", ErrMessageQuarantined, err))
+			continue
+		}
+		message.Queue = job.queue
+		messages = append(messages, &message)
+
+		rq.log.InfoContext(ctx, "job consumed successfully", "job_id", message.JobID, "queue", job.queue)
+	}
+	if len(messages) == 0 {
+		return messages, quarantined
 	}
 
-	rq.log.InfoContext(ctx, "job consumed successfully", "job_id", message.JobID, "queue", queueName)
-	return &message, nil
+	// The counter only feeds resource recommendations, so a failure must not lose the jobs
+	_, err := rq.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, message := range messages {
+			pipe.HIncrBy(ctx, ConsumedJobsKey, string(message.ProcessingType), 1)
+		}
+		return nil
+	})
+	if err != nil {
+		rq.log.WarnContext(ctx, "failed to count consumed jobs", "jobs", len(messages), "error", err)
+	}
+	return messages, quarantined
 }
 
+// GetConsumedJobs returns the number of jobs consumed so far per processing type.
+func (rq *RedisQueue) GetConsumedJobs(ctx context.Context) (map[database.ProcessingType]int64, error) {
+	counts, err := rq.client.HGetAll(ctx, ConsumedJobsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get consumed jobs: %w", err)
+	}
+
+	consumed := make(map[database.ProcessingType]int64, len(counts))
+	for processingType, count := range counts {
+		n, err := strconv.ParseInt(count, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse consumed jobs of %s: %w", processingType, err)
+		}
+		consumed[database.ProcessingType(processingType)] = n
+	}
+	return consumed, nil
+}
+
+// failScript pushes the failed job message ARGV[1] to the failed queue KEYS[1] and counts the
+// failure in the deliveries hash KEYS[2] of the job, kept for ARGV[3] seconds. The message ends
+// with the placeholder ARGV[2], its retry count of zero, which is replaced with the failures of the
+// job so far; counting and pushing in one step, concurrent failures of a job never share a count.
+var failScript = redis.NewScript(`
+local failures = redis.call('HINCRBY', KEYS[2], 'failures', 1)
+redis.call('EXPIRE', KEYS[2], ARGV[3])
+local data = ARGV[1]
+if string.sub(data, -#ARGV[2]) == ARGV[2] then
+	data = string.sub(data, 1, #data - #ARGV[2]) .. '"retry_count":' .. failures .. '}'
+end
+redis.call('LPUSH', KEYS[1], data)
+return failures
+`)
+
+// retryCountPlaceholder is how failed queue messages end before failScript sets their retry count:
+// the retry count is the last field of both plain and sealed failed messages.
+const retryCountPlaceholder = `"retry_count":0}`
+
+// PublishToFailedQueue pushes the message of a failed job to the failed queue, with the number of
+// times the job failed so far as its retry count.
 func (rq *RedisQueue) PublishToFailedQueue(ctx context.Context, message SubmitJobMessage, errorMsg string) error {
 	failedMessage := struct {
 		SubmitJobMessage
@@ -150,15 +677,20 @@ func (rq *RedisQueue) PublishToFailedQueue(ctx context.Context, message SubmitJo
 		SubmitJobMessage: message,
 		FailedAt:         time.Now(),
 		ErrorMessage:     errorMsg,
-		RetryCount:       1,
 	}
 
+	// Failed messages stay JSON, which the retry count is written into
 	data, err := json.Marshal(failedMessage)
 	if err != nil {
 		return fmt.Errorf("marshal failed message: %w", err)
 	}
+	data, err = rq.seal(message.JobID, &failedMessage.FailedAt, data)
+	if err != nil {
+		return err
+	}
 
-	if err := rq.client.LPush(ctx, QueueFailed, data).Err(); err != nil {
+	keys := []string{QueueFailed, deliveriesKey(message.JobID)}
+	if err := failScript.Run(ctx, rq.client, keys, data, retryCountPlaceholder, int64(deliveriesTTL.Seconds())).Err(); err != nil {
 		return fmt.Errorf("publish to failed queue: %w", err)
 	}
 
@@ -188,3 +720,25 @@ func (rq *RedisQueue) GetStats(ctx context.Context) (map[string]interface{}, err
 
 	return stats, nil
 }
+
+// AppendScalingDecision stores an encoded scaling decision, keeping the newest maxEntries.
+func (rq *RedisQueue) AppendScalingDecision(ctx context.Context, decision []byte, maxEntries int64) error {
+	_, err := rq.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.LPush(ctx, ScalingHistoryKey, decision)
+		pipe.LTrim(ctx, ScalingHistoryKey, 0, maxEntries-1)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("append scaling decision: %w", err)
+	}
+	return nil
+}
+
+// GetScalingDecisions returns up to limit encoded scaling decisions, newest first.
+func (rq *RedisQueue) GetScalingDecisions(ctx context.Context, limit int64) ([]string, error) {
+	decisions, err := rq.client.LRange(ctx, ScalingHistoryKey, 0, limit-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get scaling decisions: %w", err)
+	}
+	return decisions, nil
+}
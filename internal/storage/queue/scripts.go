@@ -0,0 +1,34 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scripts are the Lua scripts of the queue operations that take several commands, run atomically
+// by Redis. Run executes them by SHA and falls back to sending the source only when Redis does
+// not have them cached.
+var scripts = map[string]*redis.Script{
+	"boost":          boostScript,
+	"claim":          claimScript,
+	"expire":         expireScript,
+	"fail":           failScript,
+	"fair_consume":   fairConsumeScript,
+	"fair_publish":   fairPublishScript,
+	"queue_position": queuePositionScript,
+	"rate_limit":     rateLimitScript,
+}
+
+// LoadScripts loads the Lua scripts into the Redis script cache, so that they run by SHA from the
+// first call and a script Redis rejects fails startup rather than the first operation using it.
+// Redis empties the cache on restart, after which Run loads them again as they are used.
+func (rq *RedisQueue) LoadScripts(ctx context.Context) error {
+	for name, script := range scripts {
+		if err := script.Load(ctx, rq.client).Err(); err != nil {
+			return fmt.Errorf("load %s script: %w", name, err)
+		}
+	}
+	return nil
+}
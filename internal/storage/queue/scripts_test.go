@@ -0,0 +1,538 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// redisContainer is the Redis server the tests of the scripts share, started by the first test
+// needing it and terminated by TestMain.
+var (
+	redisOnce      sync.Once
+	redisContainer *tcredis.RedisContainer
+	redisErr       error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if redisContainer != nil {
+		_ = testcontainers.TerminateContainer(redisContainer)
+	}
+	os.Exit(code)
+}
+
+// newTestQueue returns a queue on the emptied database of the shared Redis container, and skips
+// the test when Docker is not available.
+func newTestQueue(t *testing.T) *RedisQueue {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	redisOnce.Do(func() {
+		redisContainer, redisErr = tcredis.Run(ctx, "redis:7-alpine")
+	})
+	require.NoError(t, redisErr)
+
+	host, err := redisContainer.Host(ctx)
+	require.NoError(t, err)
+	port, err := redisContainer.MappedPort(ctx, "6379/tcp")
+	require.NoError(t, err)
+
+	rq := newRedisQueue(config.Redis{Host: host, Port: port.Int()}, slog.New(slog.DiscardHandler))
+	t.Cleanup(func() { _ = rq.Close() })
+	require.NoError(t, rq.client.FlushDB(ctx).Err())
+	return rq
+}
+
+// flushScripts empties the script cache, as a Redis restart does, so that scripts run by SHA get
+// NOSCRIPT.
+func flushScripts(t *testing.T, rq *RedisQueue) {
+	t.Helper()
+	require.NoError(t, rq.client.ScriptFlush(context.Background()).Err())
+}
+
+func testMessage(tenantID string, priority int) SubmitJobMessage {
+	return SubmitJobMessage{
+		JobID:          uuid.New(),
+		TenantID:       tenantID,
+		ProcessingType: database.ProcessingTypeWordCount,
+		Priority:       priority,
+	}
+}
+
+func messageIDs(messages []*SubmitJobMessage) []uuid.UUID {
+	ids := make([]uuid.UUID, len(messages))
+	for i, message := range messages {
+		ids[i] = message.JobID
+	}
+	return ids
+}
+
+func TestLoadScripts(t *testing.T) {
+	rq := newTestQueue(t)
+	ctx := context.Background()
+	flushScripts(t, rq)
+
+	require.NoError(t, rq.LoadScripts(ctx))
+
+	for name, script := range scripts {
+		exists, err := script.Exists(ctx, rq.client).Result()
+		require.NoError(t, err)
+		assert.Equal(t, []bool{true}, exists, name)
+	}
+}
+
+func TestClaimJobs(t *testing.T) {
+	ctx := context.Background()
+	lease := time.Minute
+
+	t.Run("new claims", func(t *testing.T) {
+		rq := newTestQueue(t)
+		jobIDs := []uuid.UUID{uuid.New(), uuid.New()}
+
+		claims, err := rq.ClaimJobs(ctx, jobIDs, "worker-1", lease)
+
+		require.NoError(t, err)
+		assert.Equal(t, []JobClaim{{Claimed: true}, {Claimed: true}}, claims)
+		for _, jobID := range jobIDs {
+			holder, err := rq.client.Get(ctx, processingKey(jobID)).Result()
+			require.NoError(t, err)
+			assert.Equal(t, "worker-1", holder)
+
+			ttl, err := rq.client.PTTL(ctx, processingKey(jobID)).Result()
+			require.NoError(t, err)
+			assert.Greater(t, ttl, time.Duration(0))
+			assert.LessOrEqual(t, ttl, lease)
+		}
+		heartbeat, err := rq.client.HGet(ctx, WorkerHeartbeatsKey, "worker-1").Int64()
+		require.NoError(t, err)
+		assert.InDelta(t, time.Now().Unix(), heartbeat, 5)
+	})
+
+	t.Run("duplicate delivery", func(t *testing.T) {
+		rq := newTestQueue(t)
+		claimed, unclaimed := uuid.New(), uuid.New()
+		_, err := rq.ClaimJobs(ctx, []uuid.UUID{claimed}, "worker-1", lease)
+		require.NoError(t, err)
+
+		claims, err := rq.ClaimJobs(ctx, []uuid.UUID{claimed, unclaimed}, "worker-2", lease)
+
+		require.NoError(t, err)
+		assert.Equal(t, []JobClaim{{Claimed: false, Holder: "worker-1"}, {Claimed: true}}, claims)
+		holder, err := rq.client.Get(ctx, processingKey(claimed)).Result()
+		require.NoError(t, err)
+		assert.Equal(t, "worker-1", holder)
+	})
+
+	t.Run("reloads the script Redis lost", func(t *testing.T) {
+		rq := newTestQueue(t)
+		flushScripts(t, rq)
+
+		claims, err := rq.ClaimJobs(ctx, []uuid.UUID{uuid.New()}, "worker-1", lease)
+
+		require.NoError(t, err)
+		assert.Equal(t, []JobClaim{{Claimed: true}}, claims)
+	})
+
+	t.Run("heartbeats key of the wrong type", func(t *testing.T) {
+		rq := newTestQueue(t)
+		require.NoError(t, rq.client.Set(ctx, WorkerHeartbeatsKey, "corrupted", 0).Err())
+
+		_, err := rq.ClaimJobs(ctx, []uuid.UUID{uuid.New()}, "worker-1", lease)
+
+		assert.ErrorContains(t, err, "WRONGTYPE")
+	})
+}
+
+func TestPublishToFailedQueue(t *testing.T) {
+	ctx := context.Background()
+	retryCounts := func(t *testing.T, rq *RedisQueue) []int {
+		t.Helper()
+		messages, err := rq.client.LRange(ctx, QueueFailed, 0, -1).Result()
+		require.NoError(t, err)
+
+		counts := make([]int, len(messages))
+		for i, data := range messages {
+			var failed struct {
+				RetryCount int `json:"retry_count"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(data), &failed))
+			counts[i] = failed.RetryCount
+		}
+		return counts
+	}
+
+	t.Run("counts the failures of the job", func(t *testing.T) {
+		rq := newTestQueue(t)
+		message := testMessage("", 0)
+
+		require.NoError(t, rq.PublishToFailedQueue(ctx, message, "first"))
+		require.NoError(t, rq.PublishToFailedQueue(ctx, message, "second"))
+		require.NoError(t, rq.PublishToFailedQueue(ctx, testMessage("", 0), "other job"))
+
+		assert.Equal(t, []int{1, 2, 1}, retryCounts(t, rq))
+		ttl, err := rq.client.TTL(ctx, deliveriesKey(message.JobID)).Result()
+		require.NoError(t, err)
+		assert.Greater(t, ttl, time.Duration(0))
+		assert.LessOrEqual(t, ttl, deliveriesTTL)
+	})
+
+	t.Run("runs after Redis lost the script", func(t *testing.T) {
+		rq := newTestQueue(t)
+		flushScripts(t, rq)
+
+		require.NoError(t, rq.PublishToFailedQueue(ctx, testMessage("", 0), "failed"))
+
+		assert.Equal(t, []int{1}, retryCounts(t, rq))
+	})
+
+	t.Run("keeps messages without the placeholder", func(t *testing.T) {
+		rq := newTestQueue(t)
+		keys := []string{QueueFailed, deliveriesKey(uuid.New())}
+
+		failures, err := failScript.Run(ctx, rq.client, keys, `{"retry_count":3}`, retryCountPlaceholder, 60).Int64()
+
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), failures)
+		messages, err := rq.client.LRange(ctx, QueueFailed, 0, -1).Result()
+		require.NoError(t, err)
+		assert.Equal(t, []string{`{"retry_count":3}`}, messages)
+	})
+
+	t.Run("deliveries key of the wrong type", func(t *testing.T) {
+		rq := newTestQueue(t)
+		message := testMessage("", 0)
+		require.NoError(t, rq.client.Set(ctx, deliveriesKey(message.JobID), "corrupted", 0).Err())
+
+		err := rq.PublishToFailedQueue(ctx, message, "failed")
+
+		assert.ErrorContains(t, err, "WRONGTYPE")
+		length, err := rq.client.LLen(ctx, QueueFailed).Result()
+		require.NoError(t, err)
+		assert.Zero(t, length)
+	})
+}
+
+func TestBoostJob(t *testing.T) {
+	ctx := context.Background()
+	types := []database.ProcessingType{database.ProcessingTypeWordCount}
+
+	t.Run("moves the job behind the queued priority jobs", func(t *testing.T) {
+		rq := newTestQueue(t)
+		queued, boosted, priority := testMessage("", 0), testMessage("", 0), testMessage("", 9)
+		for _, message := range []SubmitJobMessage{queued, boosted, priority} {
+			require.NoError(t, rq.PublishJob(ctx, message))
+		}
+
+		require.NoError(t, rq.BoostJob(ctx, boosted.JobID, boosted.ProcessingType, ""))
+
+		messages, _, err := rq.ConsumeJobs(ctx, time.Second, types, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{priority.JobID, boosted.JobID, queued.JobID}, messageIDs(messages))
+	})
+
+	t.Run("moves the job from its tenant queue", func(t *testing.T) {
+		rq := newTestQueue(t)
+		rq.fairTenants = true
+		message := testMessage("acme", 0)
+		require.NoError(t, rq.PublishJob(ctx, message))
+
+		require.NoError(t, rq.BoostJob(ctx, message.JobID, message.ProcessingType, "acme"))
+
+		length, err := rq.client.LLen(ctx, TenantQueue(message.ProcessingType, "acme")).Result()
+		require.NoError(t, err)
+		assert.Zero(t, length)
+		length, err = rq.client.LLen(ctx, TypePriorityQueue(message.ProcessingType)).Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), length)
+	})
+
+	t.Run("runs after Redis lost the script", func(t *testing.T) {
+		rq := newTestQueue(t)
+		message := testMessage("", 0)
+		require.NoError(t, rq.PublishJob(ctx, message))
+		flushScripts(t, rq)
+
+		assert.NoError(t, rq.BoostJob(ctx, message.JobID, message.ProcessingType, ""))
+	})
+
+	t.Run("job not queued", func(t *testing.T) {
+		rq := newTestQueue(t)
+		require.NoError(t, rq.PublishJob(ctx, testMessage("", 0)))
+
+		err := rq.BoostJob(ctx, uuid.New(), database.ProcessingTypeWordCount, "")
+
+		assert.ErrorIs(t, err, ErrJobNotQueued)
+	})
+
+	t.Run("job already boosted", func(t *testing.T) {
+		rq := newTestQueue(t)
+		message := testMessage("", 9)
+		require.NoError(t, rq.PublishJob(ctx, message))
+
+		err := rq.BoostJob(ctx, message.JobID, message.ProcessingType, "")
+
+		assert.ErrorIs(t, err, ErrJobNotQueued)
+	})
+}
+
+func TestPopExpiredFailed(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("pops the expired messages oldest first", func(t *testing.T) {
+		rq := newTestQueue(t)
+		older, newer := testMessage("", 0), testMessage("", 0)
+		require.NoError(t, rq.PublishToFailedQueue(ctx, older, "failed"))
+		require.NoError(t, rq.PublishToFailedQueue(ctx, newer, "failed"))
+
+		popped, err := rq.PopExpiredFailed(ctx, time.Now().Add(time.Minute), 10)
+
+		require.NoError(t, err)
+		require.Len(t, popped, 2)
+		assert.Contains(t, popped[0], older.JobID.String())
+		assert.Contains(t, popped[1], newer.JobID.String())
+		length, err := rq.client.LLen(ctx, QueueFailed).Result()
+		require.NoError(t, err)
+		assert.Zero(t, length)
+	})
+
+	t.Run("keeps the messages failed after the cutoff", func(t *testing.T) {
+		rq := newTestQueue(t)
+		require.NoError(t, rq.PublishToFailedQueue(ctx, testMessage("", 0), "failed"))
+
+		popped, err := rq.PopExpiredFailed(ctx, time.Now().Add(-time.Minute), 10)
+
+		require.NoError(t, err)
+		assert.Empty(t, popped)
+		length, err := rq.client.LLen(ctx, QueueFailed).Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), length)
+	})
+
+	t.Run("runs after Redis lost the script", func(t *testing.T) {
+		rq := newTestQueue(t)
+		require.NoError(t, rq.PublishToFailedQueue(ctx, testMessage("", 0), "failed"))
+		flushScripts(t, rq)
+
+		popped, err := rq.PopExpiredFailed(ctx, time.Now().Add(time.Minute), 10)
+
+		require.NoError(t, err)
+		assert.Len(t, popped, 1)
+	})
+
+	t.Run("stops at a message changed in the meantime", func(t *testing.T) {
+		rq := newTestQueue(t)
+		require.NoError(t, rq.client.LPush(ctx, QueueFailed, "oldest", "retried").Err())
+
+		popped, err := expireScript.Run(ctx, rq.client, []string{QueueFailed}, "oldest", "expired").StringSlice()
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{"oldest"}, popped)
+		messages, err := rq.client.LRange(ctx, QueueFailed, 0, -1).Result()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"retried"}, messages)
+	})
+}
+
+func TestFairQueues(t *testing.T) {
+	ctx := context.Background()
+	processingType := database.ProcessingTypeWordCount
+	types := []database.ProcessingType{processingType}
+
+	t.Run("consumes tenants round-robin", func(t *testing.T) {
+		rq := newTestQueue(t)
+		rq.fairTenants = true
+		acme1, acme2, globex := testMessage("acme", 0), testMessage("acme", 0), testMessage("globex", 0)
+		for _, message := range []SubmitJobMessage{acme1, acme2, globex} {
+			require.NoError(t, rq.PublishJob(ctx, message))
+		}
+
+		messages, _, err := rq.ConsumeJobs(ctx, time.Second, types, 3)
+
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{acme1.JobID, globex.JobID, acme2.JobID}, messageIDs(messages))
+		assert.Equal(t, TenantQueue(processingType, "globex"), messages[1].Queue)
+		exists, err := rq.client.Exists(ctx, tenantRing(processingType)).Result()
+		require.NoError(t, err)
+		assert.Zero(t, exists, "tenants without jobs leave the ring")
+	})
+
+	t.Run("queues a tenant on the ring once", func(t *testing.T) {
+		rq := newTestQueue(t)
+		rq.fairTenants = true
+		require.NoError(t, rq.PublishJob(ctx, testMessage("acme", 0)))
+		require.NoError(t, rq.PublishJob(ctx, testMessage("acme", 0)))
+		require.NoError(t, rq.PublishJob(ctx, testMessage("", 0)))
+
+		ring, err := rq.client.LRange(ctx, tenantRing(processingType), 0, -1).Result()
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{tenantOrDefault(""), "acme"}, ring)
+	})
+
+	t.Run("puts back the tenant of a blocking pop", func(t *testing.T) {
+		rq := newTestQueue(t)
+		rq.fairTenants = true
+		message := testMessage("acme", 0)
+		require.NoError(t, rq.PublishJob(ctx, message))
+		ring := tenantRing(processingType)
+		require.NoError(t, rq.client.Del(ctx, ring).Err())
+
+		messages, _, err := rq.popFair(ctx, []string{ring}, ring, "acme", 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{message.JobID}, messageIDs(messages))
+	})
+
+	t.Run("runs after Redis lost the scripts", func(t *testing.T) {
+		rq := newTestQueue(t)
+		rq.fairTenants = true
+		flushScripts(t, rq)
+		message := testMessage("acme", 0)
+		require.NoError(t, rq.PublishJob(ctx, message))
+		flushScripts(t, rq)
+
+		messages, _, err := rq.ConsumeJobs(ctx, time.Second, types, 1)
+
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{message.JobID}, messageIDs(messages))
+	})
+
+	t.Run("no jobs available", func(t *testing.T) {
+		rq := newTestQueue(t)
+
+		_, _, err := rq.popFair(ctx, []string{tenantRing(processingType), TypeQueue(processingType)}, "", "", 1)
+
+		assert.ErrorIs(t, err, ErrNoJobsAvailable)
+	})
+}
+
+func TestGetQueuePosition(t *testing.T) {
+	ctx := context.Background()
+	processingType := database.ProcessingTypeWordCount
+
+	rq := newTestQueue(t)
+	priority := testMessage("", 9)
+	acme1, acme2, globex := testMessage("acme", 0), testMessage("acme", 0), testMessage("globex", 0)
+	plain := testMessage("", 0)
+	require.NoError(t, rq.PublishJob(ctx, priority))
+	rq.fairTenants = true
+	for _, message := range []SubmitJobMessage{acme1, acme2, globex} {
+		require.NoError(t, rq.PublishJob(ctx, message))
+	}
+	rq.fairTenants = false
+	require.NoError(t, rq.PublishJob(ctx, plain))
+
+	tests := []struct {
+		name      string
+		message   SubmitJobMessage
+		wantAhead int64
+	}{
+		{name: "priority queue", message: priority, wantAhead: 0},
+		{name: "first job of a tenant", message: acme1, wantAhead: 1},
+		{name: "second job of a tenant", message: acme2, wantAhead: 3},
+		{name: "first job of another tenant", message: globex, wantAhead: 1},
+		{name: "main queue after the tenant queues", message: plain, wantAhead: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ahead, queued, err := rq.GetQueuePosition(ctx, tt.message.JobID, processingType, tt.message.TenantID)
+
+			require.NoError(t, err)
+			assert.True(t, queued)
+			assert.Equal(t, tt.wantAhead, ahead)
+		})
+	}
+
+	t.Run("runs after Redis lost the script", func(t *testing.T) {
+		flushScripts(t, rq)
+
+		ahead, queued, err := rq.GetQueuePosition(ctx, acme2.JobID, processingType, "acme")
+
+		require.NoError(t, err)
+		assert.True(t, queued)
+		assert.Equal(t, int64(3), ahead)
+	})
+
+	t.Run("job not queued", func(t *testing.T) {
+		_, queued, err := rq.GetQueuePosition(ctx, uuid.New(), processingType, "")
+
+		require.NoError(t, err)
+		assert.False(t, queued)
+	})
+}
+
+func TestAllowRequest(t *testing.T) {
+	ctx := context.Background()
+	window := time.Minute
+
+	t.Run("rejects requests beyond the limit", func(t *testing.T) {
+		rq := newTestQueue(t)
+		for range 2 {
+			allowed, _, err := rq.AllowRequest(ctx, "client", 2, window)
+			require.NoError(t, err)
+			require.True(t, allowed)
+		}
+
+		allowed, retryAfter, err := rq.AllowRequest(ctx, "client", 2, window)
+
+		require.NoError(t, err)
+		assert.False(t, allowed)
+		assert.Greater(t, retryAfter, time.Duration(0))
+		assert.LessOrEqual(t, retryAfter, window)
+		count, err := rq.client.ZCard(ctx, rateLimitKeyPrefix+"client").Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count, "rejected requests are not recorded")
+
+		allowed, _, err = rq.AllowRequest(ctx, "other", 2, window)
+		require.NoError(t, err)
+		assert.True(t, allowed, "clients are limited separately")
+	})
+
+	t.Run("admits requests again after the window", func(t *testing.T) {
+		rq := newTestQueue(t)
+		allowed, _, err := rq.AllowRequest(ctx, "client", 1, 50*time.Millisecond)
+		require.NoError(t, err)
+		require.True(t, allowed)
+
+		time.Sleep(100 * time.Millisecond)
+		allowed, _, err = rq.AllowRequest(ctx, "client", 1, 50*time.Millisecond)
+
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("runs after Redis lost the script", func(t *testing.T) {
+		rq := newTestQueue(t)
+		flushScripts(t, rq)
+
+		allowed, _, err := rq.AllowRequest(ctx, "client", 1, window)
+
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	})
+
+	t.Run("key of the wrong type", func(t *testing.T) {
+		rq := newTestQueue(t)
+		require.NoError(t, rq.client.Set(ctx, rateLimitKeyPrefix+"client", "corrupted", 0).Err())
+
+		_, _, err := rq.AllowRequest(ctx, "client", 1, window)
+
+		assert.ErrorContains(t, err, "WRONGTYPE")
+	})
+}
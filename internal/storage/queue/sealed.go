@@ -0,0 +1,75 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rsav/k8s-learning/internal/encryption"
+)
+
+// sealedMessage is an encrypted job message. The job ID, and when the job failed for failed queue
+// messages, stay readable, so that jobs can be boosted and failed messages expired without the key.
+// Failed queue messages end with their retry count, which is set after sealing.
+type sealedMessage struct {
+	JobID      uuid.UUID  `json:"job_id"`
+	FailedAt   *time.Time `json:"failed_at,omitempty"`
+	Encrypted  []byte     `json:"encrypted"`
+	RetryCount *int       `json:"retry_count,omitempty"`
+}
+
+// SetKeyring sets the keys job messages are encrypted and decrypted with. Messages are encrypted
+// only when the keyring has an active key, and unencrypted ones are always read.
+func (rq *RedisQueue) SetKeyring(keys *encryption.Keyring) {
+	rq.keys = keys
+}
+
+// seal encrypts an encoded queue message when the keyring has an active key.
+func (rq *RedisQueue) seal(jobID uuid.UUID, failedAt *time.Time, data []byte) ([]byte, error) {
+	if !rq.keys.Encrypts() {
+		return data, nil
+	}
+
+	encrypted, err := rq.keys.Seal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt queue message: %w", err)
+	}
+
+	sealed := sealedMessage{JobID: jobID, FailedAt: failedAt, Encrypted: encrypted}
+	if failedAt != nil {
+		sealed.RetryCount = new(int)
+	}
+	data, err = json.Marshal(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("marshal sealed queue message: %w", err)
+	}
+	return data, nil
+}
+
+// unseal returns the encoded message of a message sealed by seal, whether encrypted or not.
+// Unencrypted messages in the binary formats have no envelope.
+func (rq *RedisQueue) unseal(data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] != '{' {
+		return data, nil
+	}
+
+	var sealed sealedMessage
+	if err := json.Unmarshal(data, &sealed); err != nil {
+		return nil, err
+	}
+	if len(sealed.Encrypted) == 0 {
+		return data, nil
+	}
+	if !encryption.IsEncrypted(sealed.Encrypted) {
+		return nil, errors.New("sealed queue message is not encrypted")
+	}
+
+	decrypted, err := rq.keys.Open(sealed.Encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt queue message: %w", err)
+	}
+	return decrypted, nil
+}
@@ -0,0 +1,185 @@
+package telemetry
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// CounterVec is a Prometheus counter vector whose changes are also sent to the configured sinks.
+type CounterVec struct {
+	vec    *prometheus.CounterVec
+	name   string
+	labels []string
+}
+
+// NewCounterVec registers a counter vector with the default Prometheus registry.
+func NewCounterVec(opts prometheus.CounterOpts, labels []string) *CounterVec {
+	register(opts.Name)
+	return &CounterVec{vec: promauto.NewCounterVec(opts, labels), name: opts.Name, labels: labels}
+}
+
+// WithLabelValues returns the counter of the given label values.
+func (v *CounterVec) WithLabelValues(values ...string) Counter {
+	return Counter{counter: v.vec.WithLabelValues(values...), metric: Metric{Name: v.name, Labels: v.labels, Values: values}}
+}
+
+// DeletePartialMatch deletes the counters whose labels match, returning how many were deleted.
+func (v *CounterVec) DeletePartialMatch(labels prometheus.Labels) int {
+	return v.vec.DeletePartialMatch(labels)
+}
+
+// Counter is a single counter of a CounterVec, or one created with NewCounter.
+type Counter struct {
+	counter prometheus.Counter
+	metric  Metric
+}
+
+// NewCounter registers a counter without labels with the default Prometheus registry.
+func NewCounter(opts prometheus.CounterOpts) Counter {
+	register(opts.Name)
+	return Counter{counter: promauto.NewCounter(opts), metric: Metric{Name: opts.Name}}
+}
+
+func (c Counter) Inc() {
+	c.Add(1)
+}
+
+func (c Counter) Add(delta float64) {
+	c.counter.Add(delta)
+	for _, sink := range currentSinks() {
+		sink.Count(c.metric, delta)
+	}
+}
+
+// GaugeVec is a Prometheus gauge vector whose values are also sent to the configured sinks.
+type GaugeVec struct {
+	vec    *prometheus.GaugeVec
+	name   string
+	labels []string
+}
+
+// NewGaugeVec registers a gauge vector with the default Prometheus registry.
+func NewGaugeVec(opts prometheus.GaugeOpts, labels []string) *GaugeVec {
+	register(opts.Name)
+	return &GaugeVec{vec: promauto.NewGaugeVec(opts, labels), name: opts.Name, labels: labels}
+}
+
+// WithLabelValues returns the gauge of the given label values.
+func (v *GaugeVec) WithLabelValues(values ...string) Gauge {
+	return Gauge{gauge: v.vec.WithLabelValues(values...), metric: Metric{Name: v.name, Labels: v.labels, Values: values}}
+}
+
+// Reset deletes all gauges of the vector.
+func (v *GaugeVec) Reset() {
+	v.vec.Reset()
+}
+
+// DeletePartialMatch deletes the gauges whose labels match, returning how many were deleted.
+func (v *GaugeVec) DeletePartialMatch(labels prometheus.Labels) int {
+	return v.vec.DeletePartialMatch(labels)
+}
+
+// Gauge is a single gauge of a GaugeVec, or one created with NewGauge. Sinks receive the value of
+// the gauge after every change.
+type Gauge struct {
+	gauge  prometheus.Gauge
+	metric Metric
+}
+
+// NewGauge registers a gauge without labels with the default Prometheus registry.
+func NewGauge(opts prometheus.GaugeOpts) Gauge {
+	register(opts.Name)
+	return Gauge{gauge: promauto.NewGauge(opts), metric: Metric{Name: opts.Name}}
+}
+
+func (g Gauge) Set(value float64) {
+	g.gauge.Set(value)
+	for _, sink := range currentSinks() {
+		sink.Gauge(g.metric, value)
+	}
+}
+
+func (g Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g Gauge) Add(delta float64) {
+	g.gauge.Add(delta)
+
+	sinks := currentSinks()
+	if len(sinks) == 0 {
+		return
+	}
+	var current dto.Metric
+	if err := g.gauge.Write(&current); err != nil {
+		return
+	}
+	for _, sink := range sinks {
+		sink.Gauge(g.metric, current.GetGauge().GetValue())
+	}
+}
+
+// HistogramVec is a Prometheus histogram vector whose observations are also sent to the configured
+// sinks.
+type HistogramVec struct {
+	vec    *prometheus.HistogramVec
+	name   string
+	labels []string
+}
+
+// NewHistogramVec registers a histogram vector with the default Prometheus registry.
+func NewHistogramVec(opts prometheus.HistogramOpts, labels []string) *HistogramVec {
+	register(opts.Name)
+	return &HistogramVec{vec: promauto.NewHistogramVec(opts, labels), name: opts.Name, labels: labels}
+}
+
+// WithLabelValues returns the histogram of the given label values.
+func (v *HistogramVec) WithLabelValues(values ...string) Histogram {
+	return Histogram{
+		observer: v.vec.WithLabelValues(values...),
+		metric:   Metric{Name: v.name, Labels: v.labels, Values: values},
+	}
+}
+
+// Histogram is a single histogram of a HistogramVec.
+type Histogram struct {
+	observer prometheus.Observer
+	metric   Metric
+}
+
+func (h Histogram) Observe(value float64) {
+	h.observer.Observe(value)
+	h.forward(value)
+}
+
+// ObserveWithExemplar records value and attaches the exemplar to it in Prometheus; sinks only get
+// the value.
+func (h Histogram) ObserveWithExemplar(value float64, exemplar prometheus.Labels) {
+	eo, ok := h.observer.(prometheus.ExemplarObserver)
+	if !ok {
+		h.Observe(value)
+		return
+	}
+	eo.ObserveWithExemplar(value, exemplar)
+	h.forward(value)
+}
+
+// ObserveWithTraceID records value and attaches the trace ID to it as an exemplar when present.
+func (h Histogram) ObserveWithTraceID(value float64, traceID string) {
+	if traceID != "" {
+		h.ObserveWithExemplar(value, prometheus.Labels{"trace_id": traceID})
+		return
+	}
+	h.Observe(value)
+}
+
+func (h Histogram) forward(value float64) {
+	for _, sink := range currentSinks() {
+		sink.Observe(h.metric, value)
+	}
+}
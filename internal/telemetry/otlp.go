@@ -0,0 +1,256 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/rsav/k8s-learning/internal/version"
+)
+
+const (
+	otlpExportTimeout = 10 * time.Second
+	otlpScopeName     = "github.com/rsav/k8s-learning"
+
+	// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE: Prometheus counters and histograms
+	// count from the start of the process.
+	otlpCumulative = 2
+)
+
+// OTLPExporter periodically exports the metrics recorded through this package to an OTLP/HTTP
+// endpoint, encoded as JSON. The values are read from the default Prometheus registry, which
+// aggregates them already.
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+	gatherer prometheus.Gatherer
+	start    time.Time
+	log      *slog.Logger
+}
+
+// NewOTLPExporter creates an exporter to endpoint, e.g. http://otel-collector:4318/v1/metrics,
+// sending headers with every request and identifying the resource as service.
+func NewOTLPExporter(endpoint string, headers map[string]string, service string, log *slog.Logger) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  service,
+		client:   &http.Client{Timeout: otlpExportTimeout},
+		gatherer: prometheus.DefaultGatherer,
+		start:    time.Now(),
+		log:      log.With("component", "otlp_exporter"),
+	}
+}
+
+// Start exports the metrics every interval until ctx is done, then exports them a last time.
+func (e *OTLPExporter) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			exportCtx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+			if err := e.Export(exportCtx); err != nil {
+				e.log.Warn("failed to export metrics on shutdown", "error", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil && ctx.Err() == nil {
+				e.log.WarnContext(ctx, "failed to export metrics", "error", err)
+			}
+		}
+	}
+}
+
+// Export sends the current values of the metrics.
+func (e *OTLPExporter) Export(ctx context.Context) error {
+	families, err := e.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("gather metrics: %w", err)
+	}
+
+	body, err := json.Marshal(e.request(families, time.Now()))
+	if err != nil {
+		return fmt.Errorf("encode metrics: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP JSON encoding of ExportMetricsServiceRequest. 64-bit integers are strings, as in the
+// protobuf JSON mapping.
+type (
+	otlpRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpScope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+	otlpMetric struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		Sum         *otlpSum       `json:"sum,omitempty"`
+		Gauge       *otlpGauge     `json:"gauge,omitempty"`
+		Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpNumberPoint `json:"dataPoints"`
+		AggregationTemporality int               `json:"aggregationTemporality"`
+		IsMonotonic            bool              `json:"isMonotonic"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpNumberPoint `json:"dataPoints"`
+	}
+	otlpHistogram struct {
+		DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+		AggregationTemporality int                  `json:"aggregationTemporality"`
+	}
+	otlpNumberPoint struct {
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		AsDouble          float64         `json:"asDouble"`
+	}
+	otlpHistogramPoint struct {
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		TimeUnixNano      string          `json:"timeUnixNano"`
+		Count             string          `json:"count"`
+		Sum               float64         `json:"sum"`
+		BucketCounts      []string        `json:"bucketCounts"`
+		ExplicitBounds    []float64       `json:"explicitBounds"`
+	}
+)
+
+func (e *OTLPExporter) request(families []*dto.MetricFamily, now time.Time) otlpRequest {
+	start := strconv.FormatInt(e.start.UnixNano(), 10)
+	timestamp := strconv.FormatInt(now.UnixNano(), 10)
+
+	var metrics []otlpMetric
+	for _, family := range families {
+		if !registered(family.GetName()) {
+			continue
+		}
+		metric := otlpMetric{Name: family.GetName(), Description: family.GetHelp()}
+
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			metric.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			for _, m := range family.GetMetric() {
+				metric.Sum.DataPoints = append(metric.Sum.DataPoints, otlpNumberPoint{
+					Attributes: otlpAttributes(m.GetLabel()), StartTimeUnixNano: start, TimeUnixNano: timestamp,
+					AsDouble: m.GetCounter().GetValue(),
+				})
+			}
+		case dto.MetricType_GAUGE:
+			metric.Gauge = &otlpGauge{}
+			for _, m := range family.GetMetric() {
+				metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, otlpNumberPoint{
+					Attributes: otlpAttributes(m.GetLabel()), TimeUnixNano: timestamp, AsDouble: m.GetGauge().GetValue(),
+				})
+			}
+		case dto.MetricType_HISTOGRAM:
+			metric.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+			for _, m := range family.GetMetric() {
+				point := histogramPoint(m.GetHistogram())
+				point.Attributes, point.StartTimeUnixNano, point.TimeUnixNano = otlpAttributes(m.GetLabel()), start, timestamp
+				metric.Histogram.DataPoints = append(metric.Histogram.DataPoints, point)
+			}
+		default:
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: e.service}},
+			{Key: "service.version", Value: otlpValue{StringValue: version.Get().Version}},
+		}},
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: otlpScopeName}, Metrics: metrics}},
+	}}}
+}
+
+// histogramPoint converts the cumulative Prometheus buckets to the per-bucket counts of OTLP, which
+// end with the count above the last bound.
+func histogramPoint(histogram *dto.Histogram) otlpHistogramPoint {
+	point := otlpHistogramPoint{
+		Count:          strconv.FormatUint(histogram.GetSampleCount(), 10),
+		Sum:            histogram.GetSampleSum(),
+		BucketCounts:   []string{},
+		ExplicitBounds: []float64{},
+	}
+
+	var below uint64
+	for _, bucket := range histogram.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			continue
+		}
+		point.ExplicitBounds = append(point.ExplicitBounds, bucket.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(bucket.GetCumulativeCount()-below, 10))
+		below = bucket.GetCumulativeCount()
+	}
+	point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(histogram.GetSampleCount()-below, 10))
+
+	return point
+}
+
+func otlpAttributes(labels []*dto.LabelPair) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(labels))
+	for _, label := range labels {
+		attributes = append(attributes, otlpAttribute{Key: label.GetName(), Value: otlpValue{StringValue: label.GetValue()}})
+	}
+	return attributes
+}
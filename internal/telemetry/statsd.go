@@ -0,0 +1,157 @@
+package telemetry
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// statsdPacketSize keeps packets below the usual MTU, so they are not fragmented.
+	statsdPacketSize    = 1432
+	statsdBufferSize    = 4096
+	statsdFlushInterval = time.Second
+)
+
+// StatsD is a sink sending every metric change to a StatsD server over UDP. Labels are sent as
+// DogStatsD tags, which the Datadog agent and Telegraf understand. Lines are batched into packets
+// and flushed every second; when the buffer is full, lines are dropped instead of slowing down
+// the recording code.
+type StatsD struct {
+	conn    net.Conn
+	prefix  string
+	lines   chan string
+	dropped atomic.Int64
+	done    chan struct{}
+	log     *slog.Logger
+
+	// mu guards closed, so no line is sent on lines once it is closed.
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewStatsD creates a StatsD sink sending to address, prefixing the metric names with prefix.
+func NewStatsD(address, prefix string, log *slog.Logger) (*StatsD, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("connect to statsd: %w", err)
+	}
+
+	s := &StatsD{
+		conn:   conn,
+		prefix: prefix,
+		lines:  make(chan string, statsdBufferSize),
+		done:   make(chan struct{}),
+		log:    log.With("component", "statsd"),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *StatsD) Count(metric Metric, delta float64) {
+	s.send(metric, delta, "c")
+}
+
+func (s *StatsD) Gauge(metric Metric, value float64) {
+	s.send(metric, value, "g")
+}
+
+func (s *StatsD) Observe(metric Metric, value float64) {
+	s.send(metric, value, "h")
+}
+
+// Close flushes the buffered lines and closes the connection.
+func (s *StatsD) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.lines)
+	s.mu.Unlock()
+
+	<-s.done
+	_ = s.conn.Close()
+	if dropped := s.dropped.Load(); dropped > 0 {
+		s.log.Warn("dropped statsd lines", "count", dropped)
+	}
+}
+
+func (s *StatsD) send(metric Metric, value float64, kind string) {
+	var line strings.Builder
+	line.WriteString(s.prefix)
+	line.WriteString(metric.Name)
+	line.WriteByte(':')
+	line.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	line.WriteByte('|')
+	line.WriteString(kind)
+	for i, label := range metric.Labels {
+		if i == 0 {
+			line.WriteString("|#")
+		} else {
+			line.WriteByte(',')
+		}
+		line.WriteString(label)
+		line.WriteByte(':')
+		line.WriteString(tagValueReplacer.Replace(metric.Values[i]))
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.lines <- line.String():
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// tagValueReplacer drops the characters separating fields and tags from tag values.
+//
+//nolint:gochecknoglobals // stateless replacer
+var tagValueReplacer = strings.NewReplacer("|", "_", ",", "_", "\n", "_")
+
+func (s *StatsD) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+
+	packet := make([]byte, 0, statsdPacketSize)
+	flush := func() {
+		if len(packet) == 0 {
+			return
+		}
+		if _, err := s.conn.Write(packet); err != nil {
+			s.log.Debug("failed to send statsd packet", "error", err)
+		}
+		packet = packet[:0]
+	}
+
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				flush()
+				return
+			}
+			if len(packet) > 0 && len(packet)+1+len(line) > statsdPacketSize {
+				flush()
+			}
+			if len(packet) > 0 {
+				packet = append(packet, '\n')
+			}
+			packet = append(packet, line...)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
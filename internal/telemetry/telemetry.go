@@ -0,0 +1,107 @@
+// Package telemetry records the metrics of the services. Every metric is registered with the
+// default Prometheus registry, which /metrics serves, and can additionally be emitted to StatsD
+// and exported over OTLP, as configured per binary with METRICS_EXPORTERS.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// Metric identifies a single series: a metric name and its label values.
+type Metric struct {
+	Name   string
+	Labels []string
+	Values []string
+}
+
+// Sink receives every change of the metrics recorded through this package, as it happens.
+type Sink interface {
+	Count(metric Metric, delta float64)
+	Gauge(metric Metric, value float64)
+	Observe(metric Metric, value float64)
+}
+
+//nolint:gochecknoglobals // the metrics are package-level variables, so their sinks are too
+var (
+	sinks atomic.Pointer[[]Sink]
+
+	namesMu sync.Mutex
+	names   = map[string]struct{}{}
+)
+
+func currentSinks() []Sink {
+	if current := sinks.Load(); current != nil {
+		return *current
+	}
+	return nil
+}
+
+func register(name string) {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	names[name] = struct{}{}
+}
+
+func registered(name string) bool {
+	namesMu.Lock()
+	defer namesMu.Unlock()
+	_, ok := names[name]
+	return ok
+}
+
+// Setup starts the exporters of cfg other than Prometheus, which needs nothing but the /metrics
+// route, for the named service. The returned function flushes and stops them; call it on shutdown.
+func Setup(cfg config.Metrics, service string, log *slog.Logger) (func(), error) {
+	var (
+		active []Sink
+		stops  []func()
+	)
+	stop := func() {
+		sinks.Store(nil)
+		for _, stop := range stops {
+			stop()
+		}
+	}
+
+	if cfg.Exports(config.MetricsExporterStatsD) {
+		statsd, err := NewStatsD(cfg.StatsDAddress, cfg.StatsDPrefix, log)
+		if err != nil {
+			return nil, err
+		}
+		active = append(active, statsd)
+		stops = append(stops, statsd.Close)
+		log.Info("emitting metrics to statsd", "address", cfg.StatsDAddress)
+	}
+
+	if cfg.Exports(config.MetricsExporterOTLP) {
+		headers, err := cfg.OTLPHeaderMap()
+		if err != nil {
+			stop()
+			return nil, fmt.Errorf("otlp headers: %w", err)
+		}
+
+		exporter := NewOTLPExporter(cfg.OTLPEndpoint, headers, service, log)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			exporter.Start(ctx, cfg.OTLPInterval)
+		}()
+		stops = append(stops, func() {
+			cancel()
+			<-done
+		})
+		log.Info("exporting metrics over otlp", "endpoint", cfg.OTLPEndpoint, "interval", cfg.OTLPInterval)
+	}
+
+	if len(active) > 0 {
+		sinks.Store(&active)
+	}
+	return stop, nil
+}
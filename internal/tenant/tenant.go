@@ -0,0 +1,38 @@
+// Package tenant identifies which tenant a request or job belongs to for accounting and quotas.
+package tenant
+
+import (
+	"context"
+	"regexp"
+)
+
+const (
+	// Header carries the tenant ID on API requests. Requests without it belong to DefaultID. It is
+	// not authenticated, so tenant quotas only hold for clients that do not lie about it.
+	Header    = "X-Tenant-ID"
+	DefaultID = "default"
+)
+
+type contextKey struct{}
+
+//nolint:gochecknoglobals // idPattern is compiled once
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// Valid reports whether id is a well-formed tenant ID: lowercase letters, digits, '.', '_' or '-',
+// at most 63 characters.
+func Valid(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// WithID returns a copy of ctx carrying the given tenant ID.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant ID stored in ctx, or DefaultID.
+func FromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(contextKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultID
+}
@@ -0,0 +1,32 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+)
+
+// logHandler adds the trace_id and span_id of the context to every record logged with one.
+type logHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler wraps h so that records logged with a context carrying a span context include its
+// trace_id and span_id, which correlates logs with the traces of external tracing systems.
+func NewLogHandler(h slog.Handler) slog.Handler {
+	return logHandler{Handler: h}
+}
+
+func (h logHandler) Handle(ctx context.Context, record slog.Record) error {
+	if sc, ok := FromContext(ctx); ok {
+		record.AddAttrs(slog.String("trace_id", sc.TraceID), slog.String("span_id", sc.SpanID))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return logHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h logHandler) WithGroup(name string) slog.Handler {
+	return logHandler{Handler: h.Handler.WithGroup(name)}
+}
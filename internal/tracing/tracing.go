@@ -0,0 +1,124 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// W3C Trace Context headers: traceparent carries the trace and parent span IDs, tracestate
+// vendor-specific data that is passed on unchanged.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+type contextKey struct{}
+
+const (
+	traceparentParts = 4
+	traceIDLength    = 32
+	spanIDLength     = 16
+	flagsLength      = 2
+	zeroTraceID      = "00000000000000000000000000000000"
+	zeroSpanID       = "0000000000000000"
+
+	// supportedVersion is the only traceparent version generated; higher versions are parsed
+	// as far as version 00 defines them, as the specification requires.
+	supportedVersion = "00"
+	invalidVersion   = "ff"
+
+	// sampledFlags marks generated traces as sampled so downstream tracers record them.
+	sampledFlags = "01"
+
+	// maxTracestateLength bounds the tracestate passed on; longer values are dropped.
+	maxTracestateLength = 512
+)
+
+// SpanContext identifies a span within a W3C trace: the span this service works in, and the
+// trace state to pass on to the services it calls.
+type SpanContext struct {
+	TraceID    string
+	SpanID     string
+	Flags      string
+	TraceState string
+}
+
+// Parse returns the span context described by W3C traceparent (version-traceid-parentid-flags)
+// and tracestate header values. The span ID is the caller's; use Child to continue the trace in a
+// new span. It returns false for malformed traceparent values, whose tracestate must be discarded
+// as well.
+func Parse(traceparent, tracestate string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < traceparentParts {
+		return SpanContext{}, false
+	}
+
+	version, traceID, spanID, flags := strings.ToLower(parts[0]), strings.ToLower(parts[1]),
+		strings.ToLower(parts[2]), strings.ToLower(parts[3])
+	if len(parts) > traceparentParts && version == supportedVersion {
+		return SpanContext{}, false
+	}
+
+	if !isHex(version, flagsLength) || version == invalidVersion ||
+		!isHex(traceID, traceIDLength) || traceID == zeroTraceID ||
+		!isHex(spanID, spanIDLength) || spanID == zeroSpanID ||
+		!isHex(flags, flagsLength) {
+		return SpanContext{}, false
+	}
+
+	tracestate = strings.TrimSpace(tracestate)
+	if len(tracestate) > maxTracestateLength {
+		tracestate = ""
+	}
+
+	return SpanContext{TraceID: traceID, SpanID: spanID, Flags: flags, TraceState: tracestate}, true
+}
+
+// NewTrace starts a sampled trace with a random trace ID.
+func NewTrace() SpanContext {
+	return SpanContext{TraceID: randomHex(traceIDLength), SpanID: randomHex(spanIDLength), Flags: sampledFlags}
+}
+
+// Child returns a new span of the same trace, keeping the flags and trace state.
+func (sc SpanContext) Child() SpanContext {
+	sc.SpanID = randomHex(spanIDLength)
+	return sc
+}
+
+// Traceparent formats the span context as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return supportedVersion + "-" + sc.TraceID + "-" + sc.SpanID + "-" + sc.Flags
+}
+
+// WithSpanContext returns a copy of ctx carrying the given span context.
+func WithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// FromContext returns the span context stored in ctx.
+func FromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(contextKey{}).(SpanContext)
+	return sc, ok
+}
+
+// TraceIDFromContext returns the trace ID stored in ctx, or an empty string.
+func TraceIDFromContext(ctx context.Context) string {
+	sc, _ := FromContext(ctx)
+	return sc.TraceID
+}
+
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func randomHex(length int) string {
+	b := make([]byte, length/2) //nolint:mnd // two hex digits per byte
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,81 @@
+// Package version identifies the running binary. The variables are set at build time:
+//
+//	go build -ldflags "-X github.com/rsav/k8s-learning/internal/version.Version=v1.2.3 \
+//		-X github.com/rsav/k8s-learning/internal/version.Commit=$(git rev-parse HEAD) \
+//		-X github.com/rsav/k8s-learning/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Injected with -ldflags -X. Commit and BuildDate fall back to the VCS stamp of the Go toolchain.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Info describes the build of the running binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+	// Modified is set when the binary was built from a working tree with uncommitted changes.
+	Modified bool `json:"modified,omitempty"`
+}
+
+var buildInfoGauge = promauto.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "build_info",
+		Help: "Build information of the running binary (constant 1)",
+	},
+	[]string{"component", "version", "commit", "build_date", "go_version"},
+)
+
+// Get returns the build information, completing what was not injected from the VCS stamp.
+var Get = sync.OnceValue(func() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: BuildDate, GoVersion: "unknown"}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.GoVersion = build.GoVersion
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildDate == "" {
+				info.BuildDate = setting.Value
+			}
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+})
+
+// RecordBuildInfo exposes the build information as the build_info metric of the component.
+func RecordBuildInfo(component string) {
+	info := Get()
+	buildInfoGauge.WithLabelValues(component, info.Version, info.Commit, info.BuildDate, info.GoVersion).Set(1)
+}
+
+// Handler serves the build information as JSON.
+func Handler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(Get())
+}
@@ -0,0 +1,268 @@
+package worker
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/worker/metrics"
+)
+
+// Consumption states of a worker, changed through the admin endpoints.
+const (
+	StateRunning  = "running"
+	StatePaused   = "paused"
+	StateDraining = "draining"
+	StateDrained  = "drained"
+)
+
+const (
+	// drainPollInterval is how often a drain checks whether the in-flight jobs finished.
+	drainPollInterval   = 100 * time.Millisecond
+	defaultDrainTimeout = 30 * time.Second
+)
+
+// InFlightJob is a job the worker is processing.
+type InFlightJob struct {
+	JobID          uuid.UUID               `json:"job_id"`
+	ProcessingType database.ProcessingType `json:"processing_type"`
+	StartedAt      time.Time               `json:"started_at"`
+}
+
+// AdminStatus reports whether the worker consumes jobs and what it is processing.
+type AdminStatus struct {
+	WorkerID string        `json:"worker_id"`
+	State    string        `json:"state"`
+	InFlight []InFlightJob `json:"in_flight"`
+}
+
+// Pause stops consuming new jobs; jobs in flight keep running. A consume already waiting on the
+// queue may still pick up one job, which is processed like any other.
+func (w *Worker) Pause() {
+	w.control.Lock()
+	defer w.control.Unlock()
+
+	w.draining = false
+	if w.resumed == nil {
+		w.resumed = make(chan struct{})
+		metrics.WorkerPaused.WithLabelValues(w.workerID).Set(1)
+		w.log.Info("worker paused", "worker_id", w.workerID)
+	}
+}
+
+// Resume restarts consumption after Pause or Drain.
+func (w *Worker) Resume() {
+	w.control.Lock()
+	defer w.control.Unlock()
+
+	w.draining = false
+	if w.resumed != nil {
+		close(w.resumed)
+		w.resumed = nil
+		metrics.WorkerPaused.WithLabelValues(w.workerID).Set(0)
+		w.log.Info("worker resumed", "worker_id", w.workerID)
+	}
+}
+
+// Drain pauses consumption and waits until the jobs in flight finish or ctx is done. It returns
+// the jobs still in flight, none once the worker is drained.
+func (w *Worker) Drain(ctx context.Context) []InFlightJob {
+	w.Pause()
+	w.control.Lock()
+	w.draining = true
+	w.control.Unlock()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		inFlight := w.InFlight()
+		if len(inFlight) == 0 {
+			return inFlight
+		}
+
+		select {
+		case <-ctx.Done():
+			return inFlight
+		case <-ticker.C:
+		}
+	}
+}
+
+// processingPaused reports whether processing is paused globally through the API, logging when that
+// changes. Should the flag be unreadable, the worker keeps consuming rather than stall.
+func (w *Worker) processingPaused(ctx context.Context) bool {
+	paused, err := w.queue.ProcessingPaused(ctx)
+	if err != nil {
+		w.log.WarnContext(ctx, "failed to check whether processing is paused", "error", err, "worker_id", w.workerID)
+		return false
+	}
+
+	if w.globallyPaused.Swap(paused) != paused {
+		if paused {
+			w.log.InfoContext(ctx, "processing paused globally, idling", "worker_id", w.workerID)
+		} else {
+			w.log.InfoContext(ctx, "processing resumed globally", "worker_id", w.workerID)
+		}
+	}
+	return paused
+}
+
+// pausedUntil returns a channel closed on resume while the worker is paused, nil otherwise.
+func (w *Worker) pausedUntil() <-chan struct{} {
+	w.control.Lock()
+	defer w.control.Unlock()
+	return w.resumed
+}
+
+// InFlight returns the jobs being processed, oldest first.
+func (w *Worker) InFlight() []InFlightJob {
+	w.inFlightMu.Lock()
+	jobs := make([]InFlightJob, 0, len(w.inFlight))
+	for _, job := range w.inFlight {
+		jobs = append(jobs, job)
+	}
+	w.inFlightMu.Unlock()
+
+	slices.SortFunc(jobs, func(a, b InFlightJob) int { return a.StartedAt.Compare(b.StartedAt) })
+	return jobs
+}
+
+func (w *Worker) trackInFlight(job InFlightJob) func() {
+	w.inFlightMu.Lock()
+	w.inFlight[job.JobID] = job
+	w.inFlightMu.Unlock()
+
+	return func() {
+		w.inFlightMu.Lock()
+		delete(w.inFlight, job.JobID)
+		w.inFlightMu.Unlock()
+	}
+}
+
+// AdminStatus returns the consumption state and the jobs in flight.
+func (w *Worker) AdminStatus() AdminStatus {
+	inFlight := w.InFlight()
+
+	w.control.Lock()
+	state := StateRunning
+	switch {
+	case w.draining && len(inFlight) == 0:
+		state = StateDrained
+	case w.draining:
+		state = StateDraining
+	case w.resumed != nil:
+		state = StatePaused
+	}
+	w.control.Unlock()
+
+	return AdminStatus{WorkerID: w.workerID, State: state, InFlight: inFlight}
+}
+
+// CheckConsuming fails while the worker is paused or drained through the admin endpoints, so the
+// readiness report shows the worker as degraded.
+func (w *Worker) CheckConsuming(context.Context) error {
+	if state := w.AdminStatus().State; state != StateRunning {
+		return fmt.Errorf("worker is %s", state)
+	}
+	return nil
+}
+
+// Admin serves the worker admin endpoints, authenticated with a bearer token that can be rotated
+// without a restart. With an empty token every request is rejected.
+type Admin struct {
+	worker *Worker
+	token  atomic.Pointer[string]
+	log    *slog.Logger
+}
+
+func NewAdmin(worker *Worker, token string, log *slog.Logger) *Admin {
+	admin := &Admin{worker: worker, log: log}
+	admin.token.Store(&token)
+	return admin
+}
+
+// RotateToken switches to a new admin token.
+func (a *Admin) RotateToken(token string) {
+	a.token.Store(&token)
+	a.log.Info("worker admin token rotated")
+}
+
+// Register adds the admin routes to mux:
+//
+//	POST /admin/pause   stop consuming jobs
+//	POST /admin/resume  consume jobs again
+//	POST /admin/drain   pause and wait for in-flight jobs, at most ?timeout= (default 30s)
+//
+// Each responds with the worker's AdminStatus.
+func (a *Admin) Register(mux *http.ServeMux) {
+	mux.Handle("POST /admin/pause", a.Authenticate(a.pause))
+	mux.Handle("POST /admin/resume", a.Authenticate(a.resume))
+	mux.Handle("POST /admin/drain", a.Authenticate(a.drain))
+}
+
+// Authenticate serves next only to requests carrying the admin token, such as those of the other
+// operator endpoints of the metrics server.
+func (a *Admin) Authenticate(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := *a.token.Load()
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			a.log.WarnContext(r.Context(), "rejected worker admin request", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func (a *Admin) pause(w http.ResponseWriter, r *http.Request) {
+	a.worker.Pause()
+	a.writeStatus(w, r, http.StatusOK)
+}
+
+func (a *Admin) resume(w http.ResponseWriter, r *http.Request) {
+	a.worker.Resume()
+	a.writeStatus(w, r, http.StatusOK)
+}
+
+func (a *Admin) drain(w http.ResponseWriter, r *http.Request) {
+	timeout := defaultDrainTimeout
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "timeout must be a non-negative duration", http.StatusBadRequest)
+			return
+		}
+		timeout = parsed
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	// 202 tells the caller jobs are still running when the timeout expired
+	status := http.StatusOK
+	if remaining := a.worker.Drain(ctx); len(remaining) > 0 {
+		status = http.StatusAccepted
+	}
+	a.writeStatus(w, r, status)
+}
+
+func (a *Admin) writeStatus(w http.ResponseWriter, r *http.Request, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(a.worker.AdminStatus()); err != nil {
+		a.log.ErrorContext(r.Context(), "failed to encode worker admin status", "error", err)
+	}
+}
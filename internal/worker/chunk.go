@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// charsPerToken approximates how many characters make up a token for common BPE tokenizers.
+const charsPerToken = 4
+
+// textChunk is a single JSONL record of a chunk result. Start and End are byte offsets in the input.
+type textChunk struct {
+	Index      int    `json:"index"`
+	Start      int    `json:"start"`
+	End        int    `json:"end"`
+	Characters int    `json:"characters"`
+	Tokens     int    `json:"tokens"`
+	Text       string `json:"text"`
+}
+
+// chunkUnit is the smallest piece a chunk boundary can fall between: a word when chunking by
+// tokens, a character when chunking by characters.
+type chunkUnit struct {
+	start, end int
+	weight     int
+}
+
+// chunkText splits content into chunks of at most params.Size units, each repeating up to
+// params.Overlap units from the end of the previous one.
+func chunkText(content string, params database.ChunkParams) []textChunk {
+	var units []chunkUnit
+	if params.By == database.ChunkByCharacters {
+		units = characterUnits(content)
+	} else {
+		units = wordUnits(content)
+	}
+
+	chunks := []textChunk{}
+	for first := 0; first < len(units); {
+		last, weight := first, units[first].weight
+		for last+1 < len(units) && weight+units[last+1].weight <= params.Size {
+			last++
+			weight += units[last].weight
+		}
+
+		text := content[units[first].start:units[last].end]
+		chunks = append(chunks, textChunk{
+			Index:      len(chunks),
+			Start:      units[first].start,
+			End:        units[last].end,
+			Characters: utf8.RuneCountInString(text),
+			Tokens:     estimateTokens(text),
+			Text:       text,
+		})
+
+		if last == len(units)-1 {
+			break
+		}
+
+		// Step back over as many trailing units as fit in the overlap, always moving forward
+		next, overlap := last+1, 0
+		for next-1 > first && overlap+units[next-1].weight <= params.Overlap {
+			next--
+			overlap += units[next].weight
+		}
+		first = next
+	}
+
+	return chunks
+}
+
+// wordUnits splits content on whitespace, weighting each word by its approximate token count.
+func wordUnits(content string) []chunkUnit {
+	var units []chunkUnit
+
+	start := -1
+	for i, r := range content {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			units = append(units, chunkUnit{start: start, end: i, weight: estimateTokens(content[start:i])})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		units = append(units, chunkUnit{start: start, end: len(content), weight: estimateTokens(content[start:])})
+	}
+
+	return units
+}
+
+func characterUnits(content string) []chunkUnit {
+	units := make([]chunkUnit, 0, utf8.RuneCountInString(content))
+	for i, r := range content {
+		units = append(units, chunkUnit{start: i, end: i + utf8.RuneLen(r), weight: 1})
+	}
+	return units
+}
+
+// estimateTokens approximates the token count of text, counting each word as at least one token.
+func estimateTokens(text string) int {
+	tokens := 0
+	inWord, wordLen := false, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			if inWord {
+				tokens += (wordLen + charsPerToken - 1) / charsPerToken
+			}
+			inWord, wordLen = false, 0
+			continue
+		}
+		inWord = true
+		wordLen++
+	}
+	if inWord {
+		tokens += (wordLen + charsPerToken - 1) / charsPerToken
+	}
+	return tokens
+}
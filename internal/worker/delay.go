@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/worker/metrics"
+)
+
+// simulateDelay sleeps for the delay_ms the job asked for, to simulate slow processing in stress
+// tests. The delay is capped to the max delay of the processing type, which also covers jobs queued
+// before the max was lowered, and skipped while Redis is short of memory so that the backlog drains
+// as fast as possible. It fails when ctx ends during the delay.
+func (w *Worker) simulateDelay(ctx context.Context, message *queue.SubmitJobMessage) error {
+	if message.DelayMS <= 0 {
+		return nil
+	}
+	processingType := string(message.ProcessingType)
+
+	_, maxMS := w.config.Delays.Limits(processingType)
+	delayMS := min(message.DelayMS, maxMS)
+	if delayMS < message.DelayMS {
+		w.log.InfoContext(ctx, "capping processing delay to the max delay of the processing type",
+			"job_id", message.JobID,
+			"delay_ms", message.DelayMS,
+			"max_delay_ms", maxMS)
+	}
+
+	const millisecondsToSeconds = 1000.0
+	metrics.JobDelaySeconds.WithLabelValues(w.workerID, processingType).Observe(float64(delayMS) / millisecondsToSeconds)
+
+	if w.queue.MemoryHigh() {
+		w.log.InfoContext(ctx, "skipping processing delay while redis memory is high", "job_id", message.JobID)
+		return nil
+	}
+	if delayMS == 0 {
+		return nil
+	}
+
+	w.log.InfoContext(ctx, "applying processing delay for stress testing",
+		"job_id", message.JobID,
+		"delay_ms", delayMS)
+
+	start := time.Now()
+	timer := time.NewTimer(time.Duration(delayMS) * time.Millisecond)
+	defer timer.Stop()
+	defer func() {
+		metrics.JobSimulatedDelaySeconds.WithLabelValues(w.workerID, processingType).Observe(time.Since(start).Seconds())
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("context cancelled during delay: %w", ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
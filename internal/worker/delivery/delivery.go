@@ -0,0 +1,241 @@
+// Package delivery pushes the results of succeeded jobs to external systems: an S3 bucket, an HTTP
+// endpoint or a Kafka topic. Jobs choose the sinks with their sinks parameter; the worker delivers
+// the result once the job succeeded, retrying failed attempts.
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/afero"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/encryption"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
+	"github.com/rsav/k8s-learning/internal/worker/metrics"
+)
+
+// errorBodyLimit bounds how much of an error response is reported.
+const errorBodyLimit = 512
+
+// ErrSinkNotConfigured is returned for sinks a job asks for that this worker has no connector for.
+var ErrSinkNotConfigured = errors.New("result sink not configured")
+
+// Result is the result of a succeeded job.
+type Result struct {
+	JobID          uuid.UUID
+	TenantID       string
+	ProcessingType database.ProcessingType
+	// Path is the result file on the worker.
+	Path string
+	// fsys is the filesystem of the result file, and keys decrypt it when it is encrypted at rest.
+	fsys afero.Fs
+	keys *encryption.Keyring
+}
+
+// open opens the result file for reading its content, along with the size of the content.
+func (r Result) open() (io.ReadCloser, int64, error) {
+	file, size, err := filestore.OpenFile(r.fsys, r.keys, r.Path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open result: %w", err)
+	}
+	return file, size, nil
+}
+
+// templateData is what key and URL templates can refer to.
+type templateData struct {
+	JobID          string
+	TenantID       string
+	ProcessingType string
+	// Ext is the extension of the result file, with the leading dot, e.g. ".json".
+	Ext string
+	// Date is the UTC date of the delivery as YYYY-MM-DD.
+	Date string
+}
+
+// Connector delivers results to a sink.
+type Connector interface {
+	Name() string
+	Deliver(ctx context.Context, result Result) error
+	Close() error
+}
+
+// permanentError is a failure another attempt would get again, e.g. a rejected request.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Deliverer delivers results to the sinks jobs ask for, retrying failed attempts.
+type Deliverer struct {
+	cfg        config.ResultSinks
+	connectors map[string]Connector
+	fsys       afero.Fs
+	keys       *encryption.Keyring
+	workerID   string
+	log        *slog.Logger
+}
+
+// FromConfig creates a deliverer with a connector for every sink configured in cfg, reading results
+// from fsys and decrypting them with keys when they are encrypted at rest. The worker ID labels its
+// metrics.
+func FromConfig(
+	cfg config.ResultSinks, fsys afero.Fs, keys *encryption.Keyring, workerID string, log *slog.Logger,
+) (*Deliverer, error) {
+	connectors := make(map[string]Connector)
+
+	if cfg.S3Bucket != "" {
+		s3, err := NewS3Connector(cfg)
+		if err != nil {
+			return nil, err
+		}
+		connectors[s3.Name()] = s3
+	}
+
+	if cfg.HTTPURLTemplate != "" {
+		httpConnector, err := NewHTTPConnector(cfg)
+		if err != nil {
+			return nil, err
+		}
+		connectors[httpConnector.Name()] = httpConnector
+	}
+
+	if len(cfg.KafkaBrokers) > 0 {
+		kafka := NewKafkaConnector(cfg)
+		connectors[kafka.Name()] = kafka
+	}
+
+	return &Deliverer{
+		cfg:        cfg,
+		connectors: connectors,
+		fsys:       fsys,
+		keys:       keys,
+		workerID:   workerID,
+		log:        log.With("component", "delivery"),
+	}, nil
+}
+
+// Deliver pushes the result to every sink and returns the error of each sink it was not delivered
+// to, after the last attempt.
+func (d *Deliverer) Deliver(ctx context.Context, result Result, sinks []string) map[string]error {
+	failed := make(map[string]error)
+	for _, sink := range sinks {
+		start := time.Now()
+		err := d.deliver(ctx, result, sink)
+		metrics.ResultDeliveryDuration.WithLabelValues(d.workerID, sink).Observe(time.Since(start).Seconds())
+
+		if err != nil {
+			d.log.ErrorContext(ctx, "failed to deliver result", "error", err, "job_id", result.JobID, "sink", sink)
+			metrics.ResultDeliveriesTotal.WithLabelValues(d.workerID, sink, "failed").Inc()
+			failed[sink] = err
+			continue
+		}
+
+		d.log.InfoContext(ctx, "result delivered", "job_id", result.JobID, "sink", sink)
+		metrics.ResultDeliveriesTotal.WithLabelValues(d.workerID, sink, "delivered").Inc()
+	}
+	return failed
+}
+
+// deliver pushes the result to the sink, up to MaxAttempts times.
+func (d *Deliverer) deliver(ctx context.Context, result Result, sink string) error {
+	connector, ok := d.connectors[sink]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSinkNotConfigured, sink)
+	}
+	result.fsys, result.keys = d.fsys, d.keys
+
+	for attempt := 1; ; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+		err := connector.Deliver(attemptCtx, result)
+		cancel()
+
+		var permanent *permanentError
+		if err == nil || attempt >= d.cfg.MaxAttempts || errors.As(err, &permanent) || ctx.Err() != nil {
+			return err
+		}
+
+		metrics.ResultDeliveryRetriesTotal.WithLabelValues(d.workerID, sink).Inc()
+		d.log.WarnContext(ctx, "result delivery attempt failed, retrying",
+			"error", err, "job_id", result.JobID, "sink", sink, "attempt", attempt, "retry_in", d.cfg.RetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d.cfg.RetryDelay):
+		}
+	}
+}
+
+// Close closes every connector.
+func (d *Deliverer) Close() error {
+	var errs []error
+	for _, connector := range d.connectors {
+		if err := connector.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close %s result sink: %w", connector.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseTemplate parses a key or URL template of the named sink.
+func parseTemplate(sink, text string) (*template.Template, error) {
+	tmpl, err := template.New(sink).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s result sink template: %w", sink, err)
+	}
+	return tmpl, nil
+}
+
+// render executes a key or URL template for the result.
+func render(tmpl *template.Template, result Result) (string, error) {
+	var text strings.Builder
+	err := tmpl.Execute(&text, templateData{
+		JobID:          result.JobID.String(),
+		TenantID:       result.TenantID,
+		ProcessingType: string(result.ProcessingType),
+		Ext:            filepath.Ext(result.Path),
+		Date:           time.Now().UTC().Format(time.DateOnly),
+	})
+	if err != nil {
+		return "", &permanentError{err: fmt.Errorf("render %s template: %w", tmpl.Name(), err)}
+	}
+	return text.String(), nil
+}
+
+// checkResponse returns an error for non-2xx responses; client errors other than timeouts and rate
+// limiting are permanent.
+func checkResponse(sink string, resp *http.Response) error {
+	if resp.StatusCode < http.StatusMultipleChoices {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	err := fmt.Errorf("%s sink returned status %d", sink, resp.StatusCode)
+	if body, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit)); len(bytes.TrimSpace(body)) > 0 {
+		err = fmt.Errorf("%w: %s", err, bytes.TrimSpace(body))
+	}
+	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode < http.StatusInternalServerError &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return &permanentError{err: err}
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"text/template"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// HTTPConnector POSTs results to an HTTP endpoint, with the job in X-Job-ID, X-Tenant-ID and
+// X-Processing-Type headers.
+type HTTPConnector struct {
+	url     *template.Template
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewHTTPConnector(cfg config.ResultSinks) (*HTTPConnector, error) {
+	url, err := parseTemplate(config.ResultSinkHTTP, cfg.HTTPURLTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := cfg.HTTPHeaderMap()
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPConnector{url: url, headers: headers, client: &http.Client{}}, nil
+}
+
+func (c *HTTPConnector) Name() string {
+	return config.ResultSinkHTTP
+}
+
+func (c *HTTPConnector) Deliver(ctx context.Context, result Result) error {
+	url, err := render(c.url, result)
+	if err != nil {
+		return err
+	}
+
+	file, size, err := result.open()
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	defer file.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, file)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("create http sink request: %w", err)}
+	}
+	req.ContentLength = size
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", contentType(result.Path))
+	req.Header.Set("X-Job-ID", result.JobID.String())
+	req.Header.Set("X-Tenant-ID", result.TenantID)
+	req.Header.Set("X-Processing-Type", string(result.ProcessingType))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send result: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(c.Name(), resp)
+}
+
+func (c *HTTPConnector) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// contentType returns the media type of a result file by its extension.
+func contentType(path string) string {
+	if mediaType := mime.TypeByExtension(filepath.Ext(path)); mediaType != "" {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
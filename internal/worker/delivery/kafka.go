@@ -0,0 +1,77 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+// KafkaConnector appends results to a Kafka topic keyed by job ID, with the job in the job_id,
+// tenant_id, processing_type and result_name headers. Results larger than the maximum message
+// size are not delivered.
+type KafkaConnector struct {
+	writer          *kafka.Writer
+	maxMessageBytes int64
+}
+
+func NewKafkaConnector(cfg config.ResultSinks) *KafkaConnector {
+	return &KafkaConnector{
+		writer: &kafka.Writer{
+			Addr:     kafka.TCP(cfg.KafkaBrokers...),
+			Topic:    cfg.KafkaTopic,
+			Balancer: &kafka.Hash{},
+			// Results are written one at a time, so batching would only delay them
+			BatchSize:              1,
+			BatchBytes:             cfg.KafkaMaxMessageBytes,
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		},
+		maxMessageBytes: cfg.KafkaMaxMessageBytes,
+	}
+}
+
+func (c *KafkaConnector) Name() string {
+	return config.ResultSinkKafka
+}
+
+func (c *KafkaConnector) Deliver(ctx context.Context, result Result) error {
+	file, size, err := result.open()
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	defer file.Close()
+
+	if size > c.maxMessageBytes {
+		return &permanentError{err: fmt.Errorf("result of %d bytes exceeds the kafka message limit of %d bytes", size, c.maxMessageBytes)}
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("read result: %w", err)
+	}
+
+	message := kafka.Message{
+		Key:   []byte(result.JobID.String()),
+		Value: data,
+		Headers: []kafka.Header{
+			{Key: "job_id", Value: []byte(result.JobID.String())},
+			{Key: "tenant_id", Value: []byte(result.TenantID)},
+			{Key: "processing_type", Value: []byte(result.ProcessingType)},
+			{Key: "result_name", Value: []byte(filepath.Base(result.Path))},
+		},
+	}
+
+	if err := c.writer.WriteMessages(ctx, message); err != nil {
+		return fmt.Errorf("write kafka message: %w", err)
+	}
+	return nil
+}
+
+func (c *KafkaConnector) Close() error {
+	return c.writer.Close()
+}
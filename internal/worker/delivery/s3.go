@@ -0,0 +1,184 @@
+package delivery
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+)
+
+const (
+	s3Service       = "s3"
+	s3Algorithm     = "AWS4-HMAC-SHA256"
+	s3AmzDateFormat = "20060102T150405Z"
+	s3DateFormat    = "20060102"
+	s3SignedHeaders = "host;x-amz-content-sha256;x-amz-date"
+)
+
+// S3Connector uploads results to an S3 bucket with a PutObject request signed with AWS Signature
+// Version 4. With an endpoint, e.g. of MinIO, objects are addressed path-style.
+type S3Connector struct {
+	bucket          string
+	region          string
+	endpoint        string
+	accessKeyID     string
+	secretAccessKey string
+	key             *template.Template
+	client          *http.Client
+}
+
+func NewS3Connector(cfg config.ResultSinks) (*S3Connector, error) {
+	key, err := parseTemplate(config.ResultSinkS3, cfg.S3KeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Connector{
+		bucket:          cfg.S3Bucket,
+		region:          cfg.S3Region,
+		endpoint:        strings.TrimSuffix(cfg.S3Endpoint, "/"),
+		accessKeyID:     cfg.S3AccessKeyID,
+		secretAccessKey: cfg.S3SecretAccessKey,
+		key:             key,
+		client:          &http.Client{},
+	}, nil
+}
+
+func (c *S3Connector) Name() string {
+	return config.ResultSinkS3
+}
+
+func (c *S3Connector) Deliver(ctx context.Context, result Result) error {
+	key, err := render(c.key, result)
+	if err != nil {
+		return err
+	}
+	key = strings.TrimPrefix(key, "/")
+	if key == "" {
+		return &permanentError{err: fmt.Errorf("s3 key template rendered an empty key for job %s", result.JobID)}
+	}
+
+	// The signature covers the payload hash, so the file is read twice instead of buffered
+	payloadHash, err := hashResult(result)
+	if err != nil {
+		return err
+	}
+
+	file, size, err := result.open()
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	defer file.Close()
+
+	objectURL, err := url.Parse(c.objectURL(key))
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("s3 object URL: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), file)
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("create s3 request: %w", err)}
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType(result.Path))
+	c.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload result: %w", err)
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(c.Name(), resp)
+}
+
+// hashResult returns the hex-encoded SHA-256 hash of the content of the result file.
+func hashResult(result Result) (string, error) {
+	file, _, err := result.open()
+	if err != nil {
+		return "", &permanentError{err: err}
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("hash result: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (c *S3Connector) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// objectURL returns the URL of the object, virtual-hosted on AWS and path-style on an endpoint.
+func (c *S3Connector) objectURL(key string) string {
+	if c.endpoint != "" {
+		return fmt.Sprintf("%s/%s/%s", c.endpoint, c.bucket, escapeKey(key))
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", c.bucket, c.region, escapeKey(key))
+}
+
+// sign adds the Signature Version 4 headers to the request.
+func (c *S3Connector) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format(s3AmzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		s3SignedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(s3DateFormat), c.region, s3Service, "aws4_request"}, "/")
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.secretAccessKey), now.Format(s3DateFormat))
+	signingKey = hmacSHA256(signingKey, c.region)
+	signingKey = hmacSHA256(signingKey, s3Service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, c.accessKeyID, scope, s3SignedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapeKey URI-encodes an object key the way Signature Version 4 expects: every byte except the
+// unreserved characters and the slashes separating its segments.
+func escapeKey(key string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(key) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/':
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,235 @@
+package worker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// diffContextLines is the number of unchanged lines shown around each change, as in diff -u.
+	diffContextLines = 3
+	// maxDiffEdits bounds the Myers search, whose memory grows with the square of the edit distance.
+	maxDiffEdits = 2000
+)
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// uploadedName returns the name a file was uploaded under for diff headers, falling back to the
+// name it is stored under for messages that do not carry it. Line breaks, which would forge header
+// lines, are replaced.
+func uploadedName(originalFilename, storedPath string) string {
+	name := filepath.Base(originalFilename)
+	if originalFilename == "" {
+		name = filepath.Base(storedPath)
+	}
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(name)
+}
+
+// unifiedDiff returns the unified diff (diff -u format) turning content a into content b.
+// Identical inputs produce an empty result.
+func unifiedDiff(nameA, nameB, a, b string) (string, error) {
+	lines, err := diffLines(splitLines(a), splitLines(b))
+	if err != nil {
+		return "", err
+	}
+
+	hunks := buildHunks(lines)
+	if len(hunks) == 0 {
+		return "", nil
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", nameA, nameB)
+	for _, h := range hunks {
+		h.write(&out, lines)
+	}
+	return out.String(), nil
+}
+
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// diffLines computes a shortest edit script between a and b with Myers' algorithm.
+func diffLines(a, b []string) ([]diffLine, error) {
+	n, m := len(a), len(b)
+
+	// trace[d][k+d] is the furthest x reached on diagonal k after d edits.
+	var trace [][]int
+	for d := 0; d <= n+m; d++ {
+		if d > maxDiffEdits {
+			return nil, fmt.Errorf("inputs differ by more than %d lines", maxDiffEdits)
+		}
+
+		current := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			switch {
+			case d == 0:
+				x = 0
+			case k == -d || (k != d && trace[d-1][k-1+d-1] < trace[d-1][k+1+d-1]):
+				x = trace[d-1][k+1+d-1]
+			default:
+				x = trace[d-1][k-1+d-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			current[k+d] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, current)
+				return backtrackDiff(trace, a, b), nil
+			}
+		}
+		trace = append(trace, current)
+	}
+
+	return backtrackDiff(trace, a, b), nil
+}
+
+func backtrackDiff(trace [][]int, a, b []string) []diffLine {
+	x, y := len(a), len(b)
+	reversed := make([]diffLine, 0, len(a)+len(b))
+
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+
+		prevK := k - 1
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffLine{op: diffEqual, text: a[x-1]})
+			x--
+			y--
+		}
+
+		if x == prevX {
+			reversed = append(reversed, diffLine{op: diffInsert, text: b[y-1]})
+			y--
+		} else {
+			reversed = append(reversed, diffLine{op: diffDelete, text: a[x-1]})
+			x--
+		}
+	}
+
+	for x > 0 && y > 0 {
+		reversed = append(reversed, diffLine{op: diffEqual, text: a[x-1]})
+		x--
+		y--
+	}
+
+	lines := make([]diffLine, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines
+}
+
+// hunk is a range of the edit script, [start, end), together with the 0-based line
+// positions in a and b where it begins.
+type hunk struct {
+	start, end int
+	startA     int
+	startB     int
+}
+
+func buildHunks(lines []diffLine) []hunk {
+	var hunks []hunk
+
+	posA, posB := 0, 0
+	positions := make([][2]int, len(lines))
+	for i, line := range lines {
+		positions[i] = [2]int{posA, posB}
+		if line.op != diffInsert {
+			posA++
+		}
+		if line.op != diffDelete {
+			posB++
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		if lines[i].op == diffEqual {
+			continue
+		}
+
+		start := max(i-diffContextLines, 0)
+		end := min(i+1+diffContextLines, len(lines))
+
+		// Merge with the previous hunk when their context overlaps
+		if len(hunks) > 0 && start <= hunks[len(hunks)-1].end {
+			hunks[len(hunks)-1].end = end
+			continue
+		}
+
+		hunks = append(hunks, hunk{
+			start:  start,
+			end:    end,
+			startA: positions[start][0],
+			startB: positions[start][1],
+		})
+	}
+
+	return hunks
+}
+
+func (h hunk) write(out *strings.Builder, lines []diffLine) {
+	countA, countB := 0, 0
+	for _, line := range lines[h.start:h.end] {
+		if line.op != diffInsert {
+			countA++
+		}
+		if line.op != diffDelete {
+			countB++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(h.startA, countA), hunkRange(h.startB, countB))
+	for _, line := range lines[h.start:h.end] {
+		switch line.op {
+		case diffEqual:
+			out.WriteString(" ")
+		case diffDelete:
+			out.WriteString("-")
+		case diffInsert:
+			out.WriteString("+")
+		}
+		out.WriteString(line.text)
+		out.WriteString("\n")
+	}
+}
+
+// hunkRange formats a hunk range; empty ranges point at the line before the change, as diff -u does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/worker/metrics"
+)
+
+// queueEmail queues the notification email of a finished job submitted with notify_email, failed
+// when jobErr is set. The mailer sends it outside of job processing; a failure to queue it only
+// loses the email.
+func (w *Worker) queueEmail(ctx context.Context, message *queue.SubmitJobMessage, jobErr error) {
+	if !w.config.Email.Enabled() {
+		return
+	}
+
+	// The parameter was validated when the job was submitted
+	to, err := database.NotifyEmailFrom(message.Parameters)
+	if err != nil || to == "" {
+		return
+	}
+
+	email := queue.EmailMessage{
+		ID:       uuid.New(),
+		JobID:    message.JobID,
+		TenantID: message.TenantID,
+		To:       to,
+		QueuedAt: time.Now(),
+	}
+	email.Subject, email.Body = w.emailContent(message, jobErr)
+
+	redisStart := time.Now()
+	if err := w.queue.EnqueueEmail(ctx, email); err != nil {
+		w.log.ErrorContext(ctx, "failed to queue notification email", "error", err, "job_id", message.JobID)
+	}
+	metrics.RedisOperationsTotal.WithLabelValues(w.workerID, "enqueue_email").Inc()
+	metrics.RedisOperationDuration.WithLabelValues(w.workerID, "enqueue_email").Observe(time.Since(redisStart).Seconds())
+}
+
+// emailContent returns the subject and body of the notification email of a job.
+func (w *Worker) emailContent(message *queue.SubmitJobMessage, jobErr error) (string, string) {
+	var body strings.Builder
+	if jobErr != nil {
+		fmt.Fprintf(&body, "Your %s job %s failed:\n\n%s\n", message.ProcessingType, message.JobID, jobErr)
+		return fmt.Sprintf("Job %s failed", message.JobID), body.String()
+	}
+
+	fmt.Fprintf(&body, "Your %s job %s succeeded.\n", message.ProcessingType, message.JobID)
+	if base := w.config.Email.ResultBaseURL; base != "" {
+		link, err := url.JoinPath(base, "api/v1/jobs", message.JobID.String(), "result")
+		if err == nil {
+			fmt.Fprintf(&body, "\nDownload the result: %s\n", link)
+		}
+	}
+	return fmt.Sprintf("Job %s succeeded", message.JobID), body.String()
+}
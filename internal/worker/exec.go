@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/sandbox"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// maxCommandStderr bounds how much of a failing command's stderr ends up in the job error.
+const maxCommandStderr = 4096
+
+// commandRunner pipes job input through operator-allowed commands inside the sandbox.
+type commandRunner struct {
+	config config.Exec
+	// paths maps allowed command names to executables resolved at startup.
+	paths map[string]string
+}
+
+func newCommandRunner(cfg config.Exec, log *slog.Logger) *commandRunner {
+	paths := make(map[string]string, len(cfg.AllowedCommands))
+	for _, name := range cfg.AllowedCommands {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			log.Warn("allowed exec command not found, jobs using it will fail", "command", name, "error", err)
+			continue
+		}
+		paths[name] = path
+	}
+
+	log.Info("exec processing enabled",
+		"commands", cfg.AllowedCommands,
+		"timeout", cfg.Timeout,
+		"isolate_network", cfg.IsolateNetwork)
+
+	return &commandRunner{config: cfg, paths: paths}
+}
+
+// run returns the command output and, once the command was started, its resource usage.
+func (r *commandRunner) run(ctx context.Context, params database.ExecParams, input io.Reader) ([]byte, childUsage, error) {
+	path, ok := r.paths[params.Command]
+	if !ok {
+		return nil, childUsage{}, NewInvalidParamError(database.ExecCommandParam,
+			fmt.Sprintf("command %q is not allowed on this worker", params.Command))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	cmd, err := sandbox.Command(ctx, sandbox.Limits{
+		CPU:            r.config.CPULimit,
+		Memory:         r.config.MemoryLimit,
+		IsolateNetwork: r.config.IsolateNetwork,
+	}, path, params.Args...)
+	if err != nil {
+		return nil, childUsage{}, NewCommandError(params.Command, "prepare sandbox", err)
+	}
+
+	stdout := &limitedBuffer{limit: r.config.MaxOutputSize}
+	stderr := &limitedBuffer{limit: maxCommandStderr, truncate: true}
+	cmd.Stdin = input
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	usage := childUsageFromState(cmd.ProcessState)
+	switch {
+	case stdout.exceeded:
+		return nil, usage, NewCommandError(params.Command,
+			fmt.Sprintf("output exceeds %d bytes", r.config.MaxOutputSize), nil)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return nil, usage, NewCommandError(params.Command,
+			fmt.Sprintf("timed out after %s", r.config.Timeout), ctx.Err())
+	case err != nil:
+		details := strings.TrimSpace(stderr.String())
+		if details == "" {
+			details = err.Error()
+		}
+		return nil, usage, NewCommandError(params.Command, details, err)
+	}
+
+	return stdout.Bytes(), usage, nil
+}
+
+// limitedBuffer collects up to limit bytes. Once full it either fails writes, stopping the
+// command with a broken pipe, or silently drops the rest when truncate is set. The buffer is not
+// embedded so that io.Copy cannot bypass Write through bytes.Buffer.ReadFrom.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	limit    int64
+	truncate bool
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - int64(b.buf.Len())
+	if int64(len(p)) <= remaining {
+		return b.buf.Write(p)
+	}
+
+	b.buf.Write(p[:max(remaining, 0)])
+	if b.truncate {
+		return len(p), nil
+	}
+	b.exceeded = true
+	return 0, errors.New("output limit exceeded")
+}
+
+func (b *limitedBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand/v2"
+	"os"
+	"strconv"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/worker/metrics"
+)
+
+// ErrInjectedFault is the cause of failures injected through the fail_probability parameter.
+var ErrInjectedFault = errors.New("fault injected for resilience testing")
+
+// injectFault returns the stage an attempt of the job fails at, or "" when it does not fail. Only
+// workers with fault injection enabled inject faults. Whether an attempt fails is drawn from the job
+// ID and the attempt number, so a job fails the same way on every worker, whereas its retries draw
+// anew and may succeed.
+func (w *Worker) injectFault(ctx context.Context, job *ProcessingJob) string {
+	if !w.config.FaultInjection {
+		return ""
+	}
+
+	// The parameters passed schema validation when the job was submitted
+	fault, err := database.FaultParamsFrom(job.Parameters)
+	if err != nil || fault.Probability == 0 {
+		return ""
+	}
+
+	seed := fnv.New64a()
+	_, _ = seed.Write([]byte(job.JobID + "/" + strconv.Itoa(job.attempt)))
+	// #nosec G404 -- faults need to be reproducible, not unpredictable
+	if rand.New(rand.NewPCG(seed.Sum64(), 0)).Float64() >= fault.Probability {
+		return ""
+	}
+
+	metrics.InjectedFaultsTotal.WithLabelValues(w.workerID, string(job.ProcessingType), fault.Stage).Inc()
+	w.log.WarnContext(ctx, "injecting fault",
+		"job_id", job.JobID,
+		"attempt", job.attempt,
+		"stage", fault.Stage,
+		"fail_probability", fault.Probability)
+	return fault.Stage
+}
+
+// failInjected fails an attempt that processed the job at the process or write stage, discarding
+// the result it wrote.
+func (w *Worker) failInjected(ctx context.Context, job *ProcessingJob, stage, outputPath string) error {
+	if outputPath != "" {
+		if err := w.fsys.Remove(outputPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			w.log.WarnContext(ctx, "failed to remove result of job failed by injected fault",
+				"error", err,
+				"job_id", job.JobID,
+				"result_path", outputPath)
+		}
+	}
+
+	if stage == database.FailStageWrite {
+		return NewFileWriteError(outputPath, ErrInjectedFault)
+	}
+	return NewInjectedFaultError(stage)
+}
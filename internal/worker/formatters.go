@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// fileStats summarizes an input file for wordcount and linecount results.
+type fileStats struct {
+	File       string `json:"file"`
+	Lines      int    `json:"lines"`
+	Words      int    `json:"words"`
+	Characters int    `json:"characters"`
+	Bytes      int    `json:"bytes"`
+}
+
+func newFileStats(file, content string) fileStats {
+	lines := strings.Count(content, "\n")
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		lines++
+	}
+
+	return fileStats{
+		File:       file,
+		Lines:      lines,
+		Words:      len(strings.Fields(content)),
+		Characters: utf8.RuneCountInString(content),
+		Bytes:      len(content),
+	}
+}
+
+// extractMatch is a regex match with its byte offsets and 1-based line number.
+type extractMatch struct {
+	Match string `json:"match"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Line  int    `json:"line"`
+}
+
+type extractResult struct {
+	Pattern string         `json:"pattern"`
+	Count   int            `json:"count"`
+	Matches []extractMatch `json:"matches"`
+}
+
+func formatFileStats(stats fileStats, format database.OutputFormat) (string, error) {
+	switch format {
+	case database.OutputFormatJSON:
+		return formatJSON(stats)
+	case database.OutputFormatCSV:
+		return formatCSV([]string{"file", "lines", "words", "characters", "bytes"}, [][]string{{
+			stats.File, strconv.Itoa(stats.Lines), strconv.Itoa(stats.Words),
+			strconv.Itoa(stats.Characters), strconv.Itoa(stats.Bytes),
+		}})
+	case database.OutputFormatMarkdown:
+		return formatMarkdownTable([]string{"File", "Lines", "Words", "Characters", "Bytes"}, [][]string{{
+			stats.File, strconv.Itoa(stats.Lines), strconv.Itoa(stats.Words),
+			strconv.Itoa(stats.Characters), strconv.Itoa(stats.Bytes),
+		}}), nil
+	case database.OutputFormatText, database.OutputFormatJSONL:
+		return "", fmt.Errorf("file stats have no %s representation", format)
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+func formatExtractResult(result extractResult, format database.OutputFormat) (string, error) {
+	rows := make([][]string, 0, len(result.Matches))
+	for _, m := range result.Matches {
+		rows = append(rows, []string{m.Match, strconv.Itoa(m.Start), strconv.Itoa(m.End), strconv.Itoa(m.Line)})
+	}
+
+	switch format {
+	case database.OutputFormatJSON:
+		return formatJSON(result)
+	case database.OutputFormatCSV:
+		return formatCSV([]string{"match", "start", "end", "line"}, rows)
+	case database.OutputFormatMarkdown:
+		return formatMarkdownTable([]string{"Match", "Start", "End", "Line"}, rows), nil
+	case database.OutputFormatText:
+		matches := make([]string, 0, len(result.Matches))
+		for _, m := range result.Matches {
+			matches = append(matches, m.Match)
+		}
+		return strings.Join(matches, "\n"), nil
+	case database.OutputFormatJSONL:
+		return "", fmt.Errorf("extract results have no %s representation", format)
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", format)
+	}
+}
+
+func formatJSON(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal json result: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// formatJSONL encodes each record as a single line of JSON.
+func formatJSONL[T any](records []T) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return "", fmt.Errorf("marshal jsonl record: %w", err)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+func formatCSV(header []string, rows [][]string) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write(header); err != nil {
+		return "", fmt.Errorf("write csv header: %w", err)
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return "", fmt.Errorf("write csv rows: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+func formatMarkdownTable(header []string, rows [][]string) string {
+	var b strings.Builder
+
+	writeRow := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" ")
+			b.WriteString(escapeMarkdownCell(cell))
+			b.WriteString(" |")
+		}
+		b.WriteString("\n")
+	}
+
+	writeRow(header)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeRow(separator)
+
+	for _, row := range rows {
+		writeRow(row)
+	}
+
+	return b.String()
+}
+
+func escapeMarkdownCell(cell string) string {
+	cell = strings.ReplaceAll(cell, "|", `\|`)
+	return strings.ReplaceAll(cell, "\n", " ")
+}
@@ -5,23 +5,61 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/rsav/k8s-learning/internal/events"
 	"github.com/rsav/k8s-learning/internal/storage/database"
 	"github.com/rsav/k8s-learning/internal/storage/queue"
 )
 
 type JobConsumer interface {
-	ConsumeJob(ctx context.Context, timeout time.Duration) (*queue.SubmitJobMessage, error)
+	ConsumeJobs(ctx context.Context, timeout time.Duration, types []database.ProcessingType, limit int) ([]*queue.SubmitJobMessage, int, error)
+	ConsumePriorityJobs(ctx context.Context, timeout time.Duration, types []database.ProcessingType, limit int) ([]*queue.SubmitJobMessage, int, error)
+	StealJob(ctx context.Context, types []database.ProcessingType) (*queue.SubmitJobMessage, error)
+	StealPriorityJob(ctx context.Context, types []database.ProcessingType) (*queue.SubmitJobMessage, error)
 	PublishToFailedQueue(ctx context.Context, message queue.SubmitJobMessage, errorMsg string) error
+	SetJobProgress(ctx context.Context, jobID uuid.UUID, progress queue.JobProgress) error
+	RecordJobOutcome(ctx context.Context, failed bool) error
+	RecordHeartbeat(ctx context.Context, workerID string) error
+	RemoveHeartbeats(ctx context.Context, workerIDs ...string) error
+	ClaimJobs(ctx context.Context, jobIDs []uuid.UUID, workerID string, lease time.Duration) ([]queue.JobClaim, error)
+	CompleteJobClaim(ctx context.Context, jobID uuid.UUID, workerID string, ttl time.Duration) error
+	ReleaseJobClaim(ctx context.Context, jobID uuid.UUID) error
+	AckJob(ctx context.Context, ack queue.JobAck) error
+	RecordDelivery(ctx context.Context, jobID uuid.UUID, workerID string) (queue.JobDeliveries, error)
+	RecordDeliveryError(ctx context.Context, jobID uuid.UUID, errorMsg string) error
+	Quarantine(ctx context.Context, message queue.PoisonMessage) error
+	EnqueueEmail(ctx context.Context, message queue.EmailMessage) error
+	ProcessingPaused(ctx context.Context) (bool, error)
+	WatchMemory(ctx context.Context, watermark float64, interval time.Duration)
+	MemoryHigh() bool
 	HealthCheck(ctx context.Context) error
 	Close() error
 }
 
+type EventPublisher interface {
+	Publish(ctx context.Context, event events.Event)
+}
+
 type ProcessingJob struct {
 	JobID          string
 	FilePath       string
-	ProcessingType database.ProcessingType
-	Parameters     map[string]any
-	DelayMS        int
+	SecondFilePath string
+	// OriginalFilename and SecondOriginalFilename are the uploaded names of the files, empty for
+	// messages queued before they were carried.
+	OriginalFilename       string
+	SecondOriginalFilename string
+	ProcessingType         database.ProcessingType
+	Parameters             map[string]any
+	// child is set by processors that run external processes, for usage accounting.
+	child childUsage
+	// progress counts the input read by processors; nil when progress is not reported.
+	progress *progressTracker
+	// attempt is the 1-based processing attempt, counting retries.
+	attempt int
+	// version numbers the result the attempt writes, counting the attempts of every delivery.
+	version int
+	// sharedResult is set when the result shares the bytes of the input rather than copying them.
+	sharedResult bool
 }
 
 // ProcessingError represents an error that occurred during job processing.
@@ -42,6 +80,9 @@ const (
 	ErrorTypeInvalidParam    ErrorType = "invalid_parameter"
 	ErrorTypeRegexCompile    ErrorType = "regex_compile"
 	ErrorTypeProcessingLogic ErrorType = "processing_logic"
+	ErrorTypeCommand         ErrorType = "command"
+	ErrorTypeTimeout         ErrorType = "timeout"
+	ErrorTypeInjectedFault   ErrorType = "injected_fault"
 )
 
 // NewFileReadError creates a new file read error.
@@ -92,6 +133,36 @@ func NewProcessingLogicError(operation string, details string) *ProcessingError
 	}
 }
 
+// NewCommandError creates a new error for an external command that failed or was not allowed.
+func NewCommandError(command string, details string, cause error) *ProcessingError {
+	return &ProcessingError{
+		Type:    ErrorTypeCommand,
+		Message: fmt.Sprintf("command failed: %s", command),
+		Details: details,
+		Cause:   cause,
+	}
+}
+
+// NewTimeoutError creates a new error for a job that was not processed within the job timeout.
+func NewTimeoutError(timeout time.Duration, cause error) *ProcessingError {
+	return &ProcessingError{
+		Type:    ErrorTypeTimeout,
+		Message: "job timed out",
+		Details: fmt.Sprintf("timeout: %s", timeout),
+		Cause:   cause,
+	}
+}
+
+// NewInjectedFaultError creates a new error for a fault injected at the process stage.
+func NewInjectedFaultError(stage string) *ProcessingError {
+	return &ProcessingError{
+		Type:    ErrorTypeInjectedFault,
+		Message: "injected fault",
+		Details: fmt.Sprintf("stage: %s", stage),
+		Cause:   ErrInjectedFault,
+	}
+}
+
 // Error implements the error interface.
 func (pe *ProcessingError) Error() string {
 	if pe.Details != "" {
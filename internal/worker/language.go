@@ -0,0 +1,171 @@
+package worker
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// languageSampleSize bounds how much of the input detect_language reads; a sample this large
+// decides the language as well as the whole file would.
+const languageSampleSize = 1 << 20
+
+// Languages written in scripts of their own are identified by the script alone.
+//
+//nolint:gochecknoglobals // lookup table
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+}
+
+// Languages written in Latin script are told apart by their most frequent words.
+//
+//nolint:gochecknoglobals // lookup table
+var latinStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "that", "it", "for", "was", "with", "on", "as", "are", "this", "be", "by", "not", "or", "have"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "del", "se", "las", "por", "un", "para", "con", "una", "es", "no", "su", "al", "lo"},
+	"fr": {"le", "la", "de", "et", "les", "des", "est", "un", "une", "du", "en", "que", "pour", "dans", "qui", "pas", "sur", "au", "avec", "ce"},
+	"de": {"der", "die", "und", "in", "den", "von", "zu", "das", "mit", "sich", "des", "auf", "ist", "nicht", "ein", "eine", "dem", "auch", "es", "im"},
+	"it": {"il", "di", "che", "la", "e", "per", "un", "in", "del", "non", "una", "sono", "della", "le", "con", "si", "gli", "da", "al", "è"},
+	"pt": {"de", "que", "o", "a", "do", "da", "em", "um", "para", "com", "não", "uma", "os", "no", "se", "na", "por", "mais", "as", "dos"},
+	"nl": {"de", "het", "een", "en", "van", "ik", "te", "dat", "die", "in", "is", "niet", "op", "zijn", "met", "voor", "hij", "maar", "ook", "als"},
+	"sv": {"och", "att", "det", "som", "en", "på", "är", "av", "för", "med", "till", "den", "har", "inte", "om", "ett", "han", "men", "var", "jag"},
+	"pl": {"i", "w", "nie", "na", "się", "z", "jest", "że", "do", "to", "o", "jak", "ale", "po", "co", "tak", "za", "od", "przez", "czy"},
+}
+
+// languageScore is a probable language of the input.
+type languageScore struct {
+	Language   string  `json:"language"`
+	Confidence float64 `json:"confidence"`
+}
+
+// languageResult is the result of a detect_language job.
+type languageResult struct {
+	Languages []languageScore `json:"languages"`
+	// Words is how many words of the sample were considered.
+	Words int `json:"words"`
+	// Truncated is set when only the first part of the input was sampled.
+	Truncated bool `json:"truncated"`
+}
+
+// detectLanguages scores the languages of content and returns the top most probable ones with
+// confidences summing to at most 1. Text with neither letters of a distinct script nor frequent
+// words of a known language has no languages.
+func detectLanguages(content string, top int) ([]languageScore, int) {
+	scores := make(map[string]float64)
+
+	letters := 0
+	for _, r := range content {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, sl := range scriptLanguages {
+			if unicode.Is(sl.script, r) {
+				scores[sl.language]++
+				break
+			}
+		}
+	}
+
+	// Japanese mixes kanji with kana, so Han characters alongside kana are Japanese
+	if scores["ja"] > 0 {
+		scores["ja"] += scores["zh"]
+		delete(scores, "zh")
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	// Latin letters count towards the languages whose stopwords they use, in proportion
+	latinLetters := float64(letters)
+	for _, score := range scores {
+		latinLetters -= score
+	}
+	if latinLetters > 0 {
+		hits := make(map[string]float64, len(latinStopwords))
+		total := 0.0
+		for _, word := range words {
+			for language, stopwords := range latinStopwords {
+				if slices.Contains(stopwords, word) {
+					hits[language]++
+					total++
+				}
+			}
+		}
+		for language, count := range hits {
+			scores[language] = latinLetters * count / total
+		}
+	}
+
+	var sum float64
+	for _, score := range scores {
+		sum += score
+	}
+
+	languages := make([]languageScore, 0, len(scores))
+	for language, score := range scores {
+		languages = append(languages, languageScore{
+			Language:   language,
+			Confidence: math.Round(score/sum*1000) / 1000,
+		})
+	}
+	slices.SortFunc(languages, func(a, b languageScore) int {
+		return cmp.Or(cmp.Compare(b.Confidence, a.Confidence), cmp.Compare(a.Language, b.Language))
+	})
+
+	return languages[:min(top, len(languages))], len(words)
+}
+
+func (tp *TextProcessor) processLanguage(_ context.Context, job *ProcessingJob) (string, error) {
+	top, err := database.LanguageTopFrom(job.Parameters)
+	if err != nil {
+		return "", NewInvalidParamError("parameters", err.Error())
+	}
+
+	file, size, err := tp.openFile(job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+	defer file.Close()
+
+	sample, err := io.ReadAll(io.LimitReader(job.progress.reader(file), languageSampleSize))
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+
+	languages, words := detectLanguages(strings.ToValidUTF8(string(sample), ""), top)
+	result, err := formatJSON(languageResult{
+		Languages: languages,
+		Words:     words,
+		Truncated: size > languageSampleSize,
+	})
+	if err != nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), err.Error())
+	}
+
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatJSON)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
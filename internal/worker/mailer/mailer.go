@@ -0,0 +1,189 @@
+// Package mailer delivers the job notification emails workers queue in Redis. A pool of sender
+// goroutines consumes the outbox independently of job processing, retries failed deliveries with
+// exponential backoff and suppresses recipients the SMTP server rejects permanently.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/worker/metrics"
+)
+
+const (
+	// consumeTimeout bounds how long a sender waits for an email before checking for shutdown.
+	consumeTimeout = 5 * time.Second
+	// promoteInterval is how often due retries are moved back to the outbox.
+	promoteInterval = 5 * time.Second
+	// errorBackoff is how long a sender waits after the outbox could not be read.
+	errorBackoff = time.Second
+	// maxRetryDelay caps the exponential backoff between delivery attempts.
+	maxRetryDelay = 6 * time.Hour
+)
+
+// Outcomes of a delivery, as counted by the worker_emails_total metric.
+const (
+	statusSent       = "sent"
+	statusRetried    = "retried"
+	statusFailed     = "failed"
+	statusSuppressed = "suppressed"
+)
+
+// Outbox is the queue of emails and the suppression list.
+type Outbox interface {
+	ConsumeEmail(ctx context.Context, timeout time.Duration) (*queue.EmailMessage, error)
+	RetryEmail(ctx context.Context, message queue.EmailMessage, at time.Time) error
+	PromoteDueEmails(ctx context.Context) (int, error)
+	SuppressEmail(ctx context.Context, address string) error
+	IsEmailSuppressed(ctx context.Context, address string) (bool, error)
+}
+
+// Sender delivers the emails of the outbox through the SMTP server.
+type Sender struct {
+	cfg      config.Email
+	outbox   Outbox
+	smtp     *smtpClient
+	workerID string
+	log      *slog.Logger
+}
+
+// NewSender creates a sender for the SMTP server of cfg. The worker ID labels its metrics.
+func NewSender(cfg config.Email, outbox Outbox, workerID string, log *slog.Logger) (*Sender, error) {
+	client, err := newSMTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sender{
+		cfg:      cfg,
+		outbox:   outbox,
+		smtp:     client,
+		workerID: workerID,
+		log:      log.With("component", "mailer"),
+	}, nil
+}
+
+// Start runs the sender goroutines and the promotion of due retries until ctx is done. Emails being
+// sent when ctx is done are still delivered.
+func (s *Sender) Start(ctx context.Context) {
+	s.log.InfoContext(ctx, "starting email senders", "senders", s.cfg.Senders,
+		"smtp_host", s.cfg.SMTPHost, "smtp_port", s.cfg.SMTPPort)
+
+	var wg sync.WaitGroup
+	for range s.cfg.Senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.sendLoop(ctx)
+		}()
+	}
+
+	s.promoteLoop(ctx)
+	wg.Wait()
+}
+
+func (s *Sender) sendLoop(ctx context.Context) {
+	for ctx.Err() == nil {
+		message, err := s.outbox.ConsumeEmail(ctx, consumeTimeout)
+		if err != nil {
+			if errors.Is(err, queue.ErrNoEmailsAvailable) || ctx.Err() != nil {
+				continue
+			}
+			s.log.ErrorContext(ctx, "failed to consume email", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(errorBackoff):
+			}
+			continue
+		}
+
+		s.deliver(context.WithoutCancel(ctx), *message)
+	}
+}
+
+func (s *Sender) promoteLoop(ctx context.Context) {
+	ticker := time.NewTicker(promoteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if promoted, err := s.outbox.PromoteDueEmails(ctx); err != nil && ctx.Err() == nil {
+			s.log.ErrorContext(ctx, "failed to promote email retries", "error", err)
+		} else if promoted > 0 {
+			s.log.DebugContext(ctx, "promoted email retries", "count", promoted)
+		}
+	}
+}
+
+// deliver sends the email unless its recipient is suppressed, and retries or drops it on failure.
+func (s *Sender) deliver(ctx context.Context, message queue.EmailMessage) {
+	log := s.log.With("email_id", message.ID, "job_id", message.JobID, "attempt", message.Attempts+1)
+
+	suppressed, err := s.outbox.IsEmailSuppressed(ctx, message.To)
+	if err != nil {
+		// Sending is preferred over losing the email
+		log.WarnContext(ctx, "failed to check email suppression", "error", err)
+	}
+	if suppressed {
+		log.InfoContext(ctx, "dropping email to suppressed recipient")
+		s.count(statusSuppressed)
+		return
+	}
+
+	err = s.smtp.send(ctx, message)
+	if err == nil {
+		log.InfoContext(ctx, "email sent")
+		s.count(statusSent)
+		return
+	}
+
+	var rejected *recipientRejectedError
+	if errors.As(err, &rejected) {
+		log.WarnContext(ctx, "recipient rejected, suppressing further emails", "error", err)
+		if err := s.outbox.SuppressEmail(ctx, message.To); err != nil {
+			log.ErrorContext(ctx, "failed to suppress email recipient", "error", err)
+		}
+		s.count(statusFailed)
+		return
+	}
+
+	message.Attempts++
+	message.LastError = err.Error()
+	if isPermanent(err) || message.Attempts >= s.cfg.MaxAttempts {
+		log.ErrorContext(ctx, "email not delivered, giving up", "error", err)
+		s.count(statusFailed)
+		return
+	}
+
+	delay := s.retryDelay(message.Attempts)
+	if err := s.outbox.RetryEmail(ctx, message, time.Now().Add(delay)); err != nil {
+		log.ErrorContext(ctx, "failed to schedule email retry, dropping email", "error", err, "send_error", message.LastError)
+		s.count(statusFailed)
+		return
+	}
+	log.WarnContext(ctx, "email not delivered, retrying", "error", err, "retry_in", delay)
+	s.count(statusRetried)
+}
+
+// retryDelay returns the delay after the given number of failed attempts, doubled after every one.
+func (s *Sender) retryDelay(attempts int) time.Duration {
+	delay := s.cfg.RetryDelay
+	for range attempts - 1 {
+		delay = min(2*delay, maxRetryDelay) //nolint:mnd // double the delay
+	}
+	return delay
+}
+
+func (s *Sender) count(status string) {
+	metrics.EmailsTotal.WithLabelValues(s.workerID, status).Inc()
+}
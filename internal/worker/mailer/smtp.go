@@ -0,0 +1,155 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+// recipientRejectedError is a permanent rejection of the recipient address by the SMTP server.
+type recipientRejectedError struct {
+	err error
+}
+
+func (e *recipientRejectedError) Error() string {
+	return fmt.Sprintf("recipient rejected: %v", e.err)
+}
+
+func (e *recipientRejectedError) Unwrap() error {
+	return e.err
+}
+
+// isPermanent reports whether the SMTP server refused the email with a 5xx reply, which another
+// attempt would get again.
+func isPermanent(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr) && protoErr.Code >= 500
+}
+
+// smtpClient sends emails through the SMTP server, opening a connection per email.
+type smtpClient struct {
+	cfg  config.Email
+	from *mail.Address
+	// domain of the sender address, for the Message-ID header.
+	domain string
+}
+
+func newSMTPClient(cfg config.Email) (*smtpClient, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("parse email from address: %w", err)
+	}
+
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	return &smtpClient{cfg: cfg, from: from, domain: domain}, nil
+}
+
+// send delivers the email within the send timeout.
+func (c *smtpClient) send(ctx context.Context, message queue.EmailMessage) error {
+	dialer := net.Dialer{Timeout: c.cfg.SendTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.cfg.SMTPHost, strconv.Itoa(c.cfg.SMTPPort)))
+	if err != nil {
+		return fmt.Errorf("connect to smtp server: %w", err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(c.cfg.SendTimeout)); err != nil {
+		conn.Close()
+		return fmt.Errorf("set smtp deadline: %w", err)
+	}
+
+	tlsConfig := &tls.Config{ServerName: c.cfg.SMTPHost, MinVersion: tls.VersionTLS12}
+	if c.cfg.SMTPTLS == config.SMTPTLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, c.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("start smtp session: %w", err)
+	}
+	defer client.Close()
+
+	if c.cfg.SMTPTLS == config.SMTPTLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+
+	if c.cfg.SMTPUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", c.cfg.SMTPUsername, c.cfg.SMTPPassword, c.cfg.SMTPHost)); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(c.from.Address); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	if err := client.Rcpt(message.To); err != nil {
+		if isPermanent(err) {
+			return &recipientRejectedError{err: err}
+		}
+		return fmt.Errorf("smtp rcpt to: %w", err)
+	}
+
+	body, err := c.build(message)
+	if err != nil {
+		return err
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := writer.Write(body); err != nil {
+		return fmt.Errorf("write email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+
+	// The server accepted the email, so a failing QUIT does not make it undelivered
+	_ = client.Quit()
+	return nil
+}
+
+// build renders the email as a plain text MIME message.
+func (c *smtpClient) build(message queue.EmailMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", c.from.String())
+	header("To", message.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", message.ID, c.domain))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	writer := quotedprintable.NewWriter(&buf)
+	if _, err := writer.Write([]byte(message.Body)); err != nil {
+		return nil, fmt.Errorf("encode email body: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("encode email body: %w", err)
+	}
+	return buf.Bytes(), nil
+}
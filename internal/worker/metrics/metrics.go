@@ -2,40 +2,96 @@ package metrics
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rsav/k8s-learning/internal/observability"
+	"github.com/rsav/k8s-learning/internal/telemetry"
+)
+
+const (
+	// nativeHistogramBucketFactor enables sparse native histograms alongside the classic buckets.
+	nativeHistogramBucketFactor = 1.1
+	nativeHistogramMaxBuckets   = 160
 )
 
 var (
 	// JobsProcessedTotal tracks the total number of jobs processed by the worker.
-	JobsProcessedTotal = promauto.NewCounterVec(
+	JobsProcessedTotal = telemetry.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "worker_jobs_processed_total",
+			Name: observability.MetricWorkerJobsProcessed,
 			Help: "Total number of jobs processed by the worker",
 		},
 		[]string{"worker_id", "processing_type", "status"},
 	)
 
-	// JobProcessingDuration tracks job processing duration in seconds.
-	JobProcessingDuration = promauto.NewHistogramVec(
+	// JobProcessingDuration tracks job processing duration in seconds, without the simulated delay.
+	JobProcessingDuration = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "worker_job_processing_duration_seconds",
-			Help:    "Job processing duration in seconds",
-			Buckets: prometheus.DefBuckets,
+			Name:                           observability.MetricWorkerJobDuration,
+			Help:                           "Job processing duration in seconds, excluding the simulated delay",
+			Buckets:                        prometheus.DefBuckets,
+			NativeHistogramBucketFactor:    nativeHistogramBucketFactor,
+			NativeHistogramMaxBucketNumber: nativeHistogramMaxBuckets,
 		},
 		[]string{"worker_id", "processing_type"},
 	)
 
+	// JobCPUSecondsTotal, JobWallSecondsTotal and JobBytes*Total account resource usage per tenant
+	// and processing type for chargeback and showback dashboards.
+	JobCPUSecondsTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_job_cpu_seconds_total",
+			Help: "CPU time consumed by jobs, including external processes",
+		},
+		[]string{"tenant_id", "processing_type"},
+	)
+
+	JobWallSecondsTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_job_wall_seconds_total",
+			Help: "Wall time spent processing jobs",
+		},
+		[]string{"tenant_id", "processing_type"},
+	)
+
+	JobBytesReadTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_job_bytes_read_total",
+			Help: "Input bytes read by jobs",
+		},
+		[]string{"tenant_id", "processing_type"},
+	)
+
+	JobBytesWrittenTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_job_bytes_written_total",
+			Help: "Result bytes written by jobs",
+		},
+		[]string{"tenant_id", "processing_type"},
+	)
+
+	// JobQueueWaitSeconds tracks how long jobs waited in the queue per tenant, from publishing to
+	// consumption, which shows whether tenants are served fairly under mixed load.
+	JobQueueWaitSeconds = telemetry.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:                           "worker_job_queue_wait_seconds",
+			Help:                           "Time jobs waited in the queue before a worker consumed them in seconds",
+			Buckets:                        []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900, 3600},
+			NativeHistogramBucketFactor:    nativeHistogramBucketFactor,
+			NativeHistogramMaxBucketNumber: nativeHistogramMaxBuckets,
+		},
+		[]string{"tenant_id", "processing_type"},
+	)
+
 	// JobsActive tracks the number of jobs currently being processed.
-	JobsActive = promauto.NewGaugeVec(
+	JobsActive = telemetry.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "worker_jobs_active",
+			Name: observability.MetricWorkerJobsActive,
 			Help: "Number of jobs currently being processed by the worker",
 		},
 		[]string{"worker_id"},
 	)
 
 	// JobDelaySeconds tracks the configured delay for jobs in seconds.
-	JobDelaySeconds = promauto.NewHistogramVec(
+	JobDelaySeconds = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "worker_job_delay_seconds",
 			Help:    "Configured delay for jobs in seconds",
@@ -44,8 +100,28 @@ var (
 		[]string{"worker_id", "processing_type"},
 	)
 
+	// JobSimulatedDelaySeconds tracks how long jobs actually slept for their configured delay, which
+	// worker_job_processing_duration_seconds leaves out.
+	JobSimulatedDelaySeconds = telemetry.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "worker_job_simulated_delay_seconds",
+			Help:    "Time jobs spent in their simulated processing delay in seconds",
+			Buckets: []float64{0, 1, 5, 10, 30, 60},
+		},
+		[]string{"worker_id", "processing_type"},
+	)
+
+	// InjectedFaultsTotal tracks processing attempts failed by fault injection.
+	InjectedFaultsTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_injected_faults_total",
+			Help: "Total number of processing attempts failed by fault injection",
+		},
+		[]string{"worker_id", "processing_type", "stage"},
+	)
+
 	// DBQueriesTotal tracks the total number of database queries by operation.
-	DBQueriesTotal = promauto.NewCounterVec(
+	DBQueriesTotal = telemetry.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "worker_db_queries_total",
 			Help: "Total number of database queries by the worker",
@@ -54,7 +130,7 @@ var (
 	)
 
 	// DBQueryDuration tracks database query duration in seconds.
-	DBQueryDuration = promauto.NewHistogramVec(
+	DBQueryDuration = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "worker_db_query_duration_seconds",
 			Help:    "Database query duration in seconds",
@@ -64,7 +140,7 @@ var (
 	)
 
 	// RedisOperationsTotal tracks the total number of Redis operations.
-	RedisOperationsTotal = promauto.NewCounterVec(
+	RedisOperationsTotal = telemetry.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "worker_redis_operations_total",
 			Help: "Total number of Redis operations by the worker",
@@ -73,7 +149,7 @@ var (
 	)
 
 	// RedisOperationDuration tracks Redis operation duration in seconds.
-	RedisOperationDuration = promauto.NewHistogramVec(
+	RedisOperationDuration = telemetry.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "worker_redis_operation_duration_seconds",
 			Help:    "Redis operation duration in seconds",
@@ -82,8 +158,113 @@ var (
 		[]string{"worker_id", "operation"},
 	)
 
+	// DuplicateDeliveriesTotal counts job messages dropped because the job was already claimed in
+	// the idempotency ledger.
+	DuplicateDeliveriesTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_duplicate_deliveries_total",
+			Help: "Total number of duplicate job deliveries skipped by the worker",
+		},
+		[]string{"worker_id", "processing_type"},
+	)
+
+	// JobRetriesTotal counts jobs processed again after a failed attempt.
+	JobRetriesTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_job_retries_total",
+			Help: "Total number of job retries after failed processing attempts",
+		},
+		[]string{"worker_id", "processing_type"},
+	)
+
+	// JobTimeoutsTotal counts processing attempts cancelled by the job timeout.
+	JobTimeoutsTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_job_timeouts_total",
+			Help: "Total number of job processing attempts that exceeded the job timeout",
+		},
+		[]string{"worker_id", "processing_type"},
+	)
+
+	// JobsConsumedTotal counts consumed jobs by the queue they came from: the worker's own queues, or
+	// those of other processing types it stole from while its own were empty.
+	JobsConsumedTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_jobs_consumed_total",
+			Help: "Total number of jobs consumed by the worker by source (own or stolen) and processing type",
+		},
+		[]string{"worker_id", "source", "processing_type"},
+	)
+
+	// ConsumeBatchSize tracks how many jobs the worker popped per round trip to Redis, which stays
+	// below CONSUME_BATCH_SIZE while the queues run dry or the worker has few free job slots.
+	ConsumeBatchSize = telemetry.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "worker_consume_batch_size",
+			Help:    "Number of jobs consumed per round trip to Redis",
+			Buckets: []float64{1, 2, 5, 10, 20, 50, 100},
+		},
+		[]string{"worker_id"},
+	)
+
+	// QuarantinedMessagesTotal counts messages moved to the poison queue instead of processed.
+	QuarantinedMessagesTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_quarantined_messages_total",
+			Help: "Total number of consumed messages quarantined in the poison queue",
+		},
+		[]string{"worker_id", "reason"},
+	)
+
+	// EmailsTotal counts the job notification emails handled by the senders by outcome: sent,
+	// retried, failed after the last attempt or rejected, and suppressed.
+	EmailsTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_emails_total",
+			Help: "Total number of job notification emails by outcome",
+		},
+		[]string{"worker_id", "status"},
+	)
+
+	// ResultDeliveriesTotal counts the results pushed to result sinks by outcome, delivered or
+	// failed after the last attempt; ResultDeliveryRetriesTotal counts the attempts retried.
+	ResultDeliveriesTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_result_deliveries_total",
+			Help: "Total number of job results pushed to result sinks by outcome",
+		},
+		[]string{"worker_id", "sink", "status"},
+	)
+
+	ResultDeliveryRetriesTotal = telemetry.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_result_delivery_retries_total",
+			Help: "Total number of result delivery attempts retried",
+		},
+		[]string{"worker_id", "sink"},
+	)
+
+	// ResultDeliveryDuration tracks how long delivering a result to a sink took, retries included.
+	ResultDeliveryDuration = telemetry.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "worker_result_delivery_duration_seconds",
+			Help:    "Duration of result deliveries to sinks in seconds, including retries",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"worker_id", "sink"},
+	)
+
+	// WorkerPaused is 1 while job consumption is paused or draining through the admin endpoints.
+	WorkerPaused = telemetry.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_paused",
+			Help: "Whether job consumption is paused (1) or running (0)",
+		},
+		[]string{"worker_id"},
+	)
+
 	// WorkerInfo provides worker metadata as labels.
-	WorkerInfo = promauto.NewGaugeVec(
+	WorkerInfo = telemetry.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "worker_info",
 			Help: "Worker information (constant 1)",
@@ -0,0 +1,207 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// Plugin ABI: a module exports its linear memory as "memory", alloc(size i32) -> ptr i32 to
+// reserve space for the input, and process(ptr i32, len i32) -> i64 returning the output
+// location packed as ptr<<32 | len. A trap, or a WASI proc_exit with a non-zero code, fails
+// the job; anything the plugin wrote to stderr is reported as the error detail.
+const (
+	pluginExtension     = ".wasm"
+	pluginMemoryExport  = "memory"
+	pluginAllocExport   = "alloc"
+	pluginProcessExport = "process"
+	// pluginInitExport is the WASI reactor initializer emitted by TinyGo and Rust toolchains.
+	pluginInitExport = "_initialize"
+)
+
+// pluginRegistry holds WASM plugins compiled at startup. Each job runs in a fresh module
+// instance, so plugins cannot keep state between jobs.
+type pluginRegistry struct {
+	runtime wazero.Runtime
+	modules map[string]wazero.CompiledModule
+	config  config.Plugins
+}
+
+// loadPlugins compiles every <name>.wasm in cfg.Dir. Modules that do not implement the plugin ABI
+// are logged and skipped so that one broken plugin does not keep the worker from starting.
+func loadPlugins(ctx context.Context, cfg config.Plugins, log *slog.Logger) (*pluginRegistry, error) {
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("read plugin directory: %w", err)
+	}
+
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(cfg.MemoryLimitPages()).
+		WithCloseOnContextDone(true))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		_ = runtime.Close(ctx)
+		return nil, fmt.Errorf("instantiate wasi: %w", err)
+	}
+
+	registry := &pluginRegistry{
+		runtime: runtime,
+		modules: make(map[string]wazero.CompiledModule),
+		config:  cfg,
+	}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), pluginExtension)
+		if !ok || entry.IsDir() {
+			continue
+		}
+
+		if err := registry.load(ctx, name, filepath.Join(cfg.Dir, entry.Name())); err != nil {
+			log.ErrorContext(ctx, "skipping invalid plugin", "plugin", name, "error", err)
+			continue
+		}
+	}
+
+	log.InfoContext(ctx, "loaded plugins", "dir", cfg.Dir, "plugins", registry.names())
+	return registry, nil
+}
+
+func (r *pluginRegistry) load(ctx context.Context, name, path string) error {
+	if !database.ValidPluginName(name) {
+		return errors.New("file name must be lowercase letters, digits, '-' or '_'")
+	}
+
+	// #nosec G304 -- path is a file in the operator-configured plugin directory
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read module: %w", err)
+	}
+
+	compiled, err := r.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return fmt.Errorf("compile module: %w", err)
+	}
+
+	if err := checkPluginExports(compiled); err != nil {
+		_ = compiled.Close(ctx)
+		return err
+	}
+
+	r.modules[name] = compiled
+	return nil
+}
+
+func checkPluginExports(compiled wazero.CompiledModule) error {
+	if _, ok := compiled.ExportedMemories()[pluginMemoryExport]; !ok {
+		return fmt.Errorf("module does not export %q", pluginMemoryExport)
+	}
+
+	i32, i64 := api.ValueTypeI32, api.ValueTypeI64
+	signatures := map[string]struct{ params, results []api.ValueType }{
+		pluginAllocExport:   {params: []api.ValueType{i32}, results: []api.ValueType{i32}},
+		pluginProcessExport: {params: []api.ValueType{i32, i32}, results: []api.ValueType{i64}},
+	}
+
+	functions := compiled.ExportedFunctions()
+	for name, want := range signatures {
+		fn, ok := functions[name]
+		if !ok {
+			return fmt.Errorf("module does not export function %q", name)
+		}
+		if !slices.Equal(fn.ParamTypes(), want.params) || !slices.Equal(fn.ResultTypes(), want.results) {
+			return fmt.Errorf("function %q has signature %v -> %v, want %v -> %v",
+				name, fn.ParamTypes(), fn.ResultTypes(), want.params, want.results)
+		}
+	}
+
+	return nil
+}
+
+func (r *pluginRegistry) has(name string) bool {
+	_, ok := r.modules[name]
+	return ok
+}
+
+// names returns the registered plugin names in sorted order.
+func (r *pluginRegistry) names() []string {
+	names := make([]string, 0, len(r.modules))
+	for name := range r.modules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// run passes input to the plugin's process function and returns a copy of its output.
+func (r *pluginRegistry) run(ctx context.Context, name string, input []byte) ([]byte, error) {
+	compiled, ok := r.modules[name]
+	if !ok {
+		return nil, NewInvalidParamError("processing_type", fmt.Sprintf("plugin %q is not loaded on this worker", name))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	stderr := &limitedBuffer{limit: maxCommandStderr, truncate: true}
+	module, err := r.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStderr(stderr).
+		WithStartFunctions(pluginInitExport))
+	if err != nil {
+		return nil, pluginError(ctx, name, "instantiate", stderr, err)
+	}
+	defer module.Close(ctx)
+
+	results, err := module.ExportedFunction(pluginAllocExport).Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, pluginError(ctx, name, pluginAllocExport, stderr, err)
+	}
+
+	inputPtr := uint32(results[0]) //nolint:gosec // i32 result
+	if !module.Memory().Write(inputPtr, input) {
+		return nil, NewProcessingLogicError(database.PluginProcessingTypePrefix+name, "alloc returned a region outside module memory")
+	}
+
+	results, err = module.ExportedFunction(pluginProcessExport).Call(ctx, uint64(inputPtr), uint64(len(input)))
+	if err != nil {
+		return nil, pluginError(ctx, name, pluginProcessExport, stderr, err)
+	}
+
+	outputPtr, outputLen := uint32(results[0]>>32), uint32(results[0]) //nolint:gosec,mnd // unpack ptr<<32 | len
+	output, ok := module.Memory().Read(outputPtr, outputLen)
+	if !ok {
+		return nil, NewProcessingLogicError(database.PluginProcessingTypePrefix+name, "process returned a region outside module memory")
+	}
+
+	// Read returns a view of module memory, which is released on Close
+	return slices.Clone(output), nil
+}
+
+func pluginError(ctx context.Context, name, stage string, stderr *limitedBuffer, err error) error {
+	details := strings.TrimSpace(stderr.String())
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		details = "timed out"
+	case details == "":
+		details = err.Error()
+	}
+	return NewCommandError(database.PluginProcessingTypePrefix+name+" "+stage, details, err)
+}
+
+func (r *pluginRegistry) close(ctx context.Context) error {
+	if err := r.runtime.Close(ctx); err != nil {
+		return fmt.Errorf("close wasm runtime: %w", err)
+	}
+	return nil
+}
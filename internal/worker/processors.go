@@ -3,38 +3,71 @@ package worker
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
-	"time"
 
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/encryption"
+	"github.com/rsav/k8s-learning/internal/processing/schemas"
 	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
+	"github.com/spf13/afero"
 )
 
 type TextProcessor struct {
+	// fsys is the filesystem of the input and result files, the OS one outside of tests.
+	fsys      afero.Fs
 	resultDir string
-	log       *slog.Logger
+	// keys decrypt input files and encrypt results; nil when files are not encrypted at rest.
+	keys *encryption.Keyring
+	// commands runs exec jobs; nil when exec processing is disabled.
+	commands *commandRunner
+	// plugins runs plugin:<name> jobs; nil when no plugin directory is configured.
+	plugins *pluginRegistry
+	// versionResults names results after the attempt writing them rather than overwriting the
+	// result of earlier attempts.
+	versionResults bool
+	log            *slog.Logger
 }
 
-func NewTextProcessor(resultDir string, logger *slog.Logger) *TextProcessor {
-	return &TextProcessor{
-		resultDir: resultDir,
-		log:       logger,
+func NewTextProcessor(
+	fsys afero.Fs, resultDir, resultPolicy string, execConfig config.Exec, keys *encryption.Keyring, logger *slog.Logger,
+) *TextProcessor {
+	tp := &TextProcessor{
+		fsys:           fsys,
+		resultDir:      resultDir,
+		keys:           keys,
+		versionResults: resultPolicy == config.ResultPolicyVersion,
+		log:            logger,
 	}
+	if execConfig.Enabled {
+		tp.commands = newCommandRunner(execConfig, logger)
+	}
+	return tp
 }
 
 func (tp *TextProcessor) CanProcess(processingType database.ProcessingType) bool {
 	switch processingType {
 	case database.ProcessingTypeWordCount, database.ProcessingTypeLineCount,
 		database.ProcessingTypeUppercase, database.ProcessingTypeLowercase,
-		database.ProcessingTypeReplace, database.ProcessingTypeExtract:
+		database.ProcessingTypeReplace, database.ProcessingTypeExtract,
+		database.ProcessingTypeDiff, database.ProcessingTypeTextStats,
+		database.ProcessingTypeChunk, database.ProcessingTypeRedact,
+		database.ProcessingTypePIIReport, database.ProcessingTypeLanguage,
+		database.ProcessingTypeTranscode:
 		return true
+	case database.ProcessingTypeExec:
+		return tp.commands != nil
 	default:
-		return false
+		name, ok := processingType.PluginName()
+		return ok && tp.plugins != nil && tp.plugins.has(name)
 	}
 }
 
@@ -42,22 +75,11 @@ func (tp *TextProcessor) Process(ctx context.Context, job *ProcessingJob) (strin
 	tp.log.InfoContext(ctx, "processing text job",
 		"job_id", job.JobID,
 		"processing_type", job.ProcessingType,
-		"file_path", job.FilePath,
-		"delay_ms", job.DelayMS)
-
-	// Apply delay for stress testing if specified
-	if job.DelayMS > 0 {
-		delayDuration := time.Duration(job.DelayMS) * time.Millisecond
-		tp.log.InfoContext(ctx, "applying processing delay for stress testing",
-			"job_id", job.JobID,
-			"delay_ms", job.DelayMS)
-
-		select {
-		case <-ctx.Done():
-			return "", fmt.Errorf("context cancelled during delay: %w", ctx.Err())
-		case <-time.After(delayDuration):
-			// Delay completed, continue processing
-		}
+		"file_path", job.FilePath)
+
+	// Revalidate: jobs queued before a schema change, or by other producers, reach workers too
+	if err := schemas.Validate(job.ProcessingType, job.Parameters); err != nil {
+		return "", NewInvalidParamError("parameters", err.Error())
 	}
 
 	switch job.ProcessingType {
@@ -73,21 +95,47 @@ func (tp *TextProcessor) Process(ctx context.Context, job *ProcessingJob) (strin
 		return tp.processReplace(ctx, job)
 	case database.ProcessingTypeExtract:
 		return tp.processExtract(ctx, job)
+	case database.ProcessingTypeDiff:
+		return tp.processDiff(ctx, job)
+	case database.ProcessingTypeTextStats:
+		return tp.processTextStats(ctx, job)
+	case database.ProcessingTypeChunk:
+		return tp.processChunk(ctx, job)
+	case database.ProcessingTypeRedact:
+		return tp.processRedact(ctx, job)
+	case database.ProcessingTypePIIReport:
+		return tp.processPIIReport(ctx, job)
+	case database.ProcessingTypeLanguage:
+		return tp.processLanguage(ctx, job)
+	case database.ProcessingTypeTranscode:
+		return tp.processTranscode(ctx, job)
+	case database.ProcessingTypeExec:
+		return tp.processExec(ctx, job)
 	default:
+		if name, ok := job.ProcessingType.PluginName(); ok {
+			return tp.processPlugin(ctx, job, name)
+		}
 		return "", NewProcessingLogicError(string(job.ProcessingType), "unsupported processing type")
 	}
 }
 
 func (tp *TextProcessor) processWordCount(_ context.Context, job *ProcessingJob) (string, error) {
-	content, err := tp.readFile(job.FilePath)
+	content, err := tp.readFile(job, job.FilePath)
 	if err != nil {
 		return "", NewFileReadError(job.FilePath, err)
 	}
 
-	words := strings.Fields(content)
-	result := strconv.Itoa(len(words))
+	format := database.OutputFormatFromParams(job.ProcessingType, job.Parameters)
 
-	outputPath, err := tp.writeResult(job.JobID, result)
+	result := strconv.Itoa(len(strings.Fields(content)))
+	if format != database.OutputFormatText {
+		result, err = formatFileStats(newFileStats(filepath.Base(job.FilePath), content), format)
+		if err != nil {
+			return "", NewProcessingLogicError(string(job.ProcessingType), err.Error())
+		}
+	}
+
+	outputPath, err := tp.writeResult(job, result, format)
 	if err != nil {
 		return "", NewFileWriteError(outputPath, err)
 	}
@@ -96,14 +144,18 @@ func (tp *TextProcessor) processWordCount(_ context.Context, job *ProcessingJob)
 }
 
 func (tp *TextProcessor) processLineCount(_ context.Context, job *ProcessingJob) (string, error) {
-	// #nosec G304 -- job.FilePath is validated in readFile() and comes from trusted database source
-	file, err := os.Open(job.FilePath)
+	if format := database.OutputFormatFromParams(job.ProcessingType, job.Parameters); format != database.OutputFormatText {
+		return tp.processFileStats(job, format)
+	}
+
+	// job.FilePath is validated in readFile() and comes from trusted database source
+	file, _, err := tp.openFile(job.FilePath)
 	if err != nil {
 		return "", NewFileReadError(job.FilePath, err)
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(job.progress.reader(file))
 	lineCount := 0
 	for scanner.Scan() {
 		lineCount++
@@ -114,7 +166,27 @@ func (tp *TextProcessor) processLineCount(_ context.Context, job *ProcessingJob)
 	}
 
 	result := strconv.Itoa(lineCount)
-	outputPath, err := tp.writeResult(job.JobID, result)
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatText)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
+
+// processFileStats writes structured file statistics for non-text output formats.
+func (tp *TextProcessor) processFileStats(job *ProcessingJob, format database.OutputFormat) (string, error) {
+	content, err := tp.readFile(job, job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+
+	result, err := formatFileStats(newFileStats(filepath.Base(job.FilePath), content), format)
+	if err != nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), err.Error())
+	}
+
+	outputPath, err := tp.writeResult(job, result, format)
 	if err != nil {
 		return "", NewFileWriteError(outputPath, err)
 	}
@@ -123,13 +195,13 @@ func (tp *TextProcessor) processLineCount(_ context.Context, job *ProcessingJob)
 }
 
 func (tp *TextProcessor) processUppercase(_ context.Context, job *ProcessingJob) (string, error) {
-	content, err := tp.readFile(job.FilePath)
+	content, err := tp.readFile(job, job.FilePath)
 	if err != nil {
 		return "", NewFileReadError(job.FilePath, err)
 	}
 
 	result := strings.ToUpper(content)
-	outputPath, err := tp.writeResult(job.JobID, result)
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatText)
 	if err != nil {
 		return "", NewFileWriteError(outputPath, err)
 	}
@@ -138,13 +210,13 @@ func (tp *TextProcessor) processUppercase(_ context.Context, job *ProcessingJob)
 }
 
 func (tp *TextProcessor) processLowercase(_ context.Context, job *ProcessingJob) (string, error) {
-	content, err := tp.readFile(job.FilePath)
+	content, err := tp.readFile(job, job.FilePath)
 	if err != nil {
 		return "", NewFileReadError(job.FilePath, err)
 	}
 
 	result := strings.ToLower(content)
-	outputPath, err := tp.writeResult(job.JobID, result)
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatText)
 	if err != nil {
 		return "", NewFileWriteError(outputPath, err)
 	}
@@ -163,13 +235,13 @@ func (tp *TextProcessor) processReplace(_ context.Context, job *ProcessingJob) (
 		return "", NewInvalidParamError("replace_with", "missing or not a string")
 	}
 
-	content, err := tp.readFile(job.FilePath)
+	content, err := tp.readFile(job, job.FilePath)
 	if err != nil {
 		return "", NewFileReadError(job.FilePath, err)
 	}
 
 	result := strings.ReplaceAll(content, find, replaceWith)
-	outputPath, err := tp.writeResult(job.JobID, result)
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatText)
 	if err != nil {
 		return "", NewFileWriteError(outputPath, err)
 	}
@@ -188,15 +260,149 @@ func (tp *TextProcessor) processExtract(_ context.Context, job *ProcessingJob) (
 		return "", NewRegexCompileError(pattern, err)
 	}
 
-	content, err := tp.readFile(job.FilePath)
+	content, err := tp.readFile(job, job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+
+	format := database.OutputFormatFromParams(job.ProcessingType, job.Parameters)
+	result, err := formatExtractResult(extractMatches(regex, pattern, content), format)
+	if err != nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), err.Error())
+	}
+
+	outputPath, err := tp.writeResult(job, result, format)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
+
+func (tp *TextProcessor) processDiff(_ context.Context, job *ProcessingJob) (string, error) {
+	if job.SecondFilePath == "" {
+		return "", NewInvalidParamError("second_file", "diff requires a second file")
+	}
+
+	original, err := tp.readFile(job, job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+
+	modified, err := tp.readFile(job, job.SecondFilePath)
+	if err != nil {
+		return "", NewFileReadError(job.SecondFilePath, err)
+	}
+
+	result, err := unifiedDiff(uploadedName(job.OriginalFilename, job.FilePath),
+		uploadedName(job.SecondOriginalFilename, job.SecondFilePath), original, modified)
+	if err != nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), err.Error())
+	}
+
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatText)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
+
+func (tp *TextProcessor) processTextStats(_ context.Context, job *ProcessingJob) (string, error) {
+	topN, ngram, err := database.TextStatsParams(job.Parameters)
+	if err != nil {
+		return "", NewInvalidParamError("parameters", err.Error())
+	}
+
+	content, err := tp.readFile(job, job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+
+	result, err := formatJSON(newTextStats(filepath.Base(job.FilePath), content, topN, ngram))
+	if err != nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), err.Error())
+	}
+
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatJSON)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
+
+func (tp *TextProcessor) processChunk(_ context.Context, job *ProcessingJob) (string, error) {
+	params, err := database.ChunkParamsFrom(job.Parameters)
+	if err != nil {
+		return "", NewInvalidParamError("parameters", err.Error())
+	}
+
+	content, err := tp.readFile(job, job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+
+	result, err := formatJSONL(chunkText(content, params))
+	if err != nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), err.Error())
+	}
+
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatJSONL)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
+
+func (tp *TextProcessor) processExec(ctx context.Context, job *ProcessingJob) (string, error) {
+	if tp.commands == nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), "exec processing is disabled on this worker")
+	}
+
+	params, err := database.ExecParamsFrom(job.Parameters)
+	if err != nil {
+		return "", NewInvalidParamError("parameters", err.Error())
+	}
+
+	// job.FilePath comes from trusted database source, as in processLineCount
+	input, _, err := tp.openFile(job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+	defer input.Close()
+
+	result, usage, err := tp.commands.run(ctx, params, job.progress.reader(input))
+	job.child = usage
+	if err != nil {
+		return "", err
+	}
+
+	outputPath, err := tp.writeResult(job, string(result), database.OutputFormatText)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
+
+func (tp *TextProcessor) processPlugin(ctx context.Context, job *ProcessingJob, name string) (string, error) {
+	if tp.plugins == nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), "plugins are disabled on this worker")
+	}
+
+	content, err := tp.readFile(job, job.FilePath)
 	if err != nil {
 		return "", NewFileReadError(job.FilePath, err)
 	}
 
-	matches := regex.FindAllString(content, -1)
-	result := strings.Join(matches, "\n")
+	result, err := tp.plugins.run(ctx, name, []byte(content))
+	if err != nil {
+		return "", err
+	}
 
-	outputPath, err := tp.writeResult(job.JobID, result)
+	outputPath, err := tp.writeResult(job, string(result), database.OutputFormatText)
 	if err != nil {
 		return "", NewFileWriteError(outputPath, err)
 	}
@@ -204,7 +410,33 @@ func (tp *TextProcessor) processExtract(_ context.Context, job *ProcessingJob) (
 	return outputPath, nil
 }
 
-func (tp *TextProcessor) readFile(filePath string) (string, error) {
+// extractMatches finds all matches with their byte offsets and 1-based line numbers.
+func extractMatches(regex *regexp.Regexp, pattern, content string) extractResult {
+	locations := regex.FindAllStringIndex(content, -1)
+	matches := make([]extractMatch, 0, len(locations))
+
+	line, lineStart := 1, 0
+	for _, loc := range locations {
+		line += strings.Count(content[lineStart:loc[0]], "\n")
+		lineStart = loc[0]
+
+		matches = append(matches, extractMatch{
+			Match: content[loc[0]:loc[1]],
+			Start: loc[0],
+			End:   loc[1],
+			Line:  line,
+		})
+	}
+
+	return extractResult{
+		Pattern: pattern,
+		Count:   len(matches),
+		Matches: matches,
+	}
+}
+
+// readFile reads an input file of the job, counting it towards the job's progress.
+func (tp *TextProcessor) readFile(job *ProcessingJob, filePath string) (string, error) {
 	// Validate that the file path is within expected directories
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
@@ -217,21 +449,79 @@ func (tp *TextProcessor) readFile(filePath string) (string, error) {
 		return "", fmt.Errorf("invalid file path %s: contains path traversal", filePath)
 	}
 
-	// #nosec G304 -- filePath is validated and comes from database (originally created by FileStore with UUID)
-	content, err := os.ReadFile(absPath)
+	// filePath is validated and comes from database (originally created by FileStore with UUID)
+	file, size, err := tp.openFile(absPath)
 	if err != nil {
 		return "", fmt.Errorf("read file: %w", err)
 	}
-	return string(content), nil
+	defer file.Close()
+
+	var content strings.Builder
+	content.Grow(int(size))
+
+	// Reading in chunks rather than at once lets progress advance on large files
+	if _, err := io.CopyBuffer(&content, job.progress.reader(file), make([]byte, progressReadChunkSize)); err != nil {
+		return "", fmt.Errorf("read file: %w", err)
+	}
+	return content.String(), nil
+}
+
+// openFile opens an input file of the job for reading its decrypted content, along with the size
+// of the content.
+func (tp *TextProcessor) openFile(filePath string) (io.ReadCloser, int64, error) {
+	return filestore.OpenFile(tp.fsys, tp.keys, filePath)
+}
+
+func (tp *TextProcessor) writeResult(job *ProcessingJob, content string, format database.OutputFormat) (string, error) {
+	return tp.writeResultFrom(job, strings.NewReader(content), format)
 }
 
-func (tp *TextProcessor) writeResult(jobID, content string) (string, error) {
-	filename := fmt.Sprintf("result_%s.txt", jobID)
-	outputPath := filepath.Join(tp.resultDir, filename)
+// writeResultFrom writes the result streamed from content, for results too large to hold in memory.
+func (tp *TextProcessor) writeResultFrom(job *ProcessingJob, content io.Reader, format database.OutputFormat) (string, error) {
+	outputPath := tp.resultPath(job, format)
 
-	if err := os.WriteFile(outputPath, []byte(content), 0600); err != nil {
+	// The path is within the result directory
+	file, err := filestore.CreateFile(tp.fsys, tp.keys, outputPath)
+	if err != nil {
+		return "", fmt.Errorf("create result file: %w", err)
+	}
+
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
 		return "", fmt.Errorf("write result file: %w", err)
 	}
 
 	return outputPath, nil
 }
+
+// linkResult gives the result the content of the input, for processing that leaves it unchanged.
+// Results that share the bytes of the input are marked so that they are not counted twice.
+func (tp *TextProcessor) linkResult(job *ProcessingJob, format database.OutputFormat) (string, error) {
+	outputPath := tp.resultPath(job, format)
+
+	// A previous attempt may have left its result behind
+	if err := tp.fsys.Remove(outputPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return outputPath, fmt.Errorf("remove previous result file: %w", err)
+	}
+
+	method, err := filestore.LinkFile(tp.fsys, job.FilePath, outputPath)
+	if err != nil {
+		return outputPath, fmt.Errorf("link result file: %w", err)
+	}
+	job.sharedResult = method.Shared()
+	tp.log.Debug("linked result file", "job_id", job.JobID, "method", method)
+
+	return outputPath, nil
+}
+
+// resultPath returns where the attempt of the job writes its result: result_<job_id>.v<version>
+// when results are versioned, result_<job_id> otherwise.
+func (tp *TextProcessor) resultPath(job *ProcessingJob, format database.OutputFormat) string {
+	if tp.versionResults && job.version > 0 {
+		return filepath.Join(tp.resultDir, fmt.Sprintf("result_%s.v%d.%s", job.JobID, job.version, format.Extension()))
+	}
+	return filepath.Join(tp.resultDir, fmt.Sprintf("result_%s.%s", job.JobID, format.Extension()))
+}
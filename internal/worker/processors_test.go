@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+func TestTextProcessorMemFS(t *testing.T) {
+	tests := []struct {
+		name           string
+		processingType database.ProcessingType
+		parameters     map[string]any
+		want           string
+	}{
+		{
+			name:           "uppercase writes the result",
+			processingType: database.ProcessingTypeUppercase,
+			want:           "HELLO WORLD\n",
+		},
+		{
+			name:           "line count reads the input",
+			processingType: database.ProcessingTypeLineCount,
+			want:           "1",
+		},
+		{
+			name:           "transcode to the same encoding copies the input",
+			processingType: database.ProcessingTypeTranscode,
+			parameters:     map[string]any{database.TranscodeFromParam: "utf-8", database.TranscodeToParam: "utf-8"},
+			want:           "hello world\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fsys, "/uploads/input.txt", []byte("hello world\n"), 0o600))
+			require.NoError(t, fsys.MkdirAll("/results", 0o700))
+			tp := NewTextProcessor(fsys, "/results", config.ResultPolicyVersion, config.Exec{}, nil, slog.New(slog.DiscardHandler))
+			job := &ProcessingJob{
+				JobID:          uuid.NewString(),
+				FilePath:       "/uploads/input.txt",
+				ProcessingType: tt.processingType,
+				Parameters:     tt.parameters,
+				version:        1,
+			}
+
+			outputPath, err := tp.Process(context.Background(), job)
+
+			require.NoError(t, err)
+			content, err := afero.ReadFile(fsys, outputPath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(content))
+			// Only the OS filesystem links files, so results never share the bytes of the input
+			assert.False(t, job.sharedResult)
+		})
+	}
+}
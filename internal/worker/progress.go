@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+)
+
+const (
+	// progressReportInterval bounds how often the progress of a job is reported.
+	progressReportInterval = 500 * time.Millisecond
+
+	// progressReadChunkSize is the size of the reads progress is counted in.
+	progressReadChunkSize = 64 << 10
+
+	// maxInputProgress caps the progress of a job that read all its input: the result still has to
+	// be written.
+	maxInputProgress = 99
+)
+
+// progressTracker counts the input bytes a job has processed and reports the progress whenever the
+// percentage changed, at most every progressReportInterval. A nil tracker counts nothing.
+type progressTracker struct {
+	total  int64
+	report func(queue.JobProgress)
+
+	mu             sync.Mutex
+	processed      int64
+	lastPercent    int
+	lastReportedAt time.Time
+}
+
+func newProgressTracker(total int64, report func(queue.JobProgress)) *progressTracker {
+	return &progressTracker{total: total, report: report}
+}
+
+// add counts n processed bytes.
+func (p *progressTracker) add(n int) {
+	if p == nil || n <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.processed += int64(n)
+	percent := maxInputProgress
+	if p.processed < p.total {
+		percent = min(int(p.processed*100/p.total), maxInputProgress) //nolint:mnd // percentage
+	}
+
+	if percent == p.lastPercent || time.Since(p.lastReportedAt) < progressReportInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.lastPercent, p.lastReportedAt = percent, time.Now()
+	progress := p.progress(percent)
+	p.mu.Unlock()
+
+	p.report(progress)
+}
+
+// complete reports the job as fully processed.
+func (p *progressTracker) complete() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.processed = p.total
+	p.lastPercent, p.lastReportedAt = 100, time.Now()
+	progress := p.progress(100) //nolint:mnd // percentage
+	p.mu.Unlock()
+
+	p.report(progress)
+}
+
+func (p *progressTracker) progress(percent int) queue.JobProgress {
+	return queue.JobProgress{
+		Percent:        percent,
+		BytesProcessed: p.processed,
+		BytesTotal:     p.total,
+		UpdatedAt:      time.Now().UTC(),
+	}
+}
+
+// reader counts the bytes read from r as processed.
+func (p *progressTracker) reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{Reader: r, tracker: p}
+}
+
+type progressReader struct {
+	io.Reader
+
+	tracker *progressTracker
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.tracker.add(n)
+	return n, err
+}
@@ -0,0 +1,280 @@
+package worker
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// Candidates of the built-in PII kinds. Phone and credit card numbers are confirmed by their digit
+// count, and credit card numbers by the Luhn checksum, before they count as PII.
+//
+//nolint:gochecknoglobals // compiled once
+var (
+	emailPattern      = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern      = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\b\d{2,4}(?:[ .-]?\d{2,4}){2,4}\b`)
+	creditCardPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+)
+
+// Digit counts of phone numbers, E.164 allowing at most 15, and of payment card numbers.
+const (
+	minPhoneDigits      = 8
+	maxPhoneDigits      = 15
+	minCreditCardDigits = 13
+	maxCreditCardDigits = 19
+)
+
+// piiPriority decides between overlapping matches starting at the same offset: a credit card
+// number also looks like a phone number, while a custom pattern is what the job asked for.
+//
+//nolint:gochecknoglobals // lookup table
+var piiPriority = map[string]int{
+	database.PIIKindCustom:     0,
+	database.PIIKindEmail:      1,
+	database.PIIKindCreditCard: 2,
+	database.PIIKindPhone:      3,
+}
+
+// piiMatch is PII found in the input. Start and End are byte offsets, Line is 1-based.
+type piiMatch struct {
+	Kind    string `json:"kind"`
+	Pattern string `json:"pattern,omitempty"`
+	Line    int    `json:"line"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+}
+
+// piiReport is the result of a pii_report job. It locates the PII without repeating it.
+type piiReport struct {
+	Total    int            `json:"total"`
+	Counts   map[string]int `json:"counts"`
+	Findings []piiMatch     `json:"findings"`
+}
+
+// piiDetector finds the PII kinds and custom patterns of a redact or pii_report job.
+type piiDetector struct {
+	kinds    []string
+	patterns []*regexp.Regexp
+}
+
+func newPIIDetector(params database.PIIParams) (*piiDetector, error) {
+	detector := &piiDetector{kinds: params.Detect}
+	for _, pattern := range params.Patterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, NewRegexCompileError(pattern, err)
+		}
+		detector.patterns = append(detector.patterns, regex)
+	}
+	return detector, nil
+}
+
+// find returns the PII in content ordered by offset. Overlapping matches are resolved in favor of
+// the one starting first, then by piiPriority, then the longer one.
+func (d *piiDetector) find(content string) []piiMatch {
+	var candidates []piiMatch
+	for _, kind := range d.kinds {
+		switch kind {
+		case database.PIIKindEmail:
+			candidates = appendMatches(candidates, content, emailPattern, kind, "", nil)
+		case database.PIIKindPhone:
+			candidates = appendMatches(candidates, content, phonePattern, kind, "", validPhone)
+		case database.PIIKindCreditCard:
+			candidates = appendMatches(candidates, content, creditCardPattern, kind, "", validCreditCard)
+		}
+	}
+	for _, regex := range d.patterns {
+		candidates = appendMatches(candidates, content, regex, database.PIIKindCustom, regex.String(), nil)
+	}
+
+	slices.SortFunc(candidates, func(a, b piiMatch) int {
+		return cmp.Or(
+			cmp.Compare(a.Start, b.Start),
+			cmp.Compare(piiPriority[a.Kind], piiPriority[b.Kind]),
+			cmp.Compare(b.End, a.End),
+		)
+	})
+
+	matches := make([]piiMatch, 0, len(candidates))
+	end := 0
+	for _, candidate := range candidates {
+		if candidate.Start < end {
+			continue
+		}
+		matches = append(matches, candidate)
+		end = candidate.End
+	}
+
+	line, lineStart := 1, 0
+	for i := range matches {
+		line += strings.Count(content[lineStart:matches[i].Start], "\n")
+		lineStart = matches[i].Start
+		matches[i].Line = line
+	}
+	return matches
+}
+
+// appendMatches appends the non-empty matches of regex that valid accepts, or all with a nil valid.
+func appendMatches(
+	matches []piiMatch, content string, regex *regexp.Regexp, kind, pattern string, valid func(string) bool,
+) []piiMatch {
+	for _, loc := range regex.FindAllStringIndex(content, -1) {
+		if loc[0] == loc[1] || (valid != nil && !valid(content[loc[0]:loc[1]])) {
+			continue
+		}
+		matches = append(matches, piiMatch{Kind: kind, Pattern: pattern, Start: loc[0], End: loc[1]})
+	}
+	return matches
+}
+
+func validPhone(s string) bool {
+	digits := countDigits(s)
+	return digits >= minPhoneDigits && digits <= maxPhoneDigits
+}
+
+// validCreditCard checks the digit count and the Luhn checksum of a card number.
+func validCreditCard(s string) bool {
+	digits := countDigits(s)
+	if digits < minCreditCardDigits || digits > maxCreditCardDigits {
+		return false
+	}
+
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func countDigits(s string) int {
+	digits := 0
+	for i := range len(s) {
+		if s[i] >= '0' && s[i] <= '9' {
+			digits++
+		}
+	}
+	return digits
+}
+
+// redact replaces the matches in content with the mask, keeping the last keepLast characters of
+// each match.
+func redact(content string, matches []piiMatch, mask string, keepLast int) string {
+	var result strings.Builder
+	result.Grow(len(content))
+
+	last := 0
+	for _, match := range matches {
+		result.WriteString(content[last:match.Start])
+		result.WriteString(strings.ReplaceAll(mask, database.PIIMaskKindPlaceholder, match.Kind))
+		result.WriteString(lastRunes(content[match.Start:match.End], keepLast))
+		last = match.End
+	}
+	result.WriteString(content[last:])
+
+	return result.String()
+}
+
+// lastRunes returns the last n characters of s.
+func lastRunes(s string, n int) string {
+	end := len(s)
+	for i := 0; i < n && end > 0; i++ {
+		_, size := utf8.DecodeLastRuneInString(s[:end])
+		end -= size
+	}
+	return s[end:]
+}
+
+// newPIIReport counts the matches by kind. Every detected kind is counted, also when not found.
+func newPIIReport(params database.PIIParams, matches []piiMatch) piiReport {
+	report := piiReport{
+		Total:    len(matches),
+		Counts:   make(map[string]int, len(params.Detect)+1),
+		Findings: matches,
+	}
+	for _, kind := range params.Detect {
+		report.Counts[kind] = 0
+	}
+	if len(params.Patterns) > 0 {
+		report.Counts[database.PIIKindCustom] = 0
+	}
+
+	for _, match := range matches {
+		report.Counts[match.Kind]++
+	}
+	return report
+}
+
+// piiParams reads and compiles the parameters of a redact or pii_report job.
+func piiParams(job *ProcessingJob) (database.PIIParams, *piiDetector, error) {
+	params, err := database.PIIParamsFrom(job.Parameters)
+	if err != nil {
+		return database.PIIParams{}, nil, NewInvalidParamError("parameters", err.Error())
+	}
+
+	detector, err := newPIIDetector(params)
+	if err != nil {
+		return database.PIIParams{}, nil, err
+	}
+	return params, detector, nil
+}
+
+func (tp *TextProcessor) processRedact(_ context.Context, job *ProcessingJob) (string, error) {
+	params, detector, err := piiParams(job)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := tp.readFile(job, job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+
+	result := redact(content, detector.find(content), params.Mask, params.KeepLast)
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatText)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
+
+func (tp *TextProcessor) processPIIReport(_ context.Context, job *ProcessingJob) (string, error) {
+	params, detector, err := piiParams(job)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := tp.readFile(job, job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+
+	result, err := formatJSON(newPIIReport(params, detector.find(content)))
+	if err != nil {
+		return "", NewProcessingLogicError(string(job.ProcessingType), fmt.Sprintf("format report: %v", err))
+	}
+
+	outputPath, err := tp.writeResult(job, result, database.OutputFormatJSON)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/rsav/k8s-learning/internal/events"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/worker/metrics"
+)
+
+// processWithRetry processes the job, retrying failed attempts up to MaxRetries times and publishing
+// a job.retried event before each retry. Every attempt is bounded by JobTimeout and reports its
+// progress from the start.
+func (w *Worker) processWithRetry(ctx context.Context, message *queue.SubmitJobMessage, job *ProcessingJob) (string, error) {
+	delay := w.config.RetryDelay
+	for attempt := 1; ; attempt++ {
+		job.progress = w.newProgressTracker(ctx, message)
+		job.attempt = attempt
+
+		var outputPath string
+		err := w.startAttempt(ctx, message.JobID, job)
+		if err == nil {
+			outputPath, err = w.processAttempt(ctx, job)
+		}
+		if err == nil || attempt > w.config.MaxRetries || !retryable(err) || ctx.Err() != nil {
+			return outputPath, err
+		}
+
+		metrics.JobRetriesTotal.WithLabelValues(w.workerID, string(job.ProcessingType)).Inc()
+		w.log.WarnContext(ctx, "job attempt failed, retrying",
+			"error", err,
+			"job_id", job.JobID,
+			"attempt", attempt,
+			"max_retries", w.config.MaxRetries,
+			"retry_in", delay.String())
+		w.publishEvent(ctx, events.JobRetried, message, map[string]any{
+			"error":    err.Error(),
+			"attempt":  attempt,
+			"retry_in": delay.String(),
+		})
+
+		select {
+		case <-ctx.Done():
+			return "", err
+		case <-time.After(delay):
+		}
+
+		delay = w.config.NextRetryDelay(delay)
+	}
+}
+
+// startAttempt counts the attempt in the database, which numbers the result version it writes.
+// A failed count is retried like a failed attempt.
+func (w *Worker) startAttempt(ctx context.Context, jobID uuid.UUID, job *ProcessingJob) error {
+	start := time.Now()
+	version, err := w.repository.StartAttempt(ctx, jobID)
+	metrics.DBQueriesTotal.WithLabelValues(w.workerID, "start_attempt").Inc()
+	metrics.DBQueryDuration.WithLabelValues(w.workerID, "start_attempt").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	job.version = version
+	return nil
+}
+
+// processAttempt processes the job once, within the job timeout, failing it when a fault is
+// injected.
+func (w *Worker) processAttempt(ctx context.Context, job *ProcessingJob) (string, error) {
+	fault := w.injectFault(ctx, job)
+	if fault == database.FailStageRead {
+		return "", NewFileReadError(job.FilePath, ErrInjectedFault)
+	}
+
+	outputPath, err := w.runProcessor(ctx, job)
+	if err != nil || fault == "" {
+		return outputPath, err
+	}
+	return "", w.failInjected(ctx, job, fault, outputPath)
+}
+
+// runProcessor processes the job within the job timeout.
+func (w *Worker) runProcessor(ctx context.Context, job *ProcessingJob) (string, error) {
+	if w.config.JobTimeout <= 0 {
+		return w.textProcessor.Process(ctx, job)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, w.config.JobTimeout)
+	defer cancel()
+
+	outputPath, err := w.textProcessor.Process(attemptCtx, job)
+	if err != nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		metrics.JobTimeoutsTotal.WithLabelValues(w.workerID, string(job.ProcessingType)).Inc()
+		return "", NewTimeoutError(w.config.JobTimeout, err)
+	}
+	return outputPath, err
+}
+
+// retryable reports whether another attempt may succeed: invalid parameters and patterns, and
+// processing logic errors fail every attempt the same way.
+func retryable(err error) bool {
+	var processingErr *ProcessingError
+	if !errors.As(err, &processingErr) {
+		return true
+	}
+
+	switch processingErr.Type {
+	case ErrorTypeInvalidParam, ErrorTypeRegexCompile, ErrorTypeProcessingLogic:
+		return false
+	default:
+		return true
+	}
+}
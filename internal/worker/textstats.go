@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// termCount is a word or n-gram with its number of occurrences.
+type termCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// readability holds Flesch scores computed from estimated syllable counts.
+type readability struct {
+	Syllables          int     `json:"syllables"`
+	FleschReadingEase  float64 `json:"flesch_reading_ease"`
+	FleschKincaidGrade float64 `json:"flesch_kincaid_grade"`
+}
+
+type textStats struct {
+	File                  string      `json:"file"`
+	Words                 int         `json:"words"`
+	UniqueWords           int         `json:"unique_words"`
+	Sentences             int         `json:"sentences"`
+	AverageSentenceLength float64     `json:"average_sentence_length"`
+	AverageWordLength     float64     `json:"average_word_length"`
+	TopWords              []termCount `json:"top_words"`
+	NgramSize             int         `json:"ngram_size"`
+	TopNgrams             []termCount `json:"top_ngrams"`
+	Readability           readability `json:"readability"`
+}
+
+// newTextStats analyzes content, keeping the topN most frequent words and n-grams of size ngram.
+func newTextStats(file, content string, topN, ngram int) textStats {
+	words := tokenizeWords(content)
+	sentences := countSentences(content)
+
+	stats := textStats{
+		File:      file,
+		Words:     len(words),
+		Sentences: sentences,
+		NgramSize: ngram,
+		TopWords:  []termCount{},
+		TopNgrams: []termCount{},
+	}
+	if len(words) == 0 {
+		return stats
+	}
+
+	frequencies := make(map[string]int, len(words))
+	letters, syllables := 0, 0
+	for _, word := range words {
+		frequencies[word]++
+		letters += len([]rune(word))
+		syllables += countSyllables(word)
+	}
+
+	ngrams := make(map[string]int)
+	for i := 0; i+ngram <= len(words); i++ {
+		ngrams[strings.Join(words[i:i+ngram], " ")]++
+	}
+
+	wordsPerSentence := float64(len(words)) / float64(sentences)
+	syllablesPerWord := float64(syllables) / float64(len(words))
+
+	stats.UniqueWords = len(frequencies)
+	stats.AverageSentenceLength = round2(wordsPerSentence)
+	stats.AverageWordLength = round2(float64(letters) / float64(len(words)))
+	stats.TopWords = topTerms(frequencies, topN)
+	stats.TopNgrams = topTerms(ngrams, topN)
+	stats.Readability = readability{
+		Syllables:          syllables,
+		FleschReadingEase:  round2(206.835 - 1.015*wordsPerSentence - 84.6*syllablesPerWord), //nolint:mnd // Flesch formula
+		FleschKincaidGrade: round2(0.39*wordsPerSentence + 11.8*syllablesPerWord - 15.59),    //nolint:mnd // Flesch-Kincaid formula
+	}
+
+	return stats
+}
+
+// tokenizeWords splits content into lowercase words made of letters, digits and inner apostrophes.
+func tokenizeWords(content string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '’'
+	})
+
+	words := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if word := strings.Trim(field, "'’"); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// countSentences counts runs of sentence terminators; text without any counts as one sentence.
+func countSentences(content string) int {
+	sentences := 0
+	hasText := false
+	for _, r := range content {
+		switch {
+		case r == '.' || r == '!' || r == '?':
+			if hasText {
+				sentences++
+			}
+			hasText = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			hasText = true
+		}
+	}
+	if hasText {
+		sentences++
+	}
+	return max(sentences, 1)
+}
+
+// countSyllables estimates syllables as groups of vowels, ignoring a trailing silent e.
+func countSyllables(word string) int {
+	syllables := 0
+	prevVowel := false
+	for _, r := range word {
+		vowel := strings.ContainsRune("aeiouy", r)
+		if vowel && !prevVowel {
+			syllables++
+		}
+		prevVowel = vowel
+	}
+
+	if strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le") && syllables > 1 {
+		syllables--
+	}
+	return max(syllables, 1)
+}
+
+// topTerms returns the n most frequent terms, breaking ties alphabetically for stable output.
+func topTerms(counts map[string]int, n int) []termCount {
+	terms := make([]termCount, 0, len(counts))
+	for term, count := range counts {
+		terms = append(terms, termCount{Term: term, Count: count})
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+
+	if len(terms) > n {
+		terms = terms[:n]
+	}
+	return terms
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100 //nolint:mnd // two decimal places
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"context"
+
+	"golang.org/x/text/transform"
+
+	"github.com/rsav/k8s-learning/internal/processing/charset"
+	"github.com/rsav/k8s-learning/internal/storage/database"
+)
+
+// processTranscode converts the input between encodings as it streams from the input file to the
+// result file, so that memory use does not grow with the file size. Between the same encoding the
+// input is linked as the result instead, sharing its bytes where the filesystem allows.
+func (tp *TextProcessor) processTranscode(_ context.Context, job *ProcessingJob) (string, error) {
+	fromName, toName, err := database.TranscodeParamsFrom(job.Parameters)
+	if err != nil {
+		return "", NewInvalidParamError("parameters", err.Error())
+	}
+
+	from, err := charset.Lookup(fromName)
+	if err != nil {
+		return "", NewInvalidParamError(database.TranscodeFromParam, err.Error())
+	}
+	to, err := charset.Lookup(toName)
+	if err != nil {
+		return "", NewInvalidParamError(database.TranscodeToParam, err.Error())
+	}
+
+	if charset.Same(from, to) {
+		outputPath, err := tp.linkResult(job, database.OutputFormatText)
+		if err != nil {
+			return "", NewFileWriteError(outputPath, err)
+		}
+		return outputPath, nil
+	}
+
+	file, _, err := tp.openFile(job.FilePath)
+	if err != nil {
+		return "", NewFileReadError(job.FilePath, err)
+	}
+	defer file.Close()
+
+	converted := transform.NewReader(job.progress.reader(file), transform.Chain(from.NewDecoder(), to.NewEncoder()))
+	outputPath, err := tp.writeResultFrom(job, converted, database.OutputFormatText)
+	if err != nil {
+		return "", NewFileWriteError(outputPath, err)
+	}
+
+	return outputPath, nil
+}
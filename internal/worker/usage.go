@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/spf13/afero"
+)
+
+// childUsage is the resource consumption of an external process started for a job.
+type childUsage struct {
+	cpu    time.Duration
+	maxRSS int64
+}
+
+func childUsageFromState(state *os.ProcessState) childUsage {
+	if state == nil {
+		return childUsage{}
+	}
+	return childUsage{
+		cpu:    state.UserTime() + state.SystemTime(),
+		maxRSS: maxRSSBytes(state),
+	}
+}
+
+// usageMeter measures a job from start to stop. It pins the calling goroutine to its OS thread
+// so that thread CPU time is attributable to the job, which processors run synchronously.
+type usageMeter struct {
+	start    time.Time
+	startCPU time.Duration
+}
+
+func startUsageMeter() *usageMeter {
+	runtime.LockOSThread()
+	return &usageMeter{
+		start:    time.Now(),
+		startCPU: threadCPUTime(),
+	}
+}
+
+// stop releases the thread and returns the job's usage. Bytes are taken from the sizes of the
+// input and result files, which processors read and write in full.
+func (m *usageMeter) stop(fsys afero.Fs, job *ProcessingJob, outputPath string) database.JobUsage {
+	cpu := threadCPUTime() - m.startCPU
+	runtime.UnlockOSThread()
+
+	bytesRead := fileSize(fsys, job.FilePath) + fileSize(fsys, job.SecondFilePath)
+	bytesWritten := fileSize(fsys, outputPath)
+
+	return database.JobUsage{
+		CPUTimeMS:       (cpu + job.child.cpu).Milliseconds(),
+		WallTimeMS:      time.Since(m.start).Milliseconds(),
+		PeakMemoryBytes: max(bytesRead+bytesWritten, job.child.maxRSS),
+		BytesRead:       bytesRead,
+		BytesWritten:    bytesWritten,
+	}
+}
+
+func fileSize(fsys afero.Fs, path string) int64 {
+	if path == "" {
+		return 0
+	}
+	info, err := fsys.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package worker
+
+import (
+	"os"
+	"time"
+)
+
+// threadCPUTime is not available without RUSAGE_THREAD; jobs report only child process CPU.
+func threadCPUTime() time.Duration {
+	return 0
+}
+
+func maxRSSBytes(_ *os.ProcessState) int64 {
+	return 0
+}
@@ -2,71 +2,256 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
-	"os"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/rsav/k8s-learning/internal/config"
+	"github.com/rsav/k8s-learning/internal/encryption"
+	"github.com/rsav/k8s-learning/internal/events"
 	"github.com/rsav/k8s-learning/internal/storage/database"
+	"github.com/rsav/k8s-learning/internal/storage/filestore"
 	"github.com/rsav/k8s-learning/internal/storage/queue"
+	"github.com/rsav/k8s-learning/internal/tenant"
+	"github.com/rsav/k8s-learning/internal/tracing"
+	"github.com/rsav/k8s-learning/internal/worker/delivery"
 	"github.com/rsav/k8s-learning/internal/worker/metrics"
+	"github.com/spf13/afero"
 )
 
 type Worker struct {
-	config        *config.Worker
-	repository    Repository
-	queue         JobConsumer
-	log           *slog.Logger
-	workerID      string
+	config     *config.Worker
+	runtime    *config.RuntimeWatcher
+	repository Repository
+	queue      JobConsumer
+	events     EventPublisher
+	log        *slog.Logger
+	workerID   string
+	// fsys is the filesystem of the input and result files, the OS one outside of tests.
+	fsys          afero.Fs
 	textProcessor *TextProcessor
+	delivery      *delivery.Deliverer
+	// processingTypes are the job types this worker consumes.
+	processingTypes []database.ProcessingType
+	// stealTypes are the job types this worker steals while its own queues are empty; empty when
+	// work stealing is disabled.
+	stealTypes []database.ProcessingType
 
 	// Control channels
 	shutdownCh chan struct{}
 	doneCh     chan struct{}
 	jobSema    chan struct{}
+
+	// control guards the admin state: resumed is non-nil while consumption is paused and closed on
+	// resume, draining is set by Drain until the next Pause or Resume.
+	control  sync.Mutex
+	resumed  chan struct{}
+	draining bool
+	// globallyPaused is whether processing was paused through the API at the last check.
+	globallyPaused atomic.Bool
+
+	inFlight   map[uuid.UUID]InFlightJob
+	inFlightMu sync.Mutex
 }
 
 type Repository interface {
 	GetJobByID(ctx context.Context, id uuid.UUID) (*database.Job, error)
 	UpdateStatus(ctx context.Context, id uuid.UUID, status database.JobStatus, workerID *string) error
-	UpdateResult(ctx context.Context, id uuid.UUID, resultPath string) error
+	StartAttempt(ctx context.Context, id uuid.UUID) (int, error)
+	UpdateResult(ctx context.Context, id uuid.UUID, result database.ResultVersion) error
 	UpdateError(ctx context.Context, id uuid.UUID, errorMessage string) error
+	RecordUsage(ctx context.Context, id uuid.UUID, usage database.JobUsage) error
+	AddStorageUsage(ctx context.Context, tenantID string, delta database.StorageDelta) error
 	HealthCheck(ctx context.Context) error
 }
 
-func New(config *config.Worker, repository Repository, queue JobConsumer, log *slog.Logger) (*Worker, error) {
+func New(
+	config *config.Worker, runtime *config.RuntimeWatcher, repository Repository, queue JobConsumer, events EventPublisher, log *slog.Logger,
+) (*Worker, error) {
 	workerID := config.WorkerID
 	if workerID == "" {
 		workerID = fmt.Sprintf("worker-%s", uuid.New().String()[:8])
 	}
 
-	if err := os.MkdirAll(config.Storage.ResultDir, 0750); err != nil {
-		return nil, fmt.Errorf("create result directory: %w", err)
+	fsys := afero.NewOsFs()
+	if err := filestore.PrepareDir(fsys, config.Storage.ResultDir); err != nil {
+		return nil, fmt.Errorf("prepare result directory: %w", err)
 	}
 
-	textProcessor := NewTextProcessor(config.Storage.ResultDir, log)
+	fileKeys, err := encryption.FromConfig(config.Encryption, config.Encryption.Files)
+	if err != nil {
+		return nil, fmt.Errorf("initialize file encryption: %w", err)
+	}
+
+	textProcessor := NewTextProcessor(fsys, config.Storage.ResultDir, config.ResultOverwritePolicy, config.Exec, fileKeys, log)
+	if config.Plugins.Dir != "" {
+		plugins, err := loadPlugins(context.Background(), config.Plugins, log)
+		if err != nil {
+			return nil, fmt.Errorf("load plugins: %w", err)
+		}
+		textProcessor.plugins = plugins
+	}
+
+	processingTypes, err := consumedProcessingTypes(config.ProcessingTypes, "PROCESSING_TYPES", textProcessor.plugins)
+	if err != nil {
+		return nil, err
+	}
+
+	var stealTypes []database.ProcessingType
+	if config.WorkStealing {
+		candidates, err := consumedProcessingTypes(config.StealTypes, "STEAL_TYPES", textProcessor.plugins)
+		if err != nil {
+			return nil, err
+		}
+		for _, processingType := range candidates {
+			if !slices.Contains(processingTypes, processingType) && textProcessor.CanProcess(processingType) {
+				stealTypes = append(stealTypes, processingType)
+			}
+		}
+	}
+
+	deliverer, err := delivery.FromConfig(config.Sinks, fsys, fileKeys, workerID, log)
+	if err != nil {
+		return nil, fmt.Errorf("create result sinks: %w", err)
+	}
 
 	return &Worker{
-		config:        config,
-		repository:    repository,
-		queue:         queue,
-		log:           log,
-		workerID:      workerID,
-		textProcessor: textProcessor,
-		shutdownCh:    make(chan struct{}),
-		doneCh:        make(chan struct{}),
-		jobSema:       make(chan struct{}, config.ConcurrentJobs),
+		config:          config,
+		runtime:         runtime,
+		repository:      repository,
+		queue:           queue,
+		events:          events,
+		log:             log,
+		workerID:        workerID,
+		fsys:            fsys,
+		textProcessor:   textProcessor,
+		delivery:        deliverer,
+		processingTypes: processingTypes,
+		stealTypes:      stealTypes,
+		shutdownCh:      make(chan struct{}),
+		doneCh:          make(chan struct{}),
+		jobSema:         make(chan struct{}, config.ConcurrentJobs),
+		inFlight:        make(map[uuid.UUID]InFlightJob),
 	}, nil
 }
 
+// ID returns the worker ID, generated when WORKER_ID is not set.
+func (w *Worker) ID() string {
+	return w.workerID
+}
+
+// pollInterval returns the current queue poll interval from the runtime configuration.
+func (w *Worker) pollInterval() time.Duration {
+	return w.runtime.Current().Worker.PollInterval.Duration
+}
+
+// consumeJobs pops up to limit jobs, only from priority queues when the worker belongs to the burst
+// pool. When its own queues stay empty for the poll interval, it steals a job from the queues of
+// stealTypes. Undecodable messages are quarantined and counted here, so the batch may be empty.
+func (w *Worker) consumeJobs(ctx context.Context, limit int) ([]*queue.SubmitJobMessage, error) {
+	var messages []*queue.SubmitJobMessage
+	var quarantined int
+	var err error
+	if w.config.PriorityOnly {
+		messages, quarantined, err = w.queue.ConsumePriorityJobs(ctx, w.pollInterval(), w.processingTypes, limit)
+	} else {
+		messages, quarantined, err = w.queue.ConsumeJobs(ctx, w.pollInterval(), w.processingTypes, limit)
+	}
+	if quarantined > 0 {
+		metrics.QuarantinedMessagesTotal.WithLabelValues(w.workerID, queue.PoisonReasonUndecodable).Add(float64(quarantined))
+		w.log.WarnContext(ctx, "quarantined undecodable messages", "count", quarantined, "worker_id", w.workerID)
+	}
+	if err == nil {
+		metrics.ConsumeBatchSize.WithLabelValues(w.workerID).Observe(float64(len(messages) + quarantined))
+		for _, message := range messages {
+			metrics.JobsConsumedTotal.WithLabelValues(w.workerID, "own", string(message.ProcessingType)).Inc()
+			observeQueueWait(message)
+		}
+	}
+	if !errors.Is(err, queue.ErrNoJobsAvailable) || len(w.stealTypes) == 0 {
+		return messages, err
+	}
+
+	stealStart := time.Now()
+	var message *queue.SubmitJobMessage
+	if w.config.PriorityOnly {
+		message, err = w.queue.StealPriorityJob(ctx, w.stealTypes)
+	} else {
+		message, err = w.queue.StealJob(ctx, w.stealTypes)
+	}
+	metrics.RedisOperationsTotal.WithLabelValues(w.workerID, "steal_job").Inc()
+	metrics.RedisOperationDuration.WithLabelValues(w.workerID, "steal_job").Observe(time.Since(stealStart).Seconds())
+	if errors.Is(err, queue.ErrMessageQuarantined) {
+		metrics.QuarantinedMessagesTotal.WithLabelValues(w.workerID, queue.PoisonReasonUndecodable).Inc()
+		w.log.WarnContext(ctx, "quarantined undecodable message", "error", err, "worker_id", w.workerID)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.JobsConsumedTotal.WithLabelValues(w.workerID, "stolen", string(message.ProcessingType)).Inc()
+	observeQueueWait(message)
+	w.log.InfoContext(ctx, "stole job from another processing type's queue",
+		"job_id", message.JobID, "queue", message.Queue, "worker_id", w.workerID)
+	return []*queue.SubmitJobMessage{message}, nil
+}
+
+// observeQueueWait records how long the job waited in the queue, unless it was queued by a version
+// that did not record when.
+func observeQueueWait(message *queue.SubmitJobMessage) {
+	if message.EnqueuedAt.IsZero() {
+		return
+	}
+
+	tenantID := message.TenantID
+	if tenantID == "" {
+		tenantID = tenant.DefaultID
+	}
+	metrics.JobQueueWaitSeconds.WithLabelValues(tenantID, string(message.ProcessingType)).
+		Observe(time.Since(message.EnqueuedAt).Seconds())
+}
+
+// consumedProcessingTypes parses the processing types configured in the variable, defaulting to
+// every built-in type and loaded plugin.
+func consumedProcessingTypes(configured []string, variable string, plugins *pluginRegistry) ([]database.ProcessingType, error) {
+	if len(configured) == 0 {
+		types := database.ProcessingTypes()
+		if plugins != nil {
+			for _, name := range plugins.names() {
+				types = append(types, database.ProcessingType(database.PluginProcessingTypePrefix+name))
+			}
+		}
+		return types, nil
+	}
+
+	types := make([]database.ProcessingType, 0, len(configured))
+	for _, name := range configured {
+		processingType, ok := database.ToProcessingType(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("invalid processing type %q in %s", name, variable)
+		}
+		types = append(types, processingType)
+	}
+	return types, nil
+}
+
 func (w *Worker) Start(ctx context.Context) error {
 	w.log.InfoContext(ctx, "starting worker",
 		"worker_id", w.workerID,
-		"concurrent_jobs", w.config.ConcurrentJobs)
+		"concurrent_jobs", w.config.ConcurrentJobs,
+		"processing_types", w.processingTypes,
+		"priority_only", w.config.PriorityOnly,
+		"steal_types", w.stealTypes)
+	metrics.WorkerPaused.WithLabelValues(w.workerID).Set(0)
 
 	var wg sync.WaitGroup
 
@@ -76,6 +261,18 @@ func (w *Worker) Start(ctx context.Context) error {
 		w.jobLoop(ctx)
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.heartbeatLoop(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.queue.WatchMemory(ctx, w.config.Redis.MemoryWatermark, w.config.Redis.MemoryCheckInterval)
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -86,10 +283,45 @@ func (w *Worker) Start(ctx context.Context) error {
 	wg.Wait()
 	close(w.doneCh)
 
+	if w.textProcessor.plugins != nil {
+		if err := w.textProcessor.plugins.close(context.WithoutCancel(ctx)); err != nil {
+			w.log.WarnContext(ctx, "failed to release plugins", "error", err)
+		}
+	}
+
+	if err := w.delivery.Close(); err != nil {
+		w.log.WarnContext(ctx, "failed to close result sinks", "error", err)
+	}
+
 	w.log.InfoContext(ctx, "worker stopped", "worker_id", w.workerID)
 	return nil
 }
 
+// heartbeatLoop records that the worker is alive every heartbeat interval until it stops, then
+// removes its heartbeat, so a clean shutdown is not mistaken for a dead worker.
+func (w *Worker) heartbeatLoop(ctx context.Context) {
+	ticker := time.NewTicker(w.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.queue.RecordHeartbeat(ctx, w.workerID); err != nil && ctx.Err() == nil {
+			w.log.WarnContext(ctx, "failed to record heartbeat", "error", err, "worker_id", w.workerID)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-w.shutdownCh:
+		case <-ticker.C:
+			continue
+		}
+
+		if err := w.queue.RemoveHeartbeats(context.WithoutCancel(ctx), w.workerID); err != nil {
+			w.log.WarnContext(ctx, "failed to remove heartbeat", "error", err, "worker_id", w.workerID)
+		}
+		return
+	}
+}
+
 func (w *Worker) Stop() {
 	w.log.Info("stopping worker", "worker_id", w.workerID)
 	close(w.shutdownCh)
@@ -106,43 +338,90 @@ func (w *Worker) jobLoop(ctx context.Context) {
 		case <-w.shutdownCh:
 			return
 		default:
+			if resumed := w.pausedUntil(); resumed != nil {
+				select {
+				case <-resumed:
+				case <-ctx.Done():
+					return
+				case <-w.shutdownCh:
+					return
+				}
+				continue
+			}
+
+			if w.processingPaused(ctx) {
+				select {
+				case <-time.After(w.pollInterval()):
+				case <-ctx.Done():
+					return
+				case <-w.shutdownCh:
+					return
+				}
+				continue
+			}
+
+			// A job slot is taken before consuming, so that consumed jobs start right away rather than
+			// wait in the worker, where they would be lost with it
+			select {
+			case w.jobSema <- struct{}{}:
+			case <-ctx.Done():
+				return
+			case <-w.shutdownCh:
+				return
+			}
+			// Only the job loop takes slots, so the slots free now are still free once the batch is in
+			limit := min(w.config.ConsumeBatchSize, 1+cap(w.jobSema)-len(w.jobSema))
+
 			consumeStart := time.Now()
-			message, err := w.queue.ConsumeJob(ctx, w.config.PollInterval)
+			messages, err := w.consumeJobs(ctx, limit)
 			metrics.RedisOperationsTotal.WithLabelValues(w.workerID, "consume_job").Inc()
 			metrics.RedisOperationDuration.WithLabelValues(w.workerID, "consume_job").Observe(time.Since(consumeStart).Seconds())
+			<-w.jobSema
 
 			if err != nil {
 				if errors.Is(err, queue.ErrNoJobsAvailable) {
 					w.log.DebugContext(ctx, "no jobs available, waiting", "worker_id", w.workerID)
-					time.Sleep(w.config.PollInterval)
+					time.Sleep(w.pollInterval())
 					continue
 				}
 				w.log.ErrorContext(ctx, "failed to consume job", "error", err, "worker_id", w.workerID)
-				time.Sleep(w.config.PollInterval)
+				time.Sleep(w.pollInterval())
 				continue
 			}
 
-			w.log.InfoContext(ctx, "received job",
-				"job_id", message.JobID,
-				"processing_type", message.ProcessingType,
-				"worker_id", w.workerID)
+			w.startJobs(ctx, messages)
+		}
+	}
+}
 
-			select {
-			case w.jobSema <- struct{}{}:
-				metrics.JobsActive.WithLabelValues(w.workerID).Inc()
-				go func(msg *queue.SubmitJobMessage) {
-					defer func() {
-						<-w.jobSema
-						metrics.JobsActive.WithLabelValues(w.workerID).Dec()
-					}()
-					w.processJob(ctx, msg)
-				}(message)
-			case <-ctx.Done():
-				return
-			case <-w.shutdownCh:
-				return
-			}
+// startJobs claims the consumed jobs and processes each claimed job in a job slot of its own.
+func (w *Worker) startJobs(ctx context.Context, messages []*queue.SubmitJobMessage) {
+	if len(messages) == 0 {
+		return
+	}
+
+	claimed := w.claimJobs(ctx, messages)
+	for i, message := range messages {
+		if !claimed[i] {
+			continue
 		}
+
+		w.log.InfoContext(ctx, "received job",
+			"job_id", message.JobID,
+			"processing_type", message.ProcessingType,
+			"worker_id", w.workerID)
+
+		w.jobSema <- struct{}{}
+		metrics.JobsActive.WithLabelValues(w.workerID).Inc()
+		done := w.trackInFlight(InFlightJob{JobID: message.JobID, ProcessingType: message.ProcessingType, StartedAt: time.Now().UTC()})
+		go func(msg *queue.SubmitJobMessage) {
+			defer func() {
+				done()
+				<-w.jobSema
+				metrics.JobsActive.WithLabelValues(w.workerID).Dec()
+			}()
+			w.processJob(ctx, msg)
+		}(message)
 	}
 }
 
@@ -150,8 +429,17 @@ type contextKey string
 
 const jobIDKey contextKey = "job_id"
 
+// jobSpanContext continues the trace of the request that submitted the job in a new span, or starts
+// a trace for messages published without one.
+func jobSpanContext(message *queue.SubmitJobMessage) tracing.SpanContext {
+	if sc, ok := tracing.Parse(message.Traceparent, message.Tracestate); ok {
+		return sc.Child()
+	}
+	return tracing.NewTrace()
+}
+
 func (w *Worker) processJob(ctx context.Context, message *queue.SubmitJobMessage) {
-	jobCtx := context.WithValue(ctx, jobIDKey, message.JobID)
+	jobCtx := tracing.WithSpanContext(context.WithValue(ctx, jobIDKey, message.JobID), jobSpanContext(message))
 	start := time.Now()
 
 	w.log.InfoContext(jobCtx, "processing job",
@@ -159,19 +447,27 @@ func (w *Worker) processJob(ctx context.Context, message *queue.SubmitJobMessage
 		"processing_type", message.ProcessingType,
 		"worker_id", w.workerID)
 
-	// Track job delay metric
-	if message.DelayMS > 0 {
-		const millisecondsToSeconds = 1000.0
-		metrics.JobDelaySeconds.WithLabelValues(w.workerID, string(message.ProcessingType)).Observe(float64(message.DelayMS) / millisecondsToSeconds)
+	if w.quarantinePoison(jobCtx, message) {
+		return
 	}
 
 	// Record database operation
 	updateStart := time.Now()
 	if err := w.repository.UpdateStatus(jobCtx, message.JobID, database.JobStatusRunning, &w.workerID); err != nil {
-		w.log.ErrorContext(jobCtx, "failed to update job status to running", "error", err, "job_id", message.JobID)
 		metrics.DBQueriesTotal.WithLabelValues(w.workerID, "update_status").Inc()
 		metrics.DBQueryDuration.WithLabelValues(w.workerID, "update_status").Observe(time.Since(updateStart).Seconds())
+		if errors.Is(err, database.ErrJobCanceled) {
+			// Canceled while queued: there is nothing to process nor to retry
+			w.log.InfoContext(jobCtx, "skipping canceled job", "job_id", message.JobID)
+			metrics.JobsProcessedTotal.WithLabelValues(w.workerID, string(message.ProcessingType), "canceled").Inc()
+			w.completeClaim(jobCtx, message)
+			return
+		}
+
+		w.log.ErrorContext(jobCtx, "failed to update job status to running", "error", err, "job_id", message.JobID)
+		w.recordDeliveryError(jobCtx, message, err)
 		metrics.JobsProcessedTotal.WithLabelValues(w.workerID, string(message.ProcessingType), "failed").Inc()
+		w.recordOutcome(jobCtx, message, true)
 
 		redisStart := time.Now()
 		if publishErr := w.queue.PublishToFailedQueue(jobCtx, *message, err.Error()); publishErr != nil {
@@ -179,22 +475,41 @@ func (w *Worker) processJob(ctx context.Context, message *queue.SubmitJobMessage
 		}
 		metrics.RedisOperationsTotal.WithLabelValues(w.workerID, "publish_failed").Inc()
 		metrics.RedisOperationDuration.WithLabelValues(w.workerID, "publish_failed").Observe(time.Since(redisStart).Seconds())
+
+		// The job was not processed, so a retry from the failed queue must not be dropped
+		if err := w.queue.ReleaseJobClaim(jobCtx, message.JobID); err != nil {
+			w.log.ErrorContext(jobCtx, "failed to release job claim", "error", err, "job_id", message.JobID)
+		}
 		return
 	}
 	metrics.DBQueriesTotal.WithLabelValues(w.workerID, "update_status").Inc()
 	metrics.DBQueryDuration.WithLabelValues(w.workerID, "update_status").Observe(time.Since(updateStart).Seconds())
+	w.publishEvent(jobCtx, events.JobStarted, message, nil)
 
 	processingJob := &ProcessingJob{
 		JobID:          message.JobID.String(),
 		FilePath:       message.FilePath,
+		SecondFilePath: message.SecondFilePath,
 		ProcessingType: message.ProcessingType,
 		Parameters:     message.Parameters,
-		DelayMS:        message.DelayMS,
+
+		OriginalFilename:       message.OriginalFilename,
+		SecondOriginalFilename: message.SecondOriginalFilename,
 	}
 
-	outputPath, err := w.textProcessor.Process(jobCtx, processingJob)
+	// The simulated delay is not processing time, so processing durations and usage start after it
+	err := w.simulateDelay(jobCtx, message)
+	processStart := time.Now()
+	meter := startUsageMeter()
+	var outputPath string
+	if err == nil {
+		outputPath, err = w.processWithRetry(jobCtx, message, processingJob)
+	}
+	usage := meter.stop(w.fsys, processingJob, outputPath)
+	w.recordUsage(jobCtx, message, usage)
 	if err != nil {
 		w.log.ErrorContext(jobCtx, "processor failed", "error", err, "job_id", message.JobID)
+		w.recordDeliveryError(jobCtx, message, err)
 		updateStart := time.Now()
 		if updateErr := w.repository.UpdateError(jobCtx, message.JobID, err.Error()); updateErr != nil {
 			w.log.ErrorContext(jobCtx, "failed to update job error", "error", updateErr, "job_id", message.JobID)
@@ -202,12 +517,23 @@ func (w *Worker) processJob(ctx context.Context, message *queue.SubmitJobMessage
 		metrics.DBQueriesTotal.WithLabelValues(w.workerID, "update_error").Inc()
 		metrics.DBQueryDuration.WithLabelValues(w.workerID, "update_error").Observe(time.Since(updateStart).Seconds())
 		metrics.JobsProcessedTotal.WithLabelValues(w.workerID, string(message.ProcessingType), "failed").Inc()
-		metrics.JobProcessingDuration.WithLabelValues(w.workerID, string(message.ProcessingType)).Observe(time.Since(start).Seconds())
+		w.ackJob(jobCtx, message, true, 0)
+		metrics.JobProcessingDuration.WithLabelValues(w.workerID, string(message.ProcessingType)).
+			ObserveWithTraceID(time.Since(processStart).Seconds(), message.TraceID)
+		w.publishEvent(jobCtx, events.JobFailed, message, map[string]any{"error": err.Error()})
+		w.queueEmail(jobCtx, message, err)
 		return
 	}
+	processingJob.progress.complete()
 
 	updateStart = time.Now()
-	if err := w.repository.UpdateResult(jobCtx, message.JobID, outputPath); err != nil {
+	result := database.ResultVersion{
+		Version: processingJob.version,
+		Path:    outputPath,
+		Shared:  processingJob.sharedResult,
+		Replace: w.config.ResultOverwritePolicy == config.ResultPolicyOverwrite,
+	}
+	if err := w.repository.UpdateResult(jobCtx, message.JobID, result); err != nil {
 		w.log.ErrorContext(jobCtx, "failed to update job result", "error", err, "job_id", message.JobID)
 		metrics.DBQueriesTotal.WithLabelValues(w.workerID, "update_result").Inc()
 		metrics.DBQueryDuration.WithLabelValues(w.workerID, "update_result").Observe(time.Since(updateStart).Seconds())
@@ -215,15 +541,38 @@ func (w *Worker) processJob(ctx context.Context, message *queue.SubmitJobMessage
 			w.log.ErrorContext(jobCtx, "failed to update job error after result update failure", "error", updateErr, "job_id", message.JobID)
 		}
 		metrics.JobsProcessedTotal.WithLabelValues(w.workerID, string(message.ProcessingType), "failed").Inc()
-		metrics.JobProcessingDuration.WithLabelValues(w.workerID, string(message.ProcessingType)).Observe(time.Since(start).Seconds())
+		w.ackJob(jobCtx, message, true, 0)
+		metrics.JobProcessingDuration.WithLabelValues(w.workerID, string(message.ProcessingType)).
+			ObserveWithTraceID(time.Since(processStart).Seconds(), message.TraceID)
+		w.publishEvent(jobCtx, events.JobFailed, message, map[string]any{"error": err.Error()})
+		w.queueEmail(jobCtx, message, err)
 		return
 	}
 	metrics.DBQueriesTotal.WithLabelValues(w.workerID, "update_result").Inc()
 	metrics.DBQueryDuration.WithLabelValues(w.workerID, "update_result").Observe(time.Since(updateStart).Seconds())
+	resultBytes := usage.BytesWritten
+	if processingJob.sharedResult {
+		// The bytes are already counted against the input
+		resultBytes = 0
+	}
+	w.recordStorage(jobCtx, message, resultBytes)
 
 	// Record successful job completion
 	metrics.JobsProcessedTotal.WithLabelValues(w.workerID, string(message.ProcessingType), "success").Inc()
-	metrics.JobProcessingDuration.WithLabelValues(w.workerID, string(message.ProcessingType)).Observe(time.Since(start).Seconds())
+	// The duration feeds the completion estimates of queued jobs
+	w.ackJob(jobCtx, message, false, time.Since(start))
+	metrics.JobProcessingDuration.WithLabelValues(w.workerID, string(message.ProcessingType)).
+		ObserveWithTraceID(time.Since(processStart).Seconds(), message.TraceID)
+
+	data := map[string]any{
+		"result_path": outputPath,
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+	if failedSinks := w.deliverResult(jobCtx, message, outputPath); len(failedSinks) > 0 {
+		data["failed_sinks"] = failedSinks
+	}
+	w.publishEvent(jobCtx, events.JobSucceeded, message, data)
+	w.queueEmail(jobCtx, message, nil)
 
 	w.log.InfoContext(jobCtx, "job completed successfully",
 		"job_id", message.JobID,
@@ -231,6 +580,232 @@ func (w *Worker) processJob(ctx context.Context, message *queue.SubmitJobMessage
 		"worker_id", w.workerID)
 }
 
+// deliverResult pushes the result of a succeeded job to the result sinks of its sinks parameter
+// and returns the sinks it could not be delivered to. The job stays succeeded either way.
+func (w *Worker) deliverResult(ctx context.Context, message *queue.SubmitJobMessage, outputPath string) []string {
+	sinks := database.ResultSinksFrom(message.Parameters)
+	if len(sinks) == 0 {
+		return nil
+	}
+
+	failed := w.delivery.Deliver(ctx, delivery.Result{
+		JobID:          message.JobID,
+		TenantID:       message.TenantID,
+		ProcessingType: message.ProcessingType,
+		Path:           outputPath,
+	}, sinks)
+	return slices.Sorted(maps.Keys(failed))
+}
+
+// recordOutcome counts the finished job for the failure rate alert of the controller; a failure
+// only skews the rate.
+func (w *Worker) recordOutcome(ctx context.Context, message *queue.SubmitJobMessage, failed bool) {
+	if err := w.queue.RecordJobOutcome(ctx, failed); err != nil {
+		w.log.WarnContext(ctx, "failed to record job outcome", "error", err, "job_id", message.JobID)
+	}
+}
+
+// claimJobs claims the jobs in the idempotency ledger in one round trip and returns for each job
+// whether to process it: not for a duplicate delivery of a job another delivery is processing or
+// has processed. When the ledger is unreachable the jobs are processed anyway: a possible duplicate
+// is preferred over a lost job.
+func (w *Worker) claimJobs(ctx context.Context, messages []*queue.SubmitJobMessage) []bool {
+	jobIDs := make([]uuid.UUID, len(messages))
+	for i, message := range messages {
+		jobIDs[i] = message.JobID
+	}
+
+	process := make([]bool, len(messages))
+	redisStart := time.Now()
+	claims, err := w.queue.ClaimJobs(ctx, jobIDs, w.workerID, w.config.ClaimLease)
+	metrics.RedisOperationsTotal.WithLabelValues(w.workerID, "claim_job").Inc()
+	metrics.RedisOperationDuration.WithLabelValues(w.workerID, "claim_job").Observe(time.Since(redisStart).Seconds())
+
+	if err != nil {
+		w.log.WarnContext(ctx, "failed to claim jobs, processing without deduplication", "error", err, "jobs", len(messages))
+		for i := range process {
+			process[i] = true
+		}
+		return process
+	}
+
+	for i, message := range messages {
+		process[i] = claims[i].Claimed
+		if claims[i].Claimed {
+			continue
+		}
+
+		metrics.DuplicateDeliveriesTotal.WithLabelValues(w.workerID, string(message.ProcessingType)).Inc()
+		w.log.WarnContext(ctx, "skipping duplicate job delivery",
+			"job_id", message.JobID,
+			"processing_type", message.ProcessingType,
+			"claimed_by", claims[i].Holder,
+			"worker_id", w.workerID)
+	}
+	return process
+}
+
+// quarantinePoison counts the delivery of the job and, once it was delivered more than
+// MaxDeliveries times without completing, quarantines the message in the poison queue and fails the
+// job instead of processing it again. It returns whether the message was quarantined.
+func (w *Worker) quarantinePoison(ctx context.Context, message *queue.SubmitJobMessage) bool {
+	deliveries, err := w.queue.RecordDelivery(ctx, message.JobID, w.workerID)
+	if err != nil {
+		w.log.WarnContext(ctx, "failed to count job delivery", "error", err, "job_id", message.JobID)
+		return false
+	}
+	if deliveries.Count <= w.config.MaxDeliveries {
+		return false
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		w.log.ErrorContext(ctx, "failed to encode poison message", "error", err, "job_id", message.JobID)
+		return false
+	}
+
+	diagnosis := fmt.Sprintf("delivered %d times, more than the %d allowed, without completing", deliveries.Count, w.config.MaxDeliveries)
+	poison := queue.PoisonMessage{
+		JobID:          message.JobID,
+		ProcessingType: message.ProcessingType,
+		Queue:          message.Queue,
+		Payload:        string(payload),
+		Reason:         queue.PoisonReasonMaxDeliveries,
+		Diagnosis:      diagnosis,
+		Deliveries:     deliveries.Count,
+		LastError:      deliveries.LastError,
+		WorkerID:       deliveries.LastWorker,
+	}
+	if err := w.queue.Quarantine(ctx, poison); err != nil {
+		// Processing once more beats losing the job
+		w.log.ErrorContext(ctx, "failed to quarantine poison message", "error", err, "job_id", message.JobID)
+		return false
+	}
+
+	metrics.QuarantinedMessagesTotal.WithLabelValues(w.workerID, queue.PoisonReasonMaxDeliveries).Inc()
+	w.log.WarnContext(ctx, "quarantined poison message",
+		"job_id", message.JobID,
+		"processing_type", message.ProcessingType,
+		"deliveries", deliveries.Count,
+		"last_error", deliveries.LastError,
+		"worker_id", w.workerID)
+
+	if err := w.repository.UpdateError(ctx, message.JobID, "quarantined as a poison message: "+diagnosis); err != nil {
+		w.log.ErrorContext(ctx, "failed to fail quarantined job", "error", err, "job_id", message.JobID)
+	}
+	w.publishEvent(ctx, events.JobFailed, message, map[string]any{"error": diagnosis, "quarantined": true})
+	w.completeClaim(ctx, message)
+	return true
+}
+
+// recordDeliveryError keeps why the delivery failed for the diagnosis of a later quarantine.
+func (w *Worker) recordDeliveryError(ctx context.Context, message *queue.SubmitJobMessage, err error) {
+	if recordErr := w.queue.RecordDeliveryError(ctx, message.JobID, err.Error()); recordErr != nil {
+		w.log.WarnContext(ctx, "failed to record delivery error", "error", recordErr, "job_id", message.JobID)
+	}
+}
+
+// ackJob records that the job reached a terminal status: its claim is kept so later deliveries are
+// dropped as duplicates, its outcome counts for the failure rate alert of the controller and, when
+// not zero, its duration for the completion estimates of queued jobs. A failure only skews those.
+func (w *Worker) ackJob(ctx context.Context, message *queue.SubmitJobMessage, failed bool, duration time.Duration) {
+	redisStart := time.Now()
+	// Shutdown cancels ctx, but a processed job must still be recorded
+	err := w.queue.AckJob(context.WithoutCancel(ctx), queue.JobAck{
+		JobID:          message.JobID,
+		ProcessingType: message.ProcessingType,
+		WorkerID:       w.workerID,
+		ClaimTTL:       w.config.ClaimTTL,
+		Failed:         failed,
+		Duration:       duration,
+	})
+	if err != nil {
+		w.log.WarnContext(ctx, "failed to ack job", "error", err, "job_id", message.JobID)
+	}
+	metrics.RedisOperationsTotal.WithLabelValues(w.workerID, "ack_job").Inc()
+	metrics.RedisOperationDuration.WithLabelValues(w.workerID, "ack_job").Observe(time.Since(redisStart).Seconds())
+}
+
+// completeClaim keeps the claim of a job that reached a terminal status, so later deliveries are
+// dropped as duplicates.
+func (w *Worker) completeClaim(ctx context.Context, message *queue.SubmitJobMessage) {
+	// Shutdown cancels ctx, but a processed job must still be recorded
+	if err := w.queue.CompleteJobClaim(context.WithoutCancel(ctx), message.JobID, w.workerID, w.config.ClaimTTL); err != nil {
+		w.log.WarnContext(ctx, "failed to complete job claim", "error", err, "job_id", message.JobID)
+	}
+}
+
+// newProgressTracker tracks the job's progress through its input files, reporting it to the queue
+// for the API to show. Reporting failures are logged only: progress must never fail a job.
+func (w *Worker) newProgressTracker(ctx context.Context, message *queue.SubmitJobMessage) *progressTracker {
+	total := fileSize(w.fsys, message.FilePath) + fileSize(w.fsys, message.SecondFilePath)
+
+	return newProgressTracker(total, func(progress queue.JobProgress) {
+		// Progress keys only add to Redis memory while it is short of it
+		if w.queue.MemoryHigh() {
+			return
+		}
+
+		redisStart := time.Now()
+		if err := w.queue.SetJobProgress(ctx, message.JobID, progress); err != nil {
+			w.log.WarnContext(ctx, "failed to report job progress", "error", err, "job_id", message.JobID)
+		}
+		metrics.RedisOperationsTotal.WithLabelValues(w.workerID, "set_progress").Inc()
+		metrics.RedisOperationDuration.WithLabelValues(w.workerID, "set_progress").Observe(time.Since(redisStart).Seconds())
+	})
+}
+
+// recordUsage persists a job's resource usage and adds it to the accounting counters.
+// Failures are logged only: usage must never fail a job.
+func (w *Worker) recordUsage(ctx context.Context, message *queue.SubmitJobMessage, usage database.JobUsage) {
+	tenantID := message.TenantID
+	if tenantID == "" {
+		tenantID = tenant.DefaultID
+	}
+
+	const millisecondsToSeconds = 1000.0
+	labels := []string{tenantID, string(message.ProcessingType)}
+	metrics.JobCPUSecondsTotal.WithLabelValues(labels...).Add(float64(usage.CPUTimeMS) / millisecondsToSeconds)
+	metrics.JobWallSecondsTotal.WithLabelValues(labels...).Add(float64(usage.WallTimeMS) / millisecondsToSeconds)
+	metrics.JobBytesReadTotal.WithLabelValues(labels...).Add(float64(usage.BytesRead))
+	metrics.JobBytesWrittenTotal.WithLabelValues(labels...).Add(float64(usage.BytesWritten))
+
+	updateStart := time.Now()
+	if err := w.repository.RecordUsage(ctx, message.JobID, usage); err != nil {
+		w.log.ErrorContext(ctx, "failed to record job usage", "error", err, "job_id", message.JobID)
+	}
+	metrics.DBQueriesTotal.WithLabelValues(w.workerID, "record_usage").Inc()
+	metrics.DBQueryDuration.WithLabelValues(w.workerID, "record_usage").Observe(time.Since(updateStart).Seconds())
+}
+
+// recordStorage counts the result file against the tenant's storage usage. The quota is enforced
+// at upload time only, so a result is always kept even if it takes the tenant over the cap.
+func (w *Worker) recordStorage(ctx context.Context, message *queue.SubmitJobMessage, resultBytes int64) {
+	tenantID := message.TenantID
+	if tenantID == "" {
+		tenantID = tenant.DefaultID
+	}
+
+	updateStart := time.Now()
+	if err := w.repository.AddStorageUsage(ctx, tenantID, database.StorageDelta{ResultBytes: resultBytes, Files: 1}); err != nil {
+		w.log.ErrorContext(ctx, "failed to record result storage", "error", err, "job_id", message.JobID)
+	}
+	metrics.DBQueriesTotal.WithLabelValues(w.workerID, "add_storage_usage").Inc()
+	metrics.DBQueryDuration.WithLabelValues(w.workerID, "add_storage_usage").Observe(time.Since(updateStart).Seconds())
+}
+
+func (w *Worker) publishEvent(ctx context.Context, eventType events.Type, message *queue.SubmitJobMessage, data map[string]any) {
+	if data == nil {
+		data = make(map[string]any)
+	}
+	data["worker_id"] = w.workerID
+	data["processing_type"] = message.ProcessingType
+
+	event := events.New(eventType, message.JobID, w.workerID, data)
+	event.TenantID = message.TenantID
+	w.events.Publish(ctx, event)
+}
+
 func (w *Worker) HealthCheck(ctx context.Context) error {
 	if err := w.repository.HealthCheck(ctx); err != nil {
 		return fmt.Errorf("database health check failed: %w", err)
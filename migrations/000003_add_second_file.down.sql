@@ -0,0 +1,3 @@
+-- Remove second input file columns
+ALTER TABLE jobs DROP COLUMN IF EXISTS second_file_path;
+ALTER TABLE jobs DROP COLUMN IF EXISTS second_original_filename;
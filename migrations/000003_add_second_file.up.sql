@@ -0,0 +1,3 @@
+-- Add second input file columns for two-file processing types such as diff
+ALTER TABLE jobs ADD COLUMN second_original_filename VARCHAR(255);
+ALTER TABLE jobs ADD COLUMN second_file_path VARCHAR(500);
@@ -0,0 +1,8 @@
+-- Remove tenant ownership and per-job resource accounting
+DROP INDEX IF EXISTS idx_jobs_tenant_completed_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS bytes_written;
+ALTER TABLE jobs DROP COLUMN IF EXISTS bytes_read;
+ALTER TABLE jobs DROP COLUMN IF EXISTS peak_memory_bytes;
+ALTER TABLE jobs DROP COLUMN IF EXISTS wall_time_ms;
+ALTER TABLE jobs DROP COLUMN IF EXISTS cpu_time_ms;
+ALTER TABLE jobs DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,10 @@
+-- Add tenant ownership and per-job resource accounting
+ALTER TABLE jobs ADD COLUMN tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE jobs ADD COLUMN cpu_time_ms BIGINT;
+ALTER TABLE jobs ADD COLUMN wall_time_ms BIGINT;
+ALTER TABLE jobs ADD COLUMN peak_memory_bytes BIGINT;
+ALTER TABLE jobs ADD COLUMN bytes_read BIGINT;
+ALTER TABLE jobs ADD COLUMN bytes_written BIGINT;
+
+-- Usage reports aggregate by tenant over completion time
+CREATE INDEX IF NOT EXISTS idx_jobs_tenant_completed_at ON jobs(tenant_id, completed_at);
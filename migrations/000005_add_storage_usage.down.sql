@@ -0,0 +1,5 @@
+-- Remove per-tenant storage accounting
+DROP INDEX IF EXISTS idx_jobs_result_path;
+DROP INDEX IF EXISTS idx_jobs_second_file_path;
+DROP INDEX IF EXISTS idx_jobs_file_path;
+DROP TABLE IF EXISTS storage_usage;
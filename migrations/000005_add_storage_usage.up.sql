@@ -0,0 +1,13 @@
+-- Per-tenant storage accounting: bytes of uploaded inputs and result files currently on disk
+CREATE TABLE IF NOT EXISTS storage_usage (
+    tenant_id VARCHAR(64) PRIMARY KEY,
+    upload_bytes BIGINT NOT NULL DEFAULT 0,
+    result_bytes BIGINT NOT NULL DEFAULT 0,
+    files BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- The file cleanup resolves removed files to their tenant by path
+CREATE INDEX IF NOT EXISTS idx_jobs_file_path ON jobs(file_path);
+CREATE INDEX IF NOT EXISTS idx_jobs_second_file_path ON jobs(second_file_path);
+CREATE INDEX IF NOT EXISTS idx_jobs_result_path ON jobs(result_path);
@@ -0,0 +1,2 @@
+-- Remove the original metadata of imported jobs
+ALTER TABLE jobs DROP COLUMN IF EXISTS imported_from;
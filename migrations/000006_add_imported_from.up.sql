@@ -0,0 +1,2 @@
+-- Record the original metadata of jobs restored from an export archive
+ALTER TABLE jobs ADD COLUMN imported_from JSONB;
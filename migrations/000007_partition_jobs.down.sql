@@ -0,0 +1,35 @@
+-- Move jobs back into a single unpartitioned table
+DROP TRIGGER IF EXISTS jobs_track_id ON jobs;
+DROP FUNCTION IF EXISTS jobs_track_id();
+DROP TABLE IF EXISTS job_ids;
+
+ALTER TABLE jobs RENAME TO jobs_partitioned;
+ALTER TABLE jobs_partitioned RENAME CONSTRAINT jobs_pkey TO jobs_partitioned_pkey;
+DROP INDEX IF EXISTS idx_jobs_id;
+DROP INDEX IF EXISTS idx_jobs_status;
+DROP INDEX IF EXISTS idx_jobs_created_at;
+DROP INDEX IF EXISTS idx_jobs_processing_type;
+DROP INDEX IF EXISTS idx_jobs_worker_id;
+DROP INDEX IF EXISTS idx_jobs_delay_ms;
+DROP INDEX IF EXISTS idx_jobs_tenant_completed_at;
+DROP INDEX IF EXISTS idx_jobs_file_path;
+DROP INDEX IF EXISTS idx_jobs_second_file_path;
+DROP INDEX IF EXISTS idx_jobs_result_path;
+
+CREATE TABLE jobs (LIKE jobs_partitioned INCLUDING DEFAULTS);
+ALTER TABLE jobs ADD PRIMARY KEY (id);
+ALTER TABLE jobs ALTER COLUMN created_at DROP NOT NULL;
+
+INSERT INTO jobs SELECT * FROM jobs_partitioned;
+
+DROP TABLE jobs_partitioned;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs(created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_processing_type ON jobs(processing_type);
+CREATE INDEX IF NOT EXISTS idx_jobs_worker_id ON jobs(worker_id);
+CREATE INDEX IF NOT EXISTS idx_jobs_delay_ms ON jobs(delay_ms);
+CREATE INDEX IF NOT EXISTS idx_jobs_tenant_completed_at ON jobs(tenant_id, completed_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_file_path ON jobs(file_path);
+CREATE INDEX IF NOT EXISTS idx_jobs_second_file_path ON jobs(second_file_path);
+CREATE INDEX IF NOT EXISTS idx_jobs_result_path ON jobs(result_path);
@@ -0,0 +1,104 @@
+-- Range-partition jobs by month of creation so old months can be dropped instead of deleted
+-- row by row. The partition key must be part of the primary key, so uniqueness of job IDs
+-- across partitions is kept by the job_ids table, filled by a trigger on insert.
+ALTER TABLE jobs RENAME TO jobs_unpartitioned;
+ALTER TABLE jobs_unpartitioned RENAME CONSTRAINT jobs_pkey TO jobs_unpartitioned_pkey;
+DROP INDEX IF EXISTS idx_jobs_status;
+DROP INDEX IF EXISTS idx_jobs_created_at;
+DROP INDEX IF EXISTS idx_jobs_processing_type;
+DROP INDEX IF EXISTS idx_jobs_worker_id;
+DROP INDEX IF EXISTS idx_jobs_delay_ms;
+DROP INDEX IF EXISTS idx_jobs_tenant_completed_at;
+DROP INDEX IF EXISTS idx_jobs_file_path;
+DROP INDEX IF EXISTS idx_jobs_second_file_path;
+DROP INDEX IF EXISTS idx_jobs_result_path;
+
+CREATE TABLE jobs (
+    id UUID NOT NULL DEFAULT gen_random_uuid(),
+    original_filename VARCHAR(255) NOT NULL,
+    file_path VARCHAR(500) NOT NULL,
+    processing_type VARCHAR(100) NOT NULL,
+    parameters JSONB,
+    status VARCHAR(50) DEFAULT 'pending',
+    result_path VARCHAR(500),
+    error_message TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    worker_id VARCHAR(255),
+    delay_ms INTEGER DEFAULT 0,
+    second_original_filename VARCHAR(255),
+    second_file_path VARCHAR(500),
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    cpu_time_ms BIGINT,
+    wall_time_ms BIGINT,
+    peak_memory_bytes BIGINT,
+    bytes_read BIGINT,
+    bytes_written BIGINT,
+    imported_from JSONB,
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+-- Catches jobs outside the monthly partitions, e.g. imported ones far in the past
+CREATE TABLE jobs_default PARTITION OF jobs DEFAULT;
+
+-- One partition per month from the oldest job up to two months ahead; the API creates
+-- further ones as time goes on
+DO $$
+DECLARE
+    month_start TIMESTAMP := date_trunc('month', COALESCE((SELECT MIN(created_at) FROM jobs_unpartitioned), NOW()));
+BEGIN
+    WHILE month_start <= date_trunc('month', NOW()) + INTERVAL '2 months' LOOP
+        EXECUTE format('CREATE TABLE %I PARTITION OF jobs FOR VALUES FROM (%L) TO (%L)',
+            'jobs_' || to_char(month_start, '"y"YYYY"m"MM'), month_start, month_start + INTERVAL '1 month');
+        month_start := month_start + INTERVAL '1 month';
+    END LOOP;
+END $$;
+
+INSERT INTO jobs (id, original_filename, file_path, processing_type, parameters, status, result_path,
+    error_message, created_at, started_at, completed_at, worker_id, delay_ms, second_original_filename,
+    second_file_path, tenant_id, cpu_time_ms, wall_time_ms, peak_memory_bytes, bytes_read, bytes_written,
+    imported_from)
+SELECT id, original_filename, file_path, processing_type, parameters, status, result_path,
+    error_message, COALESCE(created_at, NOW()), started_at, completed_at, worker_id, delay_ms, second_original_filename,
+    second_file_path, tenant_id, cpu_time_ms, wall_time_ms, peak_memory_bytes, bytes_read, bytes_written,
+    imported_from
+FROM jobs_unpartitioned;
+
+DROP TABLE jobs_unpartitioned;
+
+CREATE INDEX IF NOT EXISTS idx_jobs_id ON jobs(id);
+CREATE INDEX IF NOT EXISTS idx_jobs_status ON jobs(status);
+CREATE INDEX IF NOT EXISTS idx_jobs_created_at ON jobs(created_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_processing_type ON jobs(processing_type);
+CREATE INDEX IF NOT EXISTS idx_jobs_worker_id ON jobs(worker_id);
+CREATE INDEX IF NOT EXISTS idx_jobs_delay_ms ON jobs(delay_ms);
+CREATE INDEX IF NOT EXISTS idx_jobs_tenant_completed_at ON jobs(tenant_id, completed_at);
+CREATE INDEX IF NOT EXISTS idx_jobs_file_path ON jobs(file_path);
+CREATE INDEX IF NOT EXISTS idx_jobs_second_file_path ON jobs(second_file_path);
+CREATE INDEX IF NOT EXISTS idx_jobs_result_path ON jobs(result_path);
+
+-- Job IDs are unique across partitions; a duplicate raises unique_violation on insert as before.
+-- created_at lets lookups by ID target the partition holding the job.
+CREATE TABLE IF NOT EXISTS job_ids (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO job_ids (id, created_at) SELECT id, created_at FROM jobs;
+
+CREATE INDEX IF NOT EXISTS idx_job_ids_created_at ON job_ids(created_at);
+
+CREATE OR REPLACE FUNCTION jobs_track_id() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO job_ids (id, created_at) VALUES (NEW.id, NEW.created_at);
+    ELSE
+        DELETE FROM job_ids WHERE id = OLD.id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER jobs_track_id AFTER INSERT OR DELETE ON jobs
+    FOR EACH ROW EXECUTE FUNCTION jobs_track_id();
@@ -0,0 +1,5 @@
+-- Remove the per-status job counts
+DROP TRIGGER IF EXISTS jobs_count_status_update ON jobs;
+DROP TRIGGER IF EXISTS jobs_count_status_insert_delete ON jobs;
+DROP FUNCTION IF EXISTS jobs_count_status();
+DROP TABLE IF EXISTS job_status_counts;
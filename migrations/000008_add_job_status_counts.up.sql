@@ -0,0 +1,27 @@
+-- Job counts per status, kept current by a trigger so /stats does not count the jobs table
+CREATE TABLE IF NOT EXISTS job_status_counts (
+    status VARCHAR(50) PRIMARY KEY,
+    count BIGINT NOT NULL DEFAULT 0
+);
+
+INSERT INTO job_status_counts (status, count)
+SELECT status, COUNT(*) FROM jobs WHERE status IS NOT NULL GROUP BY status;
+
+CREATE OR REPLACE FUNCTION jobs_count_status() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') AND OLD.status IS NOT NULL THEN
+        UPDATE job_status_counts SET count = count - 1 WHERE status = OLD.status;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') AND NEW.status IS NOT NULL THEN
+        INSERT INTO job_status_counts (status, count) VALUES (NEW.status, 1)
+        ON CONFLICT (status) DO UPDATE SET count = job_status_counts.count + 1;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER jobs_count_status_insert_delete AFTER INSERT OR DELETE ON jobs
+    FOR EACH ROW EXECUTE FUNCTION jobs_count_status();
+
+CREATE TRIGGER jobs_count_status_update AFTER UPDATE OF status ON jobs
+    FOR EACH ROW WHEN (OLD.status IS DISTINCT FROM NEW.status) EXECUTE FUNCTION jobs_count_status();
@@ -0,0 +1,3 @@
+-- Remove the daily bandwidth accounting
+DROP INDEX IF EXISTS idx_bandwidth_usage_tenant_day;
+DROP TABLE IF EXISTS bandwidth_usage;
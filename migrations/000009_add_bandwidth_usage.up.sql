@@ -0,0 +1,13 @@
+-- Daily request and response body bytes per tenant and API route, accumulated by every API replica
+CREATE TABLE IF NOT EXISTS bandwidth_usage (
+    day DATE NOT NULL,
+    tenant_id VARCHAR(64) NOT NULL,
+    route VARCHAR(255) NOT NULL,
+    requests BIGINT NOT NULL DEFAULT 0,
+    bytes_in BIGINT NOT NULL DEFAULT 0,
+    bytes_out BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, tenant_id, route)
+);
+
+-- Usage reports select by tenant over a range of days
+CREATE INDEX IF NOT EXISTS idx_bandwidth_usage_tenant_day ON bandwidth_usage(tenant_id, day);
@@ -0,0 +1,2 @@
+-- Remove the flag of results sharing the bytes of their input
+ALTER TABLE jobs DROP COLUMN IF EXISTS result_shared;
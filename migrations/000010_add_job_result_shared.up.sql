@@ -0,0 +1,2 @@
+-- Results linked to their input share its bytes, which only count once against storage quotas
+ALTER TABLE jobs ADD COLUMN result_shared BOOLEAN NOT NULL DEFAULT false;
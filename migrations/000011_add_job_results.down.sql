@@ -0,0 +1,4 @@
+-- Remove result versions; jobs keep their canonical result
+DROP INDEX IF EXISTS idx_job_results_result_path;
+DROP TABLE IF EXISTS job_results;
+ALTER TABLE jobs DROP COLUMN IF EXISTS attempts;
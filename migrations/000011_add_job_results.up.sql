@@ -0,0 +1,24 @@
+-- Every attempt of a job writes its own result version. jobs.result_path stays the canonical,
+-- i.e. latest successful, one; attempts counts deliveries to workers, numbering the versions.
+ALTER TABLE jobs ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS job_results (
+    job_id UUID NOT NULL REFERENCES job_ids(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    result_path VARCHAR(500) NOT NULL,
+    result_shared BOOLEAN NOT NULL DEFAULT false,
+    worker_id VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (job_id, version)
+);
+
+-- Storage accounting and cleanup look results up by path
+CREATE INDEX IF NOT EXISTS idx_job_results_result_path ON job_results(result_path);
+
+-- Results written before versioning become version 1 of their job
+INSERT INTO job_results (job_id, version, result_path, result_shared, worker_id, created_at)
+SELECT id, 1, result_path, result_shared, worker_id, COALESCE(completed_at, created_at)
+FROM jobs
+WHERE result_path IS NOT NULL AND result_path <> '';
+
+UPDATE jobs SET attempts = 1 WHERE status <> 'pending';
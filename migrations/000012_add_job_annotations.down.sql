@@ -0,0 +1,5 @@
+-- Remove job annotations
+ALTER TABLE jobs DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE jobs DROP COLUMN IF EXISTS revision;
+ALTER TABLE jobs DROP COLUMN IF EXISTS labels;
+ALTER TABLE jobs DROP COLUMN IF EXISTS notes;
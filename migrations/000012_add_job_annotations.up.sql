@@ -0,0 +1,6 @@
+-- Notes and labels clients attach to jobs after creation, for triage. revision counts the changes
+-- to them, which clients send back to update from the state they read.
+ALTER TABLE jobs ADD COLUMN notes TEXT;
+ALTER TABLE jobs ADD COLUMN labels JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE jobs ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE jobs ADD COLUMN updated_at TIMESTAMP;
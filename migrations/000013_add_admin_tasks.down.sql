@@ -0,0 +1,3 @@
+-- Remove admin task tracking; canceled jobs keep their status
+DROP INDEX IF EXISTS idx_admin_tasks_created_at;
+DROP TABLE IF EXISTS admin_tasks;
@@ -0,0 +1,19 @@
+-- Long-running admin operations, such as bulk cancels and retries of jobs, run in the background
+-- and record their progress here for clients to follow
+CREATE TABLE IF NOT EXISTS admin_tasks (
+    id UUID PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    params JSONB NOT NULL DEFAULT '{}',
+    total BIGINT NOT NULL DEFAULT 0,
+    processed BIGINT NOT NULL DEFAULT 0,
+    succeeded BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
+    error_message TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_admin_tasks_created_at ON admin_tasks(created_at);
@@ -0,0 +1,5 @@
+-- Remove the admin task runner state
+DROP INDEX IF EXISTS idx_admin_tasks_status_updated_at;
+ALTER TABLE admin_tasks DROP COLUMN IF EXISTS result;
+ALTER TABLE admin_tasks DROP COLUMN IF EXISTS cancel_requested;
+ALTER TABLE admin_tasks DROP COLUMN IF EXISTS runner_id;
@@ -0,0 +1,10 @@
+-- Admin tasks are queued in Redis and run by any API replica: runner_id is the replica running the
+-- task, whose progress updates keep updated_at fresh, cancel_requested asks it to stop and result
+-- holds the outcome of the task, such as the archive an export wrote
+ALTER TABLE admin_tasks
+    ADD COLUMN IF NOT EXISTS runner_id VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS result JSONB;
+
+-- Finds the tasks whose replica stopped reporting progress
+CREATE INDEX IF NOT EXISTS idx_admin_tasks_status_updated_at ON admin_tasks(status, updated_at);